@@ -33,6 +33,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/version"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
 	acssession "github.com/aws/amazon-ecs-agent/ecs-agent/acs/session"
 	rolecredentials "github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/doctor"
@@ -109,6 +110,8 @@ type session struct {
 	sendCredentials                 bool
 	latestSeqNumTaskManifest        *int64
 	doctor                          *doctor.Doctor
+	payloadRejections               *PayloadRejectionHistory
+	connections                     *wsclient.ConnectionTracker
 	_heartbeatTimeout               time.Duration
 	_heartbeatJitter                time.Duration
 	connectionTime                  time.Duration
@@ -133,6 +136,8 @@ func NewSession(
 	latestSeqNumTaskManifest *int64,
 	doctor *doctor.Doctor,
 	clientFactory wsclient.ClientFactory,
+	payloadRejections *PayloadRejectionHistory,
+	connections *wsclient.ConnectionTracker,
 ) Session {
 	backoff := retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax,
 		connectionBackoffJitter, connectionBackoffMultiplier)
@@ -156,6 +161,8 @@ func NewSession(
 		latestSeqNumTaskManifest:        latestSeqNumTaskManifest,
 		doctor:                          doctor,
 		clientFactory:                   clientFactory,
+		payloadRejections:               payloadRejections,
+		connections:                     connections,
 		sendCredentials:                 true,
 		_heartbeatTimeout:               heartbeatTimeout,
 		_heartbeatJitter:                heartbeatJitter,
@@ -230,10 +237,12 @@ func (acsSession *session) startSessionOnce() error {
 	acsEndpoint, err := acsSession.ecsClient.DiscoverPollEndpoint(acsSession.containerInstanceARN)
 	if err != nil {
 		seelog.Errorf("acs: unable to discover poll endpoint, err: %v", err)
+		acsSession.connections.ConnectFailed(err)
 		return err
 	}
 
 	url := acsSession.acsURL(acsEndpoint)
+	acsSession.connections.Connecting(url)
 	client := acsSession.clientFactory.New(
 		url,
 		acsSession.credentialsProvider,
@@ -251,7 +260,7 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 	cfg := acsSession.agentConfig
 
 	refreshCredsHandler := newRefreshCredentialsHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
-		client, acsSession.credentialsManager, acsSession.taskEngine)
+		client, acsSession.credentialsManager, acsSession.taskEngine, cfg.EndpointResolver())
 	defer refreshCredsHandler.clearAcks()
 	refreshCredsHandler.start()
 	defer refreshCredsHandler.stop()
@@ -301,7 +310,7 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 		acsSession.dataClient,
 		refreshCredsHandler,
 		acsSession.credentialsManager,
-		acsSession.taskHandler, acsSession.latestSeqNumTaskManifest)
+		acsSession.taskHandler, acsSession.latestSeqNumTaskManifest, acsSession.payloadRejections)
 	// Clear the acks channel on return because acks of messageids don't have any value across sessions
 	defer payloadHandler.clearAcks()
 	payloadHandler.start()
@@ -325,10 +334,12 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 	err := client.Connect()
 	if err != nil {
 		seelog.Errorf("Error connecting to ACS: %v", err)
+		acsSession.connections.ConnectFailed(err)
 		return err
 	}
 
 	seelog.Info("Connected to ACS endpoint")
+	acsSession.connections.Connected()
 	// Start a connection timer; agent will send pending acks and close its ACS websocket connection
 	// after this timer expires
 	connectionTimer := newConnectionTimer(client, acsSession.connectionTime, acsSession.connectionJitter,
@@ -338,7 +349,7 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 	// Start a heartbeat timer for closing the connection
 	heartbeatTimer := newHeartbeatTimer(client, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
 	// Any message from the server resets the heartbeat timer
-	client.SetAnyRequestHandler(anyMessageHandler(heartbeatTimer, client))
+	client.SetAnyRequestHandler(anyMessageHandler(heartbeatTimer, client, acsSession.connections))
 	defer heartbeatTimer.Stop()
 
 	// Connection to ACS was successful. Moving forward, rely on ACS to send credentials to Agent at its own cadence
@@ -355,7 +366,13 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 		})
 	defer backoffResetTimer.Stop()
 
-	return client.Serve(acsSession.ctx)
+	err = client.Serve(acsSession.ctx)
+	if shouldReconnectWithoutBackoff(err) {
+		acsSession.connections.Disconnected(nil)
+	} else {
+		acsSession.connections.Disconnected(err)
+	}
+	return err
 }
 
 func (acsSession *session) computeReconnectDelay(isInactiveInstance bool) time.Duration {
@@ -475,9 +492,13 @@ func newConnectionTimer(
 
 // anyMessageHandler handles any server message. Any server message means the
 // connection is active and thus the heartbeat disconnect should not occur
-func anyMessageHandler(timer ttime.Timer, client wsclient.ClientServer) func(interface{}) {
-	return func(interface{}) {
+func anyMessageHandler(timer ttime.Timer, client wsclient.ClientServer,
+	connections *wsclient.ConnectionTracker) func(interface{}) {
+	return func(message interface{}) {
 		seelog.Debug("ACS activity occurred")
+		if _, ok := message.(*ecsacs.HeartbeatMessage); ok {
+			connections.Heartbeat()
+		}
 		// Reset read deadline as there's activity on the channel
 		if err := client.SetReadDeadline(time.Now().Add(wsRWTimeout)); err != nil {
 			seelog.Warnf("Unable to extend read deadline for ACS connection: %v", err)
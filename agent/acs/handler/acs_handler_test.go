@@ -42,12 +42,15 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/version"
 	acsclient "github.com/aws/amazon-ecs-agent/ecs-agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
 	rolecredentials "github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 	mock_credentials "github.com/aws/amazon-ecs-agent/ecs-agent/credentials/mocks"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/doctor"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/eventstream"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/retry"
 	mock_retry "github.com/aws/amazon-ecs-agent/ecs-agent/utils/retry/mock"
+	mock_ttime "github.com/aws/amazon-ecs-agent/ecs-agent/utils/ttime/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/wsclient"
 	mock_wsclient "github.com/aws/amazon-ecs-agent/ecs-agent/wsclient/mock"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -56,6 +59,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -1150,6 +1154,8 @@ func TestStartSessionHandlesRefreshCredentialsMessages(t *testing.T) {
 			&latestSeqNumberTaskManifest,
 			emptyDoctor,
 			acsclient.NewACSClientFactory(),
+			nil,
+			nil,
 		)
 		acsSession.Start()
 		// StartSession should never return unless the context is canceled
@@ -1164,10 +1170,12 @@ func TestStartSessionHandlesRefreshCredentialsMessages(t *testing.T) {
 	gomock.InOrder(
 		// Return a task from the engine for GetTaskByArn
 		taskEngine.EXPECT().GetTaskByArn("t1").Return(taskFromEngine, true),
-		// The last invocation of SetCredentials is to update
+		// The last invocation of ForceSetTaskCredentials is to update
 		// credentials when a refresh message is received by the handler
-		credentialsManager.EXPECT().SetTaskCredentials(gomock.Any()).Do(func(creds *rolecredentials.TaskIAMRoleCredentials) {
+		credentialsManager.EXPECT().ForceSetTaskCredentials(gomock.Any()).Do(func(creds *rolecredentials.TaskIAMRoleCredentials) {
 			updatedCredentials = *creds
+			assert.False(t, updatedCredentials.GeneratedAt.IsZero(), "generation time of the credentials should be set")
+			updatedCredentials.GeneratedAt = time.Time{}
 			// Validate parsed credentials after the update
 			expectedCreds := rolecredentials.TaskIAMRoleCredentials{
 				ARN: "t1",
@@ -1247,7 +1255,9 @@ func TestHandlerCorrectlySetsSendCredentials(t *testing.T) {
 		taskHandler,
 		aws.Int64(10),
 		emptyDoctor,
-		mockClientFactory)
+		mockClientFactory,
+		nil,
+		nil)
 	acsSession.(*session)._heartbeatTimeout = 20 * time.Millisecond
 	acsSession.(*session)._heartbeatJitter = 10 * time.Millisecond
 	acsSession.(*session).connectionTime = 30 * time.Millisecond
@@ -1278,6 +1288,109 @@ func TestHandlerCorrectlySetsSendCredentials(t *testing.T) {
 	}
 }
 
+// TestHandlerTracksConnections tests that the connections to ACS are tracked through
+// connect and disconnect cycles
+func TestHandlerTracksConnections(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	emptyDoctor, _ := doctor.NewDoctor([]doctor.Healthcheck{}, "test-cluster", "this:is:an:instance:arn")
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockClientFactory := mock_wsclient.NewMockClientFactory(ctrl)
+	mockClientFactory.EXPECT().
+		New(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(mockWsClient).AnyTimes()
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().WriteCloseMessage().AnyTimes()
+	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+
+	connections := wsclient.NewConnectionTracker()
+	acsSession := NewSession(
+		ctx,
+		testConfig,
+		nil,
+		"myArn",
+		testCreds,
+		dockerClient,
+		ecsClient,
+		dockerstate.NewTaskEngineState(),
+		data.NewNoopClient(),
+		taskEngine,
+		rolecredentials.NewManager(),
+		taskHandler,
+		aws.Int64(10),
+		emptyDoctor,
+		mockClientFactory,
+		nil,
+		connections)
+	acsSession.(*session)._heartbeatTimeout = 20 * time.Millisecond
+	acsSession.(*session)._heartbeatJitter = 10 * time.Millisecond
+
+	gomock.InOrder(
+		// The poll endpoint can't be discovered
+		ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return("", errors.New("discover error")),
+		// The connection is lost
+		ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil),
+		mockWsClient.EXPECT().Connect().Return(nil),
+		mockWsClient.EXPECT().Serve(gomock.Any()).Return(errors.New("connection reset by peer")),
+		// The client fails to connect
+		ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil),
+		mockWsClient.EXPECT().Connect().Return(errors.New("connection refused")),
+		// The connection is closed by ACS
+		ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil),
+		mockWsClient.EXPECT().Connect().Return(nil),
+		mockWsClient.EXPECT().Serve(gomock.Any()).Return(io.EOF),
+	)
+
+	acsSession.(*session).startSessionOnce()
+	status := connections.ConnectionStatus()
+	assert.False(t, status.Connected)
+	assert.Empty(t, status.Endpoint)
+	assert.Equal(t, "discover error", status.LastDisconnectError)
+	assert.Equal(t, uint64(1), status.ConnectFailures)
+
+	acsSession.(*session).startSessionOnce()
+	status = connections.ConnectionStatus()
+	assert.False(t, status.Connected)
+	assert.Equal(t, acsURL+"/ws", status.Endpoint)
+	assert.Equal(t, "connection reset by peer", status.LastDisconnectError)
+	assert.Equal(t, uint64(1), status.Connects)
+	assert.Zero(t, status.Reconnects)
+	require.NotNil(t, status.LastConnectedAt)
+
+	acsSession.(*session).startSessionOnce()
+	status = connections.ConnectionStatus()
+	assert.Equal(t, "connection refused", status.LastDisconnectError)
+	assert.Equal(t, uint64(2), status.ConnectFailures)
+	assert.Equal(t, uint64(1), status.Connects)
+
+	acsSession.(*session).startSessionOnce()
+	status = connections.ConnectionStatus()
+	assert.False(t, status.Connected)
+	assert.Empty(t, status.LastDisconnectError)
+	assert.Equal(t, uint64(2), status.Connects)
+	assert.Equal(t, uint64(1), status.Reconnects)
+	assert.Equal(t, uint64(2), status.ConnectFailures)
+
+	// Heartbeats of ACS are tracked
+	heartbeatTimer := mock_ttime.NewMockTimer(ctrl)
+	heartbeatTimer.EXPECT().Reset(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().SetReadDeadline(gomock.Any()).Return(nil).AnyTimes()
+	handler := anyMessageHandler(heartbeatTimer, mockWsClient, connections)
+	handler(&ecsacs.AckRequest{})
+	assert.Nil(t, connections.ConnectionStatus().LastHeartbeatAt)
+	handler(&ecsacs.HeartbeatMessage{})
+	assert.NotNil(t, connections.ConnectionStatus().LastHeartbeatAt)
+}
+
 // TestHandlerReconnectCorrectlySetsAcsUrl tests if the ACS URL
 // is set correctly for the initial connection and subsequent connections
 func TestHandlerReconnectCorrectlySetsAcsUrl(t *testing.T) {
@@ -1345,7 +1458,9 @@ func TestHandlerReconnectCorrectlySetsAcsUrl(t *testing.T) {
 		taskHandler,
 		aws.Int64(10),
 		emptyDoctor,
-		mockClientFactory)
+		mockClientFactory,
+		nil,
+		nil)
 	acsSession.(*session).backoff = mockBackoff
 	acsSession.(*session)._heartbeatTimeout = 20 * time.Millisecond
 	acsSession.(*session)._heartbeatJitter = 10 * time.Millisecond
@@ -14,7 +14,9 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
@@ -54,6 +56,8 @@ type payloadRequestHandler struct {
 	refreshHandler              refreshCredentialsHandler
 	credentialsManager          credentials.Manager
 	latestSeqNumberTaskManifest *int64
+	// rejections records the tasks that were rejected or failed to start
+	rejections *PayloadRejectionHistory
 }
 
 // newPayloadRequestHandler returns a new payloadRequestHandler object
@@ -67,7 +71,8 @@ func newPayloadRequestHandler(
 	dataClient data.Client,
 	refreshHandler refreshCredentialsHandler,
 	credentialsManager credentials.Manager,
-	taskHandler *eventhandler.TaskHandler, seqNumTaskManifest *int64) payloadRequestHandler {
+	taskHandler *eventhandler.TaskHandler, seqNumTaskManifest *int64,
+	rejections *PayloadRejectionHistory) payloadRequestHandler {
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return payloadRequestHandler{
@@ -85,6 +90,7 @@ func newPayloadRequestHandler(
 		refreshHandler:              refreshHandler,
 		credentialsManager:          credentialsManager,
 		latestSeqNumberTaskManifest: seqNumTaskManifest,
+		rejections:                  rejections,
 	}
 }
 
@@ -168,7 +174,9 @@ func (payloadHandler *payloadRequestHandler) handleMessages() {
 func (payloadHandler *payloadRequestHandler) handleSingleMessage(payload *ecsacs.PayloadMessage) error {
 	if aws.StringValue(payload.MessageId) == "" {
 		seelog.Criticalf("Received a payload with no message id")
-		return fmt.Errorf("received a payload with no message id")
+		err := fmt.Errorf("received a payload with no message id")
+		payloadHandler.rejections.record("", "", RejectionValidationFailure, err)
+		return err
 	}
 	seelog.Debugf("Received payload message, message id: %s", aws.StringValue(payload.MessageId))
 	credentialsAcks, allTasksHandled := payloadHandler.addPayloadTasks(payload)
@@ -206,12 +214,14 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 	for _, task := range payload.Tasks {
 		if task == nil {
 			seelog.Criticalf("Received nil task for messageId: %s", aws.StringValue(payload.MessageId))
+			payloadHandler.rejections.record(aws.StringValue(payload.MessageId), "", RejectionValidationFailure,
+				errors.New("received nil task"))
 			allTasksOK = false
 			continue
 		}
 		apiTask, err := apitask.TaskFromACS(task, payload)
 		if err != nil {
-			payloadHandler.handleUnrecognizedTask(task, err, payload)
+			payloadHandler.handleUnrecognizedTask(task, err, RejectionValidationFailure, payload)
 			allTasksOK = false
 			continue
 		}
@@ -231,9 +241,10 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 				&(credentials.TaskIAMRoleCredentials{
 					ARN:                aws.StringValue(task.Arn),
 					IAMRoleCredentials: taskIAMRoleCredentials,
+					GeneratedAt:        time.Now(),
 				}))
 			if err != nil {
-				payloadHandler.handleUnrecognizedTask(task, err, payload)
+				payloadHandler.handleUnrecognizedTask(task, err, RejectionInternalError, payload)
 				allTasksOK = false
 				continue
 			}
@@ -244,7 +255,7 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 		for _, acsENI := range task.ElasticNetworkInterfaces {
 			eni, err := apieni.ENIFromACS(acsENI)
 			if err != nil {
-				payloadHandler.handleUnrecognizedTask(task, err, payload)
+				payloadHandler.handleUnrecognizedTask(task, err, RejectionValidationFailure, payload)
 				allTasksOK = false
 				continue
 			}
@@ -255,7 +266,7 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 		if task.ProxyConfiguration != nil {
 			appmesh, err := apiappmesh.AppMeshFromACS(task.ProxyConfiguration)
 			if err != nil {
-				payloadHandler.handleUnrecognizedTask(task, err, payload)
+				payloadHandler.handleUnrecognizedTask(task, err, RejectionValidationFailure, payload)
 				allTasksOK = false
 				continue
 			}
@@ -271,9 +282,10 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 				&(credentials.TaskIAMRoleCredentials{
 					ARN:                aws.StringValue(task.Arn),
 					IAMRoleCredentials: taskExecutionIAMRoleCredentials,
+					GeneratedAt:        time.Now(),
 				}))
 			if err != nil {
-				payloadHandler.handleUnrecognizedTask(task, err, payload)
+				payloadHandler.handleUnrecognizedTask(task, err, RejectionInternalError, payload)
 				allTasksOK = false
 				continue
 			}
@@ -315,6 +327,8 @@ func (payloadHandler *payloadRequestHandler) addTasks(payload *ecsacs.PayloadMes
 			err := payloadHandler.dataClient.SaveTask(task)
 			if err != nil {
 				seelog.Errorf("Failed to save data for task %s: %v", task.Arn, err)
+				payloadHandler.rejections.record(aws.StringValue(payload.MessageId), task.Arn,
+					categorizeRejection(err, RejectionInternalError), err)
 				allTasksOK = false
 			}
 		}
@@ -324,6 +338,8 @@ func (payloadHandler *payloadRequestHandler) addTasks(payload *ecsacs.PayloadMes
 			if err != nil {
 				allTasksOK = false
 				seelog.Errorf("Failed to acknowledge %s credentials for task: %s, err: %v", description, task.String(), err)
+				payloadHandler.rejections.record(aws.StringValue(payload.MessageId), task.Arn, RejectionInternalError,
+					fmt.Errorf("failed to acknowledge %s credentials: %w", description, err))
 				return
 			}
 			credentialsAcks = append(credentialsAcks, ack)
@@ -372,10 +388,14 @@ func isTaskStatusNotStopped(status apitaskstatus.TaskStatus) bool {
 }
 
 // handleUnrecognizedTask handles unrecognized tasks by sending 'stopped' with
-// a suitable reason to the backend
-func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs.Task, err error, payload *ecsacs.PayloadMessage) {
+// a suitable reason to the backend. The rejection is recorded in the category of
+// the error, or in the fallback category if the error doesn't tell the reason.
+func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs.Task, err error,
+	fallback PayloadRejectionCategory, payload *ecsacs.PayloadMessage) {
 	seelog.Warnf("Received unexpected acs message, messageID: %s, task: %v, err: %v",
 		aws.StringValue(payload.MessageId), aws.StringValue(task.Arn), err)
+	payloadHandler.rejections.record(aws.StringValue(payload.MessageId), aws.StringValue(task.Arn),
+		categorizeRejection(err, fallback), err)
 
 	if aws.StringValue(task.Arn) == "" {
 		seelog.Criticalf("Received task with no arn, messageId: %s", aws.StringValue(payload.MessageId))
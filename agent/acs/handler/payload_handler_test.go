@@ -58,6 +58,7 @@ type testHelper struct {
 	mockWsClient       *mock_wsclient.MockClientServer
 	credentialsManager credentials.Manager
 	eventHandler       *eventhandler.TaskHandler
+	rejections         *PayloadRejectionHistory
 	ctx                context.Context
 	cancel             context.CancelFunc
 }
@@ -71,6 +72,7 @@ func setup(t *testing.T) *testHelper {
 	ctx, cancel := context.WithCancel(context.Background())
 	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
 	latestSeqNumberTaskManifest := int64(10)
+	rejections := NewPayloadRejectionHistory(0)
 
 	handler := newPayloadRequestHandler(
 		ctx,
@@ -82,7 +84,7 @@ func setup(t *testing.T) *testHelper {
 		data.NewNoopClient(),
 		refreshCredentialsHandler{},
 		credentialsManager,
-		taskHandler, &latestSeqNumberTaskManifest)
+		taskHandler, &latestSeqNumberTaskManifest, rejections)
 
 	return &testHelper{
 		ctrl:               ctrl,
@@ -92,6 +94,7 @@ func setup(t *testing.T) *testHelper {
 		mockWsClient:       mockWsClient,
 		credentialsManager: credentialsManager,
 		eventHandler:       taskHandler,
+		rejections:         rejections,
 		ctx:                ctx,
 		cancel:             cancel,
 	}
@@ -307,7 +310,7 @@ func TestHandlePayloadMessageCredentialsAckedWhenTaskAdded(t *testing.T) {
 		}),
 	)
 
-	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, testconst.ClusterName, testconst.ContainerInstanceARN, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine)
+	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, testconst.ClusterName, testconst.ContainerInstanceARN, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine, nil)
 	defer refreshCredsHandler.clearAcks()
 	refreshCredsHandler.start()
 	tester.payloadHandler.refreshHandler = refreshCredsHandler
@@ -496,7 +499,7 @@ func TestPayloadBufferHandlerWithCredentials(t *testing.T) {
 		}),
 	)
 
-	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, testconst.ClusterName, testconst.ContainerInstanceARN, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine)
+	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, testconst.ClusterName, testconst.ContainerInstanceARN, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine, nil)
 	defer refreshCredsHandler.clearAcks()
 	refreshCredsHandler.start()
 	tester.payloadHandler.refreshHandler = refreshCredsHandler
@@ -618,7 +621,7 @@ func TestAddPayloadTaskAddsExecutionRoles(t *testing.T) {
 			tester.cancel()
 		}),
 	)
-	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, testconst.ClusterName, testconst.ContainerInstanceARN, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine)
+	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, testconst.ClusterName, testconst.ContainerInstanceARN, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine, nil)
 	defer refreshCredsHandler.clearAcks()
 	refreshCredsHandler.start()
 
@@ -986,10 +989,150 @@ func TestHandleUnrecognizedTask(t *testing.T) {
 		wait.Done()
 	})
 
-	tester.payloadHandler.handleUnrecognizedTask(ecsacsTask, errors.New("test error"), payloadMessage)
+	tester.payloadHandler.handleUnrecognizedTask(ecsacsTask, errors.New("test error"), RejectionInternalError,
+		payloadMessage)
 	wait.Wait()
 }
 
+// Tests that the tasks of payloads that are rejected are recorded in the history in the
+// category of their rejection.
+func TestPayloadRejectionHistory(t *testing.T) {
+	testCases := []struct {
+		name             string
+		payload          *ecsacs.PayloadMessage
+		addedTasks       int
+		expectedTaskARN  string
+		expectedCategory PayloadRejectionCategory
+		expectedDetail   string
+	}{
+		{
+			name:             "payload without message id",
+			payload:          &ecsacs.PayloadMessage{Tasks: []*ecsacs.Task{{Arn: aws.String(testconst.TaskARN)}}},
+			expectedCategory: RejectionValidationFailure,
+			expectedDetail:   "received a payload with no message id",
+		},
+		{
+			name: "nil task",
+			payload: &ecsacs.PayloadMessage{
+				Tasks:     []*ecsacs.Task{nil},
+				MessageId: aws.String(payloadMessageId),
+			},
+			expectedCategory: RejectionValidationFailure,
+			expectedDetail:   "received nil task",
+		},
+		{
+			name: "invalid eni",
+			payload: &ecsacs.PayloadMessage{
+				Tasks: []*ecsacs.Task{{
+					Arn:                      aws.String(testconst.TaskARN),
+					ElasticNetworkInterfaces: []*ecsacs.ElasticNetworkInterface{{}},
+				}},
+				MessageId: aws.String(payloadMessageId),
+			},
+			addedTasks:       1,
+			expectedTaskARN:  testconst.TaskARN,
+			expectedCategory: RejectionValidationFailure,
+			expectedDetail:   "eni message validation: no ipv4 addresses in the message",
+		},
+		{
+			name: "unsupported proxy type",
+			payload: &ecsacs.PayloadMessage{
+				Tasks: []*ecsacs.Task{{
+					Arn:                aws.String(testconst.TaskARN),
+					ProxyConfiguration: &ecsacs.ProxyConfiguration{Type: aws.String("OTHER")},
+				}},
+				MessageId: aws.String(payloadMessageId),
+			},
+			expectedTaskARN:  testconst.TaskARN,
+			expectedCategory: RejectionUnsupportedCapability,
+			expectedDetail:   "agent does not support proxy type other than app mesh",
+		},
+		{
+			name: "credentials exhausted",
+			payload: &ecsacs.PayloadMessage{
+				Tasks: []*ecsacs.Task{{
+					Arn:             aws.String(testconst.TaskARN),
+					RoleCredentials: &ecsacs.IAMRoleCredentials{CredentialsId: aws.String("credsid")},
+				}},
+				MessageId: aws.String(payloadMessageId),
+			},
+			expectedTaskARN:  testconst.TaskARN,
+			expectedCategory: RejectionResourceExhaustion,
+			expectedDetail: "unable to set credentials for task " + testconst.TaskARN +
+				": maximum number of credentials exceeded (1)",
+		},
+		{
+			name: "task not saved",
+			payload: &ecsacs.PayloadMessage{
+				// The ARN is invalid, so that the task can't be saved
+				Tasks:     []*ecsacs.Task{{Arn: aws.String("t1"), DesiredStatus: aws.String("RUNNING")}},
+				MessageId: aws.String(payloadMessageId),
+			},
+			addedTasks:       1,
+			expectedTaskARN:  "t1",
+			expectedCategory: RejectionInternalError,
+			expectedDetail:   "failed to generate database id: failed to get task id: task arn format invalid: t1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tester := setup(t)
+			defer tester.ctrl.Finish()
+			tester.payloadHandler.dataClient = newTestDataClient(t)
+			// The stopped state changes of the rejected tasks are submitted to ECS
+			ecsClient := mock_api.NewMockECSClient(tester.ctrl)
+			ecsClient.EXPECT().SubmitTaskStateChange(gomock.Any()).AnyTimes()
+			tester.payloadHandler.ecsClient = ecsClient
+			tester.payloadHandler.taskHandler = eventhandler.NewTaskHandler(tester.ctx, data.NewNoopClient(),
+				dockerstate.NewTaskEngineState(), ecsClient)
+			// The credentials manager is full, so that no credentials can be added
+			tester.payloadHandler.credentialsManager = credentials.NewManager(credentials.WithMaxEntries(1))
+			require.NoError(t, tester.payloadHandler.credentialsManager.SetTaskCredentials(
+				&credentials.TaskIAMRoleCredentials{
+					ARN:                "arn:aws:ecs:us-west-2:123456789012:task/cluster/other",
+					IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: "othercredsid"},
+				}))
+			tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(tc.addedTasks)
+			tester.rejections.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+			assert.Error(t, tester.payloadHandler.handleSingleMessage(tc.payload))
+			rejections, counts := tester.rejections.PayloadRejections()
+			assert.Equal(t, []PayloadRejection{{
+				MessageID: aws.StringValue(tc.payload.MessageId),
+				TaskARN:   tc.expectedTaskARN,
+				Timestamp: time.Unix(1700000000, 0).UTC(),
+				Category:  tc.expectedCategory,
+				Detail:    tc.expectedDetail,
+			}}, rejections)
+			assert.Equal(t, map[PayloadRejectionCategory]uint64{tc.expectedCategory: 1}, counts)
+		})
+	}
+}
+
+func TestPayloadRejectionHistoryIsBounded(t *testing.T) {
+	history := NewPayloadRejectionHistory(2)
+	for _, arn := range []string{"task1", "task2", "task3"} {
+		history.record(payloadMessageId, arn, RejectionValidationFailure, errors.New("invalid"))
+	}
+	history.record(payloadMessageId, "task4", RejectionInternalError, errors.New("failed"))
+
+	rejections, counts := history.PayloadRejections()
+	require.Len(t, rejections, 2)
+	assert.Equal(t, "task3", rejections[0].TaskARN)
+	assert.Equal(t, "task4", rejections[1].TaskARN)
+	assert.Equal(t, map[PayloadRejectionCategory]uint64{
+		RejectionValidationFailure: 3,
+		RejectionInternalError:     1,
+	}, counts)
+
+	var nilHistory *PayloadRejectionHistory
+	nilHistory.record(payloadMessageId, "task1", RejectionInternalError, errors.New("failed"))
+	rejections, counts = nilHistory.PayloadRejections()
+	assert.Empty(t, rejections)
+	assert.Empty(t, counts)
+}
+
 func TestPayloadHandlerAddedFirelensData(t *testing.T) {
 	tester := setup(t)
 	defer tester.ctrl.Finish()
@@ -0,0 +1,139 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	apiappmesh "github.com/aws/amazon-ecs-agent/agent/api/appmesh"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+)
+
+// PayloadRejectionCategory is the machine-readable category of the reason that a task of a
+// payload message was rejected, or failed to be started.
+type PayloadRejectionCategory string
+
+const (
+	// RejectionUnsupportedCapability is for tasks that need a capability the agent doesn't have
+	RejectionUnsupportedCapability PayloadRejectionCategory = "UnsupportedCapability"
+	// RejectionResourceExhaustion is for tasks that couldn't be handled because a resource of
+	// the agent or the instance, such as disk space or credentials entries, was exhausted
+	RejectionResourceExhaustion PayloadRejectionCategory = "ResourceExhaustion"
+	// RejectionValidationFailure is for payloads and tasks that are malformed
+	RejectionValidationFailure PayloadRejectionCategory = "ValidationFailure"
+	// RejectionInternalError is for tasks that the agent failed to handle otherwise
+	RejectionInternalError PayloadRejectionCategory = "InternalError"
+)
+
+// DefaultPayloadRejectionHistorySize is the number of rejections that are kept by default.
+const DefaultPayloadRejectionHistorySize = 100
+
+// PayloadRejection is a task of a payload message that the agent rejected, or failed to
+// start. The task ARN is empty if the whole payload, or a task without an ARN, was rejected.
+type PayloadRejection struct {
+	MessageID string                   `json:"MessageId"`
+	TaskARN   string                   `json:"TaskArn,omitempty"`
+	Timestamp time.Time                `json:"Timestamp"`
+	Category  PayloadRejectionCategory `json:"Category"`
+	Detail    string                   `json:"Detail"`
+}
+
+// PayloadRejectionReporter reports the payload rejections of the agent.
+type PayloadRejectionReporter interface {
+	// PayloadRejections returns the latest rejections, oldest first, and the number of
+	// rejections of each category since the agent started.
+	PayloadRejections() ([]PayloadRejection, map[PayloadRejectionCategory]uint64)
+}
+
+// PayloadRejectionHistory keeps the latest payload rejections. Rejections are dropped
+// oldest first once the history is full, but are still counted by category. It is safe
+// for concurrent use, and a nil history records nothing.
+type PayloadRejectionHistory struct {
+	lock       sync.Mutex
+	rejections []PayloadRejection
+	next       int
+	full       bool
+	counts     map[PayloadRejectionCategory]uint64
+	now        func() time.Time
+}
+
+// NewPayloadRejectionHistory creates a history that keeps the latest size rejections.
+// DefaultPayloadRejectionHistorySize is used if size isn't positive.
+func NewPayloadRejectionHistory(size int) *PayloadRejectionHistory {
+	if size <= 0 {
+		size = DefaultPayloadRejectionHistorySize
+	}
+	return &PayloadRejectionHistory{
+		rejections: make([]PayloadRejection, size),
+		counts:     make(map[PayloadRejectionCategory]uint64),
+		now:        time.Now,
+	}
+}
+
+// record adds a rejection of the task of the payload message to the history.
+func (h *PayloadRejectionHistory) record(messageID, taskARN string, category PayloadRejectionCategory, err error) {
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.rejections[h.next] = PayloadRejection{
+		MessageID: messageID,
+		TaskARN:   taskARN,
+		Timestamp: h.now().UTC(),
+		Category:  category,
+		Detail:    err.Error(),
+	}
+	h.next = (h.next + 1) % len(h.rejections)
+	if h.next == 0 {
+		h.full = true
+	}
+	h.counts[category]++
+}
+
+// PayloadRejections returns the rejections in the history, oldest first, and the number
+// of rejections of each category that were recorded.
+func (h *PayloadRejectionHistory) PayloadRejections() ([]PayloadRejection, map[PayloadRejectionCategory]uint64) {
+	rejections := []PayloadRejection{}
+	counts := make(map[PayloadRejectionCategory]uint64)
+	if h == nil {
+		return rejections, counts
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.full {
+		rejections = append(rejections, h.rejections[h.next:]...)
+	}
+	rejections = append(rejections, h.rejections[:h.next]...)
+	for category, count := range h.counts {
+		counts[category] = count
+	}
+	return rejections, counts
+}
+
+// categorizeRejection returns the category of the error that a task was rejected with,
+// or the fallback category if the error doesn't tell the reason of the rejection.
+func categorizeRejection(err error, fallback PayloadRejectionCategory) PayloadRejectionCategory {
+	switch {
+	case errors.Is(err, apiappmesh.ErrUnsupportedProxyType):
+		return RejectionUnsupportedCapability
+	case errors.Is(err, credentials.ErrMaxEntriesExceeded), errors.Is(err, syscall.ENOSPC),
+		errors.Is(err, syscall.ENOMEM):
+		return RejectionResourceExhaustion
+	}
+	return fallback
+}
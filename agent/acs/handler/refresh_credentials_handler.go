@@ -15,7 +15,9 @@ package handler
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
@@ -45,10 +47,13 @@ type refreshCredentialsHandler struct {
 	acsClient          wsclient.ClientServer
 	credentialsManager credentials.Manager
 	taskEngine         engine.TaskEngine
+	// endpoints resolves the endpoints of the clients that domainless gMSA credentials
+	// are renewed with
+	endpoints *awsendpoints.Resolver
 }
 
 // newRefreshCredentialsHandler returns a new refreshCredentialsHandler object
-func newRefreshCredentialsHandler(ctx context.Context, cluster string, containerInstanceArn string, acsClient wsclient.ClientServer, credentialsManager credentials.Manager, taskEngine engine.TaskEngine) refreshCredentialsHandler {
+func newRefreshCredentialsHandler(ctx context.Context, cluster string, containerInstanceArn string, acsClient wsclient.ClientServer, credentialsManager credentials.Manager, taskEngine engine.TaskEngine, endpoints *awsendpoints.Resolver) refreshCredentialsHandler {
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return refreshCredentialsHandler{
@@ -61,6 +66,7 @@ func newRefreshCredentialsHandler(ctx context.Context, cluster string, container
 		acsClient:          acsClient,
 		credentialsManager: credentialsManager,
 		taskEngine:         taskEngine,
+		endpoints:          endpoints,
 	}
 }
 
@@ -152,10 +158,13 @@ func (refreshHandler *refreshCredentialsHandler) handleSingleMessage(message *ec
 		seelog.Errorf("Unknown RoleType for task in credentials message, roleType: %s arn: %s, messageId: %s", roleType, taskArn, messageId)
 	} else {
 		iamRoleCredentials := credentials.IAMRoleCredentialsFromACS(message.RoleCredentials, roleType)
-		err = refreshHandler.credentialsManager.SetTaskCredentials(
+		// The task is running, so its refreshed credentials are set even if the maximum
+		// number of credentials is reached
+		err = refreshHandler.credentialsManager.ForceSetTaskCredentials(
 			&(credentials.TaskIAMRoleCredentials{
 				ARN:                taskArn,
 				IAMRoleCredentials: iamRoleCredentials,
+				GeneratedAt:        time.Now(),
 			}))
 		if err != nil {
 			seelog.Errorf("Unable to update credentials for task, err: %v messageId: %s", err, messageId)
@@ -168,7 +177,15 @@ func (refreshHandler *refreshCredentialsHandler) handleSingleMessage(message *ec
 		if roleType == credentials.ExecutionRoleType {
 			task.SetExecutionRoleCredentialsID(aws.StringValue(message.RoleCredentials.CredentialsId))
 			// Refresh domainless gMSA plugin credentials if needed
-			err = checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl(iamRoleCredentials, task)
+			renewsCredentialSpec := task.RequiresDomainlessCredentialSpecResource()
+			if renewsCredentialSpec {
+				task.MarkCredentialSpecRenewalScheduled()
+			}
+			err = checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl(iamRoleCredentials, task,
+				refreshHandler.endpoints)
+			if renewsCredentialSpec {
+				task.MarkCredentialSpecRenewalResult(err)
+			}
 			if err != nil {
 				seelog.Errorf("Unable to SetDomainlessGMSATaskExecutionRoleCredentials for task %s, err: %v messageId: %s", taskArn, err, messageId)
 				return errors.Wrap(err, "unable to SetDomainlessGMSATaskExecutionRoleCredentials")
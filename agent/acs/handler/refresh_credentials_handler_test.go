@@ -25,7 +25,10 @@ import (
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
 	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource/credentialspec"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/session/testconst"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
@@ -35,6 +38,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -68,6 +72,7 @@ var expectedCredentials = credentials.TaskIAMRoleCredentials{
 		CredentialsID:   credentialsId,
 		RoleType:        roleType,
 	},
+	Revision: 1,
 }
 
 var message = &ecsacs.IAMRoleCredentialsMessage{
@@ -177,7 +182,7 @@ func TestInvalidCredentialsMessageNotAcked(t *testing.T) {
 	credentialsManager := credentials.NewManager()
 
 	ctx, cancel := context.WithCancel(context.Background())
-	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, nil)
+	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, nil, nil)
 
 	// Start a goroutine to listen for acks. Cancelling the context stops the goroutine
 	go func() {
@@ -214,7 +219,7 @@ func TestCredentialsMessageNotAckedWhenTaskNotFound(t *testing.T) {
 	taskEngine.EXPECT().GetTaskByArn(taskArn).Return(nil, false)
 
 	ctx, cancel := context.WithCancel(context.Background())
-	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, taskEngine)
+	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, taskEngine, nil)
 
 	// Start a goroutine to listen for acks. Cancelling the context stops the goroutine
 	go func() {
@@ -272,7 +277,8 @@ func TestHandleRefreshMessageAckedWhenCredentialsUpdated(t *testing.T) {
 			// Return a task from the engine for GetTaskByArn
 			taskEngine.EXPECT().GetTaskByArn(tc.taskArn).Return(&apitask.Task{Arn: tc.taskArn, Containers: tc.containers}, true)
 
-			checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl = func(iamRoleCredentials credentials.IAMRoleCredentials, task *apitask.Task) error {
+			checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl = func(iamRoleCredentials credentials.IAMRoleCredentials, task *apitask.Task,
+				_ *awsendpoints.Resolver) error {
 				if tc.taskArn != task.Arn {
 					return errors.New(fmt.Sprintf("Expected taskArnInput to be %s, instead got %s", tc.taskArn, task.Arn))
 				}
@@ -284,7 +290,7 @@ func TestHandleRefreshMessageAckedWhenCredentialsUpdated(t *testing.T) {
 				checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl = checkAndSetDomainlessGMSATaskExecutionRoleCredentials
 			}()
 
-			handler := newRefreshCredentialsHandler(ctx, testconst.ClusterName, testconst.ContainerInstanceARN, mockWsClient, credentialsManager, taskEngine)
+			handler := newRefreshCredentialsHandler(ctx, testconst.ClusterName, testconst.ContainerInstanceARN, mockWsClient, credentialsManager, taskEngine, nil)
 			go handler.sendAcks()
 
 			// test adding a credentials message without the MessageId field
@@ -306,6 +312,10 @@ func TestHandleRefreshMessageAckedWhenCredentialsUpdated(t *testing.T) {
 			if !exist {
 				t.Errorf("Expected credentials to exist for the task")
 			}
+			if creds.GeneratedAt.IsZero() {
+				t.Errorf("Expected the generation time of the credentials to be set")
+			}
+			creds.GeneratedAt = time.Time{}
 			if !reflect.DeepEqual(creds, expectedCredentials) {
 				t.Errorf("Mismatch between expected credentials and credentials for task. Expected: %v, got: %v", expectedCredentials, creds)
 			}
@@ -344,7 +354,8 @@ func TestCredentialsMessageNotAckedWhenDomainlessGMSACredentialsError(t *testing
 			// Return a task from the engine for GetTaskByArn
 			taskEngine.EXPECT().GetTaskByArn(tc.taskArn).Return(&apitask.Task{Arn: tc.taskArn, Containers: tc.containers}, true)
 
-			checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl = func(iamRoleCredentials credentials.IAMRoleCredentials, task *apitask.Task) error {
+			checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl = func(iamRoleCredentials credentials.IAMRoleCredentials, task *apitask.Task,
+				_ *awsendpoints.Resolver) error {
 				if tc.taskArn != task.Arn {
 					return errors.New(fmt.Sprintf("Expected taskArnInput to be %s, instead got %s", tc.taskArn, task.Arn))
 				}
@@ -357,7 +368,7 @@ func TestCredentialsMessageNotAckedWhenDomainlessGMSACredentialsError(t *testing
 			}()
 
 			ctx, cancel := context.WithCancel(context.Background())
-			handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, taskEngine)
+			handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, taskEngine, nil)
 
 			// Start a goroutine to listen for acks. Cancelling the context stops the goroutine
 			go func() {
@@ -379,6 +390,84 @@ func TestCredentialsMessageNotAckedWhenDomainlessGMSACredentialsError(t *testing
 	}
 }
 
+// TestHandleRefreshMessageTracksCredentialSpecRenewal tests that renewing the domainless gMSA
+// plugin credentials is tracked in the lifecycle status of the credentialspec resource
+func TestHandleRefreshMessageTracksCredentialSpecRenewal(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		renewalErr             error
+		expectedState          string
+		expectedRenewalWarning bool
+	}{
+		{
+			name:          "RenewalSucceeds",
+			expectedState: credentialspec.LifecycleFetched,
+		},
+		{
+			name:                   "RenewalFails",
+			renewalErr:             errors.New("mock renewal error"),
+			expectedState:          credentialspec.LifecycleFailed,
+			expectedRenewalWarning: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			credentialsManager := credentials.NewManager()
+
+			credSpec := "credentialspecdomainless:file://gmsa_gmsa-acct.json"
+			task := &apitask.Task{
+				Arn:                taskArn,
+				Containers:         []*apicontainer.Container{{Name: "webapp", CredentialSpecs: []string{credSpec}}},
+				ResourcesMapUnsafe: make(map[string][]taskresource.TaskResource),
+			}
+			credentialspecResource, err := credentialspec.NewCredentialSpecResource(taskArn, "us-west-2", "",
+				credentialsManager, nil, nil, nil, map[string]string{credSpec: "webapp"})
+			require.NoError(t, err)
+			task.AddResource(credentialspec.ResourceName, credentialspecResource)
+
+			taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+			taskEngine.EXPECT().GetTaskByArn(taskArn).Return(task, true)
+
+			checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl = func(iamRoleCredentials credentials.IAMRoleCredentials, task *apitask.Task,
+				_ *awsendpoints.Resolver) error {
+				assert.Equal(t, credentialspec.LifecycleRenewalScheduled, task.GetCredentialSpecLifecycleStatus().State)
+				return tc.renewalErr
+			}
+			defer func() {
+				checkAndSetDomainlessGMSATaskExecutionRoleCredentialsImpl = checkAndSetDomainlessGMSATaskExecutionRoleCredentials
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, taskEngine, nil)
+			go func() {
+				for {
+					select {
+					case <-handler.ackRequest:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			err = handler.handleSingleMessage(message)
+			assert.Equal(t, tc.renewalErr != nil, err != nil)
+
+			status := task.GetCredentialSpecLifecycleStatus()
+			require.NotNil(t, status)
+			assert.Equal(t, tc.expectedState, status.State)
+			assert.Equal(t, tc.expectedRenewalWarning, status.RenewalWarning)
+			assert.Equal(t, []string{"file://gmsa_gmsa-acct.json"}, status.Locations)
+			if tc.renewalErr != nil {
+				assert.Equal(t, tc.renewalErr.Error(), status.Reason)
+			}
+		})
+	}
+}
+
 func TestRefreshCredentialsHandlerSendPendingAcks(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -390,7 +479,7 @@ func TestRefreshCredentialsHandlerSendPendingAcks(t *testing.T) {
 	mockWSClient.EXPECT().MakeRequest(gomock.Any()).Return(nil).Times(1)
 
 	handler := newRefreshCredentialsHandler(ctx, testconst.ClusterName, testconst.ContainerInstanceARN, mockWSClient,
-		credentialsManager, taskEngine)
+		credentialsManager, taskEngine, nil)
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
@@ -437,7 +526,7 @@ func TestRefreshCredentialsHandler(t *testing.T) {
 	// Return a task from the engine for GetTaskByArn
 	taskEngine.EXPECT().GetTaskByArn(taskArn).Return(&apitask.Task{}, true)
 
-	handler := newRefreshCredentialsHandler(ctx, testconst.ClusterName, testconst.ContainerInstanceARN, mockWsClient, credentialsManager, taskEngine)
+	handler := newRefreshCredentialsHandler(ctx, testconst.ClusterName, testconst.ContainerInstanceARN, mockWsClient, credentialsManager, taskEngine, nil)
 	go handler.start()
 
 	handler.messageBuffer <- message
@@ -454,6 +543,10 @@ func TestRefreshCredentialsHandler(t *testing.T) {
 	if !exist {
 		t.Errorf("Expected credentials to exist for the task")
 	}
+	if creds.GeneratedAt.IsZero() {
+		t.Errorf("Expected the generation time of the credentials to be set")
+	}
+	creds.GeneratedAt = time.Time{}
 	if !reflect.DeepEqual(creds, expectedCredentials) {
 		t.Errorf("Mismatch between expected credentials and credentials for task. Expected: %v, got: %v", expectedCredentials, creds)
 	}
@@ -13,7 +13,7 @@
 package appmesh
 
 import (
-	"fmt"
+	"errors"
 	"strings"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
@@ -34,6 +34,9 @@ const (
 	instanceMetadataEndpointIP = "169.254.169.254"
 )
 
+// ErrUnsupportedProxyType is returned for proxy configurations of a type other than app mesh
+var ErrUnsupportedProxyType = errors.New("agent does not support proxy type other than app mesh")
+
 // AppMesh contains information of app mesh config
 type AppMesh struct {
 	// ContainerName is the proxy container name
@@ -58,7 +61,7 @@ type AppMesh struct {
 func AppMeshFromACS(proxyConfig *ecsacs.ProxyConfiguration) (*AppMesh, error) {
 
 	if *proxyConfig.Type != appMesh {
-		return nil, fmt.Errorf("agent does not support proxy type other than app mesh")
+		return nil, ErrUnsupportedProxyType
 	}
 
 	return &AppMesh{
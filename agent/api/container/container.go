@@ -55,6 +55,17 @@ const (
 	// AuthTypeASM is to use image pull auth over AWS Secrets Manager
 	AuthTypeASM = "asm"
 
+	// ImagePullMechanismFull is the image pull mechanism of images that were pulled in full
+	ImagePullMechanismFull = "full"
+
+	// ImagePullMechanismLazy is the image pull mechanism of images that were pulled to be
+	// lazily loaded by the snapshotter
+	ImagePullMechanismLazy = "lazy"
+
+	// ImagePullMechanismFallback is the image pull mechanism of images that were pulled in
+	// full after their lazy loading pull failed
+	ImagePullMechanismFallback = "fallback"
+
 	// MetadataURIEnvironmentVariableName defines the name of the environment
 	// variable in containers' config, which can be used by the containers to access the
 	// v3 metadata endpoint
@@ -173,6 +184,14 @@ type Container struct {
 	ImageID string
 	// ImageDigest is the sha-256 digest of the container image as pulled from the repository
 	ImageDigest string
+	// ImagePullMechanism is how the container image was pulled, one of full, lazy or
+	// fallback. It's empty if the image wasn't pulled for the container.
+	ImagePullMechanism string `json:"imagePullMechanism,omitempty"`
+
+	// OutputCaptureFile is the path on the host of the file that the agent writes the
+	// output of the container to, if the container has no log driver and its output is
+	// captured.
+	OutputCaptureFile string `json:"outputCaptureFile,omitempty"`
 	// Command is the command to run in the container which is specified in the task definition
 	Command []string
 	// CPU is the cpu limitation of the container which is specified in the task definition
@@ -322,12 +341,27 @@ type Container struct {
 	// pause container
 	ContainerTornDownUnsafe bool `json:"containerTornDown"`
 
+	// EffectivePIDModeUnsafe is the task level PID mode applied when the container was
+	// created, either "host" or "task". It is empty if the container has a private PID
+	// namespace.
+	EffectivePIDModeUnsafe string `json:"EffectivePIDMode,omitempty"`
+
 	createdAt  time.Time
 	startedAt  time.Time
 	finishedAt time.Time
 
 	labels map[string]string
 
+	// waitingFor is the list of container ordering dependencies that the container
+	// is currently blocked on. It is not saved in the state file as it is recomputed
+	// every time the task manager attempts to transition the container.
+	waitingFor []DependsOn
+
+	// pid is the process ID of the container's init process as last reported by
+	// docker. It is updated every time the container is (re)started and is 0 if
+	// it is not known.
+	pid int
+
 	// ContainerHasPortRange is set to true when the container has at least 1 port range requested.
 	ContainerHasPortRange bool
 	// ContainerPortSet is a set of singular container ports that don't belong to a containerPortRange request
@@ -731,6 +765,40 @@ func (c *Container) GetImageDigest() string {
 	return c.ImageDigest
 }
 
+// SetImagePullMechanism sets how the container image was pulled
+func (c *Container) SetImagePullMechanism(mechanism string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ImagePullMechanism = mechanism
+}
+
+// GetImagePullMechanism gets how the container image was pulled
+func (c *Container) GetImagePullMechanism() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.ImagePullMechanism
+}
+
+// SetOutputCaptureFile sets the path of the file that the output of the container is
+// captured to
+func (c *Container) SetOutputCaptureFile(path string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.OutputCaptureFile = path
+}
+
+// GetOutputCaptureFile gets the path of the file that the output of the container is
+// captured to
+func (c *Container) GetOutputCaptureFile() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.OutputCaptureFile
+}
+
 // GetLabels gets the labels for a container
 func (c *Container) GetLabels() map[string]string {
 	c.lock.RLock()
@@ -1140,6 +1208,54 @@ func (c *Container) SetDependsOn(dependsOn []DependsOn) {
 	c.DependsOnUnsafe = dependsOn
 }
 
+// GetWaitingFor returns the container ordering dependencies that the container is blocked on.
+func (c *Container) GetWaitingFor() []DependsOn {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.waitingFor
+}
+
+// SetWaitingFor sets the container ordering dependencies that the container is blocked on.
+func (c *Container) SetWaitingFor(waitingFor []DependsOn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.waitingFor = waitingFor
+}
+
+// GetPID returns the process ID of the container's init process.
+func (c *Container) GetPID() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.pid
+}
+
+// SetPID sets the process ID of the container's init process.
+func (c *Container) SetPID(pid int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.pid = pid
+}
+
+// GetEffectivePIDMode returns the task level PID mode applied to the container.
+func (c *Container) GetEffectivePIDMode() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.EffectivePIDModeUnsafe
+}
+
+// SetEffectivePIDMode sets the task level PID mode applied to the container.
+func (c *Container) SetEffectivePIDMode(pidMode string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.EffectivePIDModeUnsafe = pidMode
+}
+
 // DependsOnContainer checks whether a container depends on another container.
 func (c *Container) DependsOnContainer(name string) bool {
 	c.lock.RLock()
@@ -1173,6 +1289,25 @@ func (c *Container) AddContainerDependency(name string, condition string) {
 	})
 }
 
+// HasTTY returns whether the container is allocated a TTY.
+func (c *Container) HasTTY() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.DockerConfig.Config == nil {
+		return false
+	}
+
+	config := &dockercontainer.Config{}
+	err := json.Unmarshal([]byte(*c.DockerConfig.Config), config)
+	if err != nil {
+		seelog.Warnf("Encountered error when trying to get the TTY of container %s: %v", c.RuntimeID, err)
+		return false
+	}
+
+	return config.Tty
+}
+
 // GetLogDriver returns the log driver used by the container.
 func (c *Container) GetLogDriver() string {
 	c.lock.RLock()
@@ -1232,6 +1367,25 @@ func (c *Container) GetNetworkModeFromHostConfig() string {
 	return hostConfig.NetworkMode.NetworkName()
 }
 
+// IsPrivileged returns whether the container's host config requests privileged mode.
+func (c *Container) IsPrivileged() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.DockerConfig.HostConfig == nil {
+		return false
+	}
+
+	hostConfig := &dockercontainer.HostConfig{}
+	err := json.Unmarshal([]byte(*c.DockerConfig.HostConfig), hostConfig)
+	if err != nil {
+		seelog.Warnf("Encountered error when trying to get privileged mode for container %s: %v", c.RuntimeID, err)
+		return false
+	}
+
+	return hostConfig.Privileged
+}
+
 // GetHostConfig returns the container's host config.
 func (c *Container) GetHostConfig() *string {
 	c.lock.RLock()
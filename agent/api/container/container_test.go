@@ -639,6 +639,22 @@ func TestAddContainerDependency(t *testing.T) {
 	})
 }
 
+func TestHasTTY(t *testing.T) {
+	for config, expected := range map[string]bool{
+		`{"Tty":true}`:  true,
+		`{"Tty":false}`: false,
+		`{}`:            false,
+		"invalid":       false,
+	} {
+		t.Run(config, func(t *testing.T) {
+			c := &Container{Name: "c"}
+			c.DockerConfig.Config = &config
+			assert.Equal(t, expected, c.HasTTY())
+		})
+	}
+	assert.False(t, (&Container{Name: "c"}).HasTTY())
+}
+
 func TestGetLogDriver(t *testing.T) {
 	getContainer := func(hostConfig string) *Container {
 		c := &Container{
@@ -672,6 +688,19 @@ func TestGetLogDriver(t *testing.T) {
 	}
 }
 
+func TestIsPrivileged(t *testing.T) {
+	hostConfig := func(config string) *Container {
+		c := &Container{Name: "c"}
+		c.DockerConfig.HostConfig = &config
+		return c
+	}
+
+	assert.False(t, (&Container{Name: "c"}).IsPrivileged())
+	assert.True(t, hostConfig(`{"Privileged":true}`).IsPrivileged())
+	assert.False(t, hostConfig(`{"Privileged":false}`).IsPrivileged())
+	assert.False(t, hostConfig("invalid").IsPrivileged())
+}
+
 func TestGetNetworkModeFromHostConfig(t *testing.T) {
 	getContainer := func(hostConfig string) *Container {
 		c := &Container{
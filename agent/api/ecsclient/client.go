@@ -23,6 +23,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
 	"github.com/aws/amazon-ecs-agent/agent/async"
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/ec2"
 	"github.com/aws/amazon-ecs-agent/agent/httpclient"
@@ -30,6 +31,8 @@ import (
 	apierrors "github.com/aws/amazon-ecs-agent/ecs-agent/api/errors"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -65,11 +68,13 @@ type APIECSClient struct {
 	pollEndpointCache       async.TTLCache
 }
 
-// NewECSClient creates a new ECSClient interface object
+// NewECSClient creates a new ECSClient interface object. The responses of its calls are
+// passed to clockDrift to check the host clock skew, unless clockDrift is nil.
 func NewECSClient(
 	credentialProvider *credentials.Credentials,
 	config *config.Config,
-	ec2MetadataClient ec2.EC2MetadataClient) api.ECSClient {
+	ec2MetadataClient ec2.EC2MetadataClient,
+	clockDrift *clockdrift.Checker) api.ECSClient {
 
 	var ecsConfig aws.Config
 	ecsConfig.Credentials = credentialProvider
@@ -77,9 +82,17 @@ func NewECSClient(
 	ecsConfig.HTTPClient = httpclient.New(RoundtripTimeout, config.AcceptInsecureCert)
 	if config.APIEndpoint != "" {
 		ecsConfig.Endpoint = &config.APIEndpoint
+	} else if err := config.EndpointResolver().Configure(&ecsConfig, awsendpoints.ECS, config.AWSRegion); err != nil {
+		logger.Error("Unable to resolve the ECS endpoint, using the default endpoint", logger.Fields{
+			field.Error: err,
+		})
 	}
 	standardClient := ecs.New(session.New(&ecsConfig))
 	submitStateChangeClient := newSubmitStateChangeClient(&ecsConfig)
+	if clockDrift != nil {
+		standardClient.Handlers.Send.PushBackNamed(clockDriftHandler(clockDrift))
+		submitStateChangeClient.Handlers.Send.PushBackNamed(clockDriftHandler(clockDrift))
+	}
 	return &APIECSClient{
 		credentialProvider:      credentialProvider,
 		config:                  config,
@@ -0,0 +1,39 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecsclient
+
+import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const clockDriftHandlerName = "ecsclient.ClockDriftHandler"
+
+// clockDriftHandler returns a handler that passes the response of every attempt of an
+// ECS API call to the clock drift checker. The checker is rate limited and returns
+// straight away, so the handler doesn't delay the call.
+func clockDriftHandler(checker *clockdrift.Checker) request.NamedHandler {
+	return request.NamedHandler{
+		Name: clockDriftHandlerName,
+		Fn: func(r *request.Request) {
+			if r.HTTPResponse == nil {
+				return
+			}
+			checker.ObserveResponse(r.AttemptTime, time.Now(), r.HTTPResponse.Header)
+		},
+	}
+}
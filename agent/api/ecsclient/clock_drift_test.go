@@ -0,0 +1,61 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecsclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockDriftCheckedFromResponses(t *testing.T) {
+	serverSkew := 10 * time.Minute
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(serverSkew).UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write([]byte(`{"cluster":{"clusterName":"cluster"}}`))
+	}))
+	defer server.Close()
+
+	checker := clockdrift.NewChecker(time.Minute, time.Hour, "")
+	client := NewECSClient(credentials.AnonymousCredentials, &config.Config{
+		AWSRegion:   "us-east-1",
+		APIEndpoint: server.URL,
+	}, nil, checker)
+
+	_, err := client.(*APIECSClient).CreateCluster("cluster")
+	require.NoError(t, err)
+	estimate, ok := checker.Estimate()
+	require.True(t, ok)
+	assert.Equal(t, clockdrift.SourceDateHeader, estimate.Source)
+	assert.InDelta(t, -serverSkew.Seconds(), estimate.SkewSeconds, 1.5)
+	assert.True(t, estimate.ExceedsThreshold)
+
+	// Checks are rate limited, so the next response is not looked at
+	serverSkew = 0
+	_, err = client.(*APIECSClient).CreateCluster("cluster")
+	require.NoError(t, err)
+	estimate, _ = checker.Estimate()
+	assert.True(t, estimate.ExceedsThreshold)
+}
@@ -102,6 +102,29 @@ type AttachmentStateChange struct {
 	Attachment *apieni.ENIAttachment
 }
 
+// ResourceStateChange represents an attempt to transition a task resource, or the
+// rollback of a resource after another resource of the task failed to be created.
+// Resource state changes are published locally, and never sent to the backend.
+type ResourceStateChange struct {
+	// TaskArn is the unique identifier for the task
+	TaskArn string
+	// ResourceName is the name of the resource
+	ResourceName string
+	// ResourceType is the type of the resource in the resources map of the task
+	ResourceType string
+	// Status is the status that the resource transitioned to, or failed to
+	// transition to if Reason is set
+	Status string
+	// Attempt is the number of the attempt of the transition, starting at 1. It is 0
+	// for rollbacks
+	Attempt int
+	// MaxAttempts is the number of times the transition is attempted before the
+	// resource fails to be created
+	MaxAttempts int
+	// Reason is the error of the transition, if it failed
+	Reason string
+}
+
 type ErrShouldNotSendEvent struct {
 	resourceId string
 }
@@ -349,6 +372,18 @@ func (change *TaskStateChange) String() string {
 	return res
 }
 
+// String returns a human readable string representation of this object
+func (change *ResourceStateChange) String() string {
+	res := fmt.Sprintf("%s %s -> %s", change.TaskArn, change.ResourceName, change.Status)
+	if change.Attempt > 0 {
+		res += fmt.Sprintf(", attempt %d/%d", change.Attempt, change.MaxAttempts)
+	}
+	if change.Reason != "" {
+		res += ", reason: " + change.Reason
+	}
+	return res
+}
+
 // String returns a human readable string representation of this object
 func (change *AttachmentStateChange) String() string {
 	if change.Attachment != nil {
@@ -373,6 +408,11 @@ func (ts TaskStateChange) GetEventType() statechange.EventType {
 	return statechange.TaskEvent
 }
 
+// GetEventType returns an enum identifying the event type
+func (ResourceStateChange) GetEventType() statechange.EventType {
+	return statechange.ResourceEvent
+}
+
 // GetEventType returns an enum identifying the event type
 func (AttachmentStateChange) GetEventType() statechange.EventType {
 	return statechange.AttachmentEvent
@@ -0,0 +1,142 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+)
+
+// PendingTaskStateChanges holds the task state changes of a task that have not been
+// submitted to ECS yet, in the order they are to be submitted. It is persisted so that
+// the changes survive agent restarts.
+type PendingTaskStateChanges struct {
+	TaskARN string                  `json:"taskARN"`
+	Changes []TaskStateChangeRecord `json:"changes"`
+}
+
+// TaskStateChangeRecord is the persisted form of a TaskStateChange. It references the
+// task and its containers by ARN and name instead of holding pointers to them.
+type TaskStateChangeRecord struct {
+	Status             apitaskstatus.TaskStatus        `json:"status"`
+	Reason             string                          `json:"reason,omitempty"`
+	Containers         []ContainerStateChangeRecord    `json:"containers,omitempty"`
+	ManagedAgents      []ManagedAgentStateChangeRecord `json:"managedAgents,omitempty"`
+	PullStartedAt      *time.Time                      `json:"pullStartedAt,omitempty"`
+	PullStoppedAt      *time.Time                      `json:"pullStoppedAt,omitempty"`
+	ExecutionStoppedAt *time.Time                      `json:"executionStoppedAt,omitempty"`
+}
+
+// ContainerStateChangeRecord is the persisted form of a ContainerStateChange.
+type ContainerStateChangeRecord struct {
+	ContainerName string                             `json:"containerName"`
+	RuntimeID     string                             `json:"runtimeID,omitempty"`
+	Status        apicontainerstatus.ContainerStatus `json:"status"`
+	ImageDigest   string                             `json:"imageDigest,omitempty"`
+	Reason        string                             `json:"reason,omitempty"`
+	ExitCode      *int                               `json:"exitCode,omitempty"`
+	PortBindings  []apicontainer.PortBinding         `json:"portBindings,omitempty"`
+}
+
+// ManagedAgentStateChangeRecord is the persisted form of a ManagedAgentStateChange.
+type ManagedAgentStateChangeRecord struct {
+	ContainerName string                                `json:"containerName"`
+	Name          string                                `json:"name"`
+	Status        apicontainerstatus.ManagedAgentStatus `json:"status"`
+	Reason        string                                `json:"reason,omitempty"`
+}
+
+// NewTaskStateChangeRecord creates the persisted form of a task state change.
+func NewTaskStateChangeRecord(change TaskStateChange) TaskStateChangeRecord {
+	record := TaskStateChangeRecord{
+		Status:             change.Status,
+		Reason:             change.Reason,
+		PullStartedAt:      change.PullStartedAt,
+		PullStoppedAt:      change.PullStoppedAt,
+		ExecutionStoppedAt: change.ExecutionStoppedAt,
+	}
+	for _, containerChange := range change.Containers {
+		record.Containers = append(record.Containers, ContainerStateChangeRecord{
+			ContainerName: containerChange.ContainerName,
+			RuntimeID:     containerChange.RuntimeID,
+			Status:        containerChange.Status,
+			ImageDigest:   containerChange.ImageDigest,
+			Reason:        containerChange.Reason,
+			ExitCode:      containerChange.ExitCode,
+			PortBindings:  containerChange.PortBindings,
+		})
+	}
+	for _, managedAgentChange := range change.ManagedAgents {
+		containerName := ""
+		if managedAgentChange.Container != nil {
+			containerName = managedAgentChange.Container.Name
+		}
+		record.ManagedAgents = append(record.ManagedAgents, ManagedAgentStateChangeRecord{
+			ContainerName: containerName,
+			Name:          managedAgentChange.Name,
+			Status:        managedAgentChange.Status,
+			Reason:        managedAgentChange.Reason,
+		})
+	}
+	return record
+}
+
+// ToTaskStateChange restores the task state change from its persisted form. Changes of
+// containers that are no longer part of the task are dropped.
+func (record TaskStateChangeRecord) ToTaskStateChange(task *apitask.Task) TaskStateChange {
+	change := TaskStateChange{
+		TaskARN:            task.Arn,
+		Status:             record.Status,
+		Reason:             record.Reason,
+		PullStartedAt:      record.PullStartedAt,
+		PullStoppedAt:      record.PullStoppedAt,
+		ExecutionStoppedAt: record.ExecutionStoppedAt,
+		Task:               task,
+	}
+	for _, containerRecord := range record.Containers {
+		container, ok := task.ContainerByName(containerRecord.ContainerName)
+		if !ok {
+			continue
+		}
+		change.Containers = append(change.Containers, ContainerStateChange{
+			TaskArn:       task.Arn,
+			RuntimeID:     containerRecord.RuntimeID,
+			ContainerName: containerRecord.ContainerName,
+			Status:        containerRecord.Status,
+			ImageDigest:   containerRecord.ImageDigest,
+			Reason:        containerRecord.Reason,
+			ExitCode:      containerRecord.ExitCode,
+			PortBindings:  containerRecord.PortBindings,
+			Container:     container,
+		})
+	}
+	for _, managedAgentRecord := range record.ManagedAgents {
+		container, ok := task.ContainerByName(managedAgentRecord.ContainerName)
+		if !ok {
+			continue
+		}
+		change.ManagedAgents = append(change.ManagedAgents, ManagedAgentStateChange{
+			TaskArn:   task.Arn,
+			Name:      managedAgentRecord.Name,
+			Container: container,
+			Status:    managedAgentRecord.Status,
+			Reason:    managedAgentRecord.Reason,
+		})
+	}
+	return change
+}
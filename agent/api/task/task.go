@@ -17,6 +17,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
 	"reflect"
 	"strconv"
@@ -85,6 +86,10 @@ const (
 	// neuronRuntime is the name of the neuron docker runtime.
 	neuronRuntime = "neuron"
 
+	// CPUBurstOnlyLabel is the docker label that marks a task as burst-only when a
+	// container of the task sets it to "true"
+	CPUBurstOnlyLabel = "com.amazonaws.ecs.cpu-burst-only"
+
 	ContainerOrderingCreateCondition  = "CREATE"
 	ContainerOrderingStartCondition   = "START"
 	ContainerOrderingHealthyCondition = "HEALTHY"
@@ -98,6 +103,13 @@ const (
 	// awslogsCredsEndpointOpt is the awslogs option that is used to pass in an
 	// http endpoint for authentication
 	awslogsCredsEndpointOpt = "awslogs-credentials-endpoint"
+	// awslogsDriverName is the name of the awslogs log driver
+	awslogsDriverName = "awslogs"
+	// logDriverModeOpt and logDriverMaxBufferSizeOpt are the docker log options that define
+	// how log messages are delivered from the container to the log driver
+	logDriverModeOpt          = "mode"
+	logDriverMaxBufferSizeOpt = "max-buffer-size"
+	logDriverModeNonBlocking  = "non-blocking"
 	// These contants identify the docker flag options
 	pidModeHost     = "host"
 	pidModeTask     = "task"
@@ -227,6 +239,9 @@ type Task struct {
 	// ExecutionStoppedAtUnsafe is the timestamp when the task desired status moved to stopped,
 	// which is when the any of the essential containers stopped
 	ExecutionStoppedAtUnsafe time.Time `json:"ExecutionStoppedAt"`
+	// StopRequestedAtUnsafe is the timestamp when the desired status of the task was first
+	// set to stopped, it won't be set if the task wasn't asked to stop
+	StopRequestedAtUnsafe time.Time `json:"StopRequestedAt"`
 
 	// SentStatusUnsafe represents the last KnownStatusUnsafe that was sent to the ECS SubmitTaskStateChange API.
 	// TODO(samuelkarp) SentStatusUnsafe needs a lock and setters/getters.
@@ -284,6 +299,10 @@ type Task struct {
 	// LaunchType is the launch type of this task.
 	LaunchType string `json:"LaunchType,omitempty"`
 
+	// WarningsUnsafe stores problems the agent ran into while managing the task that
+	// did not stop the task. This field should be accessed via AddWarning and GetWarnings.
+	WarningsUnsafe []string `json:"Warnings,omitempty"`
+
 	// lock is for protecting all fields in the task struct
 	lock sync.RWMutex
 
@@ -297,6 +316,10 @@ type Task struct {
 	NetworkMode string `json:"NetworkMode,omitempty"`
 
 	IsInternal bool `json:"IsInternal,omitempty"`
+
+	// IsLocal is set for tasks that were launched on this host by means of the
+	// introspection server rather than by ECS. Their state changes aren't submitted to ECS.
+	IsLocal bool `json:"IsLocal,omitempty"`
 }
 
 // TaskFromACS translates ecsacs.Task to apitask.Task by first marshaling the received
@@ -332,7 +355,8 @@ func TaskFromACS(acsTask *ecsacs.Task, envelope *ecsacs.PayloadMessage) (*Task,
 	return task, nil
 }
 
-func (task *Task) initializeVolumes(cfg *config.Config, dockerClient dockerapi.DockerClient, ctx context.Context) error {
+func (task *Task) initializeVolumes(cfg *config.Config, resourceFields *taskresource.ResourceFields,
+	dockerClient dockerapi.DockerClient, ctx context.Context) error {
 	err := task.initializeDockerLocalVolumes(dockerClient, ctx)
 	if err != nil {
 		return apierrors.NewResourceInitError(task.Arn, err)
@@ -345,9 +369,25 @@ func (task *Task) initializeVolumes(cfg *config.Config, dockerClient dockerapi.D
 	if err != nil {
 		return apierrors.NewResourceInitError(task.Arn, err)
 	}
+	if resourceFields != nil && resourceFields.ResourceFieldsCommon != nil {
+		task.setVolumeDriverProber(resourceFields.VolumeDriverProber)
+	}
 	return nil
 }
 
+// setVolumeDriverProber sets the prober used to check that volume drivers are available
+// before the docker volumes of the task are created
+func (task *Task) setVolumeDriverProber(prober taskresource.VolumeDriverProber) {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+
+	for _, resource := range task.ResourcesMapUnsafe[resourcetype.DockerVolumeKey] {
+		if volumeResource, ok := resource.(*taskresourcevolume.VolumeResource); ok {
+			volumeResource.SetDriverProber(prober)
+		}
+	}
+}
+
 // PostUnmarshalTask is run after a task has been unmarshalled, but before it has been
 // run. It is possible it will be subsequently called after that and should be
 // able to handle such an occurrence appropriately (e.g. behave idempotently).
@@ -389,7 +429,7 @@ func (task *Task) PostUnmarshalTask(cfg *config.Config,
 
 	// NOTE: initializeVolumes needs to be after initializeCredentialsEndpoint, because EFS volume might
 	// need the credentials endpoint constructed by it.
-	if err := task.initializeVolumes(cfg, dockerClient, ctx); err != nil {
+	if err := task.initializeVolumes(cfg, resourceFields, dockerClient, ctx); err != nil {
 		return err
 	}
 
@@ -411,9 +451,25 @@ func (task *Task) PostUnmarshalTask(cfg *config.Config,
 		})
 		return apierrors.NewResourceInitError(task.Arn, err)
 	}
+	if err := task.validatePIDMode(); err != nil {
+		logger.Error("Unsupported PID mode for task", logger.Fields{
+			field.TaskID: task.GetID(),
+			field.Error:  err,
+		})
+		return apierrors.NewResourceInitError(task.Arn, err)
+	}
+
 	// Adds necessary Pause containers for sharing PID or IPC namespaces
 	task.addNamespaceSharingProvisioningDependency(cfg)
 
+	if err := task.applyAWSLogsDefaults(cfg); err != nil {
+		logger.Error("Could not apply awslogs defaults", logger.Fields{
+			field.TaskID: task.GetID(),
+			field.Error:  err,
+		})
+		return apierrors.NewResourceInitError(task.Arn, err)
+	}
+
 	if err := task.applyFirelensSetup(cfg, resourceFields, credentialsManager); err != nil {
 		return err
 	}
@@ -664,7 +720,8 @@ func (task *Task) addGPUResource(cfg *config.Config) error {
 	return nil
 }
 
-func (task *Task) isGPUEnabled() bool {
+// IsGPUEnabled returns whether GPUs are associated with the task.
+func (task *Task) IsGPUEnabled() bool {
 	for _, association := range task.Associations {
 		if association.Type == GPUAssociationType {
 			return true
@@ -1183,27 +1240,57 @@ func (task *Task) GetFirelensContainer() *apicontainer.Container {
 // firelens container.
 func (task *Task) initializeFirelensResource(config *config.Config, resourceFields *taskresource.ResourceFields,
 	firelensContainer *apicontainer.Container, credentialsManager credentials.Manager) error {
+	firelensResource, container, err := task.newFirelensResource(config, resourceFields.EC2InstanceID,
+		firelensContainer, credentialsManager)
+	if err != nil {
+		return errors.Wrap(err, "unable to initialize firelens resource")
+	}
+	task.AddResource(firelens.ResourceName, firelensResource)
+	container.BuildResourceDependency(firelensResource.GetName(), resourcestatus.ResourceCreated,
+		apicontainerstatus.ContainerCreated)
+	return nil
+}
+
+// GenerateFirelensConfig generates the config file of the task's firelens container, the same way it's
+// generated when the task is started, without creating anything. Secret log options are generated as
+// config variable placeholders, so their values aren't needed.
+func (task *Task) GenerateFirelensConfig(config *config.Config, w io.Writer) error {
+	firelensContainer := task.GetFirelensContainer()
+	if firelensContainer == nil {
+		return errors.New("task has no firelens container")
+	}
+	firelensResource, _, err := task.newFirelensResource(config, "", firelensContainer, nil)
+	if err != nil {
+		return err
+	}
+	return firelensResource.GenerateConfig(w)
+}
+
+// newFirelensResource creates the firelens task resource from the log options of the containers that use the
+// awsfirelens log driver, and returns it with the firelens container.
+func (task *Task) newFirelensResource(config *config.Config, ec2InstanceID string, firelensContainer *apicontainer.Container,
+	credentialsManager credentials.Manager) (*firelens.FirelensResource, *apicontainer.Container, error) {
 	if firelensContainer.GetFirelensConfig() == nil {
-		return errors.New("firelens container config doesn't exist")
+		return nil, nil, errors.New("firelens container config doesn't exist")
 	}
 
 	containerToLogOptions := make(map[string]map[string]string)
 	// Collect plain text log options.
 	if err := task.collectFirelensLogOptions(containerToLogOptions); err != nil {
-		return errors.Wrap(err, "unable to initialize firelens resource")
+		return nil, nil, err
 	}
 
 	// Collect secret log options.
 	if err := task.collectFirelensLogEnvOptions(containerToLogOptions, firelensContainer.FirelensConfig.Type); err != nil {
-		return errors.Wrap(err, "unable to initialize firelens resource")
+		return nil, nil, err
 	}
 
 	for _, container := range task.Containers {
 		firelensConfig := container.GetFirelensConfig()
 		if firelensConfig != nil {
-			var ec2InstanceID string
+			var containerEC2InstanceID string
 			if container.Environment != nil && container.Environment[awsExecutionEnvKey] == ec2ExecutionEnv {
-				ec2InstanceID = resourceFields.EC2InstanceID
+				containerEC2InstanceID = ec2InstanceID
 			}
 
 			var networkMode string
@@ -1215,19 +1302,16 @@ func (task *Task) initializeFirelensResource(config *config.Config, resourceFiel
 				networkMode = container.GetNetworkModeFromHostConfig()
 			}
 			firelensResource, err := firelens.NewFirelensResource(config.Cluster, task.Arn, task.Family+":"+task.Version,
-				ec2InstanceID, config.DataDir, firelensConfig.Type, config.AWSRegion, networkMode, firelensConfig.Options, containerToLogOptions,
+				containerEC2InstanceID, config.DataDir, firelensConfig.Type, config.AWSRegion, networkMode, firelensConfig.Options, containerToLogOptions,
 				credentialsManager, task.ExecutionCredentialsID)
 			if err != nil {
-				return errors.Wrap(err, "unable to initialize firelens resource")
+				return nil, nil, err
 			}
-			task.AddResource(firelens.ResourceName, firelensResource)
-			container.BuildResourceDependency(firelensResource.GetName(), resourcestatus.ResourceCreated,
-				apicontainerstatus.ContainerCreated)
-			return nil
+			return firelensResource, container, nil
 		}
 	}
 
-	return errors.New("unable to initialize firelens resource because there's no firelens container")
+	return nil, nil, errors.New("there's no firelens container")
 }
 
 // addFirelensContainerDependency adds a START dependency between each container using awsfirelens log driver
@@ -1287,6 +1371,74 @@ func (task *Task) addFirelensContainerDependency() error {
 	return nil
 }
 
+// applyAWSLogsDefaults sets mode=non-blocking and the default max-buffer-size in the log
+// configuration of the containers that use the awslogs log driver and don't specify a mode,
+// if enabled in the agent config. Log options set in the task definition are never overridden.
+// The host config from the task definition is updated in place, so that the effective log
+// configuration is also what the task metadata endpoint reports.
+func (task *Task) applyAWSLogsDefaults(cfg *config.Config) error {
+	if !cfg.AWSLogsNonBlockingDefault.Enabled() {
+		return nil
+	}
+	for _, container := range task.Containers {
+		if container.DockerConfig.HostConfig == nil {
+			continue
+		}
+
+		// Decode the host config into a generic map rather than a docker HostConfig, so that
+		// only the log configuration is changed when encoding it again.
+		rawHostConfig := map[string]json.RawMessage{}
+		if err := json.Unmarshal([]byte(*container.DockerConfig.HostConfig), &rawHostConfig); err != nil {
+			return errors.Wrapf(err, "unable to decode host config of container %s", container.Name)
+		}
+		logConfigKey := ""
+		for key := range rawHostConfig {
+			if strings.EqualFold(key, "LogConfig") {
+				logConfigKey = key
+				break
+			}
+		}
+		if logConfigKey == "" {
+			continue
+		}
+		logConfig := dockercontainer.LogConfig{}
+		if err := json.Unmarshal(rawHostConfig[logConfigKey], &logConfig); err != nil {
+			return errors.Wrapf(err, "unable to decode log config of container %s", container.Name)
+		}
+		if logConfig.Type != awslogsDriverName {
+			continue
+		}
+		if _, ok := logConfig.Config[logDriverModeOpt]; ok {
+			continue
+		}
+
+		if logConfig.Config == nil {
+			logConfig.Config = map[string]string{}
+		}
+		logConfig.Config[logDriverModeOpt] = logDriverModeNonBlocking
+		_, maxBufferSizeSet := logConfig.Config[logDriverMaxBufferSizeOpt]
+		if !maxBufferSizeSet && cfg.AWSLogsDefaultMaxBufferSize != "" {
+			logConfig.Config[logDriverMaxBufferSizeOpt] = cfg.AWSLogsDefaultMaxBufferSize
+		}
+
+		rawLogConfig, err := json.Marshal(logConfig)
+		if err != nil {
+			return errors.Wrapf(err, "unable to encode log config of container %s", container.Name)
+		}
+		rawHostConfig[logConfigKey] = rawLogConfig
+		hostConfig, err := json.Marshal(rawHostConfig)
+		if err != nil {
+			return errors.Wrapf(err, "unable to encode host config of container %s", container.Name)
+		}
+		container.DockerConfig.HostConfig = aws.String(string(hostConfig))
+		logger.Info("Applied awslogs non-blocking mode default", logger.Fields{
+			field.TaskID:    task.GetID(),
+			field.Container: container.Name,
+		})
+	}
+	return nil
+}
+
 // collectFirelensLogOptions collects the log options for all the containers that use the firelens container
 // as the log driver.
 // containerToLogOptions is a nested map. Top level key is the container name. Second level is a map storing
@@ -1928,7 +2080,7 @@ func (task *Task) dockerHostConfig(container *apicontainer.Container, dockerCont
 // overrideContainerRuntime overrides the runtime for the container in host config if needed.
 func (task *Task) overrideContainerRuntime(container *apicontainer.Container, hostCfg *dockercontainer.HostConfig,
 	cfg *config.Config) *apierrors.HostConfigError {
-	if task.isGPUEnabled() && task.shouldRequireNvidiaRuntime(container) {
+	if task.IsGPUEnabled() && task.shouldRequireNvidiaRuntime(container) {
 		if !cfg.External.Enabled() {
 			if task.NvidiaRuntime == "" {
 				return &apierrors.HostConfigError{Msg: "Runtime is not set for GPU containers"}
@@ -2164,6 +2316,7 @@ func (task *Task) pidModeOverride(container *apicontainer.Container, dockerConta
 	switch task.getPIDMode() {
 	case pidModeHost:
 		setPIDMode(hostConfig, pidModeHost)
+		container.SetEffectivePIDMode(pidModeHost)
 		return
 
 	case pidModeTask:
@@ -2185,6 +2338,7 @@ func (task *Task) pidModeOverride(container *apicontainer.Container, dockerConta
 			return
 		}
 		setPIDMode(hostConfig, dockerMappingContainerPrefix+pauseDockerID.DockerID)
+		container.SetEffectivePIDMode(pidModeTask)
 		return
 
 		// If PIDMode is not Host or Task, then no need to override
@@ -2617,6 +2771,9 @@ func (task *Task) updateTaskDesiredStatusUnsafe() {
 		}
 		if cont.Essential && (cont.KnownTerminal() || cont.DesiredTerminal()) {
 			task.DesiredStatusUnsafe = apitaskstatus.TaskStopped
+			if task.StopRequestedAtUnsafe.IsZero() {
+				task.StopRequestedAtUnsafe = time.Now()
+			}
 			logger.Info("Essential container stopped; updated task desired status to stopped", task.fieldsUnsafe())
 		}
 	}
@@ -2745,12 +2902,25 @@ func (task *Task) GetDesiredStatus() apitaskstatus.TaskStatus {
 	return task.DesiredStatusUnsafe
 }
 
-// SetDesiredStatus sets the desired status of the task
+// SetDesiredStatus sets the desired status of the task. The time that the desired status is
+// first set to stopped is recorded as the time that the stop was requested.
 func (task *Task) SetDesiredStatus(status apitaskstatus.TaskStatus) {
 	task.lock.Lock()
 	defer task.lock.Unlock()
 
 	task.DesiredStatusUnsafe = status
+	if status.Terminal() && task.StopRequestedAtUnsafe.IsZero() {
+		task.StopRequestedAtUnsafe = time.Now()
+	}
+}
+
+// GetStopRequestedAt returns the time that the task was asked to stop, which is zero if it
+// wasn't asked to stop
+func (task *Task) GetStopRequestedAt() time.Time {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+
+	return task.StopRequestedAtUnsafe
 }
 
 // GetSentStatus safely returns the SentStatus of the task
@@ -2958,6 +3128,21 @@ func (task *Task) getResourcesUnsafe() []taskresource.TaskResource {
 	return resourceList
 }
 
+// GetResourceType returns the type of the resource in ResourcesMap, or an empty string if
+// the resource isn't a resource of the task
+func (task *Task) GetResourceType(resource taskresource.TaskResource) string {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+	for resourceType, resources := range task.ResourcesMapUnsafe {
+		for _, res := range resources {
+			if res == resource {
+				return resourceType
+			}
+		}
+	}
+	return ""
+}
+
 // AddResource adds a resource to ResourcesMap
 func (task *Task) AddResource(resourceType string, resource taskresource.TaskResource) {
 	task.lock.Lock()
@@ -2987,6 +3172,26 @@ func (task *Task) RequiresDomainlessCredentialSpecResource() bool {
 	return false
 }
 
+// IsCPUBurstOnly returns whether the task is burst-only, which is requested by setting the
+// CPUBurstOnlyLabel docker label of any container of the task to "true". Burst-only tasks only
+// use the CPU that other tasks leave idle, which suits batch tasks that run on the same
+// instances as latency critical tasks.
+func (task *Task) IsCPUBurstOnly() bool {
+	for _, container := range task.Containers {
+		if container.DockerConfig.Config == nil {
+			continue
+		}
+		containerConfig := &dockercontainer.Config{}
+		if err := json.Unmarshal([]byte(aws.StringValue(container.DockerConfig.Config)), containerConfig); err != nil {
+			continue
+		}
+		if burstOnly, err := strconv.ParseBool(containerConfig.Labels[CPUBurstOnlyLabel]); err == nil && burstOnly {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCredentialSpecResource retrieves credentialspec resource from resource map
 func (task *Task) GetCredentialSpecResource() ([]taskresource.TaskResource, bool) {
 	task.lock.RLock()
@@ -2996,6 +3201,43 @@ func (task *Task) GetCredentialSpecResource() ([]taskresource.TaskResource, bool
 	return res, ok
 }
 
+// getCredentialSpecResourceImpl returns the credentialspec resource of the task, if any
+func (task *Task) getCredentialSpecResourceImpl() (*credentialspec.CredentialSpecResource, bool) {
+	resources, ok := task.GetCredentialSpecResource()
+	if !ok || len(resources) == 0 {
+		return nil, false
+	}
+	credentialspecResource, ok := resources[0].(*credentialspec.CredentialSpecResource)
+	return credentialspecResource, ok
+}
+
+// GetCredentialSpecLifecycleStatus returns the fetch and renewal status of the credential specs
+// of the task, or nil if the task doesn't use credential specs
+func (task *Task) GetCredentialSpecLifecycleStatus() *credentialspec.LifecycleStatus {
+	credentialspecResource, ok := task.getCredentialSpecResourceImpl()
+	if !ok {
+		return nil
+	}
+	status := credentialspecResource.GetLifecycleStatus()
+	return &status
+}
+
+// MarkCredentialSpecRenewalScheduled records that the credentials used by the credential specs
+// of the task are being renewed
+func (task *Task) MarkCredentialSpecRenewalScheduled() {
+	if credentialspecResource, ok := task.getCredentialSpecResourceImpl(); ok {
+		credentialspecResource.MarkRenewalScheduled()
+	}
+}
+
+// MarkCredentialSpecRenewalResult records the outcome of renewing the credentials used by the
+// credential specs of the task
+func (task *Task) MarkCredentialSpecRenewalResult(err error) {
+	if credentialspecResource, ok := task.getCredentialSpecResourceImpl(); ok {
+		credentialspecResource.MarkRenewalResult(err)
+	}
+}
+
 // getAllCredentialSpecRequirements is used to build all the credential spec requirements for the task
 func (task *Task) GetAllCredentialSpecRequirements() map[string]string {
 	reqsContainerMap := make(map[string]string)
@@ -3031,6 +3273,28 @@ func (task *Task) GetTerminalReason() string {
 	return task.terminalReason
 }
 
+// AddWarning records a problem that did not stop the task. Warnings that were
+// already recorded are ignored.
+func (task *Task) AddWarning(warning string) {
+	task.lock.Lock()
+	defer task.lock.Unlock()
+
+	for _, existing := range task.WarningsUnsafe {
+		if existing == warning {
+			return
+		}
+	}
+	task.WarningsUnsafe = append(task.WarningsUnsafe, warning)
+}
+
+// GetWarnings returns the warnings recorded for the task.
+func (task *Task) GetWarnings() []string {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+
+	return append([]string(nil), task.WarningsUnsafe...)
+}
+
 // PopulateASMAuthData sets docker auth credentials for a container
 func (task *Task) PopulateASMAuthData(container *apicontainer.Container) error {
 	secretID := container.RegistryAuthentication.ASMAuthData.CredentialsParameter
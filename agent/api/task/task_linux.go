@@ -80,6 +80,9 @@ func (task *Task) initializeCgroupResourceSpec(cgroupPath string, cGroupCPUPerio
 	}
 	cgroupResource := cgroup.NewCgroupResource(task.Arn, resourceFields.Control,
 		resourceFields.IOUtil, cgroupRoot, cgroupPath, resSpec)
+	if task.IsCPUBurstOnly() {
+		cgroupResource.SetCPUBurstOnly(true)
+	}
 	task.AddResource(resourcetype.CgroupKey, cgroupResource)
 	for _, container := range task.Containers {
 		container.BuildResourceDependency(cgroupResource.GetName(),
@@ -138,6 +141,13 @@ func (task *Task) BuildLinuxResourceSpec(cGroupCPUPeriod time.Duration) (specs.L
 		linuxResourceSpec.CPU = &linuxCPUSpec
 	}
 
+	// Burst-only tasks get the minimum weight, so that they only use the CPU that other
+	// tasks leave idle. On cgroup v2 the task cgroup is also marked idle once created.
+	if task.IsCPUBurstOnly() {
+		taskCPUShares := uint64(minimumCPUShare)
+		linuxResourceSpec.CPU.Shares = &taskCPUShares
+	}
+
 	// Validate and build task memory spec
 	// NOTE: task memory specifications are optional
 	if task.Memory > 0 {
@@ -371,3 +381,22 @@ func (task *Task) BuildCNIConfigBridgeMode(cniConfig *ecscni.Config, containerNa
 	cniConfig.ContainerNetNS = fmt.Sprintf(ecscni.NetnsFormat, cniConfig.ContainerPID)
 	return cniConfig, nil
 }
+
+// validatePIDMode validates the task PID mode against the platform. All PID modes are
+// supported on Linux.
+func (task *Task) validatePIDMode() error {
+	return nil
+}
+
+// GetCPUBurstMode returns how the task cgroup was configured for the task to only use idle
+// CPU, which is empty if the task isn't burst-only or its cgroup isn't created yet
+func (task *Task) GetCPUBurstMode() string {
+	task.lock.RLock()
+	defer task.lock.RUnlock()
+	for _, resource := range task.ResourcesMapUnsafe[resourcetype.CgroupKey] {
+		if cgroupResource, ok := resource.(*cgroup.CgroupResource); ok {
+			return cgroupResource.GetCPUBurstMode()
+		}
+	}
+	return ""
+}
@@ -603,6 +603,84 @@ func TestInitCgroupResourceSpecHappyPath(t *testing.T) {
 	assert.Equal(t, 1, len(task.Containers[0].TransitionDependenciesMap))
 }
 
+// burstOnlyDockerConfig returns the docker config of a container with the burst-only label
+func burstOnlyDockerConfig(value string) apicontainer.DockerConfig {
+	config := fmt.Sprintf(`{"Labels":{%q:%q}}`, CPUBurstOnlyLabel, value)
+	return apicontainer.DockerConfig{Config: &config}
+}
+
+func TestIsCPUBurstOnly(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		dockerConfig apicontainer.DockerConfig
+		burstOnly    bool
+	}{
+		{name: "no docker config", burstOnly: false},
+		{name: "label true", dockerConfig: burstOnlyDockerConfig("true"), burstOnly: true},
+		{name: "label false", dockerConfig: burstOnlyDockerConfig("false"), burstOnly: false},
+		{name: "label invalid", dockerConfig: burstOnlyDockerConfig("sometimes"), burstOnly: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			task := &Task{
+				Containers: []*apicontainer.Container{
+					{Name: "c1"},
+					{Name: "c2", DockerConfig: tc.dockerConfig},
+				},
+			}
+			assert.Equal(t, tc.burstOnly, task.IsCPUBurstOnly())
+		})
+	}
+}
+
+// TestBuildLinuxResourceSpecCPUBurstOnly validates that burst-only tasks get the minimum
+// CPU shares, with and without task CPU limits
+func TestBuildLinuxResourceSpecCPUBurstOnly(t *testing.T) {
+	for _, taskCPU := range []float64{0, taskVCPULimit} {
+		task := &Task{
+			Arn: validTaskArn,
+			CPU: taskCPU,
+			Containers: []*apicontainer.Container{
+				{Name: "c1", CPU: 512, DockerConfig: burstOnlyDockerConfig("true")},
+			},
+		}
+		linuxResourceSpec, err := task.BuildLinuxResourceSpec(defaultCPUPeriod)
+		require.NoError(t, err)
+		require.NotNil(t, linuxResourceSpec.CPU.Shares)
+		assert.Equal(t, uint64(minimumCPUShare), *linuxResourceSpec.CPU.Shares)
+		if taskCPU > 0 {
+			assert.NotNil(t, linuxResourceSpec.CPU.Quota)
+		}
+	}
+}
+
+func TestInitCgroupResourceSpecCPUBurstOnly(t *testing.T) {
+	task := &Task{
+		Arn: validTaskArn,
+		Containers: []*apicontainer.Container{
+			{
+				Name:                      "c1",
+				DockerConfig:              burstOnlyDockerConfig("true"),
+				TransitionDependenciesMap: make(map[apicontainerstatus.ContainerStatus]apicontainer.TransitionDependencySet),
+			},
+		},
+		MemoryCPULimitsEnabled: true,
+		ResourcesMapUnsafe:     make(map[string][]taskresource.TaskResource),
+	}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert.NoError(t, task.initializeCgroupResourceSpec("cgroupPath", defaultCPUPeriod, &taskresource.ResourceFields{
+		Control: mock_control.NewMockControl(ctrl),
+		ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
+			IOUtil: mock_ioutilwrapper.NewMockIOUtil(ctrl),
+		},
+	}))
+	// The burst mode is only known once the cgroup is created
+	assert.Empty(t, task.GetCPUBurstMode())
+	data, err := json.Marshal(task.GetResources()[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"cpuBurstOnly":true`)
+}
+
 func TestInitCgroupResourceSpecInvalidARN(t *testing.T) {
 	task := &Task{
 		Arn:     "arn", // malformed arn
@@ -1603,6 +1603,64 @@ func TestNamespaceProvisionDependencyAndHostConfig(t *testing.T) {
 	}
 }
 
+// Tests that the task PID mode is applied to the docker host config of every container
+// in the task, and recorded as the effective PID mode of the container.
+func TestPIDModePropagatedToAllContainers(t *testing.T) {
+	for _, pidMode := range []string{"task", "host", ""} {
+		t.Run("pidMode="+pidMode, func(t *testing.T) {
+			taskFromACS := ecsacs.Task{
+				Arn:           strptr("myArn"),
+				DesiredStatus: strptr("RUNNING"),
+				Family:        strptr("myFamily"),
+				PidMode:       strptr(pidMode),
+				Version:       strptr("1"),
+				Containers: []*ecsacs.Container{
+					{Name: strptr("container1")},
+					{Name: strptr("container2")},
+					{
+						Name: strptr("container3"),
+						DockerConfig: &ecsacs.DockerConfig{
+							HostConfig: strptr(`{"CapAdd":["SYS_PTRACE"]}`),
+						},
+					},
+				},
+			}
+			seqNum := int64(42)
+			task, err := TaskFromACS(&taskFromACS, &ecsacs.PayloadMessage{SeqNum: &seqNum})
+			require.NoError(t, err)
+			require.NoError(t, task.PostUnmarshalTask(&config.Config{}, nil, nil, nil, nil))
+
+			docMaps := dockerMap(task)
+			namespacePause, pauseFound := task.ContainerByName(NamespacePauseContainerName)
+			assert.Equal(t, pidMode == "task", pauseFound)
+			appContainers := 0
+			for _, container := range task.Containers {
+				dockHostCfg, err := task.DockerHostConfig(container, docMaps, defaultDockerClientAPIVersion,
+					&config.Config{})
+				require.Nil(t, err)
+				if container.IsInternal() {
+					assert.Empty(t, string(dockHostCfg.PidMode), container.Name)
+					assert.Empty(t, container.GetEffectivePIDMode(), container.Name)
+					continue
+				}
+				appContainers++
+				switch pidMode {
+				case "task":
+					assert.True(t, dockHostCfg.PidMode.IsContainer(), container.Name)
+					assert.Equal(t, docMaps[namespacePause.Name].DockerID, dockHostCfg.PidMode.Container(),
+						container.Name)
+				case "host":
+					assert.True(t, dockHostCfg.PidMode.IsHost(), container.Name)
+				default:
+					assert.Empty(t, string(dockHostCfg.PidMode), container.Name)
+				}
+				assert.Equal(t, pidMode, container.GetEffectivePIDMode(), container.Name)
+			}
+			assert.Equal(t, 3, appContainers)
+		})
+	}
+}
+
 func TestAddNamespaceSharingProvisioningDependency(t *testing.T) {
 	for _, aTest := range namespaceTests {
 		testTask := &Task{
@@ -2230,6 +2288,32 @@ func TestSetPullStartedAt(t *testing.T) {
 	assert.Equal(t, t1, testTask.GetPullStartedAt(), "second set of pullStartedAt should have no impact")
 }
 
+// TestStopRequestedAt tests that the time that the task was first asked to stop is recorded
+// when its desired status is set to stopped, or is updated to stopped because an essential
+// container stopped
+func TestStopRequestedAt(t *testing.T) {
+	testTask := &Task{DesiredStatusUnsafe: apitaskstatus.TaskRunning}
+	testTask.SetDesiredStatus(apitaskstatus.TaskRunning)
+	assert.True(t, testTask.GetStopRequestedAt().IsZero())
+
+	testTask.SetDesiredStatus(apitaskstatus.TaskStopped)
+	stopRequestedAt := testTask.GetStopRequestedAt()
+	assert.False(t, stopRequestedAt.IsZero())
+	testTask.SetDesiredStatus(apitaskstatus.TaskStopped)
+	assert.Equal(t, stopRequestedAt, testTask.GetStopRequestedAt(), "the first stop request should be kept")
+
+	testTask = &Task{
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		Containers: []*apicontainer.Container{{
+			Essential:         true,
+			KnownStatusUnsafe: apicontainerstatus.ContainerStopped,
+		}},
+	}
+	testTask.UpdateDesiredStatus()
+	assert.Equal(t, apitaskstatus.TaskStopped, testTask.GetDesiredStatus())
+	assert.False(t, testTask.GetStopRequestedAt().IsZero())
+}
+
 // TestSetExecutionStoppedAt tests the task SetExecutionStoppedAt
 func TestSetExecutionStoppedAt(t *testing.T) {
 	testTask := &Task{}
@@ -2426,6 +2510,150 @@ func TestApplyExecutionRoleLogsAuthFailNoCredentialsForTask(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestApplyAWSLogsDefaults(t *testing.T) {
+	enabled := config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
+	disabled := config.BooleanDefaultFalse{Value: config.ExplicitlyDisabled}
+
+	testCases := []struct {
+		name               string
+		nonBlockingDefault config.BooleanDefaultFalse
+		maxBufferSize      string
+		hostConfig         string
+		expectedLogDriver  string
+		expectedLogOptions map[string]string
+	}{
+		{
+			name:               "mode not specified",
+			nonBlockingDefault: enabled,
+			maxBufferSize:      "25m",
+			hostConfig:         `{"LogConfig":{"Type":"awslogs","Config":{"awslogs-group":"group"}}}`,
+			expectedLogDriver:  "awslogs",
+			expectedLogOptions: map[string]string{
+				"awslogs-group":   "group",
+				"mode":            "non-blocking",
+				"max-buffer-size": "25m",
+			},
+		},
+		{
+			name:               "no log options",
+			nonBlockingDefault: enabled,
+			maxBufferSize:      "25m",
+			hostConfig:         `{"LogConfig":{"Type":"awslogs"}}`,
+			expectedLogDriver:  "awslogs",
+			expectedLogOptions: map[string]string{
+				"mode":            "non-blocking",
+				"max-buffer-size": "25m",
+			},
+		},
+		{
+			name:               "explicit blocking mode is not overridden",
+			nonBlockingDefault: enabled,
+			maxBufferSize:      "25m",
+			hostConfig:         `{"LogConfig":{"Type":"awslogs","Config":{"mode":"blocking"}}}`,
+			expectedLogDriver:  "awslogs",
+			expectedLogOptions: map[string]string{"mode": "blocking"},
+		},
+		{
+			name:               "explicit non-blocking mode is not given a max buffer size",
+			nonBlockingDefault: enabled,
+			maxBufferSize:      "25m",
+			hostConfig:         `{"LogConfig":{"Type":"awslogs","Config":{"mode":"non-blocking"}}}`,
+			expectedLogDriver:  "awslogs",
+			expectedLogOptions: map[string]string{"mode": "non-blocking"},
+		},
+		{
+			name:               "explicit max buffer size is not overridden",
+			nonBlockingDefault: enabled,
+			maxBufferSize:      "25m",
+			hostConfig:         `{"LogConfig":{"Type":"awslogs","Config":{"max-buffer-size":"4m"}}}`,
+			expectedLogDriver:  "awslogs",
+			expectedLogOptions: map[string]string{
+				"mode":            "non-blocking",
+				"max-buffer-size": "4m",
+			},
+		},
+		{
+			name:               "no default max buffer size",
+			nonBlockingDefault: enabled,
+			hostConfig:         `{"LogConfig":{"Type":"awslogs","Config":{}}}`,
+			expectedLogDriver:  "awslogs",
+			expectedLogOptions: map[string]string{"mode": "non-blocking"},
+		},
+		{
+			name:               "other log drivers are untouched",
+			nonBlockingDefault: enabled,
+			maxBufferSize:      "25m",
+			hostConfig:         `{"LogConfig":{"Type":"splunk","Config":{"splunk-url":"url"}}}`,
+			expectedLogDriver:  "splunk",
+			expectedLogOptions: map[string]string{"splunk-url": "url"},
+		},
+		{
+			name:               "disabled",
+			nonBlockingDefault: disabled,
+			maxBufferSize:      "25m",
+			hostConfig:         `{"LogConfig":{"Type":"awslogs","Config":{"awslogs-group":"group"}}}`,
+			expectedLogDriver:  "awslogs",
+			expectedLogOptions: map[string]string{"awslogs-group": "group"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task := &Task{
+				Arn: "arn:aws:ecs:us-east-1:012345678910:task/c09f0188-7f87-4b0f-bfc3-16296622b6fe",
+				Containers: []*apicontainer.Container{
+					{
+						Name: "c1",
+						DockerConfig: apicontainer.DockerConfig{
+							HostConfig: strptr(tc.hostConfig),
+						},
+					},
+				},
+			}
+			cfg := &config.Config{
+				AWSLogsNonBlockingDefault:   tc.nonBlockingDefault,
+				AWSLogsDefaultMaxBufferSize: tc.maxBufferSize,
+			}
+
+			require.NoError(t, task.applyAWSLogsDefaults(cfg))
+			assert.Equal(t, tc.expectedLogDriver, task.Containers[0].GetLogDriver())
+			assert.Equal(t, tc.expectedLogOptions, task.Containers[0].GetLogOptions())
+
+			hostConfig, hostConfigErr := task.DockerHostConfig(task.Containers[0], dockerMap(task),
+				defaultDockerClientAPIVersion, &config.Config{})
+			require.Nil(t, hostConfigErr)
+			assert.Equal(t, tc.expectedLogOptions, hostConfig.LogConfig.Config)
+		})
+	}
+}
+
+func TestApplyAWSLogsDefaultsPreservesHostConfig(t *testing.T) {
+	task := &Task{
+		Containers: []*apicontainer.Container{
+			{
+				Name: "c1",
+				DockerConfig: apicontainer.DockerConfig{
+					HostConfig: strptr(`{"Privileged":true,"LogConfig":{"Type":"awslogs"}}`),
+				},
+			},
+			{
+				Name: "c2",
+			},
+		},
+	}
+	cfg := &config.Config{
+		AWSLogsNonBlockingDefault:   config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled},
+		AWSLogsDefaultMaxBufferSize: "1m",
+	}
+
+	require.NoError(t, task.applyAWSLogsDefaults(cfg))
+	hostConfig := dockercontainer.HostConfig{}
+	require.NoError(t, json.Unmarshal([]byte(*task.Containers[0].DockerConfig.HostConfig), &hostConfig))
+	assert.True(t, hostConfig.Privileged)
+	assert.Equal(t, "non-blocking", hostConfig.LogConfig.Config["mode"])
+	assert.Nil(t, task.Containers[1].DockerConfig.HostConfig)
+}
+
 // TestSetMinimumMemoryLimit ensures that we set the correct minimum memory limit when the limit is too low
 func TestSetMinimumMemoryLimit(t *testing.T) {
 	testTask := &Task{
@@ -2609,6 +2837,20 @@ func TestSetTerminalReason(t *testing.T) {
 	assert.Equal(t, expectedTerminalReason, task.GetTerminalReason())
 }
 
+func TestAddWarning(t *testing.T) {
+	task := &Task{}
+	assert.Empty(t, task.GetWarnings())
+
+	task.AddWarning("first warning")
+	task.AddWarning("second warning")
+	task.AddWarning("first warning")
+	assert.Equal(t, []string{"first warning", "second warning"}, task.GetWarnings())
+
+	// The recorded warnings can't be changed through the returned slice
+	task.GetWarnings()[0] = "changed"
+	assert.Equal(t, "first warning", task.GetWarnings()[0])
+}
+
 func TestPopulateASMAuthData(t *testing.T) {
 	expectedUsername := "username"
 	expectedPassword := "password"
@@ -3648,7 +3890,7 @@ func TestTaskGPUEnabled(t *testing.T) {
 		},
 	}
 
-	assert.True(t, testTask.isGPUEnabled())
+	assert.True(t, testTask.IsGPUEnabled())
 }
 
 func TestTaskGPUDisabled(t *testing.T) {
@@ -3659,7 +3901,7 @@ func TestTaskGPUDisabled(t *testing.T) {
 			},
 		},
 	}
-	assert.False(t, testTask.isGPUEnabled())
+	assert.False(t, testTask.IsGPUEnabled())
 }
 
 func TestInitializeContainerOrderingWithLinksAndVolumesFrom(t *testing.T) {
@@ -116,3 +116,13 @@ func (task *Task) BuildCNIConfigAwsvpc(includeIPAMConfig bool, cniConfig *ecscni
 func (task *Task) BuildCNIConfigBridgeMode(cniConfig *ecscni.Config, containerName string) (*ecscni.Config, error) {
 	return nil, errors.New("unsupported platform")
 }
+
+// validatePIDMode validates the task PID mode against the platform.
+func (task *Task) validatePIDMode() error {
+	return nil
+}
+
+// GetCPUBurstMode returns an empty string, as tasks can't be burst-only on this platform
+func (task *Task) GetCPUBurstMode() string {
+	return ""
+}
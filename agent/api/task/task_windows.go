@@ -264,3 +264,23 @@ func (task *Task) BuildCNIConfigAwsvpc(includeIPAMConfig bool, cniConfig *ecscni
 func (task *Task) BuildCNIConfigBridgeMode(cniConfig *ecscni.Config, containerName string) (*ecscni.Config, error) {
 	return nil, errors.New("unsupported platform")
 }
+
+// validatePIDMode validates the task PID mode against the platform. Privileged containers
+// cannot join a PID namespace shared by the task on Windows.
+func (task *Task) validatePIDMode() error {
+	if task.getPIDMode() != pidModeTask {
+		return nil
+	}
+	for _, container := range task.Containers {
+		if container.IsPrivileged() {
+			return errors.Errorf("privileged container %s cannot share the task PID namespace on windows",
+				container.Name)
+		}
+	}
+	return nil
+}
+
+// GetCPUBurstMode returns an empty string, as tasks can't be burst-only on this platform
+func (task *Task) GetCPUBurstMode() string {
+	return ""
+}
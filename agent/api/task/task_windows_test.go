@@ -605,3 +605,36 @@ func TestBuildCNIConfig(t *testing.T) {
 	assert.True(t, eniConfig.UseExistingNetwork)
 	assert.EqualValues(t, ecscni.ECSBridgeNetworkName, cniConfig.NetworkConfigs[1].CNINetworkConfig.Network.Name)
 }
+
+func TestPostUnmarshalTaskPrivilegedSharedPIDMode(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		pidMode     string
+		hostConfig  string
+		expectError bool
+	}{
+		{name: "privileged with task pid mode", pidMode: "task", hostConfig: `{"Privileged":true}`, expectError: true},
+		{name: "unprivileged with task pid mode", pidMode: "task", hostConfig: `{}`, expectError: false},
+		{name: "privileged without task pid mode", pidMode: "", hostConfig: `{"Privileged":true}`, expectError: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			task := &Task{
+				Arn:     "myArn",
+				PIDMode: tc.pidMode,
+				Containers: []*apicontainer.Container{
+					{
+						Name:                      "c1",
+						TransitionDependenciesMap: make(map[apicontainerstatus.ContainerStatus]apicontainer.TransitionDependencySet),
+						DockerConfig:              apicontainer.DockerConfig{HostConfig: &tc.hostConfig},
+					},
+				},
+			}
+			err := task.PostUnmarshalTask(&config.Config{}, nil, nil, nil, nil)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -118,6 +118,7 @@ func TestMarshalTaskVolumesEFS(t *testing.T) {
 		"PullStartedAt": "0001-01-01T00:00:00Z",
 		"PullStoppedAt": "0001-01-01T00:00:00Z",
 		"ExecutionStoppedAt": "0001-01-01T00:00:00Z",
+		"StopRequestedAt": "0001-01-01T00:00:00Z",
 		"SentStatus": "NONE",
 		"executionCredentialsID": "",
 		"ENI": null,
@@ -165,6 +166,7 @@ func TestUnmarshalTaskVolumesEFS(t *testing.T) {
 		"PullStartedAt": "0001-01-01T00:00:00Z",
 		"PullStoppedAt": "0001-01-01T00:00:00Z",
 		"ExecutionStoppedAt": "0001-01-01T00:00:00Z",
+		"StopRequestedAt": "0001-01-01T00:00:00Z",
 		"SentStatus": "NONE",
 		"executionCredentialsID": "",
 		"ENI": null,
@@ -41,12 +41,15 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/eni/pause"
 	"github.com/aws/amazon-ecs-agent/agent/eni/watcher"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
 	"github.com/aws/amazon-ecs-agent/agent/handlers"
+	handlersv1 "github.com/aws/amazon-ecs-agent/agent/handlers/v1"
 	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers"
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers/exitcodes"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/stats"
+	"github.com/aws/amazon-ecs-agent/agent/taskfirewall"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource"
 	tcshandler "github.com/aws/amazon-ecs-agent/agent/tcs/handler"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
@@ -62,7 +65,11 @@ import (
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tcs/model/ecstcs"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/retry"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	aws_credentials "github.com/aws/aws-sdk-go/aws/credentials"
@@ -156,6 +163,12 @@ type ecsAgent struct {
 	resourceFields              *taskresource.ResourceFields
 	availabilityZone            string
 	latestSeqNumberTaskManifest *int64
+	clockDrift                  *clockdrift.Checker
+	payloadRejections           *acshandler.PayloadRejectionHistory
+	acsConnections              *wsclient.ConnectionTracker
+	tcsConnections              *wsclient.ConnectionTracker
+	gpuRuntime                  *gpu.RuntimeMonitor
+	registeredCapabilities      []*ecs.Attribute
 }
 
 // newAgent returns a new ecsAgent object, but does not start anything
@@ -183,6 +196,7 @@ func newAgent(blackholeEC2Metadata bool, acceptInsecureCert *bool) (agent, error
 		seelog.Warn("SSL certificate verification disabled. This is not recommended.")
 	}
 	seelog.Debugf("Loaded config: %s", cfg.String())
+	logAWSEndpoints(cfg)
 
 	if cfg.External.Enabled() {
 		logger.Info("ECS Agent is running in external mode.")
@@ -204,7 +218,7 @@ func newAgent(blackholeEC2Metadata bool, acceptInsecureCert *bool) (agent, error
 
 	var dataClient data.Client
 	if cfg.Checkpoint.Enabled() {
-		dataClient, err = data.New(cfg.DataDir)
+		dataClient, err = data.New(cfg.DataDir, data.WithEnvironmentScrubber(cfg.EnvironmentScrubber()))
 		if err != nil {
 			logger.Critical("Error creating Docker client", logger.Fields{
 				field.Error: err,
@@ -276,10 +290,20 @@ func (agent *ecsAgent) start() int {
 	sighandlers.StartDebugHandler()
 
 	containerChangeEventStream := eventstream.NewEventStream(containerChangeEventStreamName, agent.ctx)
-	credentialsManager := credentials.NewManager()
 	state := dockerstate.NewTaskEngineState()
+	// Credentials of tasks that the engine doesn't track anymore are evicted if the maximum
+	// number of credentials is reached
+	credentialsManager := credentials.NewManager(
+		credentials.WithMaxEntries(agent.cfg.CredentialsMaxEntries),
+		credentials.WithTrackedTaskLookup(func(taskARN string) bool {
+			_, ok := state.TaskByArn(taskARN)
+			return ok
+		}),
+		credentials.WithMetricsFactory(metrics.GlobalEntryFactory()))
 	imageManager := engine.NewImageManager(agent.cfg, agent.dockerClient, state)
-	client := ecsclient.NewECSClient(agent.credentialProvider, agent.cfg, agent.ec2MetadataClient)
+	agent.clockDrift = clockdrift.NewChecker(agent.cfg.ClockDriftThreshold, agent.cfg.ClockDriftCheckInterval,
+		agent.cfg.ClockDriftNTPServer)
+	client := ecsclient.NewECSClient(agent.credentialProvider, agent.cfg, agent.ec2MetadataClient, agent.clockDrift)
 
 	agent.initializeResourceFields(credentialsManager)
 	return agent.doStart(containerChangeEventStream, credentialsManager, state, imageManager, client, execcmd.NewManager())
@@ -456,6 +480,9 @@ func (agent *ecsAgent) doStart(containerChangeEventStream *eventstream.EventStre
 	// Begin listening to the docker daemon and saving changes
 	taskEngine.SetDataClient(agent.dataClient)
 	imageManager.SetDataClient(agent.dataClient)
+	agent.setTaskFirewall(taskEngine)
+	agent.setGPURuntimeMonitor(taskEngine)
+	agent.setImageLazyLoading(taskEngine)
 	taskEngine.MustInit(agent.ctx)
 
 	// Start back ground routines, including the telemetry session
@@ -612,6 +639,60 @@ func (agent *ecsAgent) initMetricsEngine() {
 	metrics.PublishMetrics()
 }
 
+// setTaskFirewall sets up the firewall that restricts the task metadata endpoints of
+// bridge mode tasks to the task's containers, if it's enabled. It has to be set before
+// the task engine is initialized so that rules left behind by a previous run are
+// reconciled.
+func (agent *ecsAgent) setTaskFirewall(taskEngine engine.TaskEngine) {
+	if !agent.cfg.TaskMetadataFirewallEnabled.Enabled() {
+		return
+	}
+	dockerTaskEngine, ok := taskEngine.(*engine.DockerTaskEngine)
+	if !ok {
+		return
+	}
+	executor, err := taskfirewall.NewRuleExecutor()
+	if err != nil {
+		seelog.Warnf("Unable to set up the task metadata firewall, task metadata endpoints won't be restricted: %v", err)
+		return
+	}
+	seelog.Infof("Restricting task metadata endpoints of bridge mode tasks with the %s backend", executor.Backend())
+	dockerTaskEngine.SetTaskFirewall(taskfirewall.NewFirewall(executor, tmds.Port))
+}
+
+// setImageLazyLoading makes the task engine detect whether the images it pulls can be
+// lazily loaded by the snapshotter of the docker daemon, if image lazy loading is enabled.
+func (agent *ecsAgent) setImageLazyLoading(taskEngine engine.TaskEngine) {
+	dockerTaskEngine, ok := taskEngine.(*engine.DockerTaskEngine)
+	if !ok {
+		return
+	}
+	inspector, ok := agent.dockerClient.(dockerapi.ImageManifestInspector)
+	if !ok {
+		return
+	}
+	snapshotter, ok := agent.imageLazyLoadingSnapshotter()
+	if !ok {
+		return
+	}
+	seelog.Infof("Detecting images that the %s snapshotter can lazily load", snapshotter)
+	dockerTaskEngine.SetImageLazyLoading(snapshotter, inspector)
+}
+
+// setGPURuntimeMonitor makes the task engine stop GPU tasks without starting them while
+// the GPU runtime of the host is unavailable, and starts probing the runtime periodically.
+func (agent *ecsAgent) setGPURuntimeMonitor(taskEngine engine.TaskEngine) {
+	if agent.gpuRuntime == nil {
+		return
+	}
+	dockerTaskEngine, ok := taskEngine.(*engine.DockerTaskEngine)
+	if !ok {
+		return
+	}
+	dockerTaskEngine.SetGPURuntimeStatusReporter(agent.gpuRuntime)
+	go agent.gpuRuntime.Start(agent.ctx, agent.cfg.GPURuntimeProbeInterval)
+}
+
 // newDoctorWithHealthchecks creates a new doctor and also configures
 // the healthchecks that the doctor should be running
 func (agent *ecsAgent) newDoctorWithHealthchecks(cluster, containerInstanceARN string) (*doctor.Doctor, error) {
@@ -743,6 +824,7 @@ func (agent *ecsAgent) registerContainerInstance(
 		return err
 	}
 	capabilities := append(agentCapabilities, additionalAttributes...)
+	agent.registeredCapabilities = capabilities
 
 	// Get the tags of this container instance defined in config file
 	tags := utils.MapToTags(agent.cfg.ContainerInstanceTags)
@@ -860,29 +942,116 @@ func (agent *ecsAgent) startAsyncRoutines(
 		go imageManager.StartImageCleanupProcess(agent.ctx)
 	}
 
+	// Warm the image cache with the images of the prefetch list
+	imagePrefetcher := engine.NewImagePrefetcher(agent.cfg, agent.dockerClient, imageManager)
+	go imagePrefetcher.Start(agent.ctx)
+
 	// Start automatic spot instance draining poller routine
 	if agent.cfg.SpotInstanceDrainingEnabled.Enabled() {
-		go agent.startSpotInstanceDrainingPoller(agent.ctx, client)
+		go agent.startSpotInstanceDrainingPoller(agent.ctx, client, taskEngine)
 	}
 
 	// Agent introspection api
-	go handlers.ServeIntrospectionHTTPEndpoint(agent.ctx, &agent.containerInstanceARN, taskEngine, agent.cfg)
+	breaker, _ := agent.dockerClient.(dockerapi.CircuitBreakerReporter)
+	credentialsEntries, _ := credentialsManager.(credentials.EntryCountReporter)
+	credentialsLister, _ := credentialsManager.(credentials.CredentialsLister)
+	credentialsSnapshotter, _ := credentialsManager.(credentials.CredentialsSnapshotter)
+	var localTasks engine.LocalTaskManager
+	if agent.cfg.LocalTaskLaunchEnabled.Enabled() {
+		seelog.Warn("Local task launch is enabled, tasks can be launched with stub credentials by means of the introspection server")
+		localTasks = engine.NewLocalTaskLauncher(agent.cfg, taskEngine, credentialsManager)
+	}
+	var gpuRuntime gpu.RuntimeStatusReporter
+	if agent.gpuRuntime != nil {
+		gpuRuntime = agent.gpuRuntime
+	}
+	// The runtime stats of the task metadata handlers are served by the introspection server
+	handlerStats := tmdsv1.NewRuntimeStats()
+	// Task and container state changes are streamed by the introspection server
+	taskEvents := handlersv1.NewTaskEventBroadcaster(handlersv1.DefaultTaskEventsBufferSize)
+	// along with the attempts to create task resources, and their rollbacks
+	if dockerTaskEngine, ok := taskEngine.(*engine.DockerTaskEngine); ok {
+		dockerTaskEngine.SetResourceEventPublisher(taskEvents.Publish)
+	}
+	// Credential serving can be paused and resumed through the introspection server
+	credentialsMaintenance := tmdsv1.NewMaintenanceToggle()
+	// The digest of the credentials fetches of each task is served by the introspection server
+	var credentialsFetchDigest *tmdsv1.FetchDigest
+	if agent.cfg.CredentialsAuditDigestWindow > 0 {
+		credentialsFetchDigest = tmdsv1.NewFetchDigest(agent.cfg.CredentialsAuditDigestWindow,
+			tmdsv1.DefaultFetchDigestMaxARNs)
+	}
+	// The tasks of ACS payloads that are rejected are reported by the introspection server
+	agent.payloadRejections = acshandler.NewPayloadRejectionHistory(acshandler.DefaultPayloadRejectionHistorySize)
+	// So are the connections to ACS and TCS
+	agent.acsConnections = wsclient.NewConnectionTracker()
+	agent.tcsConnections = wsclient.NewConnectionTracker()
+	// The instance credentials of external instances are rotated ahead of their expiration,
+	// and the rotation is reported by the introspection server
+	var instanceCredentials instancecreds.RotationStatusReporter
+	if agent.cfg.External.Enabled() && agent.credentialProvider != nil {
+		rotator := instancecreds.NewRotator(agent.credentialProvider, instancecreds.DefaultRotationMargin)
+		rotator.Start(agent.ctx)
+		instanceCredentials = rotator
+	}
+	go handlers.ServeIntrospectionHTTPEndpoint(agent.ctx, &agent.containerInstanceARN, taskEngine,
+		handlers.IntrospectionServerOptions{
+			CircuitBreaker:         breaker,
+			ClockSkew:              agent.clockDrift,
+			ImagePrefetch:          imagePrefetcher,
+			CredentialsEntries:     credentialsEntries,
+			CredentialsLister:      credentialsLister,
+			CredentialsSnapshotter: credentialsSnapshotter,
+			TaskCredentials:        credentialsManager,
+			LocalTasks:             localTasks,
+			Capabilities:           agent.registeredCapabilities,
+			GPURuntime:             gpuRuntime,
+			HandlerStats:           handlerStats,
+			TaskEvents:             taskEvents,
+			CredentialsMaintenance: credentialsMaintenance,
+			CredentialsFetchDigest: credentialsFetchDigest,
+			PayloadRejections:      agent.payloadRejections,
+			ACSConnection:          agent.acsConnections,
+			TCSConnection:          agent.tcsConnections,
+			InstanceCredentials:    instanceCredentials,
+			MetricsFactory:         metrics.MetricsEngineGlobal.EntryFactory(),
+		}, agent.cfg)
 
 	telemetryMessages := make(chan ecstcs.TelemetryMessage, telemetryChannelDefaultBufferSize)
 	healthMessages := make(chan ecstcs.HealthMessage, telemetryChannelDefaultBufferSize)
 
 	statsEngine := stats.NewDockerStatsEngine(agent.cfg, agent.dockerClient, containerChangeEventStream, telemetryMessages, healthMessages)
 
+	// Hold back credentials until the credentials of the restored tasks are back
+	reconciliationGate := tmdsv1.NewReconciliationGate(credentialsReconciliationRetryAfter)
+	go waitForCredentialsReconciliation(agent.ctx, state, credentialsManager, reconciliationGate,
+		credentialsReconciliationPollInterval, credentialsReconciliationTimeout)
+
+	// The tunables of the credentials handlers are reloaded from the config on SIGHUP
+	credentialsTunables := tmdsv1.NewTunablesHolder(handlers.CredentialsTunables(agent.cfg))
+	sighandlers.StartReloadHandler(agent.ctx, func() {
+		agent.reloadCredentialsTunables(credentialsTunables)
+	})
+
+	taskServerOpts := handlers.TaskServerOptions{
+		ReconciliationGate:     reconciliationGate,
+		ClockSkew:              agent.clockDrift,
+		CredentialsTunables:    credentialsTunables,
+		HandlerStats:           handlerStats,
+		CredentialsMaintenance: credentialsMaintenance,
+		CredentialsFetchDigest: credentialsFetchDigest,
+		MetricsFactory:         metrics.MetricsEngineGlobal.EntryFactory(),
+	}
 	// Start serving the endpoint to fetch IAM Role credentials and other task metadata
 	if agent.cfg.TaskMetadataAZDisabled {
 		// send empty availability zone
-		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, "", agent.vpc)
+		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, "", agent.vpc, taskServerOpts)
 	} else {
-		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, agent.availabilityZone, agent.vpc)
+		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, agent.availabilityZone, agent.vpc, taskServerOpts)
 	}
 
 	// Start sending events to the backend
-	go eventhandler.HandleEngineEvents(agent.ctx, taskEngine, client, taskHandler, attachmentEventHandler)
+	go eventhandler.HandleEngineEvents(agent.ctx, taskEngine, client, taskHandler, attachmentEventHandler, taskEvents.Publish)
 
 	err := statsEngine.MustInit(agent.ctx, taskEngine, agent.cfg.Cluster, agent.containerInstanceARN)
 	if err != nil {
@@ -903,12 +1072,24 @@ func (agent *ecsAgent) startAsyncRoutines(
 		MetricsChannel:                telemetryMessages,
 		HealthChannel:                 healthMessages,
 		Doctor:                        doctor,
+		Connections:                   agent.tcsConnections,
 	}
 	// Start metrics session in a go routine
 	go tcshandler.StartMetricsSession(&telemetrySessionParams)
 }
 
-func (agent *ecsAgent) startSpotInstanceDrainingPoller(ctx context.Context, client api.ECSClient) {
+// reloadCredentialsTunables reads the config again and swaps the tunables of the credentials
+// handlers for the ones in the new config. The rest of the config isn't reloaded.
+func (agent *ecsAgent) reloadCredentialsTunables(credentialsTunables *tmdsv1.TunablesHolder) {
+	cfg, err := config.NewConfig(agent.ec2MetadataClient)
+	if err != nil {
+		seelog.Errorf("Unable to reload the config, keeping the current credentials handler tunables: %v", err)
+		return
+	}
+	credentialsTunables.Swap(handlers.CredentialsTunables(cfg))
+}
+
+func (agent *ecsAgent) startSpotInstanceDrainingPoller(ctx context.Context, client api.ECSClient, taskEngine engine.TaskEngine) {
 	for !agent.spotInstanceDrainingPoller(client) {
 		select {
 		case <-ctx.Done():
@@ -917,6 +1098,10 @@ func (agent *ecsAgent) startSpotInstanceDrainingPoller(ctx context.Context, clie
 			time.Sleep(time.Second)
 		}
 	}
+	// Tasks of the stop-last families are stopped after all other tasks are stopped
+	if dockerTaskEngine, ok := taskEngine.(*engine.DockerTaskEngine); ok {
+		dockerTaskEngine.StartDrain(time.Now().Add(agent.cfg.DrainStopLastTimeout))
+	}
 }
 
 // spotInstanceDrainingPoller returns true if spot instance interruption has been
@@ -982,6 +1167,8 @@ func (agent *ecsAgent) startACSSession(
 		agent.latestSeqNumberTaskManifest,
 		doctor,
 		acsclient.NewACSClientFactory(),
+		agent.payloadRejections,
+		agent.acsConnections,
 	)
 	seelog.Info("Beginning Polling for updates")
 	err := acsSession.Start()
@@ -1121,3 +1308,13 @@ func contains(capabilities []string, capability string) bool {
 
 	return false
 }
+
+// logAWSEndpoints logs the endpoints that the AWS clients of the agent are pointed at.
+func logAWSEndpoints(cfg *config.Config) {
+	endpoints := cfg.EndpointResolver()
+	fields := logger.Fields{"mode": string(endpoints.Mode())}
+	for name, endpoint := range endpoints.ResolveAll(cfg.AWSRegion) {
+		fields[name] = endpoint
+	}
+	logger.Info("Resolved AWS endpoints", fields)
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
@@ -36,6 +37,7 @@ const (
 	attributePrefix                                        = "ecs.capability."
 	capabilityTaskIAMRole                                  = "task-iam-role"
 	capabilityTaskIAMRoleNetHost                           = "task-iam-role-network-host"
+	capabilityTaskIAMRoleV1CredentialsDisabled             = "task-iam-role.v1-credentials-disabled"
 	taskENIAttributeSuffix                                 = "task-eni"
 	taskENIIPv6AttributeSuffix                             = "task-eni.ipv6"
 	taskENIBlockInstanceMetadataAttributeSuffix            = "task-eni-block-instance-metadata"
@@ -43,6 +45,7 @@ const (
 	cniPluginVersionSuffix                                 = "cni-plugin-version"
 	capabilityTaskCPUMemLimit                              = "task-cpu-mem-limit"
 	capabilityIncreasedTaskCPULimit                        = "increased-task-cpu-limit"
+	capabilityCPUBurstOnly                                 = "cpu-burst-only"
 	capabilityDockerPluginInfix                            = "docker-plugin."
 	attributeSeparator                                     = "."
 	capabilityPrivateRegistryAuthASM                       = "private-registry-authentication.secretsmanager"
@@ -67,6 +70,7 @@ const (
 	capabilityFullTaskSync                                 = "full-sync"
 	capabilityGMSA                                         = "gmsa"
 	capabilityGMSADomainless                               = "gmsa-domainless"
+	capabilityImageLazyLoadingInfix                        = "image-lazy-loading."
 	capabilityEFS                                          = "efs"
 	capabilityEFSAuth                                      = "efsAuth"
 	capabilityEnvFilesS3                                   = "env-files.s3"
@@ -189,6 +193,7 @@ var (
 //	ecs.capability.external
 //	ecs.capability.service-connect-v1
 //	ecs.capability.network.container-port-range
+//	ecs.capability.image-lazy-loading.${snapshotter}
 func (agent *ecsAgent) capabilities() ([]*ecs.Attribute, error) {
 	var capabilities []*ecs.Attribute
 
@@ -225,6 +230,7 @@ func (agent *ecsAgent) capabilities() ([]*ecs.Attribute, error) {
 	}
 
 	capabilities = agent.appendIncreasedTaskCPULimitCapability(capabilities)
+	capabilities = agent.appendCPUBurstOnlyCapability(capabilities)
 	capabilities = agent.appendTaskENICapabilities(capabilities)
 	capabilities = agent.appendENITrunkingCapabilities(capabilities)
 	capabilities = agent.appendDockerDependentCapabilities(capabilities, supportedVersions)
@@ -237,6 +243,8 @@ func (agent *ecsAgent) capabilities() ([]*ecs.Attribute, error) {
 
 	capabilities = agent.appendVolumeDriverCapabilities(capabilities)
 
+	capabilities = agent.appendImageLazyLoadingCapabilities(capabilities)
+
 	if agent.cfg.GPUSupportEnabled {
 		capabilities = agent.appendNvidiaDriverVersionAttribute(capabilities)
 	}
@@ -331,6 +339,33 @@ func (agent *ecsAgent) appendGMSADomainlessCapabilities(capabilities []*ecs.Attr
 	return capabilities
 }
 
+func (agent *ecsAgent) appendImageLazyLoadingCapabilities(capabilities []*ecs.Attribute) []*ecs.Attribute {
+	if snapshotter, ok := agent.imageLazyLoadingSnapshotter(); ok {
+		return appendNameOnlyAttribute(capabilities, attributePrefix+capabilityImageLazyLoadingInfix+snapshotter)
+	}
+
+	return capabilities
+}
+
+// imageLazyLoadingSnapshotter returns the snapshotter that the docker daemon lazily loads
+// images with, if image lazy loading is enabled and the daemon stores images with a
+// snapshotter that supports it.
+func (agent *ecsAgent) imageLazyLoadingSnapshotter() (string, bool) {
+	if !agent.cfg.ImageLazyLoadingEnabled.Enabled() {
+		return "", false
+	}
+	info, err := agent.dockerClient.Info(agent.ctx, dockerclient.InfoTimeout)
+	if err != nil {
+		seelog.Warnf("Unable to get the docker daemon snapshotter, images will be pulled in full: %v", err)
+		return "", false
+	}
+	snapshotter, ok := dockerapi.LazyLoadingSnapshotter(info)
+	if !ok {
+		seelog.Infof("Docker daemon storage driver %q doesn't lazily load images, images will be pulled in full", info.Driver)
+	}
+	return snapshotter, ok
+}
+
 func (agent *ecsAgent) appendLoggingDriverCapabilities(capabilities []*ecs.Attribute) []*ecs.Attribute {
 	knownVersions := make(map[dockerclient.DockerVersion]struct{})
 	// Determine known API versions. Known versions are used exclusively for logging-driver enablement, since none of
@@ -355,6 +390,11 @@ func (agent *ecsAgent) appendTaskIamRoleCapabilities(capabilities []*ecs.Attribu
 		// to lookup the table of docker supportedVersions to API supportedVersions
 		if _, ok := supportedVersions[dockerclient.Version_1_19]; ok {
 			capabilities = appendNameOnlyAttribute(capabilities, capabilityPrefix+capabilityTaskIAMRole)
+			// Reported so that it's known that task credentials are only served by the v2+
+			// credentials endpoints
+			if agent.cfg.CredentialsV1EndpointDisabled.Enabled() {
+				capabilities = appendNameOnlyAttribute(capabilities, capabilityPrefix+capabilityTaskIAMRoleV1CredentialsDisabled)
+			}
 		} else {
 			seelog.Warn("Task IAM Role not enabled due to unsuppported Docker version")
 		}
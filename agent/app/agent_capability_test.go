@@ -364,6 +364,60 @@ func TestCapabilitiesTaskIAMRoleForSupportedDockerVersion(t *testing.T) {
 
 	ok := capMap["com.amazonaws.ecs.capability.task-iam-role"]
 	assert.True(t, ok, "Could not find iam capability when expected; got capabilities %v", capabilities)
+	assert.False(t, capMap["com.amazonaws.ecs.capability.task-iam-role.v1-credentials-disabled"],
+		"Found v1 credentials disabled capability when not expected; got capabilities %v", capabilities)
+}
+
+func TestCapabilitiesTaskIAMRoleV1CredentialsDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conf := &config.Config{
+		TaskIAMRoleEnabled:            config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled},
+		CredentialsV1EndpointDisabled: config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled},
+	}
+	mockMobyPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
+
+	client := mock_dockerapi.NewMockDockerClient(ctrl)
+	client.EXPECT().SupportedVersions().Return([]dockerclient.DockerVersion{
+		dockerclient.Version_1_19,
+	})
+	client.EXPECT().KnownVersions().Return(nil)
+	mockMobyPlugins.EXPECT().Scan().AnyTimes().Return([]string{}, nil)
+	client.EXPECT().ListPluginsWithFilters(gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any()).AnyTimes().Return([]string{}, nil)
+
+	mockPauseLoader := mock_loader.NewMockLoader(ctrl)
+	mockPauseLoader.EXPECT().IsLoaded(gomock.Any()).Return(false, nil).AnyTimes()
+
+	mockServiceConnectManager := mock_serviceconnect.NewMockManager(ctrl)
+	mockServiceConnectManager.EXPECT().IsLoaded(gomock.Any()).Return(true, nil).AnyTimes()
+	mockServiceConnectManager.EXPECT().GetLoadedAppnetVersion().AnyTimes()
+	mockServiceConnectManager.EXPECT().GetCapabilitiesForAppnetInterfaceVersion("").AnyTimes()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	// Cancel the context to cancel async routines
+	defer cancel()
+	agent := &ecsAgent{
+		ctx:                   ctx,
+		cfg:                   conf,
+		dockerClient:          client,
+		pauseLoader:           mockPauseLoader,
+		mobyPlugins:           mockMobyPlugins,
+		serviceconnectManager: mockServiceConnectManager,
+	}
+	capabilities, err := agent.capabilities()
+	assert.NoError(t, err)
+
+	capMap := make(map[string]bool)
+	for _, capability := range capabilities {
+		capMap[aws.StringValue(capability.Name)] = true
+	}
+
+	assert.True(t, capMap["com.amazonaws.ecs.capability.task-iam-role"],
+		"Could not find iam capability when expected; got capabilities %v", capabilities)
+	assert.True(t, capMap["com.amazonaws.ecs.capability.task-iam-role.v1-credentials-disabled"],
+		"Could not find v1 credentials disabled capability when expected; got capabilities %v", capabilities)
 }
 
 func TestCapabilitiesTaskIAMRoleForUnSupportedDockerVersion(t *testing.T) {
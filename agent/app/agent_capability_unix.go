@@ -100,6 +100,10 @@ func (agent *ecsAgent) appendVolumeDriverCapabilities(capabilities []*ecs.Attrib
 }
 
 func (agent *ecsAgent) appendNvidiaDriverVersionAttribute(capabilities []*ecs.Attribute) []*ecs.Attribute {
+	if status, probed := agent.gpuRuntime.RuntimeStatus(); probed && !status.Available {
+		seelog.Warnf("Not registering the nvidia driver version capability: %s", status.Reason)
+		return capabilities
+	}
 	if agent.resourceFields != nil && agent.resourceFields.NvidiaGPUManager != nil {
 		driverVersion := agent.resourceFields.NvidiaGPUManager.GetDriverVersion()
 		if driverVersion != "" {
@@ -232,3 +236,13 @@ func (agent *ecsAgent) getTaskENIPluginVersionAttribute() (*ecs.Attribute, error
 func defaultIsPlatformExecSupported() (bool, error) {
 	return true, nil
 }
+
+// appendCPUBurstOnlyCapability registers the capability of running burst-only tasks, which
+// is supported when the task cgroups are created. Hosts without idle cgroups fall back to
+// the minimum CPU weight.
+func (agent *ecsAgent) appendCPUBurstOnlyCapability(capabilities []*ecs.Attribute) []*ecs.Attribute {
+	if !agent.cfg.TaskCPUMemLimit.Enabled() {
+		return capabilities
+	}
+	return appendNameOnlyAttribute(capabilities, attributePrefix+capabilityCPUBurstOnly)
+}
@@ -31,6 +31,7 @@ import (
 	mock_ecscni "github.com/aws/amazon-ecs-agent/agent/ecscni/mocks"
 	mock_serviceconnect "github.com/aws/amazon-ecs-agent/agent/engine/serviceconnect/mock"
 	"github.com/aws/amazon-ecs-agent/agent/gpu"
+	mock_gpu "github.com/aws/amazon-ecs-agent/agent/gpu/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	mock_loader "github.com/aws/amazon-ecs-agent/agent/utils/loader/mocks"
@@ -40,6 +41,7 @@ import (
 	aws_credentials "github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -221,6 +223,32 @@ func TestNvidiaDriverCapabilitiesUnix(t *testing.T) {
 	}
 }
 
+func TestNvidiaDriverCapabilitiesGPURuntimeUnavailableUnix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	prober := mock_gpu.NewMockRuntimeProber(ctrl)
+	gomock.InOrder(
+		prober.EXPECT().Probe(gomock.Any()).Return(gpu.RuntimeInfo{}, errors.New("nvidia-smi failed")),
+		prober.EXPECT().Probe(gomock.Any()).Return(gpu.RuntimeInfo{DriverVersion: "545.23.08", DeviceCount: 1}, nil),
+	)
+	agent := &ecsAgent{
+		resourceFields: &taskresource.ResourceFields{
+			NvidiaGPUManager: &gpu.NvidiaGPUManager{
+				DriverVersion: "545.23.08",
+			},
+		},
+		gpuRuntime: gpu.NewRuntimeMonitor(prober, "545"),
+	}
+
+	agent.gpuRuntime.Probe(context.TODO())
+	assert.Empty(t, agent.appendNvidiaDriverVersionAttribute(nil))
+
+	agent.gpuRuntime.Probe(context.TODO())
+	assert.Equal(t, []*ecs.Attribute{{Name: aws.String(attributePrefix + "nvidia-driver-version.545.23.08")}},
+		agent.appendNvidiaDriverVersionAttribute(nil))
+}
+
 func TestEmptyNvidiaDriverCapabilitiesUnix(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -925,3 +953,14 @@ func TestAppendFSxWindowsFileServerCapabilities(t *testing.T) {
 	assert.Equal(t, len(inputCapabilities), len(capabilities))
 	assert.EqualValues(t, capabilities, inputCapabilities)
 }
+
+func TestAppendCPUBurstOnlyCapability(t *testing.T) {
+	agent := &ecsAgent{cfg: &config.Config{TaskCPUMemLimit: config.BooleanDefaultTrue{Value: config.ExplicitlyEnabled}}}
+	capabilities := agent.appendCPUBurstOnlyCapability(nil)
+	require.Len(t, capabilities, 1)
+	assert.Equal(t, attributePrefix+capabilityCPUBurstOnly, aws.StringValue(capabilities[0].Name))
+
+	// Task cgroups are required
+	agent.cfg.TaskCPUMemLimit = config.BooleanDefaultTrue{Value: config.ExplicitlyDisabled}
+	assert.Empty(t, agent.appendCPUBurstOnlyCapability(nil))
+}
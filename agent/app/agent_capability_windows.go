@@ -142,3 +142,7 @@ func defaultIsPlatformExecSupported() (bool, error) {
 	}
 	return true, nil
 }
+
+func (agent *ecsAgent) appendCPUBurstOnlyCapability(capabilities []*ecs.Attribute) []*ecs.Attribute {
+	return capabilities
+}
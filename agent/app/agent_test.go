@@ -476,6 +476,8 @@ func testDoStartHappyPathWithConditions(t *testing.T, blackholed bool, warmPools
 		imageManager.EXPECT().SetDataClient(gomock.Any()),
 		dockerClient.EXPECT().ContainerEvents(gomock.Any()),
 	)
+	// The instance credentials of external instances are retrieved again by their rotator
+	mockCredentialsProvider.EXPECT().Retrieve().Return(aws_credentials.Value{}, nil).AnyTimes()
 
 	cfg := getTestConfig()
 	cfg.ContainerMetadataEnabled = config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
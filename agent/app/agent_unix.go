@@ -34,6 +34,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/statechange"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource"
 	cgroup "github.com/aws/amazon-ecs-agent/agent/taskresource/cgroup/control"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource/volume"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ioutilwrapper"
 	"github.com/cihub/seelog"
 	"github.com/pkg/errors"
@@ -59,6 +60,9 @@ func (agent *ecsAgent) startWindowsService() int {
 
 var getPid = os.Getpid
 
+// newGPURuntimeProber is an injection point for testing
+var newGPURuntimeProber = gpu.NewNvidiaRuntimeProber
+
 // initializeTaskENIDependencies initializes all of the dependencies required by
 // the Agent to support the 'awsvpc' networking mode. A non nil error is returned
 // if an error is encountered during this process. An additional boolean flag to
@@ -156,11 +160,13 @@ func (agent *ecsAgent) initializeResourceFields(credentialsManager credentials.M
 		Control: cgroup.New(),
 		ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
 			IOUtil:             ioutilwrapper.NewIOUtil(),
-			ASMClientCreator:   asmfactory.NewClientCreator(),
-			SSMClientCreator:   ssmfactory.NewSSMClientCreator(),
+			ASMClientCreator:   asmfactory.NewClientCreator(agent.cfg.EndpointResolver()),
+			SSMClientCreator:   ssmfactory.NewSSMClientCreator(agent.cfg.EndpointResolver()),
 			S3ClientCreator:    s3factory.NewS3ClientCreator(),
 			CredentialsManager: credentialsManager,
 			EC2InstanceID:      agent.getEC2InstanceID(),
+			VolumeDriverProber: volume.NewDriverProber(agent.dockerClient, agent.mobyPlugins,
+				volume.DefaultDriverProbeTTL),
 		},
 		Ctx:              agent.ctx,
 		DockerClient:     agent.dockerClient,
@@ -185,7 +191,13 @@ func (agent *ecsAgent) cgroupInit() error {
 
 func (agent *ecsAgent) initializeGPUManager() error {
 	if agent.resourceFields != nil && agent.resourceFields.NvidiaGPUManager != nil {
-		return agent.resourceFields.NvidiaGPUManager.Initialize()
+		if err := agent.resourceFields.NvidiaGPUManager.Initialize(); err != nil {
+			return err
+		}
+		// The runtime is probed before the instance registers, so that the driver version
+		// attribute isn't registered while GPU tasks can't run
+		agent.gpuRuntime = gpu.NewRuntimeMonitor(newGPURuntimeProber(), agent.cfg.GPUMinDriverVersion)
+		agent.gpuRuntime.Probe(agent.ctx)
 	}
 	return nil
 }
@@ -37,6 +37,7 @@ import (
 	mock_serviceconnect "github.com/aws/amazon-ecs-agent/agent/engine/serviceconnect/mock"
 	mock_udev "github.com/aws/amazon-ecs-agent/agent/eni/udevwrapper/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/eni/watcher"
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
 	mock_gpu "github.com/aws/amazon-ecs-agent/agent/gpu/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers/exitcodes"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource"
@@ -493,6 +494,8 @@ func TestDoStartCgroupInitHappyPath(t *testing.T) {
 		dockerClient.EXPECT().ListContainers(gomock.Any(), gomock.Any(), gomock.Any()).Return(
 			dockerapi.ListContainersResponse{}).AnyTimes(),
 	)
+	// Credentials reconciliation looks up the restored tasks in the background
+	state.EXPECT().AllTasks().Return(nil).AnyTimes()
 
 	cfg := config.DefaultConfig()
 	ctx, cancel := context.WithCancel(context.TODO())
@@ -500,6 +503,7 @@ func TestDoStartCgroupInitHappyPath(t *testing.T) {
 	agent := &ecsAgent{
 		ctx:                ctx,
 		cfg:                &cfg,
+		dataClient:         data.NewNoopClient(),
 		credentialProvider: credentials.NewCredentials(mockCredentialsProvider),
 		pauseLoader:        mockPauseLoader,
 		dockerClient:       dockerClient,
@@ -587,6 +591,9 @@ func TestDoStartGPUManagerHappyPath(t *testing.T) {
 	defer ctrl.Finish()
 	mockCredentialsProvider := app_mocks.NewMockProvider(ctrl)
 	mockGPUManager := mock_gpu.NewMockGPUManager(ctrl)
+	mockGPURuntimeProber := mock_gpu.NewMockRuntimeProber(ctrl)
+	newGPURuntimeProber = func() gpu.RuntimeProber { return mockGPURuntimeProber }
+	defer func() { newGPURuntimeProber = gpu.NewNvidiaRuntimeProber }()
 	mockMobyPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
 	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
 	mockPauseLoader := mock_loader.NewMockLoader(ctrl)
@@ -632,6 +639,7 @@ func TestDoStartGPUManagerHappyPath(t *testing.T) {
 
 	gomock.InOrder(
 		mockGPUManager.EXPECT().Initialize().Return(nil),
+		mockGPURuntimeProber.EXPECT().Probe(gomock.Any()).Return(gpu.RuntimeInfo{DriverVersion: "396.44", DeviceCount: 3}, nil),
 		mockCredentialsProvider.EXPECT().Retrieve().Return(credentials.Value{}, nil),
 		dockerClient.EXPECT().SupportedVersions().Return(nil),
 		dockerClient.EXPECT().KnownVersions().Return(nil),
@@ -662,6 +670,8 @@ func TestDoStartGPUManagerHappyPath(t *testing.T) {
 		dockerClient.EXPECT().ListContainers(gomock.Any(), gomock.Any(), gomock.Any()).Return(
 			dockerapi.ListContainersResponse{}).AnyTimes(),
 	)
+	// Credentials reconciliation looks up the restored tasks in the background
+	state.EXPECT().AllTasks().Return(nil).AnyTimes()
 
 	cfg := getTestConfig()
 	cfg.GPUSupportEnabled = true
@@ -670,6 +680,7 @@ func TestDoStartGPUManagerHappyPath(t *testing.T) {
 	agent := &ecsAgent{
 		ctx:                ctx,
 		cfg:                &cfg,
+		dataClient:         data.NewNoopClient(),
 		credentialProvider: credentials.NewCredentials(mockCredentialsProvider),
 		dockerClient:       dockerClient,
 		pauseLoader:        mockPauseLoader,
@@ -304,8 +304,8 @@ func (t *termHandlerIndicator) wait() uint32 {
 func (agent *ecsAgent) initializeResourceFields(credentialsManager credentials.Manager) {
 	agent.resourceFields = &taskresource.ResourceFields{
 		ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
-			ASMClientCreator:   asmfactory.NewClientCreator(),
-			SSMClientCreator:   ssmfactory.NewSSMClientCreator(),
+			ASMClientCreator:   asmfactory.NewClientCreator(agent.cfg.EndpointResolver()),
+			SSMClientCreator:   ssmfactory.NewSSMClientCreator(agent.cfg.EndpointResolver()),
 			FSxClientCreator:   fsxfactory.NewFSxClientCreator(),
 			S3ClientCreator:    s3factory.NewS3ClientCreator(),
 			CredentialsManager: credentialsManager,
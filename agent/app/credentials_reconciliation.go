@@ -0,0 +1,91 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// credentialsReconciliationRetryAfter is how long clients are told to wait before
+	// retrying credentials requests made before reconciliation is complete
+	credentialsReconciliationRetryAfter = 5 * time.Second
+	// credentialsReconciliationPollInterval is how often the credentials of the restored
+	// tasks are checked for
+	credentialsReconciliationPollInterval = time.Second
+	// credentialsReconciliationTimeout bounds how long credential serving is held back,
+	// so that a task whose credentials never come back doesn't block the other tasks
+	credentialsReconciliationTimeout = 2 * time.Minute
+)
+
+// waitForCredentialsReconciliation marks the gate reconciled once the credentials of
+// all the tasks restored from the saved state are back in the credentials manager,
+// which happens as ACS resends them after the agent restarts. The gate is marked
+// reconciled after the timeout regardless, or straight away if no task needs them.
+func waitForCredentialsReconciliation(
+	ctx context.Context,
+	state dockerstate.TaskEngineState,
+	credentialsManager credentials.Manager,
+	gate *tmdsv1.ReconciliationGate,
+	pollInterval time.Duration,
+	timeout time.Duration,
+) {
+	defer gate.MarkReconciled()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		missing := missingTaskCredentials(state, credentialsManager)
+		if missing == 0 {
+			return
+		}
+		seelog.Debugf("Waiting for credentials of %d restored tasks before serving credentials", missing)
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			seelog.Warnf("Timed out waiting for credentials of %d restored tasks, serving credentials", missing)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// missingTaskCredentials returns the number of credentials IDs of the tasks that are not
+// stopped and have no credentials in the credentials manager.
+func missingTaskCredentials(state dockerstate.TaskEngineState, credentialsManager credentials.Manager) int {
+	missing := 0
+	for _, task := range state.AllTasks() {
+		if task.GetDesiredStatus().Terminal() || task.GetKnownStatus().Terminal() {
+			continue
+		}
+		for _, credentialsID := range []string{task.GetCredentialsID(), task.GetExecutionCredentialsID()} {
+			if credentialsID == "" {
+				continue
+			}
+			if _, ok := credentialsManager.GetTaskCredentials(credentialsID); !ok {
+				missing++
+			}
+		}
+	}
+	return missing
+}
@@ -0,0 +1,97 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReconciliationTestState() dockerstate.TaskEngineState {
+	state := dockerstate.NewTaskEngineState()
+	runningTask := &apitask.Task{
+		Arn:                 "runningTask",
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+	}
+	runningTask.SetCredentialsID("taskCredentials")
+	runningTask.SetExecutionRoleCredentialsID("executionCredentials")
+	state.AddTask(runningTask)
+
+	// Stopped tasks don't get their credentials back
+	stoppedTask := &apitask.Task{
+		Arn:                 "stoppedTask",
+		DesiredStatusUnsafe: apitaskstatus.TaskStopped,
+	}
+	stoppedTask.SetCredentialsID("stoppedTaskCredentials")
+	state.AddTask(stoppedTask)
+	return state
+}
+
+func TestWaitForCredentialsReconciliation(t *testing.T) {
+	state := newReconciliationTestState()
+	credentialsManager := credentials.NewManager()
+	gate := tmdsv1.NewReconciliationGate(time.Second)
+
+	done := make(chan struct{})
+	go func() {
+		waitForCredentialsReconciliation(context.Background(), state, credentialsManager, gate,
+			10*time.Millisecond, time.Minute)
+		close(done)
+	}()
+
+	require.NoError(t, credentialsManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN:                "runningTask",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: "taskCredentials"},
+	}))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, gate.Reconciled(), "execution role credentials are still missing")
+
+	require.NoError(t, credentialsManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN:                "runningTask",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: "executionCredentials"},
+	}))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconciliation did not complete once the credentials were back")
+	}
+	assert.True(t, gate.Reconciled())
+}
+
+func TestWaitForCredentialsReconciliationTimeout(t *testing.T) {
+	gate := tmdsv1.NewReconciliationGate(time.Second)
+	waitForCredentialsReconciliation(context.Background(), newReconciliationTestState(),
+		credentials.NewManager(), gate, 10*time.Millisecond, 50*time.Millisecond)
+	assert.True(t, gate.Reconciled())
+}
+
+func TestWaitForCredentialsReconciliationNoTasks(t *testing.T) {
+	gate := tmdsv1.NewReconciliationGate(time.Second)
+	waitForCredentialsReconciliation(context.Background(), dockerstate.NewTaskEngineState(),
+		credentials.NewManager(), gate, time.Minute, time.Minute)
+	assert.True(t, gate.Reconciled())
+}
@@ -37,5 +37,11 @@ func runHealthcheck(url string, timeout time.Duration) int {
 		return exitcodes.ExitError
 	}
 	resp.Body.Close()
+	// Other non-200 status codes still pass the healthcheck, but the agent reports
+	// itself unavailable when it cannot reach docker
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		seelog.Errorf("health check [HEAD %s] failed with status: %s", url, resp.Status)
+		return exitcodes.ExitError
+	}
 	return exitcodes.ExitSuccess
 }
@@ -80,6 +80,16 @@ func TestHealthcheck_404(t *testing.T) {
 	require.Equal(t, 0, rc)
 }
 
+func TestHealthcheck_503(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	rc := runHealthcheck(ts.URL, time.Second*2)
+	require.Equal(t, 1, rc)
+}
+
 var brc int
 
 func BenchmarkHealthcheck(b *testing.B) {
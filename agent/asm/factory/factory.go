@@ -16,6 +16,7 @@ package factory
 import (
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
 	"github.com/aws/amazon-ecs-agent/agent/httpclient"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 	"github.com/aws/aws-sdk-go/aws"
@@ -23,6 +24,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/cihub/seelog"
 )
 
 const (
@@ -33,13 +35,17 @@ type ClientCreator interface {
 	NewASMClient(region string, creds credentials.IAMRoleCredentials) secretsmanageriface.SecretsManagerAPI
 }
 
-func NewClientCreator() ClientCreator {
-	return &asmClientCreator{}
+// NewClientCreator returns a creator of clients that are pointed at the endpoints resolved
+// by the endpoint resolver
+func NewClientCreator(endpoints *awsendpoints.Resolver) ClientCreator {
+	return &asmClientCreator{endpoints: endpoints}
 }
 
-type asmClientCreator struct{}
+type asmClientCreator struct {
+	endpoints *awsendpoints.Resolver
+}
 
-func (*asmClientCreator) NewASMClient(region string,
+func (creator *asmClientCreator) NewASMClient(region string,
 	creds credentials.IAMRoleCredentials) secretsmanageriface.SecretsManagerAPI {
 	cfg := aws.NewConfig().
 		WithHTTPClient(httpclient.New(roundtripTimeout, false)).
@@ -47,6 +53,10 @@ func (*asmClientCreator) NewASMClient(region string,
 		WithCredentials(
 			awscreds.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey,
 				creds.SessionToken))
+	if err := creator.endpoints.Configure(cfg, awsendpoints.SecretsManager, region); err != nil {
+		seelog.Errorf("Unable to resolve the Secrets Manager endpoint in region %s, using the default endpoint: %v",
+			region, err)
+	}
 	sess := session.Must(session.NewSession(cfg))
 	return secretsmanager.New(sess)
 }
@@ -0,0 +1,211 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package awsendpoints resolves the endpoints that the AWS SDK clients of the agent are
+// pointed at, so that the agent can be run in FIPS-mandated and IPv6 environments, and
+// behind interface VPC endpoints.
+package awsendpoints
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// Mode is how the endpoints of services are resolved when they aren't overridden.
+type Mode string
+
+const (
+	// ModeStandard resolves the default endpoints of the AWS SDK.
+	ModeStandard Mode = "standard"
+	// ModeFIPS resolves the FIPS 140-2 validated endpoints of the services.
+	ModeFIPS Mode = "fips"
+	// ModeDualStack resolves the endpoints of the services that are reachable over both
+	// IPv4 and IPv6.
+	ModeDualStack Mode = "dualstack"
+)
+
+// Service names, which are the keys of the endpoint overrides.
+const (
+	ECS            = "ecs"
+	ECR            = "ecr"
+	SSM            = "ssm"
+	SecretsManager = "secretsmanager"
+)
+
+// service describes how the endpoints of a service are resolved in each mode.
+type service struct {
+	// endpointsID is the id of the service in the endpoints model of the AWS SDK
+	endpointsID string
+	// fipsPrefix and dualStackPrefix are the prefixes of the hostnames of the FIPS and
+	// dual-stack endpoints, which are followed by the region and the DNS suffix
+	fipsPrefix      string
+	dualStackPrefix string
+}
+
+var services = map[string]service{
+	ECS:            {endpointsID: "ecs", fipsPrefix: "ecs-fips", dualStackPrefix: "ecs"},
+	ECR:            {endpointsID: "api.ecr", fipsPrefix: "ecr-fips", dualStackPrefix: "ecr"},
+	SSM:            {endpointsID: "ssm", fipsPrefix: "ssm-fips", dualStackPrefix: "ssm"},
+	SecretsManager: {endpointsID: "secretsmanager", fipsPrefix: "secretsmanager-fips", dualStackPrefix: "secretsmanager"},
+}
+
+// Services returns the names of the services whose endpoints are resolved, in order.
+func Services() []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolver resolves the endpoints of services. A nil Resolver resolves the default
+// endpoints of the AWS SDK.
+type Resolver struct {
+	mode      Mode
+	overrides map[string]string
+}
+
+// NewResolver creates a Resolver of the endpoints of services in the mode, unless they're
+// overridden. The mode defaults to ModeStandard if it's empty. An error is returned if the
+// mode is unknown, or if an override is for an unknown service or isn't an absolute http
+// or https URL.
+func NewResolver(mode string, overrides map[string]string) (*Resolver, error) {
+	resolver := &Resolver{mode: Mode(strings.ToLower(mode)), overrides: make(map[string]string)}
+	switch resolver.mode {
+	case "":
+		resolver.mode = ModeStandard
+	case ModeStandard, ModeFIPS, ModeDualStack:
+	default:
+		return nil, fmt.Errorf("unknown endpoint mode %q, expected one of %s, %s or %s",
+			mode, ModeStandard, ModeFIPS, ModeDualStack)
+	}
+	for name, override := range overrides {
+		if _, ok := services[name]; !ok {
+			return nil, fmt.Errorf("endpoint override for unknown service %q, expected one of %s",
+				name, strings.Join(Services(), ", "))
+		}
+		parsed, err := url.Parse(override)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint override for service %s: %w", name, err)
+		}
+		if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint override for service %s: %q is not an http or https URL",
+				name, override)
+		}
+		resolver.overrides[name] = override
+	}
+	return resolver, nil
+}
+
+// Mode returns the mode that endpoints are resolved in.
+func (r *Resolver) Mode() Mode {
+	if r == nil {
+		return ModeStandard
+	}
+	return r.mode
+}
+
+// Overridden returns true if the endpoint of the service is overridden.
+func (r *Resolver) Overridden(name string) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.overrides[name]
+	return ok
+}
+
+// Resolve returns the URL of the endpoint of the service in the region.
+func (r *Resolver) Resolve(name, region string) (string, error) {
+	svc, ok := services[name]
+	if !ok {
+		return "", fmt.Errorf("unknown service %q", name)
+	}
+	if r != nil {
+		if override, ok := r.overrides[name]; ok {
+			return override, nil
+		}
+	}
+	partition := partitionForRegion(region)
+	switch r.Mode() {
+	case ModeFIPS:
+		if partition.ID() != endpoints.AwsPartitionID && partition.ID() != endpoints.AwsUsGovPartitionID {
+			return "", fmt.Errorf("FIPS endpoints are not available in partition %s of region %s",
+				partition.ID(), region)
+		}
+		return fmt.Sprintf("https://%s.%s.%s", svc.fipsPrefix, region, partition.DNSSuffix()), nil
+	case ModeDualStack:
+		return fmt.Sprintf("https://%s.%s.%s", svc.dualStackPrefix, region, dualStackDNSSuffix(partition)), nil
+	}
+	resolved, err := partition.EndpointFor(svc.endpointsID, region, endpoints.ResolveUnknownServiceOption)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve the endpoint of service %s in region %s: %w", name, region, err)
+	}
+	return resolved.URL, nil
+}
+
+// ResolveAll returns the URLs of the endpoints of all the services in the region, or the
+// resolution error of each service whose endpoint can't be resolved.
+func (r *Resolver) ResolveAll(region string) map[string]string {
+	resolved := make(map[string]string, len(services))
+	for name := range services {
+		endpoint, err := r.Resolve(name, region)
+		if err != nil {
+			endpoint = "error: " + err.Error()
+		}
+		resolved[name] = endpoint
+	}
+	return resolved
+}
+
+// Configure points the config of a client of the service at the endpoint of the service
+// in the region. The config is left to resolve the default endpoint of the AWS SDK if the
+// endpoint isn't overridden and the mode is ModeStandard.
+func (r *Resolver) Configure(cfg *aws.Config, name, region string) error {
+	if !r.Overridden(name) && r.Mode() == ModeStandard {
+		return nil
+	}
+	endpoint, err := r.Resolve(name, region)
+	if err != nil {
+		return err
+	}
+	cfg.Endpoint = aws.String(endpoint)
+	return nil
+}
+
+// partitionForRegion returns the partition of the region. Regions that the endpoints
+// model of the AWS SDK doesn't know about are matched by their prefix.
+func partitionForRegion(region string) endpoints.Partition {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return partition
+	}
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return endpoints.AwsCnPartition()
+	case strings.HasPrefix(region, "us-gov-"):
+		return endpoints.AwsUsGovPartition()
+	}
+	return endpoints.AwsPartition()
+}
+
+func dualStackDNSSuffix(partition endpoints.Partition) string {
+	if partition.ID() == endpoints.AwsCnPartitionID {
+		return "api.amazonwebservices.com.cn"
+	}
+	return "api.aws"
+}
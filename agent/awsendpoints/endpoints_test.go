@@ -0,0 +1,160 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsendpoints
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePerModeAndService(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		region   string
+		expected map[string]string
+	}{
+		{
+			mode:   "",
+			region: "us-west-2",
+			expected: map[string]string{
+				ECS:            "https://ecs.us-west-2.amazonaws.com",
+				ECR:            "https://api.ecr.us-west-2.amazonaws.com",
+				SSM:            "https://ssm.us-west-2.amazonaws.com",
+				SecretsManager: "https://secretsmanager.us-west-2.amazonaws.com",
+			},
+		},
+		{
+			mode:   "standard",
+			region: "cn-north-1",
+			expected: map[string]string{
+				ECS:            "https://ecs.cn-north-1.amazonaws.com.cn",
+				ECR:            "https://api.ecr.cn-north-1.amazonaws.com.cn",
+				SSM:            "https://ssm.cn-north-1.amazonaws.com.cn",
+				SecretsManager: "https://secretsmanager.cn-north-1.amazonaws.com.cn",
+			},
+		},
+		{
+			mode:   "FIPS",
+			region: "us-gov-west-1",
+			expected: map[string]string{
+				ECS:            "https://ecs-fips.us-gov-west-1.amazonaws.com",
+				ECR:            "https://ecr-fips.us-gov-west-1.amazonaws.com",
+				SSM:            "https://ssm-fips.us-gov-west-1.amazonaws.com",
+				SecretsManager: "https://secretsmanager-fips.us-gov-west-1.amazonaws.com",
+			},
+		},
+		{
+			mode:   "dualstack",
+			region: "us-east-1",
+			expected: map[string]string{
+				ECS:            "https://ecs.us-east-1.api.aws",
+				ECR:            "https://ecr.us-east-1.api.aws",
+				SSM:            "https://ssm.us-east-1.api.aws",
+				SecretsManager: "https://secretsmanager.us-east-1.api.aws",
+			},
+		},
+		{
+			mode:   "dualstack",
+			region: "cn-northwest-1",
+			expected: map[string]string{
+				ECS:            "https://ecs.cn-northwest-1.api.amazonwebservices.com.cn",
+				ECR:            "https://ecr.cn-northwest-1.api.amazonwebservices.com.cn",
+				SSM:            "https://ssm.cn-northwest-1.api.amazonwebservices.com.cn",
+				SecretsManager: "https://secretsmanager.cn-northwest-1.api.amazonwebservices.com.cn",
+			},
+		},
+	} {
+		t.Run(tc.mode+" "+tc.region, func(t *testing.T) {
+			resolver, err := NewResolver(tc.mode, nil)
+			require.NoError(t, err)
+			for name, expected := range tc.expected {
+				endpoint, err := resolver.Resolve(name, tc.region)
+				require.NoError(t, err, name)
+				assert.Equal(t, expected, endpoint, name)
+			}
+			assert.Equal(t, tc.expected, resolver.ResolveAll(tc.region))
+		})
+	}
+}
+
+func TestResolveFIPSUnavailable(t *testing.T) {
+	resolver, err := NewResolver("fips", nil)
+	require.NoError(t, err)
+	_, err = resolver.Resolve(ECS, "cn-north-1")
+	assert.Error(t, err)
+	assert.Contains(t, resolver.ResolveAll("cn-north-1")[ECS], "error: ")
+}
+
+func TestResolveOverrides(t *testing.T) {
+	resolver, err := NewResolver("fips", map[string]string{
+		ECR: "https://vpce-0123-ecr.api.ecr.us-west-2.vpce.amazonaws.com",
+	})
+	require.NoError(t, err)
+	endpoint, err := resolver.Resolve(ECR, "us-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://vpce-0123-ecr.api.ecr.us-west-2.vpce.amazonaws.com", endpoint)
+	// Services that aren't overridden are resolved in the mode
+	endpoint, err = resolver.Resolve(SSM, "us-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ssm-fips.us-west-2.amazonaws.com", endpoint)
+}
+
+func TestNewResolverValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		mode      string
+		overrides map[string]string
+	}{
+		{name: "unknown mode", mode: "ipv6"},
+		{name: "unknown service", overrides: map[string]string{"s3": "https://s3.example.com"}},
+		{name: "relative URL", overrides: map[string]string{ECS: "ecs.example.com"}},
+		{name: "unsupported scheme", overrides: map[string]string{SSM: "ftp://ssm.example.com"}},
+		{name: "malformed URL", overrides: map[string]string{SecretsManager: "https://%zz"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewResolver(tc.mode, tc.overrides)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	// The default endpoints of the AWS SDK are left to be resolved by the SDK
+	var nilResolver *Resolver
+	cfg := aws.NewConfig()
+	require.NoError(t, nilResolver.Configure(cfg, ECS, "us-west-2"))
+	assert.Nil(t, cfg.Endpoint)
+	standard, err := NewResolver("standard", nil)
+	require.NoError(t, err)
+	require.NoError(t, standard.Configure(cfg, ECS, "us-west-2"))
+	assert.Nil(t, cfg.Endpoint)
+
+	fips, err := NewResolver("fips", nil)
+	require.NoError(t, err)
+	require.NoError(t, fips.Configure(cfg, SecretsManager, "us-east-1"))
+	assert.Equal(t, "https://secretsmanager-fips.us-east-1.amazonaws.com", aws.StringValue(cfg.Endpoint))
+	assert.Error(t, fips.Configure(aws.NewConfig(), SecretsManager, "cn-north-1"))
+
+	overridden, err := NewResolver("", map[string]string{ECS: "https://ecs.example.com"})
+	require.NoError(t, err)
+	cfg = aws.NewConfig()
+	require.NoError(t, overridden.Configure(cfg, ECS, "us-west-2"))
+	assert.Equal(t, "https://ecs.example.com", aws.StringValue(cfg.Endpoint))
+}
@@ -14,6 +14,8 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,10 +25,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/ec2"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/amazon-ecs-agent/agent/utils/envscrub"
 	apierrors "github.com/aws/amazon-ecs-agent/ecs-agent/api/errors"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
 	commonutils "github.com/aws/amazon-ecs-agent/ecs-agent/utils"
 	"github.com/cihub/seelog"
 )
@@ -62,6 +67,10 @@ const (
 	// This is only used when PollMetrics is set to true
 	DefaultPollingMetricsWaitDuration = DefaultContainerMetricsPublishInterval / 2
 
+	// DefaultContainerStatsStalenessThreshold specifies the default age beyond which the
+	// latest stats of a container are not served
+	DefaultContainerStatsStalenessThreshold = 3 * DefaultContainerMetricsPublishInterval
+
 	// defaultDockerStopTimeout specifies the value for container stop timeout duration
 	defaultDockerStopTimeout = 30 * time.Second
 
@@ -73,6 +82,41 @@ const (
 	// image cleanup.
 	DefaultNumImagesToDeletePerCycle = 5
 
+	// DefaultDockerCircuitBreakerThreshold specifies the default number of consecutive
+	// connection failures to the docker daemon after which calls to it are short-circuited.
+	DefaultDockerCircuitBreakerThreshold = 5
+
+	// DefaultDockerCircuitBreakerCoolDown specifies the default amount of time for which
+	// calls to the docker daemon are short-circuited once the circuit breaker opens.
+	DefaultDockerCircuitBreakerCoolDown = 30 * time.Second
+
+	// DefaultClockDriftThreshold specifies the default estimated host clock skew above
+	// which a warning is logged. Requests signed with a clock that is off by more than
+	// 5 minutes are rejected, so this leaves time to act on the warning.
+	DefaultClockDriftThreshold = time.Minute
+
+	// DefaultClockDriftCheckInterval specifies the default minimum amount of time between
+	// two checks of the host clock skew.
+	DefaultClockDriftCheckInterval = 5 * time.Minute
+
+	// DefaultDrainStopLastTimeout specifies the default amount of time that the stops of
+	// tasks of the stop-last families are held back for once the instance is drained. It
+	// leaves time to stop the tasks within the two minute spot interruption notice.
+	DefaultDrainStopLastTimeout = 90 * time.Second
+
+	// DefaultStateReconcileConcurrency specifies the default number of containers restored
+	// from the saved state that are reconciled with docker at the same time when the agent
+	// starts.
+	DefaultStateReconcileConcurrency = 10
+
+	// DefaultImagePrefetchConcurrency specifies the default number of images of the prefetch
+	// list that are pulled at the same time.
+	DefaultImagePrefetchConcurrency = 2
+
+	// DefaultImagePrefetchRetention specifies the default amount of time that prefetched images
+	// are kept from cleanup after they were last used.
+	DefaultImagePrefetchRetention = 24 * time.Hour
+
 	// DefaultNumNonECSContainersToDeletePerCycle specifies the default number of nonecs containers to delete when agent performs
 	// nonecs containers cleanup.
 	DefaultNumNonECSContainersToDeletePerCycle = 5
@@ -135,6 +179,51 @@ const (
 	//Known cached image names
 	CachedImageNameAgentContainer = "amazon/amazon-ecs-agent:latest"
 
+	// DefaultAWSLogsMaxBufferSize is the max-buffer-size set for awslogs log configurations
+	// that are switched to non-blocking mode by the agent. This matches the docker default.
+	DefaultAWSLogsMaxBufferSize = "1m"
+
+	// DefaultLocalEndpointSlowRequestThreshold is the duration above which requests to the
+	// task metadata and introspection endpoints are logged as slow.
+	DefaultLocalEndpointSlowRequestThreshold = time.Second
+
+	// DefaultTaskEventsHeartbeatInterval is how often heartbeats are sent to the clients of
+	// the events endpoint of the introspection server.
+	DefaultTaskEventsHeartbeatInterval = 15 * time.Second
+
+	// DefaultGPURuntimeProbeInterval is how often the GPU runtime of the host is probed to
+	// check that GPU tasks can run on it.
+	DefaultGPURuntimeProbeInterval = 5 * time.Minute
+
+	// DefaultLocalEndpointReadHeaderTimeout is the maximum duration for reading the headers
+	// of requests to the task metadata and introspection endpoints.
+	DefaultLocalEndpointReadHeaderTimeout = 3 * time.Second
+
+	// MaxLocalEndpointResponseJitter is the maximum random delay of responses of the task
+	// metadata endpoint.
+	MaxLocalEndpointResponseJitter = time.Second
+
+	// DefaultTaskMetadataTagsCacheTTL is how long the task and container instance tags
+	// retrieved from ECS for the task metadata endpoint are served before they are
+	// retrieved again.
+	DefaultTaskMetadataTagsCacheTTL = 5 * time.Minute
+
+	// DefaultLocalEndpointMaxHeaderBytes is the maximum size of the headers of requests to
+	// the task metadata and introspection endpoints.
+	DefaultLocalEndpointMaxHeaderBytes = 16 << 10
+
+	// DefaultLocalEndpointMaxRequestBodyBytes is the maximum size of the bodies of requests
+	// to the task metadata endpoint.
+	DefaultLocalEndpointMaxRequestBodyBytes = 64 << 10
+
+	// DefaultContainerOutputCaptureMaxFileBytes is the size at which the files that the
+	// output of containers is captured to are rotated.
+	DefaultContainerOutputCaptureMaxFileBytes = 10 << 20
+
+	// DefaultCredentialsMaxEntries is the maximum number of credentials held by the agent.
+	// It is far above the number of credentials of the tasks an instance can run.
+	DefaultCredentialsMaxEntries = 50000
+
 	// DefaultNvidiaRuntime is the name of the runtime to pass Nvidia GPUs to containers
 	DefaultNvidiaRuntime = "nvidia"
 
@@ -333,6 +422,27 @@ func (cfg *Config) validateAndOverrideBounds() error {
 		return errors.New("Invalid logging drivers: " + strings.Join(badDrivers, ", "))
 	}
 
+	if _, err := envscrub.New(cfg.StateEnvironmentScrubPatterns); err != nil {
+		return fmt.Errorf("config: invalid value for ECS_STATE_ENV_SCRUB_PATTERNS: %w", err)
+	}
+
+	if _, err := cfg.SuspiciousHeaderHeuristics(); err != nil {
+		return fmt.Errorf("config: invalid value for ECS_CREDENTIALS_SUSPICIOUS_HEADER_HEURISTICS: %w", err)
+	}
+
+	// The agent doesn't start with endpoints that its AWS SDK clients can't be pointed at
+	if err := cfg.validateEndpoints(); err != nil {
+		return err
+	}
+
+	// The agent doesn't start with a signing key that credentials responses can't be
+	// signed with, rather than serve them without the signatures that clients expect
+	if cfg.CredentialsSigningKeyFile != "" {
+		if _, err := ReadCredentialsSigningKey(cfg.CredentialsSigningKeyFile); err != nil {
+			return fmt.Errorf("config: invalid value for ECS_CREDENTIALS_SIGNING_KEY_FILE: %w", err)
+		}
+	}
+
 	// If a value has been set for taskCleanupWaitDuration and the value is less than the minimum allowed cleanup duration,
 	// print a warning and override it
 	if cfg.TaskCleanupWaitDuration < minimumTaskCleanupWaitDuration {
@@ -345,6 +455,109 @@ func (cfg *Config) validateAndOverrideBounds() error {
 		cfg.ImagePullInactivityTimeout = defaultImagePullInactivityTimeout
 	}
 
+	if cfg.DockerCircuitBreakerCoolDown <= 0 {
+		seelog.Warnf("Invalid value for ECS_DOCKER_CIRCUIT_BREAKER_COOLDOWN, will be overridden with the default value: %s. Parsed value: %v.", DefaultDockerCircuitBreakerCoolDown.String(), cfg.DockerCircuitBreakerCoolDown)
+		cfg.DockerCircuitBreakerCoolDown = DefaultDockerCircuitBreakerCoolDown
+	}
+
+	if cfg.ClockDriftThreshold <= 0 {
+		seelog.Warnf("Invalid value for ECS_CLOCK_DRIFT_THRESHOLD, will be overridden with the default value: %s. Parsed value: %v.", DefaultClockDriftThreshold.String(), cfg.ClockDriftThreshold)
+		cfg.ClockDriftThreshold = DefaultClockDriftThreshold
+	}
+
+	if cfg.ClockDriftCheckInterval <= 0 {
+		seelog.Warnf("Invalid value for ECS_CLOCK_DRIFT_CHECK_INTERVAL, will be overridden with the default value: %s. Parsed value: %v.", DefaultClockDriftCheckInterval.String(), cfg.ClockDriftCheckInterval)
+		cfg.ClockDriftCheckInterval = DefaultClockDriftCheckInterval
+	}
+
+	if cfg.DrainStopLastTimeout <= 0 {
+		seelog.Warnf("Invalid value for ECS_DRAIN_STOP_LAST_TIMEOUT, will be overridden with the default value: %s. Parsed value: %v.", DefaultDrainStopLastTimeout.String(), cfg.DrainStopLastTimeout)
+		cfg.DrainStopLastTimeout = DefaultDrainStopLastTimeout
+	}
+
+	if cfg.StateReconcileConcurrency < 1 {
+		seelog.Warnf("Invalid value for ECS_STATE_RECONCILE_CONCURRENCY, will be overridden with the default value: %d. Parsed value: %d, minimum value: 1.", DefaultStateReconcileConcurrency, cfg.StateReconcileConcurrency)
+		cfg.StateReconcileConcurrency = DefaultStateReconcileConcurrency
+	}
+
+	if cfg.LocalEndpointReadHeaderTimeout <= 0 {
+		seelog.Warnf("Invalid value for ECS_LOCAL_ENDPOINT_READ_HEADER_TIMEOUT, will be overridden with the default value: %s. Parsed value: %v.", DefaultLocalEndpointReadHeaderTimeout.String(), cfg.LocalEndpointReadHeaderTimeout)
+		cfg.LocalEndpointReadHeaderTimeout = DefaultLocalEndpointReadHeaderTimeout
+	}
+
+	if cfg.LocalEndpointResponseJitter < 0 {
+		seelog.Warnf("Invalid value for ECS_LOCAL_ENDPOINT_RESPONSE_JITTER, will be overridden with 0s, which disables response jitter. Parsed value: %v.", cfg.LocalEndpointResponseJitter)
+		cfg.LocalEndpointResponseJitter = 0
+	} else if cfg.LocalEndpointResponseJitter > MaxLocalEndpointResponseJitter {
+		seelog.Warnf("Invalid value for ECS_LOCAL_ENDPOINT_RESPONSE_JITTER, will be overridden with the maximum value: %s. Parsed value: %v.", MaxLocalEndpointResponseJitter.String(), cfg.LocalEndpointResponseJitter)
+		cfg.LocalEndpointResponseJitter = MaxLocalEndpointResponseJitter
+	}
+
+	if cfg.CredentialsNotFoundRetryAfter < 0 {
+		seelog.Warnf("Invalid value for ECS_CREDENTIALS_NOT_FOUND_RETRY_AFTER, will be overridden with 0s, which omits the Retry-After header. Parsed value: %v.", cfg.CredentialsNotFoundRetryAfter)
+		cfg.CredentialsNotFoundRetryAfter = 0
+	}
+
+	if cfg.CredentialsPreExpiryRefreshMargin < 0 {
+		seelog.Warnf("Invalid value for ECS_CREDENTIALS_PRE_EXPIRY_REFRESH_MARGIN, will be overridden with 0s, which disables the refresh of cached credentials. Parsed value: %v.", cfg.CredentialsPreExpiryRefreshMargin)
+		cfg.CredentialsPreExpiryRefreshMargin = 0
+	}
+
+	if cfg.CredentialsRefreshAfterMargin < 0 {
+		seelog.Warnf("Invalid value for ECS_CREDENTIALS_REFRESH_AFTER_MARGIN, will be overridden with 0s, which uses the default margin. Parsed value: %v.", cfg.CredentialsRefreshAfterMargin)
+		cfg.CredentialsRefreshAfterMargin = 0
+	}
+
+	if cfg.CredentialsAuditLogDedupWindow < 0 {
+		seelog.Warnf("Invalid value for ECS_AUDIT_LOG_DEDUP_WINDOW, will be overridden with 0s, which disables the deduplication of audit log entries. Parsed value: %v.", cfg.CredentialsAuditLogDedupWindow)
+		cfg.CredentialsAuditLogDedupWindow = 0
+	}
+
+	if cfg.CredentialsAuditDigestWindow < 0 {
+		seelog.Warnf("Invalid value for ECS_CREDENTIALS_AUDIT_DIGEST_WINDOW, will be overridden with 0s, which disables the credentials audit digest. Parsed value: %v.", cfg.CredentialsAuditDigestWindow)
+		cfg.CredentialsAuditDigestWindow = 0
+	}
+
+	if cfg.TaskEventsHeartbeatInterval <= 0 {
+		seelog.Warnf("Invalid value for ECS_INTROSPECTION_EVENTS_HEARTBEAT_INTERVAL, will be overridden with the default value: %s. Parsed value: %v.", DefaultTaskEventsHeartbeatInterval.String(), cfg.TaskEventsHeartbeatInterval)
+		cfg.TaskEventsHeartbeatInterval = DefaultTaskEventsHeartbeatInterval
+	}
+
+	if cfg.GPUSupportEnabled && cfg.GPURuntimeProbeInterval <= 0 {
+		seelog.Warnf("Invalid value for ECS_GPU_RUNTIME_PROBE_INTERVAL, will be overridden with the default value: %s. Parsed value: %v.", DefaultGPURuntimeProbeInterval.String(), cfg.GPURuntimeProbeInterval)
+		cfg.GPURuntimeProbeInterval = DefaultGPURuntimeProbeInterval
+	}
+
+	if cfg.TaskMetadataTagsCacheTTL <= 0 {
+		seelog.Warnf("Invalid value for ECS_TASK_METADATA_TAGS_CACHE_TTL, will be overridden with the default value: %s. Parsed value: %v.", DefaultTaskMetadataTagsCacheTTL.String(), cfg.TaskMetadataTagsCacheTTL)
+		cfg.TaskMetadataTagsCacheTTL = DefaultTaskMetadataTagsCacheTTL
+	}
+
+	if cfg.LocalEndpointMaxHeaderBytes <= 0 {
+		seelog.Warnf("Invalid value for ECS_LOCAL_ENDPOINT_MAX_HEADER_BYTES, will be overridden with the default value: %d. Parsed value: %d.", DefaultLocalEndpointMaxHeaderBytes, cfg.LocalEndpointMaxHeaderBytes)
+		cfg.LocalEndpointMaxHeaderBytes = DefaultLocalEndpointMaxHeaderBytes
+	}
+
+	if cfg.LocalEndpointMaxRequestBodyBytes <= 0 {
+		seelog.Warnf("Invalid value for ECS_LOCAL_ENDPOINT_MAX_REQUEST_BODY_BYTES, will be overridden with the default value: %d. Parsed value: %d.", DefaultLocalEndpointMaxRequestBodyBytes, cfg.LocalEndpointMaxRequestBodyBytes)
+		cfg.LocalEndpointMaxRequestBodyBytes = DefaultLocalEndpointMaxRequestBodyBytes
+	}
+
+	if cfg.ContainerOutputCaptureMaxFileBytes <= 0 {
+		seelog.Warnf("Invalid value for ECS_CONTAINER_OUTPUT_CAPTURE_MAX_FILE_BYTES, will be overridden with the default value: %d. Parsed value: %d.", DefaultContainerOutputCaptureMaxFileBytes, cfg.ContainerOutputCaptureMaxFileBytes)
+		cfg.ContainerOutputCaptureMaxFileBytes = DefaultContainerOutputCaptureMaxFileBytes
+	}
+
+	if cfg.ImagePrefetchConcurrency < 1 {
+		seelog.Warnf("Invalid value for ECS_IMAGE_PREFETCH_CONCURRENCY, will be overridden with the default value: %d. Parsed value: %d, minimum value: 1.", DefaultImagePrefetchConcurrency, cfg.ImagePrefetchConcurrency)
+		cfg.ImagePrefetchConcurrency = DefaultImagePrefetchConcurrency
+	}
+
+	if cfg.ImagePrefetchRetention <= 0 {
+		seelog.Warnf("Invalid value for ECS_IMAGE_PREFETCH_RETENTION, will be overridden with the default value: %s. Parsed value: %v.", DefaultImagePrefetchRetention.String(), cfg.ImagePrefetchRetention)
+		cfg.ImagePrefetchRetention = DefaultImagePrefetchRetention
+	}
+
 	if cfg.ImageCleanupInterval < minimumImageCleanupInterval {
 		seelog.Warnf("Invalid value for ECS_IMAGE_CLEANUP_INTERVAL, will be overridden with the default value: %s. Parsed value: %v, minimum value: %v.", DefaultImageCleanupTimeInterval.String(), cfg.ImageCleanupInterval, minimumImageCleanupInterval)
 		cfg.ImageCleanupInterval = DefaultImageCleanupTimeInterval
@@ -361,6 +574,46 @@ func (cfg *Config) validateAndOverrideBounds() error {
 		cfg.TaskMetadataBurstRate = DefaultTaskMetadataBurstRate
 	}
 
+	if cfg.CredentialsSteadyStateRate < 0 || cfg.CredentialsBurstRate < 0 ||
+		(cfg.CredentialsSteadyStateRate == 0) != (cfg.CredentialsBurstRate == 0) {
+		seelog.Warnf("Invalid values for credentials rate limits, credentials requests will not be rate limited. Parsed values: %d,%d.", cfg.CredentialsSteadyStateRate, cfg.CredentialsBurstRate)
+		cfg.CredentialsSteadyStateRate = 0
+		cfg.CredentialsBurstRate = 0
+	}
+
+	switch strings.ToLower(cfg.TaskMetadataSessionTokenMode) {
+	case "":
+		cfg.TaskMetadataSessionTokenMode = "optional"
+	case "optional", "required":
+		cfg.TaskMetadataSessionTokenMode = strings.ToLower(cfg.TaskMetadataSessionTokenMode)
+	default:
+		seelog.Warnf("Invalid value for ECS_TASK_METADATA_SESSION_TOKENS, will be overridden with the default value: optional. Parsed value: %s.", cfg.TaskMetadataSessionTokenMode)
+		cfg.TaskMetadataSessionTokenMode = "optional"
+	}
+
+	switch cfg.ContainerMetadataFileSchema {
+	case "":
+		cfg.ContainerMetadataFileSchema = "1"
+	case "1", "2":
+	default:
+		seelog.Warnf("Invalid value for ECS_CONTAINER_METADATA_FILE_SCHEMA, will be overridden with the default value: 1. Parsed value: %s.", cfg.ContainerMetadataFileSchema)
+		cfg.ContainerMetadataFileSchema = "1"
+	}
+
+	switch strings.ToLower(cfg.CredentialsRequestLogLevel) {
+	case "", "info", "debug":
+	default:
+		seelog.Warnf("Invalid value for ECS_CREDENTIALS_REQUEST_LOG_LEVEL, will be overridden with the default value: info. Parsed value: %s.", cfg.CredentialsRequestLogLevel)
+		cfg.CredentialsRequestLogLevel = "info"
+	}
+
+	switch strings.ToLower(cfg.CredentialsResponseSchemaValidation) {
+	case "", "off", "log", "enforce":
+	default:
+		seelog.Warnf("Invalid value for ECS_CREDENTIALS_RESPONSE_SCHEMA_VALIDATION, credentials responses will not be validated. Parsed value: %s.", cfg.CredentialsResponseSchemaValidation)
+		cfg.CredentialsResponseSchemaValidation = ""
+	}
+
 	// check the PollMetrics specific configurations
 	cfg.pollMetricsOverrides()
 
@@ -383,6 +636,93 @@ func (cfg *Config) pollMetricsOverrides() {
 			cfg.PollingMetricsWaitDuration = maximumPollingMetricsWaitDuration
 		}
 	}
+
+	if cfg.ContainerStatsStalenessThreshold <= 0 {
+		seelog.Warnf("Invalid value for ECS_CONTAINER_STATS_STALENESS_THRESHOLD, will be overridden with the default value: %s. Parsed value: %s",
+			DefaultContainerStatsStalenessThreshold, cfg.ContainerStatsStalenessThreshold)
+		cfg.ContainerStatsStalenessThreshold = DefaultContainerStatsStalenessThreshold
+	}
+	// Polled stats are at most one polling interval old when they're fresh
+	if cfg.PollMetrics.Enabled() && cfg.ContainerStatsStalenessThreshold < 2*cfg.PollingMetricsWaitDuration {
+		seelog.Warnf("ECS_CONTAINER_STATS_STALENESS_THRESHOLD parsed value (%s) is less than twice the polling interval. Setting it to %s.",
+			cfg.ContainerStatsStalenessThreshold, 2*cfg.PollingMetricsWaitDuration)
+		cfg.ContainerStatsStalenessThreshold = 2 * cfg.PollingMetricsWaitDuration
+	}
+}
+
+// EndpointResolver returns the resolver of the endpoints of the AWS SDK clients of the
+// agent. The endpoint configuration is validated when the config is loaded, so nil, which
+// resolves the default endpoints of the AWS SDK, is only returned for configs that weren't
+// loaded.
+func (cfg *Config) EndpointResolver() *awsendpoints.Resolver {
+	resolver, err := awsendpoints.NewResolver(cfg.AWSEndpointMode, cfg.AWSEndpointOverrides)
+	if err != nil {
+		seelog.Errorf("Invalid endpoint configuration, using the default endpoints: %v", err)
+		return nil
+	}
+	return resolver
+}
+
+// EnvironmentScrubber returns the scrubber of the environment variables of the containers
+// in the saved state of the agent. The patterns are validated when the config is loaded, so
+// nil, which doesn't scrub anything, is only returned for configs that weren't loaded.
+func (cfg *Config) EnvironmentScrubber() *envscrub.Scrubber {
+	scrubber, err := envscrub.New(cfg.StateEnvironmentScrubPatterns)
+	if err != nil {
+		seelog.Errorf("Invalid environment variable scrub patterns, not scrubbing: %v", err)
+		return nil
+	}
+	return scrubber
+}
+
+// SuspiciousHeaderHeuristics returns the heuristics of the suspicious header guard of the
+// credentials handlers, which are all the heuristics unless some are configured.
+func (cfg *Config) SuspiciousHeaderHeuristics() ([]tmdsv1.SuspiciousHeaderHeuristic, error) {
+	if len(cfg.CredentialsHeaderGuardHeuristics) == 0 {
+		return tmdsv1.SuspiciousHeaderHeuristics, nil
+	}
+	var heuristics []tmdsv1.SuspiciousHeaderHeuristic
+	for _, name := range cfg.CredentialsHeaderGuardHeuristics {
+		heuristic, err := tmdsv1.ParseSuspiciousHeaderHeuristic(name)
+		if err != nil {
+			return nil, err
+		}
+		heuristics = append(heuristics, heuristic)
+	}
+	return heuristics, nil
+}
+
+// validateEndpoints checks that the endpoints of all the AWS SDK clients of the agent
+// can be resolved in the region.
+func (cfg *Config) validateEndpoints() error {
+	resolver, err := awsendpoints.NewResolver(cfg.AWSEndpointMode, cfg.AWSEndpointOverrides)
+	if err != nil {
+		return fmt.Errorf("config: invalid endpoint configuration: %w", err)
+	}
+	for _, service := range awsendpoints.Services() {
+		if _, err := resolver.Resolve(service, cfg.AWSRegion); err != nil {
+			return fmt.Errorf("config: invalid endpoint configuration: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadCredentialsSigningKey returns the base64 encoded pre-shared key in the credentials
+// signing key file. Keys must be at least as long as the SHA-256 HMACs they sign with.
+func ReadCredentialsSigningKey(keyFile string) ([]byte, error) {
+	encoded, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the credentials signing key file: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the credentials signing key: %w", err)
+	}
+	if len(key) < sha256.Size {
+		return nil, fmt.Errorf("credentials signing key has %d bytes, at least %d are required",
+			len(key), sha256.Size)
+	}
+	return key, nil
 }
 
 // checkMissingAndDeprecated checks all zero-valued fields for tags of the form
@@ -511,6 +851,7 @@ func environmentConfig() (Config, error) {
 	dataDir := os.Getenv("ECS_DATADIR")
 
 	steadyStateRate, burstRate := parseTaskMetadataThrottles()
+	credentialsSteadyStateRate, credentialsBurstRate := parseCredentialsThrottles()
 
 	var errs []error
 	instanceAttributes, errs := parseInstanceAttributes(errs)
@@ -519,6 +860,8 @@ func environmentConfig() (Config, error) {
 
 	additionalLocalRoutes, errs := parseAdditionalLocalRoutes(errs)
 
+	awsEndpointOverrides, errs := parseAWSEndpointOverrides(errs)
+
 	var err error
 	if len(errs) > 0 {
 		err = apierrors.NewMultiError(errs...)
@@ -526,6 +869,8 @@ func environmentConfig() (Config, error) {
 	return Config{
 		Cluster:                             os.Getenv("ECS_CLUSTER"),
 		APIEndpoint:                         os.Getenv("ECS_BACKEND_HOST"),
+		AWSEndpointMode:                     os.Getenv("ECS_AWS_ENDPOINT_MODE"),
+		AWSEndpointOverrides:                awsEndpointOverrides,
 		AWSRegion:                           os.Getenv("AWS_DEFAULT_REGION"),
 		DockerEndpoint:                      os.Getenv("DOCKER_HOST"),
 		ReservedPorts:                       parseReservedPorts("ECS_RESERVED_PORTS"),
@@ -553,9 +898,22 @@ func environmentConfig() (Config, error) {
 		ContainerCreateTimeout:              parseContainerCreateTimeout(),
 		DependentContainersPullUpfront:      parseBooleanDefaultFalseConfig("ECS_PULL_DEPENDENT_CONTAINERS_UPFRONT"),
 		ImagePullInactivityTimeout:          parseImagePullInactivityTimeout(),
+		ImagePullProgressLogInterval:        parseEnvVariableDuration("ECS_IMAGE_PULL_PROGRESS_LOG_INTERVAL"),
 		ImagePullTimeout:                    parseEnvVariableDuration("ECS_IMAGE_PULL_TIMEOUT"),
+		DockerCircuitBreakerThreshold:       parseDockerCircuitBreakerThreshold(),
+		DockerCircuitBreakerCoolDown:        parseEnvVariableDuration("ECS_DOCKER_CIRCUIT_BREAKER_COOLDOWN"),
+		ClockDriftThreshold:                 parseEnvVariableDuration("ECS_CLOCK_DRIFT_THRESHOLD"),
+		ClockDriftCheckInterval:             parseEnvVariableDuration("ECS_CLOCK_DRIFT_CHECK_INTERVAL"),
+		ClockDriftNTPServer:                 os.Getenv("ECS_CLOCK_DRIFT_NTP_SERVER"),
+		StopLastTaskFamilies:                parseCommaSeparatedList("ECS_STOP_LAST_TASK_FAMILIES"),
+		DrainStopLastTimeout:                parseEnvVariableDuration("ECS_DRAIN_STOP_LAST_TIMEOUT"),
+		StateReconcileConcurrency:           parseStateReconcileConcurrency(),
 		CredentialsAuditLogFile:             os.Getenv("ECS_AUDIT_LOGFILE"),
 		CredentialsAuditLogDisabled:         utils.ParseBool(os.Getenv("ECS_AUDIT_LOGFILE_DISABLED"), false),
+		CredentialsAuditLogSyslog:           os.Getenv("ECS_AUDIT_SYSLOG"),
+		CredentialsAuditLogSyslogFacility:   os.Getenv("ECS_AUDIT_SYSLOG_FACILITY"),
+		CredentialsAuditLogSyslogSeverity:   os.Getenv("ECS_AUDIT_SYSLOG_SEVERITY"),
+		CredentialsAuditLogDedupWindow:      parseEnvVariableDuration("ECS_AUDIT_LOG_DEDUP_WINDOW"),
 		TaskIAMRoleEnabledForNetworkHost:    utils.ParseBool(os.Getenv("ECS_ENABLE_TASK_IAM_ROLE_NETWORK_HOST"), false),
 		ImageCleanupDisabled:                parseBooleanDefaultFalseConfig("ECS_DISABLE_IMAGE_CLEANUP"),
 		MinimumImageDeletionAge:             parseEnvVariableDuration("ECS_IMAGE_MINIMUM_CLEANUP_AGE"),
@@ -565,25 +923,60 @@ func environmentConfig() (Config, error) {
 		NumNonECSContainersToDeletePerCycle: parseNumNonECSContainersToDeletePerCycle(),
 		ImagePullBehavior:                   parseImagePullBehavior(),
 		ImageCleanupExclusionList:           parseImageCleanupExclusionList("ECS_EXCLUDE_UNTRACKED_IMAGE"),
+		ImagePrefetchList:                   parseImagePrefetchList(),
+		ImagePrefetchConcurrency:            parseImagePrefetchConcurrency(),
+		ImagePrefetchRetention:              parseEnvVariableDuration("ECS_IMAGE_PREFETCH_RETENTION"),
 		InstanceAttributes:                  instanceAttributes,
 		CNIPluginsPath:                      os.Getenv("ECS_CNI_PLUGINS_PATH"),
 		AWSVPCBlockInstanceMetdata:          parseBooleanDefaultFalseConfig("ECS_AWSVPC_BLOCK_IMDS"),
 		AWSVPCAdditionalLocalRoutes:         additionalLocalRoutes,
 		ContainerMetadataEnabled:            parseBooleanDefaultFalseConfig("ECS_ENABLE_CONTAINER_METADATA"),
+		ContainerMetadataFileSchema:         os.Getenv("ECS_CONTAINER_METADATA_FILE_SCHEMA"),
+		ContainerOutputCaptureEnabled:       parseBooleanDefaultFalseConfig("ECS_ENABLE_CONTAINER_OUTPUT_CAPTURE"),
+		ContainerOutputCaptureMaxFileBytes:  parseEnvVariableInt64("ECS_CONTAINER_OUTPUT_CAPTURE_MAX_FILE_BYTES"),
 		DataDirOnHost:                       os.Getenv("ECS_HOST_DATA_DIR"),
+		StateEnvironmentScrubPatterns:       parseCommaSeparatedList("ECS_STATE_ENV_SCRUB_PATTERNS"),
 		OverrideAWSLogsExecutionRole:        parseBooleanDefaultFalseConfig("ECS_ENABLE_AWSLOGS_EXECUTIONROLE_OVERRIDE"),
+		AWSLogsNonBlockingDefault:           parseBooleanDefaultFalseConfig("ECS_AWSLOGS_NON_BLOCKING_DEFAULT"),
+		AWSLogsDefaultMaxBufferSize:         os.Getenv("ECS_AWSLOGS_DEFAULT_MAX_BUFFER_SIZE"),
+		LocalEndpointSlowRequestThreshold:   parseEnvVariableDuration("ECS_LOCAL_ENDPOINT_SLOW_REQUEST_THRESHOLD"),
+		LocalEndpointReadHeaderTimeout:      parseEnvVariableDuration("ECS_LOCAL_ENDPOINT_READ_HEADER_TIMEOUT"),
+		LocalEndpointMaxHeaderBytes:         int(parseEnvVariableInt64("ECS_LOCAL_ENDPOINT_MAX_HEADER_BYTES")),
+		LocalEndpointMaxRequestBodyBytes:    parseEnvVariableInt64("ECS_LOCAL_ENDPOINT_MAX_REQUEST_BODY_BYTES"),
+		LocalEndpointLogLevelHeaderEnabled:  parseBooleanDefaultFalseConfig("ECS_LOCAL_ENDPOINT_LOG_LEVEL_HEADER_ENABLED"),
+		LocalEndpointTraceContextEnabled:    parseBooleanDefaultFalseConfig("ECS_LOCAL_ENDPOINT_TRACE_CONTEXT_ENABLED"),
+		LocalEndpointPathNormalization:      parseBooleanDefaultFalseConfig("ECS_LOCAL_ENDPOINT_PATH_NORMALIZATION"),
+		LocalEndpointForwardedPrefixEnabled: parseBooleanDefaultFalseConfig("ECS_LOCAL_ENDPOINT_FORWARDED_PREFIX_ENABLED"),
+		CredentialsAuditDigestWindow:        parseEnvVariableDuration("ECS_CREDENTIALS_AUDIT_DIGEST_WINDOW"),
+		TaskEventsHeartbeatInterval:         parseEnvVariableDuration("ECS_INTROSPECTION_EVENTS_HEARTBEAT_INTERVAL"),
+		LocalEndpointResponseJitter:         parseEnvVariableDuration("ECS_LOCAL_ENDPOINT_RESPONSE_JITTER"),
+		CredentialsNotFoundRetryAfter:       parseEnvVariableDuration("ECS_CREDENTIALS_NOT_FOUND_RETRY_AFTER"),
+		CredentialsPreExpiryRefreshMargin:   parseEnvVariableDuration("ECS_CREDENTIALS_PRE_EXPIRY_REFRESH_MARGIN"),
+		CredentialsExpectedLocalPort:        parseEnvVariableUint16("ECS_CREDENTIALS_EXPECTED_LOCAL_PORT"),
+		CredentialsRefreshAfterMargin:       parseEnvVariableDuration("ECS_CREDENTIALS_REFRESH_AFTER_MARGIN"),
 		CgroupPath:                          os.Getenv("ECS_CGROUP_PATH"),
+		TaskMetadataTagsCacheTTL:            parseEnvVariableDuration("ECS_TASK_METADATA_TAGS_CACHE_TTL"),
 		TaskMetadataSteadyStateRate:         steadyStateRate,
 		TaskMetadataBurstRate:               burstRate,
+		TaskMetadataSessionTokenMode:        os.Getenv("ECS_TASK_METADATA_SESSION_TOKENS"),
+		CredentialsSteadyStateRate:          credentialsSteadyStateRate,
+		CredentialsBurstRate:                credentialsBurstRate,
+		CredentialsAllowedRoleTypes:         parseCommaSeparatedList("ECS_CREDENTIALS_ALLOWED_ROLE_TYPES"),
+		CredentialsRequestLogLevel:          os.Getenv("ECS_CREDENTIALS_REQUEST_LOG_LEVEL"),
+		CredentialsResponseSchemaValidation: os.Getenv("ECS_CREDENTIALS_RESPONSE_SCHEMA_VALIDATION"),
+		CredentialsFaultInjection:           parseCredentialsFaultInjection(),
 		SharedVolumeMatchFullConfig:         parseBooleanDefaultFalseConfig("ECS_SHARED_VOLUME_MATCH_FULL_CONFIG"),
 		ContainerInstanceTags:               containerInstanceTags,
 		ContainerInstancePropagateTagsFrom:  parseContainerInstancePropagateTagsFrom(),
 		PollMetrics:                         parseBooleanDefaultFalseConfig("ECS_POLL_METRICS"),
 		PollingMetricsWaitDuration:          parseEnvVariableDuration("ECS_POLLING_METRICS_WAIT_DURATION"),
+		ContainerStatsStalenessThreshold:    parseEnvVariableDuration("ECS_CONTAINER_STATS_STALENESS_THRESHOLD"),
 		DisableDockerHealthCheck:            parseBooleanDefaultFalseConfig("ECS_DISABLE_DOCKER_HEALTH_CHECK"),
 		GPUSupportEnabled:                   utils.ParseBool(os.Getenv("ECS_ENABLE_GPU_SUPPORT"), false),
 		InferentiaSupportEnabled:            utils.ParseBool(os.Getenv("ECS_ENABLE_INF_SUPPORT"), false),
 		NvidiaRuntime:                       os.Getenv("ECS_NVIDIA_RUNTIME"),
+		GPUMinDriverVersion:                 os.Getenv("ECS_NVIDIA_MIN_DRIVER_VERSION"),
+		GPURuntimeProbeInterval:             parseEnvVariableDuration("ECS_GPU_RUNTIME_PROBE_INTERVAL"),
 		TaskMetadataAZDisabled:              utils.ParseBool(os.Getenv("ECS_DISABLE_TASK_METADATA_AZ"), false),
 		CgroupCPUPeriod:                     parseCgroupCPUPeriod(),
 		SpotInstanceDrainingEnabled:         parseBooleanDefaultFalseConfig("ECS_ENABLE_SPOT_INSTANCE_DRAINING"),
@@ -593,6 +986,25 @@ func environmentConfig() (Config, error) {
 		FSxWindowsFileServerCapable:         parseFSxWindowsFileServerCapability(),
 		External:                            parseBooleanDefaultFalseConfig("ECS_EXTERNAL"),
 		EnableRuntimeStats:                  parseBooleanDefaultFalseConfig("ECS_ENABLE_RUNTIME_STATS"),
+		CredentialsEMFMetricsEnabled:        parseBooleanDefaultFalseConfig("ECS_ENABLE_CREDENTIALS_EMF_METRICS"),
+		CredentialsStatsDEndpoint:           os.Getenv("ECS_CREDENTIALS_STATSD_ENDPOINT"),
+		CredentialsRequireRunningTask:       parseBooleanDefaultFalseConfig("ECS_CREDENTIALS_REQUIRE_RUNNING_TASK"),
+		CredentialsPartitionCheckEnabled:    parseBooleanDefaultFalseConfig("ECS_CREDENTIALS_PARTITION_CHECK_ENABLED"),
+		CredentialsChecksumTrailerEnabled:   parseBooleanDefaultFalseConfig("ECS_CREDENTIALS_CHECKSUM_TRAILER_ENABLED"),
+		CredentialsSTSValidationEnabled:     parseBooleanDefaultFalseConfig("ECS_CREDENTIALS_STS_VALIDATION_ENABLED"),
+		CredentialsHeaderGuardEnabled:       parseBooleanDefaultFalseConfig("ECS_CREDENTIALS_SUSPICIOUS_HEADER_GUARD_ENABLED"),
+		CredentialsHeaderGuardHeuristics:    parseCommaSeparatedList("ECS_CREDENTIALS_SUSPICIOUS_HEADER_HEURISTICS"),
+		CredentialsV1EndpointDisabled:       parseBooleanDefaultFalseConfig("ECS_DISABLE_V1_CREDENTIALS_ENDPOINT"),
+		CredentialsSigningKeyFile:           os.Getenv("ECS_CREDENTIALS_SIGNING_KEY_FILE"),
+		CredentialsResponseSigningEnabled:   parseBooleanDefaultFalseConfig("ECS_CREDENTIALS_RESPONSE_SIGNING_ENABLED"),
+		CredentialsIDListingEnabled:         parseBooleanDefaultFalseConfig("ECS_ENABLE_CREDENTIALS_ID_LISTING"),
+		CredentialsSnapshotExportEnabled:    parseBooleanDefaultFalseConfig("ECS_ENABLE_CREDENTIALS_SNAPSHOT_EXPORT"),
+		LocalTaskLaunchEnabled:              parseBooleanDefaultFalseConfig("ECS_ENABLE_LOCAL_TASK_LAUNCH"),
+		ImageLazyLoadingEnabled:             parseBooleanDefaultFalseConfig("ECS_ENABLE_IMAGE_LAZY_LOADING"),
+		CredentialsMaxEntries:               int(parseEnvVariableInt64("ECS_CREDENTIALS_MAX_ENTRIES")),
+		TaskMetadataFirewallEnabled:         parseBooleanDefaultFalseConfig("ECS_ENABLE_TASK_METADATA_FIREWALL"),
+		TaskMetadataFirewallStrict:          parseBooleanDefaultFalseConfig("ECS_TASK_METADATA_FIREWALL_STRICT"),
+		FirelensDryRunEnabled:               parseBooleanDefaultFalseConfig("ECS_ENABLE_FIRELENS_DRY_RUN"),
 		ShouldExcludeIPv6PortBinding:        parseBooleanDefaultTrueConfig("ECS_EXCLUDE_IPV6_PORTBINDING"),
 		WarmPoolsSupport:                    parseBooleanDefaultFalseConfig("ECS_WARM_POOLS_CHECK"),
 		DynamicHostPortRange:                parseDynamicHostPortRange("ECS_DYNAMIC_HOST_PORT_RANGE"),
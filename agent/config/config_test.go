@@ -17,10 +17,13 @@
 package config
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -28,6 +31,8 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/ec2"
 	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/amazon-ecs-agent/agent/utils/envscrub"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
 
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/golang/mock/gomock"
@@ -461,6 +466,28 @@ func TestInvalidValuePollingMetricsWaitDuration(t *testing.T) {
 	assert.Equal(t, DefaultPollingMetricsWaitDuration, conf.PollingMetricsWaitDuration, "Wrong value for PollingMetricsWaitDuration")
 }
 
+func TestContainerStatsStalenessThreshold(t *testing.T) {
+	defer setTestRegion()()
+	conf, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultContainerStatsStalenessThreshold, conf.ContainerStatsStalenessThreshold)
+
+	defer setTestEnv("ECS_CONTAINER_STATS_STALENESS_THRESHOLD", "5s")()
+	conf, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, conf.ContainerStatsStalenessThreshold)
+}
+
+func TestContainerStatsStalenessThresholdBelowPollingInterval(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_POLL_METRICS", "true")()
+	defer setTestEnv("ECS_POLLING_METRICS_WAIT_DURATION", "10s")()
+	defer setTestEnv("ECS_CONTAINER_STATS_STALENESS_THRESHOLD", "5s")()
+	conf, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 20*time.Second, conf.ContainerStatsStalenessThreshold)
+}
+
 func TestInvalidFormatParseEnvVariableUint16(t *testing.T) {
 	defer setTestRegion()()
 	setTestEnv("FOO", "foo")
@@ -638,6 +665,18 @@ func TestCredentialsAuditLogDisabled(t *testing.T) {
 	assert.True(t, cfg.CredentialsAuditLogDisabled, "Wrong value for CredentialsAuditLogDisabled")
 }
 
+func TestCredentialsAuditLogSyslog(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_AUDIT_SYSLOG", "udp://127.0.0.1:514")()
+	defer setTestEnv("ECS_AUDIT_SYSLOG_FACILITY", "local3")()
+	defer setTestEnv("ECS_AUDIT_SYSLOG_SEVERITY", "notice")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, "udp://127.0.0.1:514", cfg.CredentialsAuditLogSyslog, "Wrong value for CredentialsAuditLogSyslog")
+	assert.Equal(t, "local3", cfg.CredentialsAuditLogSyslogFacility)
+	assert.Equal(t, "notice", cfg.CredentialsAuditLogSyslogSeverity)
+}
+
 func TestImageCleanupMinimumInterval(t *testing.T) {
 	defer setTestRegion()()
 	defer setTestEnv("ECS_IMAGE_CLEANUP_INTERVAL", "1m")()
@@ -678,6 +717,439 @@ func TestEnableRuntimeStatsConfigEnabled(t *testing.T) {
 	assert.True(t, cfg.EnableRuntimeStats.Enabled(), "Wrong value for EnableRuntimeStats")
 }
 
+func TestCredentialsEMFMetricsEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsEMFMetricsEnabled.Enabled())
+
+	defer setTestEnv("ECS_ENABLE_CREDENTIALS_EMF_METRICS", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsEMFMetricsEnabled.Enabled())
+}
+
+func TestCredentialsRequireRunningTask(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsRequireRunningTask.Enabled())
+
+	defer setTestEnv("ECS_CREDENTIALS_REQUIRE_RUNNING_TASK", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsRequireRunningTask.Enabled())
+}
+
+func TestCredentialsPartitionCheckEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsPartitionCheckEnabled.Enabled())
+
+	defer setTestEnv("ECS_CREDENTIALS_PARTITION_CHECK_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsPartitionCheckEnabled.Enabled())
+}
+
+func TestCredentialsChecksumTrailerEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsChecksumTrailerEnabled.Enabled())
+
+	defer setTestEnv("ECS_CREDENTIALS_CHECKSUM_TRAILER_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsChecksumTrailerEnabled.Enabled())
+}
+
+func TestCredentialsSTSValidationEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsSTSValidationEnabled.Enabled())
+
+	defer setTestEnv("ECS_CREDENTIALS_STS_VALIDATION_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsSTSValidationEnabled.Enabled())
+}
+
+func TestCredentialsHeaderGuardEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsHeaderGuardEnabled.Enabled())
+
+	defer setTestEnv("ECS_CREDENTIALS_SUSPICIOUS_HEADER_GUARD_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsHeaderGuardEnabled.Enabled())
+}
+
+func TestCredentialsV1EndpointDisabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsV1EndpointDisabled.Enabled())
+
+	defer setTestEnv("ECS_DISABLE_V1_CREDENTIALS_ENDPOINT", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsV1EndpointDisabled.Enabled())
+}
+
+func TestCredentialsIDListingEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsIDListingEnabled.Enabled())
+
+	defer setTestEnv("ECS_ENABLE_CREDENTIALS_ID_LISTING", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsIDListingEnabled.Enabled())
+}
+
+func TestCredentialsSnapshotExportEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsSnapshotExportEnabled.Enabled())
+
+	defer setTestEnv("ECS_ENABLE_CREDENTIALS_SNAPSHOT_EXPORT", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsSnapshotExportEnabled.Enabled())
+}
+
+func TestLocalTaskLaunchEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.LocalTaskLaunchEnabled.Enabled())
+
+	defer setTestEnv("ECS_ENABLE_LOCAL_TASK_LAUNCH", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.LocalTaskLaunchEnabled.Enabled())
+}
+
+func TestImageLazyLoadingEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.ImageLazyLoadingEnabled.Enabled())
+
+	defer setTestEnv("ECS_ENABLE_IMAGE_LAZY_LOADING", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.ImageLazyLoadingEnabled.Enabled())
+}
+
+func TestCredentialsSigningKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "credentials-signing.key")
+	require.NoError(t, os.WriteFile(keyFile,
+		[]byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))+"\n"), 0600))
+	defer setTestRegion()()
+	defer setTestEnv("ECS_CREDENTIALS_SIGNING_KEY_FILE", keyFile)()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, keyFile, cfg.CredentialsSigningKeyFile)
+}
+
+func TestInvalidCredentialsSigningKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	notEncodedFile := filepath.Join(dir, "not-encoded.key")
+	require.NoError(t, os.WriteFile(notEncodedFile, []byte("not base64!"), 0600))
+	shortKeyFile := filepath.Join(dir, "short.key")
+	require.NoError(t, os.WriteFile(shortKeyFile,
+		[]byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16))), 0600))
+	defer setTestRegion()()
+
+	for _, keyFile := range []string{filepath.Join(dir, "missing.key"), notEncodedFile, shortKeyFile} {
+		t.Run(filepath.Base(keyFile), func(t *testing.T) {
+			defer setTestEnv("ECS_CREDENTIALS_SIGNING_KEY_FILE", keyFile)()
+			_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAWSEndpointSettings(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_AWS_ENDPOINT_MODE", " FIPS ")()
+	defer setTestEnv("ECS_AWS_ENDPOINT_OVERRIDES",
+		`{"ssm":"https://vpce-0123-ssm.ssm.us-west-2.vpce.amazonaws.com"}`)()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	assert.Equal(t, "FIPS", cfg.AWSEndpointMode)
+	assert.Equal(t, map[string]string{"ssm": "https://vpce-0123-ssm.ssm.us-west-2.vpce.amazonaws.com"},
+		cfg.AWSEndpointOverrides)
+
+	endpoints := cfg.EndpointResolver()
+	require.NotNil(t, endpoints)
+	assert.Equal(t, map[string]string{
+		"ecs":            "https://ecs-fips.us-west-2.amazonaws.com",
+		"ecr":            "https://ecr-fips.us-west-2.amazonaws.com",
+		"ssm":            "https://vpce-0123-ssm.ssm.us-west-2.vpce.amazonaws.com",
+		"secretsmanager": "https://secretsmanager-fips.us-west-2.amazonaws.com",
+	}, endpoints.ResolveAll(cfg.AWSRegion))
+}
+
+func TestInvalidAWSEndpointSettings(t *testing.T) {
+	testCases := []struct {
+		name      string
+		region    string
+		mode      string
+		overrides string
+	}{
+		{name: "unknown mode", region: "us-west-2", mode: "fastest"},
+		{name: "FIPS in China", region: "cn-north-1", mode: "fips"},
+		{name: "override not a json hash", region: "us-west-2", overrides: `["https://ecs.example.com"]`},
+		{name: "override of unknown service", region: "us-west-2", overrides: `{"s3":"https://s3.example.com"}`},
+		{name: "relative override", region: "us-west-2", overrides: `{"ecs":"ecs.example.com"}`},
+		{name: "override with bad scheme", region: "us-west-2", overrides: `{"ecr":"ftp://ecr.example.com"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setTestEnv("AWS_DEFAULT_REGION", tc.region)()
+			defer setTestEnv("ECS_AWS_ENDPOINT_MODE", tc.mode)()
+			defer setTestEnv("ECS_AWS_ENDPOINT_OVERRIDES", tc.overrides)()
+			_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCredentialsResponseSigningEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.CredentialsResponseSigningEnabled.Enabled())
+
+	defer setTestEnv("ECS_CREDENTIALS_RESPONSE_SIGNING_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsResponseSigningEnabled.Enabled())
+}
+
+func TestCredentialsMaxEntries(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCredentialsMaxEntries, cfg.CredentialsMaxEntries)
+
+	defer setTestEnv("ECS_CREDENTIALS_MAX_ENTRIES", "-1")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cfg.CredentialsMaxEntries)
+}
+
+func TestCredentialsStatsDEndpoint(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.CredentialsStatsDEndpoint)
+
+	defer setTestEnv("ECS_CREDENTIALS_STATSD_ENDPOINT", "127.0.0.1:8125")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8125", cfg.CredentialsStatsDEndpoint)
+}
+
+func TestTaskMetadataSessionTokenMode(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+	}{
+		{value: "", expected: "optional"},
+		{value: "optional", expected: "optional"},
+		{value: "Required", expected: "required"},
+		{value: "sometimes", expected: "optional"},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_TASK_METADATA_SESSION_TOKENS", tc.value)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cfg.TaskMetadataSessionTokenMode)
+		})
+	}
+}
+
+func TestContainerMetadataFileSchema(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+	}{
+		{value: "", expected: "1"},
+		{value: "1", expected: "1"},
+		{value: "2", expected: "2"},
+		{value: "v3", expected: "1"},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_CONTAINER_METADATA_FILE_SCHEMA", tc.value)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cfg.ContainerMetadataFileSchema)
+		})
+	}
+}
+
+func TestContainerOutputCapture(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.ContainerOutputCaptureEnabled.Enabled())
+	assert.Equal(t, int64(DefaultContainerOutputCaptureMaxFileBytes), cfg.ContainerOutputCaptureMaxFileBytes)
+
+	for _, tc := range []struct {
+		value    string
+		expected int64
+	}{
+		{value: "1048576", expected: 1 << 20},
+		{value: "-1", expected: DefaultContainerOutputCaptureMaxFileBytes},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			defer setTestEnv("ECS_ENABLE_CONTAINER_OUTPUT_CAPTURE", "true")()
+			defer setTestEnv("ECS_CONTAINER_OUTPUT_CAPTURE_MAX_FILE_BYTES", tc.value)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.True(t, cfg.ContainerOutputCaptureEnabled.Enabled())
+			assert.Equal(t, tc.expected, cfg.ContainerOutputCaptureMaxFileBytes)
+		})
+	}
+}
+
+func TestCredentialsResponseSchemaValidation(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.CredentialsResponseSchemaValidation)
+
+	defer setTestEnv("ECS_CREDENTIALS_RESPONSE_SCHEMA_VALIDATION", "enforce")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, "enforce", cfg.CredentialsResponseSchemaValidation)
+}
+
+func TestInvalidCredentialsResponseSchemaValidation(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_CREDENTIALS_RESPONSE_SCHEMA_VALIDATION", "strict")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.CredentialsResponseSchemaValidation)
+}
+
+func TestImagePrefetch(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.ImagePrefetchList)
+	assert.Equal(t, DefaultImagePrefetchConcurrency, cfg.ImagePrefetchConcurrency)
+	assert.Equal(t, DefaultImagePrefetchRetention, cfg.ImagePrefetchRetention)
+
+	defer setTestEnv("ECS_IMAGE_PREFETCH_LIST", `[{"Image": "123456789012.dkr.ecr.us-west-2.amazonaws.com/app:v1", "ECRRegion": "us-west-2", "ECRRegistryID": "123456789012"}, {"Image": "busybox:latest"}]`)()
+	defer setTestEnv("ECS_IMAGE_PREFETCH_CONCURRENCY", "4")()
+	defer setTestEnv("ECS_IMAGE_PREFETCH_RETENTION", "2h")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, []ImagePrefetch{
+		{Image: "123456789012.dkr.ecr.us-west-2.amazonaws.com/app:v1", ECRRegion: "us-west-2", ECRRegistryID: "123456789012"},
+		{Image: "busybox:latest"},
+	}, cfg.ImagePrefetchList)
+	assert.Equal(t, 4, cfg.ImagePrefetchConcurrency)
+	assert.Equal(t, 2*time.Hour, cfg.ImagePrefetchRetention)
+
+	defer setTestEnv("ECS_IMAGE_PREFETCH_LIST", "busybox:latest, nginx:1.25")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, []ImagePrefetch{{Image: "busybox:latest"}, {Image: "nginx:1.25"}}, cfg.ImagePrefetchList)
+}
+
+func TestStateReconcileConcurrency(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultStateReconcileConcurrency, cfg.StateReconcileConcurrency)
+
+	defer setTestEnv("ECS_STATE_RECONCILE_CONCURRENCY", "32")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 32, cfg.StateReconcileConcurrency)
+}
+
+func TestInvalidStateReconcileConcurrency(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_STATE_RECONCILE_CONCURRENCY", "0")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultStateReconcileConcurrency, cfg.StateReconcileConcurrency)
+}
+
+func TestCredentialsTunables(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.CredentialsSteadyStateRate)
+	assert.Zero(t, cfg.CredentialsBurstRate)
+	assert.Empty(t, cfg.CredentialsAllowedRoleTypes)
+	assert.Empty(t, cfg.CredentialsRequestLogLevel)
+
+	defer setTestEnv("ECS_CREDENTIALS_RPS_LIMIT", "50,100")()
+	defer setTestEnv("ECS_CREDENTIALS_ALLOWED_ROLE_TYPES", "TaskApplication,TaskExecution")()
+	defer setTestEnv("ECS_CREDENTIALS_REQUEST_LOG_LEVEL", "debug")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 50, cfg.CredentialsSteadyStateRate)
+	assert.Equal(t, 100, cfg.CredentialsBurstRate)
+	assert.Equal(t, []string{"TaskApplication", "TaskExecution"}, cfg.CredentialsAllowedRoleTypes)
+	assert.Equal(t, "debug", cfg.CredentialsRequestLogLevel)
+}
+
+func TestInvalidCredentialsTunables(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_CREDENTIALS_RPS_LIMIT", "-10,10")()
+	defer setTestEnv("ECS_CREDENTIALS_REQUEST_LOG_LEVEL", "trace")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.CredentialsSteadyStateRate)
+	assert.Zero(t, cfg.CredentialsBurstRate)
+	assert.Equal(t, "info", cfg.CredentialsRequestLogLevel)
+}
+
+func TestTaskMetadataFirewall(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.TaskMetadataFirewallEnabled.Enabled())
+	assert.False(t, cfg.TaskMetadataFirewallStrict.Enabled())
+
+	defer setTestEnv("ECS_ENABLE_TASK_METADATA_FIREWALL", "true")()
+	defer setTestEnv("ECS_TASK_METADATA_FIREWALL_STRICT", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.TaskMetadataFirewallEnabled.Enabled())
+	assert.True(t, cfg.TaskMetadataFirewallStrict.Enabled())
+}
+
+func TestFirelensDryRunEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.FirelensDryRunEnabled.Enabled())
+
+	defer setTestEnv("ECS_ENABLE_FIRELENS_DRY_RUN", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.FirelensDryRunEnabled.Enabled())
+}
+
 func TestParseImagePullBehavior(t *testing.T) {
 	testcases := []struct {
 		name                      string
@@ -751,6 +1223,423 @@ func TestAWSLogsExecutionRole(t *testing.T) {
 	assert.True(t, conf.OverrideAWSLogsExecutionRole.Enabled())
 }
 
+func TestAWSLogsNonBlockingDefault(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.AWSLogsNonBlockingDefault.Enabled())
+	assert.Equal(t, DefaultAWSLogsMaxBufferSize, cfg.AWSLogsDefaultMaxBufferSize)
+
+	defer setTestEnv("ECS_AWSLOGS_NON_BLOCKING_DEFAULT", "true")()
+	defer setTestEnv("ECS_AWSLOGS_DEFAULT_MAX_BUFFER_SIZE", "25m")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.AWSLogsNonBlockingDefault.Enabled())
+	assert.Equal(t, "25m", cfg.AWSLogsDefaultMaxBufferSize)
+}
+
+func TestImagePullProgressLogInterval(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), cfg.ImagePullProgressLogInterval)
+
+	defer setTestEnv("ECS_IMAGE_PULL_PROGRESS_LOG_INTERVAL", "30s")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.ImagePullProgressLogInterval)
+}
+
+func TestDockerCircuitBreaker(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDockerCircuitBreakerThreshold, cfg.DockerCircuitBreakerThreshold)
+	assert.Equal(t, DefaultDockerCircuitBreakerCoolDown, cfg.DockerCircuitBreakerCoolDown)
+
+	defer setTestEnv("ECS_DOCKER_CIRCUIT_BREAKER_THRESHOLD", "3")()
+	defer setTestEnv("ECS_DOCKER_CIRCUIT_BREAKER_COOLDOWN", "1m")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cfg.DockerCircuitBreakerThreshold)
+	assert.Equal(t, time.Minute, cfg.DockerCircuitBreakerCoolDown)
+
+	defer setTestEnv("ECS_DOCKER_CIRCUIT_BREAKER_THRESHOLD", "-1")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cfg.DockerCircuitBreakerThreshold)
+}
+
+func TestClockDrift(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultClockDriftThreshold, cfg.ClockDriftThreshold)
+	assert.Equal(t, DefaultClockDriftCheckInterval, cfg.ClockDriftCheckInterval)
+	assert.Empty(t, cfg.ClockDriftNTPServer)
+
+	defer setTestEnv("ECS_CLOCK_DRIFT_THRESHOLD", "30s")()
+	defer setTestEnv("ECS_CLOCK_DRIFT_CHECK_INTERVAL", "1h")()
+	defer setTestEnv("ECS_CLOCK_DRIFT_NTP_SERVER", "169.254.169.123")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.ClockDriftThreshold)
+	assert.Equal(t, time.Hour, cfg.ClockDriftCheckInterval)
+	assert.Equal(t, "169.254.169.123", cfg.ClockDriftNTPServer)
+
+	defer setTestEnv("ECS_CLOCK_DRIFT_THRESHOLD", "-1s")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultClockDriftThreshold, cfg.ClockDriftThreshold)
+}
+
+func TestStopLastTaskFamilies(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.StopLastTaskFamilies)
+	assert.Equal(t, DefaultDrainStopLastTimeout, cfg.DrainStopLastTimeout)
+
+	defer setTestEnv("ECS_STOP_LAST_TASK_FAMILIES", "log-router, metrics-agent,,")()
+	defer setTestEnv("ECS_DRAIN_STOP_LAST_TIMEOUT", "45s")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log-router", "metrics-agent"}, cfg.StopLastTaskFamilies)
+	assert.Equal(t, 45*time.Second, cfg.DrainStopLastTimeout)
+
+	defer setTestEnv("ECS_DRAIN_STOP_LAST_TIMEOUT", "0s")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDrainStopLastTimeout, cfg.DrainStopLastTimeout)
+}
+
+func TestLocalEndpointSlowRequestThreshold(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultLocalEndpointSlowRequestThreshold, cfg.LocalEndpointSlowRequestThreshold)
+
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_SLOW_REQUEST_THRESHOLD", "500ms")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, cfg.LocalEndpointSlowRequestThreshold)
+}
+
+func TestLocalEndpointRequestLimits(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultLocalEndpointReadHeaderTimeout, cfg.LocalEndpointReadHeaderTimeout)
+	assert.Equal(t, DefaultLocalEndpointMaxHeaderBytes, cfg.LocalEndpointMaxHeaderBytes)
+	assert.Equal(t, int64(DefaultLocalEndpointMaxRequestBodyBytes), cfg.LocalEndpointMaxRequestBodyBytes)
+
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_READ_HEADER_TIMEOUT", "1s")()
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_MAX_HEADER_BYTES", "4096")()
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_MAX_REQUEST_BODY_BYTES", "1048576")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, cfg.LocalEndpointReadHeaderTimeout)
+	assert.Equal(t, 4096, cfg.LocalEndpointMaxHeaderBytes)
+	assert.Equal(t, int64(1048576), cfg.LocalEndpointMaxRequestBodyBytes)
+}
+
+func TestTaskMetadataTagsCacheTTL(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTaskMetadataTagsCacheTTL, cfg.TaskMetadataTagsCacheTTL)
+
+	defer setTestEnv("ECS_TASK_METADATA_TAGS_CACHE_TTL", "30s")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.TaskMetadataTagsCacheTTL)
+}
+
+func TestLocalEndpointLogLevelHeaderEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.LocalEndpointLogLevelHeaderEnabled.Enabled())
+
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_LOG_LEVEL_HEADER_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.LocalEndpointLogLevelHeaderEnabled.Enabled())
+}
+
+func TestLocalEndpointTraceContextEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.LocalEndpointTraceContextEnabled.Enabled())
+
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_TRACE_CONTEXT_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.LocalEndpointTraceContextEnabled.Enabled())
+}
+
+func TestLocalEndpointPathNormalization(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.LocalEndpointPathNormalization.Enabled())
+
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_PATH_NORMALIZATION", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.LocalEndpointPathNormalization.Enabled())
+}
+
+func TestLocalEndpointForwardedPrefixEnabled(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.LocalEndpointForwardedPrefixEnabled.Enabled())
+
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_FORWARDED_PREFIX_ENABLED", "true")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.LocalEndpointForwardedPrefixEnabled.Enabled())
+}
+
+func TestLocalEndpointResponseJitter(t *testing.T) {
+	testCases := []struct {
+		envVarVal      string
+		expectedJitter time.Duration
+	}{
+		{envVarVal: "", expectedJitter: 0},
+		{envVarVal: "250ms", expectedJitter: 250 * time.Millisecond},
+		{envVarVal: "-1s", expectedJitter: 0},
+		{envVarVal: "1m", expectedJitter: MaxLocalEndpointResponseJitter},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.envVarVal, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_LOCAL_ENDPOINT_RESPONSE_JITTER", tc.envVarVal)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedJitter, cfg.LocalEndpointResponseJitter)
+		})
+	}
+}
+
+func TestCredentialsNotFoundRetryAfter(t *testing.T) {
+	testCases := []struct {
+		envVarVal          string
+		expectedRetryAfter time.Duration
+	}{
+		{envVarVal: "", expectedRetryAfter: 0},
+		{envVarVal: "2s", expectedRetryAfter: 2 * time.Second},
+		{envVarVal: "-1s", expectedRetryAfter: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.envVarVal, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_CREDENTIALS_NOT_FOUND_RETRY_AFTER", tc.envVarVal)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRetryAfter, cfg.CredentialsNotFoundRetryAfter)
+		})
+	}
+}
+
+func TestCredentialsPreExpiryRefreshMargin(t *testing.T) {
+	testCases := []struct {
+		envVarVal      string
+		expectedMargin time.Duration
+	}{
+		{envVarVal: "", expectedMargin: 0},
+		{envVarVal: "5m", expectedMargin: 5 * time.Minute},
+		{envVarVal: "-1m", expectedMargin: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.envVarVal, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_CREDENTIALS_PRE_EXPIRY_REFRESH_MARGIN", tc.envVarVal)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMargin, cfg.CredentialsPreExpiryRefreshMargin)
+		})
+	}
+}
+
+func TestCredentialsExpectedLocalPort(t *testing.T) {
+	testCases := []struct {
+		envVarVal    string
+		expectedPort uint16
+	}{
+		{envVarVal: "", expectedPort: 0},
+		{envVarVal: "51679", expectedPort: 51679},
+		{envVarVal: "70000", expectedPort: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.envVarVal, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_CREDENTIALS_EXPECTED_LOCAL_PORT", tc.envVarVal)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPort, cfg.CredentialsExpectedLocalPort)
+		})
+	}
+}
+
+func TestCredentialsRefreshAfterMargin(t *testing.T) {
+	testCases := []struct {
+		envVarVal      string
+		expectedMargin time.Duration
+	}{
+		{envVarVal: "", expectedMargin: 0},
+		{envVarVal: "15m", expectedMargin: 15 * time.Minute},
+		{envVarVal: "-1m", expectedMargin: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.envVarVal, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_CREDENTIALS_REFRESH_AFTER_MARGIN", tc.envVarVal)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMargin, cfg.CredentialsRefreshAfterMargin)
+		})
+	}
+}
+
+func TestCredentialsAuditLogDedupWindow(t *testing.T) {
+	testCases := []struct {
+		envVarVal      string
+		expectedWindow time.Duration
+	}{
+		{envVarVal: "", expectedWindow: 0},
+		{envVarVal: "30s", expectedWindow: 30 * time.Second},
+		{envVarVal: "-1m", expectedWindow: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.envVarVal, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_AUDIT_LOG_DEDUP_WINDOW", tc.envVarVal)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedWindow, cfg.CredentialsAuditLogDedupWindow)
+		})
+	}
+}
+
+func TestStateEnvironmentScrubPatterns(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	assert.Equal(t, envscrub.DefaultPatterns, cfg.StateEnvironmentScrubPatterns)
+	assert.True(t, cfg.EnvironmentScrubber().Sensitive("DB_PASSWORD"))
+
+	defer setTestEnv("ECS_STATE_ENV_SCRUB_PATTERNS", "*_CREDENTIAL, DSN")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*_CREDENTIAL", "DSN"}, cfg.StateEnvironmentScrubPatterns)
+	assert.True(t, cfg.EnvironmentScrubber().Sensitive("dsn"))
+	assert.False(t, cfg.EnvironmentScrubber().Sensitive("DB_PASSWORD"))
+}
+
+func TestInvalidStateEnvironmentScrubPatterns(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_STATE_ENV_SCRUB_PATTERNS", "*KEY*,[SECRET")()
+	_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.Error(t, err)
+}
+
+func TestCredentialsHeaderGuardHeuristics(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	heuristics, err := cfg.SuspiciousHeaderHeuristics()
+	require.NoError(t, err)
+	assert.Equal(t, tmdsv1.SuspiciousHeaderHeuristics, heuristics)
+
+	defer setTestEnv("ECS_CREDENTIALS_SUSPICIOUS_HEADER_HEURISTICS", "url-override, proxy-headers")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	heuristics, err = cfg.SuspiciousHeaderHeuristics()
+	require.NoError(t, err)
+	assert.Equal(t, []tmdsv1.SuspiciousHeaderHeuristic{tmdsv1.HeuristicURLOverride, tmdsv1.HeuristicProxyHeaders},
+		heuristics)
+}
+
+func TestInvalidCredentialsHeaderGuardHeuristics(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_CREDENTIALS_SUSPICIOUS_HEADER_HEURISTICS", "proxy-headers,referer")()
+	_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.Error(t, err)
+}
+
+func TestCredentialsFaultInjection(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.CredentialsFaultInjection)
+
+	defer setTestEnv("ECS_UNSAFE_CREDENTIALS_FAULT_INJECTION",
+		`{"id1": {"Type": "Delay", "Delay": "500ms"}, "id2": {"Type": "TruncatedBody"}, "id3": {"Type": "Delay", "Delay": "soon"}, "id4": {"Type": "Crash"}}`)()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]CredentialsFault{
+		"id1": {Type: "Delay", Delay: 500 * time.Millisecond},
+		"id2": {Type: "TruncatedBody"},
+	}, cfg.CredentialsFaultInjection)
+
+	os.Setenv("ECS_UNSAFE_CREDENTIALS_FAULT_INJECTION", "[]")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.CredentialsFaultInjection)
+}
+
+func TestCredentialsAuditDigestWindow(t *testing.T) {
+	testCases := []struct {
+		envVarVal      string
+		expectedWindow time.Duration
+	}{
+		{envVarVal: "", expectedWindow: 0},
+		{envVarVal: "15m", expectedWindow: 15 * time.Minute},
+		{envVarVal: "-1h", expectedWindow: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.envVarVal, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_CREDENTIALS_AUDIT_DIGEST_WINDOW", tc.envVarVal)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedWindow, cfg.CredentialsAuditDigestWindow)
+		})
+	}
+}
+
+func TestTaskEventsHeartbeatInterval(t *testing.T) {
+	defer setTestRegion()()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTaskEventsHeartbeatInterval, cfg.TaskEventsHeartbeatInterval)
+
+	defer setTestEnv("ECS_INTROSPECTION_EVENTS_HEARTBEAT_INTERVAL", "30s")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.TaskEventsHeartbeatInterval)
+
+	os.Setenv("ECS_INTROSPECTION_EVENTS_HEARTBEAT_INTERVAL", "-1s")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTaskEventsHeartbeatInterval, cfg.TaskEventsHeartbeatInterval)
+}
+
+func TestInvalidLocalEndpointRequestLimits(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_READ_HEADER_TIMEOUT", "-1s")()
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_MAX_HEADER_BYTES", "-1")()
+	defer setTestEnv("ECS_LOCAL_ENDPOINT_MAX_REQUEST_BODY_BYTES", "lots")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultLocalEndpointReadHeaderTimeout, cfg.LocalEndpointReadHeaderTimeout)
+	assert.Equal(t, DefaultLocalEndpointMaxHeaderBytes, cfg.LocalEndpointMaxHeaderBytes)
+	assert.Equal(t, int64(DefaultLocalEndpointMaxRequestBodyBytes), cfg.LocalEndpointMaxRequestBodyBytes)
+}
+
 func TestTaskMetadataRPSLimits(t *testing.T) {
 	testCases := []struct {
 		name                    string
@@ -919,6 +1808,23 @@ func TestGPUSupportEnabled(t *testing.T) {
 	assert.True(t, cfg.GPUSupportEnabled, "Wrong value for GPUSupportEnabled")
 }
 
+func TestGPURuntimeProbeConfig(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ENABLE_GPU_SUPPORT", "true")()
+	defer setTestEnv("ECS_GPU_RUNTIME_PROBE_INTERVAL", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.GPUMinDriverVersion)
+	assert.Equal(t, DefaultGPURuntimeProbeInterval, cfg.GPURuntimeProbeInterval)
+
+	defer setTestEnv("ECS_NVIDIA_MIN_DRIVER_VERSION", " 545.23 ")()
+	defer setTestEnv("ECS_GPU_RUNTIME_PROBE_INTERVAL", "1m")()
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, "545.23", cfg.GPUMinDriverVersion)
+	assert.Equal(t, time.Minute, cfg.GPURuntimeProbeInterval)
+}
+
 func TestInferentiaSupportEnabled(t *testing.T) {
 	defer setTestRegion()()
 	defer setTestEnv("ECS_ENABLE_INF_SUPPORT", "true")()
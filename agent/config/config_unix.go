@@ -23,6 +23,7 @@ import (
 
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/amazon-ecs-agent/agent/utils/envscrub"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds"
 )
 
@@ -66,6 +67,7 @@ func DefaultConfig() Config {
 		ReservedPortsUDP:                    []uint16{},
 		DataDir:                             "/data/",
 		DataDirOnHost:                       "/var/lib/ecs",
+		StateEnvironmentScrubPatterns:       envscrub.DefaultPatterns,
 		DisableMetrics:                      BooleanDefaultFalse{Value: ExplicitlyDisabled},
 		ReservedMemory:                      0,
 		AvailableLoggingDrivers:             []dockerclient.LoggingDriver{dockerclient.JSONFileDriver, dockerclient.NoneDriver},
@@ -83,6 +85,14 @@ func DefaultConfig() Config {
 		ImagePullInactivityTimeout:          defaultImagePullInactivityTimeout,
 		ImagePullTimeout:                    DefaultImagePullTimeout,
 		NumImagesToDeletePerCycle:           DefaultNumImagesToDeletePerCycle,
+		DockerCircuitBreakerThreshold:       DefaultDockerCircuitBreakerThreshold,
+		DockerCircuitBreakerCoolDown:        DefaultDockerCircuitBreakerCoolDown,
+		ClockDriftThreshold:                 DefaultClockDriftThreshold,
+		ClockDriftCheckInterval:             DefaultClockDriftCheckInterval,
+		DrainStopLastTimeout:                DefaultDrainStopLastTimeout,
+		StateReconcileConcurrency:           DefaultStateReconcileConcurrency,
+		ImagePrefetchConcurrency:            DefaultImagePrefetchConcurrency,
+		ImagePrefetchRetention:              DefaultImagePrefetchRetention,
 		NumNonECSContainersToDeletePerCycle: DefaultNumNonECSContainersToDeletePerCycle,
 		CNIPluginsPath:                      defaultCNIPluginsPath,
 		PauseContainerTarballPath:           pauseContainerTarballPath,
@@ -90,22 +100,54 @@ func DefaultConfig() Config {
 		PauseContainerTag:                   DefaultPauseContainerTag,
 		AWSVPCBlockInstanceMetdata:          BooleanDefaultFalse{Value: ExplicitlyDisabled},
 		ContainerMetadataEnabled:            BooleanDefaultFalse{Value: ExplicitlyDisabled},
+		ContainerOutputCaptureEnabled:       BooleanDefaultFalse{Value: ExplicitlyDisabled},
+		ContainerOutputCaptureMaxFileBytes:  DefaultContainerOutputCaptureMaxFileBytes,
 		TaskCPUMemLimit:                     BooleanDefaultTrue{Value: NotSet},
 		CgroupPath:                          defaultCgroupPath,
 		TaskMetadataSteadyStateRate:         DefaultTaskMetadataSteadyStateRate,
 		TaskMetadataBurstRate:               DefaultTaskMetadataBurstRate,
+		AWSLogsNonBlockingDefault:           BooleanDefaultFalse{Value: ExplicitlyDisabled},
+		AWSLogsDefaultMaxBufferSize:         DefaultAWSLogsMaxBufferSize,
+		LocalEndpointSlowRequestThreshold:   DefaultLocalEndpointSlowRequestThreshold,
+		LocalEndpointReadHeaderTimeout:      DefaultLocalEndpointReadHeaderTimeout,
+		TaskMetadataTagsCacheTTL:            DefaultTaskMetadataTagsCacheTTL,
+		LocalEndpointMaxHeaderBytes:         DefaultLocalEndpointMaxHeaderBytes,
+		LocalEndpointMaxRequestBodyBytes:    DefaultLocalEndpointMaxRequestBodyBytes,
+		LocalEndpointLogLevelHeaderEnabled:  BooleanDefaultFalse{Value: NotSet},
+		LocalEndpointTraceContextEnabled:    BooleanDefaultFalse{Value: NotSet},
+		LocalEndpointPathNormalization:      BooleanDefaultFalse{Value: NotSet},
+		LocalEndpointForwardedPrefixEnabled: BooleanDefaultFalse{Value: NotSet},
+		TaskEventsHeartbeatInterval:         DefaultTaskEventsHeartbeatInterval,
 		SharedVolumeMatchFullConfig:         BooleanDefaultFalse{Value: ExplicitlyDisabled}, // only requiring shared volumes to match on name, which is default docker behavior
 		ContainerInstancePropagateTagsFrom:  ContainerInstancePropagateTagsFromNoneType,
 		PrometheusMetricsEnabled:            false,
 		PollMetrics:                         BooleanDefaultFalse{Value: NotSet},
 		PollingMetricsWaitDuration:          DefaultPollingMetricsWaitDuration,
+		ContainerStatsStalenessThreshold:    DefaultContainerStatsStalenessThreshold,
 		NvidiaRuntime:                       DefaultNvidiaRuntime,
+		GPURuntimeProbeInterval:             DefaultGPURuntimeProbeInterval,
 		CgroupCPUPeriod:                     defaultCgroupCPUPeriod,
 		GMSACapable:                         parseGMSACapability(),
 		GMSADomainlessCapable:               parseGMSADomainlessCapability(),
 		FSxWindowsFileServerCapable:         BooleanDefaultFalse{Value: ExplicitlyDisabled},
 		RuntimeStatsLogFile:                 defaultRuntimeStatsLogFile,
 		EnableRuntimeStats:                  BooleanDefaultFalse{Value: NotSet},
+		CredentialsEMFMetricsEnabled:        BooleanDefaultFalse{Value: NotSet},
+		CredentialsRequireRunningTask:       BooleanDefaultFalse{Value: NotSet},
+		CredentialsPartitionCheckEnabled:    BooleanDefaultFalse{Value: NotSet},
+		CredentialsChecksumTrailerEnabled:   BooleanDefaultFalse{Value: NotSet},
+		CredentialsSTSValidationEnabled:     BooleanDefaultFalse{Value: NotSet},
+		CredentialsHeaderGuardEnabled:       BooleanDefaultFalse{Value: NotSet},
+		CredentialsV1EndpointDisabled:       BooleanDefaultFalse{Value: NotSet},
+		CredentialsResponseSigningEnabled:   BooleanDefaultFalse{Value: NotSet},
+		CredentialsIDListingEnabled:         BooleanDefaultFalse{Value: NotSet},
+		CredentialsSnapshotExportEnabled:    BooleanDefaultFalse{Value: NotSet},
+		LocalTaskLaunchEnabled:              BooleanDefaultFalse{Value: NotSet},
+		ImageLazyLoadingEnabled:             BooleanDefaultFalse{Value: NotSet},
+		CredentialsMaxEntries:               DefaultCredentialsMaxEntries,
+		TaskMetadataFirewallEnabled:         BooleanDefaultFalse{Value: NotSet},
+		TaskMetadataFirewallStrict:          BooleanDefaultFalse{Value: NotSet},
+		FirelensDryRunEnabled:               BooleanDefaultFalse{Value: NotSet},
 		ShouldExcludeIPv6PortBinding:        BooleanDefaultTrue{Value: ExplicitlyEnabled},
 	}
 }
@@ -25,6 +25,7 @@ import (
 
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/amazon-ecs-agent/agent/utils/envscrub"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds"
 
 	"github.com/cihub/seelog"
@@ -118,6 +119,7 @@ func DefaultConfig() Config {
 		// DataDirOnHost is identical to DataDir for Windows because we do not
 		// run as a container
 		DataDirOnHost:                       dataDir,
+		StateEnvironmentScrubPatterns:       envscrub.DefaultPatterns,
 		ReservedMemory:                      0,
 		AvailableLoggingDrivers:             []dockerclient.LoggingDriver{dockerclient.JSONFileDriver, dockerclient.NoneDriver, dockerclient.AWSLogsDriver},
 		TaskCleanupWaitDuration:             DefaultTaskCleanupWaitDuration,
@@ -134,15 +136,38 @@ func DefaultConfig() Config {
 		NonECSMinimumImageDeletionAge:       DefaultNonECSImageDeletionAge,
 		ImageCleanupInterval:                DefaultImageCleanupTimeInterval,
 		NumImagesToDeletePerCycle:           DefaultNumImagesToDeletePerCycle,
+		DockerCircuitBreakerThreshold:       DefaultDockerCircuitBreakerThreshold,
+		DockerCircuitBreakerCoolDown:        DefaultDockerCircuitBreakerCoolDown,
+		ClockDriftThreshold:                 DefaultClockDriftThreshold,
+		ClockDriftCheckInterval:             DefaultClockDriftCheckInterval,
+		DrainStopLastTimeout:                DefaultDrainStopLastTimeout,
+		StateReconcileConcurrency:           DefaultStateReconcileConcurrency,
+		ImagePrefetchConcurrency:            DefaultImagePrefetchConcurrency,
+		ImagePrefetchRetention:              DefaultImagePrefetchRetention,
 		NumNonECSContainersToDeletePerCycle: DefaultNumNonECSContainersToDeletePerCycle,
 		ContainerMetadataEnabled:            BooleanDefaultFalse{Value: ExplicitlyDisabled},
+		ContainerOutputCaptureEnabled:       BooleanDefaultFalse{Value: ExplicitlyDisabled},
+		ContainerOutputCaptureMaxFileBytes:  DefaultContainerOutputCaptureMaxFileBytes,
 		TaskCPUMemLimit:                     BooleanDefaultTrue{Value: ExplicitlyDisabled},
 		PlatformVariables:                   platformVariables,
 		TaskMetadataSteadyStateRate:         DefaultTaskMetadataSteadyStateRate,
 		TaskMetadataBurstRate:               DefaultTaskMetadataBurstRate,
+		AWSLogsNonBlockingDefault:           BooleanDefaultFalse{Value: ExplicitlyDisabled},
+		AWSLogsDefaultMaxBufferSize:         DefaultAWSLogsMaxBufferSize,
+		LocalEndpointSlowRequestThreshold:   DefaultLocalEndpointSlowRequestThreshold,
+		LocalEndpointReadHeaderTimeout:      DefaultLocalEndpointReadHeaderTimeout,
+		TaskMetadataTagsCacheTTL:            DefaultTaskMetadataTagsCacheTTL,
+		LocalEndpointMaxHeaderBytes:         DefaultLocalEndpointMaxHeaderBytes,
+		LocalEndpointMaxRequestBodyBytes:    DefaultLocalEndpointMaxRequestBodyBytes,
+		LocalEndpointLogLevelHeaderEnabled:  BooleanDefaultFalse{Value: NotSet},
+		LocalEndpointTraceContextEnabled:    BooleanDefaultFalse{Value: NotSet},
+		LocalEndpointPathNormalization:      BooleanDefaultFalse{Value: NotSet},
+		LocalEndpointForwardedPrefixEnabled: BooleanDefaultFalse{Value: NotSet},
+		TaskEventsHeartbeatInterval:         DefaultTaskEventsHeartbeatInterval,
 		SharedVolumeMatchFullConfig:         BooleanDefaultFalse{Value: ExplicitlyDisabled}, //only requiring shared volumes to match on name, which is default docker behavior
 		PollMetrics:                         BooleanDefaultFalse{Value: NotSet},
 		PollingMetricsWaitDuration:          DefaultPollingMetricsWaitDuration,
+		ContainerStatsStalenessThreshold:    DefaultContainerStatsStalenessThreshold,
 		GMSACapable:                         BooleanDefaultFalse{Value: ExplicitlyDisabled},
 		GMSADomainlessCapable:               BooleanDefaultFalse{Value: ExplicitlyDisabled},
 		FSxWindowsFileServerCapable:         BooleanDefaultFalse{Value: ExplicitlyDisabled},
@@ -151,6 +176,22 @@ func DefaultConfig() Config {
 		CNIPluginsPath:                      filepath.Join(ecsBinaryDir, defaultCNIPluginDirName),
 		RuntimeStatsLogFile:                 filepath.Join(ecsRoot, defaultRuntimeStatsLogFile),
 		EnableRuntimeStats:                  BooleanDefaultFalse{Value: NotSet},
+		CredentialsEMFMetricsEnabled:        BooleanDefaultFalse{Value: NotSet},
+		CredentialsRequireRunningTask:       BooleanDefaultFalse{Value: NotSet},
+		CredentialsPartitionCheckEnabled:    BooleanDefaultFalse{Value: NotSet},
+		CredentialsChecksumTrailerEnabled:   BooleanDefaultFalse{Value: NotSet},
+		CredentialsSTSValidationEnabled:     BooleanDefaultFalse{Value: NotSet},
+		CredentialsHeaderGuardEnabled:       BooleanDefaultFalse{Value: NotSet},
+		CredentialsV1EndpointDisabled:       BooleanDefaultFalse{Value: NotSet},
+		CredentialsResponseSigningEnabled:   BooleanDefaultFalse{Value: NotSet},
+		CredentialsIDListingEnabled:         BooleanDefaultFalse{Value: NotSet},
+		CredentialsSnapshotExportEnabled:    BooleanDefaultFalse{Value: NotSet},
+		LocalTaskLaunchEnabled:              BooleanDefaultFalse{Value: NotSet},
+		ImageLazyLoadingEnabled:             BooleanDefaultFalse{Value: NotSet},
+		CredentialsMaxEntries:               DefaultCredentialsMaxEntries,
+		TaskMetadataFirewallEnabled:         BooleanDefaultFalse{Value: NotSet},
+		TaskMetadataFirewallStrict:          BooleanDefaultFalse{Value: NotSet},
+		FirelensDryRunEnabled:               BooleanDefaultFalse{Value: NotSet},
 		ShouldExcludeIPv6PortBinding:        BooleanDefaultTrue{Value: ExplicitlyEnabled},
 	}
 }
@@ -24,6 +24,7 @@ import (
 
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
 
 	"github.com/cihub/seelog"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
@@ -173,6 +174,93 @@ func parseNumImagesToDeletePerCycle() int {
 	return numImagesToDeletePerCycle
 }
 
+func parseDockerCircuitBreakerThreshold() int {
+	thresholdEnvVal := os.Getenv("ECS_DOCKER_CIRCUIT_BREAKER_THRESHOLD")
+	threshold, err := strconv.Atoi(thresholdEnvVal)
+	if thresholdEnvVal != "" && err != nil {
+		seelog.Warnf("Invalid format for \"ECS_DOCKER_CIRCUIT_BREAKER_THRESHOLD\", expected an integer. err %v", err)
+	}
+	return threshold
+}
+
+func parseStateReconcileConcurrency() int {
+	concurrencyEnvVal := os.Getenv("ECS_STATE_RECONCILE_CONCURRENCY")
+	concurrency, err := strconv.Atoi(concurrencyEnvVal)
+	if concurrencyEnvVal != "" && err != nil {
+		seelog.Warnf("Invalid format for \"ECS_STATE_RECONCILE_CONCURRENCY\", expected an integer. err %v", err)
+	}
+	return concurrency
+}
+
+func parseImagePrefetchConcurrency() int {
+	concurrencyEnvVal := os.Getenv("ECS_IMAGE_PREFETCH_CONCURRENCY")
+	concurrency, err := strconv.Atoi(concurrencyEnvVal)
+	if concurrencyEnvVal != "" && err != nil {
+		seelog.Warnf("Invalid format for \"ECS_IMAGE_PREFETCH_CONCURRENCY\", expected an integer. err %v", err)
+	}
+	return concurrency
+}
+
+// parseImagePrefetchList parses the prefetch list, either a JSON list of images with their
+// registry auth or a comma separated list of image references.
+func parseImagePrefetchList() []ImagePrefetch {
+	prefetchEnvVal := strings.TrimSpace(os.Getenv("ECS_IMAGE_PREFETCH_LIST"))
+	if prefetchEnvVal == "" {
+		return nil
+	}
+	var prefetchList []ImagePrefetch
+	if strings.HasPrefix(prefetchEnvVal, "[") {
+		if err := json.Unmarshal([]byte(prefetchEnvVal), &prefetchList); err != nil {
+			seelog.Warnf("Invalid format for \"ECS_IMAGE_PREFETCH_LIST\", expected a json list of images. error: %v", err)
+			return nil
+		}
+		return prefetchList
+	}
+	for _, image := range strings.Split(prefetchEnvVal, ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			prefetchList = append(prefetchList, ImagePrefetch{Image: image})
+		}
+	}
+	return prefetchList
+}
+
+// parseCredentialsFaultInjection parses the JSON object of credentials IDs to the faults
+// injected into their responses. Delays are durations such as "500ms".
+func parseCredentialsFaultInjection() map[string]CredentialsFault {
+	faultsEnvVal := strings.TrimSpace(os.Getenv("ECS_UNSAFE_CREDENTIALS_FAULT_INJECTION"))
+	if faultsEnvVal == "" {
+		return nil
+	}
+	var parsedFaults map[string]struct {
+		Type  string
+		Delay string
+	}
+	if err := json.Unmarshal([]byte(faultsEnvVal), &parsedFaults); err != nil {
+		seelog.Warnf("Invalid format for \"ECS_UNSAFE_CREDENTIALS_FAULT_INJECTION\", expected a json object of credentials IDs to faults. error: %v", err)
+		return nil
+	}
+	faults := make(map[string]CredentialsFault, len(parsedFaults))
+	for credentialsID, parsedFault := range parsedFaults {
+		switch tmdsv1.FaultType(parsedFault.Type) {
+		case tmdsv1.FaultDelay, tmdsv1.FaultServiceUnavailable, tmdsv1.FaultTruncatedBody:
+		default:
+			seelog.Warnf("Unknown type %q for the credentials fault of %s in \"ECS_UNSAFE_CREDENTIALS_FAULT_INJECTION\", ignoring it", parsedFault.Type, credentialsID)
+			continue
+		}
+		fault := CredentialsFault{Type: parsedFault.Type}
+		if parsedFault.Delay != "" {
+			delay, err := time.ParseDuration(parsedFault.Delay)
+			if err != nil {
+				seelog.Warnf("Invalid delay for the credentials fault of %s in \"ECS_UNSAFE_CREDENTIALS_FAULT_INJECTION\", ignoring it. error: %v", credentialsID, err)
+				continue
+			}
+			fault.Delay = delay
+		}
+		faults[credentialsID] = fault
+	}
+	return faults
+}
+
 func parseNumNonECSContainersToDeletePerCycle() int {
 	numNonEcsContainersToDeletePerCycleEnvVal := os.Getenv("NONECS_NUM_CONTAINERS_DELETE_PER_CYCLE")
 	numNonEcsContainersToDeletePerCycle, err := strconv.Atoi(numNonEcsContainersToDeletePerCycleEnvVal)
@@ -273,25 +361,34 @@ func parseBooleanDefaultTrueConfig(envVarName string) BooleanDefaultTrue {
 }
 
 func parseTaskMetadataThrottles() (int, int) {
+	return parseRPSLimit("ECS_TASK_METADATA_RPS_LIMIT")
+}
+
+func parseCredentialsThrottles() (int, int) {
+	return parseRPSLimit("ECS_CREDENTIALS_RPS_LIMIT")
+}
+
+// parseRPSLimit parses a request rate limit of the "rateLimit,burst" format.
+func parseRPSLimit(envVar string) (int, int) {
 	var steadyStateRate, burstRate int
-	rpsLimitEnvVal := os.Getenv("ECS_TASK_METADATA_RPS_LIMIT")
+	rpsLimitEnvVal := os.Getenv(envVar)
 	if rpsLimitEnvVal == "" {
-		seelog.Debug("Environment variable empty: ECS_TASK_METADATA_RPS_LIMIT")
+		seelog.Debugf("Environment variable empty: %s", envVar)
 		return 0, 0
 	}
 	rpsLimitSplits := strings.Split(rpsLimitEnvVal, ",")
 	if len(rpsLimitSplits) != 2 {
-		seelog.Warn(`Invalid format for "ECS_TASK_METADATA_RPS_LIMIT", expected: "rateLimit,burst"`)
+		seelog.Warnf(`Invalid format for "%s", expected: "rateLimit,burst"`, envVar)
 		return 0, 0
 	}
 	steadyStateRate, err := strconv.Atoi(strings.TrimSpace(rpsLimitSplits[0]))
 	if err != nil {
-		seelog.Warnf(`Invalid format for "ECS_TASK_METADATA_RPS_LIMIT", expected integer for steady state rate: %v`, err)
+		seelog.Warnf(`Invalid format for "%s", expected integer for steady state rate: %v`, envVar, err)
 		return 0, 0
 	}
 	burstRate, err = strconv.Atoi(strings.TrimSpace(rpsLimitSplits[1]))
 	if err != nil {
-		seelog.Warnf(`Invalid format for "ECS_TASK_METADATA_RPS_LIMIT", expected integer for burst rate: %v`, err)
+		seelog.Warnf(`Invalid format for "%s", expected integer for burst rate: %v`, envVar, err)
 		return 0, 0
 	}
 	return steadyStateRate, burstRate
@@ -318,6 +415,20 @@ func parseContainerInstanceTags(errs []error) (map[string]string, []error) {
 	return containerInstanceTags, errs
 }
 
+func parseAWSEndpointOverrides(errs []error) (map[string]string, []error) {
+	var overrides map[string]string
+	overridesEnv := os.Getenv("ECS_AWS_ENDPOINT_OVERRIDES")
+	if overridesEnv == "" {
+		return overrides, errs
+	}
+	if err := json.Unmarshal([]byte(overridesEnv), &overrides); err != nil {
+		wrappedErr := fmt.Errorf("Invalid format for ECS_AWS_ENDPOINT_OVERRIDES. Expected a json hash: %v", err)
+		seelog.Error(wrappedErr)
+		errs = append(errs, wrappedErr)
+	}
+	return overrides, errs
+}
+
 func parseContainerInstancePropagateTagsFrom() ContainerInstancePropagateTagsFromType {
 	containerInstancePropagateTagsFromString := os.Getenv("ECS_CONTAINER_INSTANCE_PROPAGATE_TAGS_FROM")
 	switch containerInstancePropagateTagsFromString {
@@ -344,6 +455,19 @@ func parseEnvVariableUint16(envVar string) uint16 {
 	return var16
 }
 
+func parseEnvVariableInt64(envVar string) int64 {
+	envVal := os.Getenv(envVar)
+	var var64 int64
+	if envVal != "" {
+		var err error
+		var64, err = strconv.ParseInt(envVal, 10, 64)
+		if err != nil {
+			seelog.Warnf("Invalid format for \""+envVar+"\" environment variable; expected integer. err %v", err)
+		}
+	}
+	return var64
+}
+
 func parseEnvVariableDuration(envVar string) time.Duration {
 	var duration time.Duration
 	envVal := os.Getenv(envVar)
@@ -372,6 +496,17 @@ func parseImageCleanupExclusionList(envVar string) []string {
 	return imageCleanupExclusionList
 }
 
+// parseCommaSeparatedList parses a comma separated list, leaving out empty items.
+func parseCommaSeparatedList(envVar string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(envVar), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func parseCgroupCPUPeriod() time.Duration {
 	duration := parseEnvVariableDuration("ECS_CGROUP_CPU_PERIOD")
 
@@ -29,6 +29,26 @@ type ImagePullBehaviorType int8
 // ways to propagate tags, it includes none (default) and ec2_instance.
 type ContainerInstancePropagateTagsFromType int8
 
+// ImagePrefetch is an image that is pulled when the agent starts, before any task needs it.
+type ImagePrefetch struct {
+	// Image is the reference of the image.
+	Image string
+	// ECRRegion and ECRRegistryID are set for images in ECR, which are pulled with the
+	// credentials of the instance as there is no execution role to pull them with. Other
+	// images are pulled with the engine auth data, if there is any.
+	ECRRegion     string `json:",omitempty"`
+	ECRRegistryID string `json:",omitempty"`
+}
+
+// CredentialsFault is a fault injected into the credentials responses of a credentials ID,
+// to validate the resilience of clients in test environments.
+type CredentialsFault struct {
+	// Type is the type of fault: "Delay", "ServiceUnavailable" or "TruncatedBody".
+	Type string
+	// Delay is how long responses are delayed by "Delay" faults.
+	Delay time.Duration
+}
+
 type Config struct {
 	// DEPRECATED
 	// ClusterArn is the Name or full ARN of a Cluster to register into. It has
@@ -43,6 +63,16 @@ type Config struct {
 	// make calls against. If this value is not set, it will default to the
 	// endpoint for your current AWSRegion
 	APIEndpoint string `trim:"true"`
+	// AWSEndpointMode is how the endpoints of the ECS, ECR, SSM and Secrets Manager clients
+	// are resolved: "standard", which is the default, "fips" or "dualstack". It can be set
+	// by means of the ECS_AWS_ENDPOINT_MODE environment variable.
+	AWSEndpointMode string `trim:"true"`
+	// AWSEndpointOverrides maps the services "ecs", "ecr", "ssm" and "secretsmanager" to the
+	// URLs of the endpoints that their clients are pointed at regardless of AWSEndpointMode,
+	// such as the DNS names of interface VPC endpoints. APIEndpoint takes precedence for ECS.
+	// It can be set by means of the ECS_AWS_ENDPOINT_OVERRIDES environment variable, as a
+	// JSON object.
+	AWSEndpointOverrides map[string]string
 	// DockerEndpoint is the address the agent will attempt to connect to the
 	// Docker daemon at. This should have the same value as "DOCKER_HOST"
 	// normally would to interact with the daemon. It defaults to
@@ -67,6 +97,14 @@ type Config struct {
 	// DataDirOnHost is the directory in the instance from which we mount
 	// DataDir to the ecs-agent container and to agent managed containers
 	DataDirOnHost string
+
+	// StateEnvironmentScrubPatterns are the patterns of the names of the environment
+	// variables of containers whose values are redacted in the state saved to DataDir,
+	// once the containers are created. Patterns are matched case-insensitively, with the
+	// wildcards of path.Match. By default, names containing KEY, SECRET, TOKEN or PASSWORD
+	// are matched, which can be overridden with a comma-separated list of patterns by
+	// means of the ECS_STATE_ENV_SCRUB_PATTERNS environment variable.
+	StateEnvironmentScrubPatterns []string
 	// Checkpoint configures whether data should be periodically to a checkpoint
 	// file, in DataDir, such that on instance or agent restarts it will resume
 	// as the same ContainerInstance. It defaults to false.
@@ -99,6 +137,12 @@ type Config struct {
 	// again when PollMetrics is set to true
 	PollingMetricsWaitDuration time.Duration
 
+	// ContainerStatsStalenessThreshold is the age beyond which the latest stats of a container
+	// are no longer served by the stats endpoints, for example because the stats stream of the
+	// container broke and is being re-established. It can be set by means of the
+	// ECS_CONTAINER_STATS_STALENESS_THRESHOLD environment variable.
+	ContainerStatsStalenessThreshold time.Duration
+
 	// DisableDockerHealthCheck configures whether container health feature was enabled
 	// on the instance
 	DisableDockerHealthCheck BooleanDefaultFalse
@@ -125,6 +169,46 @@ type Config struct {
 	// ImagePullInactivityTimeout is here to override the amount of time to wait when pulling and extracting a container
 	ImagePullInactivityTimeout time.Duration
 
+	// ImagePullProgressLogInterval is the interval at which the progress of image pulls
+	// is logged. Pull progress is not logged if it is not positive.
+	ImagePullProgressLogInterval time.Duration
+
+	// DockerCircuitBreakerThreshold is the number of consecutive connection failures to
+	// the docker daemon after which calls to it are short-circuited for
+	// DockerCircuitBreakerCoolDown. The circuit breaker is disabled if it is negative.
+	DockerCircuitBreakerThreshold int
+
+	// DockerCircuitBreakerCoolDown is the amount of time for which calls to the docker
+	// daemon are short-circuited once the circuit breaker opens.
+	DockerCircuitBreakerCoolDown time.Duration
+
+	// ClockDriftThreshold is the estimated host clock skew above which a warning is
+	// logged, since credentials signed with a skewed clock are rejected.
+	ClockDriftThreshold time.Duration
+
+	// ClockDriftCheckInterval is the minimum amount of time between two checks of the
+	// host clock skew.
+	ClockDriftCheckInterval time.Duration
+
+	// ClockDriftNTPServer is the NTP server that the host clock skew is checked against.
+	// The skew is estimated from the Date header of ECS API responses if it is not set.
+	ClockDriftNTPServer string
+
+	// StopLastTaskFamilies are the families of tasks, such as daemon tasks that observe
+	// the other tasks, that are stopped after all other tasks while the instance is
+	// drained. Their stops are held back until the other tasks are stopped or
+	// DrainStopLastTimeout has passed.
+	StopLastTaskFamilies []string
+
+	// DrainStopLastTimeout is the maximum amount of time the stops of tasks of the
+	// stop-last families are held back for once the instance is drained.
+	DrainStopLastTimeout time.Duration
+
+	// StateReconcileConcurrency is the number of containers restored from the saved state
+	// that are reconciled with docker at the same time when the agent starts. The
+	// containers of a task are always reconciled one after the other.
+	StateReconcileConcurrency int
+
 	//ImagePullTimeout is here to override the timeout for PullImage API
 	ImagePullTimeout time.Duration
 
@@ -170,6 +254,23 @@ type Config struct {
 	// CredentialsAuditLogEnabled specifies whether audit logging is disabled.
 	CredentialsAuditLogDisabled bool
 
+	// CredentialsAuditLogSyslog specifies the syslog that the audit log is sent to instead
+	// of the audit log file, either "local" or a URL such as udp://host:514. The audit log
+	// file is used while syslog is unavailable.
+	CredentialsAuditLogSyslog string
+
+	// CredentialsAuditLogSyslogFacility and CredentialsAuditLogSyslogSeverity specify the
+	// syslog facility and severity of the audit log, auth and info by default.
+	CredentialsAuditLogSyslogFacility string
+	CredentialsAuditLogSyslogSeverity string
+
+	// CredentialsAuditLogDedupWindow is the window within which the duplicate success entries
+	// of an ARN, such as the entries of clients polling for credentials, are suppressed. A
+	// heartbeat entry is still logged periodically for ARNs whose entries are suppressed. By
+	// default, entries aren't suppressed, which can be overridden by means of the
+	// ECS_AUDIT_LOG_DEDUP_WINDOW environment variable.
+	CredentialsAuditLogDedupWindow time.Duration
+
 	// TaskIAMRoleEnabledForNetworkHost specifies if the Agent is capable of launching
 	// tasks with IAM Roles when networkMode is set to 'host'
 	TaskIAMRoleEnabledForNetworkHost bool
@@ -259,10 +360,139 @@ type Config struct {
 	// file for containers.
 	ContainerMetadataEnabled BooleanDefaultFalse
 
+	// ContainerMetadataFileSchema is the schema version of the metadata file for
+	// containers. Version "1", which is the default, is the original schema. Version "2"
+	// adds the image digest, the cpu and memory limits of the container and its task, and
+	// the ports and IP addresses of containers of awsvpc tasks. It can be set by means of
+	// the ECS_CONTAINER_METADATA_FILE_SCHEMA environment variable.
+	ContainerMetadataFileSchema string
+
+	// ContainerOutputCaptureEnabled specifies if the agent captures the output of
+	// containers whose log driver is 'none' to files in the data directory, which are
+	// removed when their task is cleaned up. By default, this configuration is set to
+	// false, and can be overridden by means of the
+	// ECS_ENABLE_CONTAINER_OUTPUT_CAPTURE environment variable.
+	ContainerOutputCaptureEnabled BooleanDefaultFalse
+
+	// ContainerOutputCaptureMaxFileBytes is the size at which the file that the output of
+	// a container is captured to is rotated. One rotated file is kept, so that at most
+	// twice this size is kept per container. It can be set by means of the
+	// ECS_CONTAINER_OUTPUT_CAPTURE_MAX_FILE_BYTES environment variable.
+	ContainerOutputCaptureMaxFileBytes int64
+
 	// OverrideAWSLogsExecutionRole is config option used to enable awslogs
 	// driver authentication over the task's execution role
 	OverrideAWSLogsExecutionRole BooleanDefaultFalse
 
+	// AWSLogsNonBlockingDefault specifies whether the agent sets mode=non-blocking in
+	// the log configuration of containers using the awslogs log driver that don't
+	// specify a mode
+	AWSLogsNonBlockingDefault BooleanDefaultFalse
+
+	// AWSLogsDefaultMaxBufferSize is the max-buffer-size set along with mode=non-blocking
+	// when AWSLogsNonBlockingDefault is enabled and the container doesn't specify one
+	AWSLogsDefaultMaxBufferSize string
+
+	// LocalEndpointSlowRequestThreshold is the duration above which requests to the task
+	// metadata and introspection endpoints are logged as slow. Slow request logging is
+	// disabled if it is negative.
+	LocalEndpointSlowRequestThreshold time.Duration
+
+	// LocalEndpointReadHeaderTimeout is the maximum duration for reading the headers of
+	// requests to the task metadata and introspection endpoints. Connections of clients
+	// that send headers slower than that are closed.
+	LocalEndpointReadHeaderTimeout time.Duration
+
+	// TaskMetadataTagsCacheTTL is how long the task and container instance tags retrieved
+	// from ECS for the v4 task metadata endpoint are served before they are retrieved
+	// again. Cached tags are served past it when they can't be retrieved again.
+	TaskMetadataTagsCacheTTL time.Duration
+
+	// LocalEndpointMaxHeaderBytes is the maximum size of the headers of requests to the task
+	// metadata and introspection endpoints. Requests with larger headers are rejected with
+	// a 431.
+	LocalEndpointMaxHeaderBytes int
+
+	// LocalEndpointMaxRequestBodyBytes is the maximum size of the bodies of requests to the
+	// task metadata endpoint. Requests with larger bodies are rejected with a 413.
+	LocalEndpointMaxRequestBodyBytes int64
+
+	// LocalEndpointLogLevelHeaderEnabled specifies if the X-Amzn-Log-Level header of requests
+	// to the task metadata and introspection endpoints is honored, raising the log level to
+	// debug for the requests that set it to debug. By default, this configuration is set to
+	// false and can be overridden by means of the ECS_LOCAL_ENDPOINT_LOG_LEVEL_HEADER_ENABLED
+	// environment variable.
+	LocalEndpointLogLevelHeaderEnabled BooleanDefaultFalse
+
+	// LocalEndpointTraceContextEnabled specifies if the W3C Trace Context traceparent header
+	// of requests to the task metadata endpoint is honored, so that the trace and span ids of
+	// the requests are written to the credentials audit log. By default, this configuration
+	// is set to false and can be overridden by means of the
+	// ECS_LOCAL_ENDPOINT_TRACE_CONTEXT_ENABLED environment variable.
+	LocalEndpointTraceContextEnabled BooleanDefaultFalse
+
+	// LocalEndpointPathNormalization specifies if requests to the task metadata
+	// endpoint for paths with a trailing slash or in a different case, such as
+	// '/V2/Metadata/', are served as requests for the paths of the endpoint. By default,
+	// this configuration is set to false, so that paths are matched strictly, and can be
+	// overridden by means of the ECS_LOCAL_ENDPOINT_PATH_NORMALIZATION environment
+	// variable.
+	LocalEndpointPathNormalization BooleanDefaultFalse
+
+	// LocalEndpointForwardedPrefixEnabled specifies if the X-Forwarded-Prefix header of
+	// requests to the task metadata endpoint is honored, so that the endpoint can be served
+	// behind a reverse proxy that forwards requests under a prefix, such as
+	// '/ecs/v2/credentials/id' for '/v2/credentials/id'. By default, this configuration is
+	// set to false, and can be overridden by means of the
+	// ECS_LOCAL_ENDPOINT_FORWARDED_PREFIX_ENABLED environment variable.
+	LocalEndpointForwardedPrefixEnabled BooleanDefaultFalse
+
+	// CredentialsAuditDigestWindow is the window of the digest of the credentials fetches
+	// of each task that the introspection server serves at /v1/credentials/audit/digest, for
+	// auditors to ingest. The counts are reset at the start of each window. The digest is
+	// disabled by default, which can be overridden by means of the
+	// ECS_CREDENTIALS_AUDIT_DIGEST_WINDOW environment variable.
+	CredentialsAuditDigestWindow time.Duration
+
+	// TaskEventsHeartbeatInterval is how often heartbeats are sent to the clients of the
+	// task state transition events endpoint of the introspection server, so that they can
+	// tell an idle stream from a broken one. It can be set by means of the
+	// ECS_INTROSPECTION_EVENTS_HEARTBEAT_INTERVAL environment variable.
+	TaskEventsHeartbeatInterval time.Duration
+
+	// LocalEndpointResponseJitter is the maximum random delay of responses of the task
+	// metadata endpoint, so that clients polling in lockstep drift apart over time. It is
+	// capped at one second. By default, responses are not delayed, which can be overridden
+	// by means of the ECS_LOCAL_ENDPOINT_RESPONSE_JITTER environment variable.
+	LocalEndpointResponseJitter time.Duration
+
+	// CredentialsNotFoundRetryAfter is the backoff advised to clients in the Retry-After
+	// header of the response to requests for credentials that aren't found, so that tasks
+	// polling for credentials that haven't been delivered yet don't retry immediately. By
+	// default, the header is omitted, which can be overridden by means of the
+	// ECS_CREDENTIALS_NOT_FOUND_RETRY_AFTER environment variable.
+	CredentialsNotFoundRetryAfter time.Duration
+
+	// CredentialsPreExpiryRefreshMargin enables the refresh of cached credentials responses
+	// in the background, so that requests aren't served from a cold cache once credentials
+	// are replaced. Credentials that aren't replaced by the margin before they expire are
+	// warned about. By default, responses aren't refreshed, which can be overridden by means
+	// of the ECS_CREDENTIALS_PRE_EXPIRY_REFRESH_MARGIN environment variable.
+	CredentialsPreExpiryRefreshMargin time.Duration
+
+	// CredentialsExpectedLocalPort is the local port that credentials requests must be
+	// received on, so that credentials aren't served if the credentials handlers end up
+	// mounted on another listener. Requests received on other ports are rejected. By
+	// default, the local port isn't checked, which can be overridden by means of the
+	// ECS_CREDENTIALS_EXPECTED_LOCAL_PORT environment variable.
+	CredentialsExpectedLocalPort uint16
+
+	// CredentialsRefreshAfterMargin is how long before credentials expire the RefreshAfter
+	// field of credentials responses advises clients to refresh them. By default, the margin
+	// of the credentials handlers is used, which can be overridden by means of the
+	// ECS_CREDENTIALS_REFRESH_AFTER_MARGIN environment variable.
+	CredentialsRefreshAfterMargin time.Duration
+
 	// CgroupPath is the path expected by the agent, defaults to
 	// '/sys/fs/cgroup'
 	CgroupPath string
@@ -276,6 +506,50 @@ type Config struct {
 	// TaskMetadataBurstRate specifies the burst rate throttle for the task metadata endpoint
 	TaskMetadataBurstRate int
 
+	// TaskMetadataSessionTokenMode is whether requests to the task metadata endpoints must
+	// carry IMDSv2-like session tokens, which clients are issued by PUT requests to
+	// /api/token. Session tokens are scoped to the task and the IP of the container that
+	// requested them, or only to the IP for containers sharing the network of the host.
+	// In "optional" mode, which is the default, requests without session tokens are
+	// served, and in "required" mode they are rejected. It can be set by means of the
+	// ECS_TASK_METADATA_SESSION_TOKENS environment variable.
+	TaskMetadataSessionTokenMode string
+
+	// CredentialsSteadyStateRate and CredentialsBurstRate specify the throttle for
+	// credentials requests. Credentials requests aren't throttled if they are zero, which
+	// is the default. They can be set by means of the ECS_CREDENTIALS_RPS_LIMIT environment
+	// variable, and are reloaded when the agent receives a SIGHUP.
+	CredentialsSteadyStateRate int
+	CredentialsBurstRate       int
+
+	// CredentialsAllowedRoleTypes are the role types, TaskApplication and TaskExecution,
+	// that credentials are served for. Credentials of all role types are served if it's
+	// empty, which is the default. It can be set by means of the
+	// ECS_CREDENTIALS_ALLOWED_ROLE_TYPES environment variable, and is reloaded when the
+	// agent receives a SIGHUP.
+	CredentialsAllowedRoleTypes []string
+
+	// CredentialsRequestLogLevel is the level, info or debug, that credentials requests are
+	// logged at. It defaults to info and can be set by means of the
+	// ECS_CREDENTIALS_REQUEST_LOG_LEVEL environment variable, and is reloaded when the
+	// agent receives a SIGHUP.
+	CredentialsRequestLogLevel string
+
+	// CredentialsResponseSchemaValidation is what is done with credentials responses that
+	// don't match the credentials response schema: "log" logs them, and "enforce" logs them
+	// and responds with an internal server error instead. Responses aren't validated by
+	// default, validation is meant for test and canary environments. It can be set by means
+	// of the ECS_CREDENTIALS_RESPONSE_SCHEMA_VALIDATION environment variable.
+	CredentialsResponseSchemaValidation string
+
+	// CredentialsFaultInjection are the faults injected into the credentials responses of
+	// credentials IDs. UNSAFE: it is meant for validating client resilience in test
+	// environments only and must never be set in production. No faults are injected by
+	// default. It can be set by means of the ECS_UNSAFE_CREDENTIALS_FAULT_INJECTION
+	// environment variable, as a JSON object of credentials IDs to faults such as
+	// {"<id>": {"Type": "Delay", "Delay": "500ms"}}.
+	CredentialsFaultInjection map[string]CredentialsFault
+
 	// SharedVolumeMatchFullConfig is config option used to short-circuit volume validation against a
 	// provisioned volume, if false (default). If true, we perform deep comparison including driver options
 	// and labels. For comparing shared volume across 2 instances, this should be set to false as docker's
@@ -307,9 +581,41 @@ type Config struct {
 	// ImageCleanupExclusionList is the list of image names customers want to keep for their own use and delete automatically
 	ImageCleanupExclusionList []string
 
+	// ImagePrefetchList are the images that are pulled when the agent starts, to have them
+	// cached by the time tasks need them. It can be set by means of the
+	// ECS_IMAGE_PREFETCH_LIST environment variable, as a JSON list of ImagePrefetch or a
+	// comma separated list of image references.
+	ImagePrefetchList []ImagePrefetch
+
+	// ImagePrefetchConcurrency is the number of images of the prefetch list that are pulled
+	// at the same time. Prefetch pulls only run while no task pulls are in flight.
+	ImagePrefetchConcurrency int
+
+	// ImageLazyLoadingEnabled specifies if the manifests of the images to pull are inspected for
+	// a companion that the snapshotter of the daemon can lazily load them with, when the daemon
+	// stores images with the SOCI or stargz snapshotter. How each container image was pulled
+	// is then reported in the v4 task metadata.
+	// By default, this configuration is set to false and can be overridden by means of the
+	// ECS_ENABLE_IMAGE_LAZY_LOADING environment variable.
+	ImageLazyLoadingEnabled BooleanDefaultFalse
+
+	// ImagePrefetchRetention is how long prefetched images are kept from cleanup after they
+	// were last used, or prefetched if they haven't been used.
+	ImagePrefetchRetention time.Duration
+
 	// NvidiaRuntime is the runtime to be used for passing Nvidia GPU devices to containers
 	NvidiaRuntime string `trim:"true"`
 
+	// GPUMinDriverVersion is the minimum NVIDIA driver version that the GPU runtime of the
+	// host requires, such as 545. GPU tasks are stopped without being started while the
+	// driver is older. It can be set by means of the ECS_NVIDIA_MIN_DRIVER_VERSION
+	// environment variable, by default the driver version is not checked.
+	GPUMinDriverVersion string `trim:"true"`
+
+	// GPURuntimeProbeInterval is how often the GPU runtime of the host is probed, when GPU
+	// support is enabled.
+	GPURuntimeProbeInterval time.Duration
+
 	// TaskMetadataAZDisabled specifies if availability zone should be disabled in Task Metadata endpoint
 	TaskMetadataAZDisabled bool
 
@@ -357,6 +663,129 @@ type Config struct {
 	// is set to false and can be overridden by means of the ECS_ENABLE_RUNTIME_STATS environment variable.
 	EnableRuntimeStats BooleanDefaultFalse
 
+	// CredentialsEMFMetricsEnabled specifies if a CloudWatch embedded metric format log line
+	// is written to stdout for every credentials request. By default, this configuration is
+	// set to false and can be overridden by means of the ECS_ENABLE_CREDENTIALS_EMF_METRICS
+	// environment variable.
+	CredentialsEMFMetricsEnabled BooleanDefaultFalse
+
+	// CredentialsStatsDEndpoint is the UDP address, as host:port, of a StatsD server that
+	// the count, latency and errors of credentials requests are sent to. Metrics aren't sent
+	// to StatsD if it's empty, which is the default. It can be set by means of the
+	// ECS_CREDENTIALS_STATSD_ENDPOINT environment variable.
+	CredentialsStatsDEndpoint string
+
+	// CredentialsRequireRunningTask specifies if credentials are only served for tasks that
+	// are not stopping or stopped. By default, this configuration is set to false and can be
+	// overridden by means of the ECS_CREDENTIALS_REQUIRE_RUNNING_TASK environment variable.
+	CredentialsRequireRunningTask BooleanDefaultFalse
+
+	// CredentialsPartitionCheckEnabled specifies if credentials are only served if their role
+	// is in the AWS partition of their task, as given by the partition segment of the task
+	// ARN. By default, this configuration is set to false and can be overridden by means of
+	// the ECS_CREDENTIALS_PARTITION_CHECK_ENABLED environment variable.
+	CredentialsPartitionCheckEnabled BooleanDefaultFalse
+
+	// CredentialsChecksumTrailerEnabled specifies if the SHA-256 digest of the body of credentials
+	// responses is sent in the X-Amzn-Checksum trailer of the chunked response, for streaming
+	// clients to verify the body once it's read. By default, this configuration is set to false
+	// and can be overridden by means of the ECS_CREDENTIALS_CHECKSUM_TRAILER_ENABLED environment
+	// variable.
+	CredentialsChecksumTrailerEnabled BooleanDefaultFalse
+
+	// CredentialsSTSValidationEnabled specifies if credentials are validated by calling STS
+	// GetCallerIdentity with them before they are served, responding with a 503 instead of
+	// credentials that fail validation. Results are cached, so that STS isn't called for
+	// every request. As validating credentials calls out of the instance, this configuration
+	// is set to false by default and can be overridden by means of the
+	// ECS_CREDENTIALS_STS_VALIDATION_ENABLED environment variable.
+	CredentialsSTSValidationEnabled BooleanDefaultFalse
+
+	// CredentialsHeaderGuardEnabled specifies if credentials requests with headers that are
+	// indicative of server-side request forgery or proxy abuse, such as an X-Forwarded-Host
+	// that doesn't match the host of the request, are rejected with a 403. The heuristics
+	// that flag requests are given by CredentialsHeaderGuardHeuristics. As requests of
+	// clients that go through proxies can be flagged, this configuration is set to false by
+	// default and can be overridden by means of the
+	// ECS_CREDENTIALS_SUSPICIOUS_HEADER_GUARD_ENABLED environment variable.
+	CredentialsHeaderGuardEnabled BooleanDefaultFalse
+
+	// CredentialsHeaderGuardHeuristics are the names of the heuristics that flag credentials
+	// requests if CredentialsHeaderGuardEnabled is set: forwarded-host-mismatch,
+	// proxy-headers and url-override. All the heuristics are used if empty, which is the
+	// default. It can be set by means of the ECS_CREDENTIALS_SUSPICIOUS_HEADER_HEURISTICS
+	// environment variable, as a comma separated list.
+	CredentialsHeaderGuardHeuristics []string
+
+	// CredentialsV1EndpointDisabled specifies if the v1 credentials endpoint is disabled, so
+	// that only the v2 credentials endpoint injected into containers with the
+	// AWS_CONTAINER_CREDENTIALS_RELATIVE_URI environment variable serves credentials. By
+	// default, this configuration is set to false and can be overridden by means of the
+	// ECS_DISABLE_V1_CREDENTIALS_ENDPOINT environment variable.
+	CredentialsV1EndpointDisabled BooleanDefaultFalse
+
+	// CredentialsSigningKeyFile is the path to a file containing the base64 encoded
+	// pre-shared key that credentials responses are signed with, in the X-Amzn-Signature
+	// response header. Responses are unsigned if it's empty, which is the default. It can be
+	// set by means of the ECS_CREDENTIALS_SIGNING_KEY_FILE environment variable.
+	CredentialsSigningKeyFile string
+
+	// CredentialsResponseSigningEnabled specifies if credentials responses are signed with an
+	// Ed25519 key pair generated when the agent starts, in the X-Amzn-Credentials-Signature
+	// response header. Only the public key is served, at /v1/credentials-signing-key of the
+	// task metadata server. Responses are signed with the pre-shared key instead if
+	// CredentialsSigningKeyFile is set. By default, this configuration is set to false and
+	// can be overridden by means of the ECS_CREDENTIALS_RESPONSE_SIGNING_ENABLED environment
+	// variable.
+	CredentialsResponseSigningEnabled BooleanDefaultFalse
+
+	// CredentialsIDListingEnabled specifies if the fingerprints of the ids of the
+	// credentials held by the agent are listed by the introspection server, with the ARNs of
+	// their tasks and their expirations, for diagnostics. By default, this configuration is
+	// set to false and can be overridden by means of the ECS_ENABLE_CREDENTIALS_ID_LISTING
+	// environment variable.
+	CredentialsIDListingEnabled BooleanDefaultFalse
+
+	// CredentialsSnapshotExportEnabled specifies if snapshots of the metadata of the
+	// credentials held by the agent can be exported to files under the data directory by
+	// means of the introspection server, for incident response. Snapshots never contain
+	// secrets nor credentials ids. By default, this configuration is set to false and can
+	// be overridden by means of the ECS_ENABLE_CREDENTIALS_SNAPSHOT_EXPORT environment
+	// variable.
+	CredentialsSnapshotExportEnabled BooleanDefaultFalse
+
+	// LocalTaskLaunchEnabled specifies if tasks can be launched and stopped on this host,
+	// without ECS, by means of the introspection server, for single-host development. The
+	// tasks are registered with stub credentials. By default, this configuration is set to
+	// false and can be overridden by means of the ECS_ENABLE_LOCAL_TASK_LAUNCH environment
+	// variable.
+	LocalTaskLaunchEnabled BooleanDefaultFalse
+
+	// CredentialsMaxEntries is the maximum number of credentials held by the agent. Credentials
+	// for new credentials ids are refused beyond it, unless credentials of tasks that the
+	// agent doesn't track anymore can be evicted. The number of credentials is not limited if
+	// it's negative. It can be set by means of the ECS_CREDENTIALS_MAX_ENTRIES environment
+	// variable.
+	CredentialsMaxEntries int
+
+	// TaskMetadataFirewallEnabled specifies if firewall rules are installed for every bridge
+	// mode task so that only the task's containers can reach its v3 and v4 task metadata
+	// endpoints. By default, this configuration is set to false and can be overridden by
+	// means of the ECS_ENABLE_TASK_METADATA_FIREWALL environment variable.
+	TaskMetadataFirewallEnabled BooleanDefaultFalse
+
+	// TaskMetadataFirewallStrict specifies if a task is stopped when its task metadata
+	// firewall rules can't be installed. Otherwise, the failure is recorded as a warning of
+	// the task. By default, this configuration is set to false and can be overridden by
+	// means of the ECS_TASK_METADATA_FIREWALL_STRICT environment variable.
+	TaskMetadataFirewallStrict BooleanDefaultFalse
+
+	// FirelensDryRunEnabled specifies if the introspection server accepts firelens
+	// configurations and returns the fluentd or fluentbit config generated for them, without
+	// starting anything. By default, this configuration is set to false and can be overridden
+	// by means of the ECS_ENABLE_FIRELENS_DRY_RUN environment variable.
+	FirelensDryRunEnabled BooleanDefaultFalse
+
 	// ShouldExcludeIPv6PortBinding specifies whether agent should exclude IPv6 port bindings reported from docker. This configuration
 	// is set to true by default, and can be overridden by the ECS_EXCLUDE_IPV6_PORTBINDING environment variable. This is a workaround
 	// for docker's bug as detailed in https://github.com/aws/amazon-ecs-agent/issues/2870.
@@ -66,6 +66,8 @@ type metadataManager struct {
 	hostPrivateIPv4Address string
 	// hostPublicIPv4Address is the public IPv4 address associated with the EC2 instance
 	hostPublicIPv4Address string
+	// schemaVersion is the schema version of the metadata files
+	schemaVersion string
 }
 
 // NewManager creates a metadataManager for a given DockerTaskEngine settings.
@@ -75,6 +77,7 @@ func NewManager(client DockerMetadataClient, cfg *config.Config) Manager {
 		cluster:       cfg.Cluster,
 		dataDir:       cfg.DataDir,
 		dataDirOnHost: cfg.DataDirOnHost,
+		schemaVersion: cfg.ContainerMetadataFileSchema,
 	}
 }
 
@@ -20,6 +20,7 @@ import (
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 
 	tmdsresponse "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/response"
+	tmdsv2 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v2"
 	"github.com/cihub/seelog"
 	"github.com/docker/docker/api/types"
 	dockercontainer "github.com/docker/docker/api/types/container"
@@ -44,6 +45,8 @@ func (manager *metadataManager) parseMetadataAtContainerCreate(task *apitask.Tas
 		availabilityZone:       manager.availabilityZone,
 		hostPrivateIPv4Address: manager.hostPrivateIPv4Address,
 		hostPublicIPv4Address:  manager.hostPublicIPv4Address,
+		schemaVersion:          manager.schemaVersion,
+		containerMetadata:      manager.parseContainerMetadata(task, containerName),
 	}
 }
 
@@ -53,6 +56,9 @@ func (manager *metadataManager) parseMetadataAtContainerCreate(task *apitask.Tas
 // errors here and handle them at this or the above stage.
 func (manager *metadataManager) parseMetadata(dockerContainer *types.ContainerJSON, task *apitask.Task, containerName string) Metadata {
 	dockerMD := parseDockerContainerMetadata(task.Arn, containerName, dockerContainer)
+	if manager.schemaVersion == MetadataSchemaV2 && task.IsNetworkModeAWSVPC() {
+		dockerMD = parseAWSVPCMetadata(dockerMD, task, containerName)
+	}
 	return Metadata{
 		cluster: manager.cluster,
 		taskMetadata: TaskMetadata{
@@ -67,7 +73,85 @@ func (manager *metadataManager) parseMetadata(dockerContainer *types.ContainerJS
 		availabilityZone:        manager.availabilityZone,
 		hostPrivateIPv4Address:  manager.hostPrivateIPv4Address,
 		hostPublicIPv4Address:   manager.hostPublicIPv4Address,
+		schemaVersion:           manager.schemaVersion,
+		containerMetadata:       manager.parseContainerMetadata(task, containerName),
+	}
+}
+
+// parseContainerMetadata gathers the metadata of the container and its task that is
+// only written in the v2 schema
+func (manager *metadataManager) parseContainerMetadata(task *apitask.Task, containerName string) ContainerMetadata {
+	if manager.schemaVersion != MetadataSchemaV2 {
+		return ContainerMetadata{}
+	}
+	metadata := ContainerMetadata{
+		taskLimits: parseTaskLimits(task),
+	}
+	container, ok := task.ContainerByName(containerName)
+	if !ok {
+		seelog.Warnf("Failed to parse container metadata for task %s container %s: container not found in task", task.Arn, containerName)
+		return metadata
+	}
+	cpu := float64(container.CPU)
+	memory := int64(container.Memory)
+	metadata.imageDigest = container.GetImageDigest()
+	metadata.limits = &tmdsv2.LimitsResponse{
+		CPU:    &cpu,
+		Memory: &memory,
+	}
+	return metadata
+}
+
+// parseTaskLimits returns the task level limits of cpu, in vCPUs, and memory, in MiB,
+// or nil if the task definition sets neither
+func parseTaskLimits(task *apitask.Task) *tmdsv2.LimitsResponse {
+	if task.CPU <= 0 && task.Memory <= 0 {
+		return nil
+	}
+	limits := &tmdsv2.LimitsResponse{}
+	if task.CPU > 0 {
+		cpu := task.CPU
+		limits.CPU = &cpu
+	}
+	if task.Memory > 0 {
+		memory := task.Memory
+		limits.Memory = &memory
+	}
+	return limits
+}
+
+// parseAWSVPCMetadata replaces the ports and networks of the container of an awsvpc task,
+// which docker only knows for the pause container, with the port mappings of the task
+// definition and the IP addresses of the task ENI
+func parseAWSVPCMetadata(dockerMD DockerContainerMetadata, task *apitask.Task, containerName string) DockerContainerMetadata {
+	if container, ok := task.ContainerByName(containerName); ok {
+		ports := make([]apicontainer.PortBinding, 0, len(container.Ports))
+		for _, port := range container.Ports {
+			ports = append(ports, apicontainer.PortBinding{
+				ContainerPort:      port.ContainerPort,
+				ContainerPortRange: port.ContainerPortRange,
+				HostPort:           port.ContainerPort,
+				BindIP:             port.BindIP,
+				Protocol:           port.Protocol,
+			})
+		}
+		dockerMD.ports = ports
+	}
+	eni := task.GetPrimaryENI()
+	if eni == nil {
+		seelog.Warnf("Failed to parse container metadata for task %s container %s: task has no ENI", task.Arn, containerName)
+		return dockerMD
+	}
+	dockerMD.networkInfo = NetworkMetadata{
+		networks: []tmdsresponse.Network{
+			{
+				NetworkMode:   apitask.AWSVPCNetworkMode,
+				IPv4Addresses: eni.GetIPV4Addresses(),
+				IPv6Addresses: eni.GetIPV6Addresses(),
+			},
+		},
 	}
+	return dockerMD
 }
 
 // parseDockerContainerMetadata parses the metadata in a docker container
@@ -17,21 +17,30 @@
 package containermetadata
 
 import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
 	"testing"
 
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apieni "github.com/aws/amazon-ecs-agent/ecs-agent/api/eni"
 
 	"github.com/docker/docker/api/types"
 	dockercontainer "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/go-connections/nat"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
 	cluster = "us-west2"
 )
 
+var updateGoldenFiles = flag.Bool("update", false, "update the golden metadata files in testdata")
+
 // TestParseContainerCreate checks case when parsing is done at metadata creation
 func TestParseContainerCreate(t *testing.T) {
 	mockTaskARN := validTaskARN
@@ -384,3 +393,121 @@ func TestParseTaskDefinitionSettings(t *testing.T) {
 	assert.Equal(t, metadata.taskMetadata.taskDefinitionFamily, mockTaskDefinitionFamily, "Expected task definition family "+mockTaskDefinitionFamily)
 	assert.Equal(t, metadata.taskMetadata.taskDefinitionRevision, mockTaskDefinitionRevision, "Expected task definition revision "+mockTaskDefinitionRevision)
 }
+
+// goldenTask returns a task with a container of the network mode, and the container as
+// docker inspects it once it's running
+func goldenTask(networkMode string) (*apitask.Task, *types.ContainerJSON) {
+	container := &apicontainer.Container{
+		Name:   containerName,
+		CPU:    256,
+		Memory: 512,
+		Ports: []apicontainer.PortBinding{
+			{ContainerPort: 80, HostPort: 8080, Protocol: apicontainer.TransportProtocolTCP},
+		},
+	}
+	container.SetImageDigest("sha256:7b3ccd7a6f7b3c6b6d0f0a4e3c1d2b5b9fd9d3a3e2c4b8f0e4b7f5d2a8c1e9f0")
+	task := &apitask.Task{
+		Arn:         validTaskARN,
+		Family:      taskDefinitionFamily,
+		Version:     taskDefinitionRevision,
+		CPU:         0.5,
+		Memory:      1024,
+		NetworkMode: networkMode,
+		Containers:  []*apicontainer.Container{container},
+	}
+	dockerContainer := &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    dockerID,
+			Name:  "/ecs-taskdefinitionfamily-8-container-e4c1b8f0e4b7f5d2a801",
+			Image: "sha256:2b6f5d2a8c1e9f07b3ccd7a6f7b3c6b6d0f0a4e3c1d2b5b9fd9d3a3e2c4b8f0e",
+		},
+		Config: &dockercontainer.Config{Image: "nginx:latest"},
+	}
+	if networkMode == apitask.AWSVPCNetworkMode {
+		task.AddTaskENI(&apieni.ENI{
+			ID:            "eni-0123456789abcdef0",
+			IPV4Addresses: []*apieni.ENIIPV4Address{{Primary: true, Address: "10.0.0.42"}},
+			IPV6Addresses: []*apieni.ENIIPV6Address{{Address: "2001:db8::42"}},
+		})
+		// Containers of awsvpc tasks join the network namespace of the pause container,
+		// so docker knows neither their ports nor their IP addresses
+		dockerContainer.HostConfig = &dockercontainer.HostConfig{NetworkMode: "container:pause-container-id"}
+		dockerContainer.NetworkSettings = &types.NetworkSettings{}
+	} else {
+		dockerContainer.HostConfig = &dockercontainer.HostConfig{NetworkMode: "bridge"}
+		dockerContainer.NetworkSettings = &types.NetworkSettings{
+			NetworkSettingsBase: types.NetworkSettingsBase{
+				Ports: nat.PortMap{
+					"80/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "8080"}},
+				},
+			},
+			Networks: map[string]*network.EndpointSettings{
+				"bridge": {IPAddress: "172.17.0.2"},
+			},
+		}
+	}
+	return task, dockerContainer
+}
+
+// TestMetadataFileGolden checks the metadata files of both schemas against the golden
+// files in testdata, which are updated by running the test with -update
+func TestMetadataFileGolden(t *testing.T) {
+	for _, tc := range []struct {
+		schemaVersion string
+		networkMode   string
+		goldenFile    string
+	}{
+		{schemaVersion: MetadataSchemaV1, networkMode: "bridge", goldenFile: "metadata_v1_bridge.json"},
+		{schemaVersion: MetadataSchemaV1, networkMode: apitask.AWSVPCNetworkMode, goldenFile: "metadata_v1_awsvpc.json"},
+		{schemaVersion: MetadataSchemaV2, networkMode: "bridge", goldenFile: "metadata_v2_bridge.json"},
+		{schemaVersion: MetadataSchemaV2, networkMode: apitask.AWSVPCNetworkMode, goldenFile: "metadata_v2_awsvpc.json"},
+	} {
+		t.Run(tc.goldenFile, func(t *testing.T) {
+			newManager := &metadataManager{
+				cluster:                cluster,
+				containerInstanceARN:   containerInstanceARN,
+				availabilityZone:       availabilityZone,
+				hostPrivateIPv4Address: hostPrivateIPv4Address,
+				hostPublicIPv4Address:  hostPublicIPv4Address,
+				schemaVersion:          tc.schemaVersion,
+			}
+			task, dockerContainer := goldenTask(tc.networkMode)
+			data, err := json.MarshalIndent(newManager.parseMetadata(dockerContainer, task, containerName), "", "\t")
+			require.NoError(t, err)
+
+			goldenPath := filepath.Join("testdata", tc.goldenFile)
+			if *updateGoldenFiles {
+				require.NoError(t, os.WriteFile(goldenPath, append(data, '\n'), 0644))
+			}
+			expected, err := os.ReadFile(goldenPath)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(data)+"\n")
+		})
+	}
+}
+
+// TestParseContainerCreateSchemaV2 checks that the v2 fields that are known before the
+// container is created are written at creation
+func TestParseContainerCreateSchemaV2(t *testing.T) {
+	task, _ := goldenTask(apitask.AWSVPCNetworkMode)
+	newManager := &metadataManager{schemaVersion: MetadataSchemaV2}
+	data, err := json.Marshal(newManager.parseMetadataAtContainerCreate(task, containerName))
+	require.NoError(t, err)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	assert.Equal(t, float64(2), metadata["SchemaVersion"])
+	assert.Equal(t, "sha256:7b3ccd7a6f7b3c6b6d0f0a4e3c1d2b5b9fd9d3a3e2c4b8f0e4b7f5d2a8c1e9f0", metadata["ImageDigest"])
+	assert.Equal(t, map[string]interface{}{"CPU": float64(256), "Memory": float64(512)}, metadata["Limits"])
+	assert.Equal(t, map[string]interface{}{"CPU": 0.5, "Memory": float64(1024)}, metadata["TaskLimits"])
+
+	// The v1 schema is unchanged
+	newManager.schemaVersion = MetadataSchemaV1
+	data, err = json.Marshal(newManager.parseMetadataAtContainerCreate(task, containerName))
+	require.NoError(t, err)
+	metadata = nil
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	for _, field := range []string{"SchemaVersion", "ImageDigest", "Limits", "TaskLimits"} {
+		assert.NotContains(t, metadata, field)
+	}
+}
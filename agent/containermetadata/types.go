@@ -21,6 +21,7 @@ import (
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	tmdsresponse "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/response"
+	tmdsv2 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v2"
 	"github.com/docker/docker/api/types"
 )
 
@@ -38,6 +39,17 @@ const (
 	MetadataReady
 )
 
+const (
+	// MetadataSchemaV1 is the schema of the metadata file that is written by default
+	MetadataSchemaV1 = "1"
+	// MetadataSchemaV2 is the schema of the metadata file that adds the image digest, the
+	// limits of the container and its task, and the ports and IP addresses of awsvpc
+	// tasks to the v1 schema
+	MetadataSchemaV2 = "2"
+
+	metadataSchemaV2Number = 2
+)
+
 // MetadataStatus specifies the current update status of the metadata file.
 // The purpose of this status is for users to check if the metadata file has
 // reached the stage they need before they read the rest of the file to avoid
@@ -112,6 +124,14 @@ type TaskMetadata struct {
 	taskDefinitionRevision string
 }
 
+// ContainerMetadata keeps track of the metadata of the container and its task
+// that is only written in the v2 schema
+type ContainerMetadata struct {
+	imageDigest string
+	limits      *tmdsv2.LimitsResponse
+	taskLimits  *tmdsv2.LimitsResponse
+}
+
 // Metadata packages all acquired metadata and is used to format it
 // into JSON to write to the metadata file. We have it flattened, rather
 // than simply containing the previous three structures to simplify JSON
@@ -125,6 +145,8 @@ type Metadata struct {
 	availabilityZone        string
 	hostPrivateIPv4Address  string
 	hostPublicIPv4Address   string
+	schemaVersion           string
+	containerMetadata       ContainerMetadata
 }
 
 // metadataSerializer is an intermediate struct that converts the information
@@ -148,24 +170,46 @@ type metadataSerializer struct {
 	HostPublicIPv4Address  string                     `json:"HostPublicIPv4Address,omitempty"`
 }
 
+// metadataSerializerV2 is an intermediate struct that converts the information
+// in Metadata into information to encode into JSON in the v2 schema
+type metadataSerializerV2 struct {
+	SchemaVersion int `json:"SchemaVersion"`
+	metadataSerializer
+	ImageDigest string                 `json:"ImageDigest,omitempty"`
+	Limits      *tmdsv2.LimitsResponse `json:"Limits,omitempty"`
+	TaskLimits  *tmdsv2.LimitsResponse `json:"TaskLimits,omitempty"`
+}
+
 func (m Metadata) MarshalJSON() ([]byte, error) {
-	return json.Marshal(
-		metadataSerializer{
-			Cluster:                m.cluster,
-			ContainerInstanceARN:   m.containerInstanceARN,
-			TaskARN:                m.taskMetadata.taskARN,
-			TaskDefinitionFamily:   m.taskMetadata.taskDefinitionFamily,
-			TaskDefinitionRevision: m.taskMetadata.taskDefinitionRevision,
-			ContainerID:            m.dockerContainerMetadata.containerID,
-			ContainerName:          m.taskMetadata.containerName,
-			DockerContainerName:    m.dockerContainerMetadata.dockerContainerName,
-			ImageID:                m.dockerContainerMetadata.imageID,
-			ImageName:              m.dockerContainerMetadata.imageName,
-			Ports:                  m.dockerContainerMetadata.ports,
-			Networks:               m.dockerContainerMetadata.networkInfo.networks,
-			MetadataFileStatus:     m.metadataStatus,
-			AvailabilityZone:       m.availabilityZone,
-			HostPrivateIPv4Address: m.hostPrivateIPv4Address,
-			HostPublicIPv4Address:  m.hostPublicIPv4Address,
+	if m.schemaVersion == MetadataSchemaV2 {
+		return json.Marshal(metadataSerializerV2{
+			SchemaVersion:      metadataSchemaV2Number,
+			metadataSerializer: m.serializer(),
+			ImageDigest:        m.containerMetadata.imageDigest,
+			Limits:             m.containerMetadata.limits,
+			TaskLimits:         m.containerMetadata.taskLimits,
 		})
+	}
+	return json.Marshal(m.serializer())
+}
+
+func (m Metadata) serializer() metadataSerializer {
+	return metadataSerializer{
+		Cluster:                m.cluster,
+		ContainerInstanceARN:   m.containerInstanceARN,
+		TaskARN:                m.taskMetadata.taskARN,
+		TaskDefinitionFamily:   m.taskMetadata.taskDefinitionFamily,
+		TaskDefinitionRevision: m.taskMetadata.taskDefinitionRevision,
+		ContainerID:            m.dockerContainerMetadata.containerID,
+		ContainerName:          m.taskMetadata.containerName,
+		DockerContainerName:    m.dockerContainerMetadata.dockerContainerName,
+		ImageID:                m.dockerContainerMetadata.imageID,
+		ImageName:              m.dockerContainerMetadata.imageName,
+		Ports:                  m.dockerContainerMetadata.ports,
+		Networks:               m.dockerContainerMetadata.networkInfo.networks,
+		MetadataFileStatus:     m.metadataStatus,
+		AvailabilityZone:       m.availabilityZone,
+		HostPrivateIPv4Address: m.hostPrivateIPv4Address,
+		HostPublicIPv4Address:  m.hostPublicIPv4Address,
+	}
 }
@@ -55,7 +55,7 @@ func writeToMetadataFile(data []byte, taskARN string, containerName string, data
 	}
 	metadataFileName := filepath.Join(metadataFileDir, metadataFile)
 
-	file, err := openFile(metadataFileName, os.O_WRONLY|os.O_CREATE, metadataPerm)
+	file, err := openFile(metadataFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, metadataPerm)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,193 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package containeroutput captures the output of containers that have no log driver to
+// files in the data directory of the agent.
+package containeroutput
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/arn"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	// LogDriverNone is the log driver of the containers whose output is captured
+	LogDriverNone = "none"
+
+	// outputDir is the directory of the data directory that the output of containers is
+	// captured to, in a directory per task and container
+	outputDir = "output"
+	// outputFile is the file that the output of a container is captured to
+	outputFile = "output.log"
+	outputPerm = 0644
+)
+
+// Manager captures the output of containers to files that are removed with their task.
+type Manager interface {
+	// Capture attaches to the output of the container, which must not be started yet so
+	// that all of its output is captured, and writes it to the output file of the
+	// container until the output ends. It returns the path of the file on the host.
+	Capture(ctx context.Context, taskARN string, containerName string, dockerID string, tty bool) (string, error)
+	// Clean stops capturing the output of the containers of the task and removes their
+	// output files.
+	Clean(taskARN string) error
+}
+
+// DockerOutputClient is the subset of the docker client that the manager uses to attach
+// to containers, which avoids an import cycle with dockerapi.
+type DockerOutputClient interface {
+	AttachContainer(context.Context, string, time.Duration) (io.ReadCloser, error)
+}
+
+// outputManager implements the Manager interface
+type outputManager struct {
+	client DockerOutputClient
+	// dataDir is the directory that the output is written to, and dataDirOnHost the
+	// directory on the host that dataDir is mounted from for the Linux version of the agent
+	dataDir       string
+	dataDirOnHost string
+	// maxFileBytes is the size at which output files are rotated
+	maxFileBytes int64
+
+	lock     sync.Mutex
+	captures map[string][]*capture
+}
+
+// capture is the capture of the output of a container.
+type capture struct {
+	stream    io.ReadCloser
+	closeOnce sync.Once
+	// closed is whether the stream was closed, which ends the capture
+	closed atomic.Bool
+	// done is closed once nothing is written to the output file anymore
+	done chan struct{}
+}
+
+// NewManager creates a manager of the captures of the output of containers.
+func NewManager(client DockerOutputClient, cfg *config.Config) Manager {
+	return &outputManager{
+		client:        client,
+		dataDir:       cfg.DataDir,
+		dataDirOnHost: cfg.DataDirOnHost,
+		maxFileBytes:  cfg.ContainerOutputCaptureMaxFileBytes,
+		captures:      make(map[string][]*capture),
+	}
+}
+
+// Capture attaches to the output of the container and writes it to the output file of the
+// container in the background.
+func (m *outputManager) Capture(ctx context.Context, taskARN string, containerName string,
+	dockerID string, tty bool) (string, error) {
+	taskDir, err := m.taskOutputDir(taskARN)
+	if err != nil {
+		return "", err
+	}
+	containerDir := filepath.Join(taskDir, containerName)
+	if err := os.MkdirAll(containerDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("creating output directory of container %s: %w", containerName, err)
+	}
+	path := filepath.Join(containerDir, outputFile)
+	file, err := newRotatingFile(path, m.maxFileBytes)
+	if err != nil {
+		return "", fmt.Errorf("creating output file of container %s: %w", containerName, err)
+	}
+	stream, err := m.client.AttachContainer(ctx, dockerID, dockerclient.AttachContainerTimeout)
+	if err != nil {
+		file.Close()
+		return "", fmt.Errorf("attaching to container %s: %w", containerName, err)
+	}
+
+	c := &capture{stream: stream, done: make(chan struct{})}
+	m.lock.Lock()
+	m.captures[taskARN] = append(m.captures[taskARN], c)
+	m.lock.Unlock()
+	go c.copy(file, tty, taskARN, containerName)
+	return hostPath(m.dataDirOnHost, path), nil
+}
+
+// copy writes the output stream to the file until the stream ends. The output of
+// containers without a TTY is multiplexed, and both stdout and stderr are written to the
+// file. The stream is drained if the file can't be written, since docker blocks writes of
+// containers to their output until the streams attached to them are read.
+func (c *capture) copy(file io.WriteCloser, tty bool, taskARN string, containerName string) {
+	defer close(c.done)
+	defer c.close()
+	defer file.Close()
+
+	var err error
+	if tty {
+		_, err = io.Copy(file, c.stream)
+	} else {
+		_, err = stdcopy.StdCopy(file, file, c.stream)
+	}
+	if err != nil && !c.closed.Load() {
+		logger.Warn("Stopped capturing the output of container", logger.Fields{
+			field.TaskARN:   taskARN,
+			field.Container: containerName,
+			field.Error:     err,
+		})
+		io.Copy(io.Discard, c.stream)
+	}
+}
+
+// close closes the output stream, which ends the capture.
+func (c *capture) close() {
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		c.stream.Close()
+	})
+}
+
+// Clean ends the captures of the task, waits for them to stop writing, and removes the
+// output files of the task.
+func (m *outputManager) Clean(taskARN string) error {
+	taskDir, err := m.taskOutputDir(taskARN)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	captures := m.captures[taskARN]
+	delete(m.captures, taskARN)
+	m.lock.Unlock()
+	for _, c := range captures {
+		c.close()
+		<-c.done
+	}
+	return os.RemoveAll(taskDir)
+}
+
+// taskOutputDir returns the directory that the output of the containers of the task is
+// captured to.
+func (m *outputManager) taskOutputDir(taskARN string) (string, error) {
+	taskID, err := arn.TaskIdFromArn(taskARN)
+	if err != nil {
+		return "", fmt.Errorf("output directory of task %s: %w", taskARN, err)
+	}
+	if taskID == "" {
+		return "", fmt.Errorf("output directory of task %s: task id is empty", taskARN)
+	}
+	return filepath.Join(m.dataDir, outputDir, taskID), nil
+}
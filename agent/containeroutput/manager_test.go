@@ -0,0 +1,167 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package containeroutput
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	taskARN       = "arn:aws:ecs:us-west-2:123456789012:task/cluster/taskid"
+	containerName = "debug"
+	dockerID      = "dockerid"
+)
+
+// fakeAttachClient returns the read ends of pipes as the attach streams of containers,
+// whose write ends are the output of the containers.
+type fakeAttachClient struct {
+	lock    sync.Mutex
+	outputs map[string]*io.PipeWriter
+	err     error
+}
+
+func newFakeAttachClient() *fakeAttachClient {
+	return &fakeAttachClient{outputs: make(map[string]*io.PipeWriter)}
+}
+
+func (c *fakeAttachClient) AttachContainer(ctx context.Context, id string, timeout time.Duration) (io.ReadCloser, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	r, w := io.Pipe()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.outputs[id] = w
+	return r, nil
+}
+
+func (c *fakeAttachClient) output(id string) *io.PipeWriter {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.outputs[id]
+}
+
+func newTestManager(t *testing.T, client DockerOutputClient, maxFileBytes int64) *outputManager {
+	return NewManager(client, &config.Config{
+		DataDir:                            t.TempDir(),
+		DataDirOnHost:                      "/var/lib/ecs",
+		ContainerOutputCaptureMaxFileBytes: maxFileBytes,
+	}).(*outputManager)
+}
+
+func outputPath(m *outputManager) string {
+	return filepath.Join(m.dataDir, outputDir, "taskid", containerName, outputFile)
+}
+
+// waitForOutput waits for the file to hold the output, since it's written in the background.
+func waitForOutput(t *testing.T, path string, expected string) {
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(path)
+		return err == nil && string(data) == expected
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCaptureMultiplexedOutput(t *testing.T) {
+	client := newFakeAttachClient()
+	m := newTestManager(t, client, 1024)
+	path, err := m.Capture(context.TODO(), taskARN, containerName, dockerID, false)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/var/lib/ecs", outputPath(m)), path)
+
+	output := client.output(dockerID)
+	stdout := stdcopy.NewStdWriter(output, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(output, stdcopy.Stderr)
+	_, err = stdout.Write([]byte("starting\n"))
+	require.NoError(t, err)
+	_, err = stderr.Write([]byte("panic: crashed\n"))
+	require.NoError(t, err)
+	output.Close()
+	waitForOutput(t, outputPath(m), "starting\npanic: crashed\n")
+}
+
+func TestCaptureTTYOutputRotation(t *testing.T) {
+	client := newFakeAttachClient()
+	m := newTestManager(t, client, 8)
+	_, err := m.Capture(context.TODO(), taskARN, containerName, dockerID, true)
+	require.NoError(t, err)
+
+	output := client.output(dockerID)
+	_, err = output.Write([]byte(strings.Repeat("a", 8) + strings.Repeat("b", 8) + "cc"))
+	require.NoError(t, err)
+	output.Close()
+	waitForOutput(t, outputPath(m), "cc")
+	assert.Equal(t, strings.Repeat("b", 8), readFile(t, outputPath(m)+rotatedFileSuffix))
+}
+
+func TestCaptureAttachFailure(t *testing.T) {
+	client := newFakeAttachClient()
+	client.err = errors.New("attach failed")
+	m := newTestManager(t, client, 1024)
+	_, err := m.Capture(context.TODO(), taskARN, containerName, dockerID, false)
+	assert.Error(t, err)
+	assert.Empty(t, m.captures)
+}
+
+func TestCaptureInvalidTaskARN(t *testing.T) {
+	m := newTestManager(t, newFakeAttachClient(), 1024)
+	_, err := m.Capture(context.TODO(), "invalid", containerName, dockerID, false)
+	assert.Error(t, err)
+	assert.Error(t, m.Clean("invalid"))
+}
+
+func TestClean(t *testing.T) {
+	client := newFakeAttachClient()
+	m := newTestManager(t, client, 1024)
+	_, err := m.Capture(context.TODO(), taskARN, containerName, dockerID, true)
+	require.NoError(t, err)
+	otherTaskARN := "arn:aws:ecs:us-west-2:123456789012:task/cluster/othertaskid"
+	_, err = m.Capture(context.TODO(), otherTaskARN, containerName, "otherdockerid", true)
+	require.NoError(t, err)
+
+	output := client.output(dockerID)
+	_, err = output.Write([]byte("output"))
+	require.NoError(t, err)
+	waitForOutput(t, outputPath(m), "output")
+
+	// The capture of a container that is still running is stopped before its file is removed
+	require.NoError(t, m.Clean(taskARN))
+	assert.NoDirExists(t, filepath.Join(m.dataDir, outputDir, "taskid"))
+	_, err = output.Write([]byte("more output"))
+	assert.Error(t, err)
+	assert.DirExists(t, filepath.Join(m.dataDir, outputDir, "othertaskid"))
+	assert.NotContains(t, m.captures, taskARN)
+	assert.Contains(t, m.captures, otherTaskARN)
+
+	// Tasks are cleaned once their captures ended too
+	client.output("otherdockerid").Close()
+	require.NoError(t, m.Clean(otherTaskARN))
+	assert.NoDirExists(t, filepath.Join(m.dataDir, outputDir, "othertaskid"))
+	assert.Empty(t, m.captures)
+}
@@ -0,0 +1,93 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package containeroutput
+
+import (
+	"os"
+)
+
+// rotatedFileSuffix is the suffix of the rotated output file
+const rotatedFileSuffix = ".1"
+
+// rotatingFile writes to a file that is rotated once it reaches its maximum size: the
+// file is renamed with rotatedFileSuffix, replacing the file rotated before, and a new file
+// is written. At most twice the maximum size is kept on disk.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// newRotatingFile opens the file, appending to it if it exists, such as when a container
+// is restarted.
+func newRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, outputPerm)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, maxSize: maxSize, file: file, size: info.Size()}, nil
+}
+
+// Write writes to the file, rotating it whenever it reaches its maximum size. Writes that
+// don't fit are split across files, so that no file exceeds the maximum size.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if f.size >= f.maxSize {
+			if err := f.rotate(); err != nil {
+				return written, err
+			}
+		}
+		chunk := p
+		if remaining := f.maxSize - f.size; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := f.file.Write(chunk)
+		written += n
+		f.size += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// rotate renames the file with rotatedFileSuffix and creates a new file.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, f.path+rotatedFileSuffix); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, outputPerm)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+// Close closes the file.
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,72 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package containeroutput
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), outputFile)
+	f, err := newRotatingFile(path, 10)
+	require.NoError(t, err)
+
+	n, err := f.Write([]byte("12345678"))
+	require.NoError(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, "12345678", readFile(t, path))
+	assert.NoFileExists(t, path+rotatedFileSuffix)
+
+	// Writes that don't fit are split across the files
+	n, err = f.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, "12345678ab", readFile(t, path+rotatedFileSuffix))
+	assert.Equal(t, "cdef", readFile(t, path))
+
+	// Only one rotated file is kept
+	n, err = f.Write([]byte("ghijklmnopqrstuvwxyz"))
+	require.NoError(t, err)
+	assert.Equal(t, 20, n)
+	assert.Equal(t, "mnopqrstuv", readFile(t, path+rotatedFileSuffix))
+	assert.Equal(t, "wxyz", readFile(t, path))
+	require.NoError(t, f.Close())
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), outputFile)
+	require.NoError(t, os.WriteFile(path, []byte("123456"), outputPerm))
+
+	f, err := newRotatingFile(path, 10)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, "123456abcd", readFile(t, path+rotatedFileSuffix))
+	assert.Equal(t, "ef", readFile(t, path))
+}
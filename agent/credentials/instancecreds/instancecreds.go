@@ -15,11 +15,118 @@ package instancecreds
 
 import (
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
 var (
 	credentialChain *credentials.Credentials
-	mu              sync.Mutex
+	// credentialChainProvider is the provider of credentialChain
+	credentialChainProvider credentials.Provider
+	mu                      sync.Mutex
 )
+
+// newChainProvider returns the provider of the instance credentials chain. The chain of
+// external instances reports when the credentials of the provider that they were
+// retrieved from expire, and lets them be retrieved ahead of their use, so that they can
+// be rotated ahead of it by a Rotator. The chain of EC2 instances is the chain of the SDK.
+func newChainProvider(providers []credentials.Provider, isExternal bool) credentials.Provider {
+	if !isExternal {
+		return &credentials.ChainProvider{
+			VerboseErrors: false,
+			Providers:     providers,
+		}
+	}
+	return newExpiringChainProvider(providers)
+}
+
+// setCredentialChain sets the instance credentials chain to the credentials of the chain
+// of the providers. mu must be held.
+func setCredentialChain(providers []credentials.Provider, isExternal bool) {
+	credentialChainProvider = newChainProvider(providers, isExternal)
+	credentialChain = credentials.NewCredentials(credentialChainProvider)
+}
+
+// expiringChainProvider is a chain provider that implements credentials.Expirer for the
+// providers of the chain that do. Credentials can also be retrieved from the chain ahead
+// of their use, in which case they are staged until the credentials in use are expired,
+// so that the credentials in use aren't lost if the retrieval fails.
+type expiringChainProvider struct {
+	providers []credentials.Provider
+
+	lock sync.Mutex
+	// current is the provider that the credentials in use were retrieved from
+	current credentials.Provider
+	// staged are the credentials that were retrieved ahead of their use, if any
+	staged *stagedCredentials
+}
+
+// stagedCredentials are credentials that were retrieved ahead of their use, from the
+// provider.
+type stagedCredentials struct {
+	value    credentials.Value
+	provider credentials.Provider
+}
+
+func newExpiringChainProvider(providers []credentials.Provider) *expiringChainProvider {
+	return &expiringChainProvider{providers: providers}
+}
+
+// Retrieve returns the staged credentials if there are any, or else the credentials of the
+// first provider of the chain that retrieves them.
+func (c *expiringChainProvider) Retrieve() (credentials.Value, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if staged := c.staged; staged != nil {
+		c.staged = nil
+		c.current = staged.provider
+		return staged.value, nil
+	}
+	value, provider, err := c.retrieve()
+	c.current = provider
+	return value, err
+}
+
+// retrieveAhead retrieves credentials from the chain and stages them, so that they are
+// used once the credentials in use are expired. The credentials in use, and when they
+// expire, are left untouched if the credentials can't be retrieved.
+func (c *expiringChainProvider) retrieveAhead() (credentials.Value, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value, provider, err := c.retrieve()
+	if err != nil {
+		return value, err
+	}
+	c.staged = &stagedCredentials{value: value, provider: provider}
+	return value, nil
+}
+
+// retrieve returns the credentials of the first provider of the chain that retrieves them,
+// along with that provider. c.lock must be held.
+func (c *expiringChainProvider) retrieve() (credentials.Value, credentials.Provider, error) {
+	for _, provider := range c.providers {
+		if value, err := provider.Retrieve(); err == nil {
+			return value, provider, nil
+		}
+	}
+	return credentials.Value{}, nil, credentials.ErrNoValidProvidersFoundInChain
+}
+
+// IsExpired returns true if the credentials in use expired, or if there are none.
+func (c *expiringChainProvider) IsExpired() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.current == nil || c.current.IsExpired()
+}
+
+// ExpiresAt returns when the credentials in use expire, or the zero time if the provider
+// that they were retrieved from doesn't know when they expire.
+func (c *expiringChainProvider) ExpiresAt() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if expirer, ok := c.current.(credentials.Expirer); ok {
+		return expirer.ExpiresAt()
+	}
+	return time.Time{}
+}
@@ -44,6 +44,9 @@ import (
 //     in the credentials not being refreshed. To mitigate this issue, we will
 //     reorder the credential chain and ensure that `RotatingSharedCredentialsProvider`
 //     takes precedence over the `SharedCredentialsProvider` for ECS-A.
+//
+// The chain of external instances also reports when its credentials expire, and lets them
+// be retrieved ahead of their use, so that they can be rotated ahead of it by a Rotator.
 func GetCredentials(isExternal bool) *credentials.Credentials {
 	mu.Lock()
 	credProviders := defaults.CredProviders(defaults.Config(), defaults.Handlers())
@@ -52,10 +55,7 @@ func GetCredentials(isExternal bool) *credentials.Credentials {
 	} else {
 		credProviders = append(credProviders, providers.NewRotatingSharedCredentialsProvider())
 	}
-	credentialChain = credentials.NewCredentials(&credentials.ChainProvider{
-		VerboseErrors: false,
-		Providers:     credProviders,
-	})
+	setCredentialChain(credProviders, isExternal)
 	mu.Unlock()
 
 	// credentials.Credentials is concurrency-safe, so lock not needed here
@@ -0,0 +1,246 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package instancecreds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/retry"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// DefaultRotationMargin is how long before the instance credentials expire they are
+	// rotated.
+	DefaultRotationMargin = 5 * time.Minute
+	// rotationJitter is the maximum amount of time that rotations are moved ahead by, so
+	// that the instances of a fleet whose credentials were issued together don't all ask
+	// for new credentials at the same time.
+	rotationJitter = time.Minute
+	// minRotationInterval is the minimum amount of time between successful rotations,
+	// for credentials that are valid for less than the margin, such as the credentials of
+	// the rotating shared credentials provider.
+	minRotationInterval = 30 * time.Second
+	// noExpiryRotationInterval is how often credentials without known expiration, such as
+	// static credentials, are checked.
+	noExpiryRotationInterval = 15 * time.Minute
+
+	rotationBackoffMin      = 5 * time.Second
+	rotationBackoffMax      = 2 * time.Minute
+	rotationBackoffJitter   = 0.2
+	rotationBackoffMultiple = 2
+)
+
+// RotationState is the state of the rotation of the instance credentials.
+type RotationState string
+
+const (
+	// RotationPending is the state before the credentials are first rotated.
+	RotationPending RotationState = "PENDING"
+	// RotationHealthy is the state once the credentials were rotated.
+	RotationHealthy RotationState = "HEALTHY"
+	// RotationDegraded is the state while rotations fail and the last credentials that
+	// were retrieved haven't expired yet.
+	RotationDegraded RotationState = "DEGRADED"
+	// RotationExpired is the state while rotations fail and the last credentials that
+	// were retrieved have expired, so calls to AWS APIs fail.
+	RotationExpired RotationState = "EXPIRED"
+)
+
+// RotationStatus is the status of the rotation of the instance credentials.
+type RotationStatus struct {
+	State RotationState `json:"State"`
+	// ProviderName is the name of the provider that the credentials were last retrieved from
+	ProviderName string `json:"ProviderName,omitempty"`
+	// LastRotatedAt is when the credentials were last retrieved
+	LastRotatedAt *time.Time `json:"LastRotatedAt,omitempty"`
+	// ExpiresAt is when the last credentials that were retrieved expire, if they expire
+	ExpiresAt *time.Time `json:"ExpiresAt,omitempty"`
+	// NextRotationAt is when the credentials are rotated next, or retried after a failure
+	NextRotationAt *time.Time `json:"NextRotationAt,omitempty"`
+	// ConsecutiveFailures is the number of rotations that failed since the last success
+	ConsecutiveFailures int `json:"ConsecutiveFailures"`
+	// LastError is the error of the last rotation, if it failed
+	LastError string `json:"LastError,omitempty"`
+}
+
+// RotationStatusReporter reports the status of the rotation of the instance credentials.
+type RotationStatusReporter interface {
+	RotationStatus() RotationStatus
+}
+
+// Rotator rotates the instance credentials ahead of their expiration, instead of letting
+// them expire and having calls to AWS APIs fail until the credentials are retrieved
+// again. This is used on external instances, whose credentials are issued by SSM and
+// don't last long. Credentials are rotated the margin before they expire, moved ahead by
+// up to a minute of jitter. Rotations that fail are retried with backoff, and the rotation
+// is reported degraded until a rotation succeeds.
+//
+// New credentials are retrieved ahead of their use, and the credentials in use are only
+// replaced once new credentials were retrieved, so the credentials in use keep being used
+// until they expire if rotations fail. Credentials whose chain can't retrieve them ahead
+// of their use, which isn't the instance credentials chain of external instances, are
+// only retrieved once their provider reports them expired.
+type Rotator struct {
+	credentials *credentials.Credentials
+	// chain is the provider of the credentials if it can retrieve them ahead of their use
+	chain   *expiringChainProvider
+	margin  time.Duration
+	backoff retry.Backoff
+	now     func() time.Time
+	jitter  func(time.Duration) time.Duration
+
+	lock   sync.RWMutex
+	status RotationStatus
+}
+
+// NewRotator creates a rotator of the credentials, which rotates them the margin before
+// they expire.
+func NewRotator(creds *credentials.Credentials, margin time.Duration) *Rotator {
+	mu.Lock()
+	var chain credentials.Provider
+	if creds == credentialChain {
+		chain = credentialChainProvider
+	}
+	mu.Unlock()
+	return newRotator(creds, chain, margin)
+}
+
+// newRotator creates a rotator of the credentials of the provider.
+func newRotator(creds *credentials.Credentials, provider credentials.Provider, margin time.Duration) *Rotator {
+	chain, _ := provider.(*expiringChainProvider)
+	return &Rotator{
+		credentials: creds,
+		chain:       chain,
+		margin:      margin,
+		backoff: retry.NewExponentialBackoff(rotationBackoffMin, rotationBackoffMax, rotationBackoffJitter,
+			rotationBackoffMultiple),
+		now: time.Now,
+		jitter: func(jitter time.Duration) time.Duration {
+			return retry.AddJitter(0, jitter)
+		},
+		status: RotationStatus{State: RotationPending},
+	}
+}
+
+// Start rotates the credentials in the background until the context is done.
+func (r *Rotator) Start(ctx context.Context) {
+	go r.run(ctx)
+}
+
+func (r *Rotator) run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(r.rotate())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// rotate rotates the credentials if they expire within the margin, and returns how long
+// to wait before the next rotation.
+func (r *Rotator) rotate() time.Duration {
+	now := r.now()
+	var err error
+	if expiresAt, ok := r.expiresAt(); ok && expiresAt.Sub(now) <= r.margin && r.chain != nil {
+		// The credentials in use are only expired once new credentials were retrieved, which
+		// are then used in their place
+		if _, err = r.chain.retrieveAhead(); err == nil {
+			r.credentials.Expire()
+		}
+	}
+	var value credentials.Value
+	if err == nil {
+		value, err = r.credentials.Get()
+	}
+	if err == nil && value.AccessKeyID == "" {
+		err = errors.New("no credentials were retrieved")
+	}
+	expiresAt, hasExpiry := r.expiresAt()
+	if err == nil && hasExpiry && !expiresAt.After(now) {
+		err = fmt.Errorf("credentials retrieved from %s expired at %s", value.ProviderName,
+			expiresAt.UTC().Format(time.RFC3339))
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err != nil {
+		retryIn := r.backoff.Duration()
+		nextRotationAt := now.Add(retryIn).UTC()
+		r.status.State = RotationDegraded
+		r.status.NextRotationAt = &nextRotationAt
+		r.status.ConsecutiveFailures++
+		r.status.LastError = err.Error()
+		seelog.Warnf("Error rotating the instance credentials, retrying in %v (%d consecutive failures): %v",
+			retryIn, r.status.ConsecutiveFailures, err)
+		return retryIn
+	}
+
+	r.backoff.Reset()
+	rotateIn := noExpiryRotationInterval
+	r.status.ExpiresAt = nil
+	if hasExpiry {
+		rotateIn = expiresAt.Sub(now) - r.margin - r.jitter(rotationJitter)
+		if rotateIn < minRotationInterval {
+			rotateIn = minRotationInterval
+		}
+		expiresAt = expiresAt.UTC()
+		r.status.ExpiresAt = &expiresAt
+	}
+	if r.status.ConsecutiveFailures > 0 {
+		seelog.Infof("Rotated the instance credentials after %d consecutive failures",
+			r.status.ConsecutiveFailures)
+	}
+	rotatedAt := now.UTC()
+	nextRotationAt := rotatedAt.Add(rotateIn)
+	r.status = RotationStatus{
+		State:          RotationHealthy,
+		ProviderName:   value.ProviderName,
+		LastRotatedAt:  &rotatedAt,
+		ExpiresAt:      r.status.ExpiresAt,
+		NextRotationAt: &nextRotationAt,
+	}
+	return rotateIn
+}
+
+// expiresAt returns when the credentials expire. It returns false if that isn't known,
+// because the credentials weren't retrieved yet or because their provider doesn't know.
+func (r *Rotator) expiresAt() (time.Time, bool) {
+	expiresAt, err := r.credentials.ExpiresAt()
+	if err != nil || expiresAt.IsZero() {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+// RotationStatus returns the status of the rotation of the credentials. The rotation is
+// reported expired while rotations fail past the expiration of the last credentials that
+// were retrieved.
+func (r *Rotator) RotationStatus() RotationStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	status := r.status
+	if status.State == RotationDegraded && status.ExpiresAt != nil && !r.now().Before(*status.ExpiresAt) {
+		status.State = RotationExpired
+	}
+	return status
+}
@@ -0,0 +1,273 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package instancecreds
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeSSMProviderName = "FakeSSMProvider"
+
+// fakeSSMCredentialsSource issues credentials that expire the ttl after they are issued,
+// like the credentials that SSM issues to external instances.
+type fakeSSMCredentialsSource struct {
+	credentials.Expiry
+	now    *time.Time
+	ttl    time.Duration
+	err    error
+	issued int
+}
+
+func newFakeSSMCredentialsSource(now *time.Time, ttl time.Duration) *fakeSSMCredentialsSource {
+	source := &fakeSSMCredentialsSource{now: now, ttl: ttl}
+	source.CurrentTime = func() time.Time { return *now }
+	return source
+}
+
+func (s *fakeSSMCredentialsSource) Retrieve() (credentials.Value, error) {
+	if s.err != nil {
+		return credentials.Value{ProviderName: fakeSSMProviderName}, s.err
+	}
+	s.issued++
+	s.SetExpiration(s.now.Add(s.ttl), 0)
+	return credentials.Value{
+		AccessKeyID:     fmt.Sprintf("AKID%d", s.issued),
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		ProviderName:    fakeSSMProviderName,
+	}, nil
+}
+
+// newTestRotator returns a rotator of the credentials of the chain of the providers, whose
+// clock is the returned time, and whose jitter is half of the maximum jitter.
+func newTestRotator(providers ...func(now *time.Time) credentials.Provider) (*Rotator, *time.Time) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	var chain []credentials.Provider
+	for _, provider := range providers {
+		chain = append(chain, provider(&now))
+	}
+	provider := newChainProvider(chain, true)
+	r := newRotator(credentials.NewCredentials(provider), provider, DefaultRotationMargin)
+	r.now = func() time.Time { return now }
+	r.jitter = func(jitter time.Duration) time.Duration { return jitter / 2 }
+	return r, &now
+}
+
+func TestRotatorRotatesAheadOfExpiration(t *testing.T) {
+	var source *fakeSSMCredentialsSource
+	r, now := newTestRotator(func(now *time.Time) credentials.Provider {
+		source = newFakeSSMCredentialsSource(now, time.Hour)
+		return source
+	})
+	start := *now
+	assert.Equal(t, RotationPending, r.RotationStatus().State)
+
+	// The credentials are rotated the margin and the jitter before they expire
+	assert.Equal(t, time.Hour-DefaultRotationMargin-rotationJitter/2, r.rotate())
+	status := r.RotationStatus()
+	assert.Equal(t, RotationHealthy, status.State)
+	assert.Equal(t, fakeSSMProviderName, status.ProviderName)
+	require.NotNil(t, status.ExpiresAt)
+	assert.Equal(t, start.Add(time.Hour), *status.ExpiresAt)
+	require.NotNil(t, status.NextRotationAt)
+	assert.Equal(t, start.Add(time.Hour-DefaultRotationMargin-rotationJitter/2), *status.NextRotationAt)
+	assert.Equal(t, 1, source.issued)
+
+	// Credentials that don't expire within the margin aren't replaced
+	*now = start.Add(30 * time.Minute)
+	r.rotate()
+	assert.Equal(t, 1, source.issued)
+
+	// Credentials that expire within the margin are, before they expire
+	*now = start.Add(time.Hour - DefaultRotationMargin + time.Second)
+	r.rotate()
+	assert.Equal(t, 2, source.issued)
+	status = r.RotationStatus()
+	assert.Equal(t, RotationHealthy, status.State)
+	assert.Equal(t, now.Add(time.Hour), *status.ExpiresAt)
+	assert.Equal(t, *now, *status.LastRotatedAt)
+}
+
+func TestRotatorRetriesWithBackoffAndReportsDegradation(t *testing.T) {
+	var source *fakeSSMCredentialsSource
+	r, now := newTestRotator(func(now *time.Time) credentials.Provider {
+		source = newFakeSSMCredentialsSource(now, time.Hour)
+		return source
+	})
+	start := *now
+	r.rotate()
+
+	// SSM fails to issue new credentials, the rotation is retried with backoff
+	source.err = errors.New("SSM is unavailable")
+	*now = start.Add(56 * time.Minute)
+	var retries []time.Duration
+	for i := 0; i < 3; i++ {
+		retries = append(retries, r.rotate())
+	}
+	for _, retryIn := range retries {
+		assert.GreaterOrEqual(t, retryIn, rotationBackoffMin)
+		assert.LessOrEqual(t, retryIn, rotationBackoffMax)
+	}
+	assert.Greater(t, retries[2], retries[0])
+	status := r.RotationStatus()
+	assert.Equal(t, RotationDegraded, status.State)
+	assert.Equal(t, 3, status.ConsecutiveFailures)
+	assert.Contains(t, status.LastError, "NoCredentialProviders")
+	assert.Equal(t, now.Add(retries[2]), *status.NextRotationAt)
+	// The expiration of the last credentials that were issued is kept
+	assert.Equal(t, start.Add(time.Hour), *status.ExpiresAt)
+
+	// The credentials in use are kept until they expire
+	value, err := r.credentials.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "AKID1", value.AccessKeyID)
+	expiresAt, err := r.credentials.ExpiresAt()
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(time.Hour), expiresAt)
+
+	// The rotation is reported expired once the credentials expire
+	*now = start.Add(time.Hour)
+	assert.Equal(t, RotationExpired, r.RotationStatus().State)
+
+	// SSM recovers
+	source.err = nil
+	r.rotate()
+	status = r.RotationStatus()
+	assert.Equal(t, RotationHealthy, status.State)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Empty(t, status.LastError)
+	assert.Equal(t, now.Add(time.Hour), *status.ExpiresAt)
+	assert.Equal(t, 2, source.issued)
+}
+
+func TestRotatorWithoutExpiringChain(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	source := newFakeSSMCredentialsSource(&now, time.Hour)
+	chain := &credentials.ChainProvider{Providers: []credentials.Provider{source}}
+	r := NewRotator(credentials.NewCredentials(chain), DefaultRotationMargin)
+	assert.Nil(t, r.chain)
+	r.now = func() time.Time { return now }
+	r.rotate()
+
+	// The credentials aren't expired within the margin, since they can't be retrieved ahead
+	// of their use
+	now = now.Add(time.Hour - DefaultRotationMargin + time.Second)
+	r.rotate()
+	assert.Equal(t, 1, source.issued)
+	assert.Equal(t, RotationHealthy, r.RotationStatus().State)
+}
+
+func TestNewRotatorOfCredentialChain(t *testing.T) {
+	defer func() {
+		credentialChain = nil
+		credentialChainProvider = nil
+	}()
+	setCredentialChain([]credentials.Provider{&credentials.StaticProvider{}}, true)
+	assert.NotNil(t, NewRotator(credentialChain, DefaultRotationMargin).chain)
+
+	setCredentialChain([]credentials.Provider{&credentials.StaticProvider{}}, false)
+	assert.Nil(t, NewRotator(credentialChain, DefaultRotationMargin).chain)
+}
+
+func TestRotatorRejectsExpiredCredentials(t *testing.T) {
+	r, _ := newTestRotator(func(now *time.Time) credentials.Provider {
+		return newFakeSSMCredentialsSource(now, -time.Minute)
+	})
+
+	r.rotate()
+	status := r.RotationStatus()
+	assert.Equal(t, RotationDegraded, status.State)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	assert.Contains(t, status.LastError, "expired at 2023-05-01T09:59:00Z")
+}
+
+func TestRotatorCredentialsWithoutExpiration(t *testing.T) {
+	r, now := newTestRotator(func(*time.Time) credentials.Provider {
+		return &credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "secret",
+		}}
+	})
+
+	assert.Equal(t, noExpiryRotationInterval, r.rotate())
+	status := r.RotationStatus()
+	assert.Equal(t, RotationHealthy, status.State)
+	assert.Equal(t, credentials.StaticProviderName, status.ProviderName)
+	assert.Nil(t, status.ExpiresAt)
+	assert.Equal(t, now.Add(noExpiryRotationInterval), *status.NextRotationAt)
+}
+
+func TestRotatorShortLivedCredentials(t *testing.T) {
+	r, _ := newTestRotator(func(now *time.Time) credentials.Provider {
+		return newFakeSSMCredentialsSource(now, time.Minute)
+	})
+
+	// Credentials valid for less than the margin aren't rotated continuously
+	assert.Equal(t, minRotationInterval, r.rotate())
+	assert.Equal(t, RotationHealthy, r.RotationStatus().State)
+}
+
+func TestExpiringChainProvider(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	failing := newFakeSSMCredentialsSource(&now, time.Hour)
+	failing.err = errors.New("unavailable")
+	source := newFakeSSMCredentialsSource(&now, 30*time.Minute)
+	chain := newExpiringChainProvider([]credentials.Provider{failing, source})
+	creds := credentials.NewCredentials(chain)
+
+	expiresAt, err := creds.ExpiresAt()
+	require.NoError(t, err)
+	assert.True(t, expiresAt.IsZero())
+	value, err := creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "AKID1", value.AccessKeyID)
+	expiresAt, err = creds.ExpiresAt()
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(30*time.Minute), expiresAt)
+
+	// Credentials retrieved ahead of their use are used once the credentials in use are
+	// expired
+	_, err = chain.retrieveAhead()
+	require.NoError(t, err)
+	value, err = creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "AKID1", value.AccessKeyID)
+	creds.Expire()
+	value, err = creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "AKID2", value.AccessKeyID)
+	assert.Equal(t, 2, source.issued)
+
+	// The credentials in use are kept if credentials can't be retrieved ahead of their use
+	source.err = errors.New("unavailable")
+	_, err = chain.retrieveAhead()
+	assert.Error(t, err)
+	value, err = creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "AKID2", value.AccessKeyID)
+	assert.False(t, creds.IsExpired())
+
+	// The chain of EC2 instances is the chain of the SDK
+	assert.IsType(t, &credentials.ChainProvider{}, newChainProvider([]credentials.Provider{source}, false))
+}
@@ -17,9 +17,11 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/api/container"
 	"github.com/aws/amazon-ecs-agent/agent/api/task"
 	"github.com/aws/amazon-ecs-agent/agent/engine/image"
+	"github.com/aws/amazon-ecs-agent/agent/utils/envscrub"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/api/eni"
 
 	bolt "go.etcd.io/bbolt"
@@ -34,6 +36,7 @@ const (
 	imagesBucketName         = "images"
 	eniAttachmentsBucketName = "eniattachments"
 	metadataBucketName       = "metadata"
+	taskStateChangesBucket   = "taskstatechanges"
 )
 
 var (
@@ -46,6 +49,7 @@ var (
 		tasksBucketName,
 		eniAttachmentsBucketName,
 		metadataBucketName,
+		taskStateChangesBucket,
 	}
 )
 
@@ -89,6 +93,13 @@ type Client interface {
 	// GetMetadata gets the value of a certain kind of metadata.
 	GetMetadata(string) (string, error)
 
+	// SavePendingTaskStateChanges saves the task state changes of a task that are yet to be submitted.
+	SavePendingTaskStateChanges(*api.PendingTaskStateChanges) error
+	// DeletePendingTaskStateChanges deletes the pending task state changes of a task.
+	DeletePendingTaskStateChanges(string) error
+	// GetPendingTaskStateChanges gets the pending task state changes of all the tasks.
+	GetPendingTaskStateChanges() ([]*api.PendingTaskStateChanges, error)
+
 	// Close closes the connection to database.
 	Close() error
 }
@@ -96,13 +107,28 @@ type Client interface {
 // client implements the Client interface using boltdb as the backing data store.
 type client struct {
 	db *bolt.DB
+	// scrubber redacts the environment variables of the containers that are saved
+	scrubber *envscrub.Scrubber
+}
+
+// Opt is an option of a data client.
+type Opt func(*client)
+
+// WithEnvironmentScrubber redacts the values of the sensitive environment variables of the
+// containers that are saved, in the data of both the containers and their tasks. The
+// containers are scrubbed once they have been created, the containers in memory are not
+// affected. Environments are saved as is if not set.
+func WithEnvironmentScrubber(scrubber *envscrub.Scrubber) Opt {
+	return func(c *client) {
+		c.scrubber = scrubber
+	}
 }
 
 // New returns a data client that implements the Client interface with boltdb.
-func New(dataDir string) (Client, error) {
+func New(dataDir string, opts ...Opt) (Client, error) {
 	var err error
 	once.Do(func() {
-		dbClient, err = setup(dataDir)
+		dbClient, err = setup(dataDir, opts...)
 	})
 	if err != nil {
 		return nil, err
@@ -112,12 +138,12 @@ func New(dataDir string) (Client, error) {
 
 // NewWithSetup returns a data client that implements the Client interface with boltdb.
 // It always runs the db setup. Used for testing.
-func NewWithSetup(dataDir string) (Client, error) {
-	return setup(dataDir)
+func NewWithSetup(dataDir string, opts ...Opt) (Client, error) {
+	return setup(dataDir, opts...)
 }
 
 // setup initiates the boltdb client and makes sure the buckets we use are created.
-func setup(dataDir string) (*client, error) {
+func setup(dataDir string, opts ...Opt) (*client, error) {
 	db, err := bolt.Open(filepath.Join(dataDir, dbName), dbMode, nil)
 	err = db.Update(func(tx *bolt.Tx) error {
 		for _, b := range buckets {
@@ -132,9 +158,13 @@ func setup(dataDir string) (*client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &client{
+	c := &client{
 		db: db,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
 // Close closes the boltdb connection.
@@ -29,9 +29,13 @@ func (c *client) SaveDockerContainer(container *apicontainer.DockerContainer) er
 	if err != nil {
 		return errors.Wrap(err, "failed to generate database id")
 	}
+	data, err := c.marshalDockerContainer(container)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal object with key %q", id)
+	}
 	return c.db.Batch(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(containersBucketName))
-		return putObject(b, id, container)
+		return putData(b, id, data)
 	})
 }
 
@@ -49,9 +53,13 @@ func (c *client) SaveContainer(container *apicontainer.Container) error {
 		dockerContainer = &apicontainer.DockerContainer{}
 	}
 	dockerContainer.Container = container
+	data, err := c.marshalDockerContainer(dockerContainer)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal object with key %q", id)
+	}
 	return c.db.Batch(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(containersBucketName))
-		return putObject(b, id, dockerContainer)
+		return putData(b, id, data)
 	})
 }
 
@@ -21,13 +21,16 @@ import (
 )
 
 func putObject(bucket *bolt.Bucket, key string, obj interface{}) error {
-	keyBytes := []byte(key)
 	data, err := json.Marshal(obj)
 	if err != nil {
 		return errors.Wrapf(err, "failed to marshal object with key %q", key)
 	}
+	return putData(bucket, key, data)
+}
 
-	if err := bucket.Put(keyBytes, data); err != nil {
+// putData puts the json of an object that is already marshaled.
+func putData(bucket *bolt.Bucket, key string, data []byte) error {
+	if err := bucket.Put([]byte(key), data); err != nil {
 		return errors.Wrapf(err, "failed to insert object with key %q", key)
 	}
 
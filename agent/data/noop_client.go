@@ -14,6 +14,7 @@
 package data
 
 import (
+	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/api/container"
 	"github.com/aws/amazon-ecs-agent/agent/api/task"
 	"github.com/aws/amazon-ecs-agent/agent/engine/image"
@@ -88,6 +89,18 @@ func (c *noopClient) GetMetadata(string) (string, error) {
 	return "", nil
 }
 
+func (c *noopClient) SavePendingTaskStateChanges(*api.PendingTaskStateChanges) error {
+	return nil
+}
+
+func (c *noopClient) DeletePendingTaskStateChanges(string) error {
+	return nil
+}
+
+func (c *noopClient) GetPendingTaskStateChanges() ([]*api.PendingTaskStateChanges, error) {
+	return nil, nil
+}
+
 func (c *noopClient) Close() error {
 	return nil
 }
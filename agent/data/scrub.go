@@ -0,0 +1,129 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/utils/envscrub"
+)
+
+// marshalDockerContainer returns the json of the docker container that is saved, with the
+// environment of its container scrubbed.
+func (c *client) marshalDockerContainer(container *apicontainer.DockerContainer) ([]byte, error) {
+	return c.marshalScrubbed(container, func(obj map[string]interface{}) {
+		c.scrubContainer(obj["Container"])
+	})
+}
+
+// marshalTask returns the json of the task that is saved, with the environment of its
+// containers scrubbed.
+func (c *client) marshalTask(task *apitask.Task) ([]byte, error) {
+	return c.marshalScrubbed(task, func(obj map[string]interface{}) {
+		containers, _ := obj["Containers"].([]interface{})
+		for _, container := range containers {
+			c.scrubContainer(container)
+		}
+	})
+}
+
+// marshalScrubbed returns the json of the object after scrub has scrubbed its generic json
+// representation, or the json of the object as is if the client doesn't scrub environments.
+func (c *client) marshalScrubbed(obj interface{}, scrub func(map[string]interface{})) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil || c.scrubber == nil {
+		return data, err
+	}
+	var generic map[string]interface{}
+	if err := unmarshalGeneric(data, &generic); err != nil {
+		return nil, err
+	}
+	scrub(generic)
+	return json.Marshal(generic)
+}
+
+// scrubContainer redacts the sensitive environment variables of the generic json of a
+// container, both in its environment and in its docker config. Containers that are yet to be
+// created are left as is, as their environment is needed to create them when the agent is
+// restarted.
+func (c *client) scrubContainer(obj interface{}) {
+	container, ok := obj.(map[string]interface{})
+	if !ok || !created(container["KnownStatus"]) {
+		return
+	}
+	if environment, ok := container["environment"].(map[string]interface{}); ok {
+		for name := range environment {
+			if c.scrubber.Sensitive(name) {
+				environment[name] = envscrub.RedactionMarker
+			}
+		}
+	}
+	if dockerConfig, ok := container["dockerConfig"].(map[string]interface{}); ok {
+		if config, ok := dockerConfig["config"].(string); ok {
+			dockerConfig["config"] = c.scrubDockerContainerConfig(config)
+		}
+	}
+}
+
+// scrubDockerContainerConfig returns the docker container config with the sensitive
+// variables of its environment redacted. Configs that can't be parsed are returned as is.
+func (c *client) scrubDockerContainerConfig(config string) string {
+	var generic map[string]interface{}
+	if err := unmarshalGeneric([]byte(config), &generic); err != nil {
+		return config
+	}
+	variables, ok := generic["Env"].([]interface{})
+	if !ok {
+		return config
+	}
+	environment := make([]string, 0, len(variables))
+	for _, variable := range variables {
+		if variable, ok := variable.(string); ok {
+			environment = append(environment, variable)
+		}
+	}
+	generic["Env"] = c.scrubber.ScrubEnvironmentList(environment)
+	scrubbed, err := json.Marshal(generic)
+	if err != nil {
+		return config
+	}
+	return string(scrubbed)
+}
+
+// created returns true if the known status of the generic json of a container is created or
+// later.
+func created(knownStatus interface{}) bool {
+	name, ok := knownStatus.(string)
+	if !ok {
+		return false
+	}
+	var status apicontainerstatus.ContainerStatus
+	if err := json.Unmarshal([]byte(strconv.Quote(name)), &status); err != nil {
+		return false
+	}
+	return status >= apicontainerstatus.ContainerCreated
+}
+
+// unmarshalGeneric unmarshals json into generic values, keeping numbers as they are so that
+// they can be marshaled again without losing precision.
+func unmarshalGeneric(data []byte, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
@@ -0,0 +1,136 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/utils/envscrub"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSeededSecret       = "seeded-secret-value"
+	testSeededConfigSecret = "seeded-config-secret-value"
+	testPendingSecret      = "pending-secret-value"
+)
+
+func newScrubbedContainer(name string, status apicontainerstatus.ContainerStatus,
+	secret, configSecret string) *apicontainer.Container {
+	container := &apicontainer.Container{
+		Name:          name,
+		TaskARNUnsafe: testTaskArn,
+		Environment: map[string]string{
+			"DB_PASSWORD": secret,
+			"LOG_LEVEL":   "debug",
+		},
+		DockerConfig: apicontainer.DockerConfig{
+			Config: aws.String(`{"Env":["API_KEY=` + configSecret + `","PATH=/usr/bin"],"StopTimeout":1234567890123}`),
+		},
+	}
+	container.SetKnownStatus(status)
+	return container
+}
+
+func TestEnvironmentScrubbing(t *testing.T) {
+	testDir := t.TempDir()
+	scrubber, err := envscrub.New(envscrub.DefaultPatterns)
+	require.NoError(t, err)
+	testClient, err := NewWithSetup(testDir, WithEnvironmentScrubber(scrubber))
+	require.NoError(t, err)
+
+	created := newScrubbedContainer(testContainerName, apicontainerstatus.ContainerRunning, testSeededSecret,
+		testSeededConfigSecret)
+	pending := newScrubbedContainer(testContainerName2, apicontainerstatus.ContainerPulled, testPendingSecret,
+		testPendingSecret)
+	task := &apitask.Task{
+		Arn:        testTaskArn,
+		Containers: []*apicontainer.Container{created, pending},
+	}
+	require.NoError(t, testClient.SaveTask(task))
+	require.NoError(t, testClient.SaveDockerContainer(&apicontainer.DockerContainer{
+		DockerID:   testDockerID,
+		DockerName: testDockerName,
+		Container:  created,
+	}))
+	require.NoError(t, testClient.SaveContainer(pending))
+	require.NoError(t, testClient.Close())
+
+	// The containers in memory keep their environment
+	assert.Equal(t, testSeededSecret, created.Environment["DB_PASSWORD"])
+	assert.Contains(t, aws.StringValue(created.DockerConfig.Config), testSeededConfigSecret)
+
+	// The secrets of the created container never make it to disk
+	onDisk, err := os.ReadFile(filepath.Join(testDir, dbName))
+	require.NoError(t, err)
+	assert.NotContains(t, string(onDisk), testSeededSecret)
+	assert.NotContains(t, string(onDisk), testSeededConfigSecret)
+
+	// The state is restored with the secrets of the created container redacted, and the
+	// environment of the container that is yet to be created intact
+	testClient, err = NewWithSetup(testDir, WithEnvironmentScrubber(scrubber))
+	require.NoError(t, err)
+	defer testClient.Close()
+	tasks, err := testClient.GetTasks()
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	require.Len(t, tasks[0].Containers, 2)
+	assert.Equal(t, map[string]string{"DB_PASSWORD": envscrub.RedactionMarker, "LOG_LEVEL": "debug"},
+		tasks[0].Containers[0].Environment)
+	assert.JSONEq(t, `{"Env":["API_KEY=[redacted]","PATH=/usr/bin"],"StopTimeout":1234567890123}`,
+		aws.StringValue(tasks[0].Containers[0].DockerConfig.Config))
+	assert.Equal(t, testPendingSecret, tasks[0].Containers[1].Environment["DB_PASSWORD"])
+
+	containers, err := testClient.GetContainers()
+	require.NoError(t, err)
+	require.Len(t, containers, 2)
+	for _, container := range containers {
+		switch container.Container.Name {
+		case testContainerName:
+			assert.Equal(t, testDockerID, container.DockerID)
+			assert.Equal(t, apicontainerstatus.ContainerRunning, container.Container.GetKnownStatus())
+			assert.Equal(t, envscrub.RedactionMarker, container.Container.Environment["DB_PASSWORD"])
+			assert.Equal(t, "debug", container.Container.Environment["LOG_LEVEL"])
+			// Numbers of the docker config are kept as they are
+			assert.JSONEq(t, `{"Env":["API_KEY=[redacted]","PATH=/usr/bin"],"StopTimeout":1234567890123}`,
+				aws.StringValue(container.Container.DockerConfig.Config))
+		case testContainerName2:
+			assert.Equal(t, testPendingSecret, container.Container.Environment["DB_PASSWORD"])
+		default:
+			t.Errorf("unexpected container %s", container.Container.Name)
+		}
+	}
+}
+
+func TestEnvironmentNotScrubbedWithoutScrubber(t *testing.T) {
+	testClient := newTestClient(t)
+	created := newScrubbedContainer(testContainerName, apicontainerstatus.ContainerRunning, testSeededSecret,
+		testSeededConfigSecret)
+	require.NoError(t, testClient.SaveContainer(created))
+
+	containers, err := testClient.GetContainers()
+	require.NoError(t, err)
+	require.Len(t, containers, 1)
+	assert.Equal(t, testSeededSecret, containers[0].Container.Environment["DB_PASSWORD"])
+}
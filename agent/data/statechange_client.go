@@ -0,0 +1,52 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"encoding/json"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func (c *client) SavePendingTaskStateChanges(changes *api.PendingTaskStateChanges) error {
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(taskStateChangesBucket))
+		return putObject(b, changes.TaskARN, changes)
+	})
+}
+
+func (c *client) DeletePendingTaskStateChanges(taskARN string) error {
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(taskStateChangesBucket))
+		return b.Delete([]byte(taskARN))
+	})
+}
+
+func (c *client) GetPendingTaskStateChanges() ([]*api.PendingTaskStateChanges, error) {
+	var pendingChanges []*api.PendingTaskStateChanges
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(taskStateChangesBucket))
+		return walk(bucket, func(id string, data []byte) error {
+			changes := api.PendingTaskStateChanges{}
+			if err := json.Unmarshal(data, &changes); err != nil {
+				return err
+			}
+			pendingChanges = append(pendingChanges, &changes)
+			return nil
+		})
+	})
+	return pendingChanges, err
+}
@@ -0,0 +1,72 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagePendingTaskStateChanges(t *testing.T) {
+	testClient := newTestClient(t)
+
+	exitCode := 1
+	pendingChanges := &api.PendingTaskStateChanges{
+		TaskARN: testTaskArn,
+		Changes: []api.TaskStateChangeRecord{
+			{
+				Status: apitaskstatus.TaskRunning,
+				Containers: []api.ContainerStateChangeRecord{
+					{ContainerName: "c1", Status: apicontainerstatus.ContainerRunning},
+				},
+			},
+			{
+				Status: apitaskstatus.TaskStopped,
+				Reason: "Essential container exited",
+				Containers: []api.ContainerStateChangeRecord{
+					{ContainerName: "c1", Status: apicontainerstatus.ContainerStopped, ExitCode: &exitCode},
+				},
+			},
+		},
+	}
+	require.NoError(t, testClient.SavePendingTaskStateChanges(pendingChanges))
+
+	res, err := testClient.GetPendingTaskStateChanges()
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, pendingChanges, res[0])
+
+	// Saving again replaces the changes of the task
+	pendingChanges.Changes = pendingChanges.Changes[1:]
+	require.NoError(t, testClient.SavePendingTaskStateChanges(pendingChanges))
+	res, err = testClient.GetPendingTaskStateChanges()
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Len(t, res[0].Changes, 1)
+	assert.Equal(t, apitaskstatus.TaskStopped, res[0].Changes[0].Status)
+
+	require.NoError(t, testClient.DeletePendingTaskStateChanges(testTaskArn))
+	res, err = testClient.GetPendingTaskStateChanges()
+	require.NoError(t, err)
+	assert.Len(t, res, 0)
+}
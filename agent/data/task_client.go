@@ -29,9 +29,13 @@ func (c *client) SaveTask(task *apitask.Task) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to generate database id")
 	}
+	data, err := c.marshalTask(task)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal object with key %q", id)
+	}
 	return c.db.Batch(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(tasksBucketName))
-		return putObject(b, id, task)
+		return putData(b, id, data)
 	})
 }
 
@@ -0,0 +1,328 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/sdkclient"
+	"github.com/cihub/seelog"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// CircuitBreakerClosed means calls to the docker daemon go through as usual.
+	CircuitBreakerClosed = "CLOSED"
+	// CircuitBreakerOpen means calls to the docker daemon are short-circuited until
+	// the cool-down elapses.
+	CircuitBreakerOpen = "OPEN"
+	// CircuitBreakerHalfOpen means the cool-down has elapsed and a single call is let
+	// through to find out whether the daemon is back. Other calls are short-circuited
+	// until it returns, and a connection failure opens the breaker again.
+	CircuitBreakerHalfOpen = "HALF_OPEN"
+
+	// DockerUnavailableErrorName is the name of the error returned for calls that
+	// are short-circuited by an open breaker.
+	DockerUnavailableErrorName = "DockerUnavailableError"
+)
+
+// DockerUnavailableError is returned instead of calling the docker daemon while the
+// circuit breaker is open.
+type DockerUnavailableError struct {
+	// RetryAfter is how long until the breaker lets calls through again.
+	RetryAfter time.Duration
+}
+
+func (err DockerUnavailableError) Error() string {
+	return "docker daemon is unavailable; calls are suspended for another " + err.RetryAfter.String()
+}
+
+// ErrorName returns the name of the DockerUnavailableError.
+func (err DockerUnavailableError) ErrorName() string {
+	return DockerUnavailableErrorName
+}
+
+// IsRetriableError returns a boolean indicating whether the call that
+// generated the error can be retried.
+func (err DockerUnavailableError) IsRetriableError() bool {
+	return true
+}
+
+// CircuitBreakerStatus is a snapshot of the state of a circuit breaker.
+type CircuitBreakerStatus struct {
+	State               string     `json:"State"`
+	ConsecutiveFailures int        `json:"ConsecutiveFailures"`
+	OpenedAt            *time.Time `json:"OpenedAt,omitempty"`
+}
+
+// CircuitBreakerReporter is implemented by docker clients that guard calls to the
+// daemon with a circuit breaker.
+type CircuitBreakerReporter interface {
+	// CircuitBreakerStatus returns the current status of the breaker.
+	CircuitBreakerStatus() CircuitBreakerStatus
+}
+
+// CircuitBreaker counts consecutive connection failures and timeouts of calls to the
+// docker daemon. Once the threshold is reached, it opens and short-circuits calls for
+// the cool-down period, after which it lets a single probe call through to tell it
+// whether the daemon is back.
+type CircuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+	now       func() time.Time
+
+	state               string
+	consecutiveFailures int
+	openedAt            time.Time
+	// probeStartedAt is when the probe of the half-open breaker was let through, it is
+	// zero if no probe is in flight. A probe whose outcome isn't recorded within the
+	// cool-down is given up on, so that another one is let through.
+	probeStartedAt time.Time
+	lock           sync.Mutex
+}
+
+// NewCircuitBreaker creates a circuit breaker that opens after threshold
+// consecutive connection failures and stays open for coolDown.
+func NewCircuitBreaker(threshold int, coolDown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		now:       time.Now,
+		state:     CircuitBreakerClosed,
+	}
+}
+
+// Allow returns a DockerUnavailableError if calls to the daemon should be
+// short-circuited.
+func (cb *CircuitBreaker) Allow() error {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	now := cb.now()
+	switch cb.state {
+	case CircuitBreakerOpen:
+		remaining := cb.coolDown - now.Sub(cb.openedAt)
+		if remaining > 0 {
+			return DockerUnavailableError{RetryAfter: remaining}
+		}
+		seelog.Infof("DockerGoClient: circuit breaker cool-down elapsed, probing the docker daemon")
+		cb.state = CircuitBreakerHalfOpen
+	case CircuitBreakerHalfOpen:
+		if !cb.probeStartedAt.IsZero() {
+			remaining := cb.coolDown - now.Sub(cb.probeStartedAt)
+			if remaining > 0 {
+				return DockerUnavailableError{RetryAfter: remaining}
+			}
+			seelog.Warnf("DockerGoClient: circuit breaker probe didn't complete within %s, probing again",
+				cb.coolDown)
+		}
+	default:
+		return nil
+	}
+	cb.probeStartedAt = now
+	return nil
+}
+
+// Record updates the breaker with the outcome of a call to the daemon. Any
+// response from the daemon, including API errors, closes the breaker; only
+// connection errors and timeouts count as failures.
+func (cb *CircuitBreaker) Record(err error) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	// Another probe is let through if the call was the probe and its caller gave up
+	cb.probeStartedAt = time.Time{}
+	if errors.Is(err, context.Canceled) {
+		// The caller gave up, which says nothing about the daemon
+		return
+	}
+
+	if err == nil || !(IsConnectionError(err) || errors.Is(err, context.DeadlineExceeded)) {
+		if cb.state != CircuitBreakerClosed {
+			seelog.Infof("DockerGoClient: docker daemon is reachable again, closing circuit breaker")
+		}
+		cb.state = CircuitBreakerClosed
+		cb.consecutiveFailures = 0
+		cb.openedAt = time.Time{}
+		return
+	}
+
+	cb.consecutiveFailures++
+	if cb.state == CircuitBreakerHalfOpen ||
+		(cb.state == CircuitBreakerClosed && cb.consecutiveFailures >= cb.threshold) {
+		seelog.Errorf("DockerGoClient: opening circuit breaker after %d consecutive connection failures or timeouts, "+
+			"suspending calls to the docker daemon for %s: %v", cb.consecutiveFailures, cb.coolDown, err)
+		cb.state = CircuitBreakerOpen
+		cb.openedAt = cb.now()
+	}
+}
+
+// Status returns the current status of the breaker.
+func (cb *CircuitBreaker) Status() CircuitBreakerStatus {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	status := CircuitBreakerStatus{
+		State:               cb.state,
+		ConsecutiveFailures: cb.consecutiveFailures,
+	}
+	if !cb.openedAt.IsZero() {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// IsConnectionError returns whether the error means that the docker daemon could
+// not be reached, as opposed to the daemon answering with an error.
+func IsConnectionError(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case CannotDescribeContainerError:
+		return IsConnectionError(e.FromError)
+	case *CannotInspectContainerError:
+		return IsConnectionError(e.FromError)
+	case CannotGetDockerClientError:
+		return IsConnectionError(e.err)
+	}
+
+	var unavailable DockerUnavailableError
+	if errors.As(err, &unavailable) || client.IsErrConnectionFailed(err) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// breakerClient records the outcome of calls to the daemon with a circuit breaker.
+// Calls that aren't overridden here are forwarded without being recorded.
+type breakerClient struct {
+	sdkclient.Client
+	breaker *CircuitBreaker
+}
+
+func (c *breakerClient) ContainerCreate(ctx context.Context, config *container.Config,
+	hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform,
+	containerName string) (container.ContainerCreateCreatedBody, error) {
+	resp, err := c.Client.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	resp, err := c.Client.ContainerInspect(ctx, containerID)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	resp, err := c.Client.ContainerList(ctx, options)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	err := c.Client.ContainerRemove(ctx, containerID, options)
+	c.breaker.Record(err)
+	return err
+}
+
+func (c *breakerClient) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	err := c.Client.ContainerStart(ctx, containerID, options)
+	c.breaker.Record(err)
+	return err
+}
+
+func (c *breakerClient) ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error {
+	err := c.Client.ContainerStop(ctx, containerID, timeout)
+	c.breaker.Record(err)
+	return err
+}
+
+func (c *breakerClient) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	resp, raw, err := c.Client.ImageInspectWithRaw(ctx, imageID)
+	c.breaker.Record(err)
+	return resp, raw, err
+}
+
+func (c *breakerClient) ImagePull(ctx context.Context, refStr string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	resp, err := c.Client.ImagePull(ctx, refStr, options)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) ImageRemove(ctx context.Context, imageID string,
+	options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	resp, err := c.Client.ImageRemove(ctx, imageID, options)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) Ping(ctx context.Context) (types.Ping, error) {
+	resp, err := c.Client.Ping(ctx)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) PluginList(ctx context.Context, filter filters.Args) (types.PluginsListResponse, error) {
+	resp, err := c.Client.PluginList(ctx, filter)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) VolumeCreate(ctx context.Context, options volume.VolumeCreateBody) (types.Volume, error) {
+	resp, err := c.Client.VolumeCreate(ctx, options)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) VolumeInspect(ctx context.Context, volumeID string) (types.Volume, error) {
+	resp, err := c.Client.VolumeInspect(ctx, volumeID)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	err := c.Client.VolumeRemove(ctx, volumeID, force)
+	c.breaker.Record(err)
+	return err
+}
+
+func (c *breakerClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	resp, err := c.Client.ServerVersion(ctx)
+	c.breaker.Record(err)
+	return resp, err
+}
+
+func (c *breakerClient) Info(ctx context.Context) (types.Info, error) {
+	resp, err := c.Client.Info(ctx)
+	c.breaker.Record(err)
+	return resp, err
+}
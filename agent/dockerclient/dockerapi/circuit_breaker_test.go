@@ -0,0 +1,198 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	dialErr := &net.OpError{
+		Op:  "dial",
+		Net: "unix",
+		Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"connection failed", client.ErrorConnectionFailed("unix:///var/run/docker.sock"), true},
+		{"connection refused", dialErr, true},
+		{"socket missing", &net.OpError{Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", syscall.ENOENT)}, true},
+		{"breaker open", DockerUnavailableError{RetryAfter: time.Second}, true},
+		{"wrapped in describe error", CannotDescribeContainerError{FromError: dialErr}, true},
+		{"wrapped in client error", CannotGetDockerClientError{err: client.ErrorConnectionFailed("")}, true},
+		{"not found", errdefs.NotFound(errors.New("No such container: c1")), false},
+		{"server error", errdefs.System(errors.New("driver failed")), false},
+		{"read error", &net.OpError{Op: "read", Net: "unix", Err: syscall.ECONNRESET}, false},
+		{"api error in describe error", CannotDescribeContainerError{FromError: errors.New("No such container: c1")}, false},
+		{"timeout", &DockerTimeoutError{Duration: time.Second, Transition: "inspecting"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsConnectionError(tc.err))
+		})
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(3, 30*time.Second)
+	breaker.now = func() time.Time { return now }
+	connErr := client.ErrorConnectionFailed("unix:///var/run/docker.sock")
+
+	// API errors mean the daemon is up, so they don't count
+	breaker.Record(connErr)
+	breaker.Record(connErr)
+	breaker.Record(errdefs.NotFound(errors.New("No such container: c1")))
+	assert.Equal(t, CircuitBreakerClosed, breaker.Status().State)
+	assert.Equal(t, 0, breaker.Status().ConsecutiveFailures)
+
+	// Callers giving up don't count either, but timeouts do
+	breaker.Record(context.Canceled)
+	assert.Equal(t, 0, breaker.Status().ConsecutiveFailures)
+	breaker.Record(fmt.Errorf("inspecting container: %w", context.DeadlineExceeded))
+	assert.Equal(t, 1, breaker.Status().ConsecutiveFailures)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.Allow())
+		breaker.Record(connErr)
+	}
+	status := breaker.Status()
+	assert.Equal(t, CircuitBreakerOpen, status.State)
+	assert.Equal(t, 3, status.ConsecutiveFailures)
+	require.NotNil(t, status.OpenedAt)
+	assert.Equal(t, now, *status.OpenedAt)
+
+	now = now.Add(10 * time.Second)
+	err := breaker.Allow()
+	require.Error(t, err)
+	var unavailable DockerUnavailableError
+	require.True(t, errors.As(err, &unavailable))
+	assert.Equal(t, 20*time.Second, unavailable.RetryAfter)
+
+	// A single probe is let through after the cool-down
+	now = now.Add(20 * time.Second)
+	assert.NoError(t, breaker.Allow())
+	assert.Equal(t, CircuitBreakerHalfOpen, breaker.Status().State)
+	assert.True(t, errors.As(breaker.Allow(), &unavailable))
+	// Another one is let through if its caller gives up on it
+	breaker.Record(context.Canceled)
+	assert.NoError(t, breaker.Allow())
+	// A failure of the probe opens the breaker again straight away
+	breaker.Record(connErr)
+	assert.Equal(t, CircuitBreakerOpen, breaker.Status().State)
+	assert.Error(t, breaker.Allow())
+
+	// A success after the cool-down closes it
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, breaker.Allow())
+	breaker.Record(nil)
+	status = breaker.Status()
+	assert.Equal(t, CircuitBreakerClosed, status.State)
+	assert.Equal(t, 0, status.ConsecutiveFailures)
+	assert.Nil(t, status.OpenedAt)
+	assert.NoError(t, breaker.Allow())
+	assert.NoError(t, breaker.Allow())
+}
+
+// TestCircuitBreakerStuckProbe tests that another probe is let through if the outcome of
+// the probe isn't recorded within the cool-down.
+func TestCircuitBreakerStuckProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, 30*time.Second)
+	breaker.now = func() time.Time { return now }
+	breaker.Record(client.ErrorConnectionFailed("unix:///var/run/docker.sock"))
+	require.Equal(t, CircuitBreakerOpen, breaker.Status().State)
+
+	now = now.Add(30 * time.Second)
+	require.NoError(t, breaker.Allow())
+	now = now.Add(10 * time.Second)
+	err := breaker.Allow()
+	var unavailable DockerUnavailableError
+	require.True(t, errors.As(err, &unavailable))
+	assert.Equal(t, 20*time.Second, unavailable.RetryAfter)
+
+	now = now.Add(20 * time.Second)
+	assert.NoError(t, breaker.Allow())
+	assert.Equal(t, CircuitBreakerHalfOpen, breaker.Status().State)
+}
+
+func TestDockerClientCircuitBreaker(t *testing.T) {
+	conf := config.DefaultConfig()
+	conf.DockerCircuitBreakerThreshold = 2
+	conf.DockerCircuitBreakerCoolDown = time.Minute
+	mockDockerSDK, goClient, _, _, _, done := dockerClientSetupWithConfig(t, conf)
+	defer done()
+
+	connErr := &net.OpError{Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	mockDockerSDK.EXPECT().ContainerInspect(gomock.Any(), "id").Return(types.ContainerJSON{}, connErr).Times(2)
+
+	for i := 0; i < 2; i++ {
+		_, metadata := goClient.DescribeContainer(context.TODO(), "id")
+		assert.True(t, IsConnectionError(metadata.Error))
+	}
+	assert.Equal(t, CircuitBreakerOpen, goClient.CircuitBreakerStatus().State)
+
+	// Calls are short-circuited without reaching the daemon while the breaker is open
+	_, metadata := goClient.DescribeContainer(context.TODO(), "id")
+	require.Error(t, metadata.Error)
+	assert.True(t, IsConnectionError(metadata.Error))
+	_, err := goClient.InspectContainer(context.TODO(), "id", dockerclient.InspectContainerTimeout)
+	var unavailable DockerUnavailableError
+	assert.True(t, errors.As(err, &unavailable))
+
+	// The daemon answering after the cool-down closes the breaker
+	goClient.breaker.now = func() time.Time { return time.Now().Add(time.Minute) }
+	mockDockerSDK.EXPECT().ContainerInspect(gomock.Any(), "id").Return(types.ContainerJSON{}, nil)
+	_, err = goClient.InspectContainer(context.TODO(), "id", dockerclient.InspectContainerTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitBreakerClosed, goClient.CircuitBreakerStatus().State)
+}
+
+func TestDockerClientCircuitBreakerDisabled(t *testing.T) {
+	conf := config.DefaultConfig()
+	conf.DockerCircuitBreakerThreshold = -1
+	mockDockerSDK, goClient, _, _, _, done := dockerClientSetupWithConfig(t, conf)
+	defer done()
+
+	connErr := client.ErrorConnectionFailed("")
+	mockDockerSDK.EXPECT().ContainerInspect(gomock.Any(), "id").Return(types.ContainerJSON{}, connErr).Times(10)
+	for i := 0; i < 10; i++ {
+		goClient.DescribeContainer(context.TODO(), "id")
+	}
+	assert.Equal(t, CircuitBreakerStatus{State: CircuitBreakerClosed}, goClient.CircuitBreakerStatus())
+}
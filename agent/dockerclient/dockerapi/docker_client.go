@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"strconv"
 	"strings"
 	"sync"
@@ -40,6 +41,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient/sdkclient"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient/sdkclientfactory"
 	"github.com/aws/amazon-ecs-agent/agent/ecr"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
 	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	apierrors "github.com/aws/amazon-ecs-agent/ecs-agent/api/errors"
@@ -136,6 +138,12 @@ type DockerClient interface {
 	// for the request.
 	StopContainer(context.Context, string, time.Duration) DockerContainerMetadata
 
+	// AttachContainer attaches to the output streams of the container identified by the name provided, and returns
+	// the stream of the output of the container, which is multiplexed unless the container has a TTY. Attaching
+	// before the container is started streams all of its output. A timeout value and a context should be provided
+	// for the request, which only bound attaching. The caller is responsible for closing the stream.
+	AttachContainer(context.Context, string, time.Duration) (io.ReadCloser, error)
+
 	// DescribeContainer returns status information about the specified container. A context should be provided
 	// for the request
 	DescribeContainer(context.Context, string) (apicontainerstatus.ContainerStatus, DockerContainerMetadata)
@@ -241,6 +249,11 @@ type dockerGoClient struct {
 	context                  context.Context
 	imagePullBackoff         retry.Backoff
 	inactivityTimeoutHandler inactivityTimeoutHandlerFunc
+	// breaker short-circuits calls to the daemon after repeated connection failures.
+	// It is nil if the circuit breaker is disabled.
+	breaker *CircuitBreaker
+	// registryHTTPClient retrieves image manifests from registries.
+	registryHTTPClient *http.Client
 
 	_time     ttime.Time
 	_timeOnce sync.Once
@@ -267,6 +280,9 @@ func (dg *dockerGoClient) WithVersion(version dockerclient.DockerVersion) Docker
 		auth:             dg.auth,
 		config:           dg.config,
 		context:          dg.context,
+		breaker:          dg.breaker,
+
+		registryHTTPClient: dg.registryHTTPClient,
 	}
 }
 
@@ -299,22 +315,52 @@ func NewDockerGoClient(sdkclientFactory sdkclientfactory.Factory,
 	return &dockerGoClient{
 		sdkClientFactory: sdkclientFactory,
 		auth:             dockerauth.NewDockerAuthProvider(cfg.EngineAuthType, dockerAuthData),
-		ecrClientFactory: ecr.NewECRFactory(cfg.AcceptInsecureCert),
+		ecrClientFactory: ecr.NewECRFactory(cfg.AcceptInsecureCert, cfg.EndpointResolver()),
 		ecrTokenCache:    async.NewLRUCache(tokenCacheSize, tokenCacheTTL),
 		config:           cfg,
 		context:          ctx,
 		imagePullBackoff: retry.NewExponentialBackoff(minimumPullRetryDelay, maximumPullRetryDelay,
 			pullRetryJitterMultiplier, pullRetryDelayMultiplier),
 		inactivityTimeoutHandler: handleInactivityTimeout,
+		breaker:                  newCircuitBreakerFromConfig(cfg),
+		registryHTTPClient:       httpclient.New(dockerclient.ImageManifestInspectTimeout, cfg.AcceptInsecureCert),
 	}, nil
 }
 
 // Returns the Docker SDK Client
 func (dg *dockerGoClient) sdkDockerClient() (sdkclient.Client, error) {
+	if dg.breaker != nil {
+		if err := dg.breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+	var sdkClient sdkclient.Client
+	var err error
 	if dg.version == "" {
-		return dg.sdkClientFactory.GetDefaultClient()
+		sdkClient, err = dg.sdkClientFactory.GetDefaultClient()
+	} else {
+		sdkClient, err = dg.sdkClientFactory.GetClient(dg.version)
+	}
+	if err != nil || dg.breaker == nil {
+		return sdkClient, err
 	}
-	return dg.sdkClientFactory.GetClient(dg.version)
+	return &breakerClient{Client: sdkClient, breaker: dg.breaker}, nil
+}
+
+// CircuitBreakerStatus returns the status of the circuit breaker guarding calls to
+// the docker daemon. The breaker is always reported closed if it is disabled.
+func (dg *dockerGoClient) CircuitBreakerStatus() CircuitBreakerStatus {
+	if dg.breaker == nil {
+		return CircuitBreakerStatus{State: CircuitBreakerClosed}
+	}
+	return dg.breaker.Status()
+}
+
+func newCircuitBreakerFromConfig(cfg *config.Config) *CircuitBreaker {
+	if cfg.DockerCircuitBreakerThreshold <= 0 {
+		return nil
+	}
+	return NewCircuitBreaker(cfg.DockerCircuitBreakerThreshold, cfg.DockerCircuitBreakerCoolDown)
 }
 
 func (dg *dockerGoClient) time() ttime.Time {
@@ -346,6 +392,7 @@ func (dg *dockerGoClient) PullImage(ctx context.Context, image string,
 
 	select {
 	case resp := <-response:
+		recordPullFailure(resp.Error)
 		return resp
 	case <-ctx.Done():
 		// Context has either expired or canceled. If it has timed out,
@@ -356,8 +403,25 @@ func (dg *dockerGoClient) PullImage(ctx context.Context, image string,
 		}
 		// Context was canceled even though there was no timeout. Send
 		// back an error.
-		return DockerContainerMetadata{Error: &CannotPullContainerError{err}}
+		pullErr := &CannotPullContainerError{err}
+		recordPullFailure(pullErr)
+		return DockerContainerMetadata{Error: pullErr}
+	}
+}
+
+// recordPullFailure records the category of the cause of a pull failure, if the
+// failure is a CannotPullContainerError.
+func recordPullFailure(err apierrors.NamedError) {
+	var pullErr CannotPullContainerError
+	switch e := err.(type) {
+	case CannotPullContainerError:
+		pullErr = e
+	case *CannotPullContainerError:
+		pullErr = *e
+	default:
+		return
 	}
+	metrics.MetricsEngineGlobal.RecordImagePullFailure(string(pullErr.Category()))
 }
 
 func wrapPullErrorAsNamedError(err error) apierrors.NamedError {
@@ -409,6 +473,9 @@ func (dg *dockerGoClient) pullImage(ctx context.Context, image string,
 
 	go func() {
 		defer cancelRequest()
+		progress := NewPullProgressTracker()
+		registerPullProgress(image, progress)
+		defer deregisterPullProgress(image, progress)
 		reader, err := client.ImagePull(subCtx, repository, imagePullOpts)
 		if err != nil {
 			pullFinished <- err
@@ -446,6 +513,10 @@ func (dg *dockerGoClient) pullImage(ctx context.Context, image string,
 			})
 
 			statusDisplayed = dg.filterPullDebugOutput(data, image, statusDisplayed)
+			progress.Update(data)
+			if progress.shouldLog(time.Now(), dg.config.ImagePullProgressLogInterval) {
+				logPullProgress(image, progress.Progress())
+			}
 
 			data = new(ImagePullResponse)
 		}
@@ -491,6 +562,15 @@ func (dg *dockerGoClient) filterPullDebugOutput(data *ImagePullResponse, image s
 	return now
 }
 
+func logPullProgress(image string, progress ImagePullProgress) {
+	percent := "unknown"
+	if progress.Percent != nil {
+		percent = fmt.Sprintf("%.1f%%", *progress.Percent)
+	}
+	seelog.Infof("DockerGoClient: pulling image %s, progress %s, %d bytes downloaded, %d/%d layers downloaded",
+		image, percent, progress.BytesDownloaded, progress.LayersDownloaded, progress.LayersTotal)
+}
+
 func getRepository(image string) string {
 	repository, tag := utils.ParseRepositoryTag(image)
 	if tag == "" {
@@ -639,6 +719,70 @@ func DockerStateToState(state *types.ContainerState) apicontainerstatus.Containe
 	return apicontainerstatus.ContainerStopped
 }
 
+func (dg *dockerGoClient) AttachContainer(ctx context.Context, id string, timeout time.Duration) (io.ReadCloser, error) {
+	type attachContainerResponse struct {
+		stream io.ReadCloser
+		err    error
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	defer metrics.MetricsEngineGlobal.RecordDockerMetric("ATTACH_CONTAINER")()
+	response := make(chan attachContainerResponse, 1)
+	go func() {
+		stream, err := dg.attachContainer(ctx, id)
+		response <- attachContainerResponse{stream, err}
+	}()
+
+	select {
+	case resp := <-response:
+		return resp.stream, resp.err
+	case <-ctx.Done():
+		// The stream of a request that completes after the timeout is closed, since
+		// nothing reads it
+		go func() {
+			if resp := <-response; resp.stream != nil {
+				resp.stream.Close()
+			}
+		}()
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			return nil, &DockerTimeoutError{timeout, "attached"}
+		}
+		return nil, &CannotAttachContainerError{err}
+	}
+}
+
+func (dg *dockerGoClient) attachContainer(ctx context.Context, id string) (io.ReadCloser, error) {
+	client, err := dg.sdkDockerClient()
+	if err != nil {
+		return nil, &CannotAttachContainerError{err}
+	}
+	hijacked, err := client.ContainerAttach(ctx, id, types.ContainerAttachOptions{
+		Stream: true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, &CannotAttachContainerError{err}
+	}
+	return &hijackedStream{hijacked}, nil
+}
+
+// hijackedStream is the stream of the output of a hijacked connection.
+type hijackedStream struct {
+	types.HijackedResponse
+}
+
+func (s *hijackedStream) Read(p []byte) (int, error) {
+	return s.Reader.Read(p)
+}
+
+func (s *hijackedStream) Close() error {
+	s.HijackedResponse.Close()
+	return nil
+}
+
 func (dg *dockerGoClient) DescribeContainer(ctx context.Context, dockerID string) (apicontainerstatus.ContainerStatus, DockerContainerMetadata) {
 	dockerContainer, err := dg.InspectContainer(ctx, dockerID, dockerclient.InspectContainerTimeout)
 	if err != nil {
@@ -824,6 +968,7 @@ func MetadataFromContainer(dockerContainer *types.ContainerJSON) DockerContainer
 	if dockerContainer.State == nil {
 		return metadata
 	}
+	metadata.PID = dockerContainer.State.Pid
 	if !dockerContainer.State.Running && !finishedTime.IsZero() {
 		// Only record an exitcode if it has exited
 		metadata.ExitCode = &dockerContainer.State.ExitCode
@@ -885,6 +1030,9 @@ func (dg *dockerGoClient) ContainerEvents(ctx context.Context) (<-chan DockerCon
 	events := make(chan *events.Message)
 	buffer := NewInfiniteBuffer()
 
+	// reconcile is signaled every time the event stream is reopened.
+	reconcile := make(chan struct{}, 1)
+
 	derivedCtx, cancel := context.WithCancel(ctx)
 	dockerEvents, eventErr := client.Events(derivedCtx, types.EventsOptions{})
 
@@ -907,15 +1055,27 @@ func (dg *dockerGoClient) ContainerEvents(ctx context.Context) (<-chan DockerCon
 					seelog.Errorf("DockerGoClient: Docker events stream closed with error: %v", err)
 				}
 
-				// Reopen a new event stream to continue listening.
+				// Reopen a new event stream to continue listening. Resume from the last event
+				// seen so that events emitted while the stream was down are replayed; the
+				// buffer drops the ones that were already processed.
 				nextCtx, nextCancel := context.WithCancel(ctx)
-				dockerEvents, eventErr = client.Events(nextCtx, types.EventsOptions{})
+				options := types.EventsOptions{}
+				if lastEventTime := buffer.LastEventTime(); !lastEventTime.IsZero() {
+					options.Since = eventsSinceCursor(lastEventTime)
+				}
+				dockerEvents, eventErr = client.Events(nextCtx, options)
 				// Cache the event from docker client.
 				go buffer.StartListening(nextCtx, dockerEvents)
 				// Close previous stream after starting to listen on new one
 				cancel()
 				// Reassign cancel variable next Cancel function to setup next iteration of loop.
 				cancel = nextCancel
+				// The daemon may have restarted and lost the events of the gap, so also
+				// re-inspect the containers seen so far.
+				select {
+				case reconcile <- struct{}{}:
+				default:
+				}
 			case <-ctx.Done():
 				return
 			}
@@ -925,70 +1085,200 @@ func (dg *dockerGoClient) ContainerEvents(ctx context.Context) (<-chan DockerCon
 	// Read the buffered events and send to task engine
 	go buffer.Consume(events)
 	changedContainers := make(chan DockerContainerChangeEvent)
-	go dg.handleContainerEvents(ctx, events, changedContainers)
+	go dg.handleContainerEvents(ctx, events, reconcile, changedContainers)
 
 	return changedContainers, nil
 }
 
+// eventsSinceCursor formats t the way the docker events API expects its since
+// filter, which keeps nanosecond precision.
+func eventsSinceCursor(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), int64(t.Nanosecond()))
+}
+
 func (dg *dockerGoClient) handleContainerEvents(ctx context.Context,
 	events <-chan *events.Message,
+	reconcile <-chan struct{},
 	changedContainers chan<- DockerContainerChangeEvent) {
-	for event := range events {
-		containerID := event.ID
-		seelog.Debugf("DockerGoClient: got event from docker daemon: %v", event)
-
-		var status apicontainerstatus.ContainerStatus
-		eventType := apicontainer.ContainerStatusEvent
-		switch event.Status {
-		case "create":
-			status = apicontainerstatus.ContainerCreated
-			changedContainers <- DockerContainerChangeEvent{
-				Status: status,
-				Type:   eventType,
-				DockerContainerMetadata: DockerContainerMetadata{
-					DockerID: containerID,
-				},
-			}
-			continue
-		case "start":
-			status = apicontainerstatus.ContainerRunning
-		case "stop":
-			fallthrough
-		case "die":
-			status = apicontainerstatus.ContainerStopped
-		case "oom":
-			containerInfo := event.ID
-			// events only contain the container's name in newer Docker API
-			// versions (starting with 1.22)
-			if containerName, ok := event.Actor.Attributes["name"]; ok {
-				containerInfo += fmt.Sprintf(" (name: %q)", containerName)
-			}
+	tracker := newContainerStatusTracker()
+	for {
+		select {
+		case event := <-events:
+			dg.handleContainerEvent(ctx, event, tracker, changedContainers)
+		case <-reconcile:
+			dg.reconcileContainers(ctx, tracker, changedContainers)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-			seelog.Infof("DockerGoClient: process within container %s died due to OOM", containerInfo)
-			// "oom" can either means any process got OOM'd, but doesn't always
-			// mean the container dies (non-init processes). If the container also
-			// dies, you see a "die" status as well; we'll update suitably there
-			continue
-		case "health_status: healthy":
-			fallthrough
-		case "health_status: unhealthy":
-			eventType = apicontainer.ContainerHealthEvent
-		default:
-			// Because docker emits new events even when you use an old event api
-			// version, it's not that big a deal
-			seelog.Debugf("DockerGoClient: unknown status event from docker: %v", event)
+func (dg *dockerGoClient) handleContainerEvent(ctx context.Context,
+	event *events.Message,
+	tracker *containerStatusTracker,
+	changedContainers chan<- DockerContainerChangeEvent) {
+	containerID := event.ID
+	seelog.Debugf("DockerGoClient: got event from docker daemon: %v", event)
+
+	var status apicontainerstatus.ContainerStatus
+	eventType := apicontainer.ContainerStatusEvent
+	switch event.Status {
+	case "create":
+		status = apicontainerstatus.ContainerCreated
+		if !tracker.observe(containerID, status) {
+			return
+		}
+		changedContainers <- DockerContainerChangeEvent{
+			Status: status,
+			Type:   eventType,
+			DockerContainerMetadata: DockerContainerMetadata{
+				DockerID: containerID,
+			},
+		}
+		return
+	case "start":
+		status = apicontainerstatus.ContainerRunning
+	case "stop":
+		fallthrough
+	case "die":
+		status = apicontainerstatus.ContainerStopped
+	case "oom":
+		containerInfo := event.ID
+		// events only contain the container's name in newer Docker API
+		// versions (starting with 1.22)
+		if containerName, ok := event.Actor.Attributes["name"]; ok {
+			containerInfo += fmt.Sprintf(" (name: %q)", containerName)
 		}
 
-		metadata := dg.containerMetadata(ctx, containerID)
-		// In case when we received a container die event but was not able to inspect the container (e.g. due to timeout),
-		// we will use the exit code from the event, so that the exit code of the container is still reported and
-		// available for customer to see from describing task.
-		setExitCodeFromEvent(event, &metadata)
+		seelog.Infof("DockerGoClient: process within container %s died due to OOM", containerInfo)
+		// "oom" can either means any process got OOM'd, but doesn't always
+		// mean the container dies (non-init processes). If the container also
+		// dies, you see a "die" status as well; we'll update suitably there
+		return
+	case "health_status: healthy":
+		fallthrough
+	case "health_status: unhealthy":
+		eventType = apicontainer.ContainerHealthEvent
+	default:
+		// Because docker emits new events even when you use an old event api
+		// version, it's not that big a deal
+		seelog.Debugf("DockerGoClient: unknown status event from docker: %v", event)
+	}
 
+	if eventType == apicontainer.ContainerStatusEvent && !tracker.observe(containerID, status) {
+		return
+	}
+
+	metadata := dg.containerMetadata(ctx, containerID)
+	// In case when we received a container die event but was not able to inspect the container (e.g. due to timeout),
+	// we will use the exit code from the event, so that the exit code of the container is still reported and
+	// available for customer to see from describing task.
+	setExitCodeFromEvent(event, &metadata)
+
+	changedContainers <- DockerContainerChangeEvent{
+		Status:                  status,
+		Type:                    eventType,
+		DockerContainerMetadata: metadata,
+	}
+}
+
+// reconcileContainers inspects every container the event stream has reported
+// and is not known to be stopped, and reports the ones whose state changed
+// without a corresponding event, e.g. because the daemon restarted while the
+// events stream was down.
+func (dg *dockerGoClient) reconcileContainers(ctx context.Context,
+	tracker *containerStatusTracker,
+	changedContainers chan<- DockerContainerChangeEvent) {
+	tracker.pruneStopped()
+	for containerID, knownStatus := range tracker.known {
+		dockerContainer, err := dg.InspectContainer(ctx, containerID, dockerclient.InspectContainerTimeout)
+		if err != nil {
+			seelog.Warnf("DockerGoClient: unable to inspect container %s while reconciling missed docker events: %v",
+				containerID, err)
+			continue
+		}
+		status := containerStatusFromState(dockerContainer.State)
+		if status == apicontainerstatus.ContainerStatusNone || status == knownStatus {
+			continue
+		}
+		seelog.Infof("DockerGoClient: container %s changed from %s to %s while the docker events stream was down",
+			containerID, knownStatus.String(), status.String())
+		tracker.reconciled(containerID, status)
 		changedContainers <- DockerContainerChangeEvent{
 			Status:                  status,
-			Type:                    eventType,
-			DockerContainerMetadata: metadata,
+			Type:                    apicontainer.ContainerStatusEvent,
+			DockerContainerMetadata: MetadataFromContainer(dockerContainer),
+		}
+	}
+}
+
+// containerStatusFromState maps the state of an inspected container to the
+// container status reported by the corresponding docker event.
+func containerStatusFromState(state *types.ContainerState) apicontainerstatus.ContainerStatus {
+	if state == nil {
+		return apicontainerstatus.ContainerStatusNone
+	}
+	if state.Running {
+		return apicontainerstatus.ContainerRunning
+	}
+	switch state.Status {
+	case "created":
+		return apicontainerstatus.ContainerCreated
+	case "exited", "dead":
+		return apicontainerstatus.ContainerStopped
+	}
+	return apicontainerstatus.ContainerStatusNone
+}
+
+// containerStatusTracker remembers the last status reported for each container
+// from the events stream, so that a reconciliation only reports the containers
+// whose state changed while the stream was down.
+type containerStatusTracker struct {
+	known map[string]apicontainerstatus.ContainerStatus
+	// fromReconcile marks containers whose known status was reported by a
+	// reconciliation. Events replayed later with that same status are dropped
+	// so that the transition is not reported twice.
+	fromReconcile map[string]bool
+}
+
+func newContainerStatusTracker() *containerStatusTracker {
+	return &containerStatusTracker{
+		known:         make(map[string]apicontainerstatus.ContainerStatus),
+		fromReconcile: make(map[string]bool),
+	}
+}
+
+// observe records a status reported by the events stream and returns false if
+// the event only repeats a transition already reported by a reconciliation.
+func (tracker *containerStatusTracker) observe(containerID string, status apicontainerstatus.ContainerStatus) bool {
+	if status == apicontainerstatus.ContainerStatusNone {
+		return true
+	}
+	if tracker.fromReconcile[containerID] && tracker.known[containerID] == status {
+		return false
+	}
+	delete(tracker.fromReconcile, containerID)
+	if status == apicontainerstatus.ContainerStopped {
+		// Stopped containers don't need to be reconciled anymore.
+		delete(tracker.known, containerID)
+		return true
+	}
+	tracker.known[containerID] = status
+	return true
+}
+
+// reconciled records a status reported by a reconciliation.
+func (tracker *containerStatusTracker) reconciled(containerID string, status apicontainerstatus.ContainerStatus) {
+	tracker.known[containerID] = status
+	tracker.fromReconcile[containerID] = true
+}
+
+// pruneStopped forgets containers a previous reconciliation found stopped.
+func (tracker *containerStatusTracker) pruneStopped() {
+	for containerID, status := range tracker.known {
+		if status == apicontainerstatus.ContainerStopped {
+			delete(tracker.known, containerID)
+			delete(tracker.fromReconcile, containerID)
 		}
 	}
 }
@@ -1485,11 +1775,16 @@ func (dg *dockerGoClient) Stats(ctx context.Context, id string, inactivityTimeou
 			statPollTicker := time.NewTicker(dg.config.PollingMetricsWaitDuration)
 			defer statPollTicker.Stop()
 			for range statPollTicker.C {
-				stats, err := getContainerStatsNotStreamed(client, subCtx, id, pollStatsTimeout)
+				previous := stats
+				stats, err = getContainerStatsNotStreamed(client, subCtx, id, pollStatsTimeout)
 				if err != nil {
 					errC <- err
 					return
 				}
+				// One-shot stats don't wait for docker to sample the previous cpu stats,
+				// so the previous poll's are used instead.
+				stats.PreRead = previous.Read
+				stats.PreCPUStats = previous.CPUStats
 				select {
 				case <-ctx.Done():
 					return
@@ -1502,6 +1797,9 @@ func (dg *dockerGoClient) Stats(ctx context.Context, id string, inactivityTimeou
 	return statsC, errC
 }
 
+// getContainerStatsNotStreamed returns one-shot stats for the container, which docker
+// returns without waiting a second to sample the previous cpu stats. Daemons that don't
+// support one-shot stats ignore it and wait.
 func getContainerStatsNotStreamed(client sdkclient.Client, ctx context.Context, id string, timeout time.Duration) (*types.StatsJSON, error) {
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -1511,7 +1809,7 @@ func getContainerStatsNotStreamed(client sdkclient.Client, ctx context.Context,
 	}
 	response := make(chan statsResponse, 1)
 	go func() {
-		stats, err := client.ContainerStats(ctxWithTimeout, id, false)
+		stats, err := client.ContainerStatsOneShot(ctxWithTimeout, id)
 		response <- statsResponse{stats, err}
 	}()
 	select {
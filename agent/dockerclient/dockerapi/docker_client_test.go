@@ -17,11 +17,14 @@
 package dockerapi
 
 import (
+	"bufio"
 	"context"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"reflect"
 	"strconv"
 	"strings"
@@ -543,6 +546,61 @@ func TestStartContainerExec(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestAttachContainer(t *testing.T) {
+	mockDockerSDK, client, _, _, _, done := dockerClientSetup(t)
+	defer done()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	mockDockerSDK.EXPECT().ContainerAttach(gomock.Any(), "id", types.ContainerAttachOptions{
+		Stream: true,
+		Stdout: true,
+		Stderr: true,
+	}).Return(types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(strings.NewReader("output"))}, nil)
+
+	stream, err := client.AttachContainer(context.TODO(), "id", dockerclient.AttachContainerTimeout)
+	require.NoError(t, err)
+	output, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "output", string(output))
+	// Closing the stream closes the hijacked connection
+	require.NoError(t, stream.Close())
+	_, err = peer.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAttachContainerError(t *testing.T) {
+	mockDockerSDK, client, _, _, _, done := dockerClientSetup(t)
+	defer done()
+
+	mockDockerSDK.EXPECT().ContainerAttach(gomock.Any(), "id", gomock.Any()).Return(
+		types.HijackedResponse{}, errors.New("attach failed"))
+	_, err := client.AttachContainer(context.TODO(), "id", dockerclient.AttachContainerTimeout)
+	require.Error(t, err)
+	assert.Equal(t, "CannotAttachContainerError", err.(apierrors.NamedError).ErrorName())
+}
+
+func TestAttachContainerTimeout(t *testing.T) {
+	mockDockerSDK, client, _, _, _, done := dockerClientSetup(t)
+	defer done()
+
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	mockDockerSDK.EXPECT().ContainerAttach(gomock.Any(), "id", gomock.Any()).Do(func(x, y, z interface{}) {
+		wait.Wait() // wait until timeout happens
+	}).Return(types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, nil).MaxTimes(1)
+
+	_, err := client.AttachContainer(context.TODO(), "id", xContainerShortTimeout)
+	require.Error(t, err)
+	assert.Equal(t, "DockerTimeoutError", err.(apierrors.NamedError).ErrorName())
+	wait.Done()
+	// The connection that is attached after the timeout is closed
+	_, err = peer.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
 func TestInspectContainerExecTimeout(t *testing.T) {
 	mockDockerSDK, client, _, _, _, done := dockerClientSetup(t)
 	defer done()
@@ -963,6 +1021,126 @@ func TestContainerEventsError(t *testing.T) {
 	}
 }
 
+func TestContainerEventsResubscribeReplaysMissedEvents(t *testing.T) {
+	mockDockerSDK, client, _, _, _, done := dockerClientSetup(t)
+	defer done()
+
+	createTime := time.Now().UnixNano()
+	startTime := createTime + 1
+	dieTime := createTime + 2
+
+	eventsChan := make(chan events.Message, dockerEventBufferSize)
+	errChan := make(chan error)
+	replayChan := make(chan events.Message, dockerEventBufferSize)
+	replayErrChan := make(chan error)
+	gomock.InOrder(
+		mockDockerSDK.EXPECT().Events(gomock.Any(), types.EventsOptions{}).Return(eventsChan, errChan),
+		mockDockerSDK.EXPECT().Events(gomock.Any(), types.EventsOptions{
+			Since: eventsSinceCursor(time.Unix(0, startTime)),
+		}).Return(replayChan, replayErrChan),
+	)
+	runningContainer := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "cid",
+			State: &types.ContainerState{Status: "running", Running: true},
+		},
+	}
+	stoppedContainer := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: "cid",
+			State: &types.ContainerState{
+				Status:     "exited",
+				FinishedAt: time.Now().Format(time.RFC3339),
+				ExitCode:   1,
+			},
+		},
+	}
+	gomock.InOrder(
+		mockDockerSDK.EXPECT().ContainerInspect(gomock.Any(), "cid").Return(runningContainer, nil),
+		// The container dies while the stream is down. Depending on whether the replayed die event or the
+		// reconciliation gets there first, it's inspected once or twice.
+		mockDockerSDK.EXPECT().ContainerInspect(gomock.Any(), "cid").Return(stoppedContainer, nil).MinTimes(1).MaxTimes(2),
+	)
+
+	dockerEvents, err := client.ContainerEvents(context.TODO())
+	require.NoError(t, err, "Could not get container events")
+
+	eventsChan <- events.Message{Type: "container", ID: "cid", Status: "create", TimeNano: createTime}
+	event := <-dockerEvents
+	assert.Equal(t, apicontainerstatus.ContainerCreated, event.Status)
+	eventsChan <- events.Message{Type: "container", ID: "cid", Status: "start", TimeNano: startTime}
+	event = <-dockerEvents
+	assert.Equal(t, apicontainerstatus.ContainerRunning, event.Status)
+
+	// Drop the stream. The daemon replays everything since the last processed event, including
+	// the start event that was already processed.
+	errChan <- io.ErrUnexpectedEOF
+	replayChan <- events.Message{Type: "container", ID: "cid", Status: "start", TimeNano: startTime}
+	replayChan <- events.Message{Type: "container", ID: "cid", Status: "die", TimeNano: dieTime}
+
+	event = <-dockerEvents
+	assert.Equal(t, "cid", event.DockerID)
+	assert.Equal(t, apicontainerstatus.ContainerStopped, event.Status)
+	assert.Equal(t, 1, aws.IntValue(event.ExitCode))
+
+	select {
+	case event = <-dockerEvents:
+		t.Errorf("Unexpected duplicate event: %v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestContainerEventsResubscribeReconcilesLostEvents(t *testing.T) {
+	mockDockerSDK, client, _, _, _, done := dockerClientSetup(t)
+	defer done()
+
+	createTime := time.Now().UnixNano()
+
+	eventsChan := make(chan events.Message, dockerEventBufferSize)
+	errChan := make(chan error)
+	replayChan := make(chan events.Message, dockerEventBufferSize)
+	replayErrChan := make(chan error)
+	gomock.InOrder(
+		mockDockerSDK.EXPECT().Events(gomock.Any(), types.EventsOptions{}).Return(eventsChan, errChan),
+		mockDockerSDK.EXPECT().Events(gomock.Any(), types.EventsOptions{
+			Since: eventsSinceCursor(time.Unix(0, createTime)),
+		}).Return(replayChan, replayErrChan),
+	)
+	// The daemon restarted while the stream was down and lost the start event.
+	mockDockerSDK.EXPECT().ContainerInspect(gomock.Any(), "cid").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "cid",
+			State: &types.ContainerState{Status: "running", Running: true},
+		},
+	}, nil)
+
+	dockerEvents, err := client.ContainerEvents(context.TODO())
+	require.NoError(t, err, "Could not get container events")
+
+	eventsChan <- events.Message{Type: "container", ID: "cid", Status: "create", TimeNano: createTime}
+	event := <-dockerEvents
+	assert.Equal(t, apicontainerstatus.ContainerCreated, event.Status)
+
+	errChan <- io.EOF
+	event = <-dockerEvents
+	assert.Equal(t, "cid", event.DockerID)
+	assert.Equal(t, apicontainerstatus.ContainerRunning, event.Status)
+
+	// The start event is reported late by the new stream; it must not be reported twice.
+	replayChan <- events.Message{Type: "container", ID: "cid", Status: "start", TimeNano: createTime + 1}
+	select {
+	case event = <-dockerEvents:
+		t.Errorf("Unexpected duplicate event: %v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The new stream keeps reporting new events.
+	replayChan <- events.Message{Type: "container", ID: "cid2", Status: "create", TimeNano: createTime + 2}
+	event = <-dockerEvents
+	assert.Equal(t, "cid2", event.DockerID)
+	assert.Equal(t, apicontainerstatus.ContainerCreated, event.Status)
+}
+
 func TestSetExitCodeFromEvent(t *testing.T) {
 	var (
 		exitCodeInt    = 42
@@ -1446,7 +1624,7 @@ func TestPollStatsTimeout(t *testing.T) {
 	defer done()
 	wait := &sync.WaitGroup{}
 	wait.Add(1)
-	mockDockerSDK.EXPECT().ContainerStats(gomock.Any(), gomock.Any(), false).Do(func(x, y, z interface{}) {
+	mockDockerSDK.EXPECT().ContainerStatsOneShot(gomock.Any(), gomock.Any()).Do(func(x, y interface{}) {
 		wait.Wait()
 	}).MaxTimes(1).Return(types.ContainerStats{Body: mockStream{}}, nil)
 	ctx, cancel := context.WithCancel(context.TODO())
@@ -1460,7 +1638,7 @@ func TestPollStatsError(t *testing.T) {
 	shortTimeout := 1 * time.Millisecond
 	mockDockerSDK, _, _, _, _, done := dockerClientSetup(t)
 	defer done()
-	mockDockerSDK.EXPECT().ContainerStats(gomock.Any(), gomock.Any(), false).MaxTimes(1).Return(types.ContainerStats{
+	mockDockerSDK.EXPECT().ContainerStatsOneShot(gomock.Any(), gomock.Any()).MaxTimes(1).Return(types.ContainerStats{
 		Body: nil},
 		errors.New("Container stats error"))
 	ctx, cancel := context.WithCancel(context.TODO())
@@ -1469,6 +1647,33 @@ func TestPollStatsError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestPollStatsPrimesPreCPUStats(t *testing.T) {
+	conf := config.DefaultConfig()
+	conf.PollMetrics = config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
+	conf.PollingMetricsWaitDuration = 10 * time.Millisecond
+	mockDockerSDK, client, _, _, _, done := dockerClientSetupWithConfig(t, conf)
+	defer done()
+	var polls int32
+	mockDockerSDK.EXPECT().ContainerStatsOneShot(gomock.Any(), "foo").DoAndReturn(
+		func(ctx context.Context, id string) (types.ContainerStats, error) {
+			poll := atomic.AddInt32(&polls, 1)
+			return types.ContainerStats{Body: io.NopCloser(strings.NewReader(fmt.Sprintf(
+				`{"read":"2026-01-01T00:00:%02dZ","cpu_stats":{"cpu_usage":{"total_usage":%d}}}`, poll, poll*100)))}, nil
+		}).MinTimes(2)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	statsC, _ := client.Stats(ctx, "foo", dockerclient.StatsInactivityTimeout)
+
+	first := <-statsC
+	second := <-statsC
+	assert.Equal(t, uint64(100), first.CPUStats.CPUUsage.TotalUsage)
+	assert.Equal(t, uint64(200), second.CPUStats.CPUUsage.TotalUsage)
+	assert.Equal(t, first.CPUStats, second.PreCPUStats)
+	assert.Equal(t, first.Read, second.PreRead)
+	cancel()
+	assert.True(t, waitForStatsChanClose(statsC), "stats channel was not properly closed")
+}
+
 func TestStatsInactivityTimeoutNoHit(t *testing.T) {
 	longInactivityTimeout := 500 * time.Millisecond
 	mockDockerSDK, client, _, _, _, done := dockerClientSetup(t)
@@ -1817,6 +2022,7 @@ func TestMetadataFromContainer(t *testing.T) {
 			Created: created,
 			State: &types.ContainerState{
 				Running:    true,
+				Pid:        4242,
 				StartedAt:  started,
 				FinishedAt: finished,
 			},
@@ -1838,6 +2044,7 @@ func TestMetadataFromContainer(t *testing.T) {
 	assert.Equal(t, "bridge", metadata.NetworkMode)
 	assert.NotNil(t, metadata.NetworkSettings)
 	assert.Equal(t, "17.0.0.3", metadata.NetworkSettings.IPAddress)
+	assert.Equal(t, 4242, metadata.PID)
 
 	// Need to convert both strings to same format to be able to compare. Parse and Format are not inverses.
 	createdTimeSDK, _ := time.Parse(time.RFC3339, dockerContainer.Created)
@@ -16,6 +16,7 @@ package dockerapi
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types/events"
 )
@@ -23,6 +24,12 @@ import (
 const (
 	// TODO  add support for filter in go-dockerclient
 	containerTypeEvent = "container"
+
+	// eventDedupeWindow is how far behind the newest event the buffer keeps
+	// track of already seen events. Events replayed by the daemon after a
+	// resubscribe would always be newer than the resubscribe cursor, so this
+	// only needs to cover the overlap between the old and the new stream.
+	eventDedupeWindow = time.Minute
 )
 
 var containerEvents = []string{
@@ -43,11 +50,27 @@ type InfiniteBuffer struct {
 	empty        bool
 	waitForEvent sync.WaitGroup
 	lock         sync.RWMutex
+	// seen records the timestamp of every event copied into the buffer
+	// within eventDedupeWindow of lastEventTimeNano, keyed by event identity.
+	seen map[eventKey]int64
+	// lastEventTimeNano is the timestamp of the newest event copied into the
+	// buffer. It is used as the since-cursor when resubscribing.
+	lastEventTimeNano int64
+	lastPruneTimeNano int64
+}
+
+// eventKey identifies a single docker event for deduplication.
+type eventKey struct {
+	id       string
+	status   string
+	timeNano int64
 }
 
 // NewInfiniteBuffer returns an InfiniteBuffer object
 func NewInfiniteBuffer() *InfiniteBuffer {
-	return &InfiniteBuffer{}
+	return &InfiniteBuffer{
+		seen: make(map[eventKey]int64),
+	}
 }
 
 // StartListening starts reading from the input channel and writes to the buffer
@@ -80,6 +103,9 @@ func (buffer *InfiniteBuffer) CopyEvents(event *events.Message) {
 			buffer.lock.Lock()
 			defer buffer.lock.Unlock()
 
+			if buffer.isDuplicate(event) {
+				return
+			}
 			buffer.events = append(buffer.events, event)
 			// Check if there is consumer waiting for events
 			if buffer.empty {
@@ -93,6 +119,47 @@ func (buffer *InfiniteBuffer) CopyEvents(event *events.Message) {
 	}
 }
 
+// isDuplicate reports whether the event was already copied into the buffer
+// and records it otherwise. Events without a timestamp cannot be told apart
+// from each other and are never treated as duplicates. Caller must hold the
+// buffer lock.
+func (buffer *InfiniteBuffer) isDuplicate(event *events.Message) bool {
+	timeNano := event.TimeNano
+	if timeNano == 0 {
+		return false
+	}
+	key := eventKey{id: event.ID, status: event.Status, timeNano: timeNano}
+	if _, ok := buffer.seen[key]; ok {
+		return true
+	}
+	buffer.seen[key] = timeNano
+	if timeNano > buffer.lastEventTimeNano {
+		buffer.lastEventTimeNano = timeNano
+	}
+	if buffer.lastEventTimeNano-buffer.lastPruneTimeNano > int64(eventDedupeWindow) {
+		cutoff := buffer.lastEventTimeNano - int64(eventDedupeWindow)
+		for seenKey, seenTime := range buffer.seen {
+			if seenTime < cutoff {
+				delete(buffer.seen, seenKey)
+			}
+		}
+		buffer.lastPruneTimeNano = buffer.lastEventTimeNano
+	}
+	return false
+}
+
+// LastEventTime returns the timestamp of the newest event copied into the
+// buffer, or the zero time if no timestamped event has been seen yet.
+func (buffer *InfiniteBuffer) LastEventTime() time.Time {
+	buffer.lock.RLock()
+	defer buffer.lock.RUnlock()
+
+	if buffer.lastEventTimeNano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, buffer.lastEventTimeNano)
+}
+
 // Consume reads the buffer and write to a listener channel
 func (buffer *InfiniteBuffer) Consume(in chan<- *events.Message) {
 	for {
@@ -20,6 +20,7 @@ import (
 	"context"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types/events"
 	"github.com/stretchr/testify/assert"
@@ -71,3 +72,36 @@ func TestIgnoreEvents(t *testing.T) {
 	defer buffer.lock.Unlock()
 	assert.Len(t, buffer.events, 0)
 }
+
+func TestDuplicateEvents(t *testing.T) {
+	buffer := NewInfiniteBuffer()
+	assert.True(t, buffer.LastEventTime().IsZero())
+
+	now := time.Now().UnixNano()
+	buffer.CopyEvents(&events.Message{ID: "id", Type: containerTypeEvent, Status: "start", TimeNano: now})
+	buffer.CopyEvents(&events.Message{ID: "id", Type: containerTypeEvent, Status: "die", TimeNano: now + 1})
+	// Replayed after a resubscribe
+	buffer.CopyEvents(&events.Message{ID: "id", Type: containerTypeEvent, Status: "start", TimeNano: now})
+	buffer.CopyEvents(&events.Message{ID: "id", Type: containerTypeEvent, Status: "die", TimeNano: now + 1})
+	// Events without a timestamp are never deduplicated
+	buffer.CopyEvents(&events.Message{ID: "id2", Type: containerTypeEvent, Status: "die"})
+	buffer.CopyEvents(&events.Message{ID: "id2", Type: containerTypeEvent, Status: "die"})
+
+	buffer.lock.Lock()
+	assert.Len(t, buffer.events, 4)
+	buffer.lock.Unlock()
+	assert.Equal(t, now+1, buffer.LastEventTime().UnixNano())
+}
+
+func TestDuplicateEventsPruned(t *testing.T) {
+	buffer := NewInfiniteBuffer()
+
+	now := time.Now().UnixNano()
+	buffer.CopyEvents(&events.Message{ID: "id", Type: containerTypeEvent, Status: "start", TimeNano: now})
+	buffer.CopyEvents(&events.Message{ID: "id", Type: containerTypeEvent, Status: "die",
+		TimeNano: now + 2*int64(eventDedupeWindow)})
+
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	assert.Len(t, buffer.seen, 1)
+}
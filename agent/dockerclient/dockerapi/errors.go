@@ -140,8 +140,15 @@ type CannotPullContainerError struct {
 	FromError error
 }
 
+// Error returns the error message prefixed with the category of the pull failure, so
+// that stopped reasons can be told apart by their cause.
 func (err CannotPullContainerError) Error() string {
-	return err.FromError.Error()
+	return "[category=" + string(err.Category()) + "] " + err.FromError.Error()
+}
+
+// Category returns the category of the cause of the pull failure.
+func (err CannotPullContainerError) Category() PullErrorCategory {
+	return ClassifyPullError(err.FromError)
 }
 
 // ErrorName returns name of the CannotPullContainerError.
@@ -406,3 +413,17 @@ func (err CannotInspectContainerExecError) Error() string {
 func (err CannotInspectContainerExecError) ErrorName() string {
 	return "CannotInspectContainerExecError"
 }
+
+// CannotAttachContainerError indicates any error when trying to attach to a container
+type CannotAttachContainerError struct {
+	FromError error
+}
+
+func (err CannotAttachContainerError) Error() string {
+	return err.FromError.Error()
+}
+
+// ErrorName returns name of the CannotAttachContainerError.
+func (err CannotAttachContainerError) ErrorName() string {
+	return "CannotAttachContainerError"
+}
@@ -0,0 +1,230 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"strings"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	ociImageIndexMediaType       = "application/vnd.oci.image.index.v1+json"
+	ociImageManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestListMediaType  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerImageManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+	dockerHubDomain         = "docker.io"
+	dockerHubRegistryDomain = "registry-1.docker.io"
+
+	// maxImageManifestSize bounds the size of the manifests read from registries.
+	maxImageManifestSize = 4 << 20
+)
+
+var (
+	manifestAcceptHeader = strings.Join([]string{ociImageIndexMediaType, ociImageManifestMediaType,
+		dockerManifestListMediaType, dockerImageManifestMediaType}, ", ")
+
+	authChallengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// InspectImageManifests returns the manifest document that the image reference resolves
+// to and, if it's an image index, the image manifest of the host platform. The manifests
+// are retrieved from the registry with the credentials the image is pulled with.
+func (dg *dockerGoClient) InspectImageManifests(ctx context.Context, image string,
+	authData *apicontainer.RegistryAuthenticationData) ([][]byte, error) {
+	authConfig, err := dg.getAuthdata(image, authData)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dockerclient.ImageManifestInspectTimeout)
+	defer cancel()
+	return inspectImageManifests(ctx, dg.registryHTTPClient, image, authConfig)
+}
+
+func inspectImageManifests(ctx context.Context, httpClient *http.Client, image string,
+	authConfig types.AuthConfig) ([][]byte, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, err
+	}
+	domain := reference.Domain(named)
+	if domain == dockerHubDomain {
+		domain = dockerHubRegistryDomain
+	}
+	manifestRef := "latest"
+	if tagged, ok := named.(reference.Tagged); ok {
+		manifestRef = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		manifestRef = digested.Digest().String()
+	}
+	registry := &registryManifestClient{
+		httpClient: httpClient,
+		baseURL:    "https://" + domain + "/v2/" + reference.Path(named) + "/manifests/",
+		authConfig: authConfig,
+	}
+
+	document, contentType, err := registry.getManifest(ctx, manifestRef)
+	if err != nil {
+		return nil, err
+	}
+	manifests := [][]byte{document}
+	var manifest imageManifest
+	if err := json.Unmarshal(document, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode the manifest of image %s", image)
+	}
+	if !manifest.isImageIndex(contentType) {
+		return manifests, nil
+	}
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.Platform == nil || descriptor.Platform.OS != runtime.GOOS ||
+			descriptor.Platform.Architecture != runtime.GOARCH {
+			continue
+		}
+		platformDocument, _, err := registry.getManifest(ctx, descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		return append(manifests, platformDocument), nil
+	}
+	return manifests, nil
+}
+
+// registryManifestClient retrieves manifests from a registry, authorizing with the token
+// or basic authentication challenges of the registry.
+type registryManifestClient struct {
+	httpClient    *http.Client
+	baseURL       string
+	authConfig    types.AuthConfig
+	authorization string
+}
+
+func (c *registryManifestClient) getManifest(ctx context.Context, manifestRef string) ([]byte, string, error) {
+	resp, err := c.get(ctx, manifestRef)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authorize(ctx, challenge); err != nil {
+			return nil, "", err
+		}
+		if resp, err = c.get(ctx, manifestRef); err != nil {
+			return nil, "", err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("registry responded to the manifest request with status %d", resp.StatusCode)
+	}
+	document, err := io.ReadAll(io.LimitReader(resp.Body, maxImageManifestSize))
+	return document, strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]), err
+}
+
+func (c *registryManifestClient) get(ctx context.Context, manifestRef string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+manifestRef, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", manifestAcceptHeader)
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	return c.httpClient.Do(req)
+}
+
+// authorize sets the authorization of the manifest requests from the authentication
+// challenge of the registry.
+func (c *registryManifestClient) authorize(ctx context.Context, challenge string) error {
+	scheme, paramsString, _ := strings.Cut(challenge, " ")
+	params := make(map[string]string)
+	for _, match := range authChallengeParamRegex.FindAllStringSubmatch(paramsString, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.authConfig.Username == "" {
+			return errors.New("registry requires basic authentication, but there are no credentials for the image")
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(c.authConfig.Username, c.authConfig.Password)
+		c.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		token, err := c.getToken(ctx, params)
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+		return nil
+	}
+	return fmt.Errorf("registry authentication challenge %q is not supported", challenge)
+}
+
+func (c *registryManifestClient) getToken(ctx context.Context, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("registry token realm %q is invalid", params["realm"])
+	}
+	query := realm.Query()
+	for _, param := range []string{"service", "scope"} {
+		if params[param] != "" {
+			query.Set(param, params[param])
+		}
+	}
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.authConfig.Username != "" {
+		req.SetBasicAuth(c.authConfig.Username, c.authConfig.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token service responded with status %d", resp.StatusCode)
+	}
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxImageManifestSize)).Decode(&tokenResponse); err != nil {
+		return "", errors.Wrap(err, "unable to decode the registry token")
+	}
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	if tokenResponse.AccessToken != "" {
+		return tokenResponse.AccessToken, nil
+	}
+	return "", errors.New("registry token service responded without a token")
+}
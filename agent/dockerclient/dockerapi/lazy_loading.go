@@ -0,0 +1,128 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"encoding/json"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	// SOCISnapshotter is the containerd snapshotter that lazily loads images that have a
+	// SOCI index.
+	SOCISnapshotter = "soci"
+	// StargzSnapshotter is the containerd snapshotter that lazily loads images that have
+	// eStargz layers.
+	StargzSnapshotter = "stargz"
+
+	sociIndexArtifactType             = "application/vnd.amazon.soci.index.v1+json"
+	sociIndexDigestAnnotation         = "com.amazon.soci.index-digest"
+	sociImageManifestDigestAnnotation = "com.amazon.soci.image-manifest-digest"
+	estargzTOCDigestAnnotation        = "containerd.io/snapshot/stargz/toc.digest"
+)
+
+// ImageManifestInspector is implemented by docker clients that can retrieve the manifests
+// of images from their registries.
+type ImageManifestInspector interface {
+	// InspectImageManifests returns the manifest document that the image reference
+	// resolves to and, if it's an image index, the image manifest of the host platform.
+	InspectImageManifests(ctx context.Context, image string,
+		authData *apicontainer.RegistryAuthenticationData) ([][]byte, error)
+}
+
+// manifestDescriptor has the fields of OCI and docker descriptors that lazy loading
+// companions are detected from.
+type manifestDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+// imageManifest has the fields of image indexes and image manifests that lazy loading
+// companions are detected from.
+type imageManifest struct {
+	MediaType    string               `json:"mediaType"`
+	ArtifactType string               `json:"artifactType,omitempty"`
+	Manifests    []manifestDescriptor `json:"manifests,omitempty"`
+	Layers       []manifestDescriptor `json:"layers,omitempty"`
+	Annotations  map[string]string    `json:"annotations,omitempty"`
+}
+
+// LazyLoadingSnapshotter returns the snapshotter that the daemon stores images with, if it
+// can lazily load images. The daemon reports the snapshotter as its storage driver when it
+// stores images in containerd.
+func LazyLoadingSnapshotter(info types.Info) (string, bool) {
+	switch info.Driver {
+	case SOCISnapshotter, StargzSnapshotter:
+		return info.Driver, true
+	}
+	return "", false
+}
+
+// DetectLazyLoadingSnapshotter returns the snapshotter that can lazily load the image of
+// the manifests, as returned by InspectImageManifests, and false if the image has no lazy
+// loading companion. Images have a SOCI companion if their index lists a SOCI index or
+// their manifest is annotated with one, and an eStargz companion if their layers are
+// annotated with a table of contents.
+func DetectLazyLoadingSnapshotter(manifests ...[]byte) (string, bool, error) {
+	estargz := false
+	for _, document := range manifests {
+		var manifest imageManifest
+		if err := json.Unmarshal(document, &manifest); err != nil {
+			return "", false, err
+		}
+		if manifest.Annotations[sociIndexDigestAnnotation] != "" {
+			return SOCISnapshotter, true, nil
+		}
+		for _, descriptor := range manifest.Manifests {
+			if descriptor.ArtifactType == sociIndexArtifactType ||
+				descriptor.Annotations[sociImageManifestDigestAnnotation] != "" ||
+				descriptor.Annotations[sociIndexDigestAnnotation] != "" {
+				return SOCISnapshotter, true, nil
+			}
+		}
+		for _, layer := range manifest.Layers {
+			if layer.Annotations[estargzTOCDigestAnnotation] != "" {
+				estargz = true
+			}
+		}
+	}
+	if estargz {
+		return StargzSnapshotter, true, nil
+	}
+	return "", false, nil
+}
+
+// isImageIndex returns whether the manifest document is an image index or a docker
+// manifest list.
+func (manifest *imageManifest) isImageIndex(contentType string) bool {
+	switch contentType {
+	case ociImageIndexMediaType, dockerManifestListMediaType:
+		return true
+	}
+	switch manifest.MediaType {
+	case ociImageIndexMediaType, dockerManifestListMediaType:
+		return true
+	}
+	return manifest.MediaType == "" && len(manifest.Manifests) > 0 && len(manifest.Layers) == 0
+}
@@ -0,0 +1,168 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readManifestFixture(t *testing.T, name string) []byte {
+	manifest, err := os.ReadFile(filepath.Join("testdata", "manifests", name))
+	require.NoError(t, err)
+	return manifest
+}
+
+func TestDetectLazyLoadingSnapshotter(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		fixtures             []string
+		expectedSnapshotter  string
+		expectedLazyLoadable bool
+	}{
+		{
+			name:                 "index listing a SOCI index",
+			fixtures:             []string{"soci_index.json"},
+			expectedSnapshotter:  SOCISnapshotter,
+			expectedLazyLoadable: true,
+		},
+		{
+			name:                 "manifest annotated with a SOCI index",
+			fixtures:             []string{"soci_manifest.json"},
+			expectedSnapshotter:  SOCISnapshotter,
+			expectedLazyLoadable: true,
+		},
+		{
+			name:                 "manifest list and manifest with eStargz layers",
+			fixtures:             []string{"docker_manifest_list.json", "estargz_manifest.json"},
+			expectedSnapshotter:  StargzSnapshotter,
+			expectedLazyLoadable: true,
+		},
+		{
+			name:     "manifest list and manifest without companion",
+			fixtures: []string{"docker_manifest_list.json", "docker_manifest.json"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var manifests [][]byte
+			for _, fixture := range tc.fixtures {
+				manifests = append(manifests, readManifestFixture(t, fixture))
+			}
+			snapshotter, lazyLoadable, err := DetectLazyLoadingSnapshotter(manifests...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSnapshotter, snapshotter)
+			assert.Equal(t, tc.expectedLazyLoadable, lazyLoadable)
+		})
+	}
+
+	_, _, err := DetectLazyLoadingSnapshotter([]byte("not a manifest"))
+	assert.Error(t, err)
+}
+
+func TestLazyLoadingSnapshotter(t *testing.T) {
+	snapshotter, ok := LazyLoadingSnapshotter(types.Info{Driver: "soci"})
+	assert.True(t, ok)
+	assert.Equal(t, SOCISnapshotter, snapshotter)
+	_, ok = LazyLoadingSnapshotter(types.Info{Driver: "overlay2"})
+	assert.False(t, ok)
+}
+
+func TestInspectImageManifestsTokenAuthentication(t *testing.T) {
+	index := readManifestFixture(t, "docker_manifest_list.json")
+	manifest := readManifestFixture(t, "estargz_manifest.json")
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, _ := r.BasicAuth()
+			if username != "user" || password != "pass" || r.URL.Query().Get("scope") != "repository:app:pull" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"token":"registry-token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate",
+				`Bearer realm="`+server.URL+`/token",service="registry",scope="repository:app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Contains(t, r.Header.Get("Accept"), ociImageIndexMediaType)
+		switch {
+		case r.URL.Path == "/v2/app/manifests/latest":
+			w.Header().Set("Content-Type", dockerManifestListMediaType)
+			w.Write(index)
+		case strings.HasPrefix(r.URL.Path, "/v2/app/manifests/sha256:"):
+			w.Header().Set("Content-Type", ociImageManifestMediaType)
+			w.Write(manifest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	image := strings.TrimPrefix(server.URL, "https://") + "/app:latest"
+	manifests, err := inspectImageManifests(context.TODO(), server.Client(), image,
+		types.AuthConfig{Username: "user", Password: "pass"})
+	require.NoError(t, err)
+	require.NotEmpty(t, manifests)
+	assert.Equal(t, index, manifests[0])
+	if runtime.GOOS == "linux" && (runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64") {
+		// The manifest list lists a manifest for the platform of the host
+		assert.Equal(t, [][]byte{index, manifest}, manifests)
+	}
+
+	_, err = inspectImageManifests(context.TODO(), server.Client(), image, types.AuthConfig{})
+	assert.Error(t, err)
+}
+
+func TestInspectImageManifestsBasicAuthentication(t *testing.T) {
+	manifest := readManifestFixture(t, "soci_manifest.json")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "AWS" || password != "ecr-token" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="https://registry.example.com/",service="ecr.amazonaws.com"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/v2/team/app/manifests/v1", r.URL.Path)
+		w.Header().Set("Content-Type", ociImageManifestMediaType)
+		w.Write(manifest)
+	}))
+	defer server.Close()
+
+	image := strings.TrimPrefix(server.URL, "https://") + "/team/app:v1"
+	manifests, err := inspectImageManifests(context.TODO(), server.Client(), image,
+		types.AuthConfig{Username: "AWS", Password: "ecr-token"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{manifest}, manifests)
+	snapshotter, lazyLoadable, err := DetectLazyLoadingSnapshotter(manifests...)
+	require.NoError(t, err)
+	assert.True(t, lazyLoadable)
+	assert.Equal(t, SOCISnapshotter, snapshotter)
+}
@@ -72,6 +72,21 @@ func (mr *MockDockerClientMockRecorder) APIVersion() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "APIVersion", reflect.TypeOf((*MockDockerClient)(nil).APIVersion))
 }
 
+// AttachContainer mocks base method.
+func (m *MockDockerClient) AttachContainer(arg0 context.Context, arg1 string, arg2 time.Duration) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AttachContainer", arg0, arg1, arg2)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AttachContainer indicates an expected call of AttachContainer.
+func (mr *MockDockerClientMockRecorder) AttachContainer(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttachContainer", reflect.TypeOf((*MockDockerClient)(nil).AttachContainer), arg0, arg1, arg2)
+}
+
 // ContainerEvents mocks base method.
 func (m *MockDockerClient) ContainerEvents(arg0 context.Context) (<-chan dockerapi.DockerContainerChangeEvent, error) {
 	m.ctrl.T.Helper()
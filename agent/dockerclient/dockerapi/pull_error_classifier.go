@@ -0,0 +1,138 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"strings"
+)
+
+// PullErrorCategory is the category of the cause of an image pull failure
+type PullErrorCategory string
+
+const (
+	// PullErrorAuthentication is the category of pull failures where the registry
+	// rejected or required credentials
+	PullErrorAuthentication PullErrorCategory = "authentication"
+	// PullErrorAuthorization is the category of pull failures where the credentials
+	// aren't allowed to pull the image
+	PullErrorAuthorization PullErrorCategory = "authorization"
+	// PullErrorManifestNotFound is the category of pull failures where the image or
+	// its manifest for the platform doesn't exist
+	PullErrorManifestNotFound PullErrorCategory = "manifest_not_found"
+	// PullErrorNetworkTimeout is the category of pull failures where the registry
+	// couldn't be reached or didn't respond in time
+	PullErrorNetworkTimeout PullErrorCategory = "network_timeout"
+	// PullErrorDiskFull is the category of pull failures where the image couldn't be
+	// stored on the instance
+	PullErrorDiskFull PullErrorCategory = "disk_full"
+	// PullErrorRateLimited is the category of pull failures where the registry
+	// throttled the pull
+	PullErrorRateLimited PullErrorCategory = "rate_limited"
+	// PullErrorUnknown is the category of pull failures that match no rule
+	PullErrorUnknown PullErrorCategory = "unknown"
+)
+
+// pullErrorClassificationRule classifies pull errors whose message contains any of
+// the substrings, which are matched case insensitively.
+type pullErrorClassificationRule struct {
+	category   PullErrorCategory
+	substrings []string
+}
+
+// pullErrorClassificationRules are the rules that pull errors are classified by. The
+// first rule that matches wins, so rules for messages that embed the messages of other
+// rules come first. For example, Docker Hub suggests authenticating when it rate limits
+// pulls, and denies access to repositories that don't exist.
+var pullErrorClassificationRules = []pullErrorClassificationRule{
+	{
+		category: PullErrorRateLimited,
+		substrings: []string{
+			"toomanyrequests",
+			"too many requests",
+			"pull rate limit",
+			"rate exceeded",
+			"throttlingexception",
+		},
+	},
+	{
+		category: PullErrorDiskFull,
+		substrings: []string{
+			"no space left on device",
+			"disk quota exceeded",
+		},
+	},
+	{
+		category: PullErrorAuthentication,
+		substrings: []string{
+			"no basic auth credentials",
+			"authentication required",
+			"incorrect username or password",
+			"authorization token has expired",
+			"unauthorized",
+			"invalid credentials",
+		},
+	},
+	{
+		category: PullErrorAuthorization,
+		substrings: []string{
+			"pull access denied",
+			"requested access to the resource is denied",
+			"is not authorized to perform",
+			"forbidden",
+			"denied:",
+		},
+	},
+	{
+		category: PullErrorManifestNotFound,
+		substrings: []string{
+			"manifest unknown",
+			"no matching manifest",
+			"name unknown",
+			"repository does not exist",
+			"not found",
+		},
+	},
+	{
+		category: PullErrorNetworkTimeout,
+		substrings: []string{
+			"i/o timeout",
+			"tls handshake timeout",
+			"context deadline exceeded",
+			"client.timeout exceeded",
+			"request canceled while waiting for connection",
+			"inactivity time exceeded timeout",
+			"connection refused",
+			"connection reset by peer",
+			"no such host",
+			"network is unreachable",
+			"timeout",
+		},
+	},
+}
+
+// ClassifyPullError returns the category of the cause of an image pull failure
+func ClassifyPullError(err error) PullErrorCategory {
+	if err == nil {
+		return PullErrorUnknown
+	}
+	message := strings.ToLower(err.Error())
+	for _, rule := range pullErrorClassificationRules {
+		for _, substring := range rule.substrings {
+			if strings.Contains(message, substring) {
+				return rule.category
+			}
+		}
+	}
+	return PullErrorUnknown
+}
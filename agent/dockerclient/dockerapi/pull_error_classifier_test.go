@@ -0,0 +1,83 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyPullError(t *testing.T) {
+	testCases := []struct {
+		message  string
+		category PullErrorCategory
+	}{
+		// Authentication
+		{"Error response from daemon: Get \"https://registry-1.docker.io/v2/library/busybox/manifests/latest\": unauthorized: incorrect username or password", PullErrorAuthentication},
+		{"Error response from daemon: Get \"https://ghcr.io/v2/org/app/manifests/1.0\": unauthorized: authentication required", PullErrorAuthentication},
+		{"Error response from daemon: Head \"https://123456789012.dkr.ecr.us-west-2.amazonaws.com/v2/app/manifests/latest\": no basic auth credentials", PullErrorAuthentication},
+		{"Error response from daemon: pull access denied for 123456789012.dkr.ecr.us-west-2.amazonaws.com/app, repository does not exist or may require 'docker login': denied: Your authorization token has expired. Reauthenticate and try again.", PullErrorAuthentication},
+		{"Error response from daemon: Get \"https://quay.io/v2/org/app/manifests/latest\": unexpected status code 401 Unauthorized", PullErrorAuthentication},
+		// Authorization
+		{"Error response from daemon: pull access denied for private/app, repository does not exist or may require 'docker login': denied: requested access to the resource is denied", PullErrorAuthorization},
+		{"Error response from daemon: denied: User: arn:aws:sts::123456789012:assumed-role/ecsInstanceRole/i-0123456789abcdef0 is not authorized to perform: ecr:BatchGetImage on resource: arn:aws:ecr:us-west-2:123456789012:repository/app", PullErrorAuthorization},
+		{"Error response from daemon: Head \"https://registry.example.com/v2/app/manifests/latest\": 403 Forbidden", PullErrorAuthorization},
+		// Manifest not found
+		{"Error response from daemon: manifest for busybox:does-not-exist not found: manifest unknown: manifest unknown", PullErrorManifestNotFound},
+		{"Error response from daemon: manifest for 123456789012.dkr.ecr.us-west-2.amazonaws.com/app:v2 not found: manifest unknown: Requested image not found", PullErrorManifestNotFound},
+		{"no matching manifest for linux/arm64/v8 in the manifest list entries", PullErrorManifestNotFound},
+		{"Error response from daemon: Get \"https://ghcr.io/v2/org/missing/manifests/latest\": name unknown: repository name not known to registry", PullErrorManifestNotFound},
+		// Network timeout
+		{"Error response from daemon: Get \"https://registry-1.docker.io/v2/\": net/http: request canceled while waiting for connection (Client.Timeout exceeded while awaiting headers)", PullErrorNetworkTimeout},
+		{"Error response from daemon: Get \"https://registry-1.docker.io/v2/\": net/http: TLS handshake timeout", PullErrorNetworkTimeout},
+		{"Error response from daemon: Get \"https://123456789012.dkr.ecr.us-west-2.amazonaws.com/v2/\": dial tcp 10.0.0.1:443: i/o timeout", PullErrorNetworkTimeout},
+		{"Error response from daemon: Get \"https://registry.example.com/v2/\": dial tcp: lookup registry.example.com on 10.0.0.2:53: no such host", PullErrorNetworkTimeout},
+		{"Error response from daemon: Get \"https://registry.example.com/v2/\": dial tcp 10.0.0.1:443: connect: connection refused", PullErrorNetworkTimeout},
+		{"read tcp 10.0.0.5:53412->52.94.0.1:443: read: connection reset by peer", PullErrorNetworkTimeout},
+		{"inactivity time exceeded timeout while pulling image", PullErrorNetworkTimeout},
+		// Disk full
+		{"failed to register layer: Error processing tar file(exit status 1): write /usr/lib/libLLVM.so: no space left on device", PullErrorDiskFull},
+		{"write /var/lib/docker/tmp/GetImageBlob123: disk quota exceeded", PullErrorDiskFull},
+		// Rate limited
+		{"Error response from daemon: toomanyrequests: You have reached your pull rate limit. You may increase the limit by authenticating and upgrading: https://www.docker.com/increase-rate-limit", PullErrorRateLimited},
+		{"Error response from daemon: Head \"https://public.ecr.aws/v2/docker/library/nginx/manifests/latest\": toomanyrequests: Rate exceeded", PullErrorRateLimited},
+		{"unexpected status code 429 Too Many Requests", PullErrorRateLimited},
+		// Unknown
+		{"failed to register layer: Error processing tar file(exit status 1): unexpected EOF", PullErrorUnknown},
+		{"", PullErrorUnknown},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.message, func(t *testing.T) {
+			assert.Equal(t, tc.category, ClassifyPullError(errors.New(tc.message)))
+		})
+	}
+}
+
+func TestClassifyPullErrorContextDeadline(t *testing.T) {
+	assert.Equal(t, PullErrorNetworkTimeout, ClassifyPullError(context.DeadlineExceeded))
+	assert.Equal(t, PullErrorUnknown, ClassifyPullError(nil))
+}
+
+func TestCannotPullContainerErrorCategoryPrefix(t *testing.T) {
+	err := CannotPullContainerError{errors.New("pull access denied for app")}
+	assert.Equal(t, PullErrorAuthorization, err.Category())
+	assert.Equal(t, "[category=authorization] pull access denied for app", err.Error())
+	assert.Equal(t, "CannotPullContainerError", err.ErrorName())
+}
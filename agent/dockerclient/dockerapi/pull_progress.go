@@ -0,0 +1,187 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Layer statuses reported in docker pull progress messages
+const (
+	pullStatusPullingFSLayer   = "Pulling fs layer"
+	pullStatusWaiting          = "Waiting"
+	pullStatusDownloading      = "Downloading"
+	pullStatusVerifying        = "Verifying Checksum"
+	pullStatusDownloadComplete = "Download complete"
+	pullStatusExtracting       = "Extracting"
+	pullStatusPullComplete     = "Pull complete"
+	pullStatusAlreadyExists    = "Already exists"
+)
+
+// ImagePullProgress is a snapshot of the progress of an image pull.
+type ImagePullProgress struct {
+	// Percent is the percentage of bytes downloaded. It is nil while the total size of the
+	// image is unknown, i.e. until every layer has reported its size.
+	Percent          *float64 `json:"Percent,omitempty"`
+	BytesDownloaded  int64    `json:"BytesDownloaded"`
+	BytesTotal       int64    `json:"BytesTotal,omitempty"`
+	LayersDownloaded int      `json:"LayersDownloaded"`
+	LayersTotal      int      `json:"LayersTotal"`
+	// CurrentLayer is the ID of the layer that most recently reported download progress
+	CurrentLayer string `json:"CurrentLayer,omitempty"`
+}
+
+// layerPullProgress is the download progress of a single layer
+type layerPullProgress struct {
+	current    int64
+	total      int64
+	downloaded bool
+}
+
+// PullProgressTracker maintains the progress of an image pull from the docker pull progress
+// stream. Layers are downloaded in parallel, so progress is kept per layer.
+type PullProgressTracker struct {
+	layers       map[string]*layerPullProgress
+	currentLayer string
+	lastLogged   time.Time
+	lock         sync.RWMutex
+}
+
+// NewPullProgressTracker creates a tracker for a pull that hasn't reported progress yet.
+func NewPullProgressTracker() *PullProgressTracker {
+	return &PullProgressTracker{
+		layers: make(map[string]*layerPullProgress),
+	}
+}
+
+// Update updates the progress with a message from the docker pull progress stream. Messages
+// that are not about a layer, such as the digest and status lines, are ignored.
+func (t *PullProgressTracker) Update(data *ImagePullResponse) {
+	if data.Id == "" || strings.HasPrefix(data.Status, "Pulling from") {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	layer, ok := t.layers[data.Id]
+	if !ok {
+		layer = &layerPullProgress{}
+		t.layers[data.Id] = layer
+	}
+	switch data.Status {
+	case pullStatusDownloading:
+		layer.current = data.ProgressDetail.Current
+		if data.ProgressDetail.Total > 0 {
+			layer.total = data.ProgressDetail.Total
+		}
+		t.currentLayer = data.Id
+	case pullStatusVerifying, pullStatusDownloadComplete, pullStatusExtracting, pullStatusPullComplete:
+		if !layer.downloaded {
+			layer.downloaded = true
+			// Layers with unknown sizes have their size known once downloaded
+			if layer.total <= 0 || layer.current > layer.total {
+				layer.total = layer.current
+			}
+			layer.current = layer.total
+		}
+		if t.currentLayer == data.Id {
+			t.currentLayer = ""
+		}
+	case pullStatusAlreadyExists:
+		layer.downloaded = true
+	}
+}
+
+// Progress returns a snapshot of the pull progress.
+func (t *PullProgressTracker) Progress() ImagePullProgress {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	progress := ImagePullProgress{
+		LayersTotal:  len(t.layers),
+		CurrentLayer: t.currentLayer,
+	}
+	totalKnown := true
+	for _, layer := range t.layers {
+		progress.BytesDownloaded += layer.current
+		progress.BytesTotal += layer.total
+		if layer.downloaded {
+			progress.LayersDownloaded++
+		} else if layer.total <= 0 {
+			totalKnown = false
+		}
+	}
+	if !totalKnown || len(t.layers) == 0 {
+		progress.BytesTotal = 0
+		return progress
+	}
+	percent := 100.0
+	if progress.BytesTotal > 0 {
+		percent = math.Round(float64(progress.BytesDownloaded)*1000/float64(progress.BytesTotal)) / 10
+	}
+	progress.Percent = &percent
+	return progress
+}
+
+// shouldLog returns whether the progress should be logged at the given time, for logging
+// progress at most once per interval.
+func (t *PullProgressTracker) shouldLog(now time.Time, interval time.Duration) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if interval <= 0 || now.Sub(t.lastLogged) < interval {
+		return false
+	}
+	if t.lastLogged.IsZero() {
+		// Don't log as soon as the pull begins, short pulls don't need progress logs
+		t.lastLogged = now
+		return false
+	}
+	t.lastLogged = now
+	return true
+}
+
+// pullProgressRegistry holds the progress trackers of the image pulls in flight, by image
+var pullProgressRegistry = struct {
+	trackers map[string]*PullProgressTracker
+	lock     sync.RWMutex
+}{trackers: make(map[string]*PullProgressTracker)}
+
+func registerPullProgress(image string, tracker *PullProgressTracker) {
+	pullProgressRegistry.lock.Lock()
+	defer pullProgressRegistry.lock.Unlock()
+	pullProgressRegistry.trackers[image] = tracker
+}
+
+func deregisterPullProgress(image string, tracker *PullProgressTracker) {
+	pullProgressRegistry.lock.Lock()
+	defer pullProgressRegistry.lock.Unlock()
+	if pullProgressRegistry.trackers[image] == tracker {
+		delete(pullProgressRegistry.trackers, image)
+	}
+}
+
+// GetImagePullProgress returns the progress of the pull of an image if it's in flight.
+func GetImagePullProgress(image string) (ImagePullProgress, bool) {
+	pullProgressRegistry.lock.RLock()
+	tracker, ok := pullProgressRegistry.trackers[image]
+	pullProgressRegistry.lock.RUnlock()
+	if !ok {
+		return ImagePullProgress{}, false
+	}
+	return tracker.Progress(), true
+}
@@ -0,0 +1,175 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// feedPullProgress decodes a recorded docker pull progress stream into the tracker.
+func feedPullProgress(t *testing.T, tracker *PullProgressTracker, stream string) {
+	decoder := json.NewDecoder(strings.NewReader(stream))
+	for {
+		data := new(ImagePullResponse)
+		err := decoder.Decode(data)
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+		tracker.Update(data)
+	}
+}
+
+func percent(value float64) *float64 {
+	return &value
+}
+
+// Recorded while pulling an image with two layers downloading in parallel and one layer
+// already present on the host.
+const parallelLayersPullStart = `
+{"status":"Pulling from library/pytorch","id":"2.1"}
+{"status":"Already exists","progressDetail":{},"id":"a1b2c3d4e5f6"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"b2c3d4e5f6a1"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"c3d4e5f6a1b2"}
+{"status":"Downloading","progressDetail":{"current":1000,"total":4000},"progress":"[=====>      ]","id":"b2c3d4e5f6a1"}
+{"status":"Downloading","progressDetail":{"current":500,"total":6000},"progress":"[=>          ]","id":"c3d4e5f6a1b2"}
+{"status":"Downloading","progressDetail":{"current":3000,"total":4000},"progress":"[========>   ]","id":"b2c3d4e5f6a1"}
+`
+
+const parallelLayersPullEnd = `
+{"status":"Verifying Checksum","progressDetail":{},"id":"b2c3d4e5f6a1"}
+{"status":"Download complete","progressDetail":{},"id":"b2c3d4e5f6a1"}
+{"status":"Extracting","progressDetail":{"current":32768,"total":4000},"progress":"[==>        ]","id":"b2c3d4e5f6a1"}
+{"status":"Downloading","progressDetail":{"current":6000,"total":6000},"progress":"[===========>]","id":"c3d4e5f6a1b2"}
+{"status":"Download complete","progressDetail":{},"id":"c3d4e5f6a1b2"}
+{"status":"Pull complete","progressDetail":{},"id":"b2c3d4e5f6a1"}
+{"status":"Extracting","progressDetail":{"current":6000,"total":6000},"progress":"[===========>]","id":"c3d4e5f6a1b2"}
+{"status":"Pull complete","progressDetail":{},"id":"c3d4e5f6a1b2"}
+{"status":"Digest: sha256:0123456789abcdef"}
+{"status":"Status: Downloaded newer image for pytorch:2.1"}
+`
+
+func TestPullProgressParallelLayers(t *testing.T) {
+	tracker := NewPullProgressTracker()
+	feedPullProgress(t, tracker, parallelLayersPullStart)
+	assert.Equal(t, ImagePullProgress{
+		Percent:          percent(35),
+		BytesDownloaded:  3500,
+		BytesTotal:       10000,
+		LayersDownloaded: 1,
+		LayersTotal:      3,
+		CurrentLayer:     "b2c3d4e5f6a1",
+	}, tracker.Progress())
+
+	feedPullProgress(t, tracker, parallelLayersPullEnd)
+	assert.Equal(t, ImagePullProgress{
+		Percent:          percent(100),
+		BytesDownloaded:  10000,
+		BytesTotal:       10000,
+		LayersDownloaded: 3,
+		LayersTotal:      3,
+	}, tracker.Progress())
+}
+
+// Recorded from a registry that doesn't report layer sizes.
+const unknownSizePull = `
+{"status":"Pulling from team/model-server","id":"latest"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"d4e5f6a1b2c3"}
+{"status":"Downloading","progressDetail":{"current":2048},"id":"d4e5f6a1b2c3"}
+`
+
+func TestPullProgressUnknownTotalSize(t *testing.T) {
+	tracker := NewPullProgressTracker()
+	feedPullProgress(t, tracker, unknownSizePull)
+	assert.Equal(t, ImagePullProgress{
+		BytesDownloaded: 2048,
+		LayersTotal:     1,
+		CurrentLayer:    "d4e5f6a1b2c3",
+	}, tracker.Progress())
+
+	feedPullProgress(t, tracker, `{"status":"Downloading","progressDetail":{"current":4096},"id":"d4e5f6a1b2c3"}
+{"status":"Download complete","progressDetail":{},"id":"d4e5f6a1b2c3"}`)
+	assert.Equal(t, ImagePullProgress{
+		Percent:          percent(100),
+		BytesDownloaded:  4096,
+		BytesTotal:       4096,
+		LayersDownloaded: 1,
+		LayersTotal:      1,
+	}, tracker.Progress())
+}
+
+// Tests that the percentage is unknown while some layers are still waiting to be downloaded.
+func TestPullProgressWaitingLayers(t *testing.T) {
+	tracker := NewPullProgressTracker()
+	feedPullProgress(t, tracker, `
+{"status":"Pulling fs layer","progressDetail":{},"id":"e5f6a1b2c3d4"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"f6a1b2c3d4e5"}
+{"status":"Waiting","progressDetail":{},"id":"f6a1b2c3d4e5"}
+{"status":"Downloading","progressDetail":{"current":100,"total":200},"id":"e5f6a1b2c3d4"}
+`)
+	progress := tracker.Progress()
+	assert.Nil(t, progress.Percent)
+	assert.Equal(t, int64(100), progress.BytesDownloaded)
+	assert.Equal(t, int64(0), progress.BytesTotal)
+	assert.Equal(t, 2, progress.LayersTotal)
+}
+
+func TestPullProgressNoLayers(t *testing.T) {
+	tracker := NewPullProgressTracker()
+	feedPullProgress(t, tracker, `{"status":"Pulling from library/busybox","id":"latest"}`)
+	assert.Equal(t, ImagePullProgress{}, tracker.Progress())
+}
+
+func TestPullProgressShouldLog(t *testing.T) {
+	tracker := NewPullProgressTracker()
+	now := time.Now()
+	assert.False(t, tracker.shouldLog(now, 0), "logging disabled")
+	assert.False(t, tracker.shouldLog(now, time.Minute), "pull just began")
+	assert.False(t, tracker.shouldLog(now.Add(30*time.Second), time.Minute))
+	assert.True(t, tracker.shouldLog(now.Add(time.Minute), time.Minute))
+	assert.False(t, tracker.shouldLog(now.Add(90*time.Second), time.Minute))
+	assert.True(t, tracker.shouldLog(now.Add(2*time.Minute), time.Minute))
+}
+
+func TestGetImagePullProgress(t *testing.T) {
+	image := "registry.example.com/pytorch:2.1"
+	_, ok := GetImagePullProgress(image)
+	assert.False(t, ok)
+
+	tracker := NewPullProgressTracker()
+	registerPullProgress(image, tracker)
+	feedPullProgress(t, tracker, parallelLayersPullStart)
+	progress, ok := GetImagePullProgress(image)
+	require.True(t, ok)
+	assert.Equal(t, 3, progress.LayersTotal)
+
+	// A stale pull must not deregister the tracker of a newer pull of the same image
+	deregisterPullProgress(image, NewPullProgressTracker())
+	_, ok = GetImagePullProgress(image)
+	assert.True(t, ok)
+
+	deregisterPullProgress(image, tracker)
+	_, ok = GetImagePullProgress(image)
+	assert.False(t, ok)
+}
@@ -75,6 +75,8 @@ type DockerContainerMetadata struct {
 	NetworkMode string
 	// NetworksUnsafe denotes the Docker Network Settings in the container
 	NetworkSettings *types.NetworkSettings
+	// PID is the process ID of the container's init process if it is running
+	PID int
 }
 
 // ListContainersResponse encapsulates the response from the docker client for the
@@ -35,6 +35,8 @@ const (
 	ListContainersTimeout = 10 * time.Minute
 	// InspectContainerTimeout is the timeout for the InspectContainer API.
 	InspectContainerTimeout = 30 * time.Second
+	// AttachContainerTimeout is the timeout for the AttachContainer API.
+	AttachContainerTimeout = 30 * time.Second
 	// ContainerExecCreateTimeout is the timeout for the ContainerExecCreate API.
 	ContainerExecCreateTimeout = 1 * time.Minute
 	// ContainerExecStartTimeout is the timeout for the ContainerExecStart API.
@@ -73,4 +75,8 @@ const (
 
 	// InfoTimeout is the timeout for the Info API
 	InfoTimeout = 10 * time.Second
+
+	// ImageManifestInspectTimeout is the timeout for retrieving the manifests of an image
+	// from its registry
+	ImageManifestInspectTimeout = 30 * time.Second
 )
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
 	"github.com/aws/amazon-ecs-agent/agent/credentials/instancecreds"
 	ecrapi "github.com/aws/amazon-ecs-agent/agent/ecr/model/ecr"
 	"github.com/aws/amazon-ecs-agent/agent/httpclient"
@@ -36,22 +37,25 @@ type ECRFactory interface {
 
 type ecrFactory struct {
 	httpClient *http.Client
+	endpoints  *awsendpoints.Resolver
 }
 
 const (
 	roundtripTimeout = 5 * time.Second
 )
 
-// NewECRFactory returns an ECRFactory capable of producing ECRSDK clients
-func NewECRFactory(acceptInsecureCert bool) ECRFactory {
+// NewECRFactory returns an ECRFactory capable of producing ECRSDK clients, which are
+// pointed at the endpoints resolved by the endpoint resolver
+func NewECRFactory(acceptInsecureCert bool, endpoints *awsendpoints.Resolver) ECRFactory {
 	return &ecrFactory{
 		httpClient: httpclient.New(roundtripTimeout, acceptInsecureCert),
+		endpoints:  endpoints,
 	}
 }
 
 // GetClient creates the ECR SDK client based on the authdata
 func (factory *ecrFactory) GetClient(authData *apicontainer.ECRAuthData) (ECRClient, error) {
-	clientConfig, err := getClientConfig(factory.httpClient, authData)
+	clientConfig, err := getClientConfig(factory.httpClient, factory.endpoints, authData)
 	if err != nil {
 		return &ecrClient{}, err
 	}
@@ -59,11 +63,15 @@ func (factory *ecrFactory) GetClient(authData *apicontainer.ECRAuthData) (ECRCli
 	return factory.newClient(clientConfig), nil
 }
 
-// getClientConfig returns the config for the ecr client based on authData
-func getClientConfig(httpClient *http.Client, authData *apicontainer.ECRAuthData) (*aws.Config, error) {
+// getClientConfig returns the config for the ecr client based on authData. The endpoint
+// override of the agent configuration takes precedence over the one of authData.
+func getClientConfig(httpClient *http.Client, endpoints *awsendpoints.Resolver,
+	authData *apicontainer.ECRAuthData) (*aws.Config, error) {
 	cfg := aws.NewConfig().WithRegion(authData.Region).WithHTTPClient(httpClient)
-	if authData.EndpointOverride != "" {
+	if authData.EndpointOverride != "" && !endpoints.Overridden(awsendpoints.ECR) {
 		cfg.Endpoint = aws.String(authData.EndpointOverride)
+	} else if err := endpoints.Configure(cfg, awsendpoints.ECR, authData.Region); err != nil {
+		return nil, err
 	}
 
 	if authData.UseExecutionRole {
@@ -20,7 +20,10 @@ import (
 	"testing"
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetClientConfigEndpointOverride(t *testing.T) {
@@ -30,8 +33,35 @@ func TestGetClientConfigEndpointOverride(t *testing.T) {
 		UseExecutionRole: false,
 	}
 
-	cfg, err := getClientConfig(nil, testAuthData)
+	cfg, err := getClientConfig(nil, nil, testAuthData)
 
 	assert.Nil(t, err)
 	assert.Equal(t, testAuthData.EndpointOverride, *cfg.Endpoint)
 }
+
+func TestGetClientConfigEndpointResolver(t *testing.T) {
+	testAuthData := &apicontainer.ECRAuthData{
+		EndpointOverride: "api.ecr.us-west-2.amazonaws.com",
+		Region:           "us-west-2",
+	}
+
+	// The endpoint override of the agent configuration takes precedence
+	endpoints, err := awsendpoints.NewResolver("", map[string]string{
+		awsendpoints.ECR: "https://vpce-0123.api.ecr.us-west-2.vpce.amazonaws.com",
+	})
+	require.NoError(t, err)
+	cfg, err := getClientConfig(nil, endpoints, testAuthData)
+	require.NoError(t, err)
+	assert.Equal(t, "https://vpce-0123.api.ecr.us-west-2.vpce.amazonaws.com", aws.StringValue(cfg.Endpoint))
+
+	endpoints, err = awsendpoints.NewResolver("fips", nil)
+	require.NoError(t, err)
+	cfg, err = getClientConfig(nil, endpoints, testAuthData)
+	require.NoError(t, err)
+	assert.Equal(t, testAuthData.EndpointOverride, aws.StringValue(cfg.Endpoint))
+
+	testAuthData.EndpointOverride = ""
+	cfg, err = getClientConfig(nil, endpoints, testAuthData)
+	require.NoError(t, err)
+	assert.Equal(t, "https://ecr-fips.us-west-2.amazonaws.com", aws.StringValue(cfg.Endpoint))
+}
@@ -106,7 +106,7 @@ func setupGMSALinux(cfg *config.Config, state dockerstate.TaskEngineState, t *te
 
 	resourceFields := &taskresource.ResourceFields{
 		ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
-			SSMClientCreator: ssmfactory.NewSSMClientCreator(),
+			SSMClientCreator: ssmfactory.NewSSMClientCreator(nil),
 			S3ClientCreator:  s3factory.NewS3ClientCreator(),
 		},
 		DockerClient: dockerClient,
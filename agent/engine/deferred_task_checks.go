@@ -0,0 +1,100 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"sync"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+// defaultDeferredTaskCheckInterval is how often the state checks of the tasks that were
+// deferred because docker could not be reached are retried.
+const defaultDeferredTaskCheckInterval = 5 * time.Second
+
+// deferredTaskChecks queues the state checks of tasks while docker can't be reached. A
+// connection failure says nothing about the containers of a task, so the decisions on the
+// task are held back until docker answers, instead of concluding that its containers are
+// gone. The queued checks are retried until docker answers them; while the circuit breaker
+// of the docker client is open they fail fast without reaching the daemon.
+type deferredTaskChecks struct {
+	lock sync.Mutex
+	// tasks are the tasks whose checks are queued, by ARN
+	tasks map[string]*apitask.Task
+	// retrying is whether the queued checks are being retried
+	retrying bool
+	// interval is how often the queued checks are retried, the default interval is used
+	// if it is not set
+	interval time.Duration
+}
+
+// deferTaskStateCheck queues a check of the state of the containers of the task until
+// docker can be reached again.
+func (engine *DockerTaskEngine) deferTaskStateCheck(task *apitask.Task) {
+	checks := &engine.deferredChecks
+	checks.lock.Lock()
+	defer checks.lock.Unlock()
+
+	if checks.tasks == nil {
+		checks.tasks = make(map[string]*apitask.Task)
+	}
+	if _, ok := checks.tasks[task.Arn]; !ok {
+		logger.Info("Deferring the state check of the task until docker can be reached", logger.Fields{
+			field.TaskID: task.GetID(),
+		})
+	}
+	checks.tasks[task.Arn] = task
+	if !checks.retrying {
+		checks.retrying = true
+		interval := checks.interval
+		if interval <= 0 {
+			interval = defaultDeferredTaskCheckInterval
+		}
+		go engine.retryDeferredTaskStateChecks(interval)
+	}
+}
+
+// retryDeferredTaskStateChecks checks the state of the queued tasks until none is left.
+// The checks that still can't reach docker are queued again.
+func (engine *DockerTaskEngine) retryDeferredTaskStateChecks(interval time.Duration) {
+	checks := &engine.deferredChecks
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-engine.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checks.lock.Lock()
+		tasks := checks.tasks
+		checks.tasks = make(map[string]*apitask.Task)
+		checks.lock.Unlock()
+		for _, task := range tasks {
+			engine.checkTaskState(task)
+		}
+
+		checks.lock.Lock()
+		if len(checks.tasks) == 0 {
+			checks.retrying = false
+			checks.lock.Unlock()
+			return
+		}
+		checks.lock.Unlock()
+	}
+}
@@ -289,7 +289,8 @@ func verifyContainerOrderingStatusResolvable(target *apicontainer.Container, exi
 		// However, if dependency container has already stopped, then it cannot time out.
 		if targetKnown < apicontainerstatus.ContainerCreated && dependencyContainer.GetKnownStatus() != apicontainerstatus.ContainerStopped {
 			if hasDependencyTimedOut(dependencyContainer, dependency.Condition) {
-				return nil, &dependencyError{err: fmt.Errorf("dependency graph: container ordering dependency [%v] for target [%v] has timed out.", dependencyContainer, target), isTerminal: true}
+				return nil, &dependencyError{err: fmt.Errorf("dependency graph: container ordering dependency [%s] for target [%s] did not reach condition %s within the start timeout of %s",
+					dependencyContainer.Name, target.Name, dependency.Condition, dependencyContainer.GetStartTimeout()), isTerminal: true}
 			}
 		}
 
@@ -316,6 +317,32 @@ func verifyContainerOrderingStatusResolvable(target *apicontainer.Container, exi
 	return nil, nil
 }
 
+// UnresolvedContainerOrderingDependencies returns the container ordering dependencies of
+// `target` that are not resolved yet given the current known state of the containers in `by`.
+// An empty list is returned if `target` is not blocked on any ordering dependency.
+func UnresolvedContainerOrderingDependencies(target *apicontainer.Container,
+	by []*apicontainer.Container,
+	cfg *config.Config) []apicontainer.DependsOn {
+	targetGoal := target.GetDesiredStatus()
+	if targetGoal != target.GetSteadyStateStatus() && targetGoal != apicontainerstatus.ContainerCreated {
+		return nil
+	}
+
+	nameMap := make(map[string]*apicontainer.Container)
+	for _, cont := range by {
+		nameMap[cont.Name] = cont
+	}
+
+	var unresolved []apicontainer.DependsOn
+	for _, dependency := range target.GetDependsOn() {
+		dependencyContainer, ok := nameMap[dependency.ContainerName]
+		if !ok || !containerOrderingDependenciesIsResolved(target, dependencyContainer, dependency.Condition, cfg) {
+			unresolved = append(unresolved, dependency)
+		}
+	}
+	return unresolved
+}
+
 func verifyTransitionDependenciesResolved(target *apicontainer.Container,
 	existingContainers map[string]*apicontainer.Container,
 	existingResources map[string]taskresource.TaskResource) DependencyError {
@@ -31,6 +31,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func volumeStrToVol(vols []string) []apicontainer.VolumeFrom {
@@ -1396,3 +1397,101 @@ func TestVerifyContainerOrderingStatusResolvableFailOnDependencyWontStart(t *tes
 	_, err := verifyContainerOrderingStatusResolvable(target, contMap, &config.Config{}, dummyResolves)
 	assert.Error(t, err)
 }
+
+func TestVerifyContainerOrderingStatusResolvableTimeoutNamesDependency(t *testing.T) {
+	target := &apicontainer.Container{
+		Name:                "target",
+		KnownStatusUnsafe:   apicontainerstatus.ContainerPulled,
+		DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+		DependsOnUnsafe: []apicontainer.DependsOn{
+			{
+				ContainerName: "dependency",
+				Condition:     healthyCondition,
+			},
+		},
+	}
+	dep := &apicontainer.Container{
+		Name:                "dependency",
+		KnownStatusUnsafe:   apicontainerstatus.ContainerRunning,
+		DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+		StartTimeout:        10,
+	}
+	dep.SetStartedAt(time.Now().Add(-time.Minute))
+	contMap := map[string]*apicontainer.Container{
+		"target":     target,
+		"dependency": dep,
+	}
+
+	_, err := verifyContainerOrderingStatusResolvable(target, contMap, &config.Config{}, containerOrderingDependenciesIsResolved)
+	require.Error(t, err)
+	assert.True(t, err.IsTerminal())
+	assert.Equal(t, "dependency graph: container ordering dependency [dependency] for target [target] "+
+		"did not reach condition HEALTHY within the start timeout of 10s", err.Error())
+}
+
+func TestUnresolvedContainerOrderingDependencies(t *testing.T) {
+	testcases := []struct {
+		name               string
+		condition          string
+		dependencyStatus   apicontainerstatus.ContainerStatus
+		dependencyExitCode *int
+		dependencyHealth   apicontainerstatus.ContainerHealthStatus
+		expectedBlocked    bool
+	}{
+		{
+			name:             "success condition while dependency is running",
+			condition:        successCondition,
+			dependencyStatus: apicontainerstatus.ContainerRunning,
+			expectedBlocked:  true,
+		},
+		{
+			name:               "success condition after dependency exited successfully",
+			condition:          successCondition,
+			dependencyStatus:   apicontainerstatus.ContainerStopped,
+			dependencyExitCode: aws.Int(0),
+			expectedBlocked:    false,
+		},
+		{
+			name:             "healthy condition while dependency is unhealthy",
+			condition:        healthyCondition,
+			dependencyStatus: apicontainerstatus.ContainerRunning,
+			dependencyHealth: apicontainerstatus.ContainerUnhealthy,
+			expectedBlocked:  true,
+		},
+		{
+			name:             "healthy condition after dependency is healthy",
+			condition:        healthyCondition,
+			dependencyStatus: apicontainerstatus.ContainerRunning,
+			dependencyHealth: apicontainerstatus.ContainerHealthy,
+			expectedBlocked:  false,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			dependsOn := apicontainer.DependsOn{ContainerName: "dependency", Condition: tc.condition}
+			target := &apicontainer.Container{
+				Name:                "target",
+				KnownStatusUnsafe:   apicontainerstatus.ContainerPulled,
+				DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+				DependsOnUnsafe:     []apicontainer.DependsOn{dependsOn},
+			}
+			dep := &apicontainer.Container{
+				Name:                "dependency",
+				KnownStatusUnsafe:   tc.dependencyStatus,
+				DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+				KnownExitCodeUnsafe: tc.dependencyExitCode,
+				HealthCheckType:     apicontainer.DockerHealthCheckType,
+				Health:              apicontainer.HealthStatus{Status: tc.dependencyHealth},
+			}
+
+			unresolved := UnresolvedContainerOrderingDependencies(target,
+				[]*apicontainer.Container{target, dep}, &config.Config{})
+			if tc.expectedBlocked {
+				assert.Equal(t, []apicontainer.DependsOn{dependsOn}, unresolved)
+			} else {
+				assert.Empty(t, unresolved)
+			}
+		})
+	}
+}
@@ -49,6 +49,7 @@ type ImageManager interface {
 	StartImageCleanupProcess(ctx context.Context)
 	SetDataClient(dataClient data.Client)
 	AddImageToCleanUpExclusionList(image string)
+	RecordPrefetchedImage(imageName string) error
 }
 
 // dockerImageManager accounts all the images and their states in the instance.
@@ -70,6 +71,7 @@ type dockerImageManager struct {
 	nonECSContainerCleanupWaitDuration time.Duration
 	numNonECSContainersToDelete        int
 	nonECSMinimumAgeBeforeDeletion     time.Duration
+	prefetchRetention                  time.Duration
 }
 
 // ImageStatesForDeletion is used for implementing the sort interface
@@ -89,6 +91,7 @@ func NewImageManager(cfg *config.Config, client dockerapi.DockerClient, state do
 		nonECSContainerCleanupWaitDuration: cfg.TaskCleanupWaitDuration,
 		numNonECSContainersToDelete:        cfg.NumNonECSContainersToDeletePerCycle,
 		nonECSMinimumAgeBeforeDeletion:     cfg.NonECSMinimumImageDeletionAge,
+		prefetchRetention:                  cfg.ImagePrefetchRetention,
 	}
 }
 
@@ -224,6 +227,37 @@ func (imageManager *dockerImageManager) addContainerReferenceToNewImageState(con
 	}
 }
 
+// RecordPrefetchedImage adds the image that was pulled for the prefetch list to the image
+// states, and marks it prefetched so that it's kept from cleanup until it's unused for
+// the prefetch retention.
+func (imageManager *dockerImageManager) RecordPrefetchedImage(imageName string) error {
+	imageInspected, err := imageManager.client.InspectImage(imageName)
+	if err != nil {
+		return fmt.Errorf("unable to inspect prefetched image %s: %w", imageName, err)
+	}
+	imageManager.updateLock.Lock()
+	defer imageManager.updateLock.Unlock()
+	imageManager.removeExistingImageNameOfDifferentID(imageName, imageInspected.ID)
+	now := time.Now()
+	imageState, ok := imageManager.getImageState(imageInspected.ID)
+	if !ok {
+		imageState = &image.ImageState{
+			Image: &image.Image{
+				ImageID: imageInspected.ID,
+				Size:    imageInspected.Size,
+			},
+			PulledAt:   now,
+			LastUsedAt: now,
+		}
+		imageManager.imageStates = append(imageManager.imageStates, imageState)
+	}
+	imageState.AddImageName(imageName)
+	imageState.SetPullSucceeded(true)
+	imageState.SetPrefetchedAt(now)
+	imageManager.saveImageStateData(imageState)
+	return nil
+}
+
 // RemoveContainerReferenceFromImageState removes container reference from the corresponding imageState object
 func (imageManager *dockerImageManager) RemoveContainerReferenceFromImageState(container *apicontainer.Container) error {
 	// this lock is for reading image states and finding the one that the container belongs to
@@ -618,6 +652,9 @@ func (imageManager *dockerImageManager) imagesConsiderForDeletion(allImageStates
 }
 
 func (imageManager *dockerImageManager) isExcludedFromCleanup(imageState *image.ImageState) bool {
+	if imageManager.isPinnedByPrefetch(imageState) {
+		return true
+	}
 	for _, ecsName := range imageState.Image.Names {
 		for _, exclusionName := range imageManager.imageCleanupExclusionList {
 			if ecsName == exclusionName {
@@ -628,6 +665,20 @@ func (imageManager *dockerImageManager) isExcludedFromCleanup(imageState *image.
 	return false
 }
 
+// isPinnedByPrefetch returns whether the image was prefetched, and hasn't been unused for the
+// prefetch retention since it was last used or prefetched.
+func (imageManager *dockerImageManager) isPinnedByPrefetch(imageState *image.ImageState) bool {
+	prefetchedAt := imageState.GetPrefetchedAt()
+	if prefetchedAt.IsZero() {
+		return false
+	}
+	lastUsedAt := imageState.LastUsedAt
+	if prefetchedAt.After(lastUsedAt) {
+		lastUsedAt = prefetchedAt
+	}
+	return time.Since(lastUsedAt) < imageManager.prefetchRetention
+}
+
 func (imageManager *dockerImageManager) removeLeastRecentlyUsedImage(ctx context.Context) error {
 	leastRecentlyUsedImage := imageManager.getUnusedImageForDeletion()
 	if leastRecentlyUsedImage == nil {
@@ -1942,3 +1942,64 @@ func TestImageCleanupProcessNotStart(t *testing.T) {
 	imageManager.StartImageCleanupProcess(ctx)
 	// Nothing should happen.
 }
+
+func TestRecordPrefetchedImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_dockerapi.NewMockDockerClient(ctrl)
+	imageManager := &dockerImageManager{client: client, state: dockerstate.NewTaskEngineState()}
+	imageManager.SetDataClient(data.NewNoopClient())
+
+	client.EXPECT().InspectImage("nginx:latest").Return(&types.ImageInspect{ID: "sha256:nginx", Size: 42}, nil).Times(2)
+	require.NoError(t, imageManager.RecordPrefetchedImage("nginx:latest"))
+	imageState, ok := imageManager.getImageState("sha256:nginx")
+	require.True(t, ok)
+	assert.Equal(t, []string{"nginx:latest"}, imageState.Image.Names)
+	assert.True(t, imageState.GetPullSucceeded())
+	prefetchedAt := imageState.GetPrefetchedAt()
+	assert.False(t, prefetchedAt.IsZero())
+
+	// Prefetching the image again updates the existing image state
+	require.NoError(t, imageManager.RecordPrefetchedImage("nginx:latest"))
+	assert.Len(t, imageManager.getAllImageStates(), 1)
+	assert.False(t, imageState.GetPrefetchedAt().Before(prefetchedAt))
+
+	client.EXPECT().InspectImage("missing").Return(nil, errors.New("no such image"))
+	assert.Error(t, imageManager.RecordPrefetchedImage("missing"))
+	assert.Len(t, imageManager.getAllImageStates(), 1)
+}
+
+func TestImageCleanupPrefetchedImageRetention(t *testing.T) {
+	imageManager := &dockerImageManager{prefetchRetention: time.Hour}
+	testCases := []struct {
+		name         string
+		prefetchedAt time.Time
+		lastUsedAt   time.Time
+		excluded     bool
+	}{
+		{name: "not prefetched", lastUsedAt: time.Now(), excluded: false},
+		{name: "prefetched within retention", prefetchedAt: time.Now().Add(-time.Minute), excluded: true},
+		{
+			name:         "used within retention",
+			prefetchedAt: time.Now().Add(-2 * time.Hour),
+			lastUsedAt:   time.Now().Add(-time.Minute),
+			excluded:     true,
+		},
+		{
+			name:         "unused for longer than retention",
+			prefetchedAt: time.Now().Add(-3 * time.Hour),
+			lastUsedAt:   time.Now().Add(-2 * time.Hour),
+			excluded:     false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			imageState := &image.ImageState{
+				Image:      &image.Image{ImageID: "sha256:nginx", Names: []string{"nginx:latest"}},
+				LastUsedAt: tc.lastUsedAt,
+			}
+			imageState.SetPrefetchedAt(tc.prefetchedAt)
+			assert.Equal(t, tc.excluded, imageManager.isExcludedFromCleanup(imageState))
+		})
+	}
+}
@@ -32,6 +32,7 @@ import (
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
+	"github.com/aws/amazon-ecs-agent/agent/containeroutput"
 	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
@@ -40,8 +41,10 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/engine/execcmd"
 	"github.com/aws/amazon-ecs-agent/agent/engine/serviceconnect"
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
 	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/aws/amazon-ecs-agent/agent/taskfirewall"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource/credentialspec"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource/firelens"
@@ -132,7 +135,7 @@ type DockerTaskEngine struct {
 	// This is used to checkpoint state to disk so tasks may survive agent
 	// failures or updates
 	state        dockerstate.TaskEngineState
-	managedTasks map[string]*managedTask
+	managedTasks managedTaskMap
 
 	// waitingTasksQueue is a FIFO queue of tasks waiting to acquire host resources
 	waitingTaskQueue []*managedTask
@@ -153,7 +156,8 @@ type DockerTaskEngine struct {
 	// tasksLock is a mutex that the task engine must acquire before changing
 	// any task's state which it manages. Since this is a lock that encompasses
 	// all tasks, it must not acquire it for any significant duration
-	// The write mutex should be taken when adding and removing tasks from managedTasks.
+	// The write mutex should be taken when adding and removing tasks from managedTasks,
+	// which is read without it.
 	tasksLock sync.RWMutex
 	// waitingTasksLock is a mutex for operations on waitingTasksQueue
 	waitingTasksLock sync.RWMutex
@@ -169,6 +173,7 @@ type DockerTaskEngine struct {
 	imageManager                        ImageManager
 	containerStatusToTransitionFunction map[apicontainerstatus.ContainerStatus]transitionApplyFunc
 	metadataManager                     containermetadata.Manager
+	outputManager                       containeroutput.Manager
 	serviceconnectManager               serviceconnect.Manager
 	hostResourceManager                 *HostResourceManager
 	serviceconnectRelay                 *apitask.Task
@@ -193,6 +198,18 @@ type DockerTaskEngine struct {
 	stopContainerBackoffMin   time.Duration
 	stopContainerBackoffMax   time.Duration
 	namespaceHelper           ecscni.NamespaceHelper
+	taskFirewall              *taskfirewall.Firewall
+	gpuRuntime                gpu.RuntimeStatusReporter
+	// lazyLoadingSnapshotter is the snapshotter that lazily loads images, and
+	// manifestInspector the inspector of the manifests of the images to pull. Images are
+	// pulled in full if either is unset.
+	lazyLoadingSnapshotter string
+	manifestInspector      dockerapi.ImageManifestInspector
+	lazyPullFallbacks      uint64
+	drain                  *drainCoordinator
+	reconciliation         reconciliationTracker
+	deferredChecks         deferredTaskChecks
+	resourceProvisioning   resourceProvisioning
 }
 
 // NewDockerTaskEngine returns a created, but uninitialized, DockerTaskEngine.
@@ -216,7 +233,6 @@ func NewDockerTaskEngine(cfg *config.Config,
 		dataClient: data.NewNoopClient(),
 
 		state:                  state,
-		managedTasks:           make(map[string]*managedTask),
 		stateChangeEvents:      make(chan statechange.Event),
 		monitorQueuedTaskEvent: make(chan struct{}, 1),
 
@@ -229,6 +245,7 @@ func NewDockerTaskEngine(cfg *config.Config,
 		appnetClient:               appnet.Client(),
 
 		metadataManager:                   metadataManager,
+		outputManager:                     containeroutput.NewManager(client, cfg),
 		serviceconnectManager:             serviceConnectManager,
 		taskSteadyStatePollInterval:       defaultTaskSteadyStatePollInterval,
 		taskSteadyStatePollIntervalJitter: defaultTaskSteadyStatePollIntervalJitter,
@@ -239,6 +256,8 @@ func NewDockerTaskEngine(cfg *config.Config,
 		stopContainerBackoffMin:           defaultStopContainerBackoffMin,
 		stopContainerBackoffMax:           defaultStopContainerBackoffMax,
 		namespaceHelper:                   ecscni.NewNamespaceHelper(client),
+		drain:                             newDrainCoordinator(cfg.StopLastTaskFamilies),
+		resourceProvisioning:              resourceProvisioning{policies: defaultResourceRetryPolicies},
 	}
 
 	dockerTaskEngine.initializeContainerStatusToTransitionFunction()
@@ -468,9 +487,7 @@ func (engine *DockerTaskEngine) startPeriodicExecAgentsMonitoring(ctx context.Co
 
 func (engine *DockerTaskEngine) monitorExecAgentProcesses(ctx context.Context) {
 	// TODO: [ecs-exec]add jitter between containers to not overload docker with top calls
-	engine.tasksLock.RLock()
-	defer engine.tasksLock.RUnlock()
-	for _, mTask := range engine.managedTasks {
+	for _, mTask := range engine.managedTasks.load() {
 		task := mTask.Task
 
 		if task.GetKnownStatus() != apitaskstatus.TaskRunning {
@@ -572,9 +589,7 @@ func (engine *DockerTaskEngine) Disable() {
 
 // isTaskManaged checks if task for the corresponding arn is present
 func (engine *DockerTaskEngine) isTaskManaged(arn string) bool {
-	engine.tasksLock.RLock()
-	defer engine.tasksLock.RUnlock()
-	_, ok := engine.managedTasks[arn]
+	_, ok := engine.managedTasks.get(arn)
 	return ok
 }
 
@@ -637,6 +652,8 @@ func (engine *DockerTaskEngine) synchronizeState() {
 	// - starting managedTask's overseeTask goroutines
 	engine.reconcileHostResources()
 	tasksToStart := engine.filterTasksToStartUnsafe(tasks)
+	// Container addresses are up to date once the container statuses are synchronized
+	engine.reconcileTaskFirewall(tasks)
 	for _, task := range tasks {
 		task.InitializeResources(engine.resourceFields)
 		engine.saveTaskData(task)
@@ -652,6 +669,7 @@ func (engine *DockerTaskEngine) synchronizeState() {
 // in tasks that need to be started.
 func (engine *DockerTaskEngine) filterTasksToStartUnsafe(tasks []*apitask.Task) []*apitask.Task {
 	var tasksToStart []*apitask.Task
+	var work []*taskReconciliation
 	for _, task := range tasks {
 		conts, ok := engine.state.ContainerMapByArn(task.Arn)
 		if !ok {
@@ -660,13 +678,10 @@ func (engine *DockerTaskEngine) filterTasksToStartUnsafe(tasks []*apitask.Task)
 			continue
 		}
 
-		for _, cont := range conts {
-			engine.synchronizeContainerStatus(cont, task)
-			engine.saveDockerContainerData(cont) // persist the container with the updated information.
-		}
-
+		work = append(work, engine.newTaskReconciliation(task, conts))
 		tasksToStart = append(tasksToStart, task)
 	}
+	engine.synchronizeContainerStatuses(work)
 
 	return tasksToStart
 }
@@ -697,6 +712,11 @@ func updateContainerMetadata(metadata *dockerapi.DockerContainerMetadata, contai
 		container.SetKnownExitCode(metadata.ExitCode)
 	}
 
+	// Set the pid, which changes every time the container is restarted
+	if metadata.PID != 0 {
+		container.SetPID(metadata.PID)
+	}
+
 	// Set port mappings
 	if len(metadata.PortBindings) != 0 && len(container.GetKnownPortBindings()) == 0 {
 		container.SetKnownPortBindings(metadata.PortBindings)
@@ -766,6 +786,18 @@ func (engine *DockerTaskEngine) synchronizeContainerStatus(container *apicontain
 	}
 
 	currentState, metadata := engine.client.DescribeContainer(engine.ctx, container.DockerID)
+	if dockerapi.IsConnectionError(metadata.Error) {
+		// Failing to reach the daemon says nothing about the container, so leave its
+		// status alone and check it again once the daemon is back
+		logger.Warn("Could not reach docker to describe previously known container; keeping known status", logger.Fields{
+			field.TaskID:    task.GetID(),
+			field.Container: container.DockerName,
+			field.DockerId:  container.DockerID,
+			field.Error:     metadata.Error,
+		})
+		engine.deferTaskStateCheck(task)
+		return
+	}
 	if metadata.Error != nil {
 		currentState = apicontainerstatus.ContainerStopped
 		// If this is a Docker API error
@@ -826,9 +858,16 @@ func (engine *DockerTaskEngine) checkTaskState(task *apitask.Task) {
 			continue
 		}
 		status, metadata := engine.client.DescribeContainer(engine.ctx, dockerID)
-		engine.tasksLock.RLock()
-		managedTask, ok := engine.managedTasks[task.Arn]
-		engine.tasksLock.RUnlock()
+		if dockerapi.IsConnectionError(metadata.Error) {
+			logger.Warn("Could not reach docker to check container state", logger.Fields{
+				field.TaskID:    task.GetID(),
+				field.Container: container.Name,
+				field.Error:     metadata.Error,
+			})
+			engine.deferTaskStateCheck(task)
+			return
+		}
+		managedTask, ok := engine.managedTasks.get(task.Arn)
 
 		if ok {
 			managedTask.emitDockerContainerChange(dockerContainerChange{
@@ -877,6 +916,17 @@ func (engine *DockerTaskEngine) sweepTask(task *apitask.Task) {
 			})
 		}
 	}
+
+	// Clean the captured output of the containers of the task
+	if engine.cfg.ContainerOutputCaptureEnabled.Enabled() {
+		err := engine.outputManager.Clean(task.Arn)
+		if err != nil {
+			logger.Warn("Error cleaning the captured output of the task", logger.Fields{
+				field.TaskID: task.GetID(),
+				field.Error:  err,
+			})
+		}
+	}
 }
 
 var removeAll = os.RemoveAll
@@ -898,6 +948,8 @@ func (engine *DockerTaskEngine) deleteTask(task *apitask.Task) {
 		}
 	}
 
+	engine.removeTaskFirewall(task)
+
 	tID := task.GetID()
 	if execcmd.IsExecEnabledTask(task) {
 		// cleanup host exec agent log dirs
@@ -948,7 +1000,7 @@ func (engine *DockerTaskEngine) deleteTask(task *apitask.Task) {
 	logger.Info("Finished removing task data, removing task from managed tasks", logger.Fields{
 		field.TaskID: task.GetID(),
 	})
-	delete(engine.managedTasks, task.Arn)
+	engine.managedTasks.remove(task.Arn)
 	engine.tasksLock.Unlock()
 }
 
@@ -1098,9 +1150,7 @@ func (engine *DockerTaskEngine) handleDockerEvent(event dockerapi.DockerContaine
 		return
 	}
 
-	engine.tasksLock.RLock()
-	managedTask, ok := engine.managedTasks[task.Arn]
-	engine.tasksLock.RUnlock()
+	managedTask, ok := engine.managedTasks.get(task.Arn)
 	if !ok {
 		logger.Critical("Could not find managed task for docker event", logger.Fields{
 			field.TaskID: task.GetID(),
@@ -1126,6 +1176,10 @@ func (engine *DockerTaskEngine) StateChangeEvents() chan statechange.Event {
 // AddTask starts tracking a task
 func (engine *DockerTaskEngine) AddTask(task *apitask.Task) {
 	defer metrics.MetricsEngineGlobal.RecordTaskEngineMetric("ADD_TASK")()
+	if reason := engine.gpuRuntimeUnavailableReason(task); reason != "" {
+		engine.rejectGPUTask(task, reason)
+		return
+	}
 	err := task.PostUnmarshalTask(engine.cfg, engine.credentialsManager,
 		engine.resourceFields, engine.client, engine.ctx)
 	if err != nil {
@@ -1284,6 +1338,10 @@ func (engine *DockerTaskEngine) imagePullRequired(imagePullBehavior config.Image
 }
 
 func (engine *DockerTaskEngine) concurrentPull(task *apitask.Task, container *apicontainer.Container) dockerapi.DockerContainerMetadata {
+	// Task pulls take priority over image prefetch pulls
+	imagePullPriority.taskPullStarted()
+	defer imagePullPriority.taskPullFinished()
+
 	logger.Debug("Attempting to obtain ImagePullDeleteLock to pull image for container", logger.Fields{
 		field.TaskID:    task.GetID(),
 		field.Container: container.Name,
@@ -1388,7 +1446,7 @@ func (engine *DockerTaskEngine) pullAndUpdateContainerReference(task *apitask.Ta
 		defer container.SetASMDockerAuthConfig(types.AuthConfig{})
 	}
 
-	metadata := engine.client.PullImage(engine.ctx, container.Image, container.RegistryAuthentication, engine.cfg.ImagePullTimeout)
+	metadata := engine.pullImage(task, container)
 
 	// Don't add internal images(created by ecs-agent) into imagemanger state
 	if container.IsInternal() {
@@ -1654,9 +1712,7 @@ func (engine *DockerTaskEngine) createContainer(task *apitask.Task, container *a
 				field.Error:     err,
 			})
 			// Emit a managedagent state chnage event if exec agent initialization fails
-			engine.tasksLock.RLock()
-			mTask, ok := engine.managedTasks[task.Arn]
-			engine.tasksLock.RUnlock()
+			mTask, ok := engine.managedTasks.get(task.Arn)
 			if ok {
 				mTask.emitManagedAgentEvent(mTask.Task, container, execcmd.ExecuteCommandAgentName, fmt.Sprintf("ExecuteCommandAgent Initialization failed - %v", err))
 			} else {
@@ -1771,6 +1827,27 @@ func getFirelensLogConfig(task *apitask.Task, container *apicontainer.Container,
 	return logConfig
 }
 
+// captureContainerOutput captures the output of the container to its output file. Failing
+// to capture the output is logged, and doesn't affect the container.
+func (engine *DockerTaskEngine) captureContainerOutput(task *apitask.Task, container *apicontainer.Container,
+	dockerID string) {
+	path, err := engine.outputManager.Capture(engine.ctx, task.Arn, container.Name, dockerID, container.HasTTY())
+	if err != nil {
+		logger.Warn("Failed to capture the output of container", logger.Fields{
+			field.TaskID:    task.GetID(),
+			field.Container: container.Name,
+			field.Error:     err,
+		})
+		return
+	}
+	container.SetOutputCaptureFile(path)
+	logger.Info("Capturing the output of container", logger.Fields{
+		field.TaskID:    task.GetID(),
+		field.Container: container.Name,
+		"file":          path,
+	})
+}
+
 func (engine *DockerTaskEngine) startContainer(task *apitask.Task, container *apicontainer.Container) dockerapi.DockerContainerMetadata {
 	logger.Info("Starting container", logger.Fields{
 		field.TaskID:    task.GetID(),
@@ -1791,6 +1868,13 @@ func (engine *DockerTaskEngine) startContainer(task *apitask.Task, container *ap
 		}
 	}
 
+	// The output of containers without a log driver is captured from before they are
+	// started, so that none of it is lost
+	if engine.cfg.ContainerOutputCaptureEnabled.Enabled() && !container.IsInternal() &&
+		container.GetLogDriver() == containeroutput.LogDriverNone {
+		engine.captureContainerOutput(task, container, dockerID)
+	}
+
 	startContainerBegin := time.Now()
 	dockerContainerMD := client.StartContainer(engine.ctx, dockerID, engine.cfg.ContainerStartTimeout)
 	if dockerContainerMD.Error != nil {
@@ -1906,9 +1990,7 @@ func (engine *DockerTaskEngine) startContainer(task *apitask.Task, container *ap
 				})
 			}
 
-			engine.tasksLock.RLock()
-			mTask, ok := engine.managedTasks[task.Arn]
-			engine.tasksLock.RUnlock()
+			mTask, ok := engine.managedTasks.get(task.Arn)
 			// whether we started or failed to start, we'll want to emit a state change event
 			// redundant state change events like RUNNING->RUNNING are allowed
 			if ok {
@@ -2343,7 +2425,7 @@ func (engine *DockerTaskEngine) removeContainer(task *apitask.Task, container *a
 // referenced task, and if needed applies it. It should not be called anywhere
 // but from 'AddTask' and is protected by the tasksLock lock there.
 func (engine *DockerTaskEngine) updateTaskUnsafe(task *apitask.Task, update *apitask.Task) {
-	managedTask, ok := engine.managedTasks[task.Arn]
+	managedTask, ok := engine.managedTasks.get(task.Arn)
 	if !ok {
 		logger.Critical("ACS message for a task we thought we managed, but don't!  Aborting.", logger.Fields{
 			field.TaskARN: task.Arn,
@@ -2355,6 +2437,9 @@ func (engine *DockerTaskEngine) updateTaskUnsafe(task *apitask.Task, update *api
 	// This does block the engine's ability to ingest any new events (including
 	// stops for past tasks, ack!), but this is necessary for correctness
 	updateDesiredStatus := update.GetDesiredStatus()
+	if updateDesiredStatus.Terminal() && engine.deferStopUnsafe(task, update) {
+		return
+	}
 	logger.Debug("Putting update on the acs channel", logger.Fields{
 		field.TaskID:        task.GetID(),
 		field.DesiredStatus: updateDesiredStatus.String(),
@@ -2376,9 +2461,7 @@ func (engine *DockerTaskEngine) transitionContainer(task *apitask.Task, containe
 	// This is safe because 'applyContainerState' will not mutate the task
 	metadata := engine.applyContainerState(task, container, to)
 
-	engine.tasksLock.RLock()
-	managedTask, ok := engine.managedTasks[task.Arn]
-	engine.tasksLock.RUnlock()
+	managedTask, ok := engine.managedTasks.get(task.Arn)
 	if ok {
 		managedTask.emitDockerContainerChange(dockerContainerChange{
 			container: container,
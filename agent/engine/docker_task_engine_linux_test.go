@@ -291,12 +291,15 @@ func TestDeleteTaskBranchENIEnabled(t *testing.T) {
 }
 
 // TestResourceContainerProgressionFailure ensures that task moves to STOPPED when
-// resource creation fails
+// resource creation fails on every attempt
 func TestResourceContainerProgressionFailure(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.TODO())
 	defer cancel()
 	ctrl, client, mockTime, taskEngine, _, _, _, serviceConnectManager := mocks(t, ctx, &defaultConfig)
 	defer ctrl.Finish()
+	taskEngine.(*DockerTaskEngine).resourceProvisioning.policies = map[string]resourceRetryPolicy{
+		"cgroup": {maxAttempts: 2, backoffMin: time.Millisecond, backoffMax: time.Millisecond},
+	}
 	sleepTask := testdata.LoadTask("sleep5")
 	sleepContainer := sleepTask.Containers[0]
 
@@ -317,7 +320,9 @@ func TestResourceContainerProgressionFailure(t *testing.T) {
 	client.EXPECT().ContainerEvents(gomock.Any()).Return(eventStream, nil)
 	serviceConnectManager.EXPECT().GetAppnetContainerTarballDir().AnyTimes()
 	gomock.InOrder(
-		// resource creation failure
+		// resource creation failure, and its retry
+		mockControl.EXPECT().Exists(gomock.Any()).Return(false),
+		mockControl.EXPECT().Create(gomock.Any()).Return(errors.New("cgroup create error")),
 		mockControl.EXPECT().Exists(gomock.Any()).Return(false),
 		mockControl.EXPECT().Create(gomock.Any()).Return(errors.New("cgroup create error")),
 	)
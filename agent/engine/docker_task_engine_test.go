@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"path/filepath"
 	"strconv"
@@ -1309,7 +1310,7 @@ func TestTaskWithCircularDependency(t *testing.T) {
 	_, ok := taskEngine.(*DockerTaskEngine).state.TaskByArn(task.Arn)
 	assert.True(t, ok, "Task state should be added to the agent state")
 
-	_, ok = taskEngine.(*DockerTaskEngine).managedTasks[task.Arn]
+	_, ok = taskEngine.(*DockerTaskEngine).managedTasks.get(task.Arn)
 	assert.False(t, ok, "Task should not be added to task manager for processing")
 }
 
@@ -1865,7 +1866,7 @@ func TestNewTaskTransitionOnRestart(t *testing.T) {
 	// Set the task to be stopped so that the process can done quickly
 	testTask.SetDesiredStatus(apitaskstatus.TaskStopped)
 	dockerTaskEngine.synchronizeState()
-	_, ok := dockerTaskEngine.managedTasks[testTask.Arn]
+	_, ok := dockerTaskEngine.managedTasks.get(testTask.Arn)
 	assert.True(t, ok, "task wasnot started")
 }
 
@@ -2071,6 +2072,116 @@ func TestSynchronizeContainerStatus(t *testing.T) {
 	}
 }
 
+// TestSynchronizeContainerStatusDescribeErrors tests that a container is only
+// assumed dead when docker answers the describe call with an error, and not when
+// docker cannot be reached
+func TestSynchronizeContainerStatusDescribeErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		describeErr    error
+		expectVanished bool
+	}{
+		{
+			name:           "connection error",
+			describeErr:    dockerapi.DockerUnavailableError{RetryAfter: time.Second},
+			expectVanished: false,
+		},
+		{
+			name:           "api error",
+			describeErr:    errors.New("No such container: 1234"),
+			expectVanished: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			ctrl, client, _, taskEngine, _, imageManager, _, _ := mocks(t, ctx, &defaultConfig)
+			defer ctrl.Finish()
+
+			testContainer := &apicontainer.Container{
+				Name: "c1",
+				Type: apicontainer.ContainerNormal,
+			}
+			testContainer.SetKnownStatus(apicontainerstatus.ContainerRunning)
+			testTask := &apitask.Task{
+				Containers: []*apicontainer.Container{testContainer},
+			}
+			dockerContainer := &apicontainer.DockerContainer{
+				DockerID:   "1234",
+				DockerName: "c1",
+				Container:  testContainer,
+			}
+
+			client.EXPECT().DescribeContainer(gomock.Any(), "1234").Return(apicontainerstatus.ContainerStatusNone,
+				dockerapi.DockerContainerMetadata{
+					Error: dockerapi.CannotDescribeContainerError{FromError: tc.describeErr},
+				})
+			if tc.expectVanished {
+				imageManager.EXPECT().RemoveContainerReferenceFromImageState(testContainer)
+			}
+
+			taskEngine.(*DockerTaskEngine).synchronizeContainerStatus(dockerContainer, testTask)
+			if tc.expectVanished {
+				assert.Equal(t, apicontainerstatus.ContainerStopped, testContainer.GetKnownStatus())
+				assert.NotNil(t, testContainer.ApplyingError)
+			} else {
+				assert.Equal(t, apicontainerstatus.ContainerRunning, testContainer.GetKnownStatus())
+				assert.Nil(t, testContainer.ApplyingError)
+			}
+		})
+	}
+}
+
+// TestDeferredTaskStateChecks tests that the state check of a task that can't reach docker
+// is queued until docker answers, instead of deciding on the task without its containers.
+func TestDeferredTaskStateChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	ctrl, client, _, taskEngine, _, _, _, _ := mocks(t, ctx, &defaultConfig)
+	defer ctrl.Finish()
+	dockerTaskEngine := taskEngine.(*DockerTaskEngine)
+	dockerTaskEngine.deferredChecks.interval = 10 * time.Millisecond
+
+	testContainer := &apicontainer.Container{Name: "c1", RuntimeID: "1234"}
+	testTask := &apitask.Task{
+		Arn:        "arn:aws:ecs:us-west-2:1234567890:task/cluster/task1",
+		Containers: []*apicontainer.Container{testContainer},
+	}
+	mTestTask := &managedTask{
+		Task:           testTask,
+		engine:         dockerTaskEngine,
+		ctx:            ctx,
+		dockerMessages: make(chan dockerContainerChange, 1),
+	}
+	dockerTaskEngine.managedTasks.set(testTask.Arn, mTestTask)
+
+	unavailable := dockerapi.DockerContainerMetadata{
+		Error: dockerapi.CannotDescribeContainerError{FromError: dockerapi.DockerUnavailableError{RetryAfter: time.Second}},
+	}
+	gomock.InOrder(
+		client.EXPECT().DescribeContainer(gomock.Any(), "1234").Return(apicontainerstatus.ContainerStatusNone,
+			unavailable).Times(2),
+		client.EXPECT().DescribeContainer(gomock.Any(), "1234").Return(apicontainerstatus.ContainerRunning,
+			dockerapi.DockerContainerMetadata{DockerID: "1234"}),
+	)
+
+	dockerTaskEngine.checkTaskState(testTask)
+	select {
+	case change := <-mTestTask.dockerMessages:
+		assert.Equal(t, testContainer, change.container)
+		assert.Equal(t, apicontainerstatus.ContainerRunning, change.event.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deferred state check of the task wasn't retried")
+	}
+	assert.Eventually(t, func() bool {
+		dockerTaskEngine.deferredChecks.lock.Lock()
+		defer dockerTaskEngine.deferredChecks.lock.Unlock()
+		return !dockerTaskEngine.deferredChecks.retrying
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
 // TestHandleDockerHealthEvent tests the docker health event will only cause the
 // container health status change
 func TestHandleDockerHealthEvent(t *testing.T) {
@@ -3316,7 +3427,7 @@ func TestStartExecAgent(t *testing.T) {
 		}
 
 		dockerTaskEngine.state.AddTask(testTask)
-		dockerTaskEngine.managedTasks[testTask.Arn] = mTestTask
+		dockerTaskEngine.managedTasks.set(testTask.Arn, mTestTask)
 
 		// check for expected taskEvent in stateChangeEvents
 		waitDone := make(chan struct{})
@@ -3519,7 +3630,7 @@ func TestMonitorExecAgentProcesses(t *testing.T) {
 			stateChangeEvents: stateChangeEvents,
 		}
 		dockerTaskEngine.state.AddTask(testTask)
-		dockerTaskEngine.managedTasks[testTask.Arn] = mTestTask
+		dockerTaskEngine.managedTasks.set(testTask.Arn, mTestTask)
 		restartCtx, restartCancel := context.WithTimeout(context.Background(), time.Second)
 		defer restartCancel()
 		// return execcmd.Restarted to ensure container event emission
@@ -3599,7 +3710,7 @@ func TestMonitorExecAgentProcessExecDisabled(t *testing.T) {
 			enableExecCommandAgentForContainer(testTask.Containers[0], apicontainer.ManagedAgentState{})
 		}
 		dockerTaskEngine.state.AddTask(testTask)
-		dockerTaskEngine.managedTasks[testTask.Arn] = &managedTask{Task: testTask}
+		dockerTaskEngine.managedTasks.set(testTask.Arn, &managedTask{Task: testTask})
 		dockerTaskEngine.monitorExecAgentProcesses(ctx)
 		// absence of top container expect call indicates it shouldn't have been called
 		time.Sleep(10 * time.Millisecond)
@@ -3645,7 +3756,7 @@ func TestMonitorExecAgentsMultipleContainers(t *testing.T) {
 	}
 
 	dockerTaskEngine.state.AddTask(testTask)
-	dockerTaskEngine.managedTasks[testTask.Arn] = mTestTask
+	dockerTaskEngine.managedTasks.set(testTask.Arn, mTestTask)
 	wg := &sync.WaitGroup{}
 	numContainers := len(testTask.Containers)
 	wg.Add(numContainers)
@@ -3700,7 +3811,7 @@ func TestPeriodicExecAgentsMonitoring(t *testing.T) {
 		}})
 	taskEngine.(*DockerTaskEngine).monitorExecAgentsInterval = 2 * time.Millisecond
 	taskEngine.(*DockerTaskEngine).state.AddTask(testTask)
-	taskEngine.(*DockerTaskEngine).managedTasks[testTask.Arn] = &managedTask{Task: testTask}
+	taskEngine.(*DockerTaskEngine).managedTasks.set(testTask.Arn, &managedTask{Task: testTask})
 	topCtx, topCancel := context.WithTimeout(context.Background(), time.Second)
 	defer topCancel()
 	go taskEngine.(*DockerTaskEngine).startPeriodicExecAgentsMonitoring(ctx)
@@ -3760,7 +3871,7 @@ func TestCreateContainerWithExecAgent(t *testing.T) {
 			}
 
 			taskEngine.state.AddTask(sleepTask)
-			taskEngine.managedTasks[sleepTask.Arn] = mTestTask
+			taskEngine.managedTasks.set(sleepTask.Arn, mTestTask)
 
 			waitDone := make(chan struct{})
 			var reason string
@@ -3791,3 +3902,61 @@ func TestCreateContainerWithExecAgent(t *testing.T) {
 		})
 	}
 }
+
+// TestStartContainerCapturesOutput tests that the output of containers without a log driver is
+// captured if enabled, and that failing to capture it doesn't fail starting the container.
+func TestStartContainerCapturesOutput(t *testing.T) {
+	testCases := []struct {
+		name          string
+		enabled       bool
+		logDriver     string
+		attachErr     error
+		expectAttach  bool
+		expectCapture bool
+	}{
+		{name: "disabled", logDriver: "none"},
+		{name: "log driver", enabled: true, logDriver: "awslogs"},
+		{name: "no log driver", enabled: true, logDriver: "none", expectAttach: true, expectCapture: true},
+		{name: "attach failure", enabled: true, logDriver: "none", attachErr: errors.New("attach failed"), expectAttach: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			cfg := defaultConfig
+			cfg.DataDir = t.TempDir()
+			cfg.ContainerOutputCaptureEnabled = config.BooleanDefaultFalse{Value: config.NotSet}
+			if tc.enabled {
+				cfg.ContainerOutputCaptureEnabled = config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
+			}
+			ctrl, client, _, taskEngine, _, _, _, _ := mocks(t, ctx, &cfg)
+			defer ctrl.Finish()
+
+			testTask := testdata.LoadTask("sleep5")
+			container := testTask.Containers[0]
+			container.SetRuntimeID(containerID)
+			hostConfig := fmt.Sprintf(`{"LogConfig":{"Type":"%s"}}`, tc.logDriver)
+			container.DockerConfig.HostConfig = &hostConfig
+
+			if tc.expectAttach {
+				var stream io.ReadCloser
+				if tc.attachErr == nil {
+					stream = io.NopCloser(strings.NewReader(""))
+				}
+				client.EXPECT().AttachContainer(gomock.Any(), containerID, dockerclient.AttachContainerTimeout).
+					Return(stream, tc.attachErr)
+			}
+			client.EXPECT().StartContainer(gomock.Any(), containerID, cfg.ContainerStartTimeout).Return(
+				dockerapi.DockerContainerMetadata{DockerID: containerID})
+
+			ret := taskEngine.(*DockerTaskEngine).startContainer(testTask, container)
+			assert.NoError(t, ret.Error)
+			if tc.expectCapture {
+				assert.True(t, strings.HasSuffix(container.GetOutputCaptureFile(),
+					filepath.Join("output", testTask.GetID(), container.Name, "output.log")))
+			} else {
+				assert.Empty(t, container.GetOutputCaptureFile())
+			}
+		})
+	}
+}
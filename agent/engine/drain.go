@@ -0,0 +1,256 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"sort"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const (
+	// DrainStopPhaseRegular is the stop phase of the tasks that are stopped first while
+	// the instance is drained.
+	DrainStopPhaseRegular = 1
+	// DrainStopPhaseStopLast is the stop phase of the tasks of the stop-last families.
+	DrainStopPhaseStopLast = 2
+
+	// DrainReleasedAllTasksStopped means the stops of the stop-last tasks were released
+	// because all other tasks had stopped.
+	DrainReleasedAllTasksStopped = "AllOtherTasksStopped"
+	// DrainReleasedDeadlineReached means the stops of the stop-last tasks were released
+	// because the drain deadline was reached.
+	DrainReleasedDeadlineReached = "DeadlineReached"
+)
+
+// DrainStatus is the stop ordering of the tasks while the instance is drained.
+type DrainStatus struct {
+	Draining         bool       `json:"Draining"`
+	StartedAt        *time.Time `json:"StartedAt,omitempty"`
+	Deadline         *time.Time `json:"Deadline,omitempty"`
+	StopLastFamilies []string   `json:"StopLastFamilies,omitempty"`
+	// StopLastReleased is true once the stops of the stop-last tasks are no longer held
+	// back, for the reason in ReleaseReason.
+	StopLastReleased bool   `json:"StopLastReleased"`
+	ReleaseReason    string `json:"ReleaseReason,omitempty"`
+	// Tasks are the tasks in the order they are stopped in.
+	Tasks []DrainTaskStatus `json:"Tasks,omitempty"`
+}
+
+// DrainTaskStatus is the stop phase and status of a task while the instance is drained.
+type DrainTaskStatus struct {
+	Arn           string `json:"Arn"`
+	Family        string `json:"Family"`
+	StopPhase     int    `json:"StopPhase"`
+	KnownStatus   string `json:"KnownStatus"`
+	DesiredStatus string `json:"DesiredStatus"`
+	// StopDeferred is true if the task was asked to stop and the stop is held back.
+	StopDeferred bool `json:"StopDeferred,omitempty"`
+}
+
+// DrainStatusReporter reports the stop ordering of the tasks while the instance is
+// drained.
+type DrainStatusReporter interface {
+	DrainStatus() DrainStatus
+}
+
+// deferredStop is a task stop that is held back, and the update that asked for it.
+type deferredStop struct {
+	task   *apitask.Task
+	update *apitask.Task
+}
+
+// drainCoordinator holds back the stops of the tasks of the stop-last families while
+// the instance is drained. It's guarded by the engine's tasks lock, except for now
+// which can be swapped out in tests.
+type drainCoordinator struct {
+	stopLastFamilies map[string]bool
+	now              func() time.Time
+
+	draining      bool
+	startedAt     time.Time
+	deadline      time.Time
+	released      bool
+	releaseReason string
+	deferred      []deferredStop
+}
+
+func newDrainCoordinator(stopLastFamilies []string) *drainCoordinator {
+	families := make(map[string]bool, len(stopLastFamilies))
+	for _, family := range stopLastFamilies {
+		families[family] = true
+	}
+	return &drainCoordinator{
+		stopLastFamilies: families,
+		now:              time.Now,
+	}
+}
+
+// holding returns true if stops of stop-last tasks are held back.
+func (d *drainCoordinator) holding() bool {
+	return d != nil && d.draining && !d.released && d.now().Before(d.deadline)
+}
+
+func (d *drainCoordinator) isStopLast(task *apitask.Task) bool {
+	return d != nil && d.stopLastFamilies[task.Family]
+}
+
+func (d *drainCoordinator) isDeferred(taskARN string) bool {
+	for _, stop := range d.deferred {
+		if stop.task.Arn == taskARN {
+			return true
+		}
+	}
+	return false
+}
+
+// StartDrain puts the engine in drain mode until the deadline. While draining, the
+// stops of tasks of the stop-last families are held back until all other tasks have
+// stopped or the deadline is reached.
+func (engine *DockerTaskEngine) StartDrain(deadline time.Time) {
+	engine.tasksLock.Lock()
+	defer engine.tasksLock.Unlock()
+	if engine.drain == nil || engine.drain.draining {
+		return
+	}
+	engine.drain.draining = true
+	engine.drain.startedAt = engine.drain.now()
+	engine.drain.deadline = deadline
+	logger.Info("Draining tasks, tasks of the stop-last families are stopped after all other tasks", logger.Fields{
+		"deadline": deadline.Format(time.RFC3339),
+	})
+	time.AfterFunc(deadline.Sub(engine.drain.startedAt), engine.releaseDeferredStops)
+}
+
+// DrainStatus returns the stop ordering of the tasks while the instance is drained.
+func (engine *DockerTaskEngine) DrainStatus() DrainStatus {
+	engine.tasksLock.RLock()
+	defer engine.tasksLock.RUnlock()
+	d := engine.drain
+	if d == nil || !d.draining {
+		return DrainStatus{}
+	}
+	startedAt, deadline := d.startedAt, d.deadline
+	status := DrainStatus{
+		Draining:         true,
+		StartedAt:        &startedAt,
+		Deadline:         &deadline,
+		StopLastReleased: d.released,
+		ReleaseReason:    d.releaseReason,
+	}
+	for family := range d.stopLastFamilies {
+		status.StopLastFamilies = append(status.StopLastFamilies, family)
+	}
+	sort.Strings(status.StopLastFamilies)
+	for _, mtask := range engine.managedTasks.load() {
+		if mtask.IsInternal {
+			continue
+		}
+		phase := DrainStopPhaseRegular
+		if d.isStopLast(mtask.Task) {
+			phase = DrainStopPhaseStopLast
+		}
+		status.Tasks = append(status.Tasks, DrainTaskStatus{
+			Arn:           mtask.Arn,
+			Family:        mtask.Family,
+			StopPhase:     phase,
+			KnownStatus:   mtask.GetKnownStatus().String(),
+			DesiredStatus: mtask.GetDesiredStatus().String(),
+			StopDeferred:  d.isDeferred(mtask.Arn),
+		})
+	}
+	sort.Slice(status.Tasks, func(i, j int) bool {
+		if status.Tasks[i].StopPhase != status.Tasks[j].StopPhase {
+			return status.Tasks[i].StopPhase < status.Tasks[j].StopPhase
+		}
+		return status.Tasks[i].Arn < status.Tasks[j].Arn
+	})
+	return status
+}
+
+// deferStopUnsafe holds back the stop of a stop-last task while other tasks are still
+// running. It returns true if the stop was held back.
+func (engine *DockerTaskEngine) deferStopUnsafe(task *apitask.Task, update *apitask.Task) bool {
+	d := engine.drain
+	if !d.isStopLast(task) || !d.holding() || !engine.hasRunningRegularTasksUnsafe() {
+		return false
+	}
+	for i, stop := range d.deferred {
+		if stop.task.Arn == task.Arn {
+			d.deferred[i].update = update
+			return true
+		}
+	}
+	d.deferred = append(d.deferred, deferredStop{task: task, update: update})
+	logger.Info("Holding back stop of stop-last task until all other tasks are stopped", logger.Fields{
+		field.TaskID: task.GetID(),
+		"family":     task.Family,
+	})
+	return true
+}
+
+// hasRunningRegularTasksUnsafe returns true if tasks other than the stop-last tasks
+// haven't stopped yet.
+func (engine *DockerTaskEngine) hasRunningRegularTasksUnsafe() bool {
+	for _, mtask := range engine.managedTasks.load() {
+		if !mtask.IsInternal && !engine.drain.isStopLast(mtask.Task) && !mtask.GetKnownStatus().Terminal() {
+			return true
+		}
+	}
+	return false
+}
+
+// taskStoppedWhileDraining releases the held back stops if the stopped task was the
+// last of the other tasks.
+func (engine *DockerTaskEngine) taskStoppedWhileDraining() {
+	engine.tasksLock.RLock()
+	hasDeferred := engine.drain != nil && len(engine.drain.deferred) > 0
+	engine.tasksLock.RUnlock()
+	if hasDeferred {
+		// The stops are emitted to the managed tasks, which must not be waited for from
+		// the goroutine of the task that stopped
+		go engine.releaseDeferredStops()
+	}
+}
+
+// releaseDeferredStops emits the held back stops once all other tasks have stopped or
+// the deadline is reached.
+func (engine *DockerTaskEngine) releaseDeferredStops() {
+	engine.tasksLock.Lock()
+	defer engine.tasksLock.Unlock()
+	d := engine.drain
+	if d == nil || !d.draining || d.released {
+		return
+	}
+	reason := DrainReleasedAllTasksStopped
+	if !d.now().Before(d.deadline) {
+		reason = DrainReleasedDeadlineReached
+	} else if engine.hasRunningRegularTasksUnsafe() {
+		return
+	}
+	d.released = true
+	d.releaseReason = reason
+	deferred := d.deferred
+	d.deferred = nil
+	logger.Info("Releasing stops of stop-last tasks", logger.Fields{
+		field.Reason: reason,
+		"tasks":      len(deferred),
+	})
+	for _, stop := range deferred {
+		engine.updateTaskUnsafe(stop.task, stop.update)
+	}
+}
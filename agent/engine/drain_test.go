@@ -0,0 +1,201 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	appFamily       = "web-app"
+	observerFamily  = "log-router"
+	drainTestPrefix = "arn:aws:ecs:us-west-2:123456789012:task/cluster/"
+)
+
+// drainTestEngine is a task engine with running tasks whose ACS transitions are
+// recorded instead of being handled by the managed task goroutines.
+type drainTestEngine struct {
+	*DockerTaskEngine
+	now   time.Time
+	stops []string
+}
+
+func newDrainTestEngine(families map[string]string) *drainTestEngine {
+	te := &drainTestEngine{
+		DockerTaskEngine: &DockerTaskEngine{
+			drain: newDrainCoordinator([]string{observerFamily}),
+		},
+		now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+	te.drain.now = func() time.Time { return te.now }
+	for id, family := range families {
+		task := &apitask.Task{
+			Arn:                 drainTestPrefix + id,
+			Family:              family,
+			KnownStatusUnsafe:   apitaskstatus.TaskRunning,
+			DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		}
+		te.managedTasks.set(task.Arn, &managedTask{
+			Task:        task,
+			ctx:         context.Background(),
+			acsMessages: make(chan acsTransition, 1),
+		})
+	}
+	return te
+}
+
+func (te *drainTestEngine) managedTask(id string) *managedTask {
+	mtask, _ := te.managedTasks.get(drainTestPrefix + id)
+	return mtask
+}
+
+// stop sends a stop for the task like ACS does, and records the transitions that were
+// emitted to the managed tasks.
+func (te *drainTestEngine) stop(id string) {
+	task := te.managedTask(id).Task
+	te.tasksLock.Lock()
+	te.updateTaskUnsafe(task, &apitask.Task{Arn: task.Arn, DesiredStatusUnsafe: apitaskstatus.TaskStopped})
+	te.tasksLock.Unlock()
+	te.collectStops()
+}
+
+// stopped marks the task as stopped and lets the engine release the held back stops.
+func (te *drainTestEngine) stopped(id string) {
+	te.managedTask(id).SetKnownStatus(apitaskstatus.TaskStopped)
+	te.releaseDeferredStops()
+	te.collectStops()
+}
+
+func (te *drainTestEngine) collectStops() {
+	for arn, mtask := range te.managedTasks.load() {
+		select {
+		case transition := <-mtask.acsMessages:
+			if transition.desiredStatus == apitaskstatus.TaskStopped {
+				te.stops = append(te.stops, arn[len(drainTestPrefix):])
+			}
+		default:
+		}
+	}
+}
+
+func mixedFamilies() map[string]string {
+	return map[string]string{
+		"app1":     appFamily,
+		"app2":     appFamily,
+		"observer": observerFamily,
+	}
+}
+
+func TestDrainStopsStopLastTasksAfterOtherTasks(t *testing.T) {
+	te := newDrainTestEngine(mixedFamilies())
+	te.StartDrain(te.now.Add(time.Minute))
+
+	// ECS stops the tasks in any order, the observer's stop is held back
+	te.stop("observer")
+	te.stop("app1")
+	te.stop("app2")
+	assert.Equal(t, []string{"app1", "app2"}, te.stops)
+
+	te.stopped("app1")
+	assert.Equal(t, []string{"app1", "app2"}, te.stops, "app2 is still running")
+	status := te.DrainStatus()
+	assert.False(t, status.StopLastReleased)
+	require.Len(t, status.Tasks, 3)
+	assert.True(t, status.Tasks[2].StopDeferred)
+
+	te.stopped("app2")
+	assert.Equal(t, []string{"app1", "app2", "observer"}, te.stops)
+	status = te.DrainStatus()
+	assert.True(t, status.StopLastReleased)
+	assert.Equal(t, DrainReleasedAllTasksStopped, status.ReleaseReason)
+	assert.False(t, status.Tasks[2].StopDeferred)
+
+	// Once released, stops aren't held back anymore
+	te.stop("observer")
+	assert.Equal(t, []string{"app1", "app2", "observer", "observer"}, te.stops)
+}
+
+func TestDrainDeadlineForcesStopLastTasks(t *testing.T) {
+	te := newDrainTestEngine(mixedFamilies())
+	te.StartDrain(te.now.Add(time.Minute))
+
+	te.stop("observer")
+	te.stop("app1")
+	assert.Equal(t, []string{"app1"}, te.stops)
+
+	te.now = te.now.Add(time.Minute)
+	te.releaseDeferredStops()
+	te.collectStops()
+	assert.Equal(t, []string{"app1", "observer"}, te.stops)
+	assert.Equal(t, DrainReleasedDeadlineReached, te.DrainStatus().ReleaseReason)
+}
+
+func TestStopLastTasksStopImmediatelyWithoutDrain(t *testing.T) {
+	te := newDrainTestEngine(mixedFamilies())
+
+	te.stop("observer")
+	assert.Equal(t, []string{"observer"}, te.stops)
+	assert.False(t, te.DrainStatus().Draining)
+}
+
+func TestStopLastTaskStopsImmediatelyWhenOtherTasksStopped(t *testing.T) {
+	te := newDrainTestEngine(mixedFamilies())
+	te.StartDrain(te.now.Add(time.Minute))
+
+	te.stop("app1")
+	te.stop("app2")
+	te.stopped("app1")
+	te.stopped("app2")
+	te.stop("observer")
+	assert.Equal(t, []string{"app1", "app2", "observer"}, te.stops)
+}
+
+func TestDrainStatusStopOrdering(t *testing.T) {
+	te := newDrainTestEngine(map[string]string{
+		"b-observer": observerFamily,
+		"c-app":      appFamily,
+		"a-app":      appFamily,
+		"a-observer": observerFamily,
+	})
+	start := te.now
+	te.StartDrain(start.Add(time.Minute))
+	te.stop("a-observer")
+
+	status := te.DrainStatus()
+	assert.True(t, status.Draining)
+	assert.Equal(t, start, *status.StartedAt)
+	assert.Equal(t, start.Add(time.Minute), *status.Deadline)
+	assert.Equal(t, []string{observerFamily}, status.StopLastFamilies)
+	var order []string
+	for _, task := range status.Tasks {
+		order = append(order, task.Arn[len(drainTestPrefix):])
+	}
+	assert.Equal(t, []string{"a-app", "c-app", "a-observer", "b-observer"}, order)
+	assert.Equal(t, DrainStopPhaseRegular, status.Tasks[0].StopPhase)
+	assert.Equal(t, DrainStopPhaseStopLast, status.Tasks[2].StopPhase)
+	assert.True(t, status.Tasks[2].StopDeferred)
+	assert.False(t, status.Tasks[3].StopDeferred)
+	assert.Equal(t, "RUNNING", status.Tasks[2].KnownStatus)
+}
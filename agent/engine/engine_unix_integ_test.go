@@ -1249,7 +1249,7 @@ func TestHostResourceManagerResourceUtilization(t *testing.T) {
 		time.Sleep(2 * time.Second)
 
 		// single managedTask which should have started
-		assert.Equal(t, 1, len(taskEngine.(*DockerTaskEngine).managedTasks), "exactly one task should be running")
+		assert.Equal(t, 1, taskEngine.(*DockerTaskEngine).managedTasks.len(), "exactly one task should be running")
 
 		// stopTask
 		taskEngine.AddTask(stopTask)
@@ -1330,7 +1330,7 @@ func TestHostResourceManagerStopTaskNotBlockWaitingTasks(t *testing.T) {
 		time.Sleep(2 * time.Second)
 
 		// single managedTask which should have started
-		assert.Equal(t, 1, len(taskEngine.(*DockerTaskEngine).managedTasks), "exactly one task should be running")
+		assert.Equal(t, 1, taskEngine.(*DockerTaskEngine).managedTasks.len(), "exactly one task should be running")
 
 		// stopTask[0] - stop running task[0], this task will go to STOPPING due to trap handler defined and STOPPED after 6s
 		taskEngine.AddTask(stopTasks[0])
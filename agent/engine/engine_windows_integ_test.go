@@ -549,7 +549,7 @@ func setupGMSA(cfg *config.Config, state dockerstate.TaskEngineState, t *testing
 
 	resourceFields := &taskresource.ResourceFields{
 		ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
-			SSMClientCreator: ssmfactory.NewSSMClientCreator(),
+			SSMClientCreator: ssmfactory.NewSSMClientCreator(nil),
 			S3ClientCreator:  s3factory.NewS3ClientCreator(),
 		},
 		DockerClient: dockerClient,
@@ -0,0 +1,58 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+// SetGPURuntimeStatusReporter sets the reporter of the GPU runtime status. New GPU tasks
+// are stopped without being started while the GPU runtime is unavailable.
+func (engine *DockerTaskEngine) SetGPURuntimeStatusReporter(gpuRuntime gpu.RuntimeStatusReporter) {
+	engine.gpuRuntime = gpuRuntime
+}
+
+// gpuRuntimeUnavailableReason returns why a new GPU task can't be started, or an empty
+// string if it can. Tasks that the engine already manages are never rejected, so that
+// they can still be stopped.
+func (engine *DockerTaskEngine) gpuRuntimeUnavailableReason(task *apitask.Task) string {
+	if engine.gpuRuntime == nil || !task.IsGPUEnabled() {
+		return ""
+	}
+	status, ok := engine.gpuRuntime.RuntimeStatus()
+	if !ok || status.Available {
+		return ""
+	}
+	if _, exists := engine.state.TaskByArn(task.Arn); exists {
+		return ""
+	}
+	return status.Reason
+}
+
+// rejectGPUTask stops a GPU task without creating its containers, so that it fails with
+// the reason the GPU runtime is unavailable rather than with a container runtime error.
+func (engine *DockerTaskEngine) rejectGPUTask(task *apitask.Task, reason string) {
+	logger.Error("Stopping GPU task without starting it as the GPU runtime is unavailable", logger.Fields{
+		field.TaskID: task.GetID(),
+		field.Reason: reason,
+	})
+	task.SetKnownStatus(apitaskstatus.TaskStopped)
+	task.SetDesiredStatus(apitaskstatus.TaskStopped)
+	task.SetTerminalReason(reason)
+	engine.emitTaskEvent(task, reason)
+}
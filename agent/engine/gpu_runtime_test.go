@@ -0,0 +1,111 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
+	mock_gpu "github.com/aws/amazon-ecs-agent/agent/gpu/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gpuRuntimeTestReason = "GPU runtime unavailable: driver 535.104.05 vs toolkit requires >= 545"
+
+func gpuTask(arn string) *apitask.Task {
+	return &apitask.Task{
+		Arn:                 arn,
+		Family:              "gpu",
+		Version:             "1",
+		Containers:          []*apicontainer.Container{{Name: "cuda", Image: "cuda"}},
+		Associations:        []apitask.Association{{Containers: []string{"cuda"}, Name: "0", Type: apitask.GPUAssociationType}},
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+	}
+}
+
+// flappingGPURuntime returns a monitor of a GPU runtime that is unavailable, then available,
+// then unavailable again.
+func flappingGPURuntime(t *testing.T) *gpu.RuntimeMonitor {
+	ctrl := gomock.NewController(t)
+	prober := mock_gpu.NewMockRuntimeProber(ctrl)
+	gomock.InOrder(
+		prober.EXPECT().Probe(gomock.Any()).Return(gpu.RuntimeInfo{DriverVersion: "535.104.05", DeviceCount: 1}, nil),
+		prober.EXPECT().Probe(gomock.Any()).Return(gpu.RuntimeInfo{DriverVersion: "545.23.08", DeviceCount: 1}, nil),
+		prober.EXPECT().Probe(gomock.Any()).Return(gpu.RuntimeInfo{}, errors.New("nvidia-smi failed")),
+	)
+	return gpu.NewRuntimeMonitor(prober, "545")
+}
+
+func TestGPURuntimeUnavailableReason(t *testing.T) {
+	engine := &DockerTaskEngine{state: dockerstate.NewTaskEngineState()}
+	task := gpuTask("arn:aws:ecs:us-west-2:123456789012:task/cluster/gpu")
+	nonGPUTask := gpuTask("arn:aws:ecs:us-west-2:123456789012:task/cluster/cpu")
+	nonGPUTask.Associations = nil
+
+	// GPU tasks are accepted if the GPU runtime is not monitored or not probed yet
+	assert.Empty(t, engine.gpuRuntimeUnavailableReason(task))
+	gpuRuntime := flappingGPURuntime(t)
+	engine.SetGPURuntimeStatusReporter(gpuRuntime)
+	assert.Empty(t, engine.gpuRuntimeUnavailableReason(task))
+
+	gpuRuntime.Probe(context.TODO())
+	assert.Equal(t, gpuRuntimeTestReason, engine.gpuRuntimeUnavailableReason(task))
+	assert.Empty(t, engine.gpuRuntimeUnavailableReason(nonGPUTask))
+
+	gpuRuntime.Probe(context.TODO())
+	assert.Empty(t, engine.gpuRuntimeUnavailableReason(task))
+
+	gpuRuntime.Probe(context.TODO())
+	assert.Equal(t, "GPU runtime unavailable: nvidia-smi failed", engine.gpuRuntimeUnavailableReason(task))
+
+	// Tasks that are already managed are not rejected, so that they can be stopped
+	engine.state.AddTask(task)
+	assert.Empty(t, engine.gpuRuntimeUnavailableReason(task))
+}
+
+func TestAddTaskRejectsGPUTaskWhileGPURuntimeUnavailable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	cfg := defaultConfig
+	cfg.GPUSupportEnabled = true
+	ctrl, _, _, taskEngine, _, _, _, _ := mocks(t, ctx, &cfg)
+	defer ctrl.Finish()
+	gpuRuntime := flappingGPURuntime(t)
+	gpuRuntime.Probe(context.TODO())
+	taskEngine.(*DockerTaskEngine).SetGPURuntimeStatusReporter(gpuRuntime)
+
+	// The task is stopped without any docker call
+	task := gpuTask("arn:aws:ecs:us-west-2:123456789012:task/cluster/gpu")
+	go taskEngine.AddTask(task)
+	event := <-taskEngine.StateChangeEvents()
+	taskEvent, ok := event.(api.TaskStateChange)
+	require.True(t, ok)
+	assert.Equal(t, apitaskstatus.TaskStopped, taskEvent.Status)
+	assert.Equal(t, gpuRuntimeTestReason, taskEvent.Reason)
+	assert.Equal(t, gpuRuntimeTestReason, task.GetTerminalReason())
+	_, managed := taskEngine.(*DockerTaskEngine).state.TaskByArn(task.Arn)
+	assert.False(t, managed)
+}
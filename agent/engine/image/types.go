@@ -50,7 +50,10 @@ type ImageState struct {
 	// PullSucceeded defines whether this image has been pulled successfully before,
 	// this should be set to true when one of the pull image call succeeds.
 	PullSucceeded bool
-	lock          sync.RWMutex
+	// PrefetchedAt is the time when this image was last pulled because it's in the prefetch
+	// list, if it ever was.
+	PrefetchedAt time.Time
+	lock         sync.RWMutex
 }
 
 // UpdateContainerReference updates container reference in image state
@@ -164,6 +167,22 @@ func (imageState *ImageState) GetPullSucceeded() bool {
 	return imageState.PullSucceeded
 }
 
+// SetPrefetchedAt sets the time when the image was prefetched
+func (imageState *ImageState) SetPrefetchedAt(prefetchedAt time.Time) {
+	imageState.lock.Lock()
+	defer imageState.lock.Unlock()
+
+	imageState.PrefetchedAt = prefetchedAt
+}
+
+// GetPrefetchedAt safely returns the time when the image was prefetched
+func (imageState *ImageState) GetPrefetchedAt() time.Time {
+	imageState.lock.RLock()
+	defer imageState.lock.RUnlock()
+
+	return imageState.PrefetchedAt
+}
+
 // MarshalJSON marshals image state
 func (imageState *ImageState) MarshalJSON() ([]byte, error) {
 	imageState.lock.Lock()
@@ -174,11 +193,13 @@ func (imageState *ImageState) MarshalJSON() ([]byte, error) {
 		PulledAt      time.Time
 		LastUsedAt    time.Time
 		PullSucceeded bool
+		PrefetchedAt  time.Time
 	}{
 		Image:         imageState.Image,
 		PulledAt:      imageState.PulledAt,
 		LastUsedAt:    imageState.LastUsedAt,
 		PullSucceeded: imageState.PullSucceeded,
+		PrefetchedAt:  imageState.PrefetchedAt,
 	})
 }
 
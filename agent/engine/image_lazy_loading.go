@@ -0,0 +1,90 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"sync/atomic"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const imageLazyPullFallbackMetricName = "IMAGE_LAZY_PULL_FALLBACK"
+
+// SetImageLazyLoading makes the engine detect, from the manifests of the images it pulls,
+// whether they have a companion that the snapshotter of the daemon can lazily load them
+// with, and record how each container image was pulled.
+func (engine *DockerTaskEngine) SetImageLazyLoading(snapshotter string, inspector dockerapi.ImageManifestInspector) {
+	engine.lazyLoadingSnapshotter = snapshotter
+	engine.manifestInspector = inspector
+}
+
+// pullImage pulls the image of the container and records how it was pulled. If the image
+// can be lazily loaded and the pull fails, the image is pulled again so that the
+// snapshotter fetches it in full, and the fallback is counted.
+func (engine *DockerTaskEngine) pullImage(task *apitask.Task, container *apicontainer.Container) dockerapi.DockerContainerMetadata {
+	mechanism := apicontainer.ImagePullMechanismFull
+	if engine.imageLazyLoadable(task, container) {
+		mechanism = apicontainer.ImagePullMechanismLazy
+	}
+	metadata := engine.client.PullImage(engine.ctx, container.Image, container.RegistryAuthentication, engine.cfg.ImagePullTimeout)
+	if metadata.Error != nil && mechanism == apicontainer.ImagePullMechanismLazy {
+		fallbacks := atomic.AddUint64(&engine.lazyPullFallbacks, 1)
+		metrics.MetricsEngineGlobal.RecordTaskEngineMetric(imageLazyPullFallbackMetricName)()
+		logger.Warn("Lazy loading pull of image failed, falling back to a full pull", logger.Fields{
+			field.TaskID:    task.GetID(),
+			field.Container: container.Name,
+			field.Image:     container.Image,
+			field.Error:     metadata.Error,
+			"fallbacks":     fallbacks,
+		})
+		mechanism = apicontainer.ImagePullMechanismFallback
+		metadata = engine.client.PullImage(engine.ctx, container.Image, container.RegistryAuthentication, engine.cfg.ImagePullTimeout)
+	}
+	container.SetImagePullMechanism(mechanism)
+	return metadata
+}
+
+// imageLazyLoadable returns whether the image of the container has a companion that the
+// snapshotter can lazily load it with. Images whose manifests can't be inspected are
+// pulled in full.
+func (engine *DockerTaskEngine) imageLazyLoadable(task *apitask.Task, container *apicontainer.Container) bool {
+	if engine.lazyLoadingSnapshotter == "" || engine.manifestInspector == nil {
+		return false
+	}
+	snapshotter, lazyLoadable, err := engine.detectLazyLoadingSnapshotter(container)
+	if err != nil {
+		logger.Warn("Unable to inspect the manifests of image, pulling it in full", logger.Fields{
+			field.TaskID:    task.GetID(),
+			field.Container: container.Name,
+			field.Image:     container.Image,
+			field.Error:     err,
+		})
+		return false
+	}
+	return lazyLoadable && snapshotter == engine.lazyLoadingSnapshotter
+}
+
+func (engine *DockerTaskEngine) detectLazyLoadingSnapshotter(container *apicontainer.Container) (string, bool, error) {
+	manifests, err := engine.manifestInspector.InspectImageManifests(engine.ctx, container.Image,
+		container.RegistryAuthentication)
+	if err != nil {
+		return "", false, err
+	}
+	return dockerapi.DetectLazyLoadingSnapshotter(manifests...)
+}
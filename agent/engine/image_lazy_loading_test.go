@@ -0,0 +1,144 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	mock_dockerapi "github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureManifestInspector returns the manifest fixtures of the docker client tests.
+type fixtureManifestInspector struct {
+	fixtures []string
+	err      error
+}
+
+func (i fixtureManifestInspector) InspectImageManifests(ctx context.Context, image string,
+	authData *apicontainer.RegistryAuthenticationData) ([][]byte, error) {
+	if i.err != nil {
+		return nil, i.err
+	}
+	var manifests [][]byte
+	for _, fixture := range i.fixtures {
+		manifest, err := os.ReadFile(filepath.Join("..", "dockerclient", "dockerapi", "testdata", "manifests", fixture))
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+func TestPullImageLazyLoading(t *testing.T) {
+	pullError := dockerapi.DockerContainerMetadata{Error: dockerapi.CannotPullContainerError{
+		FromError: errors.New("failed to resolve lazy layer"),
+	}}
+	testCases := []struct {
+		name               string
+		snapshotter        string
+		inspector          dockerapi.ImageManifestInspector
+		pullResults        []dockerapi.DockerContainerMetadata
+		expectedMechanism  string
+		expectedFallbacks  uint64
+		expectedPullFailed bool
+	}{
+		{
+			name:              "lazy loading disabled",
+			pullResults:       []dockerapi.DockerContainerMetadata{{}},
+			expectedMechanism: apicontainer.ImagePullMechanismFull,
+		},
+		{
+			name:              "lazy pull",
+			snapshotter:       dockerapi.SOCISnapshotter,
+			inspector:         fixtureManifestInspector{fixtures: []string{"soci_index.json"}},
+			pullResults:       []dockerapi.DockerContainerMetadata{{}},
+			expectedMechanism: apicontainer.ImagePullMechanismLazy,
+		},
+		{
+			name:              "failed lazy pull falls back to a full pull",
+			snapshotter:       dockerapi.StargzSnapshotter,
+			inspector:         fixtureManifestInspector{fixtures: []string{"docker_manifest_list.json", "estargz_manifest.json"}},
+			pullResults:       []dockerapi.DockerContainerMetadata{pullError, {}},
+			expectedMechanism: apicontainer.ImagePullMechanismFallback,
+			expectedFallbacks: 1,
+		},
+		{
+			name:               "failed fallback pull",
+			snapshotter:        dockerapi.SOCISnapshotter,
+			inspector:          fixtureManifestInspector{fixtures: []string{"soci_manifest.json"}},
+			pullResults:        []dockerapi.DockerContainerMetadata{pullError, pullError},
+			expectedMechanism:  apicontainer.ImagePullMechanismFallback,
+			expectedFallbacks:  1,
+			expectedPullFailed: true,
+		},
+		{
+			name:               "failed full pull without companion isn't retried",
+			snapshotter:        dockerapi.SOCISnapshotter,
+			inspector:          fixtureManifestInspector{fixtures: []string{"docker_manifest_list.json", "docker_manifest.json"}},
+			pullResults:        []dockerapi.DockerContainerMetadata{pullError},
+			expectedMechanism:  apicontainer.ImagePullMechanismFull,
+			expectedPullFailed: true,
+		},
+		{
+			name:              "companion of another snapshotter",
+			snapshotter:       dockerapi.StargzSnapshotter,
+			inspector:         fixtureManifestInspector{fixtures: []string{"soci_index.json"}},
+			pullResults:       []dockerapi.DockerContainerMetadata{{}},
+			expectedMechanism: apicontainer.ImagePullMechanismFull,
+		},
+		{
+			name:              "manifests can't be inspected",
+			snapshotter:       dockerapi.SOCISnapshotter,
+			inspector:         fixtureManifestInspector{err: errors.New("registry unavailable")},
+			pullResults:       []dockerapi.DockerContainerMetadata{{}},
+			expectedMechanism: apicontainer.ImagePullMechanismFull,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := mock_dockerapi.NewMockDockerClient(ctrl)
+			cfg := defaultConfig
+			engine := &DockerTaskEngine{client: client, cfg: &cfg, ctx: context.TODO()}
+			engine.SetImageLazyLoading(tc.snapshotter, tc.inspector)
+
+			var pulls []*gomock.Call
+			for _, result := range tc.pullResults {
+				pulls = append(pulls, client.EXPECT().PullImage(gomock.Any(), "app:latest", nil, gomock.Any()).Return(result))
+			}
+			gomock.InOrder(pulls...)
+
+			task := &apitask.Task{Arn: "arn:aws:ecs:us-west-2:123456789012:task/cluster/id"}
+			container := &apicontainer.Container{Name: "app", Image: "app:latest"}
+			metadata := engine.pullImage(task, container)
+			assert.Equal(t, tc.expectedPullFailed, metadata.Error != nil)
+			assert.Equal(t, tc.expectedMechanism, container.GetImagePullMechanism())
+			assert.Equal(t, tc.expectedFallbacks, engine.lazyPullFallbacks)
+		})
+	}
+}
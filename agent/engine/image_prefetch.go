@@ -0,0 +1,294 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const (
+	// ImagePrefetchPending is the status of images that are waiting to be prefetched.
+	ImagePrefetchPending = "PENDING"
+	// ImagePrefetchPulling is the status of images that are being pulled.
+	ImagePrefetchPulling = "PULLING"
+	// ImagePrefetchPreempted is the status of images whose pull was cancelled for a task
+	// pull. They are pulled again once the task pulls are done.
+	ImagePrefetchPreempted = "PREEMPTED"
+	// ImagePrefetchSucceeded is the status of images that were prefetched.
+	ImagePrefetchSucceeded = "SUCCEEDED"
+	// ImagePrefetchFailed is the status of images that couldn't be prefetched.
+	ImagePrefetchFailed = "FAILED"
+)
+
+// imagePullPriority holds back prefetch pulls while task pulls are in flight, and preempts
+// the prefetch pulls that are in flight when a task pull starts.
+var imagePullPriority = newPullPriorityGate()
+
+// ImagePrefetchStatus is the status of an image of the prefetch list.
+type ImagePrefetchStatus struct {
+	Image  string `json:"Image"`
+	Status string `json:"Status"`
+	// Attempts is the number of times the pull of the image was started, and Preemptions
+	// the number of those pulls that were cancelled for task pulls
+	Attempts    int        `json:"Attempts"`
+	Preemptions int        `json:"Preemptions"`
+	Error       string     `json:"Error,omitempty"`
+	StartedAt   *time.Time `json:"StartedAt,omitempty"`
+	FinishedAt  *time.Time `json:"FinishedAt,omitempty"`
+}
+
+// ImagePrefetchStatusReporter reports the status of the images of the prefetch list.
+type ImagePrefetchStatusReporter interface {
+	ImagePrefetchStatus() []ImagePrefetchStatus
+}
+
+// ImagePrefetcher pulls the images of the prefetch list when the agent starts, so that they
+// are cached by the time tasks need them. Prefetch pulls have a lower priority than task
+// pulls: they wait for task pulls to finish before starting, and are cancelled and retried
+// later if a task pull starts while they're in flight.
+type ImagePrefetcher struct {
+	images       []config.ImagePrefetch
+	concurrency  int
+	pullTimeout  time.Duration
+	client       dockerapi.DockerClient
+	imageManager ImageManager
+	priority     *pullPriorityGate
+
+	lock     sync.RWMutex
+	statuses []*ImagePrefetchStatus
+}
+
+// NewImagePrefetcher creates a prefetcher for the prefetch list of the config.
+func NewImagePrefetcher(cfg *config.Config, client dockerapi.DockerClient, imageManager ImageManager) *ImagePrefetcher {
+	p := &ImagePrefetcher{
+		images:       cfg.ImagePrefetchList,
+		concurrency:  cfg.ImagePrefetchConcurrency,
+		pullTimeout:  cfg.ImagePullTimeout,
+		client:       client,
+		imageManager: imageManager,
+		priority:     imagePullPriority,
+	}
+	for _, prefetch := range p.images {
+		p.statuses = append(p.statuses, &ImagePrefetchStatus{Image: prefetch.Image, Status: ImagePrefetchPending})
+	}
+	return p
+}
+
+// Start pulls the images of the prefetch list, and returns once they're all pulled or
+// failed to pull, or the context is cancelled.
+func (p *ImagePrefetcher) Start(ctx context.Context) {
+	if len(p.images) == 0 {
+		return
+	}
+	concurrency := p.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	logger.Info("Prefetching images", logger.Fields{
+		"images":      len(p.images),
+		"concurrency": concurrency,
+	})
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range queue {
+				p.prefetch(ctx, index)
+			}
+		}()
+	}
+	for index := range p.images {
+		select {
+		case queue <- index:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// ImagePrefetchStatus returns the status of the images of the prefetch list, in the
+// order of the list.
+func (p *ImagePrefetcher) ImagePrefetchStatus() []ImagePrefetchStatus {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	statuses := make([]ImagePrefetchStatus, 0, len(p.statuses))
+	for _, status := range p.statuses {
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+// prefetch pulls the image until the pull isn't preempted by a task pull.
+func (p *ImagePrefetcher) prefetch(ctx context.Context, index int) {
+	prefetch := p.images[index]
+	for {
+		pullCtx, done, err := p.priority.startPrefetch(ctx)
+		if err != nil {
+			return
+		}
+		p.updateStatus(index, func(status *ImagePrefetchStatus) {
+			now := time.Now()
+			status.Status = ImagePrefetchPulling
+			status.Attempts++
+			status.StartedAt = &now
+		})
+		metadata := p.pull(pullCtx, prefetch)
+		preempted := pullCtx.Err() != nil && ctx.Err() == nil
+		done()
+
+		if preempted {
+			logger.Info("Image prefetch preempted by a task pull, retrying once task pulls are done", logger.Fields{
+				field.Image: prefetch.Image,
+			})
+			p.updateStatus(index, func(status *ImagePrefetchStatus) {
+				status.Status = ImagePrefetchPreempted
+				status.Preemptions++
+			})
+			continue
+		}
+
+		err = metadata.Error
+		if err == nil {
+			err = p.imageManager.RecordPrefetchedImage(prefetch.Image)
+		}
+		p.updateStatus(index, func(status *ImagePrefetchStatus) {
+			now := time.Now()
+			status.FinishedAt = &now
+			if err != nil {
+				status.Status = ImagePrefetchFailed
+				status.Error = err.Error()
+				return
+			}
+			status.Status = ImagePrefetchSucceeded
+			status.Error = ""
+		})
+		if err != nil {
+			logger.Warn("Unable to prefetch image", logger.Fields{
+				field.Image: prefetch.Image,
+				field.Error: err,
+			})
+			return
+		}
+		logger.Info("Prefetched image", logger.Fields{
+			field.Image: prefetch.Image,
+		})
+		return
+	}
+}
+
+func (p *ImagePrefetcher) pull(ctx context.Context, prefetch config.ImagePrefetch) dockerapi.DockerContainerMetadata {
+	ImagePullDeleteLock.RLock()
+	defer ImagePullDeleteLock.RUnlock()
+
+	var auth *apicontainer.RegistryAuthenticationData
+	if prefetch.ECRRegion != "" {
+		auth = &apicontainer.RegistryAuthenticationData{
+			Type: apicontainer.AuthTypeECR,
+			ECRAuthData: &apicontainer.ECRAuthData{
+				Region:     prefetch.ECRRegion,
+				RegistryID: prefetch.ECRRegistryID,
+			},
+		}
+	}
+	return p.client.PullImage(ctx, prefetch.Image, auth, p.pullTimeout)
+}
+
+func (p *ImagePrefetcher) updateStatus(index int, update func(*ImagePrefetchStatus)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	update(p.statuses[index])
+}
+
+// pullPriorityGate gives task pulls priority over prefetch pulls.
+type pullPriorityGate struct {
+	lock      sync.Mutex
+	taskPulls int
+	// idle is closed when there are no task pulls in flight
+	idle       chan struct{}
+	prefetches map[int]context.CancelFunc
+	nextID     int
+}
+
+func newPullPriorityGate() *pullPriorityGate {
+	idle := make(chan struct{})
+	close(idle)
+	return &pullPriorityGate{
+		idle:       idle,
+		prefetches: make(map[int]context.CancelFunc),
+	}
+}
+
+// taskPullStarted preempts the prefetch pulls in flight, and holds back prefetch pulls
+// until taskPullFinished is called.
+func (g *pullPriorityGate) taskPullStarted() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.taskPulls == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.taskPulls++
+	for _, cancel := range g.prefetches {
+		cancel()
+	}
+}
+
+func (g *pullPriorityGate) taskPullFinished() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.taskPulls--
+	if g.taskPulls == 0 {
+		close(g.idle)
+	}
+}
+
+// startPrefetch waits until there are no task pulls in flight, and returns the context to
+// pull with, which is cancelled if a task pull starts, and the func to call once the pull
+// is done. An error is returned if ctx is done first.
+func (g *pullPriorityGate) startPrefetch(ctx context.Context) (context.Context, func(), error) {
+	for {
+		g.lock.Lock()
+		if g.taskPulls == 0 {
+			pullCtx, cancel := context.WithCancel(ctx)
+			id := g.nextID
+			g.nextID++
+			g.prefetches[id] = cancel
+			g.lock.Unlock()
+			return pullCtx, func() {
+				g.lock.Lock()
+				delete(g.prefetches, id)
+				g.lock.Unlock()
+				cancel()
+			}, nil
+		}
+		idle := g.idle
+		g.lock.Unlock()
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
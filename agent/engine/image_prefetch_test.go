@@ -0,0 +1,166 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	mock_dockerapi "github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/engine/image"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	prefetchTestImage = "prefetch-image"
+	taskTestImage     = "task-image"
+)
+
+func waitForPrefetchStatus(t *testing.T, prefetcher *ImagePrefetcher, status string) ImagePrefetchStatus {
+	var current ImagePrefetchStatus
+	require.Eventually(t, func() bool {
+		current = prefetcher.ImagePrefetchStatus()[0]
+		return current.Status == status
+	}, 5*time.Second, time.Millisecond, "image prefetch status never became %s", status)
+	return current
+}
+
+func TestImagePrefetchPreemptedByTaskPull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	cfg := defaultConfig
+	cfg.ImagePrefetchList = []config.ImagePrefetch{{Image: prefetchTestImage}}
+	cfg.ImagePrefetchConcurrency = 1
+	ctrl, client, _, privateTaskEngine, _, imageManager, _, _ := mocks(t, ctx, &cfg)
+	defer ctrl.Finish()
+	taskEngine := privateTaskEngine.(*DockerTaskEngine)
+	taskEngine._time = nil
+
+	prefetchStarted := make(chan struct{})
+	taskPullStarted := make(chan struct{})
+	releaseTaskPull := make(chan struct{})
+	gomock.InOrder(
+		// The first prefetch pull is in flight until it's cancelled by the task pull
+		client.EXPECT().PullImage(gomock.Any(), prefetchTestImage, nil, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, image string, auth *apicontainer.RegistryAuthenticationData,
+				timeout time.Duration) dockerapi.DockerContainerMetadata {
+				close(prefetchStarted)
+				<-ctx.Done()
+				return dockerapi.DockerContainerMetadata{Error: dockerapi.CannotPullContainerError{FromError: ctx.Err()}}
+			}),
+		client.EXPECT().PullImage(gomock.Any(), taskTestImage, nil, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, image string, auth *apicontainer.RegistryAuthenticationData,
+				timeout time.Duration) dockerapi.DockerContainerMetadata {
+				close(taskPullStarted)
+				<-releaseTaskPull
+				return dockerapi.DockerContainerMetadata{}
+			}),
+		// The prefetch pull is retried once the task pull is done
+		client.EXPECT().PullImage(gomock.Any(), prefetchTestImage, nil, gomock.Any()).
+			Return(dockerapi.DockerContainerMetadata{}),
+	)
+	imageManager.EXPECT().RecordContainerReference(gomock.Any())
+	imageManager.EXPECT().GetImageStateFromImageName(taskTestImage).Return(&image.ImageState{
+		Image: &image.Image{ImageID: "id"},
+	}, false)
+	imageManager.EXPECT().RecordPrefetchedImage(prefetchTestImage)
+
+	prefetcher := NewImagePrefetcher(&cfg, client, imageManager)
+	assert.Equal(t, ImagePrefetchPending, prefetcher.ImagePrefetchStatus()[0].Status)
+	prefetched := make(chan struct{})
+	go func() {
+		prefetcher.Start(ctx)
+		close(prefetched)
+	}()
+	<-prefetchStarted
+	assert.Equal(t, ImagePrefetchPulling, prefetcher.ImagePrefetchStatus()[0].Status)
+
+	container := &apicontainer.Container{Name: "app", Image: taskTestImage, Essential: true}
+	task := &apitask.Task{Arn: "taskArn", Containers: []*apicontainer.Container{container}}
+	taskPulled := make(chan dockerapi.DockerContainerMetadata)
+	go func() {
+		taskPulled <- taskEngine.concurrentPull(task, container)
+	}()
+	<-taskPullStarted
+
+	status := waitForPrefetchStatus(t, prefetcher, ImagePrefetchPreempted)
+	assert.Equal(t, 1, status.Attempts)
+	assert.Equal(t, 1, status.Preemptions)
+	// The prefetch pull isn't retried while the task pull is in flight
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, status, prefetcher.ImagePrefetchStatus()[0])
+
+	close(releaseTaskPull)
+	assert.NoError(t, (<-taskPulled).Error)
+	<-prefetched
+	status = prefetcher.ImagePrefetchStatus()[0]
+	assert.Equal(t, ImagePrefetchSucceeded, status.Status)
+	assert.Equal(t, 2, status.Attempts)
+	assert.Equal(t, 1, status.Preemptions)
+	assert.Empty(t, status.Error)
+	assert.NotNil(t, status.FinishedAt)
+}
+
+func TestImagePrefetchFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	cfg := defaultConfig
+	cfg.ImagePrefetchList = []config.ImagePrefetch{
+		{Image: "missing"},
+		{Image: "private", ECRRegion: "us-west-2", ECRRegistryID: "123456789012"},
+	}
+	client := mock_dockerapi.NewMockDockerClient(ctrl)
+	imageManager := mock_engine.NewMockImageManager(ctrl)
+
+	client.EXPECT().PullImage(gomock.Any(), "missing", nil, gomock.Any()).Return(dockerapi.DockerContainerMetadata{
+		Error: dockerapi.CannotPullContainerError{FromError: errors.New("manifest unknown")},
+	})
+	client.EXPECT().PullImage(gomock.Any(), "private", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, image string, auth *apicontainer.RegistryAuthenticationData,
+			timeout time.Duration) dockerapi.DockerContainerMetadata {
+			require.NotNil(t, auth)
+			assert.Equal(t, apicontainer.AuthTypeECR, auth.Type)
+			assert.Equal(t, "us-west-2", auth.ECRAuthData.Region)
+			assert.Equal(t, "123456789012", auth.ECRAuthData.RegistryID)
+			return dockerapi.DockerContainerMetadata{}
+		})
+	imageManager.EXPECT().RecordPrefetchedImage("private").Return(errors.New("no such image"))
+
+	prefetcher := NewImagePrefetcher(&cfg, client, imageManager)
+	prefetcher.Start(ctx)
+	statuses := prefetcher.ImagePrefetchStatus()
+	require.Len(t, statuses, 2)
+	for _, status := range statuses {
+		assert.Equal(t, ImagePrefetchFailed, status.Status, status.Image)
+		assert.Equal(t, 1, status.Attempts, status.Image)
+		assert.Equal(t, 0, status.Preemptions, status.Image)
+	}
+	assert.Contains(t, statuses[0].Error, "manifest unknown")
+	assert.Equal(t, "no such image", statuses[1].Error)
+}
@@ -0,0 +1,364 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/aws/aws-sdk-go/aws"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// localTaskAccountID is the account of the ARNs of local tasks and of their stub
+	// credentials.
+	localTaskAccountID = "000000000000"
+	// localTaskVersion is the task definition revision of local tasks.
+	localTaskVersion = "1"
+	// localTaskCredentialsLifetime is how long the stub credentials of local tasks are valid.
+	localTaskCredentialsLifetime = 12 * time.Hour
+)
+
+// ErrLocalTaskNotFound is returned when stopping a task that wasn't launched locally, or
+// that was already stopped.
+var ErrLocalTaskNotFound = errors.New("local task not found")
+
+// LocalTaskValidationError is returned when a local task can't be launched from the task
+// definition and overrides.
+type LocalTaskValidationError struct {
+	Problems []string
+}
+
+func (e *LocalTaskValidationError) Error() string {
+	return "invalid local task: " + strings.Join(e.Problems, "; ")
+}
+
+// LocalTaskLaunchRequest is the task definition of a local task and its overrides. Field
+// names are matched case-insensitively, so ECS task definitions can be used as they are.
+type LocalTaskLaunchRequest struct {
+	TaskDefinition LocalTaskDefinition `json:"TaskDefinition"`
+	Overrides      LocalTaskOverrides  `json:"Overrides,omitempty"`
+}
+
+// LocalTaskDefinition is the subset of an ECS task definition that local tasks are launched
+// from. The other fields of the task definition are ignored.
+type LocalTaskDefinition struct {
+	Family               string                     `json:"Family"`
+	NetworkMode          string                     `json:"NetworkMode,omitempty"`
+	ContainerDefinitions []LocalContainerDefinition `json:"ContainerDefinitions"`
+}
+
+// LocalContainerDefinition is the subset of an ECS container definition that the containers
+// of local tasks are created from. Containers are essential unless Essential is false.
+type LocalContainerDefinition struct {
+	Name         string                     `json:"Name"`
+	Image        string                     `json:"Image"`
+	CPU          int64                      `json:"Cpu,omitempty"`
+	Memory       int64                      `json:"Memory,omitempty"`
+	Essential    *bool                      `json:"Essential,omitempty"`
+	Command      []string                   `json:"Command,omitempty"`
+	EntryPoint   []string                   `json:"EntryPoint,omitempty"`
+	Environment  []LocalKeyValuePair        `json:"Environment,omitempty"`
+	PortMappings []LocalPortMapping         `json:"PortMappings,omitempty"`
+	DependsOn    []LocalContainerDependency `json:"DependsOn,omitempty"`
+}
+
+// LocalKeyValuePair is an environment variable of a container.
+type LocalKeyValuePair struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+// LocalPortMapping is a port mapping of a container.
+type LocalPortMapping struct {
+	ContainerPort int64  `json:"ContainerPort"`
+	HostPort      int64  `json:"HostPort,omitempty"`
+	Protocol      string `json:"Protocol,omitempty"`
+}
+
+// LocalContainerDependency is a dependency of a container on another container of the task.
+type LocalContainerDependency struct {
+	ContainerName string `json:"ContainerName"`
+	Condition     string `json:"Condition"`
+}
+
+// LocalTaskOverrides are the overrides of the containers of a local task, like the overrides
+// of RunTask.
+type LocalTaskOverrides struct {
+	ContainerOverrides []LocalContainerOverride `json:"ContainerOverrides,omitempty"`
+}
+
+// LocalContainerOverride replaces the command of a container, and adds to or replaces its
+// environment variables.
+type LocalContainerOverride struct {
+	Name        string              `json:"Name"`
+	Command     []string            `json:"Command,omitempty"`
+	Environment []LocalKeyValuePair `json:"Environment,omitempty"`
+}
+
+// LocalTaskManager launches and stops tasks that don't come from ACS, for development on a
+// single host.
+type LocalTaskManager interface {
+	LaunchLocalTask(request LocalTaskLaunchRequest) (string, error)
+	StopLocalTask(taskARN string) error
+}
+
+// LocalTaskLauncher launches local tasks through the task engine, as if they were sent by
+// ACS, with stub credentials registered in the credentials manager.
+type LocalTaskLauncher struct {
+	taskEngine         TaskEngine
+	credentialsManager credentials.Manager
+	region             string
+	cluster            string
+
+	lock sync.Mutex
+	// tasks are the local tasks that are running, with the credentials id of each
+	tasks map[string]localTask
+}
+
+type localTask struct {
+	acsTask       *ecsacs.Task
+	credentialsID string
+}
+
+// NewLocalTaskLauncher creates a launcher of local tasks.
+func NewLocalTaskLauncher(cfg *config.Config, taskEngine TaskEngine,
+	credentialsManager credentials.Manager) *LocalTaskLauncher {
+	return &LocalTaskLauncher{
+		taskEngine:         taskEngine,
+		credentialsManager: credentialsManager,
+		region:             cfg.AWSRegion,
+		cluster:            cfg.Cluster,
+		tasks:              make(map[string]localTask),
+	}
+}
+
+// LaunchLocalTask validates the request, and adds the task to the task engine. It returns
+// the ARN of the task, which identifies it in the introspection API.
+func (l *LocalTaskLauncher) LaunchLocalTask(request LocalTaskLaunchRequest) (string, error) {
+	taskARN := fmt.Sprintf("arn:aws:ecs:%s:%s:task/%s/%s", l.region, localTaskAccountID, l.cluster,
+		strings.ReplaceAll(uuid.New(), "-", ""))
+	acsTask, err := request.acsTask(taskARN)
+	if err != nil {
+		return "", err
+	}
+
+	taskCredentials := l.stubCredentials(taskARN)
+	if err := l.credentialsManager.SetTaskCredentials(taskCredentials); err != nil {
+		return "", errors.Wrap(err, "unable to register the stub credentials of the local task")
+	}
+	task, err := l.task(acsTask, taskCredentials.IAMRoleCredentials.CredentialsID)
+	if err != nil {
+		l.credentialsManager.RemoveCredentials(taskCredentials.IAMRoleCredentials.CredentialsID)
+		return "", err
+	}
+
+	l.lock.Lock()
+	l.tasks[taskARN] = localTask{acsTask: acsTask, credentialsID: taskCredentials.IAMRoleCredentials.CredentialsID}
+	l.lock.Unlock()
+	logger.Info("Launching local task", logger.Fields{
+		field.TaskARN: taskARN,
+		"family":      aws.StringValue(acsTask.Family),
+		"containers":  len(acsTask.Containers),
+	})
+	l.taskEngine.AddTask(task)
+	return taskARN, nil
+}
+
+// StopLocalTask stops a local task, like ACS stops tasks.
+func (l *LocalTaskLauncher) StopLocalTask(taskARN string) error {
+	l.lock.Lock()
+	launched, ok := l.tasks[taskARN]
+	delete(l.tasks, taskARN)
+	l.lock.Unlock()
+	if !ok {
+		return ErrLocalTaskNotFound
+	}
+
+	acsTask := *launched.acsTask
+	acsTask.DesiredStatus = aws.String(apitaskstatus.TaskStopped.String())
+	task, err := l.task(&acsTask, launched.credentialsID)
+	if err != nil {
+		return err
+	}
+	logger.Info("Stopping local task", logger.Fields{
+		field.TaskARN: taskARN,
+	})
+	l.taskEngine.AddTask(task)
+	return nil
+}
+
+func (l *LocalTaskLauncher) task(acsTask *ecsacs.Task, credentialsID string) (*apitask.Task, error) {
+	task, err := apitask.TaskFromACS(acsTask, &ecsacs.PayloadMessage{})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to construct the local task")
+	}
+	task.SetCredentialsID(credentialsID)
+	task.IsLocal = true
+	return task, nil
+}
+
+// stubCredentials returns credentials that are served to the containers of the task. They
+// aren't valid AWS credentials: local tasks are meant to be pointed at local stand-ins of
+// the AWS services they use.
+func (l *LocalTaskLauncher) stubCredentials(taskARN string) *credentials.TaskIAMRoleCredentials {
+	return &credentials.TaskIAMRoleCredentials{
+		ARN: taskARN,
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID:   uuid.New(),
+			RoleArn:         fmt.Sprintf("arn:aws:iam::%s:role/local-task", localTaskAccountID),
+			AccessKeyID:     "ASIALOCALTASK",
+			SecretAccessKey: "local-task-secret-access-key",
+			SessionToken:    "local-task-session-token",
+			Expiration:      time.Now().Add(localTaskCredentialsLifetime).UTC().Format(time.RFC3339),
+			RoleType:        credentials.ApplicationRoleType,
+		},
+	}
+}
+
+// acsTask validates the request and builds the task that ACS would send for it.
+func (request *LocalTaskLaunchRequest) acsTask(taskARN string) (*ecsacs.Task, error) {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	definition := request.TaskDefinition
+	if definition.Family == "" {
+		addProblem("TaskDefinition.Family is required")
+	}
+	var hostConfig *string
+	switch definition.NetworkMode {
+	case "", apitask.BridgeNetworkMode:
+	case apitask.HostNetworkMode, "none":
+		config, _ := json.Marshal(dockercontainer.HostConfig{
+			NetworkMode: dockercontainer.NetworkMode(definition.NetworkMode),
+		})
+		hostConfig = aws.String(string(config))
+	default:
+		addProblem("TaskDefinition.NetworkMode %q is not supported for local tasks", definition.NetworkMode)
+	}
+	if len(definition.ContainerDefinitions) == 0 {
+		addProblem("TaskDefinition.ContainerDefinitions must have at least one container")
+	}
+
+	acsTask := &ecsacs.Task{
+		Arn:           aws.String(taskARN),
+		DesiredStatus: aws.String(apitaskstatus.TaskRunning.String()),
+		Family:        aws.String(definition.Family),
+		Version:       aws.String(localTaskVersion),
+		NetworkMode:   aws.String(definition.NetworkMode),
+		LaunchType:    aws.String("EC2"),
+	}
+	containers := make(map[string]*ecsacs.Container)
+	for i, definition := range definition.ContainerDefinitions {
+		prefix := fmt.Sprintf("TaskDefinition.ContainerDefinitions[%d]", i)
+		if definition.Name == "" {
+			addProblem("%s.Name is required", prefix)
+			continue
+		}
+		if containers[definition.Name] != nil {
+			addProblem("%s.Name %q is not unique", prefix, definition.Name)
+			continue
+		}
+		if definition.Image == "" {
+			addProblem("%s.Image is required", prefix)
+		}
+		container := &ecsacs.Container{
+			Name:         aws.String(definition.Name),
+			Image:        aws.String(definition.Image),
+			Cpu:          aws.Int64(definition.CPU),
+			Memory:       aws.Int64(definition.Memory),
+			Essential:    aws.Bool(definition.Essential == nil || *definition.Essential),
+			Command:      stringSlice(definition.Command),
+			EntryPoint:   stringSlice(definition.EntryPoint),
+			Environment:  make(map[string]*string),
+			DockerConfig: &ecsacs.DockerConfig{HostConfig: hostConfig},
+		}
+		for _, env := range definition.Environment {
+			container.Environment[env.Name] = aws.String(env.Value)
+		}
+		for j, portMapping := range definition.PortMappings {
+			protocol := strings.ToLower(portMapping.Protocol)
+			switch protocol {
+			case "":
+				protocol = "tcp"
+			case "tcp", "udp":
+			default:
+				addProblem("%s.PortMappings[%d].Protocol must be tcp or udp", prefix, j)
+			}
+			container.PortMappings = append(container.PortMappings, &ecsacs.PortMapping{
+				ContainerPort: aws.Int64(portMapping.ContainerPort),
+				HostPort:      aws.Int64(portMapping.HostPort),
+				Protocol:      aws.String(protocol),
+			})
+		}
+		for _, dependency := range definition.DependsOn {
+			container.DependsOn = append(container.DependsOn, &ecsacs.ContainerDependency{
+				ContainerName: aws.String(dependency.ContainerName),
+				Condition:     aws.String(dependency.Condition),
+			})
+		}
+		containers[definition.Name] = container
+		acsTask.Containers = append(acsTask.Containers, container)
+	}
+	for _, container := range acsTask.Containers {
+		for _, dependency := range container.DependsOn {
+			if containers[aws.StringValue(dependency.ContainerName)] == nil {
+				addProblem("container %q depends on unknown container %q",
+					aws.StringValue(container.Name), aws.StringValue(dependency.ContainerName))
+			}
+		}
+	}
+
+	for i, override := range request.Overrides.ContainerOverrides {
+		container := containers[override.Name]
+		if container == nil {
+			addProblem("Overrides.ContainerOverrides[%d].Name %q is not a container of the task", i, override.Name)
+			continue
+		}
+		if len(override.Command) > 0 {
+			container.Command = stringSlice(override.Command)
+		}
+		for _, env := range override.Environment {
+			container.Environment[env.Name] = aws.String(env.Value)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &LocalTaskValidationError{Problems: problems}
+	}
+	return acsTask, nil
+}
+
+// stringSlice returns nil for an empty slice, so that the defaults of the image are used.
+func stringSlice(values []string) []*string {
+	if len(values) == 0 {
+		return nil
+	}
+	return aws.StringSlice(values)
+}
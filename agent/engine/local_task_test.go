@@ -0,0 +1,178 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// localTaskTestRequest is a task definition and overrides, as they are posted to the
+// introspection API.
+const localTaskTestRequest = `{
+	"taskDefinition": {
+		"family": "local-sleep",
+		"containerDefinitions": [{
+			"name": "sleepy",
+			"image": "busybox:latest",
+			"memory": 128,
+			"command": ["sleep", "3600"],
+			"environment": [{"name": "STAGE", "value": "dev"}, {"name": "DEBUG", "value": "false"}]
+		}]
+	},
+	"overrides": {
+		"containerOverrides": [{
+			"name": "sleepy",
+			"environment": [{"name": "DEBUG", "value": "true"}]
+		}]
+	}
+}`
+
+func TestLocalTaskLauncherRunsTask(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	cfg := defaultConfig
+	cfg.TaskCPUMemLimit.Value = config.ExplicitlyDisabled
+	ctrl, client, mockTime, taskEngine, credentialsManager, imageManager, _, serviceConnectManager := mocks(t, ctx, &cfg)
+	defer ctrl.Finish()
+
+	var taskCredentials credentials.TaskIAMRoleCredentials
+	credentialsManager.EXPECT().SetTaskCredentials(gomock.Any()).DoAndReturn(
+		func(c *credentials.TaskIAMRoleCredentials) error {
+			taskCredentials = *c
+			return nil
+		})
+	credentialsManager.EXPECT().GetTaskCredentials(gomock.Any()).DoAndReturn(
+		func(id string) (credentials.TaskIAMRoleCredentials, bool) {
+			return taskCredentials, id == taskCredentials.IAMRoleCredentials.CredentialsID
+		}).AnyTimes()
+	// The credentials are removed when the stopped task is cleaned up
+	credentialsManager.EXPECT().RemoveCredentials(gomock.Any()).AnyTimes()
+
+	mockTime.EXPECT().Now().Return(time.Now()).AnyTimes()
+	mockTime.EXPECT().After(gomock.Any()).Return(make(chan time.Time)).AnyTimes()
+	serviceConnectManager.EXPECT().GetAppnetContainerTarballDir().AnyTimes()
+	imageManager.EXPECT().AddAllImageStates(gomock.Any()).AnyTimes()
+	imageManager.EXPECT().RecordContainerReference(gomock.Any()).Return(nil)
+	imageManager.EXPECT().GetImageStateFromImageName(gomock.Any()).Return(nil, false).AnyTimes()
+	client.EXPECT().APIVersion().Return(defaultDockerClientAPIVersion, nil).AnyTimes()
+	client.EXPECT().Info(gomock.Any(), gomock.Any()).Return(types.Info{}, nil).AnyTimes()
+	client.EXPECT().DescribeContainer(gomock.Any(), gomock.Any()).AnyTimes()
+
+	eventStream := make(chan dockerapi.DockerContainerChangeEvent)
+	client.EXPECT().ContainerEvents(gomock.Any()).Return(eventStream, nil)
+	var containerConfig *dockercontainer.Config
+	gomock.InOrder(
+		client.EXPECT().PullImage(gomock.Any(), "busybox:latest", nil, gomock.Any()).
+			Return(dockerapi.DockerContainerMetadata{}),
+		client.EXPECT().CreateContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, config *dockercontainer.Config, hostConfig *dockercontainer.HostConfig,
+				name string, timeout time.Duration) dockerapi.DockerContainerMetadata {
+				containerConfig = config
+				go func() { eventStream <- createDockerEvent(apicontainerstatus.ContainerCreated) }()
+				return dockerapi.DockerContainerMetadata{DockerID: containerID}
+			}),
+		client.EXPECT().StartContainer(gomock.Any(), containerID, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, id string, timeout time.Duration) dockerapi.DockerContainerMetadata {
+				go func() { eventStream <- createDockerEvent(apicontainerstatus.ContainerRunning) }()
+				return dockerapi.DockerContainerMetadata{DockerID: containerID}
+			}),
+		// The created and running events are emitted asynchronously, and can be handled after
+		// the container stopped, which stops the container again
+		client.EXPECT().StopContainer(gomock.Any(), containerID, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, id string, timeout time.Duration) dockerapi.DockerContainerMetadata {
+				go func() {
+					eventStream <- dockerapi.DockerContainerChangeEvent{
+						Status: apicontainerstatus.ContainerStopped,
+						DockerContainerMetadata: dockerapi.DockerContainerMetadata{
+							DockerID: containerID,
+							ExitCode: aws.Int(137),
+						},
+					}
+				}()
+				return dockerapi.DockerContainerMetadata{DockerID: containerID}
+			}).MinTimes(1),
+	)
+
+	require.NoError(t, taskEngine.Init(ctx))
+	launcher := NewLocalTaskLauncher(&cfg, taskEngine, credentialsManager)
+	var request LocalTaskLaunchRequest
+	require.NoError(t, json.Unmarshal([]byte(localTaskTestRequest), &request))
+	taskARN, err := launcher.LaunchLocalTask(request)
+	require.NoError(t, err)
+
+	task, ok := taskEngine.GetTaskByArn(taskARN)
+	require.True(t, ok)
+	assert.Equal(t, "local-sleep", task.Family)
+	assert.True(t, task.IsLocal)
+	assert.Equal(t, taskARN, taskCredentials.ARN)
+	assert.Equal(t, taskCredentials.IAMRoleCredentials.CredentialsID, task.GetCredentialsID())
+	require.NoError(t, verifyTaskIsRunning(taskEngine.StateChangeEvents(), task))
+
+	// The container is created with the overrides, and the stub credentials endpoint
+	require.NotNil(t, containerConfig)
+	assert.Equal(t, []string{"sleep", "3600"}, []string(containerConfig.Cmd))
+	assert.Contains(t, containerConfig.Env, "STAGE=dev")
+	assert.Contains(t, containerConfig.Env, "DEBUG=true")
+	assert.Contains(t, containerConfig.Env, "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI="+
+		taskCredentials.IAMRoleCredentials.GenerateCredentialsEndpointRelativeURI())
+
+	require.NoError(t, launcher.StopLocalTask(taskARN))
+	verifyTaskIsStopped(taskEngine.StateChangeEvents(), task)
+	assert.Equal(t, apitaskstatus.TaskStopped, task.GetKnownStatus())
+	assert.Equal(t, ErrLocalTaskNotFound, launcher.StopLocalTask(taskARN))
+}
+
+func TestLocalTaskLaunchRequestValidation(t *testing.T) {
+	request := LocalTaskLaunchRequest{
+		TaskDefinition: LocalTaskDefinition{
+			NetworkMode: "awsvpc",
+			ContainerDefinitions: []LocalContainerDefinition{
+				{Name: "app", Image: "app", PortMappings: []LocalPortMapping{{ContainerPort: 80, Protocol: "sctp"}}},
+				{Name: "app", Image: "app"},
+				{Image: "sidecar", DependsOn: []LocalContainerDependency{{ContainerName: "db", Condition: "START"}}},
+			},
+		},
+		Overrides: LocalTaskOverrides{ContainerOverrides: []LocalContainerOverride{{Name: "web"}}},
+	}
+	_, err := request.acsTask("arn:aws:ecs:us-west-2:000000000000:task/default/id")
+	require.Error(t, err)
+	validationErr, ok := err.(*LocalTaskValidationError)
+	require.True(t, ok)
+	assert.Equal(t, []string{
+		"TaskDefinition.Family is required",
+		`TaskDefinition.NetworkMode "awsvpc" is not supported for local tasks`,
+		"TaskDefinition.ContainerDefinitions[0].PortMappings[0].Protocol must be tcp or udp",
+		`TaskDefinition.ContainerDefinitions[1].Name "app" is not unique`,
+		"TaskDefinition.ContainerDefinitions[2].Name is required",
+		`Overrides.ContainerOverrides[0].Name "web" is not a container of the task`,
+	}, validationErr.Problems)
+}
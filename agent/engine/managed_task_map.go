@@ -0,0 +1,104 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+)
+
+// TaskSnapshotter provides a snapshot of the tasks managed by the task engine that is
+// taken without blocking on the task engine adding or removing tasks.
+type TaskSnapshotter interface {
+	TaskSnapshot() []*apitask.Task
+}
+
+// managedTaskMap is the map of the tasks managed by the task engine, keyed by task arn.
+// It's copied on write: writers store an updated copy of the map, and readers load the
+// map without locking, so that lookups from docker events, metadata requests and stats
+// collection never block on the task engine holding tasksLock while it adds or removes
+// tasks. Writes copy all entries, which is cheap for the number of tasks on an instance
+// compared to the lookups. The zero value is an empty map.
+type managedTaskMap struct {
+	// writeLock serializes the writers so that no write is lost
+	writeLock sync.Mutex
+	// tasks is a map[string]*managedTask that is never modified once stored
+	tasks atomic.Value
+}
+
+// load returns the current map, which must not be modified.
+func (m *managedTaskMap) load() map[string]*managedTask {
+	tasks, _ := m.tasks.Load().(map[string]*managedTask)
+	return tasks
+}
+
+// get returns the managed task of the task arn.
+func (m *managedTaskMap) get(arn string) (*managedTask, bool) {
+	mTask, ok := m.load()[arn]
+	return mTask, ok
+}
+
+// len returns the number of managed tasks.
+func (m *managedTaskMap) len() int {
+	return len(m.load())
+}
+
+// set adds or replaces the managed task of the task arn.
+func (m *managedTaskMap) set(arn string, mTask *managedTask) {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	current := m.load()
+	tasks := make(map[string]*managedTask, len(current)+1)
+	for k, v := range current {
+		tasks[k] = v
+	}
+	tasks[arn] = mTask
+	m.tasks.Store(tasks)
+}
+
+// remove removes the managed task of the task arn.
+func (m *managedTaskMap) remove(arn string) {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	current := m.load()
+	if _, ok := current[arn]; !ok {
+		return
+	}
+	tasks := make(map[string]*managedTask, len(current))
+	for k, v := range current {
+		if k != arn {
+			tasks[k] = v
+		}
+	}
+	m.tasks.Store(tasks)
+}
+
+// TaskSnapshot returns the tasks managed by the task engine, sorted by arn. The snapshot
+// is consistent: it holds the tasks that were managed at one point in time. It's taken
+// without locking, so it never blocks on task state transitions. The tasks are shared
+// with the task engine and must only be read.
+func (engine *DockerTaskEngine) TaskSnapshot() []*apitask.Task {
+	managedTasks := engine.managedTasks.load()
+	tasks := make([]*apitask.Task, 0, len(managedTasks))
+	for _, mTask := range managedTasks {
+		tasks = append(tasks, mTask.Task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Arn < tasks[j].Arn
+	})
+	return tasks
+}
@@ -0,0 +1,256 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManagedTask(arn string) *managedTask {
+	return &managedTask{Task: &apitask.Task{Arn: arn}}
+}
+
+func TestManagedTaskMap(t *testing.T) {
+	var m managedTaskMap
+	_, ok := m.get("t1")
+	assert.False(t, ok)
+	assert.Equal(t, 0, m.len())
+
+	t1 := newTestManagedTask("t1")
+	m.set("t1", t1)
+	loaded := m.load()
+	m.set("t2", newTestManagedTask("t2"))
+	mTask, ok := m.get("t1")
+	require.True(t, ok)
+	assert.Same(t, t1, mTask)
+	assert.Equal(t, 2, m.len())
+	// Maps that were loaded are never modified
+	assert.Len(t, loaded, 1)
+
+	loaded = m.load()
+	m.remove("t1")
+	m.remove("unknown")
+	_, ok = m.get("t1")
+	assert.False(t, ok)
+	assert.Equal(t, 1, m.len())
+	assert.Len(t, loaded, 2)
+}
+
+func TestTaskSnapshot(t *testing.T) {
+	taskEngine := &DockerTaskEngine{}
+	assert.Empty(t, taskEngine.TaskSnapshot())
+
+	for _, arn := range []string{"t2", "t3", "t1"} {
+		taskEngine.managedTasks.set(arn, newTestManagedTask(arn))
+	}
+	snapshot := taskEngine.TaskSnapshot()
+	require.Len(t, snapshot, 3)
+	for i, arn := range []string{"t1", "t2", "t3"} {
+		assert.Equal(t, arn, snapshot[i].Arn)
+	}
+	taskEngine.managedTasks.remove("t2")
+	assert.Len(t, snapshot, 3)
+	assert.Len(t, taskEngine.TaskSnapshot(), 2)
+}
+
+// TestTaskSnapshotDoesNotBlockOnTasksLock tests that readers of the managed tasks aren't
+// blocked by the task engine adding or removing tasks.
+func TestTaskSnapshotDoesNotBlockOnTasksLock(t *testing.T) {
+	taskEngine := &DockerTaskEngine{}
+	taskEngine.managedTasks.set("t1", newTestManagedTask("t1"))
+
+	taskEngine.tasksLock.Lock()
+	defer taskEngine.tasksLock.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		taskEngine.TaskSnapshot()
+		taskEngine.isTaskManaged("t1")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reading the managed tasks blocked on tasksLock")
+	}
+}
+
+// TestManagedTaskMapConcurrentAccess adds and removes tasks while they are read, and should
+// be run with the race detector.
+func TestManagedTaskMapConcurrentAccess(t *testing.T) {
+	const (
+		writers         = 4
+		tasksPerWriter  = 200
+		readers         = 8
+		readsPerReader  = 2000
+		permanentTaskID = "permanent"
+	)
+	taskEngine := &DockerTaskEngine{}
+	taskEngine.managedTasks.set(permanentTaskID, newTestManagedTask(permanentTaskID))
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < tasksPerWriter; i++ {
+				arn := fmt.Sprintf("task-%d-%d", w, i)
+				taskEngine.managedTasks.set(arn, newTestManagedTask(arn))
+				// Every other task is removed again, like tasks that churn
+				if i%2 == 1 {
+					taskEngine.managedTasks.remove(arn)
+				}
+			}
+		}(w)
+	}
+	errs := make(chan error, readers)
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < readsPerReader; i++ {
+				if _, ok := taskEngine.managedTasks.get(permanentTaskID); !ok {
+					errs <- fmt.Errorf("task %s not found", permanentTaskID)
+					return
+				}
+				snapshot := taskEngine.TaskSnapshot()
+				for j := 1; j < len(snapshot); j++ {
+					if snapshot[j-1].Arn >= snapshot[j].Arn {
+						errs <- fmt.Errorf("snapshot isn't sorted by arn: %s, %s", snapshot[j-1].Arn, snapshot[j].Arn)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// No write is lost
+	assert.Equal(t, 1+writers*tasksPerWriter/2, taskEngine.managedTasks.len())
+	for w := 0; w < writers; w++ {
+		for i := 0; i < tasksPerWriter; i++ {
+			_, ok := taskEngine.managedTasks.get(fmt.Sprintf("task-%d-%d", w, i))
+			assert.Equal(t, i%2 == 0, ok)
+		}
+	}
+}
+
+// rwMutexManagedTaskMap is the managed task map guarded by tasksLock that managedTaskMap
+// replaced, which the contention benchmarks compare against.
+type rwMutexManagedTaskMap struct {
+	lock  sync.RWMutex
+	tasks map[string]*managedTask
+}
+
+func (m *rwMutexManagedTaskMap) get(arn string) (*managedTask, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	mTask, ok := m.tasks[arn]
+	return mTask, ok
+}
+
+// churn adds and removes a task while holding the write lock, like the task engine does
+// while it removes a task and its data.
+func (m *rwMutexManagedTaskMap) churn(arn string, hold time.Duration) {
+	m.lock.Lock()
+	m.tasks[arn] = newTestManagedTask(arn)
+	spin(hold)
+	delete(m.tasks, arn)
+	m.lock.Unlock()
+}
+
+const (
+	benchmarkTasks     = 100
+	benchmarkWriteHold = 20 * time.Microsecond
+)
+
+// spin keeps the goroutine busy for the duration, which unlike sleeping isn't rounded up
+// to the resolution of timers.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+// runContentionBenchmark looks up tasks from parallel readers while a writer churns tasks.
+func runContentionBenchmark(b *testing.B, get func(arn string) (*managedTask, bool), churn func(arn string)) {
+	stop := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				churn(fmt.Sprintf("churn-%d", i))
+				runtime.Gosched()
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			get(fmt.Sprintf("task-%d", i%benchmarkTasks))
+			i++
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-writerDone
+}
+
+// BenchmarkManagedTaskLookupRWMutex is the contention of task lookups before managedTaskMap.
+func BenchmarkManagedTaskLookupRWMutex(b *testing.B) {
+	m := &rwMutexManagedTaskMap{tasks: make(map[string]*managedTask)}
+	for i := 0; i < benchmarkTasks; i++ {
+		arn := fmt.Sprintf("task-%d", i)
+		m.tasks[arn] = newTestManagedTask(arn)
+	}
+	runContentionBenchmark(b, m.get, func(arn string) {
+		m.churn(arn, benchmarkWriteHold)
+	})
+}
+
+// BenchmarkManagedTaskLookupCopyOnWrite is the contention of task lookups with managedTaskMap.
+func BenchmarkManagedTaskLookupCopyOnWrite(b *testing.B) {
+	var tasksLock sync.RWMutex
+	var m managedTaskMap
+	for i := 0; i < benchmarkTasks; i++ {
+		arn := fmt.Sprintf("task-%d", i)
+		m.set(arn, newTestManagedTask(arn))
+	}
+	runContentionBenchmark(b, m.get, func(arn string) {
+		tasksLock.Lock()
+		m.set(arn, newTestManagedTask(arn))
+		spin(benchmarkWriteHold)
+		m.remove(arn)
+		tasksLock.Unlock()
+	})
+}
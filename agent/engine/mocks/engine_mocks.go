@@ -307,6 +307,20 @@ func (mr *MockImageManagerMockRecorder) RecordContainerReference(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordContainerReference", reflect.TypeOf((*MockImageManager)(nil).RecordContainerReference), arg0)
 }
 
+// RecordPrefetchedImage mocks base method.
+func (m *MockImageManager) RecordPrefetchedImage(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordPrefetchedImage", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordPrefetchedImage indicates an expected call of RecordPrefetchedImage.
+func (mr *MockImageManagerMockRecorder) RecordPrefetchedImage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordPrefetchedImage", reflect.TypeOf((*MockImageManager)(nil).RecordPrefetchedImage), arg0)
+}
+
 // RemoveContainerReferenceFromImageState mocks base method.
 func (m *MockImageManager) RemoveContainerReferenceFromImageState(arg0 *container.Container) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,226 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+// ReconciliationProgress is the progress of the reconciliation of the containers restored
+// from the saved state with docker when the agent starts.
+type ReconciliationProgress struct {
+	Reconciling bool `json:"Reconciling"`
+	// Reconciled and Remaining are the numbers of containers that have been reconciled and
+	// that are still to be reconciled, out of Total
+	Reconciled int `json:"Reconciled"`
+	Remaining  int `json:"Remaining"`
+	Total      int `json:"Total"`
+	// Status summarizes the progress, for example "reconciling: 34/150"
+	Status string `json:"Status"`
+}
+
+// ReconciliationProgressReporter reports the progress of the state reconciliation.
+type ReconciliationProgressReporter interface {
+	ReconciliationProgress() ReconciliationProgress
+}
+
+// reconciliationTracker counts the containers that are reconciled with docker as the state
+// is synchronized.
+type reconciliationTracker struct {
+	reconciling int32
+	total       int64
+	reconciled  int64
+}
+
+func (t *reconciliationTracker) start(total int) {
+	atomic.StoreInt64(&t.reconciled, 0)
+	atomic.StoreInt64(&t.total, int64(total))
+	atomic.StoreInt32(&t.reconciling, 1)
+}
+
+func (t *reconciliationTracker) containerReconciled() {
+	atomic.AddInt64(&t.reconciled, 1)
+}
+
+func (t *reconciliationTracker) finish() {
+	atomic.StoreInt32(&t.reconciling, 0)
+}
+
+// ReconciliationProgress returns the progress of the reconciliation of the containers
+// restored from the saved state.
+func (engine *DockerTaskEngine) ReconciliationProgress() ReconciliationProgress {
+	t := &engine.reconciliation
+	progress := ReconciliationProgress{
+		Reconciling: atomic.LoadInt32(&t.reconciling) == 1,
+		Reconciled:  int(atomic.LoadInt64(&t.reconciled)),
+		Total:       int(atomic.LoadInt64(&t.total)),
+	}
+	progress.Remaining = progress.Total - progress.Reconciled
+	state := "reconciled"
+	if progress.Reconciling {
+		state = "reconciling"
+	}
+	progress.Status = fmt.Sprintf("%s: %d/%d", state, progress.Reconciled, progress.Total)
+	return progress
+}
+
+// taskReconciliation is the work of reconciling the containers of a task, in the order
+// they are reconciled in.
+type taskReconciliation struct {
+	task       *apitask.Task
+	containers []*apicontainer.DockerContainer
+	// credentialsExpiration is the earliest expiration of the credentials of the task,
+	// if the task has credentials whose expiration is known
+	credentialsExpiration time.Time
+	hasCredentials        bool
+}
+
+// synchronizeContainerStatuses synchronizes the statuses of the containers of the tasks
+// with docker, with up to StateReconcileConcurrency containers being synchronized at the
+// same time. The containers of a task are synchronized one after the other, in the order
+// of the task's containers. Tasks whose credentials expire first are synchronized first, so
+// that they can be served their refreshed credentials as soon as possible.
+func (engine *DockerTaskEngine) synchronizeContainerStatuses(work []*taskReconciliation) {
+	total := 0
+	for _, w := range work {
+		total += len(w.containers)
+	}
+	engine.reconciliation.start(total)
+	defer engine.reconciliation.finish()
+	if total == 0 {
+		return
+	}
+
+	sortTaskReconciliations(work)
+	concurrency := engine.cfg.StateReconcileConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(work) {
+		concurrency = len(work)
+	}
+	logger.Info("Reconciling containers restored from the saved state", logger.Fields{
+		"tasks":       len(work),
+		"containers":  total,
+		"concurrency": concurrency,
+	})
+	start := time.Now()
+
+	queue := make(chan *taskReconciliation)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range queue {
+				for _, cont := range w.containers {
+					engine.synchronizeContainerStatus(cont, w.task)
+					engine.saveDockerContainerData(cont) // persist the container with the updated information.
+					engine.reconciliation.containerReconciled()
+				}
+			}
+		}()
+	}
+	for _, w := range work {
+		queue <- w
+	}
+	close(queue)
+	wg.Wait()
+	logger.Info("Reconciled containers restored from the saved state", logger.Fields{
+		"containers": total,
+		"elapsed":    time.Since(start).String(),
+	})
+}
+
+// newTaskReconciliation returns the work of reconciling the containers of the task. The
+// containers are ordered like the task's containers, followed by any containers the task
+// doesn't know of, by name.
+func (engine *DockerTaskEngine) newTaskReconciliation(task *apitask.Task,
+	conts map[string]*apicontainer.DockerContainer) *taskReconciliation {
+	w := &taskReconciliation{task: task}
+	seen := make(map[string]bool, len(conts))
+	for _, container := range task.Containers {
+		if cont, ok := conts[container.Name]; ok {
+			w.containers = append(w.containers, cont)
+			seen[container.Name] = true
+		}
+	}
+	var unknown []string
+	for name := range conts {
+		if !seen[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		w.containers = append(w.containers, conts[name])
+	}
+
+	for _, credentialsID := range []string{task.GetCredentialsID(), task.GetExecutionCredentialsID()} {
+		if credentialsID == "" {
+			continue
+		}
+		w.hasCredentials = true
+		if engine.credentialsManager == nil {
+			continue
+		}
+		taskCredentials, ok := engine.credentialsManager.GetTaskCredentials(credentialsID)
+		if !ok {
+			continue
+		}
+		expiration, err := time.Parse(time.RFC3339, taskCredentials.GetIAMRoleCredentials().Expiration)
+		if err != nil {
+			logger.Debug("Unable to parse the expiration of task credentials", logger.Fields{
+				field.TaskID: task.GetID(),
+				field.Error:  err,
+			})
+			continue
+		}
+		if w.credentialsExpiration.IsZero() || expiration.Before(w.credentialsExpiration) {
+			w.credentialsExpiration = expiration
+		}
+	}
+	return w
+}
+
+// sortTaskReconciliations orders the work by priority: tasks whose credentials expire
+// first, then tasks with credentials whose expiration isn't known, then the other tasks.
+func sortTaskReconciliations(work []*taskReconciliation) {
+	rank := func(w *taskReconciliation) int {
+		switch {
+		case !w.credentialsExpiration.IsZero():
+			return 0
+		case w.hasCredentials:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(work, func(i, j int) bool {
+		ri, rj := rank(work[i]), rank(work[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return ri == 0 && work[i].credentialsExpiration.Before(work[j].credentialsExpiration)
+	})
+}
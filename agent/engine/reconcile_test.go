@@ -0,0 +1,200 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	reconcileTestTasks             = 10
+	reconcileTestContainersPerTask = 4
+	reconcileTestDescribeLatency   = 5 * time.Millisecond
+)
+
+// reconcileContainers synchronizes the statuses of the containers of restored tasks with a
+// fake docker client whose describes take reconcileTestDescribeLatency, and fail for the
+// containers in failing. It returns the tasks, the order the containers of each task were
+// described in, and how long the synchronization took.
+func reconcileContainers(t *testing.T, concurrency int, failing map[string]bool) (
+	[]*apitask.Task, map[string][]string, time.Duration) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	cfg := defaultConfig
+	cfg.StateReconcileConcurrency = concurrency
+	ctrl, client, _, taskEngine, _, imageManager, _, _ := mocks(t, ctx, &cfg)
+	defer ctrl.Finish()
+	dockerTaskEngine := taskEngine.(*DockerTaskEngine)
+
+	var tasks []*apitask.Task
+	for i := 0; i < reconcileTestTasks; i++ {
+		task := &apitask.Task{Arn: fmt.Sprintf("arn:aws:ecs:us-west-2:123456789012:task/cluster/task%d", i)}
+		for j := 0; j < reconcileTestContainersPerTask; j++ {
+			container := &apicontainer.Container{Name: fmt.Sprintf("c%d", j)}
+			container.SetKnownStatus(apicontainerstatus.ContainerRunning)
+			task.Containers = append(task.Containers, container)
+		}
+		dockerTaskEngine.state.AddTask(task)
+		for _, container := range task.Containers {
+			dockerTaskEngine.state.AddContainer(&apicontainer.DockerContainer{
+				DockerID:   fmt.Sprintf("task%d-%s", i, container.Name),
+				DockerName: container.Name,
+				Container:  container,
+			}, task)
+		}
+		tasks = append(tasks, task)
+	}
+
+	var lock sync.Mutex
+	describeOrder := make(map[string][]string)
+	client.EXPECT().DescribeContainer(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dockerID string) (apicontainerstatus.ContainerStatus, dockerapi.DockerContainerMetadata) {
+			progress := dockerTaskEngine.ReconciliationProgress()
+			assert.True(t, progress.Reconciling)
+			assert.Equal(t, reconcileTestTasks*reconcileTestContainersPerTask, progress.Total)
+
+			time.Sleep(reconcileTestDescribeLatency)
+			ids := strings.SplitN(dockerID, "-", 2)
+			lock.Lock()
+			describeOrder[ids[0]] = append(describeOrder[ids[0]], ids[1])
+			lock.Unlock()
+			if failing[dockerID] {
+				return apicontainerstatus.ContainerStatusNone, dockerapi.DockerContainerMetadata{
+					Error: dockerapi.CannotDescribeContainerError{FromError: errors.New("No such container: " + dockerID)},
+				}
+			}
+			return apicontainerstatus.ContainerRunning, dockerapi.DockerContainerMetadata{DockerID: dockerID}
+		}).Times(reconcileTestTasks * reconcileTestContainersPerTask)
+	imageManager.EXPECT().RecordContainerReference(gomock.Any()).AnyTimes()
+	imageManager.EXPECT().RemoveContainerReferenceFromImageState(gomock.Any()).AnyTimes()
+
+	start := time.Now()
+	tasksToStart := dockerTaskEngine.filterTasksToStartUnsafe(tasks)
+	elapsed := time.Since(start)
+	assert.Equal(t, tasks, tasksToStart)
+
+	progress := dockerTaskEngine.ReconciliationProgress()
+	assert.False(t, progress.Reconciling)
+	assert.Equal(t, 0, progress.Remaining)
+	assert.Equal(t, fmt.Sprintf("reconciled: %d/%d", progress.Total, progress.Total), progress.Status)
+	return tasks, describeOrder, elapsed
+}
+
+func TestSynchronizeContainerStatusesInParallel(t *testing.T) {
+	failing := map[string]bool{"task3-c1": true, "task7-c0": true, "task7-c3": true}
+	_, _, sequential := reconcileContainers(t, 1, failing)
+	tasks, describeOrder, parallel := reconcileContainers(t, 8, failing)
+	t.Logf("Reconciled %d containers in %v sequentially and %v with 8 workers",
+		reconcileTestTasks*reconcileTestContainersPerTask, sequential, parallel)
+	assert.Less(t, int64(parallel), int64(sequential/2))
+
+	for i, task := range tasks {
+		// The containers of a task are reconciled in order, one after the other
+		assert.Equal(t, []string{"c0", "c1", "c2", "c3"}, describeOrder[fmt.Sprintf("task%d", i)])
+		for _, container := range task.Containers {
+			dockerID := fmt.Sprintf("task%d-%s", i, container.Name)
+			if failing[dockerID] {
+				assert.Equal(t, apicontainerstatus.ContainerStopped, container.GetKnownStatus(), dockerID)
+				assert.NotNil(t, container.ApplyingError, dockerID)
+			} else {
+				assert.Equal(t, apicontainerstatus.ContainerRunning, container.GetKnownStatus(), dockerID)
+				assert.Nil(t, container.ApplyingError, dockerID)
+			}
+		}
+	}
+}
+
+func TestTaskReconciliationPriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	ctrl, _, _, taskEngine, credentialsManager, _, _, _ := mocks(t, ctx, &defaultConfig)
+	defer ctrl.Finish()
+	dockerTaskEngine := taskEngine.(*DockerTaskEngine)
+
+	now := time.Now().UTC()
+	expirations := map[string]time.Time{
+		"late-creds":      now.Add(time.Hour),
+		"soon-creds":      now.Add(5 * time.Minute),
+		"soon-exec-creds": now.Add(2 * time.Minute),
+	}
+	credentialsManager.EXPECT().GetTaskCredentials(gomock.Any()).DoAndReturn(
+		func(id string) (credentials.TaskIAMRoleCredentials, bool) {
+			expiration, ok := expirations[id]
+			if !ok {
+				return credentials.TaskIAMRoleCredentials{}, false
+			}
+			return credentials.TaskIAMRoleCredentials{
+				IAMRoleCredentials: credentials.IAMRoleCredentials{Expiration: expiration.Format(time.RFC3339)},
+			}, true
+		}).AnyTimes()
+
+	newTask := func(arn, credentialsID, executionCredentialsID string) *taskReconciliation {
+		task := &apitask.Task{Arn: arn}
+		task.SetCredentialsID(credentialsID)
+		task.SetExecutionRoleCredentialsID(executionCredentialsID)
+		return dockerTaskEngine.newTaskReconciliation(task, nil)
+	}
+	work := []*taskReconciliation{
+		newTask("no-creds", "", ""),
+		newTask("unknown-creds", "missing-creds", ""),
+		newTask("late", "late-creds", ""),
+		newTask("soon", "soon-creds", "soon-exec-creds"),
+	}
+	sortTaskReconciliations(work)
+	var order []string
+	for _, w := range work {
+		order = append(order, w.task.Arn)
+	}
+	assert.Equal(t, []string{"soon", "late", "unknown-creds", "no-creds"}, order)
+	require.False(t, work[0].credentialsExpiration.IsZero())
+	assert.Equal(t, expirations["soon-exec-creds"].Truncate(time.Second), work[0].credentialsExpiration.UTC())
+}
+
+func TestTaskReconciliationContainerOrder(t *testing.T) {
+	task := &apitask.Task{
+		Containers: []*apicontainer.Container{{Name: "pause"}, {Name: "app"}, {Name: "sidecar"}},
+	}
+	conts := map[string]*apicontainer.DockerContainer{
+		"sidecar": {Container: task.Containers[2]},
+		"zombie":  {Container: &apicontainer.Container{Name: "zombie"}},
+		"app":     {Container: task.Containers[1]},
+		"pause":   {Container: task.Containers[0]},
+		"orphan":  {Container: &apicontainer.Container{Name: "orphan"}},
+	}
+	w := (&DockerTaskEngine{}).newTaskReconciliation(task, conts)
+	var order []string
+	for _, cont := range w.containers {
+		order = append(order, cont.Container.Name)
+	}
+	assert.Equal(t, []string{"pause", "app", "sidecar", "orphan", "zombie"}, order)
+}
@@ -0,0 +1,183 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource"
+	resourcestatus "github.com/aws/amazon-ecs-agent/agent/taskresource/status"
+	taskresourcetypes "github.com/aws/amazon-ecs-agent/agent/taskresource/types"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const (
+	resourceRetryBackoffJitter     = 0.2
+	resourceRetryBackoffMultiplier = 2
+)
+
+// resourceRetryPolicy is how many times the creation of a task resource is attempted
+// before the task fails, and how long to wait between attempts.
+type resourceRetryPolicy struct {
+	maxAttempts int
+	backoffMin  time.Duration
+	backoffMax  time.Duration
+}
+
+// defaultResourceRetryPolicy is the retry policy of the resource types without a policy of
+// their own, which are created once. These resources, such as secrets, mostly fail to be
+// created for reasons that a retry doesn't fix, like missing permissions.
+var defaultResourceRetryPolicy = resourceRetryPolicy{maxAttempts: 1}
+
+// defaultResourceRetryPolicies are the retry policies of the resource types that can fail
+// to be created transiently: cgroups while the cgroups of stopped tasks are removed, and
+// volumes while their driver attaches or mounts the storage that backs them.
+var defaultResourceRetryPolicies = map[string]resourceRetryPolicy{
+	taskresourcetypes.CgroupKey: {
+		maxAttempts: 3,
+		backoffMin:  time.Second,
+		backoffMax:  5 * time.Second,
+	},
+	taskresourcetypes.DockerVolumeKey: {
+		maxAttempts: 5,
+		backoffMin:  2 * time.Second,
+		backoffMax:  30 * time.Second,
+	},
+	taskresourcetypes.FSxWindowsFileServerKey: {
+		maxAttempts: 3,
+		backoffMin:  2 * time.Second,
+		backoffMax:  10 * time.Second,
+	},
+}
+
+// resourceProvisioning holds the retry policies of the creation of task resources, and the
+// publisher of the resource state changes. The default retry policy is used for all
+// resource types if policies is not set.
+type resourceProvisioning struct {
+	// policies are the retry policies by resource type
+	policies map[string]resourceRetryPolicy
+
+	lock    sync.RWMutex
+	publish func(statechange.Event)
+}
+
+// SetResourceEventPublisher sets the function that the attempts to create task resources,
+// and the rollbacks of task resources, are published to.
+func (engine *DockerTaskEngine) SetResourceEventPublisher(publish func(statechange.Event)) {
+	engine.resourceProvisioning.lock.Lock()
+	defer engine.resourceProvisioning.lock.Unlock()
+	engine.resourceProvisioning.publish = publish
+}
+
+func (p *resourceProvisioning) retryPolicy(resourceType string) resourceRetryPolicy {
+	if policy, ok := p.policies[resourceType]; ok && policy.maxAttempts > 0 {
+		return policy
+	}
+	return defaultResourceRetryPolicy
+}
+
+func (p *resourceProvisioning) publishEvent(event api.ResourceStateChange) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.publish != nil {
+		p.publish(event)
+	}
+}
+
+// applyResourceStateWithRetry moves the resource to the given state, retrying the creation
+// of the resource as the retry policy of its type allows. Every attempt is published as a
+// resource state change. Retries stop once the resource is no longer desired, such as when
+// the task is stopped while the resource is being created.
+func (mtask *managedTask) applyResourceStateWithRetry(resource taskresource.TaskResource,
+	nextState resourcestatus.ResourceStatus) error {
+	resourceType := mtask.GetResourceType(resource)
+	policy := defaultResourceRetryPolicy
+	if nextState == resource.SteadyState() {
+		policy = mtask.engine.resourceProvisioning.retryPolicy(resourceType)
+	}
+	backoff := newExponentialBackoff(policy.backoffMin, policy.backoffMax, resourceRetryBackoffJitter,
+		resourceRetryBackoffMultiplier)
+	for attempt := 1; ; attempt++ {
+		err := mtask.applyResourceState(resource, nextState)
+		event := api.ResourceStateChange{
+			TaskArn:      mtask.Arn,
+			ResourceName: resource.GetName(),
+			ResourceType: resourceType,
+			Status:       resource.StatusString(nextState),
+			Attempt:      attempt,
+			MaxAttempts:  policy.maxAttempts,
+		}
+		if err != nil {
+			event.Reason = err.Error()
+		}
+		mtask.engine.resourceProvisioning.publishEvent(event)
+		if err == nil || attempt >= policy.maxAttempts || resource.DesiredTerminal() {
+			return err
+		}
+
+		retryIn := backoff.Duration()
+		logger.Warn(fmt.Sprintf("Error creating task resource, retrying in %v", retryIn), logger.Fields{
+			field.TaskID:   mtask.GetID(),
+			field.Resource: resource.GetName(),
+			field.Error:    err,
+			"attempt":      attempt,
+		})
+		timer := time.NewTimer(retryIn)
+		select {
+		case <-mtask.ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// rollbackResources cleans up the resources of the task that were created, in the reverse
+// order of their creation, once a resource of the task failed to be created. The task is
+// stopped anyway, and its resources would otherwise be held until the task is cleaned up.
+// Resources that are still being created are left to the cleanup of the task.
+func (mtask *managedTask) rollbackResources() {
+	for i := len(mtask.provisionedResources) - 1; i >= 0; i-- {
+		res := mtask.provisionedResources[i]
+		terminalStatus := res.TerminalStatus()
+		event := api.ResourceStateChange{
+			TaskArn:      mtask.Arn,
+			ResourceName: res.GetName(),
+			ResourceType: mtask.GetResourceType(res),
+			Status:       res.StatusString(terminalStatus),
+		}
+		if err := res.Cleanup(); err != nil {
+			logger.Warn("Unable to roll back task resource", logger.Fields{
+				field.TaskID:   mtask.GetID(),
+				field.Resource: res.GetName(),
+				field.Error:    err,
+			})
+			event.Reason = err.Error()
+		} else {
+			logger.Info("Rolled back task resource", logger.Fields{
+				field.TaskID:   mtask.GetID(),
+				field.Resource: res.GetName(),
+			})
+			res.SetDesiredStatus(terminalStatus)
+			res.SetKnownStatus(terminalStatus)
+		}
+		mtask.engine.resourceProvisioning.publishEvent(event)
+	}
+	mtask.provisionedResources = nil
+}
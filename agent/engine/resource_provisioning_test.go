@@ -0,0 +1,358 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource"
+	resourcestatus "github.com/aws/amazon-ecs-agent/agent/taskresource/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const provisioningTestTaskARN = "arn:aws:ecs:us-west-2:1234567890:task/default/task1"
+
+// fakeProvisionedResource is a task resource whose first attempts to be created fail, and
+// which records its creation attempts and cleanups in the operations of the test.
+type fakeProvisionedResource struct {
+	taskresource.TaskResource
+	name string
+	// createFailures is the number of attempts to create the resource that fail
+	createFailures int
+	cleanupErr     error
+	ops            *[]string
+
+	lock          sync.Mutex
+	knownStatus   resourcestatus.ResourceStatus
+	desiredStatus resourcestatus.ResourceStatus
+}
+
+func newFakeProvisionedResource(name string, ops *[]string) *fakeProvisionedResource {
+	return &fakeProvisionedResource{
+		name:          name,
+		ops:           ops,
+		desiredStatus: resourcestatus.ResourceCreated,
+	}
+}
+
+func (r *fakeProvisionedResource) GetName() string { return r.name }
+
+func (r *fakeProvisionedResource) SteadyState() resourcestatus.ResourceStatus {
+	return resourcestatus.ResourceCreated
+}
+
+func (r *fakeProvisionedResource) TerminalStatus() resourcestatus.ResourceStatus {
+	return resourcestatus.ResourceRemoved
+}
+
+func (r *fakeProvisionedResource) StatusString(status resourcestatus.ResourceStatus) string {
+	switch status {
+	case resourcestatus.ResourceCreated:
+		return "CREATED"
+	case resourcestatus.ResourceRemoved:
+		return "REMOVED"
+	default:
+		return "NONE"
+	}
+}
+
+func (r *fakeProvisionedResource) ApplyTransition(status resourcestatus.ResourceStatus) error {
+	*r.ops = append(*r.ops, "create "+r.name)
+	if r.createFailures > 0 {
+		r.createFailures--
+		return fmt.Errorf("%s is busy", r.name)
+	}
+	return nil
+}
+
+func (r *fakeProvisionedResource) Cleanup() error {
+	*r.ops = append(*r.ops, "cleanup "+r.name)
+	return r.cleanupErr
+}
+
+func (r *fakeProvisionedResource) GetTerminalReason() string { return r.name + " could not be created" }
+
+func (r *fakeProvisionedResource) GetKnownStatus() resourcestatus.ResourceStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.knownStatus
+}
+
+func (r *fakeProvisionedResource) SetKnownStatus(status resourcestatus.ResourceStatus) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.knownStatus = status
+}
+
+func (r *fakeProvisionedResource) GetDesiredStatus() resourcestatus.ResourceStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.desiredStatus
+}
+
+func (r *fakeProvisionedResource) SetDesiredStatus(status resourcestatus.ResourceStatus) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.desiredStatus = status
+}
+
+func (r *fakeProvisionedResource) DesiredTerminal() bool {
+	return r.GetDesiredStatus() == resourcestatus.ResourceRemoved
+}
+
+// newProvisioningTestTask returns a managed task whose engine retries the creation of
+// cgroups and volumes, and the resource state changes that the engine publishes.
+func newProvisioningTestTask(ctx context.Context, backoff time.Duration) (*managedTask, *[]api.ResourceStateChange) {
+	engine := &DockerTaskEngine{
+		dataClient: data.NewNoopClient(),
+		resourceProvisioning: resourceProvisioning{
+			policies: map[string]resourceRetryPolicy{
+				"cgroup":       {maxAttempts: 3, backoffMin: backoff, backoffMax: backoff},
+				"dockerVolume": {maxAttempts: 2, backoffMin: backoff, backoffMax: backoff},
+			},
+		},
+	}
+	var events []api.ResourceStateChange
+	engine.SetResourceEventPublisher(func(event statechange.Event) {
+		events = append(events, event.(api.ResourceStateChange))
+	})
+	mtask := &managedTask{
+		Task: &apitask.Task{
+			Arn:                 provisioningTestTaskARN,
+			ResourcesMapUnsafe:  make(map[string][]taskresource.TaskResource),
+			DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		},
+		ctx:    ctx,
+		engine: engine,
+	}
+	return mtask, &events
+}
+
+func TestApplyResourceStateWithRetry(t *testing.T) {
+	testCases := []struct {
+		name           string
+		resourceType   string
+		createFailures int
+		canceled       bool
+		expectedErr    bool
+		// expectedReasons are the reasons of the published attempts
+		expectedReasons []string
+		maxAttempts     int
+	}{
+		{
+			name:            "created on the first attempt",
+			resourceType:    "cgroup",
+			expectedReasons: []string{""},
+			maxAttempts:     3,
+		},
+		{
+			name:            "created on a retry",
+			resourceType:    "cgroup",
+			createFailures:  2,
+			expectedReasons: []string{"res is busy", "res is busy", ""},
+			maxAttempts:     3,
+		},
+		{
+			name:            "attempts exhausted",
+			resourceType:    "dockerVolume",
+			createFailures:  5,
+			expectedErr:     true,
+			expectedReasons: []string{"res is busy", "res is busy"},
+			maxAttempts:     2,
+		},
+		{
+			name:            "type without a retry policy",
+			resourceType:    "asmsecret",
+			createFailures:  1,
+			expectedErr:     true,
+			expectedReasons: []string{"res is busy"},
+			maxAttempts:     1,
+		},
+		{
+			name:            "task context done while backing off",
+			resourceType:    "cgroup",
+			createFailures:  1,
+			canceled:        true,
+			expectedErr:     true,
+			expectedReasons: []string{"res is busy"},
+			maxAttempts:     3,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			backoff := time.Millisecond
+			if tc.canceled {
+				cancel()
+				backoff = time.Hour
+			}
+			mtask, events := newProvisioningTestTask(ctx, backoff)
+			var ops []string
+			res := newFakeProvisionedResource("res", &ops)
+			res.createFailures = tc.createFailures
+			mtask.AddResource(tc.resourceType, res)
+
+			err := mtask.applyResourceStateWithRetry(res, resourcestatus.ResourceCreated)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			require.Len(t, *events, len(tc.expectedReasons))
+			assert.Len(t, ops, len(tc.expectedReasons))
+			for i, event := range *events {
+				assert.Equal(t, api.ResourceStateChange{
+					TaskArn:      provisioningTestTaskARN,
+					ResourceName: "res",
+					ResourceType: tc.resourceType,
+					Status:       "CREATED",
+					Attempt:      i + 1,
+					MaxAttempts:  tc.maxAttempts,
+					Reason:       tc.expectedReasons[i],
+				}, event)
+			}
+		})
+	}
+}
+
+func TestApplyResourceStateWithRetryStopsOnceNotDesired(t *testing.T) {
+	mtask, events := newProvisioningTestTask(context.Background(), time.Millisecond)
+	var ops []string
+	res := newFakeProvisionedResource("res", &ops)
+	res.createFailures = 5
+	// The task is stopped while the resource is being created
+	res.SetDesiredStatus(resourcestatus.ResourceRemoved)
+	mtask.AddResource("cgroup", res)
+
+	assert.Error(t, mtask.applyResourceStateWithRetry(res, resourcestatus.ResourceCreated))
+	assert.Equal(t, []string{"create res"}, ops)
+	assert.Len(t, *events, 1)
+}
+
+func TestHandleResourceStateChangeRollsBackResources(t *testing.T) {
+	testCases := []struct {
+		name string
+		// failing is the index of the resource that fails to be created, the resources
+		// before it are created in order
+		failing     int
+		expectedOps []string
+	}{
+		{
+			name:    "first resource fails",
+			failing: 0,
+		},
+		{
+			name:        "second resource fails",
+			failing:     1,
+			expectedOps: []string{"cleanup cgroup"},
+		},
+		{
+			name:        "third resource fails",
+			failing:     2,
+			expectedOps: []string{"cleanup volume1", "cleanup cgroup"},
+		},
+		{
+			name:        "last resource fails",
+			failing:     3,
+			expectedOps: []string{"cleanup volume2", "cleanup volume1", "cleanup cgroup"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mtask, events := newProvisioningTestTask(context.Background(), time.Millisecond)
+			var ops []string
+			resources := []*fakeProvisionedResource{
+				newFakeProvisionedResource("cgroup", &ops),
+				newFakeProvisionedResource("volume1", &ops),
+				newFakeProvisionedResource("volume2", &ops),
+				newFakeProvisionedResource("envfile", &ops),
+			}
+			mtask.AddResource("cgroup", resources[0])
+			mtask.AddResource("dockerVolume", resources[1])
+			mtask.AddResource("dockerVolume", resources[2])
+			mtask.AddResource("envfile", resources[3])
+
+			for _, res := range resources[:tc.failing] {
+				mtask.handleResourceStateChange(resourceStateChange{res, resourcestatus.ResourceCreated, nil})
+			}
+			// The next resource fails to be created once its attempts are exhausted
+			mtask.handleResourceStateChange(resourceStateChange{resources[tc.failing],
+				resourcestatus.ResourceCreated, errors.New("transition error")})
+
+			assert.Equal(t, tc.expectedOps, ops)
+			assert.Equal(t, apitaskstatus.TaskStopped, mtask.GetDesiredStatus())
+			for i, res := range resources {
+				if i < tc.failing {
+					assert.Equal(t, resourcestatus.ResourceRemoved, res.GetKnownStatus(), res.name)
+					assert.Equal(t, resourcestatus.ResourceRemoved, res.GetDesiredStatus(), res.name)
+				} else {
+					assert.Equal(t, resourcestatus.ResourceStatusNone, res.GetKnownStatus(), res.name)
+				}
+			}
+			// The rollbacks are published in the order they are done
+			require.Len(t, *events, tc.failing)
+			for i, event := range *events {
+				res := resources[tc.failing-1-i]
+				assert.Equal(t, res.name, event.ResourceName)
+				assert.Equal(t, mtask.GetResourceType(res), event.ResourceType)
+				assert.Equal(t, "REMOVED", event.Status)
+				assert.Zero(t, event.Attempt)
+				assert.Empty(t, event.Reason)
+			}
+			assert.Empty(t, mtask.provisionedResources)
+		})
+	}
+}
+
+func TestRollbackResourcesContinuesOnCleanupFailure(t *testing.T) {
+	mtask, events := newProvisioningTestTask(context.Background(), time.Millisecond)
+	var ops []string
+	cgroup := newFakeProvisionedResource("cgroup", &ops)
+	volume := newFakeProvisionedResource("volume", &ops)
+	volume.cleanupErr = errors.New("volume is in use")
+	failing := newFakeProvisionedResource("envfile", &ops)
+	mtask.AddResource("cgroup", cgroup)
+	mtask.AddResource("dockerVolume", volume)
+	mtask.AddResource("envfile", failing)
+
+	mtask.handleResourceStateChange(resourceStateChange{cgroup, resourcestatus.ResourceCreated, nil})
+	mtask.handleResourceStateChange(resourceStateChange{volume, resourcestatus.ResourceCreated, nil})
+	mtask.handleResourceStateChange(resourceStateChange{failing, resourcestatus.ResourceCreated,
+		errors.New("transition error")})
+
+	assert.Equal(t, []string{"cleanup volume", "cleanup cgroup"}, ops)
+	// The volume that couldn't be cleaned up is left to the cleanup of the task
+	assert.Equal(t, resourcestatus.ResourceCreated, volume.GetKnownStatus())
+	assert.Equal(t, resourcestatus.ResourceRemoved, cgroup.GetKnownStatus())
+	require.Len(t, *events, 2)
+	assert.Equal(t, "volume", (*events)[0].ResourceName)
+	assert.Equal(t, "volume is in use", (*events)[0].Reason)
+	assert.Equal(t, "cgroup", (*events)[1].ResourceName)
+	assert.Empty(t, (*events)[1].Reason)
+}
@@ -0,0 +1,118 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/taskfirewall"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const taskFirewallErrorReason = "Unable to restrict task metadata endpoint access to the task's containers"
+
+// SetTaskFirewall sets the firewall used to restrict the task metadata endpoints of
+// bridge mode tasks to the containers of the task.
+func (engine *DockerTaskEngine) SetTaskFirewall(firewall *taskfirewall.Firewall) {
+	engine.taskFirewall = firewall
+}
+
+// syncTaskFirewall installs the firewall rules of a bridge mode task for its running
+// containers. Stopped tasks are left alone, their rules are removed on task events.
+func (engine *DockerTaskEngine) syncTaskFirewall(task *apitask.Task) {
+	if engine.taskFirewall == nil || !task.IsNetworkModeBridge() || task.GetKnownStatus().Terminal() {
+		return
+	}
+	if err := engine.taskFirewall.Sync(taskFirewallRules(task)); err != nil {
+		engine.handleTaskFirewallError(task, err)
+	}
+}
+
+// removeTaskFirewall removes the firewall rules of a task.
+func (engine *DockerTaskEngine) removeTaskFirewall(task *apitask.Task) {
+	if engine.taskFirewall == nil || !task.IsNetworkModeBridge() {
+		return
+	}
+	if err := engine.taskFirewall.Remove(task.Arn); err != nil {
+		logger.Warn("Unable to remove task metadata firewall rules", logger.Fields{
+			field.TaskID: task.GetID(),
+			field.Error:  err,
+		})
+	}
+}
+
+// reconcileTaskFirewall removes the firewall rules left behind for tasks that are no
+// longer managed, and reinstalls the rules of the tasks that are. It's called when the
+// state is synchronized after an agent restart.
+func (engine *DockerTaskEngine) reconcileTaskFirewall(tasks []*apitask.Task) {
+	if engine.taskFirewall == nil {
+		return
+	}
+	var activeTasks []*apitask.Task
+	var activeTaskARNs []string
+	for _, task := range tasks {
+		if task.IsNetworkModeBridge() && !task.GetKnownStatus().Terminal() {
+			activeTasks = append(activeTasks, task)
+			activeTaskARNs = append(activeTaskARNs, task.Arn)
+		}
+	}
+	if err := engine.taskFirewall.Reconcile(activeTaskARNs); err != nil {
+		logger.Warn("Unable to remove stale task metadata firewall rules", logger.Fields{
+			field.Error: err,
+		})
+	}
+	for _, task := range activeTasks {
+		engine.syncTaskFirewall(task)
+	}
+}
+
+// handleTaskFirewallError stops the task if the task metadata firewall is strict, and
+// records the failure as a warning of the task otherwise.
+func (engine *DockerTaskEngine) handleTaskFirewallError(task *apitask.Task, err error) {
+	fields := logger.Fields{
+		field.TaskID: task.GetID(),
+		field.Error:  err,
+	}
+	if engine.cfg.TaskMetadataFirewallStrict.Enabled() && !task.GetDesiredStatus().Terminal() {
+		logger.Error("Stopping task as its task metadata firewall rules could not be installed", fields)
+		task.SetDesiredStatus(apitaskstatus.TaskStopped)
+		task.SetTerminalReason(taskFirewallErrorReason)
+		return
+	}
+	logger.Warn("Unable to install task metadata firewall rules", fields)
+	task.AddWarning(fmt.Sprintf("%s: %v", taskFirewallErrorReason, err))
+}
+
+// taskFirewallRules returns the firewall rules of a bridge mode task, which allow the
+// addresses of its running containers to reach the metadata endpoints of all of its
+// containers.
+func taskFirewallRules(task *apitask.Task) taskfirewall.TaskRules {
+	rules := taskfirewall.TaskRules{TaskARN: task.Arn}
+	for _, container := range task.Containers {
+		if endpointID := container.GetV3EndpointID(); endpointID != "" {
+			rules.EndpointIDs = append(rules.EndpointIDs, endpointID)
+		}
+		if container.GetKnownStatus() != apicontainerstatus.ContainerRunning {
+			continue
+		}
+		if ip, ok := getContainerHostIP(container.GetNetworkSettings()); ok {
+			rules.SourceIPs = append(rules.SourceIPs, ip)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,121 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/taskfirewall"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingRuleExecutor fails every iptables command.
+type failingRuleExecutor struct{}
+
+func (failingRuleExecutor) Backend() string {
+	return taskfirewall.BackendNFTables
+}
+
+func (failingRuleExecutor) Run(args ...string) (string, error) {
+	return "", errors.New("iptables: Permission denied")
+}
+
+func bridgeTaskWithContainers() *apitask.Task {
+	running := &apicontainer.Container{Name: "running", V3EndpointID: "endpoint-1"}
+	running.SetKnownStatus(apicontainerstatus.ContainerRunning)
+	running.SetNetworkSettings(&types.NetworkSettings{
+		DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "172.17.0.2"},
+	})
+	stopped := &apicontainer.Container{Name: "stopped", V3EndpointID: "endpoint-2"}
+	stopped.SetKnownStatus(apicontainerstatus.ContainerStopped)
+	stopped.SetNetworkSettings(&types.NetworkSettings{
+		DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "172.17.0.3"},
+	})
+	return &apitask.Task{
+		Arn:                 "arn:aws:ecs:us-west-2:123456789012:task/cluster/task",
+		NetworkMode:         apitask.BridgeNetworkMode,
+		Containers:          []*apicontainer.Container{running, stopped},
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+	}
+}
+
+func TestTaskFirewallRules(t *testing.T) {
+	rules := taskFirewallRules(bridgeTaskWithContainers())
+	assert.Equal(t, taskfirewall.TaskRules{
+		TaskARN:     "arn:aws:ecs:us-west-2:123456789012:task/cluster/task",
+		EndpointIDs: []string{"endpoint-1", "endpoint-2"},
+		SourceIPs:   []string{"172.17.0.2"},
+	}, rules)
+}
+
+func TestSyncTaskFirewallFailure(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		strict                config.BooleanDefaultFalse
+		expectedDesiredStatus apitaskstatus.TaskStatus
+		expectWarning         bool
+	}{
+		{
+			name:                  "recorded as a warning",
+			strict:                config.BooleanDefaultFalse{Value: config.NotSet},
+			expectedDesiredStatus: apitaskstatus.TaskRunning,
+			expectWarning:         true,
+		},
+		{
+			name:                  "task stopped when strict",
+			strict:                config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled},
+			expectedDesiredStatus: apitaskstatus.TaskStopped,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := &DockerTaskEngine{cfg: &config.Config{TaskMetadataFirewallStrict: tc.strict}}
+			engine.SetTaskFirewall(taskfirewall.NewFirewall(failingRuleExecutor{}, 51679))
+			task := bridgeTaskWithContainers()
+
+			engine.syncTaskFirewall(task)
+			assert.Equal(t, tc.expectedDesiredStatus, task.GetDesiredStatus())
+			if tc.expectWarning {
+				assert.Len(t, task.GetWarnings(), 1)
+				assert.Contains(t, task.GetWarnings()[0], taskFirewallErrorReason)
+				assert.Empty(t, task.GetTerminalReason())
+			} else {
+				assert.Empty(t, task.GetWarnings())
+				assert.Equal(t, taskFirewallErrorReason, task.GetTerminalReason())
+			}
+		})
+	}
+}
+
+func TestSyncTaskFirewallSkipsOtherNetworkModes(t *testing.T) {
+	engine := &DockerTaskEngine{cfg: &config.Config{}}
+	engine.SetTaskFirewall(taskfirewall.NewFirewall(failingRuleExecutor{}, 51679))
+	task := bridgeTaskWithContainers()
+	task.NetworkMode = apitask.HostNetworkMode
+
+	engine.syncTaskFirewall(task)
+	engine.removeTaskFirewall(task)
+	assert.Empty(t, task.GetWarnings())
+}
@@ -162,6 +162,10 @@ type managedTask struct {
 	// verification logic gets executed to set it to a low interval
 	steadyStatePollInterval       time.Duration
 	steadyStatePollIntervalJitter time.Duration
+
+	// provisionedResources are the resources of the task that were created, in the order
+	// of their creation, which are rolled back if another resource fails to be created
+	provisionedResources []taskresource.TaskResource
 }
 
 // newManagedTask is a method on DockerTaskEngine to create a new managedTask.
@@ -187,7 +191,7 @@ func (engine *DockerTaskEngine) newManagedTask(task *apitask.Task) *managedTask
 		steadyStatePollInterval:       engine.taskSteadyStatePollInterval,
 		steadyStatePollIntervalJitter: engine.taskSteadyStatePollIntervalJitter,
 	}
-	engine.managedTasks[task.Arn] = t
+	engine.managedTasks.set(task.Arn, t)
 	return t
 }
 
@@ -478,6 +482,8 @@ func (mtask *managedTask) handleContainerChange(containerChange dockerContainerC
 	}
 
 	mtask.RecordExecutionStoppedAt(container)
+	// Container addresses change as containers start and stop
+	mtask.engine.syncTaskFirewall(mtask.Task)
 	logger.Debug("Sending container change event to tcs", eventLogFields)
 	err := mtask.containerChangeEventStream.WriteToEventStream(event)
 	if err != nil {
@@ -538,6 +544,9 @@ func (mtask *managedTask) handleResourceStateChange(resChange resourceStateChang
 	// This follows how container state change is handled.
 	res.SetKnownStatus(status)
 	if err == nil {
+		if status == res.SteadyState() {
+			mtask.provisionedResources = append(mtask.provisionedResources, res)
+		}
 		return
 	}
 
@@ -554,6 +563,7 @@ func (mtask *managedTask) handleResourceStateChange(resChange resourceStateChang
 		})
 		mtask.SetDesiredStatus(apitaskstatus.TaskStopped)
 		mtask.Task.SetTerminalReason(res.GetTerminalReason())
+		mtask.rollbackResources()
 	}
 }
 
@@ -596,6 +606,8 @@ func (mtask *managedTask) emitTaskEvent(task *apitask.Task, reason string) {
 		if err != nil {
 			logger.Critical("Failed to release resources after tast stopped", logger.Fields{field.TaskARN: mtask.Arn})
 		}
+		mtask.engine.removeTaskFirewall(task)
+		mtask.engine.taskStoppedWhileDraining()
 	}
 	if !taskKnownStatus.BackendRecognized() {
 		logger.Debug("Skipping event emission for task", logger.Fields{
@@ -1096,9 +1108,13 @@ func (mtask *managedTask) startContainerTransitions(transitionFunc containerTran
 			reasons = append(reasons, transition.reason)
 			if transition.blockedOn != nil {
 				blocked[cont.Name] = *transition.blockedOn
+				cont.SetWaitingFor(dependencygraph.UnresolvedContainerOrderingDependencies(cont, mtask.Containers, mtask.cfg))
+			} else {
+				cont.SetWaitingFor(nil)
 			}
 			continue
 		}
+		cont.SetWaitingFor(nil)
 
 		// If the container is already in a transition, skip
 		if transition.actionRequired && !cont.SetAppliedStatus(transition.nextState) {
@@ -1199,11 +1215,11 @@ func (mtask *managedTask) startResourceTransitions(transitionFunc resourceTransi
 	return anyCanTransition, transitions
 }
 
-// transitionResource calls applyResourceState, and then notifies the managed
+// transitionResource calls applyResourceStateWithRetry, and then notifies the managed
 // task of the change. transitionResource is called by progressTask
 func (mtask *managedTask) transitionResource(resource taskresource.TaskResource,
 	to resourcestatus.ResourceStatus) {
-	err := mtask.applyResourceState(resource, to)
+	err := mtask.applyResourceStateWithRetry(resource, to)
 
 	if mtask.engine.isTaskManaged(mtask.Arn) {
 		mtask.emitResourceChange(resourceStateChange{
@@ -53,6 +53,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/ecs-agent/eventstream"
 	mock_ttime "github.com/aws/amazon-ecs-agent/ecs-agent/utils/ttime/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/golang/mock/gomock"
 )
@@ -810,6 +811,122 @@ func TestStartContainerTransitionsWithTerminalError(t *testing.T) {
 	assert.Equal(t, 143, *stoppedMessages[thirdContainerName].event.DockerContainerMetadata.ExitCode)
 }
 
+func TestStartContainerTransitionsSetsWaitingFor(t *testing.T) {
+	dependencyName := "dependency"
+	dependency := &apicontainer.Container{
+		KnownStatusUnsafe:   apicontainerstatus.ContainerRunning,
+		DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+		HealthCheckType:     apicontainer.DockerHealthCheckType,
+		Name:                dependencyName,
+	}
+	dependentName := "dependent"
+	dependsOn := apicontainer.DependsOn{
+		ContainerName: dependencyName,
+		Condition:     "HEALTHY",
+	}
+	dependent := &apicontainer.Container{
+		KnownStatusUnsafe:   apicontainerstatus.ContainerPulled,
+		DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+		Name:                dependentName,
+		DependsOnUnsafe:     []apicontainer.DependsOn{dependsOn},
+	}
+	task := &managedTask{
+		Task: &apitask.Task{
+			Containers: []*apicontainer.Container{
+				dependency,
+				dependent,
+			},
+			DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		},
+		engine: &DockerTaskEngine{},
+		cfg:    &config.Config{},
+	}
+
+	// The dependency is not healthy yet, so the dependent container is blocked on it
+	canTransition, blocked, transitions, _ := task.startContainerTransitions(
+		func(cont *apicontainer.Container, nextStatus apicontainerstatus.ContainerStatus) {
+			t.Error("Transition function should not be called when no transitions are possible")
+		})
+	assert.False(t, canTransition)
+	assert.Empty(t, transitions)
+	assert.Equal(t, dependsOn, blocked[dependentName])
+	assert.Equal(t, []apicontainer.DependsOn{dependsOn}, dependent.GetWaitingFor())
+	assert.Empty(t, dependency.GetWaitingFor())
+
+	// Once the dependency is healthy, the dependent container is no longer waiting for it
+	dependency.SetHealthStatus(apicontainer.HealthStatus{Status: apicontainerstatus.ContainerHealthy})
+	transitionCalled := make(chan struct{}, 1)
+	canTransition, blocked, _, _ = task.startContainerTransitions(
+		func(cont *apicontainer.Container, nextStatus apicontainerstatus.ContainerStatus) {
+			assert.Equal(t, dependentName, cont.Name)
+			transitionCalled <- struct{}{}
+		})
+	assert.True(t, canTransition)
+	assert.Empty(t, blocked)
+	assert.Empty(t, dependent.GetWaitingFor())
+	select {
+	case <-transitionCalled:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for dependent container transition")
+	}
+}
+
+func TestStartContainerTransitionsStopsContainerOnDependencyTimeout(t *testing.T) {
+	dependencyName := "dependency"
+	dependency := &apicontainer.Container{
+		KnownStatusUnsafe:   apicontainerstatus.ContainerRunning,
+		DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+		HealthCheckType:     apicontainer.DockerHealthCheckType,
+		StartTimeout:        1,
+		Name:                dependencyName,
+	}
+	dependency.SetStartedAt(time.Now().Add(-time.Minute))
+	dependentName := "dependent"
+	dependent := &apicontainer.Container{
+		KnownStatusUnsafe:   apicontainerstatus.ContainerPulled,
+		DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+		Name:                dependentName,
+		DependsOnUnsafe: []apicontainer.DependsOn{
+			{
+				ContainerName: dependencyName,
+				Condition:     "HEALTHY",
+			},
+		},
+	}
+	dockerMessagesChan := make(chan dockerContainerChange)
+	task := &managedTask{
+		Task: &apitask.Task{
+			Containers: []*apicontainer.Container{
+				dependency,
+				dependent,
+			},
+			DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		},
+		engine:         &DockerTaskEngine{},
+		cfg:            &config.Config{},
+		dockerMessages: dockerMessagesChan,
+	}
+
+	canTransition, _, _, _ := task.startContainerTransitions(
+		func(cont *apicontainer.Container, nextStatus apicontainerstatus.ContainerStatus) {
+			t.Error("Transition function should not be called when no transitions are possible")
+		})
+	assert.False(t, canTransition)
+	assert.Empty(t, dependent.GetWaitingFor())
+	assert.Equal(t, apicontainerstatus.ContainerStopped, dependent.GetDesiredStatus())
+
+	select {
+	case msg := <-dockerMessagesChan:
+		assert.Equal(t, dependent, msg.container)
+		assert.Equal(t, apicontainerstatus.ContainerStopped, msg.event.Status)
+		require.Error(t, msg.event.DockerContainerMetadata.Error)
+		assert.Contains(t, msg.event.DockerContainerMetadata.Error.Error(),
+			"container ordering dependency [dependency] for target [dependent] did not reach condition HEALTHY")
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for docker messages")
+	}
+}
+
 func TestStartContainerTransitionsInvokesHandleContainerChange(t *testing.T) {
 	eventStreamName := "TESTTASKENGINE"
 
@@ -1070,8 +1187,7 @@ func TestHandleStoppedToSteadyStateTransition(t *testing.T) {
 		dockerMessages: make(chan dockerContainerChange),
 		ctx:            ctx,
 	}
-	taskEngine.managedTasks = make(map[string]*managedTask)
-	taskEngine.managedTasks["task1"] = mTask
+	taskEngine.managedTasks.set("task1", mTask)
 
 	var waitForTransitionFunctionInvocation sync.WaitGroup
 	waitForTransitionFunctionInvocation.Add(1)
@@ -1754,6 +1870,8 @@ func TestHandleContainerChangeUpdateMetadataRedundant(t *testing.T) {
 	container.HealthCheckType = "docker"
 	// Container already in RUNNING status
 	container.SetKnownStatus(apicontainerstatus.ContainerRunning)
+	// Container restarted with a new pid
+	container.SetPID(100)
 
 	timeNow := time.Now()
 	exitCode := exitcodes.ExitError
@@ -1769,6 +1887,7 @@ func TestHandleContainerChangeUpdateMetadataRedundant(t *testing.T) {
 				},
 				ExitCode:  &exitCode,
 				CreatedAt: timeNow,
+				PID:       200,
 			},
 		},
 	}
@@ -1782,6 +1901,7 @@ func TestHandleContainerChangeUpdateMetadataRedundant(t *testing.T) {
 	assert.Equal(t, exitCode, *containerExitCode)
 	containerCreateTime := container.GetCreatedAt()
 	assert.Equal(t, timeNow, containerCreateTime)
+	assert.Equal(t, 200, container.GetPID())
 }
 
 func TestWaitForResourceTransition(t *testing.T) {
@@ -2183,13 +2303,13 @@ func TestTaskWaitForHostResources(t *testing.T) {
 	// 1 vCPU available on host
 	hostResourceManager := NewHostResourceManager(getTestHostResources())
 	taskEngine := &DockerTaskEngine{
-		managedTasks:           make(map[string]*managedTask),
 		monitorQueuedTaskEvent: make(chan struct{}, 1),
 		hostResourceManager:    &hostResourceManager,
 	}
 	go taskEngine.monitorQueuedTasks(ctx)
 	// 3 tasks requesting 0.5 vCPUs each
 	tasks := []*apitask.Task{}
+	mtasks := []*managedTask{}
 	for i := 0; i < 3; i++ {
 		task := testdata.LoadTask("sleep5")
 		task.Arn = fmt.Sprintf("arn%d", i)
@@ -2200,14 +2320,15 @@ func TestTaskWaitForHostResources(t *testing.T) {
 			consumedHostResourceEvent: make(chan struct{}, 1),
 		}
 		tasks = append(tasks, task)
-		taskEngine.managedTasks[task.Arn] = mtask
+		mtasks = append(mtasks, mtask)
+		taskEngine.managedTasks.set(task.Arn, mtask)
 	}
 
 	// acquire for host resources order arn0, arn1, arn2
 	go func() {
-		taskEngine.managedTasks["arn0"].waitForHostResources()
-		taskEngine.managedTasks["arn1"].waitForHostResources()
-		taskEngine.managedTasks["arn2"].waitForHostResources()
+		mtasks[0].waitForHostResources()
+		mtasks[1].waitForHostResources()
+		mtasks[2].waitForHostResources()
 	}()
 	time.Sleep(500 * time.Millisecond)
 
@@ -2217,7 +2338,7 @@ func TestTaskWaitForHostResources(t *testing.T) {
 	assert.Equal(t, topTask.Arn, "arn2")
 
 	// Remove 1 task
-	taskResources := taskEngine.managedTasks["arn0"].ToHostResources()
+	taskResources := mtasks[0].ToHostResources()
 	taskEngine.hostResourceManager.release("arn0", taskResources)
 	taskEngine.wakeUpTaskQueueMonitor()
 
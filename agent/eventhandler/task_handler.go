@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
@@ -68,9 +69,13 @@ type TaskHandler struct {
 	lock sync.RWMutex
 
 	// dataClient is used to save changes to database, mainly to save
-	// changes of a task or container's SentStatus.
+	// changes of a task or container's SentStatus, and the task state
+	// changes that are yet to be submitted.
 	dataClient data.Client
 
+	// throttle delays state change submissions while ECS is throttling them
+	throttle *submitThrottle
+
 	// min and max drain events frequency refer to the range of
 	// time over which a call to SubmitTaskStateChange is made.
 	// The actual duration is randomly distributed between these
@@ -98,6 +103,21 @@ type taskSendableEvents struct {
 	createdAt time.Time
 	// taskARN is the task arn that the event list is associated with
 	taskARN string
+	// pendingVersion counts the snapshots of the pending task state changes of the list.
+	// It is guarded by lock.
+	pendingVersion uint64
+	// persistLock serializes saving the snapshots in the database, which is done without
+	// holding lock. persistedVersion is the version of the last snapshot that was saved,
+	// so that a snapshot never overwrites a newer one.
+	persistLock      sync.Mutex
+	persistedVersion uint64
+}
+
+// pendingTaskStateChanges is a snapshot of the task state changes of an event list that
+// are yet to be submitted.
+type pendingTaskStateChanges struct {
+	changes *api.PendingTaskStateChanges
+	version uint64
 }
 
 // NewTaskHandler returns a pointer to TaskHandler
@@ -117,12 +137,45 @@ func NewTaskHandler(ctx context.Context,
 		client:                    client,
 		minDrainEventsFrequency:   minDrainEventsFrequency,
 		maxDrainEventsFrequency:   maxDrainEventsFrequency,
+		throttle:                  newSubmitThrottle(submitThrottleDelayMin, submitThrottleDelayMax),
 	}
+	taskHandler.restorePendingTaskStateChanges()
 	go taskHandler.startDrainEventsTicker()
 
 	return taskHandler
 }
 
+// restorePendingTaskStateChanges queues up the task state changes that were not
+// submitted to ECS before the agent restarted. Changes of tasks that the engine no
+// longer knows about are dropped.
+func (handler *TaskHandler) restorePendingTaskStateChanges() {
+	pendingChanges, err := handler.dataClient.GetPendingTaskStateChanges()
+	if err != nil {
+		seelog.Errorf("TaskHandler: Failed to load pending task state changes from database: %v", err)
+		return
+	}
+
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	for _, pending := range pendingChanges {
+		task, ok := handler.state.TaskByArn(pending.TaskARN)
+		if !ok {
+			seelog.Infof("TaskHandler: Dropping pending state changes of unknown task %s", pending.TaskARN)
+			if err := handler.dataClient.DeletePendingTaskStateChanges(pending.TaskARN); err != nil {
+				seelog.Errorf("TaskHandler: Failed to delete pending state changes of task %s from database: %v",
+					pending.TaskARN, err)
+			}
+			continue
+		}
+		seelog.Infof("TaskHandler: Restoring %d pending state changes of task %s",
+			len(pending.Changes), pending.TaskARN)
+		for _, record := range pending.Changes {
+			event := newSendableTaskEvent(record.ToTaskStateChange(task))
+			handler.getTaskEventsUnsafe(event).sendChange(event, handler.client, handler)
+		}
+	}
+}
+
 // AddStateChangeEvent queues up the state change event to be sent to ECS.
 // If the event is for a container state change, it just gets added to the
 // handler.tasksToContainerStates map.
@@ -140,6 +193,21 @@ func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client
 		if !ok {
 			return errors.New("eventhandler: unable to get task event from state change event")
 		}
+		if handler.isLocalTask(event.TaskARN, event.Task) {
+			// ECS doesn't know about local tasks. The changes are recorded as sent, so that
+			// the task can be cleaned up once it's stopped.
+			if event.Task != nil {
+				updataTaskSentStatus(event.Task, event.Status, handler.dataClient)
+			}
+			for _, containerChange := range handler.tasksToContainerStates[event.TaskARN] {
+				if containerChange.Container != nil {
+					updateContainerSentStatus(containerChange.Container, containerChange.Status, handler.dataClient)
+				}
+			}
+			delete(handler.tasksToContainerStates, event.TaskARN)
+			delete(handler.tasksToManagedAgentStates, event.TaskARN)
+			return nil
+		}
 		// Task event: gather all the container and managed agent events and send them
 		// to ECS by invoking the async submitTaskEvents method from
 		// the sendable event list object
@@ -151,6 +219,12 @@ func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client
 		if !ok {
 			return errors.New("eventhandler: unable to get container event from state change event")
 		}
+		if handler.isLocalTask(event.TaskArn, nil) {
+			if event.Container != nil {
+				updateContainerSentStatus(event.Container, event.Status, handler.dataClient)
+			}
+			return nil
+		}
 		handler.batchContainerEventUnsafe(event)
 		return nil
 
@@ -159,6 +233,12 @@ func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client
 		if !ok {
 			return errors.New("eventhandler: unable to get managed agent event from state change event")
 		}
+		if handler.isLocalTask(event.TaskArn, nil) {
+			if event.Container != nil {
+				updateManagedAgentSentStatus(event.Container, event.Name, event.Status, handler.dataClient)
+			}
+			return nil
+		}
 
 		handler.batchManagedAgentEventUnsafe(event)
 		return nil
@@ -168,6 +248,15 @@ func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client
 	}
 }
 
+// isLocalTask returns true if the task of a state change was launched locally rather than
+// by ECS. The task is looked up in the state if the state change doesn't refer to it.
+func (handler *TaskHandler) isLocalTask(taskARN string, task *apitask.Task) bool {
+	if task == nil && handler.state != nil {
+		task, _ = handler.state.TaskByArn(taskARN)
+	}
+	return task != nil && task.IsLocal
+}
+
 // startDrainEventsTicker starts a ticker that periodically drains the events queue
 // by submitting state change events to the ECS backend
 func (handler *TaskHandler) startDrainEventsTicker() {
@@ -259,16 +348,21 @@ func (handler *TaskHandler) taskStateChangesToSend() []api.TaskStateChange {
 	return taskEvents
 }
 
-// batchContainerEventUnsafe collects container state change events for a given task arn
+// batchContainerEventUnsafe collects container state change events for a given task arn.
+// An event supersedes the batched event of the same container, so that only the latest
+// state of each container is submitted.
 func (handler *TaskHandler) batchContainerEventUnsafe(event api.ContainerStateChange) {
 	seelog.Debugf("TaskHandler: batching container event: %s", event.String())
-	handler.tasksToContainerStates[event.TaskArn] = append(handler.tasksToContainerStates[event.TaskArn], event)
+	handler.tasksToContainerStates[event.TaskArn] = mergeContainerStateChanges(
+		handler.tasksToContainerStates[event.TaskArn], event)
 }
 
-// batchManagedAgentEventUnsafe collects managed agent state change events for a given task arn
+// batchManagedAgentEventUnsafe collects managed agent state change events for a given task arn.
+// An event supersedes the batched event of the same managed agent.
 func (handler *TaskHandler) batchManagedAgentEventUnsafe(event api.ManagedAgentStateChange) {
 	seelog.Debugf("TaskHandler: batching managed agent event: %s", event.String())
-	handler.tasksToManagedAgentStates[event.TaskArn] = append(handler.tasksToManagedAgentStates[event.TaskArn], event)
+	handler.tasksToManagedAgentStates[event.TaskArn] = mergeManagedAgentStateChanges(
+		handler.tasksToManagedAgentStates[event.TaskArn], event)
 }
 
 // flushBatchUnsafe attaches the task arn's container events to TaskStateChange event
@@ -334,6 +428,10 @@ func (handler *TaskHandler) submitTaskEvents(taskEvents *taskSendableEvents, cli
 		// we haven't emptied the list so we should keep submitting
 		backoff.Reset()
 		retry.RetryWithBackoff(backoff, func() error {
+			// Hold off while ECS is throttling submissions. Events added to the list
+			// in the meantime are coalesced with the pending ones
+			handler.throttle.wait(handler.ctx)
+
 			// Lock and unlock within this function, allowing the list to be added
 			// to while we're not actively sending an event
 			seelog.Debug("TaskHandler: Waiting on semaphore to send events...")
@@ -342,6 +440,7 @@ func (handler *TaskHandler) submitTaskEvents(taskEvents *taskSendableEvents, cli
 
 			var err error
 			done, err = taskEvents.submitFirstEvent(handler, backoff)
+			handler.throttle.record(err)
 			return err
 		})
 	}
@@ -362,11 +461,22 @@ func (taskEvents *taskSendableEvents) sendChange(change *sendableEvent,
 	handler *TaskHandler) {
 
 	taskEvents.lock.Lock()
-	defer taskEvents.lock.Unlock()
-
-	// Add event to the queue
-	logger.Debug("TaskHandler: Adding event", change.toFields())
-	taskEvents.events.PushBack(change)
+	var pending *pendingTaskStateChanges
+	defer func() {
+		taskEvents.lock.Unlock()
+		// The database is written to without holding the lock of the list
+		taskEvents.persist(pending, handler.dataClient)
+	}()
+
+	// Add event to the queue, unless it can be submitted along with the last
+	// pending event
+	if last := taskEvents.events.Back(); last != nil && last.Value.(*sendableEvent).coalesce(change) {
+		logger.Debug("TaskHandler: Coalesced event with pending event", change.toFields())
+	} else {
+		logger.Debug("TaskHandler: Adding event", change.toFields())
+		taskEvents.events.PushBack(change)
+	}
+	pending = taskEvents.pendingTaskStateChangesUnsafe()
 
 	if !taskEvents.sending {
 		// If a send event is not already in progress, trigger the
@@ -387,11 +497,22 @@ func (taskEvents *taskSendableEvents) sendChange(change *sendableEvent,
 // state change submission for the first event
 func (taskEvents *taskSendableEvents) submitFirstEvent(handler *TaskHandler, backoff retry.Backoff) (bool, error) {
 	seelog.Debug("TaskHandler: Acquiring lock for sending event...")
+	var pending *pendingTaskStateChanges
+	// The database is written to once the lock of the list is released
+	defer func() { taskEvents.persist(pending, handler.dataClient) }()
 	taskEvents.lock.Lock()
 	defer taskEvents.lock.Unlock()
 
 	seelog.Debugf("TaskHandler: Acquired lock, processing event list: : %s", taskEvents.toStringUnsafe())
 
+	// Keep the pending changes in the database in sync with the list
+	pendingEvents := taskEvents.events.Len()
+	defer func() {
+		if taskEvents.events.Len() != pendingEvents {
+			pending = taskEvents.pendingTaskStateChangesUnsafe()
+		}
+	}()
+
 	if taskEvents.events.Len() == 0 {
 		seelog.Debug("TaskHandler: No events left; not retrying more")
 		taskEvents.sending = false
@@ -434,6 +555,47 @@ func (taskEvents *taskSendableEvents) submitFirstEvent(handler *TaskHandler, bac
 	return false, nil
 }
 
+// pendingTaskStateChangesUnsafe returns a snapshot of the task state changes in the
+// list that are yet to be submitted, to be saved with persist. Attachment events are
+// not saved, as attachments are acknowledged again on restart.
+func (taskEvents *taskSendableEvents) pendingTaskStateChangesUnsafe() *pendingTaskStateChanges {
+	changes := &api.PendingTaskStateChanges{TaskARN: taskEvents.taskARN}
+	for element := taskEvents.events.Front(); element != nil; element = element.Next() {
+		event := element.Value.(*sendableEvent)
+		if change, ok := event.pendingTaskStateChange(); ok {
+			changes.Changes = append(changes.Changes, api.NewTaskStateChangeRecord(change))
+		}
+	}
+	taskEvents.pendingVersion++
+	return &pendingTaskStateChanges{changes: changes, version: taskEvents.pendingVersion}
+}
+
+// persist saves a snapshot of the pending task state changes, so that they are
+// submitted after an agent restart. Snapshots that are older than the last saved one
+// are skipped. It must be called without holding the lock of the list.
+func (taskEvents *taskSendableEvents) persist(pending *pendingTaskStateChanges, dataClient data.Client) {
+	if pending == nil {
+		return
+	}
+	taskEvents.persistLock.Lock()
+	defer taskEvents.persistLock.Unlock()
+	if pending.version <= taskEvents.persistedVersion {
+		return
+	}
+	taskEvents.persistedVersion = pending.version
+
+	var err error
+	if len(pending.changes.Changes) == 0 {
+		err = dataClient.DeletePendingTaskStateChanges(taskEvents.taskARN)
+	} else {
+		err = dataClient.SavePendingTaskStateChanges(pending.changes)
+	}
+	if err != nil {
+		seelog.Errorf("TaskHandler: Failed to save pending state changes of task %s in database: %v",
+			taskEvents.taskARN, err)
+	}
+}
+
 func (taskEvents *taskSendableEvents) toStringUnsafe() string {
 	return fmt.Sprintf("Task event list [taskARN: %s, sending: %t, createdAt: %s]",
 		taskEvents.taskARN, taskEvents.sending, taskEvents.createdAt.String())
@@ -45,6 +45,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const taskARN = "taskarn"
@@ -347,6 +348,39 @@ func getTasksToEventsLen(handler *TaskHandler) int {
 	return len(handler.tasksToEvents)
 }
 
+// TestLocalTaskEventsAreNotSubmitted tests that the state changes of local tasks are
+// recorded as sent without being submitted to ECS
+func TestLocalTaskEventsAreNotSubmitted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// No state changes are expected to be submitted
+	client := mock_api.NewMockECSClient(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	state := dockerstate.NewTaskEngineState()
+	localTask := &apitask.Task{Arn: taskARN, IsLocal: true}
+	state.AddTask(localTask)
+	handler := NewTaskHandler(ctx, data.NewNoopClient(), state, client)
+
+	contEvent := containerEvent(taskARN)
+	require.NoError(t, handler.AddStateChangeEvent(contEvent, client))
+	require.NoError(t, handler.AddStateChangeEvent(managedAgentEvent(taskARN), client))
+	require.NoError(t, handler.AddStateChangeEvent(api.TaskStateChange{
+		TaskARN: taskARN,
+		Status:  apitaskstatus.TaskRunning,
+		Task:    localTask,
+	}, client))
+
+	assert.Equal(t, apitaskstatus.TaskRunning, localTask.GetSentStatus())
+	assert.Equal(t, apicontainerstatus.ContainerRunning, contEvent.(api.ContainerStateChange).Container.GetSentStatus())
+	handler.lock.RLock()
+	defer handler.lock.RUnlock()
+	assert.Empty(t, handler.tasksToContainerStates)
+	assert.Empty(t, handler.tasksToManagedAgentStates)
+	assert.Empty(t, handler.tasksToEvents)
+}
+
 func containerEvent(arn string) statechange.Event {
 	return api.ContainerStateChange{TaskArn: arn, ContainerName: "containerName", Status: apicontainerstatus.ContainerRunning, Container: &apicontainer.Container{}}
 }
@@ -709,3 +743,166 @@ func TestGetBatchedManagedAgentEventsStoppedTask(t *testing.T) {
 	events := handler.taskStateChangesToSend()
 	assert.Len(t, events, 0)
 }
+
+func TestTaskStateChangesCoalescedWhileThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_api.NewMockECSClient(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := NewTaskHandler(ctx, data.NewNoopClient(), dockerstate.NewTaskEngineState(), client)
+	defer cancel()
+
+	task := &apitask.Task{Arn: taskARN}
+	container := &apicontainer.Container{Name: "c1"}
+	throttled := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	gomock.InOrder(
+		client.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+			require.Len(t, change.Containers, 1)
+			assert.Equal(t, apicontainerstatus.ContainerRunning, change.Containers[0].Status)
+			close(throttled)
+		}).Return(awserr.New(throttlingExceptionCode, "Rate exceeded", nil)),
+		// Changes added while backing off are submitted together
+		client.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+			assert.Equal(t, apitaskstatus.TaskRunning, change.Status)
+			require.Len(t, change.Containers, 1)
+			assert.Equal(t, apicontainerstatus.ContainerStopped, change.Containers[0].Status)
+			wg.Done()
+		}).Return(nil),
+	)
+
+	handler.AddStateChangeEvent(api.ContainerStateChange{TaskArn: taskARN, ContainerName: "c1",
+		Status: apicontainerstatus.ContainerRunning, Container: container}, client)
+	handler.AddStateChangeEvent(api.TaskStateChange{TaskARN: taskARN, Status: apitaskstatus.TaskRunning, Task: task}, client)
+	<-throttled
+	assert.Equal(t, submitThrottleDelayMin, handler.throttle.currentDelay())
+
+	handler.AddStateChangeEvent(api.ContainerStateChange{TaskArn: taskARN, ContainerName: "c1",
+		Status: apicontainerstatus.ContainerStopped, Container: container}, client)
+	handler.AddStateChangeEvent(api.TaskStateChange{TaskARN: taskARN, Status: apitaskstatus.TaskRunning, Task: task}, client)
+
+	wg.Wait()
+	assert.Equal(t, time.Duration(0), handler.throttle.currentDelay())
+}
+
+func TestTerminalTaskStateChangeNotCoalescedWhileThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_api.NewMockECSClient(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := NewTaskHandler(ctx, data.NewNoopClient(), dockerstate.NewTaskEngineState(), client)
+	defer cancel()
+
+	task := &apitask.Task{Arn: taskARN}
+	throttled := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	gomock.InOrder(
+		client.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+			close(throttled)
+		}).Return(awserr.New(throttlingExceptionCode, "Rate exceeded", nil)),
+		client.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+			assert.Equal(t, apitaskstatus.TaskRunning, change.Status)
+		}).Return(nil),
+		client.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+			assert.Equal(t, apitaskstatus.TaskStopped, change.Status)
+			wg.Done()
+		}).Return(nil),
+	)
+
+	handler.AddStateChangeEvent(api.TaskStateChange{TaskARN: taskARN, Status: apitaskstatus.TaskRunning, Task: task}, client)
+	<-throttled
+	handler.AddStateChangeEvent(api.TaskStateChange{TaskARN: taskARN, Status: apitaskstatus.TaskStopped, Task: task}, client)
+
+	wg.Wait()
+}
+
+func TestPendingTaskStateChangesRestoredAfterRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataClient := newTestDataClient(t)
+
+	task := &apitask.Task{
+		Arn:        taskARN,
+		Containers: []*apicontainer.Container{{Name: "c1"}},
+	}
+	state := dockerstate.NewTaskEngineState()
+	state.AddTask(task)
+
+	// Changes of tasks that are gone by the time the agent restarts are dropped
+	require.NoError(t, dataClient.SavePendingTaskStateChanges(&api.PendingTaskStateChanges{
+		TaskARN: "unknownTaskARN",
+		Changes: []api.TaskStateChangeRecord{{Status: apitaskstatus.TaskRunning}},
+	}))
+
+	// The agent goes away while the submission is throttled, leaving the change queued
+	throttledClient := mock_api.NewMockECSClient(ctrl)
+	throttled := make(chan struct{})
+	throttledClient.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(api.TaskStateChange) {
+		close(throttled)
+		select {}
+	}).Return(awserr.New(throttlingExceptionCode, "Rate exceeded", nil))
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	handler := NewTaskHandler(ctx1, dataClient, state, throttledClient)
+	handler.AddStateChangeEvent(api.ContainerStateChange{TaskArn: taskARN, ContainerName: "c1",
+		Status: apicontainerstatus.ContainerRunning, Container: task.Containers[0]}, throttledClient)
+	handler.AddStateChangeEvent(api.TaskStateChange{TaskARN: taskARN, Status: apitaskstatus.TaskRunning, Task: task},
+		throttledClient)
+	<-throttled
+	cancel1()
+
+	pending, err := dataClient.GetPendingTaskStateChanges()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, taskARN, pending[0].TaskARN)
+
+	// The restarted agent submits the queued change and clears it from the database
+	client := mock_api.NewMockECSClient(ctrl)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	client.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+		assert.Equal(t, taskARN, change.TaskARN)
+		assert.Equal(t, apitaskstatus.TaskRunning, change.Status)
+		assert.Equal(t, task, change.Task)
+		require.Len(t, change.Containers, 1)
+		assert.Equal(t, apicontainerstatus.ContainerRunning, change.Containers[0].Status)
+		assert.Equal(t, task.Containers[0], change.Containers[0].Container)
+		wg.Done()
+	}).Return(nil)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	NewTaskHandler(ctx2, dataClient, state, client)
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		pending, err := dataClient.GetPendingTaskStateChanges()
+		return err == nil && len(pending) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, apitaskstatus.TaskRunning, task.GetSentStatus())
+}
+
+// Tests that a snapshot of the pending task state changes that is saved after a newer one
+// doesn't overwrite it, since snapshots are saved without holding the lock of the list.
+func TestPendingTaskStateChangesStaleSnapshotSkipped(t *testing.T) {
+	dataClient := newTestDataClient(t)
+	task := &apitask.Task{Arn: taskARN}
+	taskEvents := &taskSendableEvents{events: list.New(), taskARN: taskARN}
+	taskEvents.events.PushBack(newSendableTaskEvent(api.TaskStateChange{TaskARN: taskARN,
+		Status: apitaskstatus.TaskRunning, Task: task}))
+	stale := taskEvents.pendingTaskStateChangesUnsafe()
+	taskEvents.events.Init()
+	latest := taskEvents.pendingTaskStateChangesUnsafe()
+
+	taskEvents.persist(latest, dataClient)
+	taskEvents.persist(stale, dataClient)
+	pending, err := dataClient.GetPendingTaskStateChanges()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -129,6 +129,105 @@ func (event *sendableEvent) containerShouldBeSent() bool {
 	return true
 }
 
+// coalesce merges the task state change of 'change' into the event, if the event is
+// still to be sent and both can go out in a single submission. Task state changes are
+// not coalesced across the terminal boundary, so that a terminal task state is never
+// submitted before the non-terminal states that preceded it.
+func (event *sendableEvent) coalesce(change *sendableEvent) bool {
+	if event == change || event.isContainerEvent || change.isContainerEvent {
+		return false
+	}
+
+	event.lock.Lock()
+	defer event.lock.Unlock()
+	change.lock.RLock()
+	defer change.lock.RUnlock()
+
+	pending := event.taskChange
+	next := change.taskChange
+	if event.taskSent || pending.Task == nil || pending.Task != next.Task ||
+		pending.Attachment != nil || next.Attachment != nil {
+		return false
+	}
+	if pending.Status > next.Status || (next.Status.Terminal() && !pending.Status.Terminal()) {
+		return false
+	}
+
+	pending.Status = next.Status
+	if next.Reason != "" {
+		pending.Reason = next.Reason
+	}
+	for _, containerChange := range next.Containers {
+		pending.Containers = mergeContainerStateChanges(pending.Containers, containerChange)
+	}
+	for _, managedAgentChange := range next.ManagedAgents {
+		pending.ManagedAgents = mergeManagedAgentStateChanges(pending.ManagedAgents, managedAgentChange)
+	}
+	if next.PullStartedAt != nil {
+		pending.PullStartedAt = next.PullStartedAt
+	}
+	if next.PullStoppedAt != nil {
+		pending.PullStoppedAt = next.PullStoppedAt
+	}
+	if next.ExecutionStoppedAt != nil {
+		pending.ExecutionStoppedAt = next.ExecutionStoppedAt
+	}
+	event.taskChange = pending
+	return true
+}
+
+// pendingTaskStateChange returns the task state change of the event if it is yet to
+// be sent. Container and attachment events are not task state changes.
+func (event *sendableEvent) pendingTaskStateChange() (api.TaskStateChange, bool) {
+	event.lock.RLock()
+	defer event.lock.RUnlock()
+
+	if event.isContainerEvent || event.taskSent || event.taskChange.Task == nil ||
+		event.taskChange.Attachment != nil {
+		return api.TaskStateChange{}, false
+	}
+	return event.taskChange, true
+}
+
+// mergeContainerStateChanges adds the container state change to the list. It replaces
+// the change of the same container in the list, unless that one is further along, in
+// which case the change arrived out of order and is dropped.
+func mergeContainerStateChanges(changes []api.ContainerStateChange,
+	change api.ContainerStateChange) []api.ContainerStateChange {
+	for i, existing := range changes {
+		if !sameContainer(existing.Container, existing.ContainerName, change.Container, change.ContainerName) {
+			continue
+		}
+		if existing.Status <= change.Status {
+			changes[i] = change
+		}
+		return changes
+	}
+	return append(changes, change)
+}
+
+// mergeManagedAgentStateChanges adds the managed agent state change to the list,
+// replacing the change of the same managed agent in the list.
+func mergeManagedAgentStateChanges(changes []api.ManagedAgentStateChange,
+	change api.ManagedAgentStateChange) []api.ManagedAgentStateChange {
+	for i, existing := range changes {
+		if existing.Name == change.Name && existing.Container == change.Container {
+			changes[i] = change
+			return changes
+		}
+	}
+	return append(changes, change)
+}
+
+// sameContainer checks whether two state changes are for the same container. Changes
+// are matched on the container they hold, falling back to the container name.
+func sameContainer(a *apicontainer.Container, aName string, b *apicontainer.Container, bName string) bool {
+	if a != nil && b != nil {
+		return a == b
+	}
+	return aName == bName
+}
+
 func (event *sendableEvent) setSent() {
 	event.lock.Lock()
 	defer event.lock.Unlock()
@@ -489,3 +489,141 @@ func newTestDataClient(t *testing.T) data.Client {
 	})
 	return testClient
 }
+
+func TestSendableEventCoalesce(t *testing.T) {
+	task := &apitask.Task{Arn: testTaskARN}
+	container1 := &apicontainer.Container{Name: "c1"}
+	container2 := &apicontainer.Container{Name: "c2"}
+	exitCode := 1
+
+	for _, tc := range []struct {
+		name      string
+		pending   api.TaskStateChange
+		taskSent  bool
+		next      api.TaskStateChange
+		coalesced bool
+	}{
+		{
+			name:      "same status",
+			pending:   api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			next:      api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			coalesced: true,
+		},
+		{
+			name:      "later non-terminal status",
+			pending:   api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskCreated, Task: task},
+			next:      api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			coalesced: true,
+		},
+		{
+			name:      "terminal after non-terminal",
+			pending:   api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			next:      api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskStopped, Task: task},
+			coalesced: false,
+		},
+		{
+			name:      "earlier status",
+			pending:   api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskStopped, Task: task},
+			next:      api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			coalesced: false,
+		},
+		{
+			name:      "pending already sent",
+			pending:   api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			taskSent:  true,
+			next:      api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			coalesced: false,
+		},
+		{
+			name:      "different task",
+			pending:   api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			next:      api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: &apitask.Task{}},
+			coalesced: false,
+		},
+		{
+			name:    "attachment",
+			pending: api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning, Task: task},
+			next: api.TaskStateChange{TaskARN: testTaskARN, Task: task,
+				Attachment: &apieni.ENIAttachment{AttachmentInfo: attachmentinfo.AttachmentInfo{AttachmentARN: testAttachmentARN}}},
+			coalesced: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			event := newSendableTaskEvent(tc.pending)
+			event.taskSent = tc.taskSent
+			assert.Equal(t, tc.coalesced, event.coalesce(newSendableTaskEvent(tc.next)))
+		})
+	}
+
+	t.Run("merges changes", func(t *testing.T) {
+		pullStartedAt := time.Now()
+		executionStoppedAt := pullStartedAt.Add(time.Minute)
+		event := newSendableTaskEvent(api.TaskStateChange{
+			TaskARN: testTaskARN,
+			Status:  apitaskstatus.TaskRunning,
+			Reason:  "first",
+			Task:    task,
+			Containers: []api.ContainerStateChange{
+				{ContainerName: "c1", Container: container1, Status: apicontainerstatus.ContainerRunning},
+				{ContainerName: "c2", Container: container2, Status: apicontainerstatus.ContainerRunning},
+			},
+			ManagedAgents: []api.ManagedAgentStateChange{
+				{Name: "ExecAgent", Container: container1, Status: apicontainerstatus.ManagedAgentRunning},
+			},
+			PullStartedAt: &pullStartedAt,
+		})
+		require.True(t, event.coalesce(newSendableTaskEvent(api.TaskStateChange{
+			TaskARN: testTaskARN,
+			Status:  apitaskstatus.TaskRunning,
+			Task:    task,
+			Containers: []api.ContainerStateChange{
+				{ContainerName: "c1", Container: container1, Status: apicontainerstatus.ContainerStopped, ExitCode: &exitCode},
+			},
+			ManagedAgents: []api.ManagedAgentStateChange{
+				{Name: "ExecAgent", Container: container1, Status: apicontainerstatus.ManagedAgentStopped},
+			},
+			ExecutionStoppedAt: &executionStoppedAt,
+		})))
+
+		change := event.taskChange
+		assert.Equal(t, apitaskstatus.TaskRunning, change.Status)
+		assert.Equal(t, "first", change.Reason)
+		require.Len(t, change.Containers, 2)
+		assert.Equal(t, apicontainerstatus.ContainerStopped, change.Containers[0].Status)
+		assert.Equal(t, &exitCode, change.Containers[0].ExitCode)
+		assert.Equal(t, apicontainerstatus.ContainerRunning, change.Containers[1].Status)
+		require.Len(t, change.ManagedAgents, 1)
+		assert.Equal(t, apicontainerstatus.ManagedAgentStopped, change.ManagedAgents[0].Status)
+		assert.Equal(t, &pullStartedAt, change.PullStartedAt)
+		assert.Equal(t, &executionStoppedAt, change.ExecutionStoppedAt)
+	})
+}
+
+func TestMergeContainerStateChanges(t *testing.T) {
+	container := &apicontainer.Container{Name: "c1"}
+	running := api.ContainerStateChange{ContainerName: "c1", Container: container, Status: apicontainerstatus.ContainerRunning}
+	stopped := api.ContainerStateChange{ContainerName: "c1", Container: container, Status: apicontainerstatus.ContainerStopped}
+
+	// A later state supersedes the batched one
+	changes := mergeContainerStateChanges([]api.ContainerStateChange{running}, stopped)
+	require.Len(t, changes, 1)
+	assert.Equal(t, apicontainerstatus.ContainerStopped, changes[0].Status)
+
+	// Changes of other containers are kept
+	other := api.ContainerStateChange{ContainerName: "c1", Container: &apicontainer.Container{Name: "c1"},
+		Status: apicontainerstatus.ContainerRunning}
+	changes = mergeContainerStateChanges(changes, other)
+	assert.Len(t, changes, 2)
+}
+
+// Tests that a container state change that arrives after a later state of the container
+// was batched is dropped, instead of being added next to it.
+func TestMergeContainerStateChangesOutOfOrder(t *testing.T) {
+	container := &apicontainer.Container{Name: "c1"}
+	running := api.ContainerStateChange{ContainerName: "c1", Container: container, Status: apicontainerstatus.ContainerRunning}
+	stopped := api.ContainerStateChange{ContainerName: "c1", Container: container, Status: apicontainerstatus.ContainerStopped}
+
+	changes := mergeContainerStateChanges([]api.ContainerStateChange{stopped}, running)
+	require.Len(t, changes, 1)
+	assert.Equal(t, apicontainerstatus.ContainerStopped, changes[0].Status)
+}
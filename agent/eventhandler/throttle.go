@@ -0,0 +1,92 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+)
+
+const (
+	// throttlingExceptionCode is the error code ECS returns when state change
+	// submissions are being throttled
+	throttlingExceptionCode = "ThrottlingException"
+
+	submitThrottleDelayMin = 500 * time.Millisecond
+	submitThrottleDelayMax = 30 * time.Second
+)
+
+// submitThrottle adapts the delay between state change submissions to throttling
+// errors from ECS. The delay is shared by all the tasks, as throttling applies to the
+// container instance as a whole rather than to a single task. It doubles on every
+// throttling error and halves on every other outcome until it drops back to zero.
+type submitThrottle struct {
+	delay    time.Duration
+	minDelay time.Duration
+	maxDelay time.Duration
+	lock     sync.Mutex
+}
+
+func newSubmitThrottle(minDelay, maxDelay time.Duration) *submitThrottle {
+	return &submitThrottle{
+		minDelay: minDelay,
+		maxDelay: maxDelay,
+	}
+}
+
+// record adjusts the delay based on the outcome of a submission
+func (throttle *submitThrottle) record(err error) {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	if utils.IsAWSErrorCodeEqual(err, throttlingExceptionCode) {
+		throttle.delay *= 2
+		if throttle.delay < throttle.minDelay {
+			throttle.delay = throttle.minDelay
+		}
+		if throttle.delay > throttle.maxDelay {
+			throttle.delay = throttle.maxDelay
+		}
+		return
+	}
+	throttle.delay /= 2
+	if throttle.delay < throttle.minDelay {
+		throttle.delay = 0
+	}
+}
+
+// currentDelay returns how long submissions are delayed for
+func (throttle *submitThrottle) currentDelay() time.Duration {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	return throttle.delay
+}
+
+// wait blocks for the current delay, or until the context is cancelled
+func (throttle *submitThrottle) wait(ctx context.Context) {
+	delay := throttle.currentDelay()
+	if delay == 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,64 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmitThrottle(t *testing.T) {
+	throttle := newSubmitThrottle(time.Second, 5*time.Second)
+	throttlingErr := awserr.New(throttlingExceptionCode, "Rate exceeded", nil)
+
+	// Delay doubles from the minimum up to the maximum on throttling errors
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		throttle.record(throttlingErr)
+		assert.Equal(t, expected, throttle.currentDelay())
+	}
+
+	// Other errors and successes halve it until it drops back to zero
+	throttle.record(errors.New("other error"))
+	assert.Equal(t, 2500*time.Millisecond, throttle.currentDelay())
+	throttle.record(nil)
+	assert.Equal(t, 1250*time.Millisecond, throttle.currentDelay())
+	throttle.record(nil)
+	assert.Equal(t, time.Duration(0), throttle.currentDelay())
+}
+
+func TestSubmitThrottleWaitCancelled(t *testing.T) {
+	throttle := newSubmitThrottle(time.Minute, time.Minute)
+	throttle.record(awserr.New(throttlingExceptionCode, "Rate exceeded", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	waited := make(chan struct{})
+	go func() {
+		throttle.wait(ctx)
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not return after the context was cancelled")
+	}
+}
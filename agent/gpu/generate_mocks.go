@@ -16,4 +16,4 @@
 
 package gpu
 
-//go:generate mockgen -destination=mocks/gpu_manager_mocks.go -copyright_file=../../scripts/copyright_file github.com/aws/amazon-ecs-agent/agent/gpu GPUManager
+//go:generate mockgen -destination=mocks/gpu_manager_mocks.go -copyright_file=../../scripts/copyright_file github.com/aws/amazon-ecs-agent/agent/gpu GPUManager,RuntimeProber
@@ -13,14 +13,16 @@
 //
 
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/aws/amazon-ecs-agent/agent/gpu (interfaces: GPUManager)
+// Source: github.com/aws/amazon-ecs-agent/agent/gpu (interfaces: GPUManager,RuntimeProber)
 
 // Package mock_gpu is a generated GoMock package.
 package mock_gpu
 
 import (
+	context "context"
 	reflect "reflect"
 
+	gpu "github.com/aws/amazon-ecs-agent/agent/gpu"
 	ecs "github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -139,3 +141,41 @@ func (mr *MockGPUManagerMockRecorder) SetGPUIDs(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGPUIDs", reflect.TypeOf((*MockGPUManager)(nil).SetGPUIDs), arg0)
 }
+
+// MockRuntimeProber is a mock of RuntimeProber interface.
+type MockRuntimeProber struct {
+	ctrl     *gomock.Controller
+	recorder *MockRuntimeProberMockRecorder
+}
+
+// MockRuntimeProberMockRecorder is the mock recorder for MockRuntimeProber.
+type MockRuntimeProberMockRecorder struct {
+	mock *MockRuntimeProber
+}
+
+// NewMockRuntimeProber creates a new mock instance.
+func NewMockRuntimeProber(ctrl *gomock.Controller) *MockRuntimeProber {
+	mock := &MockRuntimeProber{ctrl: ctrl}
+	mock.recorder = &MockRuntimeProberMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRuntimeProber) EXPECT() *MockRuntimeProberMockRecorder {
+	return m.recorder
+}
+
+// Probe mocks base method.
+func (m *MockRuntimeProber) Probe(arg0 context.Context) (gpu.RuntimeInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Probe", arg0)
+	ret0, _ := ret[0].(gpu.RuntimeInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Probe indicates an expected call of Probe.
+func (mr *MockRuntimeProberMockRecorder) Probe(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Probe", reflect.TypeOf((*MockRuntimeProber)(nil).Probe), arg0)
+}
@@ -0,0 +1,108 @@
+//go:build linux
+// +build linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gpu
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	nvidiaSMICommand          = "nvidia-smi"
+	nvidiaContainerCLICommand = "nvidia-container-cli"
+	cliVersionPrefix          = "cli-version:"
+
+	// nvidiaProbeTimeout bounds each command run to probe the runtime, since the commands
+	// can hang when the driver is in a bad state.
+	nvidiaProbeTimeout = 30 * time.Second
+)
+
+type nvidiaRuntimeProber struct{}
+
+// NewNvidiaRuntimeProber creates a prober that gets the driver version and device count
+// of the host from nvidia-smi, and the runtime version from nvidia-container-cli.
+func NewNvidiaRuntimeProber() RuntimeProber {
+	return &nvidiaRuntimeProber{}
+}
+
+// Probe runs nvidia-smi and nvidia-container-cli to probe the runtime.
+func (p *nvidiaRuntimeProber) Probe(ctx context.Context) (RuntimeInfo, error) {
+	smiOutput, err := runProbeCommand(ctx, nvidiaSMICommand, "--query-gpu=driver_version", "--format=csv,noheader")
+	if err != nil {
+		return RuntimeInfo{}, err
+	}
+	driverVersion, deviceCount, err := parseNvidiaSMIDriverVersions(smiOutput)
+	if err != nil {
+		return RuntimeInfo{}, err
+	}
+	info := RuntimeInfo{DriverVersion: driverVersion, DeviceCount: deviceCount}
+
+	cliOutput, err := runProbeCommand(ctx, nvidiaContainerCLICommand, "--version")
+	if err != nil {
+		return info, err
+	}
+	info.RuntimeVersion, err = parseNvidiaContainerCLIVersion(cliOutput)
+	return info, err
+}
+
+func runProbeCommand(ctx context.Context, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, nvidiaProbeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "%s failed: %s", name, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// parseNvidiaSMIDriverVersions parses the driver version of each GPU listed by
+// nvidia-smi --query-gpu=driver_version --format=csv,noheader. All the GPUs of a host
+// share the driver, so their versions must match.
+func parseNvidiaSMIDriverVersions(output string) (string, int, error) {
+	var driverVersion string
+	deviceCount := 0
+	for _, line := range strings.Split(output, "\n") {
+		version := strings.TrimSpace(line)
+		if version == "" {
+			continue
+		}
+		if driverVersion != "" && version != driverVersion {
+			return "", 0, fmt.Errorf("%s reports mismatched driver versions %s and %s",
+				nvidiaSMICommand, driverVersion, version)
+		}
+		driverVersion = version
+		deviceCount++
+	}
+	return driverVersion, deviceCount, nil
+}
+
+// parseNvidiaContainerCLIVersion parses the cli-version line of nvidia-container-cli
+// --version.
+func parseNvidiaContainerCLIVersion(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, cliVersionPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, cliVersionPrefix)), nil
+		}
+	}
+	return "", fmt.Errorf("%s --version output has no cli-version", nvidiaContainerCLICommand)
+}
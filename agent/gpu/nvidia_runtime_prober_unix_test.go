@@ -0,0 +1,48 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gpu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNvidiaSMIDriverVersions(t *testing.T) {
+	driverVersion, deviceCount, err := parseNvidiaSMIDriverVersions("535.104.05\n535.104.05\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, "535.104.05", driverVersion)
+	assert.Equal(t, 2, deviceCount)
+
+	driverVersion, deviceCount, err = parseNvidiaSMIDriverVersions("")
+	require.NoError(t, err)
+	assert.Equal(t, "", driverVersion)
+	assert.Equal(t, 0, deviceCount)
+
+	_, _, err = parseNvidiaSMIDriverVersions("535.104.05\n545.23.08\n")
+	assert.EqualError(t, err, "nvidia-smi reports mismatched driver versions 535.104.05 and 545.23.08")
+}
+
+func TestParseNvidiaContainerCLIVersion(t *testing.T) {
+	version, err := parseNvidiaContainerCLIVersion("cli-version: 1.14.3\nlib-version: 1.14.3\nbuild date: 2023-10-19T11:32+00:00\n")
+	require.NoError(t, err)
+	assert.Equal(t, "1.14.3", version)
+
+	_, err = parseNvidiaContainerCLIVersion("unknown flag: --version\n")
+	assert.Error(t, err)
+}
@@ -0,0 +1,204 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gpu
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+// RuntimeInfo is what a probe of the GPU runtime of the host found.
+type RuntimeInfo struct {
+	// RuntimeVersion is the version of the container runtime that exposes GPUs to containers
+	RuntimeVersion string `json:"RuntimeVersion,omitempty"`
+	// DriverVersion is the version of the GPU driver of the host
+	DriverVersion string `json:"DriverVersion,omitempty"`
+	// DeviceCount is the number of GPUs the driver reports
+	DeviceCount int `json:"DeviceCount"`
+}
+
+// RuntimeProber probes the GPU runtime of the host.
+type RuntimeProber interface {
+	Probe(ctx context.Context) (RuntimeInfo, error)
+}
+
+// RuntimeStatus is the result of the latest probe of the GPU runtime.
+type RuntimeStatus struct {
+	RuntimeInfo
+	// Available is whether GPU tasks can run on the host
+	Available bool `json:"Available"`
+	// Reason is why GPU tasks can't run on the host, if they can't
+	Reason   string    `json:"Reason,omitempty"`
+	ProbedAt time.Time `json:"ProbedAt"`
+}
+
+// RuntimeStatusReporter provides the result of the latest probe of the GPU runtime.
+type RuntimeStatusReporter interface {
+	// RuntimeStatus returns the result of the latest probe, and false if the runtime has
+	// not been probed yet.
+	RuntimeStatus() (RuntimeStatus, bool)
+}
+
+// RuntimeMonitor probes the GPU runtime of the host, at startup and then periodically,
+// and keeps track of whether GPU tasks can run on the host.
+type RuntimeMonitor struct {
+	prober           RuntimeProber
+	minDriverVersion string
+	now              func() time.Time
+
+	lock   sync.RWMutex
+	status *RuntimeStatus
+}
+
+// NewRuntimeMonitor creates a monitor of the GPU runtime probed by the prober. The runtime
+// is unavailable if the driver version is lower than minDriverVersion, which isn't
+// checked if it's empty.
+func NewRuntimeMonitor(prober RuntimeProber, minDriverVersion string) *RuntimeMonitor {
+	return &RuntimeMonitor{
+		prober:           prober,
+		minDriverVersion: minDriverVersion,
+		now:              time.Now,
+	}
+}
+
+// Start probes the runtime every interval until the context is done. The runtime isn't
+// probed periodically if the interval isn't positive.
+func (m *RuntimeMonitor) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Probe(ctx)
+		}
+	}
+}
+
+// Probe probes the runtime and returns its status. Changes of the availability of the
+// runtime are logged.
+func (m *RuntimeMonitor) Probe(ctx context.Context) RuntimeStatus {
+	info, err := m.prober.Probe(ctx)
+	status := RuntimeStatus{RuntimeInfo: info, ProbedAt: m.now()}
+	status.Reason = m.unavailableReason(info, err)
+	status.Available = status.Reason == ""
+
+	m.lock.Lock()
+	previous := m.status
+	m.status = &status
+	m.lock.Unlock()
+
+	fields := logger.Fields{
+		"runtimeVersion": info.RuntimeVersion,
+		"driverVersion":  info.DriverVersion,
+		"deviceCount":    info.DeviceCount,
+	}
+	switch {
+	case !status.Available && (previous == nil || previous.Available):
+		fields[field.Reason] = status.Reason
+		logger.Warn("GPU runtime is unavailable, GPU tasks will be stopped without being started", fields)
+	case status.Available && previous != nil && !previous.Available:
+		logger.Info("GPU runtime is available again", fields)
+	case status.Available && previous == nil:
+		logger.Info("GPU runtime is available", fields)
+	}
+	return status
+}
+
+// RuntimeStatus returns the result of the latest probe, and false if the runtime has not
+// been probed yet.
+func (m *RuntimeMonitor) RuntimeStatus() (RuntimeStatus, bool) {
+	if m == nil {
+		return RuntimeStatus{}, false
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.status == nil {
+		return RuntimeStatus{}, false
+	}
+	return *m.status, true
+}
+
+func (m *RuntimeMonitor) unavailableReason(info RuntimeInfo, probeErr error) string {
+	if probeErr != nil {
+		return fmt.Sprintf("GPU runtime unavailable: %v", probeErr)
+	}
+	if info.DeviceCount == 0 {
+		return "GPU runtime unavailable: no GPU devices found"
+	}
+	if m.minDriverVersion == "" {
+		return ""
+	}
+	older, err := versionLess(info.DriverVersion, m.minDriverVersion)
+	if err != nil {
+		return fmt.Sprintf("GPU runtime unavailable: %v", err)
+	}
+	if older {
+		return fmt.Sprintf("GPU runtime unavailable: driver %s vs toolkit requires >= %s",
+			info.DriverVersion, m.minDriverVersion)
+	}
+	return ""
+}
+
+// versionLess returns whether the dotted numeric version a is lower than b. Missing
+// components count as zeros, so 545 and 545.0 are equal.
+func versionLess(a, b string) (bool, error) {
+	aComponents, err := parseVersion(a)
+	if err != nil {
+		return false, err
+	}
+	bComponents, err := parseVersion(b)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < len(aComponents) || i < len(bComponents); i++ {
+		var aComponent, bComponent int
+		if i < len(aComponents) {
+			aComponent = aComponents[i]
+		}
+		if i < len(bComponents) {
+			bComponent = bComponents[i]
+		}
+		if aComponent != bComponent {
+			return aComponent < bComponent, nil
+		}
+	}
+	return false, nil
+}
+
+func parseVersion(version string) ([]int, error) {
+	if version == "" {
+		return nil, fmt.Errorf("driver version is unknown")
+	}
+	var components []int
+	for _, component := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(component)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("version %q is not a dotted numeric version", version)
+		}
+		components = append(components, n)
+	}
+	return components, nil
+}
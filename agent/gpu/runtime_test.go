@@ -0,0 +1,109 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gpu_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
+	mock_gpu "github.com/aws/amazon-ecs-agent/agent/gpu/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runtimeInfo(driverVersion string, deviceCount int) gpu.RuntimeInfo {
+	return gpu.RuntimeInfo{RuntimeVersion: "1.14.3", DriverVersion: driverVersion, DeviceCount: deviceCount}
+}
+
+func TestRuntimeMonitorFlappingAvailability(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	prober := mock_gpu.NewMockRuntimeProber(ctrl)
+	gomock.InOrder(
+		prober.EXPECT().Probe(gomock.Any()).Return(runtimeInfo("545.23.08", 4), nil),
+		prober.EXPECT().Probe(gomock.Any()).Return(gpu.RuntimeInfo{}, errors.New("nvidia-smi failed: driver not loaded")),
+		prober.EXPECT().Probe(gomock.Any()).Return(runtimeInfo("545.23.08", 4), nil),
+		prober.EXPECT().Probe(gomock.Any()).Return(runtimeInfo("545.23.08", 0), nil),
+		prober.EXPECT().Probe(gomock.Any()).Return(runtimeInfo("545.23.08", 4), nil),
+	)
+	monitor := gpu.NewRuntimeMonitor(prober, "545")
+
+	// The runtime is unknown until it's probed
+	_, ok := monitor.RuntimeStatus()
+	assert.False(t, ok)
+
+	for _, expected := range []struct {
+		available bool
+		reason    string
+	}{
+		{available: true},
+		{reason: "GPU runtime unavailable: nvidia-smi failed: driver not loaded"},
+		{available: true},
+		{reason: "GPU runtime unavailable: no GPU devices found"},
+		{available: true},
+	} {
+		probed := monitor.Probe(context.TODO())
+		status, ok := monitor.RuntimeStatus()
+		require.True(t, ok)
+		assert.Equal(t, probed, status)
+		assert.Equal(t, expected.available, status.Available)
+		assert.Equal(t, expected.reason, status.Reason)
+		assert.False(t, status.ProbedAt.IsZero())
+	}
+}
+
+func TestRuntimeMonitorMinDriverVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		driverVersion    string
+		minDriverVersion string
+		expectedReason   string
+	}{
+		{name: "older driver", driverVersion: "535.104.05", minDriverVersion: "545",
+			expectedReason: "GPU runtime unavailable: driver 535.104.05 vs toolkit requires >= 545"},
+		{name: "older patch", driverVersion: "545.23.06", minDriverVersion: "545.23.08",
+			expectedReason: "GPU runtime unavailable: driver 545.23.06 vs toolkit requires >= 545.23.08"},
+		{name: "same version", driverVersion: "545.0", minDriverVersion: "545"},
+		{name: "newer driver", driverVersion: "550.54.14", minDriverVersion: "545.23.08"},
+		{name: "no minimum", driverVersion: "390.157", minDriverVersion: ""},
+		{name: "unparsable driver version", driverVersion: "545.beta", minDriverVersion: "545",
+			expectedReason: `GPU runtime unavailable: version "545.beta" is not a dotted numeric version`},
+		{name: "unknown driver version", driverVersion: "", minDriverVersion: "545",
+			expectedReason: "GPU runtime unavailable: driver version is unknown"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			prober := mock_gpu.NewMockRuntimeProber(ctrl)
+			prober.EXPECT().Probe(gomock.Any()).Return(runtimeInfo(tc.driverVersion, 1), nil)
+
+			status := gpu.NewRuntimeMonitor(prober, tc.minDriverVersion).Probe(context.TODO())
+			assert.Equal(t, tc.expectedReason == "", status.Available)
+			assert.Equal(t, tc.expectedReason, status.Reason)
+			assert.Equal(t, tc.driverVersion, status.DriverVersion)
+		})
+	}
+}
+
+func TestRuntimeMonitorNil(t *testing.T) {
+	var monitor *gpu.RuntimeMonitor
+	_, ok := monitor.RuntimeStatus()
+	assert.False(t, ok)
+}
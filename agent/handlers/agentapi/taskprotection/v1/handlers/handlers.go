@@ -84,6 +84,13 @@ func UpdateTaskProtectionHandler(state dockerstate.TaskEngineState, credentialsM
 			logger.Error("UpdateTaskProtection: failed to decode request", logger.Fields{
 				loggerfield.Error: err,
 			})
+			if errorMessage := utils.RequestBodyErrorMessage(err); errorMessage != nil {
+				writeJSONResponse(w, errorMessage.HTTPErrorCode,
+					types.NewTaskProtectionResponseError(types.NewErrorResponsePtr("", errorMessage.Code,
+						"UpdateTaskProtection: "+errorMessage.Message), nil),
+					updateTaskProtectionRequestType)
+				return
+			}
 			writeJSONResponse(w, http.StatusBadRequest,
 				types.NewTaskProtectionResponseError(types.NewErrorResponsePtr("", ecs.ErrCodeInvalidParameterException,
 					"UpdateTaskProtection: failed to decode request"), nil),
@@ -155,7 +162,7 @@ func UpdateTaskProtectionHandler(state dockerstate.TaskEngineState, credentialsM
 			return
 		}
 
-		logger.Debug("updateTaskProtection response:", logger.Fields{
+		logger.DebugContext(r.Context(), "updateTaskProtection response:", logger.Fields{
 			loggerfield.TaskProtection: response.ProtectedTasks,
 			loggerfield.Reason:         response.Failures,
 		})
@@ -249,7 +256,7 @@ func GetTaskProtectionHandler(state dockerstate.TaskEngineState, credentialsMana
 			return
 		}
 
-		logger.Debug("getTaskProtection response:", logger.Fields{
+		logger.DebugContext(r.Context(), "getTaskProtection response:", logger.Fields{
 			loggerfield.TaskProtection: response.ProtectedTasks,
 			loggerfield.Reason:         response.Failures,
 		})
@@ -20,6 +20,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,12 +35,14 @@ import (
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 	mock_credentials "github.com/aws/amazon-ecs-agent/ecs-agent/credentials/mocks"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
+	tmdsutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -177,6 +180,31 @@ func TestUpdateTaskProtectionHandler_InputValidationsDecodeError(t *testing.T) {
 	}
 }
 
+// TestUpdateTaskProtectionHandlerBodyTooLarge tests UpdateTaskProtection handler's behavior
+// when the request body exceeds the maximum request body size of the server.
+func TestUpdateTaskProtectionHandlerBodyTooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	body := `{"ProtectionEnabled": true, "ExpiresInMinutes": ` + strings.Repeat("1", 64) + `}`
+	req, err := http.NewRequest("PUT", "", strings.NewReader(body))
+	require.NoError(t, err)
+	req = mux.SetURLVars(req, map[string]string{v3.V3EndpointIDMuxName: testV3EndpointId})
+	rr := httptest.NewRecorder()
+	handler := tmdsutils.MaxRequestBodyHandler(http.HandlerFunc(UpdateTaskProtectionHandler(
+		mock_dockerstate.NewMockTaskEngineState(ctrl), nil, nil, testCluster)), 32)
+	// A chunked body is only found to be too large once it is read by the handler
+	req.ContentLength = -1
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	var response types.TaskProtectionResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.NotNil(t, response.Error)
+	assert.Equal(t, tmdsutils.ErrRequestBodyTooLarge, response.Error.Code)
+	assert.Equal(t, "UpdateTaskProtection: Request body exceeds 32 bytes", response.Error.Message)
+}
+
 // TestUpdateTaskProtectionHandlerTaskARNNotFound tests UpdateTaskProtection handler's
 // behavior when task ARN was not found for the request.
 func TestUpdateTaskProtectionHandlerTaskARNNotFound(t *testing.T) {
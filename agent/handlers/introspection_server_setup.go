@@ -19,15 +19,26 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/pprof"
+	"path/filepath"
 	"strconv"
 	"time"
 
+	acshandler "github.com/aws/amazon-ecs-agent/agent/acs/handler"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials/instancecreds"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
 	handlersutils "github.com/aws/amazon-ecs-agent/agent/handlers/utils"
 	v1 "github.com/aws/amazon-ecs-agent/agent/handlers/v1"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
 	logginghandler "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/logging"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/retry"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/wsclient"
 	"github.com/cihub/seelog"
 )
 
@@ -45,6 +56,10 @@ const (
 	pprofProfilePath     = pprofBasePath + "profile"
 	pprofSymbolPath      = pprofBasePath + "symbol"
 	pprofTracePath       = pprofBasePath + "trace"
+
+	// credentialsSnapshotDirName is the directory under the data directory that credentials
+	// snapshots are exported to
+	credentialsSnapshotDirName = "credentials-snapshots"
 )
 
 var (
@@ -56,8 +71,90 @@ var (
 	pprofTraceHandler   = pprof.Trace
 )
 
-func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersutils.DockerStateResolver, cfg *config.Config) *http.Server {
-	paths := []string{v1.AgentMetadataPath, v1.TaskContainerMetadataPath, v1.LicensePath}
+// IntrospectionServerOptions are the sources of the optional endpoints and fields of the
+// introspection server. Any of them may be nil.
+type IntrospectionServerOptions struct {
+	// CircuitBreaker reports the state of the circuit breaker of the docker client
+	CircuitBreaker dockerapi.CircuitBreakerReporter
+	// ClockSkew estimates the skew of the host clock
+	ClockSkew clockdrift.Estimator
+	// ImagePrefetch reports the status of the images prefetched at startup
+	ImagePrefetch engine.ImagePrefetchStatusReporter
+	// CredentialsEntries counts the credentials held by the credentials manager
+	CredentialsEntries credentials.EntryCountReporter
+	// CredentialsLister lists the credentials held by the credentials manager
+	CredentialsLister credentials.CredentialsLister
+	// CredentialsSnapshotter takes snapshots of the credentials held by the credentials manager
+	CredentialsSnapshotter credentials.CredentialsSnapshotter
+	// TaskCredentials reports the role types that tasks have credentials for
+	TaskCredentials credentials.Manager
+	// LocalTasks launches tasks without ECS, it is nil unless local task launch is enabled
+	LocalTasks engine.LocalTaskManager
+	// Capabilities are the capabilities that the instance registered with
+	Capabilities []*ecs.Attribute
+	// GPURuntime reports the status of the GPU runtime, it is nil unless the runtime is probed
+	GPURuntime gpu.RuntimeStatusReporter
+	// HandlerStats are the runtime stats of the task metadata handlers
+	HandlerStats *tmdsv1.RuntimeStats
+	// TaskEvents broadcasts the task and container state changes that are streamed
+	TaskEvents *v1.TaskEventBroadcaster
+	// CredentialsMaintenance pauses and resumes credential serving from loopback callers
+	CredentialsMaintenance *tmdsv1.MaintenanceToggle
+	// CredentialsFetchDigest counts the credentials fetches of each task ARN over windows
+	CredentialsFetchDigest *tmdsv1.FetchDigest
+	// PayloadRejections reports the tasks of ACS payloads that were rejected or failed to start
+	PayloadRejections acshandler.PayloadRejectionReporter
+	// ACSConnection and TCSConnection report the state of the connections to ACS and TCS
+	ACSConnection wsclient.ConnectionStatusReporter
+	TCSConnection wsclient.ConnectionStatusReporter
+	// InstanceCredentials reports the rotation of the instance credentials, it is nil
+	// unless the instance is external
+	InstanceCredentials instancecreds.RotationStatusReporter
+	// MetricsFactory records the latency of requests, they are not recorded if it is nil
+	MetricsFactory metrics.EntryFactory
+
+	// drain and reconciliation are reported by the task engine
+	drain          engine.DrainStatusReporter
+	reconciliation engine.ReconciliationProgressReporter
+}
+
+func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersutils.DockerStateResolver,
+	opts IntrospectionServerOptions, cfg *config.Config) *http.Server {
+	paths := []string{v1.AgentMetadataPath, v1.TaskContainerMetadataPath, v1.LicensePath, v1.DrainStatusPath,
+		v1.ImagePrefetchStatusPath, v1.CredentialsEntriesPath, v1.CapabilitiesPath, v1.HandlerStatsPath,
+		v1.AWSEndpointsPath, v1.PayloadRejectionsPath, v1.ConnectionsPath}
+
+	if opts.TaskEvents != nil {
+		paths = append(paths, v1.TaskEventsPath)
+	}
+
+	if opts.CredentialsMaintenance != nil {
+		paths = append(paths, v1.CredentialsMaintenancePath)
+	}
+
+	if opts.CredentialsFetchDigest != nil {
+		paths = append(paths, v1.CredentialsAuditDigestPath)
+	}
+
+	if credentialsIDListingEnabled(cfg, opts.CredentialsLister) {
+		paths = append(paths, v1.CredentialsIDsPath)
+	}
+
+	if credentialsSnapshotExportEnabled(cfg, opts.CredentialsSnapshotter) {
+		paths = append(paths, v1.CredentialsSnapshotPath)
+	}
+
+	if opts.TaskCredentials != nil {
+		paths = append(paths, v1.TaskCredentialsPath)
+	}
+
+	if cfg.FirelensDryRunEnabled.Enabled() {
+		paths = append(paths, v1.FirelensDryRunPath)
+	}
+
+	if localTaskLaunchEnabled(cfg, opts.LocalTasks) {
+		paths = append(paths, v1.LocalTasksPath)
+	}
 
 	if cfg.EnableRuntimeStats.Enabled() {
 		paths = append(paths, pprofBasePath, pprofCMDLinePath, pprofProfilePath, pprofSymbolPath, pprofTracePath)
@@ -77,22 +174,40 @@ func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersu
 	serverMux := http.NewServeMux()
 	serverMux.HandleFunc("/", defaultHandler)
 
-	v1HandlersSetup(serverMux, containerInstanceArn, taskEngine, cfg)
+	v1HandlersSetup(serverMux, containerInstanceArn, taskEngine, opts, cfg)
 	pprofHandlerSetup(serverMux, cfg)
 
+	metricsFactory := opts.MetricsFactory
+	if metricsFactory == nil {
+		metricsFactory = metrics.NewNopEntryFactory()
+	}
+	metricsHandler := logginghandler.NewRequestMetricsHandler(serverMux,
+		logginghandler.ServeMuxRouteName(serverMux), metricsFactory,
+		metrics.IntrospectionRequestLatencyMetricName, cfg.LocalEndpointSlowRequestThreshold).
+		WithStreamingRoutes(v1.TaskEventsPath)
+
 	// Log all requests and then pass through to serverMux
+	var loggingHandler http.Handler = logginghandler.NewLoggingHandler(metricsHandler)
+	if cfg.LocalEndpointLogLevelHeaderEnabled.Enabled() {
+		loggingHandler = logginghandler.NewLogLevelHeaderHandler(loggingHandler)
+	}
 	loggingServeMux := http.NewServeMux()
-	loggingServeMux.Handle("/", logginghandler.NewLoggingHandler(serverMux))
+	loggingServeMux.Handle("/", loggingHandler)
 
 	wTimeout := writeTimeout
 	if cfg.EnableRuntimeStats.Enabled() {
 		wTimeout = writeTimeoutForPprof
 	}
 	server := &http.Server{
-		Addr:         ":" + strconv.Itoa(config.AgentIntrospectionPort),
-		Handler:      loggingServeMux,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: wTimeout,
+		Addr:              ":" + strconv.Itoa(config.AgentIntrospectionPort),
+		Handler:           loggingServeMux,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: cfg.LocalEndpointReadHeaderTimeout,
+		WriteTimeout:      wTimeout,
+		MaxHeaderBytes:    cfg.LocalEndpointMaxHeaderBytes,
+		// The connections of event streams are in the context of requests, so that their
+		// write deadline can be extended
+		ConnContext: v1.ConnContext,
 	}
 
 	return server
@@ -102,10 +217,79 @@ func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersu
 func v1HandlersSetup(serverMux *http.ServeMux,
 	containerInstanceArn *string,
 	taskEngine handlersutils.DockerStateResolver,
+	opts IntrospectionServerOptions,
 	cfg *config.Config) {
-	serverMux.HandleFunc(v1.AgentMetadataPath, v1.AgentMetadataHandler(containerInstanceArn, cfg))
+	serverMux.HandleFunc(v1.AgentMetadataPath, v1.AgentMetadataHandler(containerInstanceArn, cfg, opts.CircuitBreaker,
+		opts.ClockSkew, opts.reconciliation, opts.InstanceCredentials))
 	serverMux.HandleFunc(v1.TaskContainerMetadataPath, v1.TaskContainerMetadataHandler(taskEngine))
 	serverMux.HandleFunc(v1.LicensePath, v1.LicenseHandler)
+	serverMux.HandleFunc(v1.DrainStatusPath, v1.DrainStatusHandler(opts.drain))
+	serverMux.HandleFunc(v1.ImagePrefetchStatusPath, v1.ImagePrefetchStatusHandler(opts.ImagePrefetch))
+	serverMux.HandleFunc(v1.CredentialsEntriesPath, v1.CredentialsEntriesHandler(opts.CredentialsEntries))
+	serverMux.HandleFunc(v1.CapabilitiesPath, v1.CapabilitiesHandler(opts.Capabilities, opts.GPURuntime))
+	serverMux.HandleFunc(v1.HandlerStatsPath, v1.HandlerStatsHandler(opts.HandlerStats))
+	serverMux.HandleFunc(v1.PayloadRejectionsPath, v1.PayloadRejectionsHandler(opts.PayloadRejections))
+	serverMux.HandleFunc(v1.ConnectionsPath, v1.ConnectionsHandler(opts.ACSConnection, opts.TCSConnection))
+	serverMux.HandleFunc(v1.AWSEndpointsPath, v1.AWSEndpointsHandler(cfg.EndpointResolver(), cfg.AWSRegion))
+	if opts.TaskEvents != nil {
+		serverMux.HandleFunc(v1.TaskEventsPath, v1.TaskEventsHandler(opts.TaskEvents, cfg.TaskEventsHeartbeatInterval))
+	}
+	if opts.CredentialsMaintenance != nil {
+		serverMux.HandleFunc(v1.CredentialsMaintenancePath,
+			v1.LoopbackOnly(v1.CredentialsMaintenanceHandler(opts.CredentialsMaintenance)))
+	}
+	if opts.CredentialsFetchDigest != nil {
+		serverMux.HandleFunc(v1.CredentialsAuditDigestPath, v1.CredentialsAuditDigestHandler(opts.CredentialsFetchDigest))
+	} else {
+		serverMux.HandleFunc(v1.CredentialsAuditDigestPath, http.NotFound)
+	}
+	if credentialsIDListingEnabled(cfg, opts.CredentialsLister) {
+		serverMux.HandleFunc(v1.CredentialsIDsPath, v1.CredentialsIDsHandler(opts.CredentialsLister))
+	} else {
+		// Otherwise the request would be answered by the default handler
+		serverMux.HandleFunc(v1.CredentialsIDsPath, http.NotFound)
+	}
+	if credentialsSnapshotExportEnabled(cfg, opts.CredentialsSnapshotter) {
+		// Snapshots are written to the host
+		serverMux.HandleFunc(v1.CredentialsSnapshotPath, v1.LoopbackOnly(v1.CredentialsSnapshotHandler(
+			opts.CredentialsSnapshotter, credentialsSnapshotDir(cfg))))
+	} else {
+		serverMux.HandleFunc(v1.CredentialsSnapshotPath, http.NotFound)
+	}
+	if opts.TaskCredentials != nil {
+		serverMux.HandleFunc(v1.TaskCredentialsPath, v1.TaskCredentialsHandler(taskEngine, opts.TaskCredentials))
+	}
+	if cfg.FirelensDryRunEnabled.Enabled() {
+		serverMux.HandleFunc(v1.FirelensDryRunPath, v1.FirelensDryRunHandler(cfg))
+	}
+	if localTaskLaunchEnabled(cfg, opts.LocalTasks) {
+		// Launching tasks runs arbitrary containers on the host
+		serverMux.HandleFunc(v1.LocalTasksPath, v1.LoopbackOnly(v1.LocalTasksHandler(opts.LocalTasks)))
+	} else {
+		serverMux.HandleFunc(v1.LocalTasksPath, http.NotFound)
+	}
+}
+
+// credentialsIDListingEnabled returns whether the ids of the credentials held by the
+// credentials manager are listed for diagnostics.
+func credentialsIDListingEnabled(cfg *config.Config, credentialsLister credentials.CredentialsLister) bool {
+	return cfg.CredentialsIDListingEnabled.Enabled() && credentialsLister != nil
+}
+
+// credentialsSnapshotExportEnabled returns whether snapshots of the credentials held by the
+// credentials manager can be exported for incident response.
+func credentialsSnapshotExportEnabled(cfg *config.Config, snapshotter credentials.CredentialsSnapshotter) bool {
+	return cfg.CredentialsSnapshotExportEnabled.Enabled() && snapshotter != nil
+}
+
+// credentialsSnapshotDir returns the directory that credentials snapshots are exported to.
+func credentialsSnapshotDir(cfg *config.Config) string {
+	return filepath.Join(cfg.DataDir, credentialsSnapshotDirName)
+}
+
+// localTaskLaunchEnabled returns whether tasks can be launched on this host without ECS.
+func localTaskLaunchEnabled(cfg *config.Config, localTasks engine.LocalTaskManager) bool {
+	return cfg.LocalTaskLaunchEnabled.Enabled() && localTasks != nil
 }
 
 func pprofHandlerSetup(serverMux *http.ServeMux, cfg *config.Config) {
@@ -122,12 +306,16 @@ func pprofHandlerSetup(serverMux *http.ServeMux, cfg *config.Config) {
 // ServeIntrospectionHTTPEndpoint serves information about this agent/containerInstance and tasks
 // running on it. "V1" here indicates the hostname version of this server instead
 // of the handler versions, i.e. "V1" server can include "V1" and "V2" handlers.
-func ServeIntrospectionHTTPEndpoint(ctx context.Context, containerInstanceArn *string, taskEngine engine.TaskEngine, cfg *config.Config) {
+// The optional endpoints and fields of the server are served from opts.
+func ServeIntrospectionHTTPEndpoint(ctx context.Context, containerInstanceArn *string, taskEngine engine.TaskEngine,
+	opts IntrospectionServerOptions, cfg *config.Config) {
 	// Is this the right level to type assert, assuming we'd abstract multiple taskengines here?
 	// Revisit if we ever add another type..
 	dockerTaskEngine := taskEngine.(*engine.DockerTaskEngine)
+	opts.drain = dockerTaskEngine
+	opts.reconciliation = dockerTaskEngine
 
-	server := introspectionServerSetup(containerInstanceArn, dockerTaskEngine, cfg)
+	server := introspectionServerSetup(containerInstanceArn, dockerTaskEngine, opts, cfg)
 
 	go func() {
 		<-ctx.Done()
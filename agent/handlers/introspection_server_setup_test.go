@@ -20,19 +20,32 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials/instancecreds"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
 	mock_utils "github.com/aws/amazon-ecs-agent/agent/handlers/mocks"
 	v1 "github.com/aws/amazon-ecs-agent/agent/handlers/v1"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	apieni "github.com/aws/amazon-ecs-agent/ecs-agent/api/eni"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,7 +60,7 @@ const (
 var runtimeStatsConfigForTest = config.BooleanDefaultFalse{}
 
 func TestMetadataHandler(t *testing.T) {
-	metadataHandler := v1.AgentMetadataHandler(utils.Strptr(testContainerInstanceArn), &config.Config{Cluster: testClusterArn})
+	metadataHandler := v1.AgentMetadataHandler(utils.Strptr(testContainerInstanceArn), &config.Config{Cluster: testClusterArn}, nil, nil, nil, nil)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "http://localhost:"+strconv.Itoa(config.AgentIntrospectionPort), nil)
@@ -64,6 +77,582 @@ func TestMetadataHandler(t *testing.T) {
 	}
 }
 
+type fakeCircuitBreakerReporter struct {
+	status dockerapi.CircuitBreakerStatus
+}
+
+func (f fakeCircuitBreakerReporter) CircuitBreakerStatus() dockerapi.CircuitBreakerStatus {
+	return f.status
+}
+
+func TestMetadataHandlerCircuitBreaker(t *testing.T) {
+	testCases := []struct {
+		state              string
+		expectedStatusCode int
+	}{
+		{dockerapi.CircuitBreakerClosed, http.StatusOK},
+		{dockerapi.CircuitBreakerHalfOpen, http.StatusOK},
+		{dockerapi.CircuitBreakerOpen, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.state, func(t *testing.T) {
+			breaker := fakeCircuitBreakerReporter{dockerapi.CircuitBreakerStatus{State: tc.state, ConsecutiveFailures: 5}}
+			metadataHandler := v1.AgentMetadataHandler(utils.Strptr(testContainerInstanceArn),
+				&config.Config{Cluster: testClusterArn}, breaker, nil, nil, nil)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", v1.AgentMetadataPath, nil)
+			metadataHandler(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			var resp v1.MetadataResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, testClusterArn, resp.Cluster)
+			require.NotNil(t, resp.DockerCircuitBreaker)
+			assert.Equal(t, tc.state, resp.DockerCircuitBreaker.State)
+			assert.Equal(t, 5, resp.DockerCircuitBreaker.ConsecutiveFailures)
+		})
+	}
+}
+
+func TestMetadataHandlerClockDrift(t *testing.T) {
+	checker := clockdrift.NewChecker(time.Minute, time.Minute, "")
+	metadataHandler := v1.AgentMetadataHandler(utils.Strptr(testContainerInstanceArn),
+		&config.Config{Cluster: testClusterArn}, nil, checker, nil, nil)
+	getMetadata := func() v1.MetadataResponse {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.AgentMetadataPath, nil)
+		metadataHandler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp v1.MetadataResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	assert.Nil(t, getMetadata().ClockDrift)
+
+	// An API response dated 5 minutes ahead of the host clock
+	now := time.Now()
+	header := http.Header{}
+	header.Set("Date", now.Add(5*time.Minute).UTC().Format(http.TimeFormat))
+	checker.ObserveResponse(now, now, header)
+
+	resp := getMetadata()
+	require.NotNil(t, resp.ClockDrift)
+	assert.Equal(t, clockdrift.SourceDateHeader, resp.ClockDrift.Source)
+	assert.InDelta(t, -300, resp.ClockDrift.SkewSeconds, 1.5)
+	assert.True(t, resp.ClockDrift.ExceedsThreshold)
+}
+
+type reconciliationProgressReporter engine.ReconciliationProgress
+
+func (r reconciliationProgressReporter) ReconciliationProgress() engine.ReconciliationProgress {
+	return engine.ReconciliationProgress(r)
+}
+
+func TestMetadataHandlerStateReconciliation(t *testing.T) {
+	reporter := reconciliationProgressReporter{
+		Reconciling: true,
+		Reconciled:  34,
+		Remaining:   116,
+		Total:       150,
+		Status:      "reconciling: 34/150",
+	}
+	metadataHandler := v1.AgentMetadataHandler(utils.Strptr(testContainerInstanceArn),
+		&config.Config{Cluster: testClusterArn}, nil, nil, reporter, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.AgentMetadataPath, nil)
+	metadataHandler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp v1.MetadataResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotNil(t, resp.StateReconciliation)
+	assert.Equal(t, engine.ReconciliationProgress(reporter), *resp.StateReconciliation)
+}
+
+type rotationStatusReporter instancecreds.RotationStatus
+
+func (r rotationStatusReporter) RotationStatus() instancecreds.RotationStatus {
+	return instancecreds.RotationStatus(r)
+}
+
+func TestMetadataHandlerInstanceCredentialsRotation(t *testing.T) {
+	expiresAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		state              instancecreds.RotationState
+		expectedStatusCode int
+	}{
+		{state: instancecreds.RotationHealthy, expectedStatusCode: http.StatusOK},
+		{state: instancecreds.RotationDegraded, expectedStatusCode: http.StatusOK},
+		{state: instancecreds.RotationExpired, expectedStatusCode: http.StatusServiceUnavailable},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.state), func(t *testing.T) {
+			reporter := rotationStatusReporter{
+				State:               tc.state,
+				ExpiresAt:           &expiresAt,
+				ConsecutiveFailures: 2,
+			}
+			metadataHandler := v1.AgentMetadataHandler(utils.Strptr(testContainerInstanceArn),
+				&config.Config{Cluster: testClusterArn}, nil, nil, nil, reporter)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", v1.AgentMetadataPath, nil)
+			metadataHandler(w, req)
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			var resp v1.MetadataResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.NotNil(t, resp.InstanceCredentialsRotation)
+			assert.Equal(t, instancecreds.RotationStatus(reporter), *resp.InstanceCredentialsRotation)
+		})
+	}
+}
+
+// recordingEntryFactory records the operations and fields of the entries that are done.
+type recordingEntryFactory struct {
+	done []recordingEntry
+}
+
+type recordingEntry struct {
+	factory *recordingEntryFactory
+	op      string
+	fields  map[string]interface{}
+}
+
+func (f *recordingEntryFactory) New(op string) metrics.Entry {
+	return &recordingEntry{factory: f, op: op}
+}
+
+func (f *recordingEntryFactory) Flush() {}
+
+func (e *recordingEntry) WithFields(f map[string]interface{}) metrics.Entry {
+	e.fields = f
+	return e
+}
+
+func (e *recordingEntry) WithCount(count int) metrics.Entry { return e }
+
+func (e *recordingEntry) WithGauge(value interface{}) metrics.Entry { return e }
+
+func (e *recordingEntry) Done(err error) func() {
+	return func() { e.factory.done = append(e.factory.done, *e) }
+}
+
+// Tests that the latencies of introspection requests are recorded with the metrics factory
+// of the options.
+func TestIntrospectionServerRequestMetrics(t *testing.T) {
+	metricsFactory := &recordingEntryFactory{}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		IntrospectionServerOptions{MetricsFactory: metricsFactory}, &config.Config{Cluster: testClusterArn})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.AgentMetadataPath, nil)
+	server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, metricsFactory.done, 1)
+	assert.Equal(t, metrics.IntrospectionRequestLatencyMetricName, metricsFactory.done[0].op)
+	assert.Equal(t, map[string]interface{}{
+		"route":  v1.AgentMetadataPath,
+		"method": "GET",
+		"status": http.StatusOK,
+	}, metricsFactory.done[0].fields)
+}
+
+type drainStatusReporter engine.DrainStatus
+
+func (r drainStatusReporter) DrainStatus() engine.DrainStatus {
+	return engine.DrainStatus(r)
+}
+
+func TestDrainStatusHandler(t *testing.T) {
+	getDrainStatus := func(reporter engine.DrainStatusReporter) engine.DrainStatus {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.DrainStatusPath, nil)
+		v1.DrainStatusHandler(reporter)(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp engine.DrainStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	assert.False(t, getDrainStatus(nil).Draining)
+
+	status := getDrainStatus(drainStatusReporter{
+		Draining:         true,
+		StopLastFamilies: []string{"log-router"},
+		Tasks: []engine.DrainTaskStatus{
+			{Arn: "app", Family: "web-app", StopPhase: engine.DrainStopPhaseRegular},
+			{Arn: "observer", Family: "log-router", StopPhase: engine.DrainStopPhaseStopLast, StopDeferred: true},
+		},
+	})
+	assert.True(t, status.Draining)
+	require.Len(t, status.Tasks, 2)
+	assert.Equal(t, "app", status.Tasks[0].Arn)
+	assert.Equal(t, "observer", status.Tasks[1].Arn)
+	assert.True(t, status.Tasks[1].StopDeferred)
+}
+
+type imagePrefetchStatusReporter []engine.ImagePrefetchStatus
+
+func (r imagePrefetchStatusReporter) ImagePrefetchStatus() []engine.ImagePrefetchStatus {
+	return r
+}
+
+func TestImagePrefetchStatusHandler(t *testing.T) {
+	getImagePrefetchStatus := func(reporter engine.ImagePrefetchStatusReporter) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.ImagePrefetchStatusPath, nil)
+		v1.ImagePrefetchStatusHandler(reporter)(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, `{"Images":[]}`, getImagePrefetchStatus(nil))
+	assert.Equal(t,
+		`{"Images":[{"Image":"nginx:latest","Status":"SUCCEEDED","Attempts":2,"Preemptions":1},`+
+			`{"Image":"missing:latest","Status":"FAILED","Attempts":1,"Preemptions":0,"Error":"not found"}]}`,
+		getImagePrefetchStatus(imagePrefetchStatusReporter{
+			{Image: "nginx:latest", Status: engine.ImagePrefetchSucceeded, Attempts: 2, Preemptions: 1},
+			{Image: "missing:latest", Status: engine.ImagePrefetchFailed, Attempts: 1, Error: "not found"},
+		}))
+}
+
+type gpuRuntimeStatusReporter []gpu.RuntimeStatus
+
+func (r gpuRuntimeStatusReporter) RuntimeStatus() (gpu.RuntimeStatus, bool) {
+	if len(r) == 0 {
+		return gpu.RuntimeStatus{}, false
+	}
+	return r[0], true
+}
+
+func TestCapabilitiesHandler(t *testing.T) {
+	getCapabilities := func(gpuRuntime gpu.RuntimeStatusReporter) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.CapabilitiesPath, nil)
+		v1.CapabilitiesHandler([]*ecs.Attribute{
+			{Name: aws.String("com.amazonaws.ecs.capability.docker-remote-api.1.17")},
+			{Name: aws.String("ecs.os-type"), Value: aws.String("linux")},
+		}, gpuRuntime)(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	capabilities := `"Capabilities":["com.amazonaws.ecs.capability.docker-remote-api.1.17","ecs.os-type=linux"]`
+	assert.Equal(t, `{`+capabilities+`}`, getCapabilities(nil))
+	assert.Equal(t, `{`+capabilities+`}`, getCapabilities(gpuRuntimeStatusReporter{}))
+	assert.Equal(t, `{`+capabilities+`,"GPURuntime":{"RuntimeVersion":"1.14.3","DriverVersion":"535.104.05",`+
+		`"DeviceCount":1,"Available":false,"Reason":"GPU runtime unavailable: driver 535.104.05 vs toolkit requires \u003e= 545",`+
+		`"ProbedAt":"2023-10-14T00:00:00Z"}}`,
+		getCapabilities(gpuRuntimeStatusReporter{{
+			RuntimeInfo: gpu.RuntimeInfo{RuntimeVersion: "1.14.3", DriverVersion: "535.104.05", DeviceCount: 1},
+			Reason:      "GPU runtime unavailable: driver 535.104.05 vs toolkit requires >= 545",
+			ProbedAt:    time.Date(2023, 10, 14, 0, 0, 0, 0, time.UTC),
+		}}))
+}
+
+func TestHandlerStatsHandler(t *testing.T) {
+	getHandlerStats := func(stats *tmdsv1.RuntimeStats) tmdsv1.RuntimeStatsSnapshot {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.HandlerStatsPath, nil)
+		v1.HandlerStatsHandler(stats)(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var snapshot tmdsv1.RuntimeStatsSnapshot
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+		return snapshot
+	}
+
+	assert.Zero(t, getHandlerStats(nil).Requests)
+
+	stats := tmdsv1.NewRuntimeStats()
+	stats.ObserveRequest(tmdsv1.RequestObservation{APIVersion: tmdsv1.APIVersion, StatusCode: http.StatusOK})
+	stats.ObserveRequest(tmdsv1.RequestObservation{APIVersion: "v2", StatusCode: http.StatusNotFound,
+		ErrorCode: tmdsv1.ErrInvalidIDInRequest})
+	stats.RecordThrottle()
+	stats.RecordCacheHit()
+	stats.RecordCacheMiss()
+	snapshot := getHandlerStats(stats)
+	assert.Equal(t, uint64(2), snapshot.Requests)
+	assert.Equal(t, map[string]uint64{tmdsv1.APIVersion: 1, "v2": 1}, snapshot.RequestsByAPIVersion)
+	assert.Equal(t, map[string]uint64{"200": 1, "404": 1}, snapshot.StatusCodes)
+	assert.Equal(t, map[string]uint64{tmdsv1.ErrInvalidIDInRequest: 1}, snapshot.ErrorCodes)
+	assert.Equal(t, uint64(1), snapshot.Throttled)
+	assert.Equal(t, uint64(1), snapshot.CacheHits)
+	assert.Equal(t, uint64(1), snapshot.CacheMisses)
+}
+
+func TestCredentialsAuditDigestHandler(t *testing.T) {
+	getDigest := func(digest *tmdsv1.FetchDigest) *httptest.ResponseRecorder {
+		server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil, IntrospectionServerOptions{
+			CredentialsFetchDigest: digest,
+		}, &config.Config{Cluster: testClusterArn})
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.CredentialsAuditDigestPath, nil)
+		server.Handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// The digest is disabled by default
+	assert.Equal(t, http.StatusNotFound, getDigest(nil).Code)
+
+	digest := tmdsv1.NewFetchDigest(time.Hour, 0)
+	for _, arn := range []string{"t1", "t2", "t1"} {
+		digest.ObserveRequest(tmdsv1.RequestObservation{APIVersion: tmdsv1.APIVersion, ARN: arn,
+			StatusCode: http.StatusOK})
+	}
+	recorder := getDigest(digest)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response tmdsv1.FetchDigestSnapshot
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, map[string]uint64{"t1": 2, "t2": 1}, response.Current.Fetches)
+	assert.Equal(t, uint64(3), response.Current.Total)
+	assert.Equal(t, time.Hour, response.Current.WindowEnd.Sub(response.Current.WindowStart))
+	assert.Nil(t, response.Previous)
+}
+
+func TestCredentialsEntriesHandler(t *testing.T) {
+	getCredentialsEntries := func(reporter credentials.EntryCountReporter) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.CredentialsEntriesPath, nil)
+		v1.CredentialsEntriesHandler(reporter)(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, `{"Entries":0,"HighWaterMark":0,"MaxEntries":0}`, getCredentialsEntries(nil))
+
+	manager := credentials.NewManager(credentials.WithMaxEntries(2))
+	for _, id := range []string{"c1", "c2", "c3"} {
+		manager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+			ARN:                "t1",
+			IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: id},
+		})
+	}
+	manager.RemoveCredentials("c1")
+	assert.Equal(t, `{"Entries":1,"HighWaterMark":2,"MaxEntries":2}`,
+		getCredentialsEntries(manager.(credentials.EntryCountReporter)))
+}
+
+func TestCredentialsIDsHandler(t *testing.T) {
+	manager := credentials.NewManager()
+	for _, id := range []string{"c2", "c1"} {
+		manager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+			ARN: "t-" + id,
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				CredentialsID:   id,
+				RoleArn:         "role-arn",
+				AccessKeyID:     "access-key-" + id,
+				SecretAccessKey: "secret-" + id,
+				SessionToken:    "token-" + id,
+				Expiration:      "2026-01-01T00:00:00Z",
+				RoleType:        credentials.ApplicationRoleType,
+			},
+		})
+	}
+	getCredentialsIDs := func(enabled bool) *httptest.ResponseRecorder {
+		cfg := &config.Config{Cluster: testClusterArn}
+		if enabled {
+			cfg.CredentialsIDListingEnabled = config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
+		}
+		server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil, IntrospectionServerOptions{
+			CredentialsLister: manager.(credentials.CredentialsLister),
+		}, cfg)
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", v1.CredentialsIDsPath, nil)
+		server.Handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// The listing is disabled by default
+	recorder := getCredentialsIDs(false)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = getCredentialsIDs(true)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response v1.CredentialsIDsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	expected := []v1.CredentialsIDSummary{
+		{CredentialsIDFingerprint: v1.CredentialsIDFingerprint("c1"), TaskARN: "t-c1",
+			RoleType: "TaskApplication", Expiration: "2026-01-01T00:00:00Z"},
+		{CredentialsIDFingerprint: v1.CredentialsIDFingerprint("c2"), TaskARN: "t-c2",
+			RoleType: "TaskApplication", Expiration: "2026-01-01T00:00:00Z"},
+	}
+	if expected[1].CredentialsIDFingerprint < expected[0].CredentialsIDFingerprint {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+	assert.Equal(t, expected, response.Credentials)
+	assert.Len(t, expected[0].CredentialsIDFingerprint, 24)
+	// The credentials ids are bearer tokens of the credentials endpoints
+	assert.NotContains(t, recorder.Body.String(), `"c1"`)
+	assert.NotContains(t, recorder.Body.String(), `"c2"`)
+	for _, secret := range []string{"access-key", "secret-", "token-", "role-arn"} {
+		assert.NotContains(t, recorder.Body.String(), secret)
+	}
+}
+
+func TestCredentialsSnapshotHandler(t *testing.T) {
+	manager := credentials.NewManager()
+	for _, id := range []string{"c2", "c1"} {
+		manager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+			ARN: "t-" + id,
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				CredentialsID:   id,
+				RoleArn:         "role-arn-" + id,
+				AccessKeyID:     "access-key-" + id,
+				SecretAccessKey: "secret-" + id,
+				SessionToken:    "token-" + id,
+				Expiration:      "2026-01-01T00:00:00Z",
+				RoleType:        credentials.ApplicationRoleType,
+			},
+		})
+	}
+	dataDir := t.TempDir()
+	exportSnapshot := func(enabled bool, method, remoteAddr string) *httptest.ResponseRecorder {
+		cfg := &config.Config{Cluster: testClusterArn, DataDir: dataDir}
+		if enabled {
+			cfg.CredentialsSnapshotExportEnabled = config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
+		}
+		server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil, IntrospectionServerOptions{
+			CredentialsSnapshotter: manager.(credentials.CredentialsSnapshotter),
+		}, cfg)
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, v1.CredentialsSnapshotPath, nil)
+		req.RemoteAddr = remoteAddr
+		server.Handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// The export is disabled by default
+	recorder := exportSnapshot(false, http.MethodPut, "127.0.0.1:34567")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = exportSnapshot(true, http.MethodPut, "10.0.0.1:34567")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = exportSnapshot(true, http.MethodGet, "127.0.0.1:34567")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, http.MethodPut, recorder.Header().Get("Allow"))
+
+	recorder = exportSnapshot(true, http.MethodPut, "127.0.0.1:34567")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response v1.CredentialsSnapshotResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Credentials)
+	assert.Equal(t, filepath.Join(dataDir, credentialsSnapshotDirName), filepath.Dir(response.Path))
+
+	data, err := os.ReadFile(response.Path)
+	require.NoError(t, err)
+	var snapshot v1.CredentialsSnapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.False(t, snapshot.TakenAt.IsZero())
+	expected := []v1.CredentialsMetadata{
+		{CredentialsIDFingerprint: v1.CredentialsIDFingerprint("c1"), TaskARN: "t-c1", RoleARN: "role-arn-c1",
+			RoleType: "TaskApplication", Expiration: "2026-01-01T00:00:00Z", Revision: 1},
+		{CredentialsIDFingerprint: v1.CredentialsIDFingerprint("c2"), TaskARN: "t-c2", RoleARN: "role-arn-c2",
+			RoleType: "TaskApplication", Expiration: "2026-01-01T00:00:00Z", Revision: 1},
+	}
+	assert.Equal(t, expected, snapshot.Credentials)
+	// Snapshots never include the credentials ids or secret material
+	assert.NotContains(t, string(data), `"c1"`)
+	assert.NotContains(t, string(data), `"c2"`)
+	for _, secret := range []string{"access-key", "secret-", "token-"} {
+		assert.NotContains(t, string(data), secret)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(response.Path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// fakeLocalTasks launches local tasks of a single ARN.
+type fakeLocalTasks struct {
+	launched []engine.LocalTaskLaunchRequest
+	stopped  []string
+}
+
+const fakeLocalTaskARN = "arn:aws:ecs:us-west-2:000000000000:task/default/local"
+
+func (f *fakeLocalTasks) LaunchLocalTask(request engine.LocalTaskLaunchRequest) (string, error) {
+	if request.TaskDefinition.Family == "" {
+		return "", &engine.LocalTaskValidationError{Problems: []string{"TaskDefinition.Family is required"}}
+	}
+	f.launched = append(f.launched, request)
+	return fakeLocalTaskARN, nil
+}
+
+func (f *fakeLocalTasks) StopLocalTask(taskARN string) error {
+	if taskARN != fakeLocalTaskARN {
+		return engine.ErrLocalTaskNotFound
+	}
+	f.stopped = append(f.stopped, taskARN)
+	return nil
+}
+
+func TestLocalTasksHandler(t *testing.T) {
+	localTasks := &fakeLocalTasks{}
+	remoteAddr := "127.0.0.1:51678"
+	performLocalTasksRequest := func(enabled bool, method, path, body string) *httptest.ResponseRecorder {
+		cfg := &config.Config{Cluster: testClusterArn}
+		if enabled {
+			cfg.LocalTaskLaunchEnabled = config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
+		}
+		server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil, IntrospectionServerOptions{
+			LocalTasks: localTasks,
+		}, cfg)
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		server.Handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// Local task launch is disabled by default
+	recorder := performLocalTasksRequest(false, "POST", v1.LocalTasksPath, `{"TaskDefinition":{"Family":"local"}}`)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Empty(t, localTasks.launched)
+
+	recorder = performLocalTasksRequest(true, "POST", v1.LocalTasksPath,
+		`{"taskDefinition":{"family":"local","containerDefinitions":[{"name":"app","image":"busybox"}]}}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"TaskArn":"`+fakeLocalTaskARN+`"}`, recorder.Body.String())
+	require.Len(t, localTasks.launched, 1)
+	assert.Equal(t, "busybox", localTasks.launched[0].TaskDefinition.ContainerDefinitions[0].Image)
+
+	recorder = performLocalTasksRequest(true, "POST", v1.LocalTasksPath, `{"TaskDefinition":{}}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.JSONEq(t, `{"Errors":["TaskDefinition.Family is required"]}`, recorder.Body.String())
+
+	recorder = performLocalTasksRequest(true, "POST", v1.LocalTasksPath, `{"TaskDefinition":`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = performLocalTasksRequest(true, "DELETE", v1.LocalTasksPath+"?taskarn=unknown", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = performLocalTasksRequest(true, "DELETE", v1.LocalTasksPath, "")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = performLocalTasksRequest(true, "DELETE", v1.LocalTasksPath+"?taskarn="+fakeLocalTaskARN, "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{fakeLocalTaskARN}, localTasks.stopped)
+
+	recorder = performLocalTasksRequest(true, "GET", v1.LocalTasksPath, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, "POST, DELETE", recorder.Header().Get("Allow"))
+
+	// Tasks can only be launched and stopped from this host
+	remoteAddr = "192.0.2.1:51678"
+	recorder = performLocalTasksRequest(true, "POST", v1.LocalTasksPath,
+		`{"taskDefinition":{"family":"local","containerDefinitions":[{"name":"app","image":"busybox"}]}}`)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Len(t, localTasks.launched, 1)
+	recorder = performLocalTasksRequest(true, "DELETE", v1.LocalTasksPath+"?taskarn="+fakeLocalTaskARN, "")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Len(t, localTasks.stopped, 1)
+}
+
 func TestListMultipleTasks(t *testing.T) {
 	recorder := performMockRequest(t, "/v1/tasks")
 
@@ -76,6 +665,41 @@ func TestListMultipleTasks(t *testing.T) {
 	taskDiffHelper(t, testTasks, tasksResponse)
 }
 
+// snapshotStateResolver is a task engine that provides a snapshot of its tasks.
+type snapshotStateResolver struct {
+	*mock_utils.MockDockerStateResolver
+	snapshot []*apitask.Task
+}
+
+func (r *snapshotStateResolver) TaskSnapshot() []*apitask.Task {
+	return r.snapshot
+}
+
+func TestListTasksFromSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	state := dockerstate.NewTaskEngineState()
+	stateSetupHelper(state, testTasks)
+	mockStateResolver := mock_utils.NewMockDockerStateResolver(ctrl)
+	mockStateResolver.EXPECT().State().Return(state)
+	// The tasks are listed from the snapshot, without its internal tasks
+	resolver := &snapshotStateResolver{
+		MockDockerStateResolver: mockStateResolver,
+		snapshot:                []*apitask.Task{testTasks[0], {Arn: "internal", IsInternal: true}},
+	}
+
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), resolver,
+		IntrospectionServerOptions{}, &config.Config{Cluster: testClusterArn})
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.TaskContainerMetadataPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	var tasksResponse v1.TasksResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &tasksResponse))
+	taskDiffHelper(t, testTasks[:1], tasksResponse)
+}
+
 func TestGetTaskByDockerID(t *testing.T) {
 	// stateSetupHelper uses the convention of dockerid-$arn-$containerName; the
 	// second task has a container named foo
@@ -299,7 +923,7 @@ func TestPProfHandlerSetup(t *testing.T) {
 					assert.Equal(t, p, recorder.Body.String())
 				} else {
 					assert.Equal(t, http.StatusOK, recorder.Code)
-					assert.Equal(t, `{"AvailableCommands":["/v1/metadata","/v1/tasks","/license"]}`, recorder.Body.String())
+					assert.Equal(t, `{"AvailableCommands":["/v1/metadata","/v1/tasks","/license","/v1/drain","/v1/images/prefetch","/v1/credentials/entries","/v1/capabilities","/v1/handlers/stats","/v1/aws-endpoints","/v1/payloads/rejections","/v1/connections"]}`, recorder.Body.String())
 
 				}
 			})
@@ -481,10 +1105,11 @@ func performMockRequest(t *testing.T, path string) *httptest.ResponseRecorder {
 		mockStateResolver.EXPECT().State().Return(state)
 	}
 
-	requestHandler := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), mockStateResolver, &config.Config{
-		Cluster:            testClusterArn,
-		EnableRuntimeStats: runtimeStatsConfigForTest,
-	})
+	requestHandler := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), mockStateResolver,
+		IntrospectionServerOptions{}, &config.Config{
+			Cluster:            testClusterArn,
+			EnableRuntimeStats: runtimeStatsConfigForTest,
+		})
 
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", path, nil)
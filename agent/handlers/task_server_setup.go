@@ -15,10 +15,16 @@ package handlers
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	agentAPITaskProtectionV1 "github.com/aws/amazon-ecs-agent/agent/handlers/agentapi/taskprotection/v1/handlers"
@@ -27,6 +33,8 @@ import (
 	v4 "github.com/aws/amazon-ecs-agent/agent/handlers/v4"
 	"github.com/aws/amazon-ecs-agent/agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/agent/stats"
+	"github.com/aws/amazon-ecs-agent/agent/sts"
+	agentversion "github.com/aws/amazon-ecs-agent/agent/version"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 	auditinterface "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
@@ -34,6 +42,8 @@ import (
 	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
 	tmdsv2 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v2"
 	tmdsv4 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v4"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/session"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/retry"
 	"github.com/cihub/seelog"
 	"github.com/gorilla/mux"
@@ -57,10 +67,14 @@ func taskServerSetup(credentialsManager credentials.Manager,
 	statsEngine stats.Engine,
 	steadyStateRate int,
 	burstRate int,
+	slowRequestThreshold time.Duration,
+	serverOpts []tmds.ConfigOpt,
 	availabilityZone string,
 	vpcID string,
 	containerInstanceArn string,
+	tagsCache *v2.ResourceTagsCache,
 	taskProtectionClientFactory agentAPITaskProtectionV1.TaskProtectionClientFactoryInterface,
+	credentialsOpts ...tmdsv1.ConfigOpt,
 ) (*http.Server, error) {
 
 	muxRouter := mux.NewRouter()
@@ -69,24 +83,44 @@ func taskServerSetup(credentialsManager credentials.Manager,
 	// to permanently redirect(301) to "/v3/metadata/task" handler
 	muxRouter.SkipClean(false)
 
-	muxRouter.HandleFunc(tmdsv1.CredentialsPath,
-		tmdsv1.CredentialsHandler(credentialsManager, auditLogger))
+	tmdsv1.RegisterCredentialsHandler(muxRouter, credentialsManager, auditLogger, credentialsOpts...)
 
-	v2HandlersSetup(muxRouter, state, ecsClient, statsEngine, cluster, credentialsManager, auditLogger, availabilityZone, containerInstanceArn)
+	v2HandlersSetup(muxRouter, state, ecsClient, statsEngine, cluster, credentialsManager, auditLogger, availabilityZone, containerInstanceArn, credentialsOpts...)
 
 	v3HandlersSetup(muxRouter, state, ecsClient, statsEngine, cluster, availabilityZone, containerInstanceArn)
 
-	v4HandlersSetup(muxRouter, state, ecsClient, statsEngine, cluster, availabilityZone, vpcID, containerInstanceArn)
+	v4HandlersSetup(muxRouter, state, ecsClient, statsEngine, cluster, credentialsManager, auditLogger, availabilityZone, vpcID, containerInstanceArn, tagsCache, credentialsOpts...)
 
 	agentAPIV1HandlersSetup(muxRouter, state, credentialsManager, cluster, taskProtectionClientFactory)
 
-	return tmds.NewServer(auditLogger,
+	return tmds.NewServer(auditLogger, append([]tmds.ConfigOpt{
 		tmds.WithHandler(muxRouter),
 		tmds.WithListenAddress(tmds.AddressIPv4()),
 		tmds.WithReadTimeout(readTimeout),
 		tmds.WithWriteTimeout(writeTimeout),
 		tmds.WithSteadyStateRate(float64(steadyStateRate)),
-		tmds.WithBurstRate(burstRate))
+		tmds.WithBurstRate(burstRate),
+		// Slow requests are logged even if the latencies of requests are not recorded, the
+		// metrics factory is overridden by serverOpts
+		tmds.WithRequestMetrics(metrics.NewNopEntryFactory(), slowRequestThreshold),
+	}, serverOpts...)...)
+}
+
+// localEndpointServerOpts returns the options of the task metadata server that bound the
+// time taken to read request headers and the size of requests, that enable the log level
+// and trace context headers of requests, that set the response jitter, that enable path
+// normalization, and that honor the forwarded prefix header of requests.
+func localEndpointServerOpts(cfg *config.Config) []tmds.ConfigOpt {
+	return []tmds.ConfigOpt{
+		tmds.WithReadHeaderTimeout(cfg.LocalEndpointReadHeaderTimeout),
+		tmds.WithMaxHeaderBytes(cfg.LocalEndpointMaxHeaderBytes),
+		tmds.WithMaxRequestBodyBytes(cfg.LocalEndpointMaxRequestBodyBytes),
+		tmds.WithLogLevelHeader(cfg.LocalEndpointLogLevelHeaderEnabled.Enabled()),
+		tmds.WithTraceContext(cfg.LocalEndpointTraceContextEnabled.Enabled()),
+		tmds.WithResponseJitter(cfg.LocalEndpointResponseJitter),
+		tmds.WithPathNormalization(cfg.LocalEndpointPathNormalization.Enabled()),
+		tmds.WithForwardedPrefix(cfg.LocalEndpointForwardedPrefixEnabled.Enabled()),
+	}
 }
 
 // v2HandlersSetup adds all handlers in v2 package to the mux router.
@@ -98,16 +132,17 @@ func v2HandlersSetup(muxRouter *mux.Router,
 	credentialsManager credentials.Manager,
 	auditLogger auditinterface.AuditLogger,
 	availabilityZone string,
-	containerInstanceArn string) {
-	muxRouter.HandleFunc(tmdsv2.CredentialsPath, tmdsv2.CredentialsHandler(credentialsManager, auditLogger))
-	muxRouter.HandleFunc(v2.ContainerMetadataPath, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false))
-	muxRouter.HandleFunc(v2.TaskMetadataPath, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false))
-	muxRouter.HandleFunc(v2.TaskWithTagsMetadataPath, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, true))
-	muxRouter.HandleFunc(v2.TaskMetadataPathWithSlash, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false))
-	muxRouter.HandleFunc(v2.TaskWithTagsMetadataPathWithSlash, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, true))
-	muxRouter.HandleFunc(v2.ContainerStatsPath, v2.TaskContainerStatsHandler(state, statsEngine))
-	muxRouter.HandleFunc(v2.TaskStatsPath, v2.TaskContainerStatsHandler(state, statsEngine))
-	muxRouter.HandleFunc(v2.TaskStatsPathWithSlash, v2.TaskContainerStatsHandler(state, statsEngine))
+	containerInstanceArn string,
+	credentialsOpts ...tmdsv1.ConfigOpt) {
+	muxRouter.HandleFunc(tmdsv2.CredentialsPath, tmdsv2.CredentialsHandler(credentialsManager, auditLogger, credentialsOpts...)).Name("v2/credentials")
+	muxRouter.HandleFunc(v2.ContainerMetadataPath, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false)).Name("v2/container-metadata")
+	muxRouter.HandleFunc(v2.TaskMetadataPath, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false)).Name("v2/task-metadata")
+	muxRouter.HandleFunc(v2.TaskWithTagsMetadataPath, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, true)).Name("v2/task-metadata-with-tags")
+	muxRouter.HandleFunc(v2.TaskMetadataPathWithSlash, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false)).Name("v2/task-metadata-with-slash")
+	muxRouter.HandleFunc(v2.TaskWithTagsMetadataPathWithSlash, v2.TaskContainerMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, true)).Name("v2/task-metadata-with-tags-with-slash")
+	muxRouter.HandleFunc(v2.ContainerStatsPath, v2.TaskContainerStatsHandler(state, statsEngine)).Name("v2/container-stats")
+	muxRouter.HandleFunc(v2.TaskStatsPath, v2.TaskContainerStatsHandler(state, statsEngine)).Name("v2/task-stats")
+	muxRouter.HandleFunc(v2.TaskStatsPathWithSlash, v2.TaskContainerStatsHandler(state, statsEngine)).Name("v2/task-stats-with-slash")
 }
 
 // v3HandlersSetup adds all handlers in v3 package to the mux router.
@@ -118,14 +153,14 @@ func v3HandlersSetup(muxRouter *mux.Router,
 	cluster string,
 	availabilityZone string,
 	containerInstanceArn string) {
-	muxRouter.HandleFunc(v3.ContainerMetadataPath, v3.ContainerMetadataHandler(state))
-	muxRouter.HandleFunc(v3.TaskMetadataPath, v3.TaskMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false))
-	muxRouter.HandleFunc(v3.TaskWithTagsMetadataPath, v3.TaskMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, true))
-	muxRouter.HandleFunc(v3.ContainerStatsPath, v3.ContainerStatsHandler(state, statsEngine))
-	muxRouter.HandleFunc(v3.TaskStatsPath, v3.TaskStatsHandler(state, statsEngine))
-	muxRouter.HandleFunc(v3.ContainerAssociationsPath, v3.ContainerAssociationsHandler(state))
-	muxRouter.HandleFunc(v3.ContainerAssociationPathWithSlash, v3.ContainerAssociationHandler(state))
-	muxRouter.HandleFunc(v3.ContainerAssociationPath, v3.ContainerAssociationHandler(state))
+	muxRouter.HandleFunc(v3.ContainerMetadataPath, v3.ContainerMetadataHandler(state)).Name("v3/container-metadata")
+	muxRouter.HandleFunc(v3.TaskMetadataPath, v3.TaskMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, false)).Name("v3/task-metadata")
+	muxRouter.HandleFunc(v3.TaskWithTagsMetadataPath, v3.TaskMetadataHandler(state, ecsClient, cluster, availabilityZone, containerInstanceArn, true)).Name("v3/task-metadata-with-tags")
+	muxRouter.HandleFunc(v3.ContainerStatsPath, v3.ContainerStatsHandler(state, statsEngine)).Name("v3/container-stats")
+	muxRouter.HandleFunc(v3.TaskStatsPath, v3.TaskStatsHandler(state, statsEngine)).Name("v3/task-stats")
+	muxRouter.HandleFunc(v3.ContainerAssociationsPath, v3.ContainerAssociationsHandler(state)).Name("v3/container-associations")
+	muxRouter.HandleFunc(v3.ContainerAssociationPathWithSlash, v3.ContainerAssociationHandler(state)).Name("v3/container-association-with-slash")
+	muxRouter.HandleFunc(v3.ContainerAssociationPath, v3.ContainerAssociationHandler(state)).Name("v3/container-association")
 }
 
 // v4HandlerSetup adda all handlers in v4 package to the mux router
@@ -134,20 +169,29 @@ func v4HandlersSetup(muxRouter *mux.Router,
 	ecsClient api.ECSClient,
 	statsEngine stats.Engine,
 	cluster string,
+	credentialsManager credentials.Manager,
+	auditLogger auditinterface.AuditLogger,
 	availabilityZone string,
 	vpcID string,
 	containerInstanceArn string,
+	tagsCache *v2.ResourceTagsCache,
+	credentialsOpts ...tmdsv1.ConfigOpt,
 ) {
-	tmdsAgentState := v4.NewTMDSAgentState(state, ecsClient, cluster, availabilityZone, vpcID, containerInstanceArn)
+	tmdsAgentState := v4.NewTMDSAgentState(state, ecsClient, cluster, availabilityZone, vpcID, containerInstanceArn, tagsCache)
 	metricsFactory := metrics.NewNopEntryFactory()
-	muxRouter.HandleFunc(tmdsv4.ContainerMetadataPath(), tmdsv4.ContainerMetadataHandler(tmdsAgentState, metricsFactory))
-	muxRouter.HandleFunc(tmdsv4.TaskMetadataPath(), tmdsv4.TaskMetadataHandler(tmdsAgentState, metricsFactory))
-	muxRouter.HandleFunc(tmdsv4.TaskMetadataWithTagsPath(), tmdsv4.TaskMetadataWithTagsHandler(tmdsAgentState, metricsFactory))
-	muxRouter.HandleFunc(v4.ContainerStatsPath, v4.ContainerStatsHandler(state, statsEngine))
-	muxRouter.HandleFunc(v4.TaskStatsPath, v4.TaskStatsHandler(state, statsEngine))
-	muxRouter.HandleFunc(v4.ContainerAssociationsPath, v4.ContainerAssociationsHandler(state))
-	muxRouter.HandleFunc(v4.ContainerAssociationPathWithSlash, v4.ContainerAssociationHandler(state))
-	muxRouter.HandleFunc(v4.ContainerAssociationPath, v4.ContainerAssociationHandler(state))
+	muxRouter.HandleFunc(tmdsv4.ContainerMetadataPath(), tmdsv4.ContainerMetadataHandler(tmdsAgentState, metricsFactory)).Name("v4/container-metadata")
+	muxRouter.HandleFunc(tmdsv4.TaskMetadataPath(), tmdsv4.TaskMetadataHandler(tmdsAgentState, metricsFactory)).Name("v4/task-metadata")
+	muxRouter.HandleFunc(tmdsv4.TaskMetadataWithTagsPath(), tmdsv4.TaskMetadataWithTagsHandler(tmdsAgentState, metricsFactory)).Name("v4/task-metadata-with-tags")
+	muxRouter.HandleFunc(tmdsv4.TaskMetadataWithCredentialsPath(),
+		tmdsv4.TaskMetadataWithCredentialsHandler(tmdsAgentState, credentialsManager, auditLogger, metricsFactory,
+			credentialsOpts...)).
+		Name("v4/task-metadata-with-credentials")
+	muxRouter.HandleFunc(v4.ContainerStatsPath, v4.ContainerStatsHandler(state, statsEngine)).Name("v4/container-stats")
+	muxRouter.HandleFunc(v4.TaskStatsPath, v4.TaskStatsHandler(state, statsEngine)).Name("v4/task-stats")
+	muxRouter.HandleFunc(v4.ContainerStatusPath, v4.ContainerStatusHandler(state)).Name("v4/container-status")
+	muxRouter.HandleFunc(v4.ContainerAssociationsPath, v4.ContainerAssociationsHandler(state)).Name("v4/container-associations")
+	muxRouter.HandleFunc(v4.ContainerAssociationPathWithSlash, v4.ContainerAssociationHandler(state)).Name("v4/container-association-with-slash")
+	muxRouter.HandleFunc(v4.ContainerAssociationPath, v4.ContainerAssociationHandler(state)).Name("v4/container-association")
 }
 
 // agentAPIV1HandlersSetup adds handlers for Agent API V1
@@ -162,16 +206,38 @@ func agentAPIV1HandlersSetup(
 		HandleFunc(
 			agentAPITaskProtectionV1.TaskProtectionPath(),
 			agentAPITaskProtectionV1.UpdateTaskProtectionHandler(state, credentialsManager, factory, cluster)).
-		Methods("PUT")
+		Methods("PUT").
+		Name("agent-api/v1/update-task-protection")
 	muxRouter.
 		HandleFunc(
 			agentAPITaskProtectionV1.TaskProtectionPath(),
 			agentAPITaskProtectionV1.GetTaskProtectionHandler(state, credentialsManager, factory, cluster)).
-		Methods("GET")
+		Methods("GET").
+		Name("agent-api/v1/get-task-protection")
+}
+
+// TaskServerOptions are the optional sources of the credentials handlers of the task
+// server. Any of them may be nil.
+type TaskServerOptions struct {
+	// ReconciliationGate holds back credentials until it is marked reconciled
+	ReconciliationGate *tmdsv1.ReconciliationGate
+	// ClockSkew estimates the skew of the host clock that is reported with credentials
+	ClockSkew clockdrift.Estimator
+	// CredentialsTunables are the tunables of the credentials handlers
+	CredentialsTunables *tmdsv1.TunablesHolder
+	// HandlerStats count credentials requests, throttled requests and the hits and misses
+	// of the tags cache
+	HandlerStats *tmdsv1.RuntimeStats
+	// CredentialsMaintenance pauses credential serving while it is paused
+	CredentialsMaintenance *tmdsv1.MaintenanceToggle
+	// CredentialsFetchDigest counts the credentials fetches of each task ARN over windows
+	CredentialsFetchDigest *tmdsv1.FetchDigest
+	// MetricsFactory records the latency of requests, they are not recorded if it is nil
+	MetricsFactory metrics.EntryFactory
 }
 
 // ServeTaskHTTPEndpoint serves task/container metadata, task/container stats, IAM Role Credentials, and Agent APIs
-// for tasks being managed by the agent.
+// for tasks being managed by the agent. The optional sources of the credentials handlers are in opts.
 func ServeTaskHTTPEndpoint(
 	ctx context.Context,
 	credentialsManager credentials.Manager,
@@ -181,7 +247,8 @@ func ServeTaskHTTPEndpoint(
 	cfg *config.Config,
 	statsEngine stats.Engine,
 	availabilityZone string,
-	vpcID string) {
+	vpcID string,
+	opts TaskServerOptions) {
 	// Create and initialize the audit log
 	logger, err := seelog.LoggerFromConfigAsString(audit.AuditLoggerConfig(cfg))
 	if err != nil {
@@ -191,20 +258,139 @@ func ServeTaskHTTPEndpoint(
 	}
 
 	auditLogger := audit.NewAuditLog(containerInstanceArn, cfg, logger)
+	if cfg.CredentialsAuditLogSyslog != "" {
+		// The audit log file is used while syslog is unavailable
+		auditLogger = syslogAuditLog(containerInstanceArn, cfg, logger, auditLogger)
+	}
 
 	taskProtectionClientFactory := agentAPITaskProtectionV1.TaskProtectionClientFactory{
 		Region: cfg.AWSRegion, Endpoint: cfg.APIEndpoint, AcceptInsecureCert: cfg.AcceptInsecureCert,
 	}
+	// Credentials are held back until the agent has reconciled its state after starting
+	credentialsOpts := []tmdsv1.ConfigOpt{
+		tmdsv1.WithReconciliationGate(opts.ReconciliationGate),
+		tmdsv1.WithClockSkewEstimator(opts.ClockSkew),
+		tmdsv1.WithTunables(opts.CredentialsTunables),
+		tmdsv1.WithV1Disabled(cfg.CredentialsV1EndpointDisabled.Enabled()),
+		tmdsv1.WithMaintenanceToggle(opts.CredentialsMaintenance),
+		tmdsv1.WithNotFoundRetryAfter(cfg.CredentialsNotFoundRetryAfter),
+		tmdsv1.WithAgentVersion(agentversion.Version),
+	}
+	switch strings.ToLower(cfg.CredentialsResponseSchemaValidation) {
+	case "log":
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithSchemaValidation(tmdsv1.SchemaValidationLog))
+	case "enforce":
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithSchemaValidation(tmdsv1.SchemaValidationEnforce))
+	}
+	if cfg.CredentialsSigningKeyFile != "" {
+		signer, err := PreSharedKeySigner(cfg.CredentialsSigningKeyFile)
+		if err != nil {
+			seelog.Criticalf("Failed to set up the signing of credentials responses: %v", err)
+			return
+		}
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithResponseSigner(signer))
+	} else if cfg.CredentialsResponseSigningEnabled.Enabled() {
+		// The public key of the signer is served along with the credentials
+		signer, err := tmdsv1.NewResponseSigner()
+		if err != nil {
+			seelog.Criticalf("Failed to set up the signing of credentials responses: %v", err)
+			return
+		}
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithResponseSigner(signer))
+	}
+	if faults := CredentialsFaults(cfg); len(faults) > 0 {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithUnsafeFaultInjection(faults))
+	}
+	if cfg.CredentialsRequireRunningTask.Enabled() {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithTaskRunningGate(TaskStatusLookup(state)))
+	}
+	if cfg.CredentialsExpectedLocalPort != 0 {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithExpectedLocalPort(cfg.CredentialsExpectedLocalPort))
+	}
+	if cfg.CredentialsRefreshAfterMargin > 0 {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithRefreshAfterMargin(cfg.CredentialsRefreshAfterMargin))
+	}
+	if cfg.CredentialsPartitionCheckEnabled.Enabled() {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithPartitionCheck(true))
+	}
+	if cfg.CredentialsChecksumTrailerEnabled.Enabled() {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithChecksumTrailer(true))
+	}
+	if cfg.CredentialsSTSValidationEnabled.Enabled() {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithCredentialsValidation(
+			sts.NewCredentialsValidator(cfg.AWSRegion), 0, 0))
+	}
+	if cfg.CredentialsHeaderGuardEnabled.Enabled() {
+		// The heuristics are validated when the config is loaded
+		heuristics, err := cfg.SuspiciousHeaderHeuristics()
+		if err != nil {
+			seelog.Criticalf("Failed to set up the suspicious header guard of the credentials handlers: %v", err)
+			return
+		}
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithSuspiciousHeaderGuard(heuristics...))
+	}
+	if cfg.CredentialsEMFMetricsEnabled.Enabled() {
+		credentialsOpts = append(credentialsOpts,
+			tmdsv1.WithRequestObserver(tmdsv1.NewEMFObserver(os.Stdout, tmdsv1.DefaultEMFNamespace)))
+	}
+	if cfg.CredentialsStatsDEndpoint != "" {
+		statsDObserver, err := tmdsv1.NewStatsDObserver(cfg.CredentialsStatsDEndpoint, tmdsv1.DefaultStatsDPrefix)
+		if err != nil {
+			seelog.Errorf("Error initializing the StatsD metrics of credentials requests: %v", err)
+		} else {
+			// The task server runs until the agent stops, so the observer is closed then
+			go func() {
+				<-ctx.Done()
+				statsDObserver.Close()
+			}()
+			credentialsOpts = append(credentialsOpts, tmdsv1.WithRequestObserver(statsDObserver))
+		}
+	}
+	serverOpts := localEndpointServerOpts(cfg)
+	if cfg.TaskMetadataSessionTokenMode != "" {
+		serverOpts = append(serverOpts, tmds.WithSessionTokens(session.Mode(cfg.TaskMetadataSessionTokenMode),
+			session.WithCaller(SessionCaller(state))))
+	}
+	tagsCache := v2.NewResourceTagsCache(ecsClient, cfg.TaskMetadataTagsCacheTTL)
+	if handlerStats := opts.HandlerStats; handlerStats != nil {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithRequestObserver(handlerStats))
+		serverOpts = append(serverOpts, tmds.WithLimitReachedObserver(func(*http.Request) {
+			handlerStats.RecordThrottle()
+		}))
+		tagsCache.SetStatsRecorder(handlerStats)
+	}
+	if opts.CredentialsFetchDigest != nil {
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithRequestObserver(opts.CredentialsFetchDigest))
+	}
+	// Cached credentials responses are refreshed once the credentials are replaced, until
+	// the agent stops
+	var refreshScheduler *tmdsv1.RefreshScheduler
+	if cfg.CredentialsPreExpiryRefreshMargin > 0 {
+		refreshScheduler = tmdsv1.NewRefreshScheduler(tmdsv1.NewMemoryResponseCache(tmdsv1.DefaultResponseCacheSize),
+			credentialsManager, cfg.CredentialsPreExpiryRefreshMargin)
+		credentialsOpts = append(credentialsOpts, tmdsv1.WithResponseCache(refreshScheduler))
+	}
+	if opts.MetricsFactory != nil {
+		serverOpts = append(serverOpts,
+			tmds.WithRequestMetrics(opts.MetricsFactory, cfg.LocalEndpointSlowRequestThreshold))
+	}
 	server, err := taskServerSetup(credentialsManager, auditLogger, state, ecsClient, cfg.Cluster,
-		statsEngine, cfg.TaskMetadataSteadyStateRate, cfg.TaskMetadataBurstRate,
-		availabilityZone, vpcID, containerInstanceArn, taskProtectionClientFactory)
+		statsEngine, cfg.TaskMetadataSteadyStateRate, cfg.TaskMetadataBurstRate, cfg.LocalEndpointSlowRequestThreshold,
+		serverOpts, availabilityZone, vpcID, containerInstanceArn, tagsCache, taskProtectionClientFactory,
+		credentialsOpts...)
 	if err != nil {
 		seelog.Criticalf("Failed to set up Task Metadata Server: %v", err)
 		return
 	}
 
+	if refreshScheduler != nil {
+		refreshScheduler.Start(ctx)
+	}
 	go func() {
 		<-ctx.Done()
+		if refreshScheduler != nil {
+			refreshScheduler.Stop()
+		}
 		if err := server.Shutdown(context.Background()); err != nil {
 			// Error from closing listeners, or context timeout:
 			seelog.Infof("HTTP server Shutdown: %v", err)
@@ -222,3 +408,122 @@ func ServeTaskHTTPEndpoint(
 		})
 	}
 }
+
+// PreSharedKeySigner returns a signer of credentials responses with the base64 encoded
+// pre-shared key in the key file. The key file is validated when the config is loaded.
+func PreSharedKeySigner(keyFile string) (*tmdsv1.ResponseSigner, error) {
+	key, err := config.ReadCredentialsSigningKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return tmdsv1.NewPreSharedKeySigner(key)
+}
+
+// TaskStatusLookup returns a lookup of the statuses of the tasks in the state for the task
+// running gate of the credentials handlers. Tasks can be served credentials until they
+// start stopping, so that containers that start before the task is running can get them.
+func TaskStatusLookup(state dockerstate.TaskEngineState) tmdsv1.TaskStatusLookup {
+	return func(taskARN string) (string, bool) {
+		task, ok := state.TaskByArn(taskARN)
+		if !ok {
+			return "UNKNOWN", false
+		}
+		knownStatus := task.GetKnownStatus()
+		if knownStatus >= apitaskstatus.TaskStopped {
+			return knownStatus.String(), false
+		}
+		if task.GetDesiredStatus() >= apitaskstatus.TaskStopped {
+			return "STOPPING", false
+		}
+		return knownStatus.String(), true
+	}
+}
+
+// SessionCaller identifies the callers of the task metadata endpoints that session tokens
+// are scoped to by their source IP and the task that the IP belongs to, if any, so that
+// session tokens can't be replayed by a task that is later assigned the IP. The IPs of
+// awsvpc tasks are looked up in the state, and the IPs of the running containers of bridge
+// mode tasks are looked up in their network settings. Callers whose IPs belong to no task,
+// such as containers sharing the network of the host, are identified by their IPs only.
+func SessionCaller(state dockerstate.TaskEngineState) session.CallerFunc {
+	return func(r *http.Request) (string, error) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return "", err
+		}
+		if taskARN, ok := state.GetTaskByIPAddress(ip); ok {
+			return ip + " " + taskARN, nil
+		}
+		if taskARN, ok := bridgeTaskByContainerIP(state, ip); ok {
+			return ip + " " + taskARN, nil
+		}
+		return ip, nil
+	}
+}
+
+// bridgeTaskByContainerIP returns the arn of the task with a running container whose
+// bridge network IP is the given IP. Containers that aren't running are skipped, as their
+// IPs may have been assigned to containers of other tasks since they stopped.
+func bridgeTaskByContainerIP(state dockerstate.TaskEngineState, ip string) (string, bool) {
+	for _, task := range state.AllTasks() {
+		if task.GetKnownStatus() >= apitaskstatus.TaskStopped {
+			continue
+		}
+		for _, container := range task.Containers {
+			if container.GetKnownStatus() != apicontainerstatus.ContainerRunning {
+				continue
+			}
+			settings := container.GetNetworkSettings()
+			if settings == nil {
+				continue
+			}
+			if settings.IPAddress == ip {
+				return task.Arn, true
+			}
+			if network, ok := settings.Networks[apitask.BridgeNetworkMode]; ok && network != nil && network.IPAddress == ip {
+				return task.Arn, true
+			}
+		}
+	}
+	return "", false
+}
+
+// CredentialsFaults returns the faults that are injected into credentials responses, as
+// set in the config.
+func CredentialsFaults(cfg *config.Config) map[string]tmdsv1.Fault {
+	if len(cfg.CredentialsFaultInjection) == 0 {
+		return nil
+	}
+	faults := make(map[string]tmdsv1.Fault, len(cfg.CredentialsFaultInjection))
+	for credentialsID, fault := range cfg.CredentialsFaultInjection {
+		faults[credentialsID] = tmdsv1.Fault{Type: tmdsv1.FaultType(fault.Type), Delay: fault.Delay}
+	}
+	return faults
+}
+
+// CredentialsTunables returns the tunables of the credentials handlers that are set in the
+// config. They can be swapped on the running agent when the config is reloaded.
+func CredentialsTunables(cfg *config.Config) tmdsv1.Tunables {
+	return tmdsv1.Tunables{
+		RequestsPerSecond: float64(cfg.CredentialsSteadyStateRate),
+		Burst:             cfg.CredentialsBurstRate,
+		AllowedRoleTypes:  cfg.CredentialsAllowedRoleTypes,
+		RequestLogLevel:   cfg.CredentialsRequestLogLevel,
+	}
+}
+
+// syslogAuditLog returns the audit log sending its entries to syslog, or the file audit log
+// if the syslog configuration is invalid.
+func syslogAuditLog(containerInstanceArn string, cfg *config.Config, fallback audit.InfoLogger,
+	fileAuditLogger auditinterface.AuditLogger) auditinterface.AuditLogger {
+	syslogCfg, err := audit.ParseSyslogConfig(cfg)
+	if err == nil {
+		var syslogAuditLogger auditinterface.AuditLogger
+		syslogAuditLogger, err = audit.NewSyslogAuditLog(containerInstanceArn, cfg, syslogCfg, fallback)
+		if err == nil {
+			return syslogAuditLogger
+		}
+	}
+	seelog.Errorf("Error initializing the syslog audit log, audit log entries are logged to the audit log file: %v", err)
+	return fileAuditLogger
+}
@@ -18,6 +18,7 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -26,6 +27,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -39,6 +43,8 @@ import (
 	agentapihandlers "github.com/aws/amazon-ecs-agent/agent/handlers/agentapi/taskprotection/v1/handlers"
 	task_protection_v1 "github.com/aws/amazon-ecs-agent/agent/handlers/agentapi/taskprotection/v1/handlers"
 	agentapi "github.com/aws/amazon-ecs-agent/agent/handlers/agentapi/taskprotection/v1/types"
+	v1 "github.com/aws/amazon-ecs-agent/agent/handlers/v1"
+	handlersv2 "github.com/aws/amazon-ecs-agent/agent/handlers/v2"
 	v3 "github.com/aws/amazon-ecs-agent/agent/handlers/v3"
 	"github.com/aws/amazon-ecs-agent/agent/stats"
 	mock_stats "github.com/aws/amazon-ecs-agent/agent/stats/mock"
@@ -52,11 +58,13 @@ import (
 	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
 	v2 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v2"
 	v4 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v4/state"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/session"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -783,8 +791,9 @@ func testErrorResponsesFromServer(t *testing.T, path string, expectedErrorMessag
 	auditLog := mock_audit.NewMockAuditLogger(ctrl)
 	ecsClient := mock_api.NewMockECSClient(ctrl)
 	server, err := taskServerSetup(credentialsManager, auditLog, nil, ecsClient, "", nil,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 
 	recorder := httptest.NewRecorder()
@@ -809,6 +818,233 @@ func testErrorResponsesFromServer(t *testing.T, path string, expectedErrorMessag
 	}
 }
 
+// TestCredentialsRequestsBeforeReconciliation tests that the credentials endpoints answer
+// with a 503 until the reconciliation gate is marked reconciled.
+func TestCredentialsRequestsBeforeReconciliation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+	auditLog := mock_audit.NewMockAuditLogger(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	gate := tmdsv1.NewReconciliationGate(5 * time.Second)
+	server, err := taskServerSetup(credentialsManager, auditLog, nil, ecsClient, "", nil,
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl),
+		tmdsv1.WithReconciliationGate(gate))
+	require.NoError(t, err)
+
+	paths := []string{
+		credentials.V1CredentialsPath + "?id=" + credentialsID,
+		credentials.V2CredentialsPath + "/" + credentialsID,
+	}
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusServiceUnavailable, gomock.Any()).Times(len(paths))
+	for _, path := range paths {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		server.Handler.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(t, "5", recorder.Header().Get(tmdsv1.RetryAfterHeader))
+		errorMessage := &utils.ErrorMessage{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), errorMessage))
+		assert.Equal(t, tmdsv1.ErrStateReconciling, errorMessage.Code)
+	}
+
+	gate.MarkReconciled()
+	credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(credentials.TaskIAMRoleCredentials{}, false)
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusBadRequest, gomock.Any())
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", paths[0], nil)
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// TestCredentialsV1Disabled tests that the v1 credentials endpoint answers with a 404 when
+// it's disabled, while the v2 credentials endpoint keeps serving credentials.
+func TestCredentialsV1Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+	auditLog := mock_audit.NewMockAuditLogger(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	server, err := taskServerSetup(credentialsManager, auditLog, nil, ecsClient, "", nil,
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl),
+		tmdsv1.WithV1Disabled(true))
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", credentials.V1CredentialsPath+"?id="+credentialsID, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(credentials.TaskIAMRoleCredentials{
+		ARN: taskARN,
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: credentialsID,
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}, true)
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusOK, gomock.Any())
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", credentials.V2CredentialsPath+"/"+credentialsID, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// TestPreSharedKeySigner tests that credentials responses are signed with the pre-shared
+// key of the key file in the X-Amzn-Signature header.
+func TestPreSharedKeySigner(t *testing.T) {
+	dir := t.TempDir()
+	_, err := PreSharedKeySigner(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+
+	invalidKeyFile := filepath.Join(dir, "invalid")
+	require.NoError(t, os.WriteFile(invalidKeyFile, []byte("not base64!"), 0600))
+	_, err = PreSharedKeySigner(invalidKeyFile)
+	assert.Error(t, err)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+	signer, err := PreSharedKeySigner(keyFile)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+	auditLog := mock_audit.NewMockAuditLogger(ctrl)
+	server, err := taskServerSetup(credentialsManager, auditLog, nil, mock_api.NewMockECSClient(ctrl), "", nil,
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl),
+		tmdsv1.WithResponseSigner(signer))
+	require.NoError(t, err)
+
+	credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(credentials.TaskIAMRoleCredentials{}, false)
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusBadRequest, gomock.Any())
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", credentials.V2CredentialsPath+"/"+credentialsID, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	verifier, err := tmdsv1.NewPreSharedKeySigner(key)
+	require.NoError(t, err)
+	assert.True(t, verifier.Verify(recorder.Body.Bytes(), recorder.Header().Get(tmdsv1.SignatureHeader)))
+}
+
+// TestResponseSigningPublicKey tests that credentials responses are signed with a per-boot
+// key whose public key is served by the task server.
+func TestResponseSigningPublicKey(t *testing.T) {
+	signer, err := tmdsv1.NewResponseSigner()
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+	auditLog := mock_audit.NewMockAuditLogger(ctrl)
+	server, err := taskServerSetup(credentialsManager, auditLog, nil, mock_api.NewMockECSClient(ctrl), "", nil,
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl),
+		tmdsv1.WithResponseSigner(signer))
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", tmdsv1.SigningKeyPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var signingKey tmdsv1.SigningKeyResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &signingKey))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(signer.PublicKey()), signingKey.PublicKey)
+
+	credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(credentials.TaskIAMRoleCredentials{}, false)
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusBadRequest, gomock.Any())
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", credentials.V2CredentialsPath+"/"+credentialsID, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	assert.True(t, signer.Verify(recorder.Body.Bytes(), recorder.Header().Get(tmdsv1.CredentialsSignatureHeader)))
+}
+
+// TestCredentialsFaultInjection tests that the faults set in the config are injected into
+// the credentials responses of their credentials IDs.
+func TestCredentialsFaultInjection(t *testing.T) {
+	assert.Nil(t, CredentialsFaults(&config.Config{}))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+	auditLog := mock_audit.NewMockAuditLogger(ctrl)
+	cfg := &config.Config{CredentialsFaultInjection: map[string]config.CredentialsFault{
+		credentialsID: {Type: string(tmdsv1.FaultServiceUnavailable)},
+	}}
+	server, err := taskServerSetup(credentialsManager, auditLog, nil, mock_api.NewMockECSClient(ctrl), "", nil,
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl),
+		tmdsv1.WithUnsafeFaultInjection(CredentialsFaults(cfg)))
+	require.NoError(t, err)
+
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusServiceUnavailable, gomock.Any())
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", credentials.V2CredentialsPath+"/"+credentialsID, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	var errorMessage utils.ErrorMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+	assert.Equal(t, tmdsv1.ErrInjectedFault, errorMessage.Code)
+}
+
+// TestCredentialsMaintenance tests that credential serving of the task server is paused and
+// resumed by loopback callers of the introspection server.
+func TestCredentialsMaintenance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+	auditLog := mock_audit.NewMockAuditLogger(ctrl)
+	toggle := tmdsv1.NewMaintenanceToggle()
+	taskServer, err := taskServerSetup(credentialsManager, auditLog, nil, mock_api.NewMockECSClient(ctrl), "", nil,
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl),
+		tmdsv1.WithMaintenanceToggle(toggle))
+	require.NoError(t, err)
+	introspectionServer := introspectionServerSetup(aws.String(containerInstanceArn), nil,
+		IntrospectionServerOptions{CredentialsMaintenance: toggle}, &config.Config{})
+
+	setPaused := func(remoteAddr string, paused bool) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", v1.CredentialsMaintenancePath,
+			strings.NewReader(fmt.Sprintf(`{"Paused": %t}`, paused)))
+		req.RemoteAddr = remoteAddr
+		introspectionServer.Handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	getCredentials := func() int {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", credentials.V2CredentialsPath+"/"+credentialsID, nil)
+		taskServer.Handler.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	// Other hosts can't pause credential serving
+	assert.Equal(t, http.StatusForbidden, setPaused("10.0.0.1:4567", true).Code)
+	assert.False(t, toggle.Paused())
+
+	recorder := setPaused("127.0.0.1:4567", true)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"Paused": true}`, recorder.Body.String())
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusServiceUnavailable, gomock.Any())
+	assert.Equal(t, http.StatusServiceUnavailable, getCredentials())
+
+	assert.Equal(t, http.StatusOK, setPaused("[::1]:4567", false).Code)
+	credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(credentials.TaskIAMRoleCredentials{}, false)
+	auditLog.EXPECT().Log(gomock.Any(), http.StatusBadRequest, gomock.Any())
+	assert.Equal(t, http.StatusBadRequest, getCredentials())
+}
+
 // getResponseForCredentialsRequestWithParameters queries credentials for the
 // given id. The getCredentials function is used to simulate getting the
 // credentials object from the CredentialsManager
@@ -820,8 +1056,9 @@ func getResponseForCredentialsRequest(t *testing.T, expectedStatus int,
 	auditLog := mock_audit.NewMockAuditLogger(ctrl)
 	ecsClient := mock_api.NewMockECSClient(ctrl)
 	server, err := taskServerSetup(credentialsManager, auditLog, nil, ecsClient, "", nil,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 
 	recorder := httptest.NewRecorder()
@@ -863,6 +1100,97 @@ func parseResponseBody(body *bytes.Buffer) (*credentials.IAMRoleCredentials, err
 	return &creds, nil
 }
 
+func TestTaskStatusLookup(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		desiredStatus  apitaskstatus.TaskStatus
+		knownStatus    apitaskstatus.TaskStatus
+		expectedStatus string
+		running        bool
+	}{
+		{"created", apitaskstatus.TaskRunning, apitaskstatus.TaskCreated, "CREATED", true},
+		{"running", apitaskstatus.TaskRunning, apitaskstatus.TaskRunning, "RUNNING", true},
+		{"stopping", apitaskstatus.TaskStopped, apitaskstatus.TaskRunning, "STOPPING", false},
+		{"stopped", apitaskstatus.TaskStopped, apitaskstatus.TaskStopped, "STOPPED", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+			state.EXPECT().TaskByArn(taskARN).Return(&apitask.Task{
+				Arn:                 taskARN,
+				DesiredStatusUnsafe: tc.desiredStatus,
+				KnownStatusUnsafe:   tc.knownStatus,
+			}, true)
+			status, running := TaskStatusLookup(state)(taskARN)
+			assert.Equal(t, tc.expectedStatus, status)
+			assert.Equal(t, tc.running, running)
+		})
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+	state.EXPECT().TaskByArn(taskARN).Return(nil, false)
+	_, running := TaskStatusLookup(state)(taskARN)
+	assert.False(t, running)
+}
+
+func TestSessionCaller(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+	bridgeContainer := func(ip string, status apicontainerstatus.ContainerStatus) *apicontainer.Container {
+		container := &apicontainer.Container{KnownStatusUnsafe: status}
+		container.SetNetworkSettings(&types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{apitask.BridgeNetworkMode: {IPAddress: ip}},
+		})
+		return container
+	}
+	stoppedTask := &apitask.Task{
+		Arn:               "stopped-task",
+		KnownStatusUnsafe: apitaskstatus.TaskStopped,
+		Containers:        []*apicontainer.Container{bridgeContainer("172.17.0.3", apicontainerstatus.ContainerStopped)},
+	}
+	bridgeTask := &apitask.Task{
+		Arn:               "bridge-task",
+		KnownStatusUnsafe: apitaskstatus.TaskRunning,
+		Containers: []*apicontainer.Container{
+			bridgeContainer("172.17.0.4", apicontainerstatus.ContainerStopped),
+			bridgeContainer("172.17.0.3", apicontainerstatus.ContainerRunning),
+		},
+	}
+	state.EXPECT().GetTaskByIPAddress("10.0.0.1").Return(taskARN, true)
+	state.EXPECT().GetTaskByIPAddress(gomock.Any()).Return("", false).AnyTimes()
+	state.EXPECT().AllTasks().Return([]*apitask.Task{stoppedTask, bridgeTask}).AnyTimes()
+	caller := SessionCaller(state)
+
+	req := httptest.NewRequest(http.MethodPut, session.TokenPath, nil)
+	req.RemoteAddr = "10.0.0.1:34567"
+	identity, err := caller(req)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1 "+taskARN, identity)
+
+	// Callers whose IPs belong to running bridge mode containers are identified by their
+	// tasks too
+	req.RemoteAddr = "172.17.0.3:34567"
+	identity, err = caller(req)
+	require.NoError(t, err)
+	assert.Equal(t, "172.17.0.3 bridge-task", identity)
+
+	// Callers whose IPs don't belong to a running container are identified by their IPs
+	for _, ip := range []string{"172.17.0.2", "172.17.0.4"} {
+		req.RemoteAddr = ip + ":34567"
+		identity, err = caller(req)
+		require.NoError(t, err)
+		assert.Equal(t, ip, identity)
+	}
+
+	req.RemoteAddr = "invalid"
+	_, err = caller(req)
+	assert.Error(t, err)
+}
+
 func TestV2ContainerStats(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -879,8 +1207,9 @@ func TestV2ContainerStats(t *testing.T) {
 		statsEngine.EXPECT().ContainerDockerStats(taskARN, containerID).Return(dockerStats, &stats.NetworkStatsPerSec{}, nil),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v2BaseStatsPath+"/"+containerID, nil)
@@ -930,8 +1259,9 @@ func TestV2TaskStats(t *testing.T) {
 				statsEngine.EXPECT().ContainerDockerStats(taskARN, containerID).Return(dockerStats, &stats.NetworkStatsPerSec{}, nil),
 			)
 			server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-				config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-				containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+				config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+				config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+				containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 			require.NoError(t, err)
 			recorder := httptest.NewRecorder()
 			req, _ := http.NewRequest("GET", tc.path, nil)
@@ -974,8 +1304,9 @@ func TestV3TaskStats(t *testing.T) {
 		statsEngine.EXPECT().ContainerDockerStats(taskARN, containerID).Return(dockerStats, &stats.NetworkStatsPerSec{}, nil),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v3BasePath+v3EndpointID+"/task/stats", nil)
@@ -1009,8 +1340,9 @@ func TestV3ContainerStats(t *testing.T) {
 		statsEngine.EXPECT().ContainerDockerStats(taskARN, containerID).Return(dockerStats, &stats.NetworkStatsPerSec{}, nil),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v3BasePath+v3EndpointID+"/stats", nil)
@@ -1040,8 +1372,9 @@ func TestV3ContainerAssociations(t *testing.T) {
 		state.EXPECT().TaskByArn(taskARN).Return(standardTask(), true),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v3BasePath+v3EndpointID+"/associations/"+associationType, nil)
@@ -1072,8 +1405,9 @@ func TestV3ContainerAssociation(t *testing.T) {
 		state.EXPECT().TaskByArn(taskARN).Return(task, true),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v3BasePath+v3EndpointID+"/associations/"+associationType+"/"+associationName, nil)
@@ -1109,8 +1443,9 @@ func TestV4TaskStats(t *testing.T) {
 		statsEngine.EXPECT().ContainerDockerStats(taskARN, containerID).Return(dockerStats, &stats.NetworkStatsPerSec{}, nil),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v4BasePath+v3EndpointID+"/task/stats", nil)
@@ -1144,8 +1479,9 @@ func TestV4ContainerStats(t *testing.T) {
 		statsEngine.EXPECT().ContainerDockerStats(taskARN, containerID).Return(dockerStats, &stats.NetworkStatsPerSec{}, nil),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v4BasePath+v3EndpointID+"/stats", nil)
@@ -1177,8 +1513,9 @@ func TestV4ContainerAssociations(t *testing.T) {
 		state.EXPECT().TaskByArn(taskARN).Return(task, true),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v4BasePath+v3EndpointID+"/associations/"+associationType, nil)
@@ -1209,8 +1546,9 @@ func TestV4ContainerAssociation(t *testing.T) {
 		state.EXPECT().TaskByArn(taskARN).Return(task, true),
 	)
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", v4BasePath+v3EndpointID+"/associations/"+associationType+"/"+associationName, nil)
@@ -1236,8 +1574,9 @@ func TestTaskHTTPEndpoint301Redirect(t *testing.T) {
 	ecsClient := mock_api.NewMockECSClient(ctrl)
 
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 
 	for testPath, expectedPath := range testPathsMap {
@@ -1279,8 +1618,9 @@ func TestTaskHTTPEndpointErrorCode404(t *testing.T) {
 	ecsClient := mock_api.NewMockECSClient(ctrl)
 
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 
 	for _, testPath := range testPaths {
@@ -1319,8 +1659,9 @@ func TestTaskHTTPEndpointErrorCode400(t *testing.T) {
 	ecsClient := mock_api.NewMockECSClient(ctrl)
 
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 
 	for _, testPath := range testPaths {
@@ -1358,8 +1699,9 @@ func TestTaskHTTPEndpointErrorCode500(t *testing.T) {
 	ecsClient := mock_api.NewMockECSClient(ctrl)
 
 	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-		containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+		containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 	require.NoError(t, err)
 
 	for _, testPath := range testPaths {
@@ -1428,8 +1770,9 @@ func TestV4TaskNotFoundError404(t *testing.T) {
 			ecsClient := mock_api.NewMockECSClient(ctrl)
 
 			server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-				config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-				containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+				config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+				config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+				containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 			require.NoError(t, err)
 
 			state.EXPECT().TaskARNByV3EndpointID(gomock.Any()).Return("", tc.taskFound).AnyTimes()
@@ -1484,8 +1827,9 @@ func TestV4Unexpected500Error(t *testing.T) {
 			ecsClient := mock_api.NewMockECSClient(ctrl)
 
 			server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, statsEngine,
-				config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, "", vpcID,
-				containerInstanceArn, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+				config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+				config.DefaultLocalEndpointSlowRequestThreshold, nil, "", vpcID,
+				containerInstanceArn, nil, agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
 			require.NoError(t, err)
 
 			// Initial lookups succeed
@@ -1583,8 +1927,9 @@ func testTMDSRequest[R TMDSResponse](t *testing.T, tc TMDSTestCase[R]) {
 	// Initialize server
 	server, err := taskServerSetup(credsManager, auditLog, state, ecsClient,
 		clusterName, statsEngine,
-		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate, availabilityzone, vpcID,
-		containerInstanceArn, taskProtectionClientFactory)
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, availabilityzone, vpcID,
+		containerInstanceArn, nil, taskProtectionClientFactory)
 	require.NoError(t, err)
 
 	// Create the request
@@ -2753,6 +3098,64 @@ func TestV4TaskMetadataWithTags(t *testing.T) {
 	})
 }
 
+func TestV4TaskMetadataIncludeTagsFromCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	task := standardTask()
+	state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+	auditLog := mock_audit.NewMockAuditLogger(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	auditLog.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	state.EXPECT().TaskARNByV3EndpointID(v3EndpointID).Return(taskARN, true).AnyTimes()
+	state.EXPECT().TaskByArn(taskARN).Return(task, true).AnyTimes()
+	state.EXPECT().ContainerMapByArn(taskARN).Return(containerNameToDockerContainer, true).AnyTimes()
+	state.EXPECT().PulledContainerMapByArn(taskARN).Return(nil, true).AnyTimes()
+	gomock.InOrder(
+		ecsClient.EXPECT().GetResourceTags(containerInstanceArn).Return(standardECSContainerInstanceTags(), nil),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(standardECSTaskTags(), nil),
+		ecsClient.EXPECT().GetResourceTags(containerInstanceArn).Return(standardECSContainerInstanceTags(), nil),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(nil, errors.New("error")),
+	)
+
+	// Tags expire right away, so that they are retrieved again by the second request
+	server, err := taskServerSetup(credentials.NewManager(), auditLog, state, ecsClient, clusterName, nil,
+		config.DefaultTaskMetadataSteadyStateRate, config.DefaultTaskMetadataBurstRate,
+		config.DefaultLocalEndpointSlowRequestThreshold, nil, availabilityzone, vpcID,
+		containerInstanceArn, handlersv2.NewResourceTagsCache(ecsClient, time.Nanosecond),
+		agentapihandlers.NewMockTaskProtectionClientFactoryInterface(ctrl))
+	require.NoError(t, err)
+
+	getTask := func(path string) v4.TaskResponse {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var resp v4.TaskResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// The untagged response doesn't retrieve tags
+	resp := getTask(v4BasePath + v3EndpointID + "/task")
+	assert.Nil(t, resp.TaskTags)
+	assert.Nil(t, resp.ContainerInstanceTags)
+
+	resp = getTask(v4BasePath + v3EndpointID + "/task?includeTags=true")
+	assert.Equal(t, standardContainerInstanceTags(), resp.ContainerInstanceTags)
+	assert.Equal(t, standardTaskTags(), resp.TaskTags)
+	assert.Empty(t, resp.Warnings)
+
+	// The task tags can't be retrieved again, the cached ones are served with a warning
+	resp = getTask(v4BasePath + v3EndpointID + "/task?includeTags=true")
+	assert.Equal(t, standardContainerInstanceTags(), resp.ContainerInstanceTags)
+	assert.Equal(t, standardTaskTags(), resp.TaskTags)
+	assert.Empty(t, resp.Errors)
+	require.Len(t, resp.Warnings, 1)
+	assert.Contains(t, resp.Warnings[0], "TaskTags of "+taskARN+" are stale")
+}
+
 func TestGetTaskProtection(t *testing.T) {
 	path := fmt.Sprintf("/api/%s/task-protection/v1/state", v3EndpointID)
 
@@ -18,25 +18,62 @@ import (
 	"net/http"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials/instancecreds"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
 	agentversion "github.com/aws/amazon-ecs-agent/agent/version"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
 )
 
 // AgentMetadataPath is the Agent metadata path for v1 handler.
 const AgentMetadataPath = "/v1/metadata"
 
-// AgentMetadataHandler creates response for 'v1/metadata' API.
-func AgentMetadataHandler(containerInstanceArn *string, cfg *config.Config) func(http.ResponseWriter, *http.Request) {
+// AgentMetadataHandler creates response for 'v1/metadata' API. The response includes
+// the state of the docker client circuit breaker if there is one, and the agent is
+// reported unavailable while the breaker is open since it cannot reach docker. It also
+// includes the estimated host clock skew once it has been estimated, and the progress of
+// the state reconciliation, such as "reconciling: 34/150" while the agent is starting.
+// On external instances, it includes the status of the rotation of the instance
+// credentials, and the agent is reported unavailable once they have expired.
+func AgentMetadataHandler(containerInstanceArn *string, cfg *config.Config,
+	breaker dockerapi.CircuitBreakerReporter, clockSkew clockdrift.Estimator,
+	reconciliation engine.ReconciliationProgressReporter,
+	instanceCredentials instancecreds.RotationStatusReporter) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		resp := &MetadataResponse{
 			Cluster:              cfg.Cluster,
 			ContainerInstanceArn: containerInstanceArn,
 			Version:              agentversion.String(),
 		}
+		statusCode := http.StatusOK
+		if breaker != nil {
+			breakerStatus := breaker.CircuitBreakerStatus()
+			resp.DockerCircuitBreaker = &breakerStatus
+			if breakerStatus.State == dockerapi.CircuitBreakerOpen {
+				statusCode = http.StatusServiceUnavailable
+			}
+		}
+		if clockSkew != nil {
+			if estimate, ok := clockSkew.Estimate(); ok {
+				resp.ClockDrift = &estimate
+			}
+		}
+		if reconciliation != nil {
+			progress := reconciliation.ReconciliationProgress()
+			resp.StateReconciliation = &progress
+		}
+		if instanceCredentials != nil {
+			rotation := instanceCredentials.RotationStatus()
+			resp.InstanceCredentialsRotation = &rotation
+			if rotation.State == instancecreds.RotationExpired {
+				statusCode = http.StatusServiceUnavailable
+			}
+		}
 		responseJSON, err := json.Marshal(resp)
 		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
 			return
 		}
-		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, utils.RequestTypeAgentMetadata)
+		utils.WriteJSONToResponse(w, statusCode, responseJSON, utils.RequestTypeAgentMetadata)
 	}
 }
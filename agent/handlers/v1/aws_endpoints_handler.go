@@ -0,0 +1,52 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// AWSEndpointsPath is the path of the endpoints of the AWS services for the v1 handler.
+	AWSEndpointsPath = "/v1/aws-endpoints"
+
+	awsEndpointsRequestType = "aws endpoints"
+)
+
+// AWSEndpointsResponse is the endpoint resolution mode of the agent and the endpoint
+// each of its AWS clients is pointed at, by service name.
+type AWSEndpointsResponse struct {
+	Mode      string            `json:"Mode"`
+	Endpoints map[string]string `json:"Endpoints"`
+}
+
+// AWSEndpointsHandler creates response for 'v1/aws-endpoints' API. Endpoints that can't
+// be resolved in the region are reported with the error of their resolution.
+func AWSEndpointsHandler(endpoints *awsendpoints.Resolver, region string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := AWSEndpointsResponse{
+			Mode:      string(endpoints.Mode()),
+			Endpoints: endpoints.ResolveAll(region),
+		}
+		responseJSON, err := json.Marshal(response)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, awsEndpointsRequestType)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSEndpointsHandler(t *testing.T) {
+	endpoints, err := awsendpoints.NewResolver("dualstack", map[string]string{
+		awsendpoints.ECR: "https://vpce-0123.api.ecr.us-west-2.vpce.amazonaws.com",
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	AWSEndpointsHandler(endpoints, "us-west-2")(recorder, httptest.NewRequest("GET", AWSEndpointsPath, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response AWSEndpointsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "dualstack", response.Mode)
+	assert.Equal(t, map[string]string{
+		"ecs":            "https://ecs.us-west-2.api.aws",
+		"ecr":            "https://vpce-0123.api.ecr.us-west-2.vpce.amazonaws.com",
+		"ssm":            "https://ssm.us-west-2.api.aws",
+		"secretsmanager": "https://secretsmanager.us-west-2.api.aws",
+	}, response.Endpoints)
+}
@@ -0,0 +1,65 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/gpu"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	// CapabilitiesPath is the capabilities path for v1 handler.
+	CapabilitiesPath = "/v1/capabilities"
+
+	capabilitiesRequestType = "capabilities"
+)
+
+// CapabilitiesResponse is the capabilities that the container instance registered with,
+// as name or name=value strings, and the result of the latest probe of the GPU runtime
+// if it's probed.
+type CapabilitiesResponse struct {
+	Capabilities []string           `json:"Capabilities"`
+	GPURuntime   *gpu.RuntimeStatus `json:"GPURuntime,omitempty"`
+}
+
+// CapabilitiesHandler creates response for 'v1/capabilities' API. The GPU runtime is
+// reported as it was last probed, which may differ from when the instance registered.
+func CapabilitiesHandler(capabilities []*ecs.Attribute,
+	gpuRuntime gpu.RuntimeStatusReporter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := CapabilitiesResponse{Capabilities: make([]string, 0, len(capabilities))}
+		for _, capability := range capabilities {
+			name := aws.StringValue(capability.Name)
+			if value := aws.StringValue(capability.Value); value != "" {
+				name += "=" + value
+			}
+			response.Capabilities = append(response.Capabilities, name)
+		}
+		if gpuRuntime != nil {
+			if status, probed := gpuRuntime.RuntimeStatus(); probed {
+				response.GPURuntime = &status
+			}
+		}
+		responseJSON, err := json.Marshal(response)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, capabilitiesRequestType)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/wsclient"
+)
+
+const (
+	// ConnectionsPath is the path of the connections to ACS and TCS for the v1 handler.
+	ConnectionsPath = "/v1/connections"
+
+	connectionsRequestType = "connections"
+)
+
+// ConnectionsResponse is the state of the connections of the agent to ACS and TCS since
+// the agent started.
+type ConnectionsResponse struct {
+	ACS wsclient.ConnectionStatus `json:"ACS"`
+	TCS wsclient.ConnectionStatus `json:"TCS"`
+}
+
+// ConnectionsHandler creates response for 'v1/connections' API. The state of connections
+// that aren't reported is empty.
+func ConnectionsHandler(acs, tcs wsclient.ConnectionStatusReporter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response ConnectionsResponse
+		if acs != nil {
+			response.ACS = acs.ConnectionStatus()
+		}
+		if tcs != nil {
+			response.TCS = tcs.ConnectionStatus()
+		}
+		responseJSON, err := json.Marshal(response)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, connectionsRequestType)
+	}
+}
@@ -0,0 +1,65 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/wsclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionsHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	ConnectionsHandler(nil, nil)(recorder, httptest.NewRequest("GET", ConnectionsPath, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"ACS":{"Connected":false,"Connects":0,"Reconnects":0,"ConnectFailures":0},`+
+		`"TCS":{"Connected":false,"Connects":0,"Reconnects":0,"ConnectFailures":0}}`, recorder.Body.String())
+
+	acs := wsclient.NewConnectionTracker()
+	tcs := wsclient.NewConnectionTracker()
+	acs.Connecting("https://ecs-a-1.us-west-2.amazonaws.com/ws?clusterArn=default&sendCredentials=true")
+	acs.Connected()
+	acs.Disconnected(errors.New("connection reset by peer"))
+	acs.Connected()
+	acs.Heartbeat()
+	tcs.Connecting("https://ecs-t-1.us-west-2.amazonaws.com/ws?cluster=default")
+	tcs.ConnectFailed(errors.New("connection refused"))
+
+	recorder = httptest.NewRecorder()
+	ConnectionsHandler(acs, tcs)(recorder, httptest.NewRequest("GET", ConnectionsPath, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	// The query strings of the URLs aren't exposed
+	assert.NotContains(t, recorder.Body.String(), "cluster")
+	var response ConnectionsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.True(t, response.ACS.Connected)
+	assert.Equal(t, "https://ecs-a-1.us-west-2.amazonaws.com/ws", response.ACS.Endpoint)
+	assert.Equal(t, "connection reset by peer", response.ACS.LastDisconnectError)
+	assert.NotNil(t, response.ACS.LastHeartbeatAt)
+	assert.Equal(t, uint64(2), response.ACS.Connects)
+	assert.Equal(t, uint64(1), response.ACS.Reconnects)
+	assert.False(t, response.TCS.Connected)
+	assert.Equal(t, "https://ecs-t-1.us-west-2.amazonaws.com/ws", response.TCS.Endpoint)
+	assert.Equal(t, "connection refused", response.TCS.LastDisconnectError)
+	assert.Equal(t, uint64(1), response.TCS.ConnectFailures)
+}
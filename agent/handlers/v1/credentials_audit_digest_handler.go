@@ -0,0 +1,42 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+)
+
+const (
+	// CredentialsAuditDigestPath is the credentials fetch audit digest path for v1 handler.
+	CredentialsAuditDigestPath = "/v1/credentials/audit/digest"
+
+	credentialsAuditDigestRequestType = "credentials audit digest"
+)
+
+// CredentialsAuditDigestHandler creates response for 'v1/credentials/audit/digest' API. The
+// response is the digest of the credentials fetches of each task ARN in the window in
+// progress and in the last window that ended, with the boundaries of the windows.
+func CredentialsAuditDigestHandler(digest *tmdsv1.FetchDigest) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(digest.Digest())
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, credentialsAuditDigestRequestType)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// CredentialsEntriesPath is the credentials entry count path for v1 handler.
+	CredentialsEntriesPath = "/v1/credentials/entries"
+
+	credentialsEntriesRequestType = "credentials entries"
+)
+
+// CredentialsEntriesHandler creates response for 'v1/credentials/entries' API. The response
+// has the number of credentials held by the credentials manager, the highest it has been,
+// and the maximum number of credentials. The counts are zero if the credentials manager
+// doesn't count its credentials.
+func CredentialsEntriesHandler(reporter credentials.EntryCountReporter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resp credentials.EntryCount
+		if reporter != nil {
+			resp = reporter.EntryCount()
+		}
+		responseJSON, err := json.Marshal(resp)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, credentialsEntriesRequestType)
+	}
+}
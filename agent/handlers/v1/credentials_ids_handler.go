@@ -0,0 +1,86 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// CredentialsIDsPath is the credentials ids path for v1 handler.
+	CredentialsIDsPath = "/v1/credentials/ids"
+
+	credentialsIDsRequestType = "credentials ids"
+
+	// credentialsIDFingerprintSize is the number of bytes of the SHA-256 digest of a
+	// credentials id that its fingerprint is made of
+	credentialsIDFingerprintSize = 12
+)
+
+// CredentialsIDsResponse is the schema for the credentials ids response JSON object.
+type CredentialsIDsResponse struct {
+	Credentials []CredentialsIDSummary `json:"Credentials"`
+}
+
+// CredentialsIDSummary identifies credentials held by the credentials manager by the
+// fingerprint of their id.
+type CredentialsIDSummary struct {
+	CredentialsIDFingerprint string `json:"CredentialsIdFingerprint"`
+	TaskARN                  string `json:"TaskArn"`
+	RoleType                 string `json:"RoleType"`
+	Expiration               string `json:"Expiration"`
+}
+
+// CredentialsIDFingerprint returns the hex encoded, truncated SHA-256 digest of a
+// credentials id.
+func CredentialsIDFingerprint(credentialsID string) string {
+	digest := sha256.Sum256([]byte(credentialsID))
+	return hex.EncodeToString(digest[:credentialsIDFingerprintSize])
+}
+
+// CredentialsIDsHandler creates response for 'v1/credentials/ids' API. The response lists
+// the fingerprints of the ids of the credentials held by the credentials manager, with the
+// ARNs of their tasks and their expirations, for support staff to cross-check against the
+// expected tasks. Credentials ids are bearer tokens of the credentials endpoints, so the
+// response never includes them, nor any secret material.
+func CredentialsIDsHandler(lister credentials.CredentialsLister) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summaries := lister.ListCredentials()
+		response := CredentialsIDsResponse{Credentials: make([]CredentialsIDSummary, 0, len(summaries))}
+		for _, summary := range summaries {
+			response.Credentials = append(response.Credentials, CredentialsIDSummary{
+				CredentialsIDFingerprint: CredentialsIDFingerprint(summary.CredentialsID),
+				TaskARN:                  summary.TaskARN,
+				RoleType:                 summary.RoleType,
+				Expiration:               summary.Expiration,
+			})
+		}
+		// The order of the credentials ids isn't given away either
+		sort.Slice(response.Credentials, func(i, j int) bool {
+			return response.Credentials[i].CredentialsIDFingerprint < response.Credentials[j].CredentialsIDFingerprint
+		})
+		responseJSON, err := json.Marshal(response)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, credentialsIDsRequestType)
+	}
+}
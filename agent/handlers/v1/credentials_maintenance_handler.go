@@ -0,0 +1,89 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+)
+
+const (
+	// CredentialsMaintenancePath is the credential serving maintenance path for v1 handler.
+	CredentialsMaintenancePath = "/v1/credentials/maintenance"
+
+	credentialsMaintenanceRequestType = "credentials maintenance"
+
+	// credentialsMaintenanceMaxBodySize is the maximum size of a maintenance request body.
+	credentialsMaintenanceMaxBodySize = 1 << 10
+)
+
+// CredentialsMaintenanceResponse is whether credential serving is paused for maintenance.
+type CredentialsMaintenanceResponse struct {
+	Paused bool   `json:"Paused"`
+	Error  string `json:"Error,omitempty"`
+}
+
+// CredentialsMaintenanceRequest pauses or resumes credential serving.
+type CredentialsMaintenanceRequest struct {
+	Paused *bool `json:"Paused"`
+}
+
+// CredentialsMaintenanceHandler creates response for 'v1/credentials/maintenance' API. A GET
+// returns whether credential serving is paused, and a PUT pauses or resumes it according
+// to the Paused field of the request body.
+func CredentialsMaintenanceHandler(toggle *tmdsv1.MaintenanceToggle) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var request CredentialsMaintenanceRequest
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, credentialsMaintenanceMaxBodySize)).Decode(&request)
+			if errorMessage := utils.RequestBodyErrorMessage(err); errorMessage != nil {
+				writeCredentialsMaintenanceResponse(w, errorMessage.HTTPErrorCode, CredentialsMaintenanceResponse{
+					Paused: toggle.Paused(), Error: errorMessage.Message,
+				})
+				return
+			}
+			if err != nil || request.Paused == nil {
+				writeCredentialsMaintenanceResponse(w, http.StatusBadRequest, CredentialsMaintenanceResponse{
+					Paused: toggle.Paused(), Error: `the request body must be {"Paused": true} or {"Paused": false}`,
+				})
+				return
+			}
+			if *request.Paused {
+				toggle.Pause()
+			} else {
+				toggle.Resume()
+			}
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+			writeCredentialsMaintenanceResponse(w, http.StatusMethodNotAllowed, CredentialsMaintenanceResponse{
+				Paused: toggle.Paused(), Error: "credential serving is paused and resumed with a PUT request",
+			})
+			return
+		}
+		writeCredentialsMaintenanceResponse(w, http.StatusOK, CredentialsMaintenanceResponse{Paused: toggle.Paused()})
+	}
+}
+
+func writeCredentialsMaintenanceResponse(w http.ResponseWriter, statusCode int, response CredentialsMaintenanceResponse) {
+	responseJSON, err := json.Marshal(response)
+	if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+		return
+	}
+	utils.WriteJSONToResponse(w, statusCode, responseJSON, credentialsMaintenanceRequestType)
+}
@@ -0,0 +1,158 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// CredentialsSnapshotPath is the credentials snapshot export path for v1 handler.
+	CredentialsSnapshotPath = "/v1/credentials/snapshot"
+
+	credentialsSnapshotRequestType = "credentials snapshot"
+
+	// credentialsSnapshotFileFormat is the format of the names of the snapshot files, the
+	// place holder is the time the snapshot was taken at
+	credentialsSnapshotFileFormat = "credentials-snapshot-%s.json"
+	// credentialsSnapshotTimeFormat is the format of the time in the names of the snapshot
+	// files, which sorts chronologically
+	credentialsSnapshotTimeFormat = "20060102T150405.000000000Z"
+)
+
+// CredentialsSnapshot is the schema of the credentials snapshot files.
+type CredentialsSnapshot struct {
+	TakenAt     time.Time             `json:"TakenAt"`
+	Credentials []CredentialsMetadata `json:"Credentials"`
+}
+
+// CredentialsMetadata describes credentials held by the credentials manager, identified
+// by the fingerprint of their id.
+type CredentialsMetadata struct {
+	CredentialsIDFingerprint string `json:"CredentialsIdFingerprint"`
+	TaskARN                  string `json:"TaskArn"`
+	RoleARN                  string `json:"RoleArn"`
+	RoleType                 string `json:"RoleType"`
+	Expiration               string `json:"Expiration"`
+	Revision                 uint64 `json:"Revision"`
+}
+
+// CredentialsSnapshotResponse is the file that a credentials snapshot was exported to.
+type CredentialsSnapshotResponse struct {
+	Path        string `json:"Path,omitempty"`
+	Credentials int    `json:"Credentials"`
+	Error       string `json:"Error,omitempty"`
+}
+
+// NewCredentialsSnapshot creates the snapshot of the metadata of the credentials that
+// is exported. Credentials ids are bearer tokens of the credentials endpoints, so they are
+// replaced by their fingerprints, like in the 'v1/credentials/ids' API.
+func NewCredentialsSnapshot(metadata []credentials.CredentialsMetadata, takenAt time.Time) CredentialsSnapshot {
+	snapshot := CredentialsSnapshot{
+		TakenAt:     takenAt.UTC(),
+		Credentials: make([]CredentialsMetadata, 0, len(metadata)),
+	}
+	for _, m := range metadata {
+		snapshot.Credentials = append(snapshot.Credentials, CredentialsMetadata{
+			CredentialsIDFingerprint: CredentialsIDFingerprint(m.CredentialsID),
+			TaskARN:                  m.TaskARN,
+			RoleARN:                  m.RoleARN,
+			RoleType:                 m.RoleType,
+			Expiration:               m.Expiration,
+			Revision:                 m.Revision,
+		})
+	}
+	return snapshot
+}
+
+// CredentialsSnapshotHandler creates response for 'v1/credentials/snapshot' API. A PUT takes
+// a consistent snapshot of the metadata of the credentials held by the credentials manager
+// and exports it to a new file in the directory, for incident response. The response
+// holds the path of the file. Snapshots never include secret material.
+func CredentialsSnapshotHandler(snapshotter credentials.CredentialsSnapshotter, dir string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.Header().Set("Allow", http.MethodPut)
+			writeCredentialsSnapshotResponse(w, http.StatusMethodNotAllowed, CredentialsSnapshotResponse{
+				Error: "credentials snapshots are exported with a PUT request",
+			})
+			return
+		}
+		snapshot := NewCredentialsSnapshot(snapshotter.SnapshotCredentials(), time.Now())
+		path, err := writeCredentialsSnapshot(dir, snapshot)
+		if err != nil {
+			seelog.Errorf("Unable to export the credentials snapshot to %s: %v", dir, err)
+			writeCredentialsSnapshotResponse(w, http.StatusInternalServerError, CredentialsSnapshotResponse{
+				Credentials: len(snapshot.Credentials), Error: "unable to export the credentials snapshot",
+			})
+			return
+		}
+		seelog.Infof("Exported the metadata of %d credentials to %s", len(snapshot.Credentials), path)
+		writeCredentialsSnapshotResponse(w, http.StatusOK, CredentialsSnapshotResponse{
+			Path: path, Credentials: len(snapshot.Credentials),
+		})
+	}
+}
+
+// writeCredentialsSnapshot writes the snapshot to a new file in the directory, which is
+// created if it doesn't exist, and returns the path of the file. The file is written to a
+// temporary file that is renamed, so that partial snapshots are never left behind.
+func writeCredentialsSnapshot(dir string, snapshot CredentialsSnapshot) (string, error) {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	tmpFile, err := os.CreateTemp(dir, ".credentials-snapshot-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return "", err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf(credentialsSnapshotFileFormat,
+		snapshot.TakenAt.Format(credentialsSnapshotTimeFormat)))
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func writeCredentialsSnapshotResponse(w http.ResponseWriter, statusCode int, response CredentialsSnapshotResponse) {
+	responseJSON, err := json.Marshal(response)
+	if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+		return
+	}
+	utils.WriteJSONToResponse(w, statusCode, responseJSON, credentialsSnapshotRequestType)
+}
@@ -0,0 +1,46 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// DrainStatusPath is the drain status path for v1 handler.
+	DrainStatusPath = "/v1/drain"
+
+	drainStatusRequestType = "drain status"
+)
+
+// DrainStatusHandler creates response for 'v1/drain' API. While the instance is
+// drained, the response lists the tasks in the order they are stopped in, with the
+// tasks of the stop-last families last.
+func DrainStatusHandler(reporter engine.DrainStatusReporter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var status engine.DrainStatus
+		if reporter != nil {
+			status = reporter.DrainStatus()
+		}
+		responseJSON, err := json.Marshal(status)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, drainStatusRequestType)
+	}
+}
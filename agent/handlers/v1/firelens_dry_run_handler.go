@@ -0,0 +1,238 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource/firelens"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+
+	dockercontainer "github.com/docker/docker/api/types/container"
+)
+
+const (
+	// FirelensDryRunPath is the firelens config dry run path for v1 handler.
+	FirelensDryRunPath = "/v1/firelens/dryrun"
+
+	firelensDryRunRequestType = "firelens dry run"
+
+	// firelensDryRunMaxBodySize is the maximum size of a dry run request body.
+	firelensDryRunMaxBodySize = 1 << 20
+
+	// firelensDryRunContainerName is the name of the firelens container of the hypothetical task.
+	firelensDryRunContainerName = "log_router"
+	// firelensDryRunTaskARN, firelensDryRunTaskFamily and firelensDryRunTaskVersion identify the
+	// hypothetical task in the ECS log metadata of the generated config.
+	firelensDryRunTaskARN     = "arn:aws:ecs:region:account:task/cluster/firelens-dry-run"
+	firelensDryRunTaskFamily  = "firelens-dry-run"
+	firelensDryRunTaskVersion = "1"
+
+	firelensLogDriver = "awsfirelens"
+)
+
+// FirelensDryRunRequest is the firelens configuration of a hypothetical task, and the log
+// configurations of its containers that send their logs to the firelens container. Field names
+// are matched case-insensitively, so snippets of task definitions can be used as they are.
+type FirelensDryRunRequest struct {
+	NetworkMode           string                       `json:"NetworkMode,omitempty"`
+	FirelensConfiguration *FirelensDryRunConfiguration `json:"FirelensConfiguration"`
+	Containers            []FirelensDryRunContainer    `json:"Containers"`
+}
+
+// FirelensDryRunConfiguration is the firelens configuration of the firelens container.
+type FirelensDryRunConfiguration struct {
+	Type    string            `json:"Type"`
+	Options map[string]string `json:"Options,omitempty"`
+}
+
+// FirelensDryRunContainer is a container that uses the awsfirelens log driver.
+type FirelensDryRunContainer struct {
+	Name             string                          `json:"Name"`
+	LogConfiguration *FirelensDryRunLogConfiguration `json:"LogConfiguration"`
+}
+
+// FirelensDryRunLogConfiguration is the log configuration of a container.
+type FirelensDryRunLogConfiguration struct {
+	LogDriver     string                 `json:"LogDriver"`
+	Options       map[string]string      `json:"Options,omitempty"`
+	SecretOptions []FirelensDryRunSecret `json:"SecretOptions,omitempty"`
+}
+
+// FirelensDryRunSecret is a secret log option. Only its name is used, the secret is generated
+// as a config variable placeholder, and ValueFrom is never read or logged.
+type FirelensDryRunSecret struct {
+	Name      string `json:"Name"`
+	ValueFrom string `json:"ValueFrom,omitempty"`
+}
+
+// FirelensDryRunResponse is the generated config, or the reasons it couldn't be generated.
+type FirelensDryRunResponse struct {
+	ConfigType string                `json:"ConfigType,omitempty"`
+	Config     string                `json:"Config,omitempty"`
+	Errors     []FirelensDryRunError `json:"Errors,omitempty"`
+}
+
+// FirelensDryRunError is a validation or generation error. Field is the request field at fault,
+// if there is one.
+type FirelensDryRunError struct {
+	Field   string `json:"Field,omitempty"`
+	Message string `json:"Message"`
+}
+
+// FirelensDryRunHandler creates response for 'v1/firelens/dryrun' API. It generates the
+// fluentd or fluentbit config of a hypothetical task with the same code that generates it
+// when a task is started, without creating or starting anything.
+func FirelensDryRunHandler(cfg *config.Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeFirelensDryRunResponse(w, http.StatusMethodNotAllowed, FirelensDryRunResponse{
+				Errors: []FirelensDryRunError{{Message: "firelens dry run requires a POST request"}},
+			})
+			return
+		}
+
+		var request FirelensDryRunRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, firelensDryRunMaxBodySize)).Decode(&request); err != nil {
+			if errorMessage := utils.RequestBodyErrorMessage(err); errorMessage != nil {
+				writeFirelensDryRunResponse(w, errorMessage.HTTPErrorCode, FirelensDryRunResponse{
+					Errors: []FirelensDryRunError{{Message: errorMessage.Message}},
+				})
+				return
+			}
+			writeFirelensDryRunResponse(w, http.StatusBadRequest, FirelensDryRunResponse{
+				Errors: []FirelensDryRunError{{Message: "unable to decode request: " + err.Error()}},
+			})
+			return
+		}
+
+		task, validationErrors := request.task()
+		if len(validationErrors) > 0 {
+			writeFirelensDryRunResponse(w, http.StatusBadRequest, FirelensDryRunResponse{Errors: validationErrors})
+			return
+		}
+
+		var generated bytes.Buffer
+		if err := task.GenerateFirelensConfig(cfg, &generated); err != nil {
+			writeFirelensDryRunResponse(w, http.StatusBadRequest, FirelensDryRunResponse{
+				Errors: []FirelensDryRunError{{Message: err.Error()}},
+			})
+			return
+		}
+		writeFirelensDryRunResponse(w, http.StatusOK, FirelensDryRunResponse{
+			ConfigType: request.FirelensConfiguration.Type,
+			Config:     generated.String(),
+		})
+	}
+}
+
+// task validates the request and builds the hypothetical task from it.
+func (request *FirelensDryRunRequest) task() (*apitask.Task, []FirelensDryRunError) {
+	var validationErrors []FirelensDryRunError
+	addError := func(field, format string, args ...interface{}) {
+		validationErrors = append(validationErrors, FirelensDryRunError{
+			Field:   field,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	task := &apitask.Task{
+		Arn:     firelensDryRunTaskARN,
+		Family:  firelensDryRunTaskFamily,
+		Version: firelensDryRunTaskVersion,
+	}
+	firelensContainer := &apicontainer.Container{Name: firelensDryRunContainerName}
+	switch request.NetworkMode {
+	case "", apitask.BridgeNetworkMode:
+	case apitask.AWSVPCNetworkMode:
+		task.NetworkMode = apitask.AWSVPCNetworkMode
+	case apitask.HostNetworkMode:
+		hostConfig, _ := json.Marshal(dockercontainer.HostConfig{NetworkMode: apitask.HostNetworkMode})
+		firelensContainer.DockerConfig.HostConfig = strptr(string(hostConfig))
+	default:
+		addError("NetworkMode", "unsupported network mode %q", request.NetworkMode)
+	}
+
+	if request.FirelensConfiguration == nil {
+		addError("FirelensConfiguration", "firelens configuration is required")
+	} else {
+		switch request.FirelensConfiguration.Type {
+		case firelens.FirelensConfigTypeFluentd, firelens.FirelensConfigTypeFluentbit:
+		default:
+			addError("FirelensConfiguration.Type", "firelens configuration type must be %s or %s",
+				firelens.FirelensConfigTypeFluentd, firelens.FirelensConfigTypeFluentbit)
+		}
+		firelensContainer.FirelensConfig = &apicontainer.FirelensConfig{
+			Type:    request.FirelensConfiguration.Type,
+			Options: request.FirelensConfiguration.Options,
+		}
+	}
+	task.Containers = append(task.Containers, firelensContainer)
+
+	names := map[string]bool{firelensDryRunContainerName: true}
+	for i, container := range request.Containers {
+		field := fmt.Sprintf("Containers[%d]", i)
+		if container.Name == "" {
+			addError(field+".Name", "container name is required")
+			continue
+		}
+		if names[container.Name] {
+			addError(field+".Name", "container name %q is not unique", container.Name)
+			continue
+		}
+		names[container.Name] = true
+		logConfig := container.LogConfiguration
+		if logConfig == nil || logConfig.LogDriver != firelensLogDriver {
+			addError(field+".LogConfiguration.LogDriver", "log driver must be %s", firelensLogDriver)
+			continue
+		}
+
+		hostConfig, _ := json.Marshal(dockercontainer.HostConfig{
+			LogConfig: dockercontainer.LogConfig{Type: firelensLogDriver, Config: logConfig.Options},
+		})
+		taskContainer := &apicontainer.Container{Name: container.Name}
+		taskContainer.DockerConfig.HostConfig = strptr(string(hostConfig))
+		for j, secret := range logConfig.SecretOptions {
+			if secret.Name == "" {
+				addError(fmt.Sprintf("%s.LogConfiguration.SecretOptions[%d].Name", field, j), "secret name is required")
+				continue
+			}
+			taskContainer.Secrets = append(taskContainer.Secrets, apicontainer.Secret{
+				Name:   secret.Name,
+				Target: apicontainer.SecretTargetLogDriver,
+			})
+		}
+		task.Containers = append(task.Containers, taskContainer)
+	}
+	return task, validationErrors
+}
+
+func writeFirelensDryRunResponse(w http.ResponseWriter, statusCode int, response FirelensDryRunResponse) {
+	responseJSON, err := json.Marshal(response)
+	if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+		return
+	}
+	utils.WriteJSONToResponse(w, statusCode, responseJSON, firelensDryRunRequestType)
+}
+
+func strptr(s string) *string {
+	return &s
+}
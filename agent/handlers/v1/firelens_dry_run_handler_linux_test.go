@@ -0,0 +1,151 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secretValueFrom = "arn:aws:secretsmanager:us-west-2:123456789012:secret:datadog-api-key"
+
+func dryRun(t *testing.T, method, body string) (int, FirelensDryRunResponse) {
+	handler := FirelensDryRunHandler(&config.Config{Cluster: "cluster", AWSRegion: "us-west-2"})
+	req := httptest.NewRequest(method, FirelensDryRunPath, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+
+	var response FirelensDryRunResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.NotContains(t, recorder.Body.String(), secretValueFrom)
+	return recorder.Code, response
+}
+
+func TestFirelensDryRunFluentbit(t *testing.T) {
+	code, response := dryRun(t, http.MethodPost, `{
+		"networkMode": "awsvpc",
+		"firelensConfiguration": {"type": "fluentbit"},
+		"containers": [{
+			"name": "app",
+			"logConfiguration": {
+				"logDriver": "awsfirelens",
+				"options": {"Name": "datadog", "Host": "http-intake.logs.datadoghq.com"},
+				"secretOptions": [{"name": "apikey", "valueFrom": "`+secretValueFrom+`"}]
+			}
+		}]
+	}`)
+	require.Equal(t, http.StatusOK, code, response.Errors)
+	assert.Equal(t, "fluentbit", response.ConfigType)
+	assert.Contains(t, response.Config, "    Name forward\n    Listen 127.0.0.1\n    Port 24224\n")
+	assert.Contains(t, response.Config, "    Record ecs_cluster cluster\n")
+	assert.Contains(t, response.Config, "[OUTPUT]\n    Name datadog\n    Match app-firelens*\n")
+	assert.Contains(t, response.Config, "    Host http-intake.logs.datadoghq.com\n")
+	// The secret is a placeholder for the env var of the app container, the second container
+	assert.Contains(t, response.Config, "    apikey ${apikey_1}\n")
+}
+
+func TestFirelensDryRunFluentdWithExternalConfigFile(t *testing.T) {
+	code, response := dryRun(t, http.MethodPost, `{
+		"FirelensConfiguration": {
+			"Type": "fluentd",
+			"Options": {
+				"enable-ecs-log-metadata": "false",
+				"config-file-type": "file",
+				"config-file-value": "/fluentd/etc/custom.conf"
+			}
+		},
+		"Containers": [{
+			"Name": "app",
+			"LogConfiguration": {
+				"LogDriver": "awsfirelens",
+				"Options": {"@type": "kinesis_firehose", "delivery_stream_name": "my-stream"},
+				"SecretOptions": [{"Name": "aws_key_id", "ValueFrom": "`+secretValueFrom+`"}]
+			}
+		}]
+	}`)
+	require.Equal(t, http.StatusOK, code, response.Errors)
+	assert.Equal(t, "fluentd", response.ConfigType)
+	assert.Contains(t, response.Config, "<source>\n    @type unix\n    path /var/run/fluent.sock\n</source>\n")
+	assert.Contains(t, response.Config, "<source>\n    @type forward\n    bind 0.0.0.0\n    port 24224\n</source>\n")
+	assert.Contains(t, response.Config, "@include /fluentd/etc/custom.conf\n")
+	assert.Contains(t, response.Config, "<match app-firelens**>\n    @type kinesis_firehose\n")
+	assert.Contains(t, response.Config, "    aws_key_id \"#{ENV['aws_key_id_1']}\"\n")
+	assert.NotContains(t, response.Config, "ecs_cluster")
+}
+
+func TestFirelensDryRunValidationErrors(t *testing.T) {
+	code, response := dryRun(t, http.MethodPost, `{
+		"NetworkMode": "nat",
+		"FirelensConfiguration": {"Type": "logstash"},
+		"Containers": [
+			{"Name": "app", "LogConfiguration": {"LogDriver": "awsfirelens"}},
+			{"Name": "app", "LogConfiguration": {"LogDriver": "awsfirelens"}},
+			{"Name": "sidecar", "LogConfiguration": {"LogDriver": "awslogs"}},
+			{"Name": "worker", "LogConfiguration": {"LogDriver": "awsfirelens",
+				"SecretOptions": [{"ValueFrom": "`+secretValueFrom+`"}]}}
+		]
+	}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Empty(t, response.Config)
+	var fields []string
+	for _, e := range response.Errors {
+		fields = append(fields, e.Field)
+	}
+	assert.Equal(t, []string{
+		"NetworkMode",
+		"FirelensConfiguration.Type",
+		"Containers[1].Name",
+		"Containers[2].LogConfiguration.LogDriver",
+		"Containers[3].LogConfiguration.SecretOptions[0].Name",
+	}, fields)
+}
+
+func TestFirelensDryRunGenerationError(t *testing.T) {
+	code, response := dryRun(t, http.MethodPost, `{
+		"FirelensConfiguration": {"Type": "fluentbit"},
+		"Containers": [{
+			"Name": "app",
+			"LogConfiguration": {"LogDriver": "awsfirelens", "Options": {"region": "us-west-2"}}
+		}]
+	}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	require.Len(t, response.Errors, 1)
+	assert.Contains(t, response.Errors[0].Message, "missing output key Name")
+}
+
+func TestFirelensDryRunBodyTooLarge(t *testing.T) {
+	body := `{"FirelensConfiguration": {"Type": "fluentbit", "Options": {"padding": "` +
+		strings.Repeat("a", firelensDryRunMaxBodySize) + `"}}}`
+	code, response := dryRun(t, http.MethodPost, body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "Request body exceeds 1048576 bytes", response.Errors[0].Message)
+}
+
+func TestFirelensDryRunRequiresPost(t *testing.T) {
+	code, response := dryRun(t, http.MethodGet, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	assert.Len(t, response.Errors, 1)
+}
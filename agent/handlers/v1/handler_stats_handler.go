@@ -0,0 +1,47 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+)
+
+const (
+	// HandlerStatsPath is the task metadata handlers runtime stats path for v1 handler.
+	HandlerStatsPath = "/v1/handlers/stats"
+
+	handlerStatsRequestType = "handler stats"
+)
+
+// HandlerStatsHandler creates response for 'v1/handlers/stats' API. The response is a
+// snapshot of the runtime stats of the task metadata handlers: the credentials requests by
+// API version, status code and error code, the throttled requests and the hits and misses
+// of the tags cache. The counts are zero if the stats are nil.
+func HandlerStatsHandler(stats *tmdsv1.RuntimeStats) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resp tmdsv1.RuntimeStatsSnapshot
+		if stats != nil {
+			resp = stats.Snapshot()
+		}
+		responseJSON, err := json.Marshal(resp)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, handlerStatsRequestType)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// ImagePrefetchStatusPath is the image prefetch status path for v1 handler.
+	ImagePrefetchStatusPath = "/v1/images/prefetch"
+
+	imagePrefetchStatusRequestType = "image prefetch status"
+)
+
+// ImagePrefetchStatusResponse is the schema for the image prefetch status response JSON object
+type ImagePrefetchStatusResponse struct {
+	Images []engine.ImagePrefetchStatus `json:"Images"`
+}
+
+// ImagePrefetchStatusHandler creates response for 'v1/images/prefetch' API. The response
+// lists the images of the prefetch list in order, with the status of their pulls.
+func ImagePrefetchStatusHandler(reporter engine.ImagePrefetchStatusReporter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := ImagePrefetchStatusResponse{Images: []engine.ImagePrefetchStatus{}}
+		if reporter != nil {
+			resp.Images = reporter.ImagePrefetchStatus()
+		}
+		responseJSON, err := json.Marshal(resp)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, imagePrefetchStatusRequestType)
+	}
+}
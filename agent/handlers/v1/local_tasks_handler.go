@@ -0,0 +1,114 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// LocalTasksPath is the local task launch path for v1 handler.
+	LocalTasksPath = "/v1/local/tasks"
+
+	localTasksRequestType = "local tasks"
+
+	// localTaskMaxBodySize is the maximum size of a local task launch request body.
+	localTaskMaxBodySize = 1 << 20
+)
+
+// LocalTaskResponse is the ARN of the local task that was launched or stopped, or the
+// reasons it couldn't be.
+type LocalTaskResponse struct {
+	TaskArn string   `json:"TaskArn,omitempty"`
+	Errors  []string `json:"Errors,omitempty"`
+}
+
+// LocalTasksHandler creates response for 'v1/local/tasks' API. A POST launches a task from
+// the task definition and overrides of the request body, and a DELETE stops the local task
+// of the taskarn query parameter.
+func LocalTasksHandler(manager engine.LocalTaskManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			launchLocalTask(manager, w, r)
+		case http.MethodDelete:
+			stopLocalTask(manager, w, r)
+		default:
+			w.Header().Set("Allow", http.MethodPost+", "+http.MethodDelete)
+			writeLocalTaskResponse(w, http.StatusMethodNotAllowed, LocalTaskResponse{
+				Errors: []string{"local tasks are launched with a POST request and stopped with a DELETE request"},
+			})
+		}
+	}
+}
+
+func launchLocalTask(manager engine.LocalTaskManager, w http.ResponseWriter, r *http.Request) {
+	var request engine.LocalTaskLaunchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, localTaskMaxBodySize)).Decode(&request); err != nil {
+		if errorMessage := utils.RequestBodyErrorMessage(err); errorMessage != nil {
+			writeLocalTaskResponse(w, errorMessage.HTTPErrorCode, LocalTaskResponse{
+				Errors: []string{errorMessage.Message},
+			})
+			return
+		}
+		writeLocalTaskResponse(w, http.StatusBadRequest, LocalTaskResponse{
+			Errors: []string{"unable to decode request: " + err.Error()},
+		})
+		return
+	}
+
+	taskARN, err := manager.LaunchLocalTask(request)
+	if err != nil {
+		var validationErr *engine.LocalTaskValidationError
+		if errors.As(err, &validationErr) {
+			writeLocalTaskResponse(w, http.StatusBadRequest, LocalTaskResponse{Errors: validationErr.Problems})
+			return
+		}
+		writeLocalTaskResponse(w, http.StatusInternalServerError, LocalTaskResponse{Errors: []string{err.Error()}})
+		return
+	}
+	writeLocalTaskResponse(w, http.StatusOK, LocalTaskResponse{TaskArn: taskARN})
+}
+
+func stopLocalTask(manager engine.LocalTaskManager, w http.ResponseWriter, r *http.Request) {
+	taskARN := r.URL.Query().Get(taskARNQueryField)
+	if taskARN == "" {
+		writeLocalTaskResponse(w, http.StatusBadRequest, LocalTaskResponse{
+			Errors: []string{"the " + taskARNQueryField + " query parameter is required"},
+		})
+		return
+	}
+	if err := manager.StopLocalTask(taskARN); err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrLocalTaskNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		writeLocalTaskResponse(w, statusCode, LocalTaskResponse{TaskArn: taskARN, Errors: []string{err.Error()}})
+		return
+	}
+	writeLocalTaskResponse(w, http.StatusOK, LocalTaskResponse{TaskArn: taskARN})
+}
+
+func writeLocalTaskResponse(w http.ResponseWriter, statusCode int, response LocalTaskResponse) {
+	responseJSON, err := json.Marshal(response)
+	if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+		return
+	}
+	utils.WriteJSONToResponse(w, statusCode, responseJSON, localTasksRequestType)
+}
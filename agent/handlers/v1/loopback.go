@@ -0,0 +1,53 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const loopbackOnlyRequestType = "loopback only"
+
+// LoopbackOnly restricts the handler to callers on the loopback interface. The introspection
+// server listens on all interfaces, so handlers that change the state of the agent or that
+// expose secrets must not be reachable from other hosts.
+func LoopbackOnly(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackCaller(r) {
+			seelog.Warnf("Denied %s request to %s from %s: only loopback callers are allowed",
+				r.Method, r.URL.Path, r.RemoteAddr)
+			responseJSON, err := json.Marshal(map[string]string{"Error": "only loopback callers are allowed"})
+			if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+				return
+			}
+			utils.WriteJSONToResponse(w, http.StatusForbidden, responseJSON, loopbackOnlyRequestType)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func isLoopbackCaller(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
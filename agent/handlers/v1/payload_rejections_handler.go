@@ -0,0 +1,55 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	acshandler "github.com/aws/amazon-ecs-agent/agent/acs/handler"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// PayloadRejectionsPath is the path of the rejected ACS payloads for the v1 handler.
+	PayloadRejectionsPath = "/v1/payloads/rejections"
+
+	payloadRejectionsRequestType = "payload rejections"
+)
+
+// PayloadRejectionsResponse is the latest tasks of ACS payloads that the agent rejected or
+// failed to start, oldest first, and the number of rejections of each category since the
+// agent started.
+type PayloadRejectionsResponse struct {
+	Rejections []acshandler.PayloadRejection                  `json:"Rejections"`
+	Counts     map[acshandler.PayloadRejectionCategory]uint64 `json:"Counts"`
+}
+
+// PayloadRejectionsHandler creates response for 'v1/payloads/rejections' API.
+func PayloadRejectionsHandler(reporter acshandler.PayloadRejectionReporter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := PayloadRejectionsResponse{
+			Rejections: []acshandler.PayloadRejection{},
+			Counts:     map[acshandler.PayloadRejectionCategory]uint64{},
+		}
+		if reporter != nil {
+			response.Rejections, response.Counts = reporter.PayloadRejections()
+		}
+		responseJSON, err := json.Marshal(response)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, payloadRejectionsRequestType)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	acshandler "github.com/aws/amazon-ecs-agent/agent/acs/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePayloadRejectionReporter []acshandler.PayloadRejection
+
+func (r fakePayloadRejectionReporter) PayloadRejections() ([]acshandler.PayloadRejection,
+	map[acshandler.PayloadRejectionCategory]uint64) {
+	counts := make(map[acshandler.PayloadRejectionCategory]uint64)
+	for _, rejection := range r {
+		counts[rejection.Category]++
+	}
+	return r, counts
+}
+
+func TestPayloadRejectionsHandler(t *testing.T) {
+	rejection := acshandler.PayloadRejection{
+		MessageID: "123",
+		TaskARN:   "arn:aws:ecs:us-west-2:123456789012:task/cluster/task1",
+		Timestamp: time.Date(2023, time.November, 14, 22, 13, 20, 0, time.UTC),
+		Category:  acshandler.RejectionUnsupportedCapability,
+		Detail:    "agent does not support proxy type other than app mesh",
+	}
+	for _, tc := range []struct {
+		name             string
+		reporter         acshandler.PayloadRejectionReporter
+		expectedResponse string
+	}{
+		{
+			name:             "no reporter",
+			expectedResponse: `{"Rejections":[],"Counts":{}}`,
+		},
+		{
+			name:     "rejections",
+			reporter: fakePayloadRejectionReporter{rejection},
+			expectedResponse: `{"Rejections":[{"MessageId":"123",` +
+				`"TaskArn":"arn:aws:ecs:us-west-2:123456789012:task/cluster/task1",` +
+				`"Timestamp":"2023-11-14T22:13:20Z","Category":"UnsupportedCapability",` +
+				`"Detail":"agent does not support proxy type other than app mesh"}],` +
+				`"Counts":{"UnsupportedCapability":1}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			PayloadRejectionsHandler(tc.reporter)(recorder, httptest.NewRequest("GET", PayloadRejectionsPath, nil))
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.JSONEq(t, tc.expectedResponse, recorder.Body.String())
+		})
+	}
+}
@@ -14,12 +14,22 @@
 package v1
 
 import (
+	"sort"
+	"time"
+
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/credentials/instancecreds"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	agentutils "github.com/aws/amazon-ecs-agent/agent/utils"
 	apieni "github.com/aws/amazon-ecs-agent/ecs-agent/api/eni"
 	tmdsresponse "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/response"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
+	"github.com/cihub/seelog"
 )
 
 // MetadataResponse is the schema for the metadata response JSON object
@@ -27,6 +37,16 @@ type MetadataResponse struct {
 	Cluster              string  `json:"Cluster"`
 	ContainerInstanceArn *string `json:"ContainerInstanceArn"`
 	Version              string  `json:"Version"`
+	// DockerCircuitBreaker is the state of the circuit breaker guarding calls to docker
+	DockerCircuitBreaker *dockerapi.CircuitBreakerStatus `json:"DockerCircuitBreaker,omitempty"`
+	// ClockDrift is the latest estimate of the host clock skew
+	ClockDrift *clockdrift.Estimate `json:"ClockDrift,omitempty"`
+	// StateReconciliation is the progress of the reconciliation of the containers restored
+	// from the saved state with docker
+	StateReconciliation *engine.ReconciliationProgress `json:"StateReconciliation,omitempty"`
+	// InstanceCredentialsRotation is the status of the rotation of the instance credentials
+	// of external instances
+	InstanceCredentialsRotation *instancecreds.RotationStatus `json:"InstanceCredentialsRotation,omitempty"`
 }
 
 // TaskResponse is the schema for the task response JSON object
@@ -37,6 +57,21 @@ type TaskResponse struct {
 	Family        string              `json:"Family"`
 	Version       string              `json:"Version"`
 	Containers    []ContainerResponse `json:"Containers"`
+	// CredentialSpec is set for tasks that use credential specs (gMSA)
+	CredentialSpec *CredentialSpecResponse `json:"CredentialSpec,omitempty"`
+	// CPUBurstMode is how the cgroup of burst-only tasks is configured for the task to only
+	// use idle CPU
+	CPUBurstMode string `json:"CPUBurstMode,omitempty"`
+}
+
+// CredentialSpecResponse is the schema for the credential spec status JSON object. It
+// holds the locations of the credential specs, never their contents.
+type CredentialSpecResponse struct {
+	State          string     `json:"State"`
+	Reason         string     `json:"Reason,omitempty"`
+	Locations      []string   `json:"Locations,omitempty"`
+	UpdatedAt      *time.Time `json:"UpdatedAt,omitempty"`
+	RenewalWarning bool       `json:"RenewalWarning,omitempty"`
 }
 
 // TasksResponse is the schema for the tasks response JSON object
@@ -52,12 +87,38 @@ type ContainerResponse struct {
 	Ports      []tmdsresponse.PortResponse   `json:"Ports,omitempty"`
 	Networks   []tmdsresponse.Network        `json:"Networks,omitempty"`
 	Volumes    []tmdsresponse.VolumeResponse `json:"Volumes,omitempty"`
+	WaitingFor []DependsOnResponse           `json:"WaitingFor,omitempty"`
+	// CgroupPath, PIDNamespaceInode and VolumeDevices are read from the host for
+	// running containers so that host-level tooling can map containers without
+	// talking to docker.
+	CgroupPath        string                 `json:"CgroupPath,omitempty"`
+	PIDNamespaceInode uint64                 `json:"PidNamespaceInode,omitempty"`
+	VolumeDevices     []VolumeDeviceResponse `json:"VolumeDevices,omitempty"`
+	// PullProgress is the progress of the pull of the container's image while it's
+	// being pulled
+	PullProgress *dockerapi.ImagePullProgress `json:"PullProgress,omitempty"`
+}
+
+// VolumeDeviceResponse is the schema for the device that backs a volume mounted
+// in a container
+type VolumeDeviceResponse struct {
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+	// Device is the major:minor number of the device containing Source
+	Device string `json:"Device"`
+}
+
+// DependsOnResponse is the schema for a container ordering dependency that a container
+// is blocked on
+type DependsOnResponse struct {
+	ContainerName string `json:"ContainerName"`
+	Condition     string `json:"Condition"`
 }
 
 // NewTaskResponse creates a TaskResponse for a task.
 func NewTaskResponse(task *apitask.Task, containerMap map[string]*apicontainer.DockerContainer) *TaskResponse {
 	containers := []ContainerResponse{}
-	for _, container := range containerMap {
+	for _, container := range SortedContainers(containerMap) {
 		if container.Container.IsInternal() {
 			continue
 		}
@@ -75,12 +136,54 @@ func NewTaskResponse(task *apitask.Task, containerMap map[string]*apicontainer.D
 	}
 
 	return &TaskResponse{
-		Arn:           task.Arn,
-		DesiredStatus: desiredStatus,
-		KnownStatus:   knownBackendStatus,
-		Family:        task.Family,
-		Version:       task.Version,
-		Containers:    containers,
+		Arn:            task.Arn,
+		DesiredStatus:  desiredStatus,
+		KnownStatus:    knownBackendStatus,
+		Family:         task.Family,
+		Version:        task.Version,
+		Containers:     containers,
+		CredentialSpec: newCredentialSpecResponse(task),
+		CPUBurstMode:   task.GetCPUBurstMode(),
+	}
+}
+
+// SortedContainers returns the containers of the map in the order that they were created
+// in, followed by the containers that weren't created yet. Containers created at the same
+// time, and containers that weren't created yet, are sorted by name. Responses list the
+// containers of tasks in this order, so that it doesn't change across requests.
+func SortedContainers(containerMap map[string]*apicontainer.DockerContainer) []*apicontainer.DockerContainer {
+	containers := make([]*apicontainer.DockerContainer, 0, len(containerMap))
+	createdAt := make(map[*apicontainer.DockerContainer]time.Time, len(containerMap))
+	for _, container := range containerMap {
+		containers = append(containers, container)
+		createdAt[container] = container.Container.GetCreatedAt()
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		iCreatedAt, jCreatedAt := createdAt[containers[i]], createdAt[containers[j]]
+		if !iCreatedAt.Equal(jCreatedAt) {
+			if iCreatedAt.IsZero() || jCreatedAt.IsZero() {
+				return jCreatedAt.IsZero()
+			}
+			return iCreatedAt.Before(jCreatedAt)
+		}
+		return containers[i].Container.Name < containers[j].Container.Name
+	})
+	return containers
+}
+
+// newCredentialSpecResponse creates CredentialSpecResponse for a task, or returns nil if the
+// task doesn't use credential specs.
+func newCredentialSpecResponse(task *apitask.Task) *CredentialSpecResponse {
+	lifecycle := task.GetCredentialSpecLifecycleStatus()
+	if lifecycle == nil || lifecycle.State == "" {
+		return nil
+	}
+	return &CredentialSpecResponse{
+		State:          lifecycle.State,
+		Reason:         lifecycle.Reason,
+		Locations:      lifecycle.Locations,
+		UpdatedAt:      lifecycle.UpdatedAt,
+		RenewalWarning: lifecycle.RenewalWarning,
 	}
 }
 
@@ -96,6 +199,24 @@ func NewContainerResponse(dockerContainer *apicontainer.DockerContainer, eni *ap
 	resp.Ports = NewPortBindingsResponse(dockerContainer, eni)
 	resp.Volumes = NewVolumesResponse(dockerContainer)
 
+	for _, dependency := range container.GetWaitingFor() {
+		resp.WaitingFor = append(resp.WaitingFor, DependsOnResponse{
+			ContainerName: dependency.ContainerName,
+			Condition:     dependency.Condition,
+		})
+	}
+
+	if container.GetKnownStatus() < apicontainerstatus.ContainerPulled {
+		if progress, ok := dockerapi.GetImagePullProgress(container.Image); ok {
+			resp.PullProgress = &progress
+		}
+	}
+
+	if pid := container.GetPID(); pid != 0 &&
+		container.GetKnownStatus() == apicontainerstatus.ContainerRunning {
+		setContainerProcResponse(&resp, dockerContainer, pid)
+	}
+
 	if eni != nil {
 		resp.Networks = []tmdsresponse.Network{
 			{
@@ -108,6 +229,37 @@ func NewContainerResponse(dockerContainer *apicontainer.DockerContainer, eni *ap
 	return resp
 }
 
+// setContainerProcResponse sets the fields of the container response that are read
+// from the host for the container's init process. These are read on every request, so
+// they follow the container across restarts.
+func setContainerProcResponse(resp *ContainerResponse, dockerContainer *apicontainer.DockerContainer, pid int) {
+	cgroupPath, err := agentutils.GetCgroupPath(pid)
+	if err != nil {
+		seelog.Debugf("Unable to get cgroup path of container %s: %v", dockerContainer.DockerID, err)
+	}
+	resp.CgroupPath = cgroupPath
+
+	pidNamespaceInode, err := agentutils.GetPIDNamespaceInode(pid)
+	if err != nil {
+		seelog.Debugf("Unable to get pid namespace of container %s: %v", dockerContainer.DockerID, err)
+	}
+	resp.PIDNamespaceInode = pidNamespaceInode
+
+	for _, volume := range dockerContainer.Container.GetVolumes() {
+		device, err := agentutils.GetDeviceNumber(volume.Source)
+		if err != nil {
+			seelog.Debugf("Unable to get device of volume %s of container %s: %v",
+				volume.Source, dockerContainer.DockerID, err)
+			continue
+		}
+		resp.VolumeDevices = append(resp.VolumeDevices, VolumeDeviceResponse{
+			Source:      volume.Source,
+			Destination: volume.Destination,
+			Device:      device,
+		})
+	}
+}
+
 // NewPortBindingsResponse creates PortResponse for a container.
 func NewPortBindingsResponse(dockerContainer *apicontainer.DockerContainer, eni *apieni.ENI) []tmdsresponse.PortResponse {
 	container := dockerContainer.Container
@@ -154,12 +306,35 @@ func NewVolumesResponse(dockerContainer *apicontainer.DockerContainer) []tmdsres
 
 		resp = append(resp, volResp)
 	}
+	// Volumes are sorted by name, and bind mounts, which don't have one, by destination
+	sort.SliceStable(resp, func(i, j int) bool {
+		if resp[i].DockerName != resp[j].DockerName {
+			return resp[i].DockerName < resp[j].DockerName
+		}
+		return resp[i].Destination < resp[j].Destination
+	})
 	return resp
 }
 
 // NewTasksResponse creates TasksResponse for all the tasks.
 func NewTasksResponse(state dockerstate.TaskEngineState) *TasksResponse {
-	allTasks := state.AllExternalTasks()
+	return newTasksResponse(state.AllExternalTasks(), state)
+}
+
+// NewTasksResponseFromSnapshot creates TasksResponse for the external tasks of a snapshot
+// of the tasks managed by the task engine, which is taken without blocking on the task
+// engine adding or removing tasks.
+func NewTasksResponseFromSnapshot(snapshot []*apitask.Task, state dockerstate.TaskEngineState) *TasksResponse {
+	externalTasks := make([]*apitask.Task, 0, len(snapshot))
+	for _, task := range snapshot {
+		if !task.IsInternal {
+			externalTasks = append(externalTasks, task)
+		}
+	}
+	return newTasksResponse(externalTasks, state)
+}
+
+func newTasksResponse(allTasks []*apitask.Task, state dockerstate.TaskEngineState) *TasksResponse {
 	taskResponses := make([]*TaskResponse, len(allTasks))
 	for ndx, task := range allTasks {
 		containerMap, _ := state.ContainerMapByArn(task.Arn)
@@ -0,0 +1,64 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"os"
+	"testing"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerResponseProcInfo(t *testing.T) {
+	volumeSource := t.TempDir()
+	container := &apicontainer.Container{
+		Name: containerName,
+		VolumesUnsafe: []types.MountPoint{
+			{
+				Source:      volumeSource,
+				Destination: volDestination,
+			},
+		},
+	}
+	dockerContainer := &apicontainer.DockerContainer{
+		DockerID:   containerID,
+		DockerName: containerName,
+		Container:  container,
+	}
+
+	// Nothing is reported for containers that are not running
+	container.SetPID(os.Getpid())
+	containerResponse := NewContainerResponse(dockerContainer, nil)
+	assert.Empty(t, containerResponse.CgroupPath)
+	assert.Zero(t, containerResponse.PIDNamespaceInode)
+	assert.Empty(t, containerResponse.VolumeDevices)
+
+	// Use the test process in place of the container's init process
+	container.SetKnownStatus(apicontainerstatus.ContainerRunning)
+	containerResponse = NewContainerResponse(dockerContainer, nil)
+	assert.NotEmpty(t, containerResponse.CgroupPath)
+	assert.NotZero(t, containerResponse.PIDNamespaceInode)
+	if assert.Len(t, containerResponse.VolumeDevices, 1) {
+		assert.Equal(t, volumeSource, containerResponse.VolumeDevices[0].Source)
+		assert.Equal(t, volDestination, containerResponse.VolumeDevices[0].Destination)
+		assert.Regexp(t, `^\d+:\d+$`, containerResponse.VolumeDevices[0].Device)
+	}
+}
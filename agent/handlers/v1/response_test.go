@@ -19,14 +19,20 @@ package v1
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource/credentialspec"
 	apieni "github.com/aws/amazon-ecs-agent/ecs-agent/api/eni"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 
 	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -134,6 +140,31 @@ func TestTaskResponse(t *testing.T) {
 	assert.Equal(t, expectedTaskResponseMap, taskResponseMap)
 }
 
+func TestTaskResponseCredentialSpec(t *testing.T) {
+	task := &apitask.Task{
+		Arn:                taskARN,
+		ResourcesMapUnsafe: make(map[string][]taskresource.TaskResource),
+	}
+	assert.Nil(t, NewTaskResponse(task, nil).CredentialSpec)
+
+	credSpec := "credentialspecdomainless:arn:aws:s3:::bucket/spec.json"
+	credentialspecResource, err := credentialspec.NewCredentialSpecResource(taskARN, "us-west-2", "",
+		credentials.NewManager(), nil, nil, nil, map[string]string{credSpec: containerName})
+	require.NoError(t, err)
+	task.AddResource(credentialspec.ResourceName, credentialspecResource)
+	credentialspecResource.MarkRenewalResult(errors.New("access denied"))
+
+	taskResponse := NewTaskResponse(task, nil)
+	require.NotNil(t, taskResponse.CredentialSpec)
+	assert.Equal(t, credentialspec.LifecycleFailed, taskResponse.CredentialSpec.State)
+	assert.Equal(t, "access denied", taskResponse.CredentialSpec.Reason)
+	assert.True(t, taskResponse.CredentialSpec.RenewalWarning)
+
+	taskResponseJSON, err := json.Marshal(taskResponse)
+	require.NoError(t, err)
+	assert.Contains(t, string(taskResponseJSON), `"Locations":["arn:aws:s3:::bucket/spec.json"]`)
+}
+
 func TestContainerResponse(t *testing.T) {
 	expectedContainerResponseMap := map[string]interface{}{
 		"DockerId":   "cid",
@@ -204,6 +235,35 @@ func TestContainerResponse(t *testing.T) {
 	assert.Equal(t, expectedContainerResponseMap, containerResponseMap)
 }
 
+func TestContainerResponseWaitingFor(t *testing.T) {
+	container := &apicontainer.Container{
+		Name: containerName,
+	}
+	dockerContainer := &apicontainer.DockerContainer{
+		DockerID:   containerID,
+		DockerName: containerName,
+		Container:  container,
+	}
+
+	// Containers that are not blocked on dependencies do not report any
+	containerResponse := NewContainerResponse(dockerContainer, nil)
+	assert.Empty(t, containerResponse.WaitingFor)
+
+	container.SetWaitingFor([]apicontainer.DependsOn{
+		{
+			ContainerName: "db",
+			Condition:     "HEALTHY",
+		},
+	})
+	containerResponse = NewContainerResponse(dockerContainer, nil)
+	assert.Equal(t, []DependsOnResponse{
+		{
+			ContainerName: "db",
+			Condition:     "HEALTHY",
+		},
+	}, containerResponse.WaitingFor)
+}
+
 func TestPortBindingsResponse(t *testing.T) {
 	container := &apicontainer.Container{
 		Name: containerName,
@@ -249,3 +309,43 @@ func TestVolumesResponse(t *testing.T) {
 	assert.Equal(t, volSource, VolumesResponse[0].Source)
 	assert.Equal(t, volDestination, VolumesResponse[0].Destination)
 }
+
+func TestSortedContainers(t *testing.T) {
+	createdAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	containerMap := map[string]*apicontainer.DockerContainer{}
+	for name, created := range map[string]time.Time{
+		"app":     createdAt.Add(time.Second),
+		"sidecar": createdAt.Add(time.Second),
+		"init":    createdAt,
+		"pending": {},
+		"agent":   {},
+	} {
+		container := &apicontainer.Container{Name: name}
+		container.SetCreatedAt(created)
+		containerMap[name] = &apicontainer.DockerContainer{Container: container}
+	}
+
+	var names []string
+	for _, container := range SortedContainers(containerMap) {
+		names = append(names, container.Container.Name)
+	}
+	assert.Equal(t, []string{"init", "app", "sidecar", "agent", "pending"}, names)
+}
+
+func TestVolumesResponseIsSorted(t *testing.T) {
+	container := &apicontainer.Container{
+		Name: containerName,
+		VolumesUnsafe: []types.MountPoint{
+			{Name: "volume2", Source: "/var/lib/volume2", Destination: "/volume2"},
+			{Source: "/tmp", Destination: "/tmp"},
+			{Name: volName, Source: volSource, Destination: volDestination},
+			{Source: "/etc/config", Destination: "/config"},
+		},
+	}
+
+	var destinations []string
+	for _, volume := range NewVolumesResponse(&apicontainer.DockerContainer{Container: container}) {
+		destinations = append(destinations, volume.Destination)
+	}
+	assert.Equal(t, []string{"/config", "/tmp", volDestination, "/volume2"}, destinations)
+}
@@ -18,6 +18,7 @@ import (
 	"net/http"
 
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/handlers/utils"
 	commonutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
@@ -101,7 +102,13 @@ func TaskContainerMetadataHandler(taskEngine utils.DockerStateResolver) func(htt
 			w.WriteHeader(status)
 		} else {
 			// List all tasks.
-			responseJSON, err = json.Marshal(NewTasksResponse(dockerTaskEngineState))
+			var tasksResponse *TasksResponse
+			if snapshotter, ok := taskEngine.(engine.TaskSnapshotter); ok {
+				tasksResponse = NewTasksResponseFromSnapshot(snapshotter.TaskSnapshot(), dockerTaskEngineState)
+			} else {
+				tasksResponse = NewTasksResponse(dockerTaskEngineState)
+			}
+			responseJSON, err = json.Marshal(tasksResponse)
 			if err != nil {
 				responseJSON = []byte("")
 				w.WriteHeader(http.StatusInternalServerError)
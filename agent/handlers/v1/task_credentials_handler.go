@@ -0,0 +1,84 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	commonutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+const (
+	// TaskCredentialsPath is the task credentials path for v1 handler.
+	TaskCredentialsPath = "/v1/credentials/tasks"
+
+	taskCredentialsRequestType = "task credentials"
+)
+
+// TaskCredentialsResponse is the schema for the task credentials response JSON object.
+type TaskCredentialsResponse struct {
+	Tasks []TaskCredentialsSummary `json:"Tasks"`
+}
+
+// TaskCredentialsSummary lists the role types that a task has credentials for.
+type TaskCredentialsSummary struct {
+	TaskARN     string                   `json:"TaskArn"`
+	Credentials []RoleCredentialsSummary `json:"Credentials"`
+}
+
+// RoleCredentialsSummary describes the credentials of a task for one of its roles.
+type RoleCredentialsSummary struct {
+	RoleType   string `json:"RoleType"`
+	Expiration string `json:"Expiration"`
+}
+
+// TaskCredentialsHandler creates response for 'v1/credentials/tasks' API. The response
+// lists, per task known to the task engine, the role types that the credentials manager
+// has credentials for and their expirations, such as both the task role and the execution
+// role. The taskarn query parameter limits the response to a single task. Neither secrets
+// nor credentials ids are included.
+func TaskCredentialsHandler(taskEngine utils.DockerStateResolver,
+	credentialsManager credentials.Manager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var taskARNs []string
+		if taskARN := r.URL.Query().Get(taskARNQueryField); taskARN != "" {
+			taskARNs = []string{taskARN}
+		} else {
+			for _, task := range taskEngine.State().AllTasks() {
+				taskARNs = append(taskARNs, task.Arn)
+			}
+			sort.Strings(taskARNs)
+		}
+		response := TaskCredentialsResponse{Tasks: make([]TaskCredentialsSummary, 0, len(taskARNs))}
+		for _, taskARN := range taskARNs {
+			summary := TaskCredentialsSummary{TaskARN: taskARN, Credentials: []RoleCredentialsSummary{}}
+			for _, taskCredentials := range credentialsManager.GetAllCredentialsForTaskARN(taskARN) {
+				summary.Credentials = append(summary.Credentials, RoleCredentialsSummary{
+					RoleType:   taskCredentials.IAMRoleCredentials.RoleType,
+					Expiration: taskCredentials.IAMRoleCredentials.Expiration,
+				})
+			}
+			response.Tasks = append(response.Tasks, summary)
+		}
+		responseJSON, err := json.Marshal(response)
+		if e := commonutils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		commonutils.WriteJSONToResponse(w, http.StatusOK, responseJSON, taskCredentialsRequestType)
+	}
+}
@@ -0,0 +1,128 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	mock_utils "github.com/aws/amazon-ecs-agent/agent/handlers/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	taskARNBothRoles = "arn:aws:ecs:us-west-2:123456789012:task/cluster/both"
+	taskARNOneRole   = "arn:aws:ecs:us-west-2:123456789012:task/cluster/one"
+	taskARNNoRoles   = "arn:aws:ecs:us-west-2:123456789012:task/cluster/none"
+)
+
+func TestTaskCredentialsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	state := dockerstate.NewTaskEngineState()
+	for _, arn := range []string{taskARNBothRoles, taskARNOneRole, taskARNNoRoles} {
+		state.AddTask(&apitask.Task{Arn: arn})
+	}
+	stateResolver := mock_utils.NewMockDockerStateResolver(ctrl)
+	stateResolver.EXPECT().State().Return(state).AnyTimes()
+
+	manager := credentials.NewManager()
+	for _, taskCredentials := range []credentials.TaskIAMRoleCredentials{
+		{
+			ARN: taskARNBothRoles,
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				RoleType:        credentials.ApplicationRoleType,
+				CredentialsID:   "app",
+				SecretAccessKey: "secret",
+				Expiration:      "2023-11-14T23:13:20Z",
+			},
+		},
+		{
+			ARN: taskARNBothRoles,
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				RoleType:        credentials.ExecutionRoleType,
+				CredentialsID:   "exec",
+				SecretAccessKey: "secret",
+				Expiration:      "2023-11-14T23:43:20Z",
+			},
+		},
+		{
+			ARN: taskARNOneRole,
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				RoleType:        credentials.ExecutionRoleType,
+				CredentialsID:   "one",
+				SecretAccessKey: "secret",
+				Expiration:      "2023-11-15T00:13:20Z",
+			},
+		},
+	} {
+		taskCredentials := taskCredentials
+		require.NoError(t, manager.SetTaskCredentials(&taskCredentials))
+	}
+
+	handler := TaskCredentialsHandler(stateResolver, manager)
+	for _, tc := range []struct {
+		name             string
+		path             string
+		expectedResponse string
+	}{
+		{
+			name: "all tasks",
+			path: TaskCredentialsPath,
+			expectedResponse: `{"Tasks":[` +
+				`{"TaskArn":"` + taskARNBothRoles + `","Credentials":[` +
+				`{"RoleType":"TaskApplication","Expiration":"2023-11-14T23:13:20Z"},` +
+				`{"RoleType":"TaskExecution","Expiration":"2023-11-14T23:43:20Z"}]},` +
+				`{"TaskArn":"` + taskARNNoRoles + `","Credentials":[]},` +
+				`{"TaskArn":"` + taskARNOneRole + `","Credentials":[` +
+				`{"RoleType":"TaskExecution","Expiration":"2023-11-15T00:13:20Z"}]}]}`,
+		},
+		{
+			name: "task with one role",
+			path: TaskCredentialsPath + "?taskarn=" + taskARNOneRole,
+			expectedResponse: `{"Tasks":[{"TaskArn":"` + taskARNOneRole + `","Credentials":[` +
+				`{"RoleType":"TaskExecution","Expiration":"2023-11-15T00:13:20Z"}]}]}`,
+		},
+		{
+			name:             "task without roles",
+			path:             TaskCredentialsPath + "?taskarn=" + taskARNNoRoles,
+			expectedResponse: `{"Tasks":[{"TaskArn":"` + taskARNNoRoles + `","Credentials":[]}]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.JSONEq(t, tc.expectedResponse, recorder.Body.String())
+			assert.NotContains(t, recorder.Body.String(), "secret")
+		})
+	}
+
+	// Removing the credentials of one role keeps those of the other
+	manager.RemoveCredentials("app")
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, TaskCredentialsPath+"?taskarn="+taskARNBothRoles, nil))
+	assert.JSONEq(t, `{"Tasks":[{"TaskArn":"`+taskARNBothRoles+`","Credentials":[`+
+		`{"RoleType":"TaskExecution","Expiration":"2023-11-14T23:43:20Z"}]}]}`, recorder.Body.String())
+}
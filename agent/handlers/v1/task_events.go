@@ -0,0 +1,199 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/arn"
+)
+
+const (
+	// TaskEventType is the type of the events of task state transitions.
+	TaskEventType = "task"
+	// ContainerEventType is the type of the events of container state transitions.
+	ContainerEventType = "container"
+	// ResourceEventType is the type of the events of attempts to create task resources,
+	// and of rollbacks of task resources.
+	ResourceEventType = "resource"
+
+	// DefaultTaskEventsBufferSize is the number of events buffered for each client of the
+	// events endpoint before the client is dropped.
+	DefaultTaskEventsBufferSize = 256
+)
+
+// TaskEvent is a task, container or task resource state transition, as streamed by the
+// events endpoint. Events are numbered in sequence, so that clients can detect the events
+// they missed.
+type TaskEvent struct {
+	Sequence      uint64    `json:"Sequence"`
+	Type          string    `json:"Type"`
+	TaskArn       string    `json:"TaskArn"`
+	ContainerName string    `json:"ContainerName,omitempty"`
+	DockerId      string    `json:"DockerId,omitempty"`
+	ResourceName  string    `json:"ResourceName,omitempty"`
+	ResourceType  string    `json:"ResourceType,omitempty"`
+	Status        string    `json:"Status"`
+	Reason        string    `json:"Reason,omitempty"`
+	ExitCode      *int      `json:"ExitCode,omitempty"`
+	Attempt       int       `json:"Attempt,omitempty"`
+	MaxAttempts   int       `json:"MaxAttempts,omitempty"`
+	Time          time.Time `json:"Time"`
+}
+
+// TaskEventBroadcaster broadcasts the task, container and resource state changes of the
+// engine to the subscribed clients of the events endpoint. Each subscription buffers a
+// bounded number of events, and subscriptions that fall behind are dropped rather than
+// holding up the engine.
+type TaskEventBroadcaster struct {
+	bufferSize int
+	now        func() time.Time
+
+	lock          sync.Mutex
+	sequence      uint64
+	subscriptions map[*TaskEventSubscription]struct{}
+}
+
+// TaskEventSubscription receives the events of a subscribed client.
+type TaskEventSubscription struct {
+	task    string
+	events  chan TaskEvent
+	dropped bool
+}
+
+// NewTaskEventBroadcaster creates a broadcaster that buffers up to bufferSize events for
+// each subscription, or DefaultTaskEventsBufferSize if bufferSize isn't positive.
+func NewTaskEventBroadcaster(bufferSize int) *TaskEventBroadcaster {
+	if bufferSize <= 0 {
+		bufferSize = DefaultTaskEventsBufferSize
+	}
+	return &TaskEventBroadcaster{
+		bufferSize:    bufferSize,
+		now:           time.Now,
+		subscriptions: make(map[*TaskEventSubscription]struct{}),
+	}
+}
+
+// Publish broadcasts the task, container or resource state change to the subscriptions.
+// Other state changes are ignored. Subscriptions whose buffer is full are dropped.
+func (b *TaskEventBroadcaster) Publish(change statechange.Event) {
+	var event TaskEvent
+	switch c := change.(type) {
+	case api.TaskStateChange:
+		event = TaskEvent{
+			Type:    TaskEventType,
+			TaskArn: c.TaskARN,
+			Status:  c.Status.String(),
+			Reason:  c.Reason,
+		}
+	case api.ContainerStateChange:
+		event = TaskEvent{
+			Type:          ContainerEventType,
+			TaskArn:       c.TaskArn,
+			ContainerName: c.ContainerName,
+			DockerId:      c.RuntimeID,
+			Status:        c.Status.String(),
+			Reason:        c.Reason,
+			ExitCode:      c.ExitCode,
+		}
+	case api.ResourceStateChange:
+		event = TaskEvent{
+			Type:         ResourceEventType,
+			TaskArn:      c.TaskArn,
+			ResourceName: c.ResourceName,
+			ResourceType: c.ResourceType,
+			Status:       c.Status,
+			Reason:       c.Reason,
+			Attempt:      c.Attempt,
+			MaxAttempts:  c.MaxAttempts,
+		}
+	default:
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.sequence++
+	event.Sequence = b.sequence
+	event.Time = b.now().UTC()
+	for subscription := range b.subscriptions {
+		if !subscription.matches(event.TaskArn) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped = true
+			b.unsubscribeUnsafe(subscription)
+		}
+	}
+}
+
+// Subscribe subscribes to the events of the task, identified by its ARN or ID, or to the
+// events of all tasks if task is empty.
+func (b *TaskEventBroadcaster) Subscribe(task string) *TaskEventSubscription {
+	subscription := &TaskEventSubscription{
+		task:   task,
+		events: make(chan TaskEvent, b.bufferSize),
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+// Unsubscribe removes the subscription and closes its events channel.
+func (b *TaskEventBroadcaster) Unsubscribe(subscription *TaskEventSubscription) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.unsubscribeUnsafe(subscription)
+}
+
+// Sequence returns the sequence number of the last event that was published.
+func (b *TaskEventBroadcaster) Sequence() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.sequence
+}
+
+func (b *TaskEventBroadcaster) unsubscribeUnsafe(subscription *TaskEventSubscription) {
+	if _, ok := b.subscriptions[subscription]; !ok {
+		return
+	}
+	delete(b.subscriptions, subscription)
+	close(subscription.events)
+}
+
+// Events returns the events of the subscription. The channel is closed once the
+// subscription is removed, after the events that were buffered until then.
+func (s *TaskEventSubscription) Events() <-chan TaskEvent {
+	return s.events
+}
+
+// Dropped returns whether the subscription was removed because its buffer was full. It
+// must only be called once the events channel is closed.
+func (s *TaskEventSubscription) Dropped() bool {
+	return s.dropped
+}
+
+func (s *TaskEventSubscription) matches(taskARN string) bool {
+	if s.task == "" || s.task == taskARN {
+		return true
+	}
+	taskID, err := arn.TaskIdFromArn(taskARN)
+	return err == nil && s.task == taskID
+}
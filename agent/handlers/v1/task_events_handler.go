@@ -0,0 +1,162 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// TaskEventsPath is the task and container state transition events path for v1 handler.
+	TaskEventsPath = "/v1/events"
+
+	// OverflowEventType is the type of the event sent before a client of the events
+	// endpoint is dropped because it fell behind. Clients should list the tasks again
+	// before subscribing again.
+	OverflowEventType = "overflow"
+
+	// ConnectedEventType is the type of the event sent once a client of the events
+	// endpoint is subscribed. Its data has the sequence number of the last event published
+	// before the subscription.
+	ConnectedEventType = "connected"
+
+	taskEventsRequestType = "task events"
+	taskEventsQueryField  = "task"
+
+	// taskEventsWriteTimeout is the maximum duration of each write of an event stream. The
+	// write deadline of the connection is extended before each write, since streams
+	// outlast the write timeout of the introspection server.
+	taskEventsWriteTimeout = 5 * time.Second
+)
+
+type connContextKey struct{}
+
+// ConnContext adds the connection of requests to their context, so that the write
+// deadline of the connections of event streams can be extended. It is meant to be the
+// ConnContext of the introspection server.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// sequenceEventData is the data of the connected and overflow events.
+type sequenceEventData struct {
+	Sequence uint64 `json:"Sequence"`
+}
+
+// TaskEventsHandler creates response for 'v1/events' API. The response is a stream of
+// Server-Sent Events with the task and container state transitions, of the task of the
+// task query parameter if it's set. A comment is sent as heartbeat every
+// heartbeatInterval. Clients that fall behind by more than the buffer of the broadcaster
+// are sent an overflow event and disconnected.
+func TaskEventsHandler(broadcaster *TaskEventBroadcaster, heartbeatInterval time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeTaskEventsError(w, http.StatusInternalServerError, "streaming is not supported")
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeTaskEventsError(w, http.StatusMethodNotAllowed, "events are streamed with a GET request")
+			return
+		}
+
+		subscription := broadcaster.Subscribe(r.URL.Query().Get(taskEventsQueryField))
+		defer broadcaster.Unsubscribe(subscription)
+		conn, _ := r.Context().Value(connContextKey{}).(net.Conn)
+		stream := &taskEventStream{w: w, flusher: flusher, conn: conn}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		lastSequence := broadcaster.Sequence()
+		if !stream.writeEvent("", ConnectedEventType, sequenceEventData{Sequence: lastSequence}) {
+			return
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if !stream.write(": heartbeat\n\n") {
+					return
+				}
+			case event, ok := <-subscription.Events():
+				if !ok {
+					if subscription.Dropped() {
+						seelog.Warnf("Dropped the task events stream of %s: the client fell behind by more than %d events",
+							r.RemoteAddr, broadcaster.bufferSize)
+						stream.writeEvent("", OverflowEventType, sequenceEventData{Sequence: lastSequence})
+					}
+					return
+				}
+				lastSequence = event.Sequence
+				if !stream.writeEvent(fmt.Sprint(event.Sequence), event.Type, event) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// taskEventStream writes the events of a stream to the client.
+type taskEventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	conn    net.Conn
+}
+
+func (s *taskEventStream) writeEvent(id, eventType string, data interface{}) bool {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		seelog.Errorf("Unable to marshal task event: %v", err)
+		return false
+	}
+	event := "event: " + eventType + "\ndata: " + string(dataJSON) + "\n\n"
+	if id != "" {
+		event = "id: " + id + "\n" + event
+	}
+	return s.write(event)
+}
+
+func (s *taskEventStream) write(chunk string) bool {
+	if s.conn != nil {
+		s.conn.SetWriteDeadline(time.Now().Add(taskEventsWriteTimeout))
+	}
+	if _, err := s.w.Write([]byte(chunk)); err != nil {
+		seelog.Debugf("Unable to write task events stream: %v", err)
+		return false
+	}
+	s.flusher.Flush()
+	return true
+}
+
+func writeTaskEventsError(w http.ResponseWriter, statusCode int, message string) {
+	responseJSON, err := json.Marshal(map[string]string{"Error": message})
+	if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+		return
+	}
+	utils.WriteJSONToResponse(w, statusCode, responseJSON, taskEventsRequestType)
+}
@@ -0,0 +1,263 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	eventsTestTask1ARN = "arn:aws:ecs:us-west-2:123456789012:task/cluster/task1"
+	eventsTestTask2ARN = "arn:aws:ecs:us-west-2:123456789012:task/cluster/task2"
+)
+
+// fakeEventsEngine publishes the state transitions of tasks like the engine event handler
+// does.
+type fakeEventsEngine struct {
+	broadcaster *TaskEventBroadcaster
+}
+
+func (e fakeEventsEngine) transitionTask(taskARN string, status apitaskstatus.TaskStatus) {
+	e.broadcaster.Publish(api.TaskStateChange{TaskARN: taskARN, Status: status})
+}
+
+func (e fakeEventsEngine) transitionContainer(taskARN, name string, status apicontainerstatus.ContainerStatus) {
+	e.broadcaster.Publish(api.ContainerStateChange{TaskArn: taskARN, ContainerName: name, RuntimeID: "id-" + name,
+		Status: status})
+}
+
+type sseEvent struct {
+	id, eventType, data string
+}
+
+// sseReader reads the events of a stream, counting the heartbeats in between.
+type sseReader struct {
+	reader     *bufio.Reader
+	heartbeats int
+}
+
+func (r *sseReader) next(t *testing.T) sseEvent {
+	var event sseEvent
+	for {
+		line, err := r.reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event.eventType != "" {
+				return event
+			}
+		case line == ": heartbeat":
+			r.heartbeats++
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func (r *sseReader) nextTaskEvent(t *testing.T) TaskEvent {
+	event := r.next(t)
+	var taskEvent TaskEvent
+	require.NoError(t, json.Unmarshal([]byte(event.data), &taskEvent))
+	assert.Equal(t, event.eventType, taskEvent.Type)
+	return taskEvent
+}
+
+func connectEvents(t *testing.T, server *httptest.Server, query string) *sseReader {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL + TaskEventsPath + query)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := &sseReader{reader: bufio.NewReader(resp.Body)}
+	// The connected event is sent once the client is subscribed
+	assert.Equal(t, ConnectedEventType, reader.next(t).eventType)
+	return reader
+}
+
+func TestTaskEventsHandlerDelivery(t *testing.T) {
+	broadcaster := NewTaskEventBroadcaster(16)
+	engine := fakeEventsEngine{broadcaster: broadcaster}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(TaskEventsHandler(broadcaster, 50*time.Millisecond)))
+	// Streams outlast the write timeout of the server
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	t.Cleanup(server.Close)
+
+	allTasks := connectEvents(t, server, "")
+	task1 := connectEvents(t, server, "?task=task1")
+	time.Sleep(200 * time.Millisecond)
+
+	engine.transitionContainer(eventsTestTask1ARN, "app", apicontainerstatus.ContainerRunning)
+	engine.transitionTask(eventsTestTask2ARN, apitaskstatus.TaskRunning)
+	engine.transitionTask(eventsTestTask1ARN, apitaskstatus.TaskRunning)
+
+	event := allTasks.nextTaskEvent(t)
+	assert.Equal(t, uint64(1), event.Sequence)
+	assert.Equal(t, ContainerEventType, event.Type)
+	assert.Equal(t, eventsTestTask1ARN, event.TaskArn)
+	assert.Equal(t, "app", event.ContainerName)
+	assert.Equal(t, "id-app", event.DockerId)
+	assert.Equal(t, "RUNNING", event.Status)
+	event = allTasks.nextTaskEvent(t)
+	assert.Equal(t, uint64(2), event.Sequence)
+	assert.Equal(t, TaskEventType, event.Type)
+	assert.Equal(t, eventsTestTask2ARN, event.TaskArn)
+	assert.Equal(t, uint64(3), allTasks.nextTaskEvent(t).Sequence)
+
+	// Only the events of the task are streamed to the filtered client, so the sequence
+	// numbers have a gap
+	assert.Equal(t, uint64(1), task1.nextTaskEvent(t).Sequence)
+	event = task1.nextTaskEvent(t)
+	assert.Equal(t, uint64(3), event.Sequence)
+	assert.Equal(t, eventsTestTask1ARN, event.TaskArn)
+	assert.Greater(t, allTasks.heartbeats+task1.heartbeats, 0)
+}
+
+// blockingResponseWriter is a response writer whose writes block once the first write
+// was done, until they are released.
+type blockingResponseWriter struct {
+	*httptest.ResponseRecorder
+	lock      sync.Mutex
+	writes    int
+	connected chan struct{}
+	released  chan struct{}
+	blocked   chan struct{}
+}
+
+func (w *blockingResponseWriter) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	w.writes++
+	writes := w.writes
+	w.lock.Unlock()
+	if writes == 1 {
+		defer close(w.connected)
+	}
+	if writes == 2 {
+		close(w.blocked)
+		<-w.released
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.ResponseRecorder.Write(b)
+}
+
+func (w *blockingResponseWriter) body() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.ResponseRecorder.Body.String()
+}
+
+func TestTaskEventsHandlerOverflow(t *testing.T) {
+	broadcaster := NewTaskEventBroadcaster(2)
+	engine := fakeEventsEngine{broadcaster: broadcaster}
+	server := httptest.NewServer(http.HandlerFunc(TaskEventsHandler(broadcaster, time.Hour)))
+	t.Cleanup(server.Close)
+	keepingUp := connectEvents(t, server, "")
+
+	w := &blockingResponseWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		connected:        make(chan struct{}),
+		released:         make(chan struct{}),
+		blocked:          make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		TaskEventsHandler(broadcaster, time.Hour)(w, httptest.NewRequest("GET", TaskEventsPath, nil))
+	}()
+	<-w.connected
+
+	// The handler of the slow client blocks writing the first event, so that the events
+	// that follow overflow its buffer. The client that keeps up reads each event before
+	// the next one is published, and gets all the events.
+	engine.transitionTask(eventsTestTask1ARN, apitaskstatus.TaskRunning)
+	assert.Equal(t, uint64(1), keepingUp.nextTaskEvent(t).Sequence)
+	<-w.blocked
+	for sequence := uint64(2); sequence <= 4; sequence++ {
+		engine.transitionTask(eventsTestTask1ARN, apitaskstatus.TaskRunning)
+		assert.Equal(t, sequence, keepingUp.nextTaskEvent(t).Sequence)
+	}
+	close(w.released)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow client wasn't disconnected")
+	}
+	body := w.body()
+	assert.Contains(t, body, "event: "+OverflowEventType+"\n")
+	assert.Contains(t, body, "id: 3\n")
+	assert.NotContains(t, body, "id: 4\n")
+}
+
+func TestTaskEventBroadcasterIgnoresOtherEvents(t *testing.T) {
+	broadcaster := NewTaskEventBroadcaster(0)
+	subscription := broadcaster.Subscribe("")
+	broadcaster.Publish(api.AttachmentStateChange{})
+	assert.Zero(t, broadcaster.Sequence())
+	broadcaster.Unsubscribe(subscription)
+	_, ok := <-subscription.Events()
+	assert.False(t, ok)
+	assert.False(t, subscription.Dropped())
+}
+
+func TestTaskEventBroadcasterResourceEvents(t *testing.T) {
+	broadcaster := NewTaskEventBroadcaster(0)
+	subscription := broadcaster.Subscribe("task1")
+	broadcaster.Publish(api.ResourceStateChange{
+		TaskArn:      eventsTestTask1ARN,
+		ResourceName: "cgroup",
+		ResourceType: "cgroup",
+		Status:       "CREATED",
+		Attempt:      1,
+		MaxAttempts:  3,
+		Reason:       "device or resource busy",
+	})
+	broadcaster.Publish(api.ResourceStateChange{TaskArn: eventsTestTask2ARN})
+
+	event := <-subscription.Events()
+	assert.Equal(t, uint64(1), event.Sequence)
+	assert.Equal(t, ResourceEventType, event.Type)
+	assert.Equal(t, eventsTestTask1ARN, event.TaskArn)
+	assert.Equal(t, "cgroup", event.ResourceName)
+	assert.Equal(t, "cgroup", event.ResourceType)
+	assert.Equal(t, "CREATED", event.Status)
+	assert.Equal(t, 1, event.Attempt)
+	assert.Equal(t, 3, event.MaxAttempts)
+	assert.Equal(t, "device or resource busy", event.Reason)
+	assert.Equal(t, uint64(2), broadcaster.Sequence())
+	assert.Empty(t, subscription.Events())
+}
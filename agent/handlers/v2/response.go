@@ -19,6 +19,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	v1 "github.com/aws/amazon-ecs-agent/agent/handlers/v1"
 	apieni "github.com/aws/amazon-ecs-agent/ecs-agent/api/eni"
@@ -49,7 +50,22 @@ func NewTaskResponse(
 	if !ok {
 		return nil, errors.Errorf("v2 task response: unable to find task '%s'", taskARN)
 	}
+	return NewTaskResponseFromTask(task, state, ecsClient, cluster, az, containerInstanceArn,
+		propagateTags, includeV4Metadata)
+}
 
+// NewTaskResponseFromTask creates a new response object for the task, for callers
+// that have already looked the task up.
+func NewTaskResponseFromTask(
+	task *apitask.Task,
+	state dockerstate.TaskEngineState,
+	ecsClient api.ECSClient,
+	cluster string,
+	az string,
+	containerInstanceArn string,
+	propagateTags bool,
+	includeV4Metadata bool,
+) (*tmdsv2.TaskResponse, error) {
 	resp := &tmdsv2.TaskResponse{
 		Cluster:          cluster,
 		TaskARN:          task.Arn,
@@ -92,13 +108,13 @@ func NewTaskResponse(
 		return resp, nil
 	}
 
-	for _, dockerContainer := range containerNameToDockerContainer {
+	for _, dockerContainer := range v1.SortedContainers(containerNameToDockerContainer) {
 		containerResponse := NewContainerResponse(dockerContainer, task.GetPrimaryENI(), includeV4Metadata)
 		resp.Containers = append(resp.Containers, containerResponse)
 	}
 
 	if propagateTags {
-		propagateTagsToMetadata(ecsClient, containerInstanceArn, taskARN, resp, includeV4Metadata)
+		propagateTagsToMetadata(ecsClient, containerInstanceArn, task.Arn, resp, includeV4Metadata)
 	}
 
 	return resp, nil
@@ -186,6 +202,7 @@ func NewContainerResponse(
 		resp.LogDriver = container.GetLogDriver()
 		resp.LogOptions = container.GetLogOptions()
 		resp.ContainerARN = container.ContainerArn
+		resp.PidMode = container.GetEffectivePIDMode()
 	}
 
 	// Write the container health status inside the container
@@ -217,9 +234,7 @@ func NewContainerResponse(
 		} else {
 			port.HostPort = port.ContainerPort
 		}
-		if includeV4Metadata {
-			port.HostIp = binding.BindIP
-		}
+		port.HostIp = binding.BindIP
 
 		resp.Ports = append(resp.Ports, port)
 	}
@@ -19,6 +19,8 @@ package v2
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -757,3 +759,148 @@ func TestDockerContainerHealthToV2HealthJSON(t *testing.T) {
 		})
 	}
 }
+
+// TestTaskResponseGolden locks the schema of the v2 task response for bridge and awsvpc
+// tasks, by comparing the responses with the golden files in testdata.
+func TestTaskResponseGolden(t *testing.T) {
+	createdAt, _ := time.Parse(time.RFC3339, "2023-05-01T10:00:00Z")
+	startedAt, _ := time.Parse(time.RFC3339, "2023-05-01T10:00:02Z")
+	testCases := []struct {
+		golden      string
+		eni         *apieni.ENI
+		portBinding apicontainer.PortBinding
+	}{
+		{
+			golden: "task_response_bridge.json",
+			portBinding: apicontainer.PortBinding{
+				ContainerPort: 80,
+				HostPort:      32768,
+				BindIP:        hostIp,
+				Protocol:      apicontainer.TransportProtocolTCP,
+			},
+		},
+		{
+			golden: "task_response_awsvpc.json",
+			eni: &apieni.ENI{
+				IPV4Addresses: []*apieni.ENIIPV4Address{{Address: eniIPv4Address}},
+			},
+			portBinding: apicontainer.PortBinding{
+				ContainerPort: 8080,
+				Protocol:      apicontainer.TransportProtocolUDP,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+			task := &apitask.Task{
+				Arn:                 taskARN,
+				Family:              family,
+				Version:             version,
+				DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+				KnownStatusUnsafe:   apitaskstatus.TaskRunning,
+				CPU:                 1,
+				Memory:              memory,
+			}
+			if tc.eni != nil {
+				task.ENIs = []*apieni.ENI{tc.eni}
+			}
+			container := &apicontainer.Container{
+				Name:                    containerName,
+				Image:                   imageName,
+				ImageID:                 imageID,
+				DesiredStatusUnsafe:     apicontainerstatus.ContainerRunning,
+				KnownStatusUnsafe:       apicontainerstatus.ContainerRunning,
+				CPU:                     cpu,
+				Memory:                  memory,
+				Type:                    apicontainer.ContainerNormal,
+				KnownPortBindingsUnsafe: []apicontainer.PortBinding{tc.portBinding},
+			}
+			container.SetCreatedAt(createdAt)
+			container.SetStartedAt(startedAt)
+			state.EXPECT().ContainerMapByArn(taskARN).Return(map[string]*apicontainer.DockerContainer{
+				containerName: {
+					DockerID:   containerID,
+					DockerName: containerName,
+					Container:  container,
+				},
+			}, true)
+
+			taskResponse, err := NewTaskResponseFromTask(task, state, nil, cluster, availabilityZone,
+				containerInstanceArn, false, false)
+			require.NoError(t, err)
+			taskResponseJSON, err := json.MarshalIndent(taskResponse, "", "  ")
+			require.NoError(t, err)
+			golden, err := os.ReadFile(filepath.Join("testdata", tc.golden))
+			require.NoError(t, err)
+			assert.Equal(t, string(golden), string(taskResponseJSON)+"\n")
+		})
+	}
+}
+
+// TestTaskResponseGoldenIsDeterministic tests that the v2 task response of a task with several
+// containers, volumes and labels is serialized to the same bytes on every request, with the
+// containers listed in the order that they were created in.
+func TestTaskResponseGoldenIsDeterministic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	createdAt, _ := time.Parse(time.RFC3339, "2023-05-01T10:00:00Z")
+	state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+	task := &apitask.Task{
+		Arn:                 taskARN,
+		Family:              family,
+		Version:             version,
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		KnownStatusUnsafe:   apitaskstatus.TaskRunning,
+	}
+	newContainer := func(name string, createdAt time.Time) *apicontainer.Container {
+		container := &apicontainer.Container{
+			Name:                name,
+			Image:               imageName,
+			DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+			CPU:                 cpu,
+			Memory:              memory,
+			Type:                apicontainer.ContainerNormal,
+		}
+		container.SetLabels(map[string]string{"com.example.b": "2", "com.example.a": "1", "com.example.c": "3"})
+		container.SetCreatedAt(createdAt)
+		return container
+	}
+	app := newContainer("app", createdAt.Add(time.Second))
+	app.SetVolumes([]types.MountPoint{
+		{Name: "volume2", Source: "/var/lib/volume2", Destination: "/volume2"},
+		{Source: "/tmp", Destination: "/tmp"},
+		{Name: volName, Source: volSource, Destination: volDestination},
+		{Source: "/etc/config", Destination: "/config"},
+	})
+	containers := map[string]*apicontainer.DockerContainer{}
+	for _, container := range []*apicontainer.Container{
+		app,
+		newContainer("sidecar", createdAt.Add(time.Second)),
+		newContainer("init", createdAt),
+		newContainer("pending", time.Time{}),
+		newContainer("agent", time.Time{}),
+	} {
+		containers[container.Name] = &apicontainer.DockerContainer{
+			DockerID:   container.Name + "-id",
+			DockerName: container.Name,
+			Container:  container,
+		}
+	}
+	state.EXPECT().ContainerMapByArn(taskARN).Return(containers, true).AnyTimes()
+
+	golden, err := os.ReadFile(filepath.Join("testdata", "task_response_containers.json"))
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		taskResponse, err := NewTaskResponseFromTask(task, state, nil, cluster, availabilityZone,
+			containerInstanceArn, false, true)
+		require.NoError(t, err)
+		taskResponseJSON, err := json.MarshalIndent(taskResponse, "", "  ")
+		require.NoError(t, err)
+		require.Equal(t, string(golden), string(taskResponseJSON)+"\n")
+	}
+}
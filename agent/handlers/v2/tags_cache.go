@@ -0,0 +1,218 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	tmdsv2 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v2"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// tagsRequestsPerSecond and tagsRequestsBurst bound the rate of the ECS API calls made
+	// to retrieve tags.
+	tagsRequestsPerSecond = 5
+	tagsRequestsBurst     = 10
+
+	// maxTagsRateLimitWait is the longest a request for tags that aren't cached waits for
+	// the rate limiter. Requests for tags that are cached don't wait, they are served the
+	// cached tags if the rate is exceeded.
+	maxTagsRateLimitWait = time.Second
+
+	// unusedTagsLifetime is how long the tags of a resource are kept after they were last
+	// requested, so that the tags of stopped tasks don't pile up.
+	unusedTagsLifetime = time.Hour
+)
+
+// errTagsRateExceeded is returned when tags aren't retrieved because the rate of ECS API
+// calls would be exceeded.
+var errTagsRateExceeded = errors.New("rate of tags requests exceeded")
+
+// CacheStatsRecorder counts the hits and misses of a cache.
+type CacheStatsRecorder interface {
+	RecordCacheHit()
+	RecordCacheMiss()
+}
+
+// ResourceTagsCache caches the tags of resources retrieved from ECS. Tags are retrieved
+// when they are first requested, and again when they are requested after the TTL.
+type ResourceTagsCache struct {
+	ecsClient api.ECSClient
+	ttl       time.Duration
+	limiter   *rate.Limiter
+	now       func() time.Time
+	stats     CacheStatsRecorder
+
+	lock    sync.Mutex
+	entries map[string]*resourceTagsEntry
+}
+
+type resourceTagsEntry struct {
+	// tags is nil until the tags are retrieved
+	tags            map[string]string
+	retrievedAt     time.Time
+	lastRequestedAt time.Time
+	// err is the error of the last retrieval
+	err error
+	// retrieving is closed when the retrieval in flight is done, and nil when there's none
+	retrieving chan struct{}
+}
+
+// NewResourceTagsCache creates a cache of the tags retrieved with the ECS client.
+func NewResourceTagsCache(ecsClient api.ECSClient, ttl time.Duration) *ResourceTagsCache {
+	return &ResourceTagsCache{
+		ecsClient: ecsClient,
+		ttl:       ttl,
+		limiter:   rate.NewLimiter(tagsRequestsPerSecond, tagsRequestsBurst),
+		now:       time.Now,
+		entries:   make(map[string]*resourceTagsEntry),
+	}
+}
+
+// SetStatsRecorder sets the recorder that the hits and misses of the cache are counted
+// with. Requests served with cached tags or sharing the retrieval of another request are
+// hits, and the other requests are misses. It must be set before the cache is used.
+func (c *ResourceTagsCache) SetStatsRecorder(stats CacheStatsRecorder) {
+	c.stats = stats
+}
+
+// Tags returns the tags of the resource. Concurrent requests for the tags of a resource
+// share a single ECS API call. If the tags can't be retrieved, the error is returned along
+// with the tags retrieved last, which are nil if they never were.
+func (c *ResourceTagsCache) Tags(resourceARN string) (map[string]string, error) {
+	c.lock.Lock()
+	now := c.now()
+	c.pruneUnsafe(now)
+	entry, ok := c.entries[resourceARN]
+	if !ok {
+		entry = &resourceTagsEntry{}
+		c.entries[resourceARN] = entry
+	}
+	entry.lastRequestedAt = now
+	if entry.tags != nil && now.Sub(entry.retrievedAt) < c.ttl {
+		c.lock.Unlock()
+		c.recordHit(true)
+		return entry.tags, nil
+	}
+	if retrieving := entry.retrieving; retrieving != nil {
+		c.lock.Unlock()
+		c.recordHit(true)
+		<-retrieving
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return entry.tags, entry.err
+	}
+
+	c.recordHit(false)
+	maxWait := maxTagsRateLimitWait
+	if entry.tags != nil {
+		maxWait = 0
+	}
+	reservation := c.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > maxWait {
+		reservation.CancelAt(now)
+		entry.err = errTagsRateExceeded
+		c.lock.Unlock()
+		return entry.tags, errTagsRateExceeded
+	}
+	retrieving := make(chan struct{})
+	entry.retrieving = retrieving
+	c.lock.Unlock()
+
+	time.Sleep(delay)
+	tags, err := c.retrieve(resourceARN)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry.err = err
+	if err == nil {
+		entry.tags = tags
+		entry.retrievedAt = c.now()
+	}
+	entry.retrieving = nil
+	close(retrieving)
+	return entry.tags, err
+}
+
+func (c *ResourceTagsCache) recordHit(hit bool) {
+	if c.stats == nil {
+		return
+	}
+	if hit {
+		c.stats.RecordCacheHit()
+	} else {
+		c.stats.RecordCacheMiss()
+	}
+}
+
+func (c *ResourceTagsCache) retrieve(resourceARN string) (map[string]string, error) {
+	ecsTags, err := c.ecsClient.GetResourceTags(resourceARN)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(ecsTags))
+	for _, tag := range ecsTags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
+
+// pruneUnsafe drops the tags of the resources that weren't requested for
+// unusedTagsLifetime.
+func (c *ResourceTagsCache) pruneUnsafe(now time.Time) {
+	for resourceARN, entry := range c.entries {
+		if entry.retrieving == nil && now.Sub(entry.lastRequestedAt) > unusedTagsLifetime {
+			delete(c.entries, resourceARN)
+		}
+	}
+}
+
+// PropagateCachedTagsToMetadata sets the container instance and task tags of the v4 task
+// response from the cache. Tags that can't be retrieved again are served from the cache,
+// and a warning is returned for each of them.
+func PropagateCachedTagsToMetadata(cache *ResourceTagsCache, containerInstanceARN, taskARN string,
+	resp *tmdsv2.TaskResponse) []string {
+	var warnings []string
+	for _, resource := range []struct {
+		field string
+		arn   string
+		tags  *map[string]string
+	}{
+		{"ContainerInstanceTags", containerInstanceARN, &resp.ContainerInstanceTags},
+		{"TaskTags", taskARN, &resp.TaskTags},
+	} {
+		tags, err := cache.Tags(resource.arn)
+		switch {
+		case err == nil:
+			*resource.tags = tags
+		case tags != nil:
+			*resource.tags = tags
+			warning := fmt.Sprintf("%s of %s are stale: unable to retrieve them again: %v",
+				resource.field, resource.arn, err)
+			seelog.Warnf("Task Metadata: %s", warning)
+			warnings = append(warnings, warning)
+		default:
+			metadataErrorHandling(resp, err, resource.field, resource.arn, true)
+		}
+	}
+	return warnings
+}
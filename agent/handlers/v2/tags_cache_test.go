@@ -0,0 +1,197 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v2
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/ecs_client/model/ecs"
+	tmdsv1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+	tmdsv2 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v2"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tagsCacheTestTTL = time.Minute
+
+// newTagsCacheTest returns a tags cache whose clock is advanced by the returned func.
+func newTagsCacheTest(t *testing.T) (*ResourceTagsCache, *mock_api.MockECSClient, func(time.Duration)) {
+	ctrl := gomock.NewController(t)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	cache := NewResourceTagsCache(ecsClient, tagsCacheTestTTL)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	return cache, ecsClient, func(d time.Duration) { now = now.Add(d) }
+}
+
+func ecsTags(key, value string) []*ecs.Tag {
+	return []*ecs.Tag{{Key: aws.String(key), Value: aws.String(value)}}
+}
+
+func TestResourceTagsCacheTTL(t *testing.T) {
+	cache, ecsClient, advance := newTagsCacheTest(t)
+	stats := tmdsv1.NewRuntimeStats()
+	cache.SetStatsRecorder(stats)
+	gomock.InOrder(
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(ecsTags("team", "a"), nil),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(ecsTags("team", "b"), nil),
+	)
+
+	tags, err := cache.Tags(taskARN)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "a"}, tags)
+
+	// Tags are served from the cache until the TTL expires
+	advance(tagsCacheTestTTL - time.Second)
+	tags, err = cache.Tags(taskARN)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "a"}, tags)
+
+	advance(time.Second)
+	tags, err = cache.Tags(taskARN)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "b"}, tags)
+	assert.Equal(t, uint64(1), stats.Snapshot().CacheHits)
+	assert.Equal(t, uint64(2), stats.Snapshot().CacheMisses)
+}
+
+func TestResourceTagsCacheFailureFallback(t *testing.T) {
+	cache, ecsClient, advance := newTagsCacheTest(t)
+	gomock.InOrder(
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(nil, errors.New("unavailable")),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(ecsTags("team", "a"), nil),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(nil, errors.New("throttled")),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(ecsTags("team", "b"), nil),
+	)
+
+	// There are no tags to fall back on before the tags are first retrieved
+	tags, err := cache.Tags(taskARN)
+	assert.EqualError(t, err, "unavailable")
+	assert.Nil(t, tags)
+
+	tags, err = cache.Tags(taskARN)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "a"}, tags)
+
+	// The stale tags are served with the error when they can't be retrieved again
+	advance(tagsCacheTestTTL)
+	tags, err = cache.Tags(taskARN)
+	assert.EqualError(t, err, "throttled")
+	assert.Equal(t, map[string]string{"team": "a"}, tags)
+
+	tags, err = cache.Tags(taskARN)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "b"}, tags)
+}
+
+func TestResourceTagsCacheRateLimit(t *testing.T) {
+	cache, ecsClient, advance := newTagsCacheTest(t)
+	gomock.InOrder(
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(ecsTags("team", "a"), nil),
+		ecsClient.EXPECT().GetResourceTags(containerInstanceArn).Return(ecsTags("ci", "a"), nil),
+	)
+
+	_, err := cache.Tags(taskARN)
+	require.NoError(t, err)
+	advance(tagsCacheTestTTL)
+	require.True(t, cache.limiter.AllowN(cache.now(), tagsRequestsBurst))
+
+	// The stale tags are served without waiting for the rate limiter
+	start := time.Now()
+	tags, err := cache.Tags(taskARN)
+	assert.Equal(t, errTagsRateExceeded, err)
+	assert.Equal(t, map[string]string{"team": "a"}, tags)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// Tags that aren't cached are retrieved once the rate limiter allows it
+	start = time.Now()
+	tags, err = cache.Tags(containerInstanceArn)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ci": "a"}, tags)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second/tagsRequestsPerSecond)
+}
+
+func TestResourceTagsCacheSharesRetrievals(t *testing.T) {
+	cache, ecsClient, _ := newTagsCacheTest(t)
+	release := make(chan struct{})
+	ecsClient.EXPECT().GetResourceTags(taskARN).DoAndReturn(func(string) ([]*ecs.Tag, error) {
+		<-release
+		return ecsTags("team", "a"), nil
+	}).Times(1)
+
+	var wg sync.WaitGroup
+	results := make([]map[string]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cache.Tags(taskARN)
+		}(i)
+	}
+	// Give the requests time to pile up behind the retrieval in flight
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for _, tags := range results {
+		assert.Equal(t, map[string]string{"team": "a"}, tags)
+	}
+}
+
+func TestResourceTagsCachePrunesUnusedTags(t *testing.T) {
+	cache, ecsClient, advance := newTagsCacheTest(t)
+	ecsClient.EXPECT().GetResourceTags(gomock.Any()).Return(ecsTags("team", "a"), nil).Times(2)
+
+	_, err := cache.Tags(taskARN)
+	require.NoError(t, err)
+	advance(unusedTagsLifetime + time.Second)
+	_, err = cache.Tags(containerInstanceArn)
+	require.NoError(t, err)
+
+	assert.NotContains(t, cache.entries, taskARN)
+	assert.Contains(t, cache.entries, containerInstanceArn)
+}
+
+func TestPropagateCachedTagsToMetadata(t *testing.T) {
+	cache, ecsClient, advance := newTagsCacheTest(t)
+	gomock.InOrder(
+		ecsClient.EXPECT().GetResourceTags(containerInstanceArn).Return(ecsTags("ci", "a"), nil),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(ecsTags("task", "a"), nil),
+		ecsClient.EXPECT().GetResourceTags(containerInstanceArn).Return(ecsTags("ci", "b"), nil),
+		ecsClient.EXPECT().GetResourceTags(taskARN).Return(nil, errors.New("throttled")),
+	)
+
+	resp := &tmdsv2.TaskResponse{}
+	warnings := PropagateCachedTagsToMetadata(cache, containerInstanceArn, taskARN, resp)
+	assert.Empty(t, warnings)
+	assert.Equal(t, map[string]string{"ci": "a"}, resp.ContainerInstanceTags)
+	assert.Equal(t, map[string]string{"task": "a"}, resp.TaskTags)
+
+	advance(tagsCacheTestTTL)
+	resp = &tmdsv2.TaskResponse{}
+	warnings = PropagateCachedTagsToMetadata(cache, containerInstanceArn, taskARN, resp)
+	assert.Equal(t, map[string]string{"ci": "b"}, resp.ContainerInstanceTags)
+	assert.Equal(t, map[string]string{"task": "a"}, resp.TaskTags)
+	assert.Empty(t, resp.Errors)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "TaskTags of "+taskARN+" are stale")
+}
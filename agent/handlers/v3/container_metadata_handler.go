@@ -101,7 +101,9 @@ func GetContainerNetworkMetadata(containerID string, state dockerstate.TaskEngin
 	// Instead we only get the details of the first network
 	networks := make([]tmdsresponse.Network, 0)
 	if len(settings.Networks) > 0 {
-		for modeFromSettings, containerNetwork := range settings.Networks {
+		// Networks are sorted by name, since Docker returns them in a map
+		for _, modeFromSettings := range utils.SortedKeys(settings.Networks) {
+			containerNetwork := settings.Networks[modeFromSettings]
 			networkMode := modeFromSettings
 			ipv4Addresses := []string{containerNetwork.IPAddress}
 			network := tmdsresponse.Network{NetworkMode: networkMode, IPv4Addresses: ipv4Addresses}
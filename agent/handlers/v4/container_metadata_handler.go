@@ -16,6 +16,7 @@ package v4
 import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	tmdsresponse "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/response"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
 	tmdsv4 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v4/state"
 
 	"github.com/pkg/errors"
@@ -43,7 +44,9 @@ func GetContainerNetworkMetadata(containerID string, state dockerstate.TaskEngin
 	// Instead we only get the details of the first network
 	networks := make([]tmdsv4.Network, 0)
 	if len(settings.Networks) > 0 {
-		for modeFromSettings, containerNetwork := range settings.Networks {
+		// Networks are sorted by name, since Docker returns them in a map
+		for _, modeFromSettings := range utils.SortedKeys(settings.Networks) {
+			containerNetwork := settings.Networks[modeFromSettings]
 			networkMode := modeFromSettings
 			ipv4Addresses := []string{containerNetwork.IPAddress}
 			network := tmdsv4.Network{Network: tmdsresponse.Network{NetworkMode: networkMode, IPv4Addresses: ipv4Addresses}}
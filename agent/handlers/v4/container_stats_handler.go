@@ -72,10 +72,7 @@ func WriteV4ContainerStatsResponse(w http.ResponseWriter,
 		return
 	}
 
-	containerStatsResponse := StatsResponse{
-		StatsJSON:          dockerStats,
-		Network_rate_stats: network_rate_stats,
-	}
+	containerStatsResponse := newStatsResponse(dockerStats, network_rate_stats)
 
 	responseJSON, err := json.Marshal(containerStatsResponse)
 	if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
@@ -0,0 +1,93 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v4
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	v3 "github.com/aws/amazon-ecs-agent/agent/handlers/v3"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+// ContainerStatusPath specifies the relative URI path for serving container status.
+var ContainerStatusPath = "/v4/" + utils.ConstructMuxVar(v3.V3EndpointIDMuxName, utils.AnythingButSlashRegEx) + "/status"
+
+// ContainerStatusResponse is the schema for the container status response JSON object.
+type ContainerStatusResponse struct {
+	DesiredStatus     string     `json:"DesiredStatus"`
+	KnownStatus       string     `json:"KnownStatus"`
+	TaskDesiredStatus string     `json:"TaskDesiredStatus"`
+	HealthStatus      string     `json:"HealthStatus,omitempty"`
+	StopRequestedAt   *time.Time `json:"StopRequestedAt,omitempty"`
+}
+
+// ContainerStatusHandler returns the handler method for handling container status requests.
+// The response only has the statuses of the container and of its task, for applications to
+// poll whether they are being stopped, so it is built from the state without building the
+// container and task metadata.
+func ContainerStatusHandler(state dockerstate.TaskEngineState) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskARN, err := v3.GetTaskARNByRequest(r, state)
+		if err != nil {
+			writeContainerStatusError(w, fmt.Sprintf("unable to get task arn from request: %s", err.Error()))
+			return
+		}
+		containerID, err := v3.GetContainerIDByRequest(r, state)
+		if err != nil {
+			writeContainerStatusError(w, fmt.Sprintf("unable to get container ID from request: %s", err.Error()))
+			return
+		}
+		task, ok := state.TaskByArn(taskARN)
+		if !ok {
+			writeContainerStatusError(w, "unable to find task "+taskARN)
+			return
+		}
+		dockerContainer, ok := state.ContainerByID(containerID)
+		if !ok {
+			writeContainerStatusError(w, "unable to find container "+containerID)
+			return
+		}
+
+		container := dockerContainer.Container
+		response := ContainerStatusResponse{
+			DesiredStatus:     container.GetDesiredStatus().String(),
+			KnownStatus:       container.GetKnownStatus().String(),
+			TaskDesiredStatus: task.GetDesiredStatus().String(),
+		}
+		if container.HealthStatusShouldBeReported() {
+			response.HealthStatus = container.GetHealthStatus().Status.String()
+		}
+		if stopRequestedAt := task.GetStopRequestedAt(); !stopRequestedAt.IsZero() {
+			stopRequestedAt = stopRequestedAt.UTC()
+			response.StopRequestedAt = &stopRequestedAt
+		}
+		responseJSON, err := json.Marshal(response)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, utils.RequestTypeContainerStatus)
+	}
+}
+
+func writeContainerStatusError(w http.ResponseWriter, message string) {
+	responseJSON, err := json.Marshal("V4 container status handler: " + message)
+	if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+		return
+	}
+	utils.WriteJSONToResponse(w, http.StatusNotFound, responseJSON, utils.RequestTypeContainerStatus)
+}
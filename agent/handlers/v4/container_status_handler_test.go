@@ -0,0 +1,147 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	statusTaskARN      = "arn:aws:ecs:us-west-2:123456789012:task/cluster/status"
+	statusDockerID     = "5ca1ab1e"
+	statusV3EndpointID = "v3-endpoint-id"
+)
+
+// statusTestState returns a state with a task that has a container with a health check,
+// and the task and container to update
+func statusTestState() (dockerstate.TaskEngineState, *apitask.Task, *apicontainer.Container) {
+	container := &apicontainer.Container{
+		Name:                "app",
+		V3EndpointID:        statusV3EndpointID,
+		HealthCheckType:     apicontainer.DockerHealthCheckType,
+		DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+		KnownStatusUnsafe:   apicontainerstatus.ContainerRunning,
+	}
+	container.SetHealthStatus(apicontainer.HealthStatus{Status: apicontainerstatus.ContainerHealthy})
+	task := &apitask.Task{
+		Arn:                 statusTaskARN,
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		KnownStatusUnsafe:   apitaskstatus.TaskRunning,
+		Containers:          []*apicontainer.Container{container},
+	}
+	state := dockerstate.NewTaskEngineState()
+	state.AddTask(task)
+	state.AddContainer(&apicontainer.DockerContainer{DockerID: statusDockerID, Container: container}, task)
+	return state, task, container
+}
+
+func recordContainerStatusRequest(t *testing.T, state dockerstate.TaskEngineState, v3EndpointID string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc(ContainerStatusPath, ContainerStatusHandler(state))
+	req, err := http.NewRequest(http.MethodGet, "/v4/"+v3EndpointID+"/status", nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestContainerStatusHandlerRunning(t *testing.T) {
+	state, _, _ := statusTestState()
+
+	recorder := recordContainerStatusRequest(t, state, statusV3EndpointID)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{
+		"DesiredStatus": "RUNNING",
+		"KnownStatus": "RUNNING",
+		"TaskDesiredStatus": "RUNNING",
+		"HealthStatus": "HEALTHY"
+	}`, recorder.Body.String())
+}
+
+func TestContainerStatusHandlerStopping(t *testing.T) {
+	state, task, _ := statusTestState()
+	before := time.Now().UTC()
+	task.SetDesiredStatus(apitaskstatus.TaskStopped)
+	task.UpdateDesiredStatus()
+
+	recorder := recordContainerStatusRequest(t, state, statusV3EndpointID)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response ContainerStatusResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "STOPPED", response.DesiredStatus)
+	assert.Equal(t, "RUNNING", response.KnownStatus)
+	assert.Equal(t, "STOPPED", response.TaskDesiredStatus)
+	require.NotNil(t, response.StopRequestedAt)
+	assert.False(t, response.StopRequestedAt.Before(before.Truncate(time.Second)))
+	assert.Equal(t, task.GetStopRequestedAt().UTC().Format(time.RFC3339Nano), response.StopRequestedAt.Format(time.RFC3339Nano))
+}
+
+func TestContainerStatusHandlerStopped(t *testing.T) {
+	state, task, container := statusTestState()
+	task.SetDesiredStatus(apitaskstatus.TaskStopped)
+	stopRequestedAt := task.GetStopRequestedAt()
+	container.SetDesiredStatus(apicontainerstatus.ContainerStopped)
+	container.SetKnownStatus(apicontainerstatus.ContainerStopped)
+	container.SetHealthStatus(apicontainer.HealthStatus{Status: apicontainerstatus.ContainerUnhealthy})
+	// The time that the stop was requested is kept once the task has stopped
+	task.SetDesiredStatus(apitaskstatus.TaskStopped)
+	assert.Equal(t, stopRequestedAt, task.GetStopRequestedAt())
+
+	recorder := recordContainerStatusRequest(t, state, statusV3EndpointID)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response ContainerStatusResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, ContainerStatusResponse{
+		DesiredStatus:     "STOPPED",
+		KnownStatus:       "STOPPED",
+		TaskDesiredStatus: "STOPPED",
+		HealthStatus:      "UNHEALTHY",
+		StopRequestedAt:   response.StopRequestedAt,
+	}, response)
+	require.NotNil(t, response.StopRequestedAt)
+	assert.True(t, stopRequestedAt.Equal(*response.StopRequestedAt))
+}
+
+func TestContainerStatusHandlerWithoutHealthCheck(t *testing.T) {
+	state, _, container := statusTestState()
+	container.HealthCheckType = ""
+
+	recorder := recordContainerStatusRequest(t, state, statusV3EndpointID)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "HealthStatus")
+	assert.NotContains(t, recorder.Body.String(), "StopRequestedAt")
+}
+
+func TestContainerStatusHandlerUnknownEndpointID(t *testing.T) {
+	state, _, _ := statusTestState()
+
+	recorder := recordContainerStatusRequest(t, state, "unknown")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -28,7 +28,8 @@ import (
 )
 
 // NewTaskResponse creates a new v4 response object for the task. It augments v2 task response
-// with additional network interface fields.
+// with additional network interface fields. Tags are served from the tags cache if there's
+// one, and retrieved from ECS otherwise.
 func NewTaskResponse(
 	taskARN string,
 	state dockerstate.TaskEngineState,
@@ -39,13 +40,23 @@ func NewTaskResponse(
 	containerInstanceARN string,
 	serviceName string,
 	propagateTags bool,
+	tagsCache *v2.ResourceTagsCache,
 ) (*tmdsv4.TaskResponse, error) {
+	task, ok := state.TaskByArn(taskARN)
+	if !ok {
+		return nil, errors.Errorf("v2 task response: unable to find task '%s'", taskARN)
+	}
 	// Construct the v2 response first.
-	v2Resp, err := v2.NewTaskResponse(taskARN, state, ecsClient, cluster, az,
-		containerInstanceARN, propagateTags, true)
+	v2Resp, err := v2.NewTaskResponseFromTask(task, state, ecsClient, cluster, az,
+		containerInstanceARN, propagateTags && tagsCache == nil, true)
 	if err != nil {
 		return nil, err
 	}
+	warnings := task.GetWarnings()
+	if propagateTags && tagsCache != nil {
+		warnings = append(warnings,
+			v2.PropagateCachedTagsToMetadata(tagsCache, containerInstanceARN, taskARN, v2Resp)...)
+	}
 	var containers []tmdsv4.ContainerResponse
 	// Convert each container response into v4 container response.
 	for i, container := range v2Resp.Containers {
@@ -55,31 +66,63 @@ func NewTaskResponse(
 		if err != nil {
 			return nil, err
 		}
+		var imagePullMechanism, outputCaptureFile string
+		if taskContainer, ok := task.ContainerByName(container.Name); ok {
+			imagePullMechanism = taskContainer.GetImagePullMechanism()
+			outputCaptureFile = taskContainer.GetOutputCaptureFile()
+		}
 		containers = append(containers, tmdsv4.ContainerResponse{
-			ContainerResponse: &v2Resp.Containers[i],
-			Networks:          networks,
+			ContainerResponse:  &v2Resp.Containers[i],
+			Networks:           networks,
+			ImagePullMechanism: imagePullMechanism,
+			OutputCaptureFile:  outputCaptureFile,
 		})
 	}
 
 	return &tmdsv4.TaskResponse{
-		TaskResponse: v2Resp,
-		Containers:   containers,
-		VPCID:        vpcID,
-		ServiceName:  serviceName,
+		TaskResponse:   v2Resp,
+		Containers:     containers,
+		VPCID:          vpcID,
+		ServiceName:    serviceName,
+		CredentialSpec: newCredentialSpecStatus(task),
+		Warnings:       warnings,
 	}, nil
 }
 
+// newCredentialSpecStatus returns the credential spec status of the task, or nil if the
+// task doesn't use credential specs.
+func newCredentialSpecStatus(task *apitask.Task) *tmdsv4.CredentialSpecStatus {
+	lifecycle := task.GetCredentialSpecLifecycleStatus()
+	if lifecycle == nil || lifecycle.State == "" {
+		return nil
+	}
+	return &tmdsv4.CredentialSpecStatus{
+		State:          lifecycle.State,
+		Reason:         lifecycle.Reason,
+		Locations:      lifecycle.Locations,
+		UpdatedAt:      lifecycle.UpdatedAt,
+		RenewalWarning: lifecycle.RenewalWarning,
+	}
+}
+
 // NewContainerResponse creates a new v4 container response based on container id.  It augments
 // v4 container response with additional network interface fields.
 func NewContainerResponse(
 	containerID string,
 	state dockerstate.TaskEngineState,
 ) (*tmdsv4.ContainerResponse, error) {
-	// Construct the v2 response first.
-	container, err := v2.NewContainerResponseFromState(containerID, state, true)
-	if err != nil {
-		return nil, err
+	dockerContainer, ok := state.ContainerByID(containerID)
+	if !ok {
+		return nil, errors.Errorf(
+			"v4 container response: unable to find container '%s'", containerID)
+	}
+	task, ok := state.TaskByID(containerID)
+	if !ok {
+		return nil, errors.Errorf(
+			"v4 container response: unable to find task for container '%s'", containerID)
 	}
+	// Construct the v2 response first.
+	container := v2.NewContainerResponse(dockerContainer, task.GetPrimaryENI(), true)
 	// Convert v2 network responses into v4 network responses.
 	networks, err := toV4NetworkResponse(container.Networks, func() (*apitask.Task, bool) {
 		return state.TaskByID(containerID)
@@ -88,8 +131,10 @@ func NewContainerResponse(
 		return nil, err
 	}
 	return &tmdsv4.ContainerResponse{
-		ContainerResponse: container,
-		Networks:          networks,
+		ContainerResponse:  &container,
+		Networks:           networks,
+		ImagePullMechanism: dockerContainer.Container.GetImagePullMechanism(),
+		OutputCaptureFile:  dockerContainer.Container.GetOutputCaptureFile(),
 	}, nil
 }
 
@@ -155,6 +200,8 @@ func NewPulledContainerResponse(
 ) tmdsv4.ContainerResponse {
 	resp := v2.NewContainerResponse(dockerContainer, eni, true)
 	return tmdsv4.ContainerResponse{
-		ContainerResponse: &resp,
+		ContainerResponse:  &resp,
+		ImagePullMechanism: dockerContainer.Container.GetImagePullMechanism(),
+		OutputCaptureFile:  dockerContainer.Container.GetOutputCaptureFile(),
 	}
 }
@@ -27,9 +27,13 @@ import (
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	mock_dockerstate "github.com/aws/amazon-ecs-agent/agent/engine/dockerstate/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource/credentialspec"
 	apieni "github.com/aws/amazon-ecs-agent/ecs-agent/api/eni"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -58,6 +62,7 @@ const (
 	availabilityZone         = "us-west-2b"
 	vpcID                    = "test-vpc-id"
 	containerInstanceArn     = "containerInstance-test"
+	outputCaptureFile        = "/var/lib/ecs/data/output/t1/sleepy/output.log"
 )
 
 func TestNewTaskContainerResponses(t *testing.T) {
@@ -124,6 +129,9 @@ func TestNewTaskContainerResponses(t *testing.T) {
 		"foo": "bar",
 	}
 	container.SetLabels(labels)
+	container.SetImagePullMechanism(apicontainer.ImagePullMechanismLazy)
+	container.SetOutputCaptureFile(outputCaptureFile)
+	task.Containers = []*apicontainer.Container{container}
 	dockerContainer := &apicontainer.DockerContainer{
 		DockerID:   containerID,
 		DockerName: containerName,
@@ -139,7 +147,7 @@ func TestNewTaskContainerResponses(t *testing.T) {
 	)
 
 	taskResponse, err := NewTaskResponse(taskARN, state, ecsClient, cluster,
-		availabilityZone, vpcID, containerInstanceArn, task.ServiceName, false)
+		availabilityZone, vpcID, containerInstanceArn, task.ServiceName, false, nil)
 	require.NoError(t, err)
 	_, err = json.Marshal(taskResponse)
 	require.NoError(t, err)
@@ -149,6 +157,8 @@ func TestNewTaskContainerResponses(t *testing.T) {
 	assert.Equal(t, ipv6SubnetCIDRBlock, taskResponse.Containers[0].Networks[0].IPv6SubnetCIDRBlock)
 	assert.Equal(t, subnetGatewayIPV4Address, taskResponse.Containers[0].Networks[0].SubnetGatewayIPV4Address)
 	assert.Equal(t, serviceName, taskResponse.ServiceName)
+	assert.Equal(t, apicontainer.ImagePullMechanismLazy, taskResponse.Containers[0].ImagePullMechanism)
+	assert.Equal(t, outputCaptureFile, taskResponse.Containers[0].OutputCaptureFile)
 
 	gomock.InOrder(
 		state.EXPECT().ContainerByID(containerID).Return(dockerContainer, true),
@@ -161,4 +171,67 @@ func TestNewTaskContainerResponses(t *testing.T) {
 	assert.Equal(t, created.UTC().String(), containerResponse.CreatedAt.String())
 	assert.Equal(t, "192.168.0.0/24", containerResponse.Networks[0].IPV4SubnetCIDRBlock)
 	assert.Equal(t, subnetGatewayIPV4Address, containerResponse.Networks[0].SubnetGatewayIPV4Address)
+	assert.Equal(t, apicontainer.ImagePullMechanismLazy, containerResponse.ImagePullMechanism)
+	assert.Equal(t, outputCaptureFile, containerResponse.OutputCaptureFile)
+}
+
+func TestNewCredentialSpecStatus(t *testing.T) {
+	task := &apitask.Task{
+		Arn:                taskARN,
+		ResourcesMapUnsafe: make(map[string][]taskresource.TaskResource),
+	}
+	assert.Nil(t, newCredentialSpecStatus(task))
+
+	credSpec := "credentialspec:arn:aws:ssm:us-west-2:123456789012:parameter/spec"
+	credentialspecResource, err := credentialspec.NewCredentialSpecResource(taskARN, "us-west-2", "",
+		credentials.NewManager(), nil, nil, nil, map[string]string{credSpec: containerName})
+	require.NoError(t, err)
+	task.AddResource(credentialspec.ResourceName, credentialspecResource)
+	// Not reported until the resource starts fetching the credential specs
+	assert.Nil(t, newCredentialSpecStatus(task))
+
+	credentialspecResource.MarkRenewalScheduled()
+	status := newCredentialSpecStatus(task)
+	require.NotNil(t, status)
+	assert.Equal(t, credentialspec.LifecycleRenewalScheduled, status.State)
+	assert.Equal(t, []string{"arn:aws:ssm:us-west-2:123456789012:parameter/spec"}, status.Locations)
+	assert.NotNil(t, status.UpdatedAt)
+	assert.False(t, status.RenewalWarning)
+}
+
+// TestGetContainerNetworkMetadataIsSorted tests that the networks of containers, which Docker
+// returns in a map, are sorted by name.
+func TestGetContainerNetworkMetadataIsSorted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+	container := &apicontainer.Container{Name: containerName}
+	container.SetNetworkSettings(&types.NetworkSettings{
+		Networks: map[string]*network.EndpointSettings{
+			"overlay": {IPAddress: "10.0.0.3"},
+			"bridge":  {IPAddress: "172.17.0.2"},
+			"custom":  {IPAddress: "192.168.1.2"},
+		},
+	})
+	state.EXPECT().ContainerByID(containerID).Return(&apicontainer.DockerContainer{
+		DockerID:  containerID,
+		Container: container,
+	}, true).AnyTimes()
+
+	expected, err := GetContainerNetworkMetadata(containerID, state)
+	require.NoError(t, err)
+	require.Len(t, expected, 3)
+	assert.Equal(t, "bridge", expected[0].NetworkMode)
+	assert.Equal(t, "custom", expected[1].NetworkMode)
+	assert.Equal(t, "overlay", expected[2].NetworkMode)
+	expectedJSON, err := json.Marshal(expected)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		networks, err := GetContainerNetworkMetadata(containerID, state)
+		require.NoError(t, err)
+		networksJSON, err := json.Marshal(networks)
+		require.NoError(t, err)
+		require.Equal(t, string(expectedJSON), string(networksJSON))
+	}
 }
@@ -21,11 +21,63 @@ import (
 	"github.com/pkg/errors"
 )
 
+// MaxPerCPUUsageEntries is the number of CPUs up to which the per-CPU usage of the docker
+// stats is passed through as is. The per-CPU usage of hosts with more CPUs is only
+// summarized, so that the responses of hosts with hundreds of CPUs stay small.
+const MaxPerCPUUsageEntries = 64
+
 // StatsResponse is the v4 Stats response. It augments the v4 Stats response
 // with the docker stats.
 type StatsResponse struct {
 	*types.StatsJSON
 	Network_rate_stats *stats.NetworkStatsPerSec `json:"network_rate_stats,omitempty"`
+	PerCPUUsageSummary *PerCPUUsageSummary       `json:"percpu_usage_summary,omitempty"`
+}
+
+// PerCPUUsageSummary summarizes the per-CPU usage of the docker stats with the count of
+// CPUs and the usage of the CPUs that were used.
+type PerCPUUsageSummary struct {
+	CPUCount int           `json:"cpu_count"`
+	NonZero  []PerCPUUsage `json:"nonzero_usage"`
+}
+
+// PerCPUUsage is the CPU time consumed on one CPU, in nanoseconds.
+type PerCPUUsage struct {
+	CPU   int    `json:"cpu"`
+	Usage uint64 `json:"usage"`
+}
+
+// newStatsResponse creates the v4 stats response for the docker stats. The per-CPU usage
+// is summarized if the docker stats have it, and is dropped from the docker stats of
+// hosts with more than MaxPerCPUUsageEntries CPUs. The docker stats aren't modified, as
+// they are shared with the stats engine.
+func newStatsResponse(dockerStats *types.StatsJSON, networkRateStats *stats.NetworkStatsPerSec) StatsResponse {
+	response := StatsResponse{
+		StatsJSON:          dockerStats,
+		Network_rate_stats: networkRateStats,
+	}
+	if dockerStats == nil {
+		return response
+	}
+	perCPUUsage := dockerStats.CPUStats.CPUUsage.PercpuUsage
+	if len(perCPUUsage) == 0 {
+		// The per-CPU usage isn't available with cgroup v2
+		return response
+	}
+	summary := &PerCPUUsageSummary{CPUCount: len(perCPUUsage), NonZero: []PerCPUUsage{}}
+	for cpu, usage := range perCPUUsage {
+		if usage != 0 {
+			summary.NonZero = append(summary.NonZero, PerCPUUsage{CPU: cpu, Usage: usage})
+		}
+	}
+	response.PerCPUUsageSummary = summary
+	if len(perCPUUsage) > MaxPerCPUUsageEntries {
+		capped := *dockerStats
+		capped.CPUStats.CPUUsage.PercpuUsage = nil
+		capped.PreCPUStats.CPUUsage.PercpuUsage = nil
+		response.StatsJSON = &capped
+	}
+	return response
 }
 
 // NewV4TaskStatsResponse returns a new v4 task stats response object
@@ -51,12 +103,7 @@ func NewV4TaskStatsResponse(taskARN string,
 			continue
 		}
 
-		statsResponse := StatsResponse{
-			StatsJSON:          dockerStats,
-			Network_rate_stats: network_rate_stats,
-		}
-
-		resp[containerID] = statsResponse
+		resp[containerID] = newStatsResponse(dockerStats, network_rate_stats)
 	}
 
 	return resp, nil
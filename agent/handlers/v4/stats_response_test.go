@@ -0,0 +1,123 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v4
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syntheticDockerStats returns docker stats of a host with the given number of CPUs,
+// with usage on the given CPUs only.
+func syntheticDockerStats(cpuCount int, usedCPUs ...int) *types.StatsJSON {
+	read, _ := time.Parse(time.RFC3339, "2023-05-01T10:00:10Z")
+	perCPUUsage := make([]uint64, cpuCount)
+	prePerCPUUsage := make([]uint64, cpuCount)
+	var totalUsage uint64
+	for _, cpu := range usedCPUs {
+		perCPUUsage[cpu] = uint64(cpu+1) * 1000
+		prePerCPUUsage[cpu] = uint64(cpu+1) * 500
+		totalUsage += perCPUUsage[cpu]
+	}
+	dockerStats := &types.StatsJSON{Name: "/sleepy", ID: containerID}
+	dockerStats.Read = read
+	dockerStats.PreRead = read.Add(-time.Second)
+	dockerStats.CPUStats = types.CPUStats{
+		CPUUsage: types.CPUUsage{
+			TotalUsage:        totalUsage,
+			PercpuUsage:       perCPUUsage,
+			UsageInKernelmode: totalUsage / 4,
+			UsageInUsermode:   totalUsage / 2,
+		},
+		SystemUsage: 1000000,
+		OnlineCPUs:  uint32(cpuCount),
+		ThrottlingData: types.ThrottlingData{
+			Periods:          100,
+			ThrottledPeriods: 7,
+			ThrottledTime:    35000000,
+		},
+	}
+	dockerStats.PreCPUStats = types.CPUStats{
+		CPUUsage: types.CPUUsage{
+			TotalUsage:  totalUsage / 2,
+			PercpuUsage: prePerCPUUsage,
+		},
+		SystemUsage: 500000,
+		OnlineCPUs:  uint32(cpuCount),
+		ThrottlingData: types.ThrottlingData{
+			Periods:          90,
+			ThrottledPeriods: 6,
+			ThrottledTime:    30000000,
+		},
+	}
+	return dockerStats
+}
+
+// TestStatsResponseGolden locks the CPU stats of the v4 stats response, including the
+// throttling counters and the per-CPU usage, for a small host and a host with more than
+// MaxPerCPUUsageEntries CPUs, by comparing the responses with the golden files in testdata.
+func TestStatsResponseGolden(t *testing.T) {
+	testCases := []struct {
+		golden      string
+		dockerStats *types.StatsJSON
+	}{
+		{
+			golden:      "stats_response_4_cpus.json",
+			dockerStats: syntheticDockerStats(4, 0, 2, 3),
+		},
+		{
+			golden:      "stats_response_192_cpus.json",
+			dockerStats: syntheticDockerStats(192, 0, 1, 95, 191),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			networkRateStats := &stats.NetworkStatsPerSec{RxBytesPerSecond: 10, TxBytesPerSecond: 20}
+			statsResponse := newStatsResponse(tc.dockerStats, networkRateStats)
+			statsResponseJSON, err := json.MarshalIndent(statsResponse, "", "  ")
+			require.NoError(t, err)
+			golden, err := os.ReadFile(filepath.Join("testdata", tc.golden))
+			require.NoError(t, err)
+			assert.Equal(t, string(golden), string(statsResponseJSON)+"\n")
+		})
+	}
+}
+
+// TestStatsResponseKeepsDockerStats tests that capping the per-CPU usage of the response
+// doesn't modify the docker stats shared with the stats engine.
+func TestStatsResponseKeepsDockerStats(t *testing.T) {
+	dockerStats := syntheticDockerStats(MaxPerCPUUsageEntries+1, 0)
+	statsResponse := newStatsResponse(dockerStats, nil)
+	assert.Nil(t, statsResponse.CPUStats.CPUUsage.PercpuUsage)
+	assert.Len(t, dockerStats.CPUStats.CPUUsage.PercpuUsage, MaxPerCPUUsageEntries+1)
+	assert.Len(t, dockerStats.PreCPUStats.CPUUsage.PercpuUsage, MaxPerCPUUsageEntries+1)
+	assert.Equal(t, &PerCPUUsageSummary{CPUCount: MaxPerCPUUsageEntries + 1,
+		NonZero: []PerCPUUsage{{CPU: 0, Usage: 1000}}}, statsResponse.PerCPUUsageSummary)
+
+	// Without per-CPU usage, as with cgroup v2, there's nothing to summarize
+	dockerStats.CPUStats.CPUUsage.PercpuUsage = nil
+	assert.Nil(t, newStatsResponse(dockerStats, nil).PerCPUUsageSummary)
+	assert.Nil(t, newStatsResponse(nil, nil).StatsJSON)
+}
@@ -17,8 +17,10 @@ import (
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	v2 "github.com/aws/amazon-ecs-agent/agent/handlers/v2"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
 	tmdsv4 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v4/state"
 )
 
@@ -30,6 +32,7 @@ type TMDSAgentState struct {
 	availabilityZone     string
 	vpcID                string
 	containerInstanceARN string
+	tagsCache            *v2.ResourceTagsCache
 }
 
 func NewTMDSAgentState(
@@ -39,6 +42,7 @@ func NewTMDSAgentState(
 	availabilityZone string,
 	vpcID string,
 	containerInstanceARN string,
+	tagsCache *v2.ResourceTagsCache,
 ) *TMDSAgentState {
 	return &TMDSAgentState{
 		state:                state,
@@ -47,6 +51,7 @@ func NewTMDSAgentState(
 		availabilityZone:     availabilityZone,
 		vpcID:                vpcID,
 		containerInstanceARN: containerInstanceARN,
+		tagsCache:            tagsCache,
 	}
 }
 
@@ -92,6 +97,17 @@ func (s *TMDSAgentState) GetTaskMetadataWithTags(v3EndpointID string) (tmdsv4.Ta
 	return s.getTaskMetadata(v3EndpointID, true)
 }
 
+// Returns the ARN of the task identified by the provided endpointContainerID.
+func (s *TMDSAgentState) GetTaskARN(v3EndpointID string) (string, error) {
+	taskARN, ok := s.state.TaskARNByV3EndpointID(v3EndpointID)
+	if !ok {
+		return "", tmdsv4.NewErrorLookupFailure(fmt.Sprintf(
+			"unable to get task arn from request: unable to get task Arn from v3 endpoint ID: %s",
+			v3EndpointID))
+	}
+	return taskARN, nil
+}
+
 // Returns task metadata in v4 format for the task identified by the provided endpointContainerID.
 func (s *TMDSAgentState) getTaskMetadata(v3EndpointID string, includeTags bool) (tmdsv4.TaskResponse, error) {
 	taskARN, ok := s.state.TaskARNByV3EndpointID(v3EndpointID)
@@ -109,7 +125,7 @@ func (s *TMDSAgentState) getTaskMetadata(v3EndpointID string, includeTags bool)
 	}
 
 	taskResponse, err := NewTaskResponse(taskARN, s.state, s.ecsClient, s.cluster,
-		s.availabilityZone, s.vpcID, s.containerInstanceARN, task.ServiceName, includeTags)
+		s.availabilityZone, s.vpcID, s.containerInstanceARN, task.ServiceName, includeTags, s.tagsCache)
 	if err != nil {
 		logger.Error("Failed to get task metadata", logger.Fields{
 			field.TaskARN: taskARN,
@@ -139,10 +155,11 @@ func (s *TMDSAgentState) getTaskMetadata(v3EndpointID string, includeTags bool)
 
 	pulledContainers, _ := s.state.PulledContainerMapByArn(task.Arn)
 	// Convert each pulled container into v4 container response
-	// and append pulled containers to taskResponse.Containers
-	for _, dockerContainer := range pulledContainers {
+	// and append pulled containers to taskResponse.Containers.
+	// Pulled containers weren't created yet, so they are sorted by name.
+	for _, name := range utils.SortedKeys(pulledContainers) {
 		taskResponse.Containers = append(taskResponse.Containers,
-			NewPulledContainerResponse(dockerContainer, task.GetPrimaryENI()))
+			NewPulledContainerResponse(pulledContainers[name], task.GetPrimaryENI()))
 	}
 
 	return *taskResponse, nil
@@ -16,6 +16,7 @@ package audit
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
@@ -32,32 +33,85 @@ type auditLog struct {
 	cluster              string
 	logger               InfoLogger
 	cfg                  *config.Config
+	bodyScrubber         auditinterface.BodyScrubber
+	// dedup suppresses duplicate success entries, if the dedup window is configured
+	dedup *dedupWindow
 }
 
-func NewAuditLog(containerInstanceArn string, cfg *config.Config, logger InfoLogger) auditinterface.AuditLogger {
-	return &auditLog{
+// AuditLogOpt is a function type for updating the audit log.
+type AuditLogOpt func(*auditLog)
+
+// WithBodyScrubber sets the scrubber that removes secrets from the request bodies that are
+// logged. Bodies are scrubbed with auditinterface.DefaultBodyScrubber if the scrubber
+// is not set or nil.
+func WithBodyScrubber(scrubber auditinterface.BodyScrubber) AuditLogOpt {
+	return func(a *auditLog) {
+		a.bodyScrubber = scrubber
+	}
+}
+
+func NewAuditLog(containerInstanceArn string, cfg *config.Config, logger InfoLogger,
+	options ...AuditLogOpt) auditinterface.AuditLogger {
+	a := &auditLog{
 		cluster:              cfg.Cluster,
 		containerInstanceArn: containerInstanceArn,
 		logger:               logger,
 		cfg:                  cfg,
+		bodyScrubber:         auditinterface.DefaultBodyScrubber(),
+	}
+	if cfg.CredentialsAuditLogDedupWindow > 0 {
+		a.dedup = newDedupWindow(cfg.CredentialsAuditLogDedupWindow)
+	}
+	for _, opt := range options {
+		opt(a)
 	}
+	return a
 }
 
 // Log will construct an audit log entry log and log that entry to the audit log
 // using the underlying logger (which implements the audit.InfoLogger interface).
+// Duplicate success entries are suppressed if the dedup window is configured.
 func (a *auditLog) Log(r request.LogRequest, httpResponseCode int, eventType string) {
 	if !a.cfg.CredentialsAuditLogDisabled {
-		auditLogEntry := constructAuditLogEntry(r, httpResponseCode, eventType, a.GetCluster(),
-			a.GetContainerInstanceArn())
+		suppressed := 0
+		if a.dedup != nil {
+			var ok bool
+			var flushed []flushedEntry
+			ok, suppressed, flushed = a.dedup.admit(r, httpResponseCode, eventType)
+			for _, entry := range flushed {
+				a.log(entry.request, entry.httpResponseCode, entry.eventType, entry.eventTime, entry.suppressed)
+			}
+			if !ok {
+				return
+			}
+		}
+		a.log(r, httpResponseCode, eventType, time.Now(), suppressed)
+	}
+}
 
-		a.logger.Info(auditLogEntry)
+// log logs the entry of a request that happened at the event time, after the number of
+// duplicate entries that were suppressed.
+func (a *auditLog) log(r request.LogRequest, httpResponseCode int, eventType string, eventTime time.Time,
+	suppressed int) {
+	auditLogEntry := constructAuditLogEntry(r, httpResponseCode, eventType, a.GetCluster(),
+		a.GetContainerInstanceArn(), eventTime)
+	if len(r.Body) > 0 {
+		auditLogEntry += " " + constructAuditLogBodyField(r.Body, a.bodyScrubber)
 	}
+	if traceFields := constructAuditLogTraceFields(r); traceFields != "" {
+		auditLogEntry += " " + traceFields
+	}
+	if suppressed > 0 {
+		auditLogEntry += fmt.Sprintf(" suppressed=%d", suppressed)
+	}
+
+	a.logger.Info(auditLogEntry)
 }
 
 func constructAuditLogEntry(r request.LogRequest, httpResponseCode int, eventType string,
-	cluster string, containerInstanceArn string) string {
-	commonAuditLogFields := constructCommonAuditLogEntryFields(r, httpResponseCode)
-	auditLogTypeFields := constructAuditLogEntryByType(eventType, cluster, containerInstanceArn)
+	cluster string, containerInstanceArn string, eventTime time.Time) string {
+	commonAuditLogFields := constructCommonAuditLogEntryFields(r, httpResponseCode, eventTime)
+	auditLogTypeFields := constructAuditLogEntryByType(eventType, cluster, containerInstanceArn, r.APIVersion)
 
 	return fmt.Sprintf("%s %s", commonAuditLogFields, auditLogTypeFields)
 }
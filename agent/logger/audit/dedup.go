@@ -0,0 +1,148 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
+)
+
+// dedupHeartbeatInterval is how often an entry is logged for an ARN whose duplicate
+// entries are suppressed, so that its activity remains visible in the audit log.
+const dedupHeartbeatInterval = 5 * time.Minute
+
+// dedupKey identifies the entries that are duplicates of each other.
+type dedupKey struct {
+	arn       string
+	eventType string
+}
+
+// dedupEntry is the state of the entries of a dedupKey.
+type dedupEntry struct {
+	// lastSeen is when the last entry was logged or suppressed, and lastLogged when the
+	// last entry was logged
+	lastSeen   time.Time
+	lastLogged time.Time
+	// suppressed is the number of entries that were suppressed since the last entry was
+	// logged, and last is the last of them
+	suppressed int
+	last       suppressedEntry
+}
+
+// suppressedEntry is an entry that was suppressed by the dedup window.
+type suppressedEntry struct {
+	request          request.LogRequest
+	httpResponseCode int
+	eventType        string
+	eventTime        time.Time
+}
+
+// flushedEntry is the last entry that was suppressed for a key whose state is removed,
+// which is logged with the number of entries that were suppressed before it, so that
+// the suppressed entries are accounted for in the audit log.
+type flushedEntry struct {
+	suppressedEntry
+	suppressed int
+}
+
+// dedupWindow suppresses the duplicate success entries of an ARN, that is the entries with
+// the same ARN and event type that are logged within the window of each other, such as the
+// entries of clients polling for credentials. While entries are suppressed, an entry is
+// still logged every heartbeat interval, with the number of entries that were suppressed
+// since the last entry was logged. When the state of an ARN is removed while entries are
+// suppressed, the last suppressed entry is flushed. Error entries are never suppressed.
+type dedupWindow struct {
+	window    time.Duration
+	heartbeat time.Duration
+	now       func() time.Time
+
+	lock sync.Mutex
+	// entries are the states of the entries by key, and lastSweep is when the states of the
+	// keys without entries in the window were last removed
+	entries   map[dedupKey]*dedupEntry
+	lastSweep time.Time
+}
+
+func newDedupWindow(window time.Duration) *dedupWindow {
+	return &dedupWindow{
+		window:    window,
+		heartbeat: dedupHeartbeatInterval,
+		now:       time.Now,
+		entries:   make(map[dedupKey]*dedupEntry),
+	}
+}
+
+// admit returns true if the entry is to be logged, along with the number of duplicate
+// entries that were suppressed since the last entry of its ARN was logged, and the entries
+// that are flushed, which are to be logged first.
+func (d *dedupWindow) admit(r request.LogRequest, httpResponseCode int, eventType string) (bool, int, []flushedEntry) {
+	if r.ARN == "" || httpResponseCode < http.StatusOK || httpResponseCode >= http.StatusMultipleChoices {
+		return true, 0, nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := d.now()
+	flushed := d.sweep(now)
+
+	key := dedupKey{arn: r.ARN, eventType: eventType}
+	entry, ok := d.entries[key]
+	if !ok {
+		d.entries[key] = &dedupEntry{lastSeen: now, lastLogged: now}
+		return true, 0, flushed
+	}
+	inWindow := now.Sub(entry.lastSeen) < d.window
+	entry.lastSeen = now
+	if inWindow && now.Sub(entry.lastLogged) < d.heartbeat {
+		entry.suppressed++
+		entry.last = suppressedEntry{
+			request:          r,
+			httpResponseCode: httpResponseCode,
+			eventType:        eventType,
+			eventTime:        now,
+		}
+		return false, 0, flushed
+	}
+	suppressed := entry.suppressed
+	entry.lastLogged = now
+	entry.suppressed = 0
+	entry.last = suppressedEntry{}
+	return true, suppressed, flushed
+}
+
+// sweep removes the states of the keys without entries in the window, at most once per
+// heartbeat interval, so that the states of the ARNs of stopped tasks aren't held. The
+// last suppressed entries of the keys that are removed are returned to be flushed.
+func (d *dedupWindow) sweep(now time.Time) []flushedEntry {
+	if now.Sub(d.lastSweep) < d.heartbeat {
+		return nil
+	}
+	d.lastSweep = now
+	var flushed []flushedEntry
+	for key, entry := range d.entries {
+		if now.Sub(entry.lastSeen) < d.window {
+			continue
+		}
+		if entry.suppressed > 0 {
+			flushed = append(flushed, flushedEntry{
+				suppressedEntry: entry.last,
+				suppressed:      entry.suppressed - 1,
+			})
+		}
+		delete(d.entries, key)
+	}
+	return flushed
+}
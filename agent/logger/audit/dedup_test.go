@@ -0,0 +1,163 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	auditinterface "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingInfoLogger records the entries that are logged.
+type recordingInfoLogger struct {
+	entries []string
+}
+
+func (l *recordingInfoLogger) Info(i ...interface{}) {
+	l.entries = append(l.entries, i[0].(string))
+}
+
+// newDedupTestAuditLog returns an audit log whose dedup window is the window, and whose
+// clock is the returned time.
+func newDedupTestAuditLog(t *testing.T, window time.Duration) (*auditLog, *recordingInfoLogger, *time.Time) {
+	logger := &recordingInfoLogger{}
+	cfg := &config.Config{Cluster: dummyCluster, CredentialsAuditLogDedupWindow: window}
+	a, ok := NewAuditLog(dummyContainerInstanceArn, cfg, logger).(*auditLog)
+	require.True(t, ok)
+	require.NotNil(t, a.dedup)
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	a.dedup.now = func() time.Time { return now }
+	return a, logger, &now
+}
+
+func logDedupTestEntry(t *testing.T, a *auditLog, arn string, httpResponseCode int) {
+	req, err := http.NewRequest("GET", dummyURL, nil)
+	require.NoError(t, err)
+	req.RemoteAddr = dummyRemoteAddress
+	a.Log(request.LogRequest{Request: req, ARN: arn, APIVersion: "v2"}, httpResponseCode,
+		auditinterface.GetCredentialsEventType)
+}
+
+func TestAuditLogDedupSuppressesDuplicatesWithinWindow(t *testing.T) {
+	a, logger, now := newDedupTestAuditLog(t, 30*time.Second)
+	start := *now
+
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	require.Len(t, logger.entries, 1)
+	assert.NotContains(t, logger.entries[0], "suppressed=")
+
+	// Duplicates within the window of the last entry are suppressed
+	*now = start.Add(10 * time.Second)
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	*now = start.Add(20 * time.Second)
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	assert.Len(t, logger.entries, 1)
+
+	// Errors are never suppressed
+	logDedupTestEntry(t, a, taskARN, http.StatusNotFound)
+	logDedupTestEntry(t, a, taskARN, http.StatusNotFound)
+	require.Len(t, logger.entries, 3)
+	assert.True(t, strings.HasPrefix(strings.SplitN(logger.entries[1], " ", 3)[1], "404"))
+
+	// Entries of other ARNs aren't duplicates
+	logDedupTestEntry(t, a, "task-arn-2", http.StatusOK)
+	require.Len(t, logger.entries, 4)
+	assert.Contains(t, logger.entries[3], "task-arn-2")
+
+	// Once the window elapses, the next entry is logged with the count of the suppressed ones
+	*now = start.Add(50 * time.Second)
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	require.Len(t, logger.entries, 5)
+	assert.True(t, strings.HasSuffix(logger.entries[4], " suppressed=2"), logger.entries[4])
+}
+
+func TestAuditLogDedupEmitsHeartbeat(t *testing.T) {
+	a, logger, now := newDedupTestAuditLog(t, 30*time.Second)
+	start := *now
+
+	// A client polling every 10 seconds is always within the window, so only the heartbeat
+	// entries are logged
+	for elapsed := time.Duration(0); elapsed <= 2*dedupHeartbeatInterval; elapsed += 10 * time.Second {
+		*now = start.Add(elapsed)
+		logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	}
+	require.Len(t, logger.entries, 3)
+	assert.NotContains(t, logger.entries[0], "suppressed=")
+	pollsPerHeartbeat := int(dedupHeartbeatInterval / (10 * time.Second))
+	for _, entry := range logger.entries[1:] {
+		assert.Contains(t, entry, taskARN)
+		assert.True(t, strings.HasSuffix(entry, " suppressed="+strconv.Itoa(pollsPerHeartbeat-1)), entry)
+	}
+}
+
+func TestAuditLogDedupSweepsStaleARNs(t *testing.T) {
+	a, logger, now := newDedupTestAuditLog(t, 30*time.Second)
+	start := *now
+
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	logDedupTestEntry(t, a, "task-arn-2", http.StatusOK)
+	assert.Len(t, a.dedup.entries, 2)
+
+	*now = start.Add(dedupHeartbeatInterval)
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	assert.Len(t, logger.entries, 3)
+	assert.Len(t, a.dedup.entries, 1)
+}
+
+func TestAuditLogDedupFlushesSuppressedEntriesOfStaleARNs(t *testing.T) {
+	a, logger, now := newDedupTestAuditLog(t, 30*time.Second)
+	start := *now
+
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	*now = start.Add(10 * time.Second)
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	*now = start.Add(20 * time.Second)
+	logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	require.Len(t, logger.entries, 1)
+
+	// The last suppressed entry is logged when the state of the ARN is removed, with the
+	// number of entries suppressed before it
+	*now = start.Add(dedupHeartbeatInterval)
+	logDedupTestEntry(t, a, "task-arn-2", http.StatusOK)
+	require.Len(t, logger.entries, 3)
+	flushed := logger.entries[1]
+	assert.Contains(t, flushed, taskARN)
+	assert.True(t, strings.HasPrefix(flushed, "2023-05-01T10:00:20Z "), flushed)
+	assert.True(t, strings.HasSuffix(flushed, " suppressed=1"), flushed)
+	assert.Contains(t, logger.entries[2], "task-arn-2")
+	assert.Len(t, a.dedup.entries, 1)
+}
+
+func TestAuditLogWithoutDedupWindow(t *testing.T) {
+	logger := &recordingInfoLogger{}
+	a, ok := NewAuditLog(dummyContainerInstanceArn, &config.Config{Cluster: dummyCluster}, logger).(*auditLog)
+	require.True(t, ok)
+	assert.Nil(t, a.dedup)
+
+	for i := 0; i < 3; i++ {
+		logDedupTestEntry(t, a, taskARN, http.StatusOK)
+	}
+	assert.Len(t, logger.entries, 3)
+}
@@ -15,6 +15,7 @@ package audit
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -41,7 +42,16 @@ const (
 	// Version '2', following fields were modified
 	// 7. event type ('GetCredentials, GetCredentialsExecutionRole')
 
-	getCredentialsAuditLogVersion = 2
+	// Version '3', following fields were added
+	// 11. TMDS API version ('v1', 'v2', 'v4')
+	// 12. quoted request body scrubbed of secrets, only for requests whose body is logged
+	// 13. traceId=<W3C trace id> and spanId=<W3C parent id>, only for requests with a span context
+
+	// Version '4', following fields were added
+	// 14. suppressed=<number of duplicate entries suppressed since the last entry of the ARN>,
+	//     only for entries logged after duplicates were suppressed by the dedup window
+
+	getCredentialsAuditLogVersion = 4
 )
 
 type commonAuditLogEntryFields struct {
@@ -62,13 +72,14 @@ type getCredentialsAuditLogEntryFields struct {
 	version              int
 	cluster              string
 	containerInstanceArn string
+	apiVersion           string
 }
 
 func (g *getCredentialsAuditLogEntryFields) string() string {
-	return fmt.Sprintf("%s %d %s %s", g.eventType, g.version, g.cluster, g.containerInstanceArn)
+	return fmt.Sprintf("%s %d %s %s %s", g.eventType, g.version, g.cluster, g.containerInstanceArn, g.apiVersion)
 }
 
-func constructCommonAuditLogEntryFields(r request.LogRequest, httpResponseCode int) string {
+func constructCommonAuditLogEntryFields(r request.LogRequest, httpResponseCode int, eventTime time.Time) string {
 	httpRequest := r.Request
 	url := httpRequest.URL.Path
 	// V2CredentialsPath contains the credentials ID, which should not be logged
@@ -76,7 +87,7 @@ func constructCommonAuditLogEntryFields(r request.LogRequest, httpResponseCode i
 		url = credentials.V2CredentialsPath
 	}
 	fields := &commonAuditLogEntryFields{
-		eventTime:    time.Now().UTC().Format(time.RFC3339),
+		eventTime:    eventTime.UTC().Format(time.RFC3339),
 		responseCode: httpResponseCode,
 		srcAddr:      populateField(httpRequest.RemoteAddr),
 		theURL:       populateField(fmt.Sprintf(`"%s"`, url)),
@@ -86,28 +97,45 @@ func constructCommonAuditLogEntryFields(r request.LogRequest, httpResponseCode i
 	return fields.string()
 }
 
-func constructAuditLogEntryByType(eventType string, cluster string, containerInstanceArn string) string {
-	switch eventType {
-	case audit.GetCredentialsEventType:
-		fields := &getCredentialsAuditLogEntryFields{
-			eventType:            eventType,
-			version:              getCredentialsAuditLogVersion,
-			cluster:              populateField(cluster),
-			containerInstanceArn: populateField(containerInstanceArn),
-		}
-		return fields.string()
-	case audit.GetCredentialsTaskExecutionEventType:
-		fields := &getCredentialsAuditLogEntryFields{
-			eventType:            eventType,
-			version:              getCredentialsAuditLogVersion,
-			cluster:              populateField(cluster),
-			containerInstanceArn: populateField(containerInstanceArn),
-		}
-		return fields.string()
-	default:
-		log.Warn(fmt.Sprintf("Unknown eventType: %s", eventType))
+// constructAuditLogEntryByType returns the fields of the entry that depend on the event
+// type. All the credentials event types, including the ones registered with
+// audit.RegisterRoleTypeEventMapping, have the same fields.
+func constructAuditLogEntryByType(eventType string, cluster string, containerInstanceArn string,
+	apiVersion string) string {
+	if !audit.IsCredentialsEventType(eventType) {
+		log.Debugf("Unknown eventType: %s", eventType)
+		return ""
+	}
+	fields := &getCredentialsAuditLogEntryFields{
+		eventType:            eventType,
+		version:              getCredentialsAuditLogVersion,
+		cluster:              populateField(cluster),
+		containerInstanceArn: populateField(containerInstanceArn),
+		apiVersion:           populateField(apiVersion),
+	}
+	return fields.string()
+}
+
+// constructAuditLogBodyField returns the quoted request body, scrubbed of secrets. The
+// body is quoted so that it is a single field of the entry whatever it contains.
+func constructAuditLogBodyField(body []byte, scrubber audit.BodyScrubber) string {
+	if scrubber == nil {
+		scrubber = audit.DefaultBodyScrubber()
+	}
+	return strconv.Quote(string(scrubber.Scrub(body)))
+}
+
+// constructAuditLogTraceFields returns the trace and span ids of the span context of the
+// request, or an empty string if the request has none.
+func constructAuditLogTraceFields(r request.LogRequest) string {
+	if r.Request == nil {
+		return ""
+	}
+	spanContext, ok := audit.SpanContextFromContext(r.Request.Context())
+	if !ok {
 		return ""
 	}
+	return fmt.Sprintf("traceId=%s spanId=%s", spanContext.TraceID, spanContext.SpanID)
 }
 
 func populateField(logField string) string {
@@ -0,0 +1,97 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	auditinterface "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+)
+
+const (
+	// SyslogLocal is the syslog address of the local syslog daemon
+	SyslogLocal = "local"
+
+	// DefaultSyslogFacility and DefaultSyslogSeverity are the facility and severity that
+	// audit log entries are sent to syslog with, if none are configured
+	DefaultSyslogFacility = "auth"
+	DefaultSyslogSeverity = "info"
+
+	// syslogTag is the tag of the audit log entries sent to syslog
+	syslogTag = "ecs-agent-audit"
+
+	// syslogRedialInterval is how often the connection to syslog is dialed again while
+	// syslog is unavailable
+	syslogRedialInterval = 30 * time.Second
+)
+
+// SyslogConfig is the configuration of the syslog that audit log entries are sent to.
+type SyslogConfig struct {
+	// Network and Address are the network and address of the syslog daemon, Network is
+	// empty for the local syslog daemon
+	Network string
+	Address string
+	// Facility and Severity are the names of the syslog facility and severity, such as
+	// auth and info
+	Facility string
+	Severity string
+}
+
+// ParseSyslogConfig returns the syslog configuration of the agent config. The syslog
+// address is either "local", for the local syslog daemon, or a URL of the form
+// udp://host:port or tcp://host:port.
+func ParseSyslogConfig(cfg *config.Config) (SyslogConfig, error) {
+	syslogCfg := SyslogConfig{
+		Facility: DefaultSyslogFacility,
+		Severity: DefaultSyslogSeverity,
+	}
+	if cfg.CredentialsAuditLogSyslogFacility != "" {
+		syslogCfg.Facility = strings.ToLower(cfg.CredentialsAuditLogSyslogFacility)
+	}
+	if cfg.CredentialsAuditLogSyslogSeverity != "" {
+		syslogCfg.Severity = strings.ToLower(cfg.CredentialsAuditLogSyslogSeverity)
+	}
+	if cfg.CredentialsAuditLogSyslog == SyslogLocal {
+		return syslogCfg, nil
+	}
+	address, err := url.Parse(cfg.CredentialsAuditLogSyslog)
+	if err != nil {
+		return SyslogConfig{}, fmt.Errorf("invalid syslog address %q: %w", cfg.CredentialsAuditLogSyslog, err)
+	}
+	if (address.Scheme != "udp" && address.Scheme != "tcp") || address.Host == "" {
+		return SyslogConfig{}, fmt.Errorf("invalid syslog address %q: must be %s, udp://host:port or tcp://host:port",
+			cfg.CredentialsAuditLogSyslog, SyslogLocal)
+	}
+	syslogCfg.Network = address.Scheme
+	syslogCfg.Address = address.Host
+	return syslogCfg, nil
+}
+
+// NewSyslogAuditLog creates an audit log that sends its entries to syslog. Entries are
+// logged with the fallback logger while syslog is unavailable, such as when the syslog
+// daemon isn't running or can't be reached, and syslog is dialed again every 30 seconds
+// until it is available. An error is returned if the facility or severity is unknown, or
+// if syslog isn't supported on the platform.
+func NewSyslogAuditLog(containerInstanceArn string, cfg *config.Config, syslogCfg SyslogConfig,
+	fallback InfoLogger, options ...AuditLogOpt) (auditinterface.AuditLogger, error) {
+	logger, err := newSyslogLogger(syslogCfg, fallback)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLog(containerInstanceArn, cfg, logger, options...), nil
+}
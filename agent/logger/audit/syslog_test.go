@@ -0,0 +1,68 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyslogConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      config.Config
+		expected SyslogConfig
+	}{
+		{
+			name:     "local",
+			cfg:      config.Config{CredentialsAuditLogSyslog: "local"},
+			expected: SyslogConfig{Facility: "auth", Severity: "info"},
+		},
+		{
+			name: "udp",
+			cfg: config.Config{
+				CredentialsAuditLogSyslog:         "udp://10.0.0.1:514",
+				CredentialsAuditLogSyslogFacility: "LOCAL3",
+				CredentialsAuditLogSyslogSeverity: "notice",
+			},
+			expected: SyslogConfig{Network: "udp", Address: "10.0.0.1:514", Facility: "local3", Severity: "notice"},
+		},
+		{
+			name:     "tcp",
+			cfg:      config.Config{CredentialsAuditLogSyslog: "tcp://syslog.example.com:6514"},
+			expected: SyslogConfig{Network: "tcp", Address: "syslog.example.com:6514", Facility: "auth", Severity: "info"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			syslogCfg, err := ParseSyslogConfig(&tc.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, syslogCfg)
+		})
+	}
+}
+
+func TestParseSyslogConfigInvalidAddress(t *testing.T) {
+	for _, address := range []string{"10.0.0.1:514", "unix:///dev/log", "udp://", "remote"} {
+		t.Run(address, func(t *testing.T) {
+			_, err := ParseSyslogConfig(&config.Config{CredentialsAuditLogSyslog: address})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+//go:build !windows
+// +build !windows
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"log/syslog"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+var syslogSeverities = map[string]syslog.Priority{
+	"emerg":   syslog.LOG_EMERG,
+	"alert":   syslog.LOG_ALERT,
+	"crit":    syslog.LOG_CRIT,
+	"err":     syslog.LOG_ERR,
+	"warning": syslog.LOG_WARNING,
+	"notice":  syslog.LOG_NOTICE,
+	"info":    syslog.LOG_INFO,
+	"debug":   syslog.LOG_DEBUG,
+}
+
+// syslogLogger is the InfoLogger of the syslog audit log. It falls back to another logger
+// while syslog is unavailable.
+type syslogLogger struct {
+	network  string
+	address  string
+	priority syslog.Priority
+	fallback InfoLogger
+
+	lock sync.Mutex
+	// writer is nil while syslog is unavailable, lastDial is when it was last dialed
+	writer         *syslog.Writer
+	lastDial       time.Time
+	redialInterval time.Duration
+	now            func() time.Time
+}
+
+func newSyslogLogger(syslogCfg SyslogConfig, fallback InfoLogger) (InfoLogger, error) {
+	facility, ok := syslogFacilities[syslogCfg.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", syslogCfg.Facility)
+	}
+	severity, ok := syslogSeverities[syslogCfg.Severity]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog severity %q", syslogCfg.Severity)
+	}
+	l := &syslogLogger{
+		network:        syslogCfg.Network,
+		address:        syslogCfg.Address,
+		priority:       facility | severity,
+		fallback:       fallback,
+		redialInterval: syslogRedialInterval,
+		now:            time.Now,
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.dialUnsafe()
+	return l, nil
+}
+
+// Info sends the audit log entry to syslog, or logs it with the fallback logger if syslog
+// is unavailable.
+func (l *syslogLogger) Info(i ...interface{}) {
+	entry := fmt.Sprint(i...)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.writer == nil && l.now().Sub(l.lastDial) >= l.redialInterval {
+		l.dialUnsafe()
+	}
+	if l.writer != nil {
+		// The writer dials again by itself once if the write fails
+		_, err := l.writer.Write([]byte(entry))
+		if err == nil {
+			return
+		}
+		seelog.Warnf("Failed to send audit log entry to syslog, falling back to the audit log: %v", err)
+		l.writer.Close()
+		l.writer = nil
+	}
+	if l.fallback != nil {
+		l.fallback.Info(entry)
+	}
+}
+
+func (l *syslogLogger) dialUnsafe() {
+	l.lastDial = l.now()
+	writer, err := syslog.Dial(l.network, l.address, l.priority, syslogTag)
+	if err != nil {
+		seelog.Warnf("Syslog is unavailable, audit log entries are logged to the audit log: %v", err)
+		return
+	}
+	l.writer = writer
+}
@@ -0,0 +1,171 @@
+//go:build !windows && unit
+// +build !windows,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	mock_infologger "github.com/aws/amazon-ecs-agent/agent/logger/audit/mocks"
+	auditinterface "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func syslogTestLogRequest(t *testing.T) request.LogRequest {
+	req, err := http.NewRequest("GET", dummyURL, nil)
+	require.NoError(t, err)
+	req.RemoteAddr = dummyRemoteAddress
+	req.Header.Set("User-Agent", dummyUserAgent)
+	return request.LogRequest{Request: req, ARN: taskARN}
+}
+
+// assertSyslogMessage asserts that the syslog message has the priority of the local3
+// facility and the notice severity, the audit log tag and the audit log entry.
+func assertSyslogMessage(t *testing.T, message string) {
+	// local3 is facility 19 and notice is severity 5
+	assert.True(t, strings.HasPrefix(message, "<157>"), "unexpected priority of message %q", message)
+	assert.Contains(t, message, " "+syslogTag+"[")
+	assert.Contains(t, message, dummyURLPath)
+	assert.Contains(t, message, auditinterface.GetCredentialsEventType)
+	assert.Contains(t, message, dummyCluster)
+}
+
+func TestSyslogAuditLogUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	cfg := &config.Config{Cluster: dummyCluster}
+	auditLogger, err := NewSyslogAuditLog(dummyContainerInstanceArn, cfg, SyslogConfig{
+		Network:  "udp",
+		Address:  listener.LocalAddr().String(),
+		Facility: "local3",
+		Severity: "notice",
+	}, nil)
+	require.NoError(t, err)
+	auditLogger.Log(syslogTestLogRequest(t), dummyResponseCode, auditinterface.GetCredentialsEventType)
+
+	buf := make([]byte, 4096)
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(10*time.Second)))
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assertSyslogMessage(t, string(buf[:n]))
+}
+
+func TestSyslogAuditLogTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Messages over TCP are terminated by a new line
+		message, _ := bufio.NewReader(conn).ReadString('\n')
+		messages <- message
+	}()
+
+	cfg := &config.Config{Cluster: dummyCluster}
+	auditLogger, err := NewSyslogAuditLog(dummyContainerInstanceArn, cfg, SyslogConfig{
+		Network:  "tcp",
+		Address:  listener.Addr().String(),
+		Facility: "local3",
+		Severity: "notice",
+	}, nil)
+	require.NoError(t, err)
+	auditLogger.Log(syslogTestLogRequest(t), dummyResponseCode, auditinterface.GetCredentialsEventType)
+
+	select {
+	case message := <-messages:
+		assertSyslogMessage(t, message)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the syslog message")
+	}
+}
+
+func TestSyslogAuditLogUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Nothing listens on the address of the closed listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	fallback := mock_infologger.NewMockInfoLogger(ctrl)
+	logger, err := newSyslogLogger(SyslogConfig{
+		Network:  "tcp",
+		Address:  address,
+		Facility: "auth",
+		Severity: "info",
+	}, fallback)
+	require.NoError(t, err)
+	syslogLogger := logger.(*syslogLogger)
+	now := time.Now()
+	syslogLogger.now = func() time.Time { return now }
+
+	cfg := &config.Config{Cluster: dummyCluster}
+	auditLogger := NewAuditLog(dummyContainerInstanceArn, cfg, logger)
+	fallback.EXPECT().Info(gomock.Any()).Do(func(entry string) {
+		assert.Contains(t, entry, dummyURLPath)
+	}).Times(2)
+	auditLogger.Log(syslogTestLogRequest(t), dummyResponseCode, auditinterface.GetCredentialsEventType)
+	auditLogger.Log(syslogTestLogRequest(t), dummyResponseCode, auditinterface.GetCredentialsEventType)
+
+	// Syslog is dialed again once the redial interval has passed
+	listener, err = net.Listen("tcp", address)
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		message, _ := bufio.NewReader(conn).ReadString('\n')
+		messages <- message
+	}()
+	now = now.Add(syslogRedialInterval)
+	auditLogger.Log(syslogTestLogRequest(t), dummyResponseCode, auditinterface.GetCredentialsEventType)
+	select {
+	case message := <-messages:
+		assert.Contains(t, message, dummyURLPath)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the syslog message")
+	}
+}
+
+func TestSyslogAuditLogInvalidPriority(t *testing.T) {
+	cfg := &config.Config{Cluster: dummyCluster}
+	_, err := NewSyslogAuditLog(dummyContainerInstanceArn, cfg, SyslogConfig{Facility: "security", Severity: "info"}, nil)
+	assert.Error(t, err)
+	_, err = NewSyslogAuditLog(dummyContainerInstanceArn, cfg, SyslogConfig{Facility: "auth", Severity: "verbose"}, nil)
+	assert.Error(t, err)
+}
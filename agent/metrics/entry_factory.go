@@ -0,0 +1,161 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ecsmetrics "github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	"github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// histogramEntryFactory creates metric entries that record the duration of operations in
+// Prometheus histograms. The fields of the entries are the labels of the histograms.
+type histogramEntryFactory struct {
+	registry   *prometheus.Registry
+	lock       sync.Mutex
+	histograms map[string]*prometheus.HistogramVec
+}
+
+func newHistogramEntryFactory(registry *prometheus.Registry) *histogramEntryFactory {
+	return &histogramEntryFactory{
+		registry:   registry,
+		histograms: make(map[string]*prometheus.HistogramVec),
+	}
+}
+
+// EntryFactory returns the factory of metric entries that record the duration of operations
+// in the registry of the engine, like the latency of requests to the local endpoints. The
+// entries are not recorded if Prometheus metrics are not enabled.
+func (engine *MetricsEngine) EntryFactory() ecsmetrics.EntryFactory {
+	if engine == nil || !engine.collection {
+		return ecsmetrics.NewNopEntryFactory()
+	}
+	return engine.entryFactory
+}
+
+// GlobalEntryFactory returns a factory of metric entries that are created with the factory
+// of MetricsEngineGlobal at the time they are created, for components that are created
+// before the global metrics engine is initialized.
+func GlobalEntryFactory() ecsmetrics.EntryFactory {
+	return globalEntryFactory{}
+}
+
+type globalEntryFactory struct{}
+
+func (globalEntryFactory) New(op string) ecsmetrics.Entry {
+	return MetricsEngineGlobal.EntryFactory().New(op)
+}
+
+func (globalEntryFactory) Flush() {
+	MetricsEngineGlobal.EntryFactory().Flush()
+}
+
+func (f *histogramEntryFactory) New(op string) ecsmetrics.Entry {
+	return &histogramEntry{
+		factory: f,
+		op:      op,
+		start:   time.Now(),
+	}
+}
+
+func (f *histogramEntryFactory) Flush() {}
+
+// histogram returns the histogram of an operation. It is registered with the label names of
+// the first entry of the operation that is done.
+func (f *histogramEntryFactory) histogram(op string, labelNames []string) (*prometheus.HistogramVec, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if histogram, ok := f.histograms[op]; ok {
+		return histogram, nil
+	}
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: AgentNamespace,
+		Name:      strings.ReplaceAll(op, ".", "_") + "_seconds",
+		Help:      op + " duration in seconds",
+		Buckets:   prometheus.DefBuckets,
+	}, labelNames)
+	if err := f.registry.Register(histogram); err != nil {
+		return nil, err
+	}
+	f.histograms[op] = histogram
+	return histogram, nil
+}
+
+// histogramEntry is timed from its creation until it is done. Counts and gauges are not
+// recorded. The duration is observed with the exemplar of the entry, if it has one, which
+// is exposed when metrics are scraped in the OpenMetrics format.
+type histogramEntry struct {
+	factory  *histogramEntryFactory
+	op       string
+	start    time.Time
+	fields   map[string]interface{}
+	exemplar prometheus.Labels
+}
+
+func (e *histogramEntry) WithFields(f map[string]interface{}) ecsmetrics.Entry {
+	fields := make(map[string]interface{}, len(e.fields)+len(f))
+	for name, value := range e.fields {
+		fields[name] = value
+	}
+	for name, value := range f {
+		fields[name] = value
+	}
+	entry := *e
+	entry.fields = fields
+	return &entry
+}
+
+func (e *histogramEntry) WithExemplar(labels map[string]string) ecsmetrics.Entry {
+	entry := *e
+	entry.exemplar = labels
+	return &entry
+}
+
+func (e *histogramEntry) WithCount(count int) ecsmetrics.Entry { return e }
+
+func (e *histogramEntry) WithGauge(value interface{}) ecsmetrics.Entry { return e }
+
+func (e *histogramEntry) Done(err error) func() {
+	duration := time.Since(e.start)
+	return func() {
+		labels := make(prometheus.Labels, len(e.fields))
+		labelNames := make([]string, 0, len(e.fields))
+		for name, value := range e.fields {
+			labels[name] = fmt.Sprint(value)
+			labelNames = append(labelNames, name)
+		}
+		sort.Strings(labelNames)
+		histogram, err := e.factory.histogram(e.op, labelNames)
+		if err != nil {
+			seelog.Warnf("Unable to register the histogram of %s: %v", e.op, err)
+			return
+		}
+		observer, err := histogram.GetMetricWith(labels)
+		if err != nil {
+			seelog.Warnf("Unable to record the duration of %s: %v", e.op, err)
+			return
+		}
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && len(e.exemplar) > 0 {
+			exemplarObserver.ObserveWithExemplar(duration.Seconds(), e.exemplar)
+			return
+		}
+		observer.Observe(duration.Seconds())
+	}
+}
@@ -30,6 +30,8 @@ type MetricsEngine struct {
 	cfg            *config.Config
 	Registry       *prometheus.Registry
 	managedMetrics map[APIType]MetricsClient
+	entryFactory   *histogramEntryFactory
+	pullFailures   *prometheus.CounterVec
 }
 
 const (
@@ -86,7 +88,15 @@ func NewMetricsEngine(cfg *config.Config, registry *prometheus.Registry) *Metric
 		cfg:            cfg,
 		Registry:       registry,
 		managedMetrics: make(map[APIType]MetricsClient),
+		entryFactory:   newHistogramEntryFactory(registry),
+		pullFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: AgentNamespace,
+			Subsystem: DockerSubsystem,
+			Name:      "image_pull_failure_count",
+			Help:      "Image pull failures by the category of their cause",
+		}, []string{"Category"}),
 	}
+	registry.MustRegister(metricsEngine.pullFailures)
 	for managedAPI := range managedAPIs {
 		aClient := NewMetricsClient(managedAPI, metricsEngine.Registry)
 		metricsEngine.managedMetrics[managedAPI] = aClient
@@ -114,6 +124,14 @@ func (engine *MetricsEngine) RecordECSClientMetric(callName string) func() {
 	return engine.recordGenericMetric(ECSClient, callName)
 }
 
+// Records an image pull failure in the counter of its category
+func (engine *MetricsEngine) RecordImagePullFailure(category string) {
+	if engine == nil || !engine.collection {
+		return
+	}
+	engine.pullFailures.WithLabelValues(category).Inc()
+}
+
 // Records a call's start and returns a function to be deferred.
 // Wrapper functions will use this function for GenericMetricsClients.
 // If Metrics collection is enabled from the cfg, we record a metric with callID
@@ -144,9 +162,10 @@ func (engine *MetricsEngine) recordMetric(apiType APIType, callName, callID stri
 func (engine *MetricsEngine) publishMetrics() {
 	go func() {
 		// Because we are using the DefaultRegisterer in Prometheus, we can use
-		// the promhttp.Handler() function. In future cases for custom registers,
-		// we can use promhttp.HandlerFor(customRegisterer, promhttp.HandlerOpts{})
-		http.Handle("/metrics", promhttp.Handler())
+		// the default gatherer. Scrapers that accept the OpenMetrics format are served
+		// the exemplars of histograms, others are served the text format.
+		http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
 		err := http.ListenAndServe(fmt.Sprintf(":%d", config.AgentPrometheusExpositionPort), nil)
 		if err != nil {
 			seelog.Errorf("Error publishing metrics: %s", err.Error())
@@ -23,9 +23,11 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	ecsmetrics "github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Create default config for Metrics. PrometheusMetricsEnabled is set to false
@@ -216,3 +218,136 @@ func compareDiff(a, b, deltaMin float64) bool {
 	}
 	return diff <= (a * deltaMin)
 }
+
+// Tests that the entries of the entry factory record the duration of operations in a
+// histogram labelled with their fields.
+func TestEntryFactory(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	_, ok := MetricsEngineGlobal.EntryFactory().New("Test.Latency").(*histogramEntry)
+	assert.False(t, ok, "entries shouldn't be recorded when metrics are disabled")
+
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	factory := MetricsEngineGlobal.EntryFactory()
+	for i := 0; i < 2; i++ {
+		entry := factory.New("Test.Latency")
+		time.Sleep(10 * time.Millisecond)
+		entry.WithFields(map[string]interface{}{"route": "v2/credentials", "status": 200}).Done(nil)()
+	}
+	factory.New("Test.Latency").WithFields(map[string]interface{}{"route": "v1/metadata"}).Done(nil)()
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+	var histogram *dto.Histogram
+	for _, family := range metricFamilies {
+		if family.GetName() != "AgentMetrics_Test_Latency_seconds" {
+			continue
+		}
+		assert.Len(t, family.GetMetric(), 1)
+		for _, label := range family.GetMetric()[0].GetLabel() {
+			assert.Contains(t, []string{"route=v2/credentials", "status=200"},
+				label.GetName()+"="+label.GetValue())
+		}
+		histogram = family.GetMetric()[0].GetHistogram()
+	}
+	if assert.NotNil(t, histogram) {
+		assert.Equal(t, uint64(2), histogram.GetSampleCount())
+		assert.GreaterOrEqual(t, histogram.GetSampleSum(), 0.02)
+	}
+}
+
+// Tests that the entries of the entry factory observe durations with their exemplars, and
+// that entries without exemplars observe durations without them.
+func TestEntryFactoryExemplars(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	factory := MetricsEngineGlobal.EntryFactory()
+	fields := map[string]interface{}{"route": "v1/credentials"}
+	factory.New("Test.Latency").WithFields(fields).Done(nil)()
+	assertBucketExemplars(t, nil)
+
+	entry, ok := factory.New("Test.Latency").(ecsmetrics.ExemplarEntry)
+	require.True(t, ok, "entries should support exemplars")
+	entry.WithExemplar(map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}).
+		WithFields(fields).Done(nil)()
+	assertBucketExemplars(t, []string{"4bf92f3577b34da6a3ce929d0e0e4736"})
+}
+
+// assertBucketExemplars asserts that the buckets of the test histogram have exemplars with
+// the trace ids.
+func assertBucketExemplars(t *testing.T, expectedTraceIDs []string) {
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	require.NoError(t, err)
+	var traceIDs []string
+	for _, family := range metricFamilies {
+		if family.GetName() != "AgentMetrics_Test_Latency_seconds" {
+			continue
+		}
+		for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			if exemplar := bucket.GetExemplar(); exemplar != nil {
+				for _, label := range exemplar.GetLabel() {
+					assert.Equal(t, "trace_id", label.GetName())
+					traceIDs = append(traceIDs, label.GetValue())
+				}
+			}
+		}
+	}
+	assert.Equal(t, expectedTraceIDs, traceIDs)
+}
+
+// Tests that the global entry factory creates entries with the factory of the global
+// metrics engine once it is initialized.
+func TestGlobalEntryFactory(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	factory := GlobalEntryFactory()
+	_, ok := factory.New("Test.Latency").(*histogramEntry)
+	assert.False(t, ok, "entries shouldn't be recorded when metrics are disabled")
+
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	_, ok = factory.New("Test.Latency").(*histogramEntry)
+	assert.True(t, ok, "entries should be recorded once metrics are enabled")
+}
+
+// Tests that image pull failures are counted by category.
+func TestRecordImagePullFailure(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	// Recording isn't a no-op only once metrics are enabled
+	MetricsEngineGlobal.RecordImagePullFailure("authentication")
+
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordImagePullFailure("authentication")
+	MetricsEngineGlobal.RecordImagePullFailure("authentication")
+	MetricsEngineGlobal.RecordImagePullFailure("disk_full")
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+	counts := make(map[string]float64)
+	for _, family := range metricFamilies {
+		if family.GetName() != "AgentMetrics_DockerAPI_image_pull_failure_count" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			counts[metric.GetLabel()[0].GetValue()] = metric.GetCounter().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{"authentication": 2, "disk_full": 1}, counts)
+}
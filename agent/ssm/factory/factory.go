@@ -16,6 +16,7 @@ package factory
 import (
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/awsendpoints"
 	"github.com/aws/amazon-ecs-agent/agent/httpclient"
 	ssmclient "github.com/aws/amazon-ecs-agent/agent/ssm"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
@@ -23,6 +24,7 @@ import (
 	awscreds "github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/cihub/seelog"
 )
 
 const (
@@ -33,14 +35,18 @@ type SSMClientCreator interface {
 	NewSSMClient(region string, creds credentials.IAMRoleCredentials) ssmclient.SSMClient
 }
 
-func NewSSMClientCreator() SSMClientCreator {
-	return &ssmClientCreator{}
+// NewSSMClientCreator returns a creator of clients that are pointed at the endpoints resolved
+// by the endpoint resolver
+func NewSSMClientCreator(endpoints *awsendpoints.Resolver) SSMClientCreator {
+	return &ssmClientCreator{endpoints: endpoints}
 }
 
-type ssmClientCreator struct{}
+type ssmClientCreator struct {
+	endpoints *awsendpoints.Resolver
+}
 
 // SSM Client will automatically retry 3 times when has throttling error
-func (*ssmClientCreator) NewSSMClient(region string,
+func (creator *ssmClientCreator) NewSSMClient(region string,
 	creds credentials.IAMRoleCredentials) ssmclient.SSMClient {
 	cfg := aws.NewConfig().
 		WithHTTPClient(httpclient.New(roundtripTimeout, false)).
@@ -48,6 +54,10 @@ func (*ssmClientCreator) NewSSMClient(region string,
 		WithCredentials(
 			awscreds.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey,
 				creds.SessionToken))
+	if err := creator.endpoints.Configure(cfg, awsendpoints.SSM, region); err != nil {
+		seelog.Errorf("Unable to resolve the SSM endpoint in region %s, using the default endpoint: %v",
+			region, err)
+	}
 	sess := session.Must(session.NewSession(cfg))
 	return ssm.New(sess)
 }
@@ -29,6 +29,11 @@ const (
 	// ManagedAgentEvent is used to define the managed agent state transition events
 	// emitted by the engine
 	ManagedAgentEvent
+
+	// ResourceEvent is used to define the task resource state transition events
+	// emitted by the engine. They are only published locally, and never sent to
+	// the backend
+	ResourceEvent
 )
 
 // Event defines the type of state change event
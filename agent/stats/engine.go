@@ -956,7 +956,9 @@ func (engine *DockerStatsEngine) resetStatsUnsafe() {
 	}
 }
 
-// ContainerDockerStats returns the last stored raw docker stats object for a container
+// ContainerDockerStats returns the last stored raw docker stats object for a container. No
+// stats are returned if the last stats are older than the staleness threshold, for example
+// while the stats stream of the container is being re-established.
 func (engine *DockerStatsEngine) ContainerDockerStats(taskARN string, containerID string) (*types.StatsJSON, *NetworkStatsPerSec, error) {
 	engine.lock.RLock()
 	defer engine.lock.RUnlock()
@@ -972,8 +974,14 @@ func (engine *DockerStatsEngine) ContainerDockerStats(taskARN string, containerI
 	if !ok {
 		return nil, nil, errors.Errorf("stats engine: container not found: %s", containerID)
 	}
-	containerStats := container.statsQueue.GetLastStat()
+	containerStats := engine.lastStat(container.statsQueue)
 	containerNetworkRateStats := container.statsQueue.GetLastNetworkStatPerSec()
+	if containerStats == nil {
+		logger.Debug("No fresh stats for container", logger.Fields{
+			field.Container: containerID,
+		})
+		return nil, nil, nil
+	}
 
 	// Insert network stats in container stats
 	task, err := engine.resolver.ResolveTaskByARN(taskARN)
@@ -985,8 +993,8 @@ func (engine *DockerStatsEngine) ContainerDockerStats(taskARN string, containerI
 	if task.IsNetworkModeAWSVPC() {
 		taskStats, ok := taskToTaskStats[taskARN]
 		if ok {
-			if taskStats.StatsQueue.GetLastStat() != nil {
-				containerStats.Networks = taskStats.StatsQueue.GetLastStat().Networks
+			if taskStat := engine.lastStat(taskStats.StatsQueue); taskStat != nil {
+				containerStats.Networks = taskStat.Networks
 			}
 			containerNetworkRateStats = taskStats.StatsQueue.GetLastNetworkStatPerSec()
 		} else {
@@ -1001,6 +1009,15 @@ func (engine *DockerStatsEngine) ContainerDockerStats(taskARN string, containerI
 	return containerStats, containerNetworkRateStats, nil
 }
 
+// lastStat returns the last stats of the queue unless they're older than the staleness
+// threshold.
+func (engine *DockerStatsEngine) lastStat(queue *Queue) *types.StatsJSON {
+	if engine.config == nil || engine.config.ContainerStatsStalenessThreshold <= 0 {
+		return queue.GetLastStat()
+	}
+	return queue.GetLastStatWithin(engine.config.ContainerStatsStalenessThreshold)
+}
+
 // getTaskStatsToCollect returns a map of taskArns for which task metrics needs to collected
 func (engine *DockerStatsEngine) getTaskStatsToCollect() map[string]bool {
 	taskStatsToCollect := make(map[string]bool)
@@ -273,6 +273,98 @@ func TestStatsEngineMetadataInStatsSets(t *testing.T) {
 	validateIdleContainerMetrics(t, engine)
 }
 
+// newStatsCacheTestEngine returns an engine tracking the containers of a bridge mode task,
+// whose stats queues are filled by the tests instead of docker stats streams.
+func newStatsCacheTestEngine(ctrl *gomock.Controller, containers int,
+	stalenessThreshold time.Duration) *DockerStatsEngine {
+	resolver := mock_resolver.NewMockContainerMetadataResolver(ctrl)
+	resolver.EXPECT().ResolveTaskByARN("t1").Return(
+		&apitask.Task{Arn: "t1", Family: "f1", NetworkMode: "bridge"}, nil).AnyTimes()
+	engineCfg := cfg
+	engineCfg.ContainerStatsStalenessThreshold = stalenessThreshold
+	engine := NewDockerStatsEngine(&engineCfg, nil, eventStream("TestStatsCache"), nil, nil)
+	engine.resolver = resolver
+	engine.tasksToContainers["t1"] = make(map[string]*StatsContainer)
+	for i := 0; i < containers; i++ {
+		dockerID := fmt.Sprintf("c%d", i)
+		engine.tasksToContainers["t1"][dockerID] = &StatsContainer{
+			containerMetadata: &ContainerMetadata{DockerID: dockerID},
+			statsQueue:        NewQueue(10),
+		}
+	}
+	return engine
+}
+
+func TestContainerDockerStatsStaleness(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	engine := newStatsCacheTestEngine(mockCtrl, 1, 50*time.Millisecond)
+	queue := engine.tasksToContainers["t1"]["c0"].statsQueue
+
+	// No stats have been received yet
+	dockerStat, _, err := engine.ContainerDockerStats("t1", "c0")
+	assert.NoError(t, err)
+	assert.Nil(t, dockerStat)
+
+	ts1 := parseNanoTime("2015-02-12T21:22:05.131117533Z")
+	queue.setLastStat(&types.StatsJSON{Stats: types.Stats{Read: ts1}})
+	dockerStat, _, err = engine.ContainerDockerStats("t1", "c0")
+	assert.NoError(t, err)
+	require.NotNil(t, dockerStat)
+	assert.Equal(t, ts1, dockerStat.Read)
+
+	// The stats go stale while the stats stream is broken
+	time.Sleep(100 * time.Millisecond)
+	dockerStat, _, err = engine.ContainerDockerStats("t1", "c0")
+	assert.NoError(t, err)
+	assert.Nil(t, dockerStat)
+
+	// and are served again once the stream is re-established
+	ts2 := parseNanoTime("2015-02-12T21:22:06.131117533Z")
+	queue.setLastStat(&types.StatsJSON{Stats: types.Stats{Read: ts2}})
+	dockerStat, _, err = engine.ContainerDockerStats("t1", "c0")
+	assert.NoError(t, err)
+	require.NotNil(t, dockerStat)
+	assert.Equal(t, ts2, dockerStat.Read)
+}
+
+func TestContainerDockerStatsWithoutStalenessThreshold(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	engine := newStatsCacheTestEngine(mockCtrl, 1, 0)
+	queue := engine.tasksToContainers["t1"]["c0"].statsQueue
+	queue.setLastStat(&types.StatsJSON{})
+	queue.lastStatReceivedAt = time.Now().Add(-time.Hour)
+
+	dockerStat, _, err := engine.ContainerDockerStats("t1", "c0")
+	assert.NoError(t, err)
+	assert.NotNil(t, dockerStat)
+}
+
+// BenchmarkStatsCache measures serving the latest stats of 200 containers, each of which
+// receives a new sample from its stats stream before its stats are served.
+func BenchmarkStatsCache(b *testing.B) {
+	const containers = 200
+	mockCtrl := gomock.NewController(b)
+	defer mockCtrl.Finish()
+	engine := newStatsCacheTestEngine(mockCtrl, containers, config.DefaultContainerStatsStalenessThreshold)
+	queues := make([]*Queue, containers)
+	for i := range queues {
+		queues[i] = engine.tasksToContainers["t1"][fmt.Sprintf("c%d", i)].statsQueue
+	}
+	dockerStat := &types.StatsJSON{Stats: types.Stats{Read: time.Now()}}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i, queue := range queues {
+			queue.setLastStat(dockerStat)
+			if stat, _, err := engine.ContainerDockerStats("t1", fmt.Sprintf("c%d", i)); err != nil || stat == nil {
+				b.Fatalf("no stats for container c%d: %v", i, err)
+			}
+		}
+	}
+}
+
 func TestStatsEngineInvalidTaskEngine(t *testing.T) {
 	statsEngine := NewDockerStatsEngine(&cfg, nil, eventStream("TestStatsEngineInvalidTaskEngine"), nil, nil)
 	taskEngine := &MockTaskEngine{}
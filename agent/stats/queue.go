@@ -36,6 +36,7 @@ type Queue struct {
 	buffer                []UsageStats
 	maxSize               int
 	lastStat              *types.StatsJSON
+	lastStatReceivedAt    time.Time
 	lastNetworkStatPerSec *NetworkStatsPerSec
 	lock                  sync.RWMutex
 }
@@ -75,6 +76,7 @@ func (queue *Queue) setLastStat(stat *types.StatsJSON) {
 	defer queue.lock.Unlock()
 
 	queue.lastStat = stat
+	queue.lastStatReceivedAt = time.Now()
 }
 
 func (queue *Queue) add(rawStat *ContainerStats) {
@@ -148,6 +150,18 @@ func (queue *Queue) GetLastStat() *types.StatsJSON {
 	return queue.lastStat
 }
 
+// GetLastStatWithin returns the last recorded raw statistics object from docker if it was
+// received within maxAge, and nil otherwise.
+func (queue *Queue) GetLastStatWithin(maxAge time.Duration) *types.StatsJSON {
+	queue.lock.RLock()
+	defer queue.lock.RUnlock()
+
+	if queue.lastStat == nil || time.Since(queue.lastStatReceivedAt) > maxAge {
+		return nil
+	}
+	return queue.lastStat
+}
+
 func (queue *Queue) GetLastNetworkStatPerSec() *NetworkStatsPerSec {
 	queue.lock.RLock()
 	defer queue.lock.RUnlock()
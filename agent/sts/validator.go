@@ -0,0 +1,82 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package sts validates task credentials with AWS STS.
+package sts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	awscreds "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+const (
+	roundtripTimeout = 5 * time.Second
+)
+
+// CredentialsValidator validates credentials by calling STS GetCallerIdentity with them,
+// for the credentials handlers to catch broken credentials before they are served.
+type CredentialsValidator struct {
+	region    string
+	newClient func(region string, creds credentials.IAMRoleCredentials) stsiface.STSAPI
+}
+
+// NewCredentialsValidator returns a validator of credentials that calls the regional STS
+// endpoint of the region.
+func NewCredentialsValidator(region string) *CredentialsValidator {
+	return &CredentialsValidator{region: region, newClient: newSTSClient}
+}
+
+func newSTSClient(region string, creds credentials.IAMRoleCredentials) stsiface.STSAPI {
+	cfg := aws.NewConfig().
+		WithHTTPClient(httpclient.New(roundtripTimeout, false)).
+		WithRegion(region).
+		WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint).
+		WithCredentials(
+			awscreds.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey,
+				creds.SessionToken))
+	// Credentials are validated as they are, without retries that would outlast the
+	// timeout of the credentials handlers
+	cfg.MaxRetries = aws.Int(0)
+	return sts.New(session.Must(session.NewSession(cfg)))
+}
+
+// ValidateCredentials returns an error if GetCallerIdentity fails with the credentials, or
+// if the credentials are of an account other than the account of their role.
+func (v *CredentialsValidator) ValidateCredentials(ctx context.Context, creds credentials.IAMRoleCredentials) error {
+	out, err := v.newClient(v.region, creds).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("sts: GetCallerIdentity failed: %w", err)
+	}
+	account := aws.StringValue(out.Account)
+	if account == "" {
+		return fmt.Errorf("sts: GetCallerIdentity returned no account")
+	}
+	// Roles that aren't ARNs can't be checked, such as those of credentials in tests
+	if roleARN, err := arn.Parse(creds.RoleArn); err == nil && roleARN.AccountID != "" &&
+		roleARN.AccountID != account {
+		return fmt.Errorf("sts: credentials are of account %s instead of account %s of role %s",
+			account, roleARN.AccountID, creds.RoleArn)
+	}
+	return nil
+}
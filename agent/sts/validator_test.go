@@ -0,0 +1,100 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sts
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSTSClient struct {
+	stsiface.STSAPI
+	out *sts.GetCallerIdentityOutput
+	err error
+}
+
+func (f *fakeSTSClient) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput,
+	opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	return f.out, f.err
+}
+
+func TestValidateCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		roleArn     string
+		out         *sts.GetCallerIdentityOutput
+		err         error
+		expectError bool
+	}{
+		{
+			name:    "valid",
+			roleArn: "arn:aws:iam::123456789012:role/taskRole",
+			out:     &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")},
+		},
+		{
+			name:    "role not an ARN",
+			roleArn: "taskRole",
+			out:     &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")},
+		},
+		{
+			name:        "call fails",
+			roleArn:     "arn:aws:iam::123456789012:role/taskRole",
+			err:         errors.New("ExpiredToken"),
+			expectError: true,
+		},
+		{
+			name:        "no account",
+			roleArn:     "arn:aws:iam::123456789012:role/taskRole",
+			out:         &sts.GetCallerIdentityOutput{},
+			expectError: true,
+		},
+		{
+			name:        "other account",
+			roleArn:     "arn:aws:iam::123456789012:role/taskRole",
+			out:         &sts.GetCallerIdentityOutput{Account: aws.String("210987654321")},
+			expectError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var clientCreds credentials.IAMRoleCredentials
+			validator := &CredentialsValidator{
+				region: "us-west-2",
+				newClient: func(region string, creds credentials.IAMRoleCredentials) stsiface.STSAPI {
+					clientCreds = creds
+					return &fakeSTSClient{out: tc.out, err: tc.err}
+				},
+			}
+			creds := credentials.IAMRoleCredentials{RoleArn: tc.roleArn, AccessKeyID: "akid"}
+			err := validator.ValidateCredentials(context.Background(), creds)
+			if tc.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, creds, clientCreds, "the client wasn't created with the credentials")
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package taskfirewall
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// BackendNFTables means the rules are installed with the nf_tables backend of iptables.
+	BackendNFTables = "nftables"
+	// BackendLegacy means the rules are installed with the legacy iptables backend.
+	BackendLegacy = "iptables-legacy"
+
+	iptablesExecutable       = "iptables"
+	iptablesNFTExecutable    = "iptables-nft"
+	iptablesLegacyExecutable = "iptables-legacy"
+)
+
+// RuleExecutor runs iptables commands against the netfilter backend of the host.
+type RuleExecutor interface {
+	// Backend returns the netfilter backend the rules are installed with.
+	Backend() string
+	// Run runs an iptables command with the arguments and returns its combined output.
+	Run(args ...string) (string, error)
+}
+
+type commandExecutor struct {
+	executable string
+	backend    string
+	run        func(name string, args ...string) ([]byte, error)
+}
+
+// NewRuleExecutor returns an executor for the netfilter backend the host uses. The
+// iptables executable is preferred and its own backend is used, falling back to the
+// iptables-nft and iptables-legacy executables if it can't be found.
+func NewRuleExecutor() (RuleExecutor, error) {
+	return detectRuleExecutor(exec.LookPath, runCommand)
+}
+
+func detectRuleExecutor(
+	lookPath func(file string) (string, error),
+	run func(name string, args ...string) ([]byte, error),
+) (RuleExecutor, error) {
+	if path, err := lookPath(iptablesExecutable); err == nil {
+		backend := BackendLegacy
+		// iptables 1.8 and later report the backend they were built with, such as
+		// "iptables v1.8.7 (nf_tables)". Older versions only support the legacy backend.
+		if version, err := run(path, "--version"); err == nil && strings.Contains(string(version), "nf_tables") {
+			backend = BackendNFTables
+		}
+		return &commandExecutor{executable: path, backend: backend, run: run}, nil
+	}
+	if path, err := lookPath(iptablesNFTExecutable); err == nil {
+		return &commandExecutor{executable: path, backend: BackendNFTables, run: run}, nil
+	}
+	if path, err := lookPath(iptablesLegacyExecutable); err == nil {
+		return &commandExecutor{executable: path, backend: BackendLegacy, run: run}, nil
+	}
+	return nil, errors.Errorf("taskfirewall: none of %s, %s or %s found in the path",
+		iptablesExecutable, iptablesNFTExecutable, iptablesLegacyExecutable)
+}
+
+func (e *commandExecutor) Backend() string {
+	return e.backend
+}
+
+func (e *commandExecutor) Run(args ...string) (string, error) {
+	// Wait for the xtables lock instead of failing if another process holds it
+	output, err := e.run(e.executable, append([]string{"-w"}, args...)...)
+	if err != nil {
+		return string(output), errors.Wrapf(err, "taskfirewall: %s %s failed: %s",
+			e.executable, strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
@@ -0,0 +1,92 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package taskfirewall
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRuleExecutor(t *testing.T) {
+	testCases := []struct {
+		name               string
+		executables        []string
+		version            string
+		expectedExecutable string
+		expectedBackend    string
+	}{
+		{"iptables with nf_tables", []string{"iptables"}, "iptables v1.8.7 (nf_tables)", "/sbin/iptables", BackendNFTables},
+		{"iptables with legacy", []string{"iptables"}, "iptables v1.8.7 (legacy)", "/sbin/iptables", BackendLegacy},
+		{"old iptables", []string{"iptables"}, "iptables v1.4.21", "/sbin/iptables", BackendLegacy},
+		{"iptables-nft only", []string{"iptables-nft", "iptables-legacy"}, "", "/sbin/iptables-nft", BackendNFTables},
+		{"iptables-legacy only", []string{"iptables-legacy"}, "", "/sbin/iptables-legacy", BackendLegacy},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lookPath := func(file string) (string, error) {
+				for _, executable := range tc.executables {
+					if executable == file {
+						return "/sbin/" + file, nil
+					}
+				}
+				return "", errors.New("not found")
+			}
+			var ran []string
+			run := func(name string, args ...string) ([]byte, error) {
+				ran = append(append(ran, name), args...)
+				if len(args) == 1 && args[0] == "--version" {
+					return []byte(tc.version), nil
+				}
+				return []byte("ok"), nil
+			}
+
+			executor, err := detectRuleExecutor(lookPath, run)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedBackend, executor.Backend())
+
+			ran = nil
+			output, err := executor.Run("-t", "filter", "-S")
+			require.NoError(t, err)
+			assert.Equal(t, "ok", output)
+			assert.Equal(t, []string{tc.expectedExecutable, "-w", "-t", "filter", "-S"}, ran)
+		})
+	}
+}
+
+func TestDetectRuleExecutorNotFound(t *testing.T) {
+	lookPath := func(file string) (string, error) {
+		return "", errors.New("not found")
+	}
+	_, err := detectRuleExecutor(lookPath, nil)
+	assert.Error(t, err)
+}
+
+func TestRuleExecutorRunError(t *testing.T) {
+	executor := &commandExecutor{
+		executable: "iptables",
+		run: func(name string, args ...string) ([]byte, error) {
+			return []byte("iptables: No chain/target/match by that name.\n"), errors.New("exit status 1")
+		},
+	}
+	output, err := executor.Run("-t", "filter", "-S", "ECS_TMDS")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "No chain/target/match by that name.")
+	assert.Contains(t, output, "No chain")
+}
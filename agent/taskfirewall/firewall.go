@@ -0,0 +1,328 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package taskfirewall installs netfilter rules that restrict the task metadata
+// endpoints of bridge mode tasks to the containers of the task. Requests to the
+// credentials endpoint are redirected to the agent on the host, so without these
+// rules any container on the host can try the metadata paths of other tasks.
+package taskfirewall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const (
+	// parentChain is jumped to from the INPUT chain for all traffic to the task metadata
+	// server, and jumps to the chain of a task for requests to its metadata paths.
+	parentChain = "ECS_TMDS"
+	// taskChainPrefix is the prefix of the chains of the tasks. A task chain returns for
+	// the addresses of the task's containers and drops everything else.
+	taskChainPrefix = "ECS_TMDS_"
+	// taskChainHashLength is the number of hex digits of the task ARN hash in a task
+	// chain name, which keeps the name within the 28 characters netfilter allows.
+	taskChainHashLength = 16
+
+	filterTable  = "filter"
+	inputChain   = "INPUT"
+	loopbackIPv4 = "127.0.0.1"
+	targetDrop   = "DROP"
+	targetReturn = "RETURN"
+	appendRule   = "-A"
+	newChain     = "-N"
+	listRules    = "-S"
+	targetFlag   = "-j"
+	stringFlag   = "--string"
+)
+
+// metadataVersions are the versions of the task metadata endpoint that are restricted.
+var metadataVersions = []string{"v3", "v4"}
+
+// TaskRules describes who may reach the task metadata endpoints of a task.
+type TaskRules struct {
+	TaskARN string
+	// EndpointIDs are the v3/v4 metadata endpoint IDs of the task's containers.
+	EndpointIDs []string
+	// SourceIPs are the addresses of the task's containers.
+	SourceIPs []string
+}
+
+// Firewall installs and removes the rules of tasks. The rules are read back from the
+// host rather than from memory when they are removed, so rules left behind by a
+// previous run of the agent are cleaned up too.
+type Firewall struct {
+	executor RuleExecutor
+	port     int
+
+	lock        sync.Mutex
+	initialized bool
+	installed   map[string]TaskRules
+}
+
+// NewFirewall creates a firewall that restricts requests to the task metadata server
+// listening on the port of the loopback address.
+func NewFirewall(executor RuleExecutor, port int) *Firewall {
+	return &Firewall{
+		executor:  executor,
+		port:      port,
+		installed: make(map[string]TaskRules),
+	}
+}
+
+// Backend returns the netfilter backend the rules are installed with.
+func (f *Firewall) Backend() string {
+	return f.executor.Backend()
+}
+
+// Sync installs the rules of a task, replacing the rules installed for it before. The
+// rules of the task are removed if it has no endpoint IDs or addresses yet. Partially
+// installed rules are removed if the installation fails.
+func (f *Firewall) Sync(rules TaskRules) error {
+	rules = normalize(rules)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if installed, ok := f.installed[rules.TaskARN]; ok && reflect.DeepEqual(installed, rules) {
+		return nil
+	}
+	if err := f.initUnsafe(); err != nil {
+		return err
+	}
+	if err := f.removeUnsafe(rules.TaskARN); err != nil {
+		return err
+	}
+	if len(rules.EndpointIDs) == 0 || len(rules.SourceIPs) == 0 {
+		return nil
+	}
+	if err := f.installUnsafe(rules); err != nil {
+		if cleanupErr := f.removeUnsafe(rules.TaskARN); cleanupErr != nil {
+			logger.Warn("Unable to remove partially installed task metadata firewall rules", logger.Fields{
+				field.TaskARN: rules.TaskARN,
+				field.Error:   cleanupErr,
+			})
+		}
+		return err
+	}
+	f.installed[rules.TaskARN] = rules
+	return nil
+}
+
+// Remove removes the rules of a task. It's a no-op if the task has no rules.
+func (f *Firewall) Remove(taskARN string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.removeUnsafe(taskARN)
+}
+
+// Reconcile removes the rules of all tasks other than the active ones, including rules
+// left behind by a previous run of the agent, and forgets which rules were installed so
+// that the next Sync of an active task installs its rules afresh.
+func (f *Firewall) Reconcile(activeTaskARNs []string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.initUnsafe(); err != nil {
+		return err
+	}
+	active := make(map[string]bool, len(activeTaskARNs))
+	for _, taskARN := range activeTaskARNs {
+		active[taskChain(taskARN)] = true
+	}
+	output, err := f.executor.Run("-t", filterTable, listRules)
+	if err != nil {
+		return err
+	}
+	for _, spec := range ruleSpecs(output) {
+		if len(spec) == 2 && spec[0] == newChain && strings.HasPrefix(spec[1], taskChainPrefix) && !active[spec[1]] {
+			if err := f.removeChainUnsafe(spec[1]); err != nil {
+				return err
+			}
+		}
+	}
+	f.installed = make(map[string]TaskRules)
+	return nil
+}
+
+// initUnsafe creates the parent chain and the jump to it from the INPUT chain.
+func (f *Firewall) initUnsafe() error {
+	if f.initialized {
+		return nil
+	}
+	if !f.chainExists(parentChain) {
+		if _, err := f.executor.Run("-t", filterTable, newChain, parentChain); err != nil {
+			return err
+		}
+	}
+	jump := append([]string{"-t", filterTable, "-C", inputChain}, f.parentJumpSpec()...)
+	if _, err := f.executor.Run(jump...); err != nil {
+		insert := append([]string{"-t", filterTable, "-I", inputChain, "1"}, f.parentJumpSpec()...)
+		if _, err := f.executor.Run(insert...); err != nil {
+			return err
+		}
+	}
+	f.initialized = true
+	logger.Info("Initialized task metadata firewall", logger.Fields{
+		"backend": f.executor.Backend(),
+	})
+	return nil
+}
+
+func (f *Firewall) installUnsafe(rules TaskRules) error {
+	chain := taskChain(rules.TaskARN)
+	commands := [][]string{{newChain, chain}}
+	for _, sourceIP := range rules.SourceIPs {
+		commands = append(commands, []string{appendRule, chain, "-s", sourceIP, targetFlag, targetReturn})
+	}
+	commands = append(commands, []string{appendRule, chain, targetFlag, targetDrop})
+	for _, endpointID := range rules.EndpointIDs {
+		for _, version := range metadataVersions {
+			commands = append(commands, []string{appendRule, parentChain, "-p", "tcp",
+				"-m", "string", "--algo", "bm", stringFlag, "/" + version + "/" + endpointID, targetFlag, chain})
+		}
+	}
+	for _, command := range commands {
+		if _, err := f.executor.Run(append([]string{"-t", filterTable}, command...)...); err != nil {
+			return err
+		}
+	}
+	logger.Info("Installed task metadata firewall rules", logger.Fields{
+		field.TaskARN: rules.TaskARN,
+		"chain":       chain,
+		"sourceIPs":   strings.Join(rules.SourceIPs, ","),
+	})
+	return nil
+}
+
+func (f *Firewall) removeUnsafe(taskARN string) error {
+	if err := f.removeChainUnsafe(taskChain(taskARN)); err != nil {
+		return err
+	}
+	delete(f.installed, taskARN)
+	return nil
+}
+
+// removeChainUnsafe deletes the jumps to a task chain from the parent chain, and then
+// the task chain itself.
+func (f *Firewall) removeChainUnsafe(chain string) error {
+	if output, err := f.executor.Run("-t", filterTable, listRules, parentChain); err == nil {
+		for _, spec := range ruleSpecs(output) {
+			if len(spec) < 2 || spec[0] != appendRule || spec[1] != parentChain || !jumpsTo(spec, chain) {
+				continue
+			}
+			if _, err := f.executor.Run(append([]string{"-t", filterTable, "-D", parentChain}, spec[2:]...)...); err != nil {
+				return err
+			}
+		}
+	}
+	if !f.chainExists(chain) {
+		return nil
+	}
+	if _, err := f.executor.Run("-t", filterTable, "-F", chain); err != nil {
+		return err
+	}
+	if _, err := f.executor.Run("-t", filterTable, "-X", chain); err != nil {
+		return err
+	}
+	logger.Info("Removed task metadata firewall rules", logger.Fields{
+		"chain": chain,
+	})
+	return nil
+}
+
+func (f *Firewall) chainExists(chain string) bool {
+	_, err := f.executor.Run("-t", filterTable, listRules, chain)
+	return err == nil
+}
+
+func (f *Firewall) parentJumpSpec() []string {
+	return []string{"-d", loopbackIPv4, "-p", "tcp", "--dport", strconv.Itoa(f.port), targetFlag, parentChain}
+}
+
+// taskChain returns the name of the chain of a task.
+func taskChain(taskARN string) string {
+	sum := sha256.Sum256([]byte(taskARN))
+	return taskChainPrefix + hex.EncodeToString(sum[:])[:taskChainHashLength]
+}
+
+// normalize sorts and deduplicates the endpoint IDs and addresses so that rules can
+// be compared.
+func normalize(rules TaskRules) TaskRules {
+	return TaskRules{
+		TaskARN:     rules.TaskARN,
+		EndpointIDs: sortedUnique(rules.EndpointIDs),
+		SourceIPs:   sortedUnique(rules.SourceIPs),
+	}
+}
+
+func sortedUnique(values []string) []string {
+	var result []string
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func jumpsTo(spec []string, chain string) bool {
+	for i := 0; i < len(spec)-1; i++ {
+		if spec[i] == targetFlag && spec[i+1] == chain {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleSpecs splits the output of iptables -S into the arguments of each rule. Quoted
+// arguments, such as the strings matched by the string extension, are unquoted.
+func ruleSpecs(output string) [][]string {
+	var specs [][]string
+	for _, line := range strings.Split(output, "\n") {
+		var spec []string
+		var current strings.Builder
+		inQuotes, hasArg := false, false
+		for _, r := range strings.TrimSpace(line) {
+			switch {
+			case r == '"':
+				inQuotes = !inQuotes
+				hasArg = true
+			case r == ' ' && !inQuotes:
+				if hasArg {
+					spec = append(spec, current.String())
+					current.Reset()
+					hasArg = false
+				}
+			default:
+				current.WriteRune(r)
+				hasArg = true
+			}
+		}
+		if hasArg {
+			spec = append(spec, current.String())
+		}
+		if len(spec) > 0 {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
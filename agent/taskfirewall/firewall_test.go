@@ -0,0 +1,308 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package taskfirewall
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	taskARN1  = "arn:aws:ecs:us-west-2:123456789012:task/cluster/task1"
+	taskARN2  = "arn:aws:ecs:us-west-2:123456789012:task/cluster/task2"
+	tmdsPort  = 51679
+	parentJmp = "-d 127.0.0.1 -p tcp --dport 51679 -j ECS_TMDS"
+)
+
+// fakeExecutor keeps the chains of the filter table in memory and rejects commands
+// the way iptables does, so that leaked or duplicated rules show up in its state.
+type fakeExecutor struct {
+	chains   map[string][]string
+	commands int
+	failOn   string
+}
+
+func newFakeExecutor() *fakeExecutor {
+	return &fakeExecutor{chains: map[string][]string{inputChain: nil}}
+}
+
+func (e *fakeExecutor) Backend() string {
+	return BackendNFTables
+}
+
+func (e *fakeExecutor) Run(args ...string) (string, error) {
+	e.commands++
+	command := strings.Join(args, " ")
+	if e.failOn != "" && strings.Contains(command, e.failOn) {
+		return "", fmt.Errorf("injected failure: %s", command)
+	}
+	if len(args) < 3 || args[0] != "-t" || args[1] != filterTable {
+		return "", fmt.Errorf("unexpected command: %s", command)
+	}
+	action, args := args[2], args[3:]
+	if action == listRules && len(args) == 0 {
+		return e.list(e.chainNames()...), nil
+	}
+	chain := args[0]
+	rules, exists := e.chains[chain]
+	if !exists && action != newChain {
+		return "", fmt.Errorf("iptables: No chain/target/match by that name")
+	}
+	spec := strings.Join(args[1:], " ")
+	switch action {
+	case newChain:
+		if exists {
+			return "", fmt.Errorf("iptables: Chain already exists")
+		}
+		e.chains[chain] = nil
+	case "-X":
+		if len(rules) > 0 || e.referenced(chain) {
+			return "", fmt.Errorf("iptables: Directory not empty")
+		}
+		delete(e.chains, chain)
+	case "-F":
+		e.chains[chain] = nil
+	case appendRule, "-I":
+		if target := jumpTarget(args[1:]); target != "" && target != targetDrop && target != targetReturn {
+			if _, ok := e.chains[target]; !ok {
+				return "", fmt.Errorf("iptables: Couldn't load target `%s'", target)
+			}
+		}
+		if action == appendRule {
+			e.chains[chain] = append(rules, spec)
+		} else {
+			e.chains[chain] = append([]string{strings.TrimPrefix(spec, "1 ")}, rules...)
+		}
+	case "-D", "-C":
+		for i, rule := range rules {
+			if rule == spec {
+				if action == "-D" && len(rules) == 1 {
+					e.chains[chain] = nil
+				} else if action == "-D" {
+					e.chains[chain] = append(rules[:i:i], rules[i+1:]...)
+				}
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("iptables: Bad rule (does a matching rule exist in that chain?)")
+	case listRules:
+		return e.list(chain), nil
+	default:
+		return "", fmt.Errorf("unexpected command: %s", command)
+	}
+	return "", nil
+}
+
+func (e *fakeExecutor) chainNames() []string {
+	var names []string
+	for name := range e.chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// list prints the chains like iptables -S, quoting the matched strings.
+func (e *fakeExecutor) list(chains ...string) string {
+	var lines []string
+	for _, chain := range chains {
+		if chain == inputChain {
+			lines = append(lines, "-P INPUT ACCEPT")
+		} else {
+			lines = append(lines, newChain+" "+chain)
+		}
+	}
+	for _, chain := range chains {
+		for _, rule := range e.chains[chain] {
+			fields := strings.Fields(rule)
+			for i := range fields {
+				if i > 0 && fields[i-1] == stringFlag {
+					fields[i] = `"` + fields[i] + `"`
+				}
+			}
+			lines = append(lines, appendRule+" "+chain+" "+strings.Join(fields, " "))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (e *fakeExecutor) referenced(chain string) bool {
+	for _, rules := range e.chains {
+		for _, rule := range rules {
+			if jumpTarget(strings.Fields(rule)) == chain {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jumpTarget(spec []string) string {
+	for i := 0; i < len(spec)-1; i++ {
+		if spec[i] == targetFlag {
+			return spec[i+1]
+		}
+	}
+	return ""
+}
+
+// initializedState is the state of the filter table without the rules of any task.
+func initializedState() map[string][]string {
+	return map[string][]string{
+		inputChain:  {parentJmp},
+		parentChain: nil,
+	}
+}
+
+func task1Rules() TaskRules {
+	return TaskRules{
+		TaskARN:     taskARN1,
+		EndpointIDs: []string{"endpoint-b", "endpoint-a"},
+		SourceIPs:   []string{"172.17.0.3", "172.17.0.2", "172.17.0.3"},
+	}
+}
+
+func task2Rules() TaskRules {
+	return TaskRules{
+		TaskARN:     taskARN2,
+		EndpointIDs: []string{"endpoint-c"},
+		SourceIPs:   []string{"172.17.0.4"},
+	}
+}
+
+func TestTaskChain(t *testing.T) {
+	chain := taskChain(taskARN1)
+	assert.True(t, strings.HasPrefix(chain, taskChainPrefix))
+	assert.LessOrEqual(t, len(chain), 28)
+	assert.Equal(t, chain, taskChain(taskARN1))
+	assert.NotEqual(t, chain, taskChain(taskARN2))
+}
+
+func TestSyncAndRemove(t *testing.T) {
+	executor := newFakeExecutor()
+	firewall := NewFirewall(executor, tmdsPort)
+
+	require.NoError(t, firewall.Sync(task1Rules()))
+	chain := taskChain(taskARN1)
+	assert.Equal(t, []string{
+		"-s 172.17.0.2 -j RETURN",
+		"-s 172.17.0.3 -j RETURN",
+		"-j DROP",
+	}, executor.chains[chain])
+	assert.Equal(t, []string{
+		"-p tcp -m string --algo bm --string /v3/endpoint-a -j " + chain,
+		"-p tcp -m string --algo bm --string /v4/endpoint-a -j " + chain,
+		"-p tcp -m string --algo bm --string /v3/endpoint-b -j " + chain,
+		"-p tcp -m string --algo bm --string /v4/endpoint-b -j " + chain,
+	}, executor.chains[parentChain])
+	assert.Equal(t, []string{parentJmp}, executor.chains[inputChain])
+
+	// Syncing the same rules again doesn't touch the host
+	commands := executor.commands
+	require.NoError(t, firewall.Sync(task1Rules()))
+	assert.Equal(t, commands, executor.commands)
+
+	require.NoError(t, firewall.Remove(taskARN1))
+	assert.Equal(t, initializedState(), executor.chains)
+	require.NoError(t, firewall.Remove(taskARN1), "removing twice is a no-op")
+	assert.Equal(t, initializedState(), executor.chains)
+}
+
+func TestSyncReplacesRules(t *testing.T) {
+	executor := newFakeExecutor()
+	firewall := NewFirewall(executor, tmdsPort)
+
+	rules := task2Rules()
+	require.NoError(t, firewall.Sync(rules))
+	rules.SourceIPs = append(rules.SourceIPs, "172.17.0.5")
+	require.NoError(t, firewall.Sync(rules))
+
+	chain := taskChain(taskARN2)
+	assert.Equal(t, []string{
+		"-s 172.17.0.4 -j RETURN",
+		"-s 172.17.0.5 -j RETURN",
+		"-j DROP",
+	}, executor.chains[chain])
+	assert.Len(t, executor.chains[parentChain], 2)
+
+	// Without addresses, there is nothing to allow and the rules are removed
+	rules.SourceIPs = nil
+	require.NoError(t, firewall.Sync(rules))
+	assert.Equal(t, initializedState(), executor.chains)
+}
+
+func TestSyncFailureRemovesPartialRules(t *testing.T) {
+	executor := newFakeExecutor()
+	firewall := NewFirewall(executor, tmdsPort)
+	require.NoError(t, firewall.Sync(task2Rules()))
+
+	executor.failOn = "/v4/endpoint-b"
+	assert.Error(t, firewall.Sync(task1Rules()))
+	_, exists := executor.chains[taskChain(taskARN1)]
+	assert.False(t, exists)
+	assert.Len(t, executor.chains[parentChain], 2, "rules of other tasks are kept")
+
+	// The failed rules are retried on the next sync
+	executor.failOn = ""
+	require.NoError(t, firewall.Sync(task1Rules()))
+	assert.Len(t, executor.chains[parentChain], 6)
+}
+
+func TestReconcileAfterCrash(t *testing.T) {
+	executor := newFakeExecutor()
+	firewall := NewFirewall(executor, tmdsPort)
+	require.NoError(t, firewall.Sync(task1Rules()))
+	require.NoError(t, firewall.Sync(task2Rules()))
+
+	// The agent restarts with the rules still installed, and only task 2 is still running
+	restarted := NewFirewall(executor, tmdsPort)
+	require.NoError(t, restarted.Reconcile([]string{taskARN2}))
+	_, exists := executor.chains[taskChain(taskARN1)]
+	assert.False(t, exists)
+	assert.Equal(t, []string{parentJmp}, executor.chains[inputChain], "the jump to the parent chain isn't duplicated")
+
+	require.NoError(t, restarted.Sync(task2Rules()))
+	assert.Equal(t, []string{"-s 172.17.0.4 -j RETURN", "-j DROP"}, executor.chains[taskChain(taskARN2)])
+	assert.Len(t, executor.chains[parentChain], 2, "the rules of task 2 aren't duplicated")
+
+	require.NoError(t, restarted.Remove(taskARN2))
+	assert.Equal(t, initializedState(), executor.chains)
+}
+
+func TestRemoveAfterCrash(t *testing.T) {
+	executor := newFakeExecutor()
+	firewall := NewFirewall(executor, tmdsPort)
+	require.NoError(t, firewall.Sync(task1Rules()))
+
+	// Rules of a previous run are removed even though this run never installed them
+	restarted := NewFirewall(executor, tmdsPort)
+	require.NoError(t, restarted.Remove(taskARN1))
+	assert.Equal(t, initializedState(), executor.chains)
+}
+
+func TestRuleSpecs(t *testing.T) {
+	specs := ruleSpecs("-N ECS_TMDS\n-A ECS_TMDS -p tcp -m string --string \"/v3/a b\" --algo bm --to 65535 -j ECS_TMDS_0\n\n")
+	assert.Equal(t, [][]string{
+		{"-N", "ECS_TMDS"},
+		{"-A", "ECS_TMDS", "-p", "tcp", "-m", "string", "--string", "/v3/a b", "--algo", "bm", "--to", "65535", "-j", "ECS_TMDS_0"},
+	}, specs)
+}
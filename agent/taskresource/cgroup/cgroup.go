@@ -40,6 +40,14 @@ import (
 )
 
 const (
+	// CPUBurstModeIdle is the CPU burst mode of burst-only tasks whose cgroup v2 is marked
+	// idle, so that the task only runs on CPU that other tasks leave idle
+	CPUBurstModeIdle = "idle"
+	// CPUBurstModeMinimumWeight is the CPU burst mode of burst-only tasks that only have the
+	// minimum CPU weight, because the host doesn't support idle cgroups
+	CPUBurstModeMinimumWeight = "minimum-weight"
+
+	cpuIdle                   = "cpu.idle"
 	memorySubsystem           = "/memory"
 	memoryUseHierarchy        = "memory.use_hierarchy"
 	rootReadOnlyPermissions   = os.FileMode(400)
@@ -49,6 +57,7 @@ const (
 
 var (
 	enableMemoryHierarchy = []byte(strconv.Itoa(1))
+	enableCPUIdle         = []byte(strconv.Itoa(1))
 )
 
 // CgroupResource represents Cgroup resource
@@ -58,6 +67,8 @@ type CgroupResource struct {
 	cgroupRoot          string
 	cgroupMountPath     string
 	resourceSpec        specs.LinuxResources
+	cpuBurstOnly        bool
+	cpuBurstMode        string
 	ioutil              ioutilwrapper.IOUtil
 	createdAt           time.Time
 	desiredStatusUnsafe resourcestatus.ResourceStatus
@@ -93,6 +104,22 @@ func NewCgroupResource(
 	return c
 }
 
+// SetCPUBurstOnly sets whether the task is burst-only, so that the task cgroup is
+// configured for the task to only use idle CPU when it's created
+func (cgroup *CgroupResource) SetCPUBurstOnly(cpuBurstOnly bool) {
+	cgroup.lock.Lock()
+	defer cgroup.lock.Unlock()
+	cgroup.cpuBurstOnly = cpuBurstOnly
+}
+
+// GetCPUBurstMode returns how the task cgroup was configured for the task to only use idle
+// CPU, which is empty if the task isn't burst-only or the cgroup isn't created yet
+func (cgroup *CgroupResource) GetCPUBurstMode() string {
+	cgroup.lock.RLock()
+	defer cgroup.lock.RUnlock()
+	return cgroup.cpuBurstMode
+}
+
 // GetTerminalReason returns an error string to propagate up through to task
 // state change messages
 func (cgroup *CgroupResource) GetTerminalReason() string {
@@ -294,9 +321,37 @@ func (cgroup *CgroupResource) setupTaskCgroup() error {
 		}
 	}
 
+	cgroup.lock.Lock()
+	defer cgroup.lock.Unlock()
+	if cgroup.cpuBurstOnly {
+		cgroup.cpuBurstMode = cgroup.setupCPUBurstOnly(cgroupRoot)
+	}
 	return nil
 }
 
+// setupCPUBurstOnly marks the cgroup v2 of a burst-only task idle, and returns the CPU
+// burst mode of the task. The resource spec of burst-only tasks has the minimum CPU
+// shares, which is the minimum weight on cgroup v2, so the task falls back to the minimum
+// weight on hosts that don't support idle cgroups, which are introduced by cgroup v2 on
+// Linux 5.15.
+func (cgroup *CgroupResource) setupCPUBurstOnly(cgroupRoot string) string {
+	if !config.CgroupV2 {
+		seelog.Warnf("Idle cgroups require cgroup v2, the burst-only task falls back to the minimum CPU shares taskARN=%s cgroupPath=%s", cgroup.taskARN, cgroupRoot)
+		return CPUBurstModeMinimumWeight
+	}
+	cpuIdlePath := filepath.Join(cgroup.cgroupMountPath, config.DefaultTaskCgroupV2Prefix+".slice", cgroupRoot, cpuIdle)
+	if _, err := os.Stat(cpuIdlePath); err != nil {
+		seelog.Warnf("Idle cgroups are not supported by the kernel, the burst-only task falls back to the minimum CPU weight taskARN=%s cgroupPath=%s err=%v", cgroup.taskARN, cgroupRoot, err)
+		return CPUBurstModeMinimumWeight
+	}
+	if err := cgroup.ioutil.WriteFile(cpuIdlePath, enableCPUIdle, rootReadOnlyPermissions); err != nil {
+		seelog.Warnf("Unable to mark the cgroup of the burst-only task idle, the task falls back to the minimum CPU weight taskARN=%s cgroupPath=%s err=%v", cgroup.taskARN, cgroupRoot, err)
+		return CPUBurstModeMinimumWeight
+	}
+	seelog.Infof("Marked the cgroup of the burst-only task idle taskARN=%s cgroupPath=%s", cgroup.taskARN, cgroupRoot)
+	return CPUBurstModeIdle
+}
+
 // Cleanup removes the cgroup root created for the task
 func (cgroup *CgroupResource) Cleanup() error {
 	err := cgroup.control.Remove(cgroup.cgroupRoot)
@@ -319,6 +374,8 @@ type cgroupResourceJSON struct {
 	DesiredStatus   *CgroupStatus        `json:"desiredStatus"`
 	KnownStatus     *CgroupStatus        `json:"knownStatus"`
 	LinuxSpec       specs.LinuxResources `json:"resourceSpec"`
+	CPUBurstOnly    bool                 `json:"cpuBurstOnly,omitempty"`
+	CPUBurstMode    string               `json:"cpuBurstMode,omitempty"`
 }
 
 // MarshalJSON marshals CgroupResource object using duplicate struct CgroupResourceJSON
@@ -341,6 +398,8 @@ func (cgroup *CgroupResource) MarshalJSON() ([]byte, error) {
 			return &status
 		}(),
 		cgroup.resourceSpec,
+		cgroup.cpuBurstOnly,
+		cgroup.GetCPUBurstMode(),
 	})
 }
 
@@ -355,6 +414,8 @@ func (cgroup *CgroupResource) UnmarshalJSON(b []byte) error {
 	cgroup.cgroupRoot = temp.CgroupRoot
 	cgroup.cgroupMountPath = temp.CgroupMountPath
 	cgroup.resourceSpec = temp.LinuxSpec
+	cgroup.cpuBurstOnly = temp.CPUBurstOnly
+	cgroup.cpuBurstMode = temp.CPUBurstMode
 	if temp.DesiredStatus != nil {
 		cgroup.SetDesiredStatus(resourcestatus.ResourceStatus(*temp.DesiredStatus))
 	}
@@ -19,6 +19,8 @@ package cgroup
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -26,10 +28,12 @@ import (
 	cgroup "github.com/aws/amazon-ecs-agent/agent/taskresource/cgroup/control"
 	"github.com/aws/amazon-ecs-agent/agent/taskresource/cgroup/control/mock_control"
 	resourcestatus "github.com/aws/amazon-ecs-agent/agent/taskresource/status"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ioutilwrapper"
 	mock_ioutilwrapper "github.com/aws/amazon-ecs-agent/agent/utils/ioutilwrapper/mocks"
 	"github.com/containerd/cgroups"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/golang/mock/gomock"
 )
@@ -202,3 +206,112 @@ func TestUnmarshal(t *testing.T) {
 	assert.Equal(t, resourcestatus.ResourceStatus(CgroupCreated), unmarshalledCgroup.GetDesiredStatus())
 	assert.Equal(t, resourcestatus.ResourceStatus(CgroupStatusNone), unmarshalledCgroup.GetKnownStatus())
 }
+
+// setCgroupV2 sets whether the host uses cgroup v2 and returns a func that restores it
+func setCgroupV2(cgroupV2 bool) func() {
+	previous := config.CgroupV2
+	config.CgroupV2 = cgroupV2
+	return func() {
+		config.CgroupV2 = previous
+	}
+}
+
+// TestCreateCPUBurstOnlyIdle checks that the cgroup v2 of burst-only tasks is marked idle
+// on a synthetic cgroup tree whose kernel supports idle cgroups
+func TestCreateCPUBurstOnlyIdle(t *testing.T) {
+	defer setCgroupV2(true)()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mountPath := t.TempDir()
+	cgroupRoot := fmt.Sprintf("ecstasks-%s.slice", taskID)
+	cgroupPath := filepath.Join(mountPath, "ecstasks.slice", cgroupRoot)
+	mockControl := mock_control.NewMockControl(ctrl)
+	mockControl.EXPECT().Exists(cgroupRoot).Return(false)
+	mockControl.EXPECT().Create(gomock.Any()).DoAndReturn(func(*cgroup.Spec) error {
+		// The kernel creates the interface files of the cgroup
+		require.NoError(t, os.MkdirAll(cgroupPath, 0755))
+		return os.WriteFile(filepath.Join(cgroupPath, "cpu.idle"), []byte("0\n"), 0644)
+	})
+
+	cgroupResource := NewCgroupResource("taskArn", mockControl, ioutilwrapper.NewIOUtil(), cgroupRoot, mountPath, specs.LinuxResources{})
+	cgroupResource.SetCPUBurstOnly(true)
+	require.NoError(t, cgroupResource.Create())
+	cpuIdle, err := os.ReadFile(filepath.Join(cgroupPath, "cpu.idle"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(cpuIdle))
+	assert.Equal(t, CPUBurstModeIdle, cgroupResource.GetCPUBurstMode())
+}
+
+// TestCreateCPUBurstOnlyFallback checks that burst-only tasks fall back to the minimum
+// weight on synthetic cgroup trees of hosts that don't support idle cgroups
+func TestCreateCPUBurstOnlyFallback(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cgroupV2 bool
+	}{
+		{name: "cgroup v2 without cpu.idle", cgroupV2: true},
+		{name: "cgroup v1", cgroupV2: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setCgroupV2(tc.cgroupV2)()
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mountPath := t.TempDir()
+			cgroupRoot := fmt.Sprintf("ecstasks-%s.slice", taskID)
+			cgroupPath := filepath.Join(mountPath, "ecstasks.slice", cgroupRoot)
+			if !tc.cgroupV2 {
+				cgroupRoot = fmt.Sprintf("/ecs/%s", taskID)
+				cgroupPath = filepath.Join(mountPath, "memory", cgroupRoot)
+			}
+			mockControl := mock_control.NewMockControl(ctrl)
+			mockControl.EXPECT().Exists(cgroupRoot).Return(false)
+			mockControl.EXPECT().Create(gomock.Any()).DoAndReturn(func(*cgroup.Spec) error {
+				return os.MkdirAll(cgroupPath, 0755)
+			})
+
+			cgroupResource := NewCgroupResource("taskArn", mockControl, ioutilwrapper.NewIOUtil(), cgroupRoot, mountPath, specs.LinuxResources{})
+			cgroupResource.SetCPUBurstOnly(true)
+			require.NoError(t, cgroupResource.Create())
+			assert.NoFileExists(t, filepath.Join(cgroupPath, "cpu.idle"))
+			assert.Equal(t, CPUBurstModeMinimumWeight, cgroupResource.GetCPUBurstMode())
+		})
+	}
+}
+
+func TestCreateNotCPUBurstOnly(t *testing.T) {
+	defer setCgroupV2(true)()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mountPath := t.TempDir()
+	cgroupRoot := fmt.Sprintf("ecstasks-%s.slice", taskID)
+	cgroupPath := filepath.Join(mountPath, "ecstasks.slice", cgroupRoot)
+	mockControl := mock_control.NewMockControl(ctrl)
+	mockControl.EXPECT().Exists(cgroupRoot).Return(false)
+	mockControl.EXPECT().Create(gomock.Any()).DoAndReturn(func(*cgroup.Spec) error {
+		require.NoError(t, os.MkdirAll(cgroupPath, 0755))
+		return os.WriteFile(filepath.Join(cgroupPath, "cpu.idle"), []byte("0\n"), 0644)
+	})
+
+	cgroupResource := NewCgroupResource("taskArn", mockControl, ioutilwrapper.NewIOUtil(), cgroupRoot, mountPath, specs.LinuxResources{})
+	require.NoError(t, cgroupResource.Create())
+	cpuIdle, err := os.ReadFile(filepath.Join(cgroupPath, "cpu.idle"))
+	require.NoError(t, err)
+	assert.Equal(t, "0\n", string(cpuIdle))
+	assert.Empty(t, cgroupResource.GetCPUBurstMode())
+}
+
+func TestMarshalCPUBurstMode(t *testing.T) {
+	cgroupResource := NewCgroupResource("", nil, nil, "ecstasks-taskid.slice", "/sys/fs/cgroup", specs.LinuxResources{})
+	cgroupResource.SetCPUBurstOnly(true)
+	cgroupResource.cpuBurstMode = CPUBurstModeIdle
+	bytes, err := cgroupResource.MarshalJSON()
+	require.NoError(t, err)
+
+	unmarshalledCgroup := &CgroupResource{}
+	require.NoError(t, unmarshalledCgroup.UnmarshalJSON(bytes))
+	assert.True(t, unmarshalledCgroup.cpuBurstOnly)
+	assert.Equal(t, CPUBurstModeIdle, unmarshalledCgroup.GetCPUBurstMode())
+}
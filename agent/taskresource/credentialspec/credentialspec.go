@@ -73,6 +73,13 @@ type CredentialSpecResourceCommon struct {
 	// Example item := arn:aws:ssm:us-east-1:XXXXXXXXXXXXX:parameter/x/y/c:container-sql
 	// This stores the map of a credential spec to corresponding container name
 	credentialSpecContainerMap map[string]string
+	// lifecycleState, lifecycleReason and lifecycleUpdatedAt track fetching and
+	// renewing the credential specs, see LifecycleStatus
+	lifecycleState     string
+	lifecycleReason    string
+	lifecycleUpdatedAt time.Time
+	// renewalWarning is set when the last renewal of the credential specs failed
+	renewalWarning bool
 	// lock is used for fields that are accessed and updated concurrently
 	lock sync.RWMutex
 }
@@ -90,7 +97,7 @@ func (cs *CredentialSpecResource) Initialize(resourceFields *taskresource.Resour
 
 func (cs *CredentialSpecResource) initStatusToTransition() {
 	resourceStatusToTransitionFunction := map[resourcestatus.ResourceStatus]func() error{
-		resourcestatus.ResourceStatus(CredentialSpecCreated): cs.Create,
+		resourcestatus.ResourceStatus(CredentialSpecCreated): cs.create,
 	}
 	cs.resourceStatusToTransitionFunction = resourceStatusToTransitionFunction
 }
@@ -274,6 +281,7 @@ type CredentialSpecResourceJSONCommon struct {
 	CredentialSpecContainerMap map[string]string     `json:"CredentialSpecContainerMap"`
 	CredSpecMap                map[string]string     `json:"CredSpecMap"`
 	ExecutionCredentialsID     string                `json:"executionCredentialsID"`
+	Lifecycle                  *LifecycleStatus      `json:"lifecycle,omitempty"`
 }
 
 // MarshalJSON serialises the CredentialSpecResourceJSON struct to JSON
@@ -300,6 +308,13 @@ func (cs *CredentialSpecResource) MarshalJSON() ([]byte, error) {
 			CredentialSpecContainerMap: cs.credentialSpecContainerMap,
 			CredSpecMap:                cs.getCredSpecMap(),
 			ExecutionCredentialsID:     cs.getExecutionCredentialsID(),
+			Lifecycle: func() *LifecycleStatus {
+				lifecycle := cs.GetLifecycleStatus()
+				if lifecycle.State == "" {
+					return nil
+				}
+				return &lifecycle
+			}(),
 		},
 	}
 	cs.MarshallPlatformSpecificFields(&credentialSpecResourceJSON)
@@ -344,6 +359,14 @@ func (cs *CredentialSpecResource) UnmarshalJSON(b []byte) error {
 	}
 	cs.taskARN = temp.TaskARN
 	cs.executionCredentialsID = temp.ExecutionCredentialsID
+	if temp.Lifecycle != nil {
+		cs.lifecycleState = temp.Lifecycle.State
+		cs.lifecycleReason = temp.Lifecycle.Reason
+		cs.renewalWarning = temp.Lifecycle.RenewalWarning
+		if temp.Lifecycle.UpdatedAt != nil {
+			cs.lifecycleUpdatedAt = *temp.Lifecycle.UpdatedAt
+		}
+	}
 	cs.UnmarshallPlatformSpecificFields(temp)
 
 	return nil
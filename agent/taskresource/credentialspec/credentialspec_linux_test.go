@@ -954,3 +954,78 @@ func TestUpdateRegionForTaskMaliformedInput(t *testing.T) {
 	err := cs.UpdateRegionFromTask()
 	assert.Error(t, err)
 }
+
+func TestCreateTracksLifecycleOnFetchFailure(t *testing.T) {
+	testCases := []struct {
+		name           string
+		credentialSpec string
+		location       string
+		setExpect      func(ctrl *gomock.Controller, ssmClientCreator *mockfactory.MockSSMClientCreator,
+			s3ClientCreator *mock_s3_factory.MockS3ClientCreator)
+	}{
+		{
+			name:           "SSM",
+			credentialSpec: "credentialspec:arn:aws:ssm:us-west-2:123456789012:parameter/test",
+			location:       "arn:aws:ssm:us-west-2:123456789012:parameter/test",
+			setExpect: func(ctrl *gomock.Controller, ssmClientCreator *mockfactory.MockSSMClientCreator,
+				s3ClientCreator *mock_s3_factory.MockS3ClientCreator) {
+				mockSSMClient := mockssmiface.NewMockSSMClient(ctrl)
+				ssmClientCreator.EXPECT().NewSSMClient(gomock.Any(), gomock.Any()).Return(mockSSMClient)
+				mockSSMClient.EXPECT().GetParameters(gomock.Any()).Return(nil, errors.New("test-error"))
+			},
+		},
+		{
+			name:           "S3",
+			credentialSpec: "credentialspec:arn:aws:s3:::gmsacredspec/contoso_webapp01.json",
+			location:       "arn:aws:s3:::gmsacredspec/contoso_webapp01.json",
+			setExpect: func(ctrl *gomock.Controller, ssmClientCreator *mockfactory.MockSSMClientCreator,
+				s3ClientCreator *mock_s3_factory.MockS3ClientCreator) {
+				mockS3Client := mock_s3.NewMockS3Client(ctrl)
+				s3ClientCreator.EXPECT().NewS3Client(gomock.Any(), gomock.Any()).Return(mockS3Client)
+				mockS3Client.EXPECT().GetObject(gomock.Any()).Return(nil, errors.New("test-error"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			credentialsManager := mockcredentials.NewMockManager(ctrl)
+			ssmClientCreator := mockfactory.NewMockSSMClientCreator(ctrl)
+			s3ClientCreator := mock_s3_factory.NewMockS3ClientCreator(ctrl)
+
+			cs := &CredentialSpecResource{
+				CredentialSpecResourceCommon: &CredentialSpecResourceCommon{
+					knownStatusUnsafe:          resourcestatus.ResourceCreated,
+					desiredStatusUnsafe:        resourcestatus.ResourceCreated,
+					CredSpecMap:                map[string]string{},
+					taskARN:                    taskARN,
+					credentialSpecContainerMap: map[string]string{tc.credentialSpec: "webapp"},
+				},
+				ServiceAccountInfoMap: map[string]ServiceAccountInfo{},
+			}
+			cs.Initialize(&taskresource.ResourceFields{
+				ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
+					SSMClientCreator:   ssmClientCreator,
+					S3ClientCreator:    s3ClientCreator,
+					CredentialsManager: credentialsManager,
+				},
+			}, apitaskstatus.TaskStatusNone, apitaskstatus.TaskRunning)
+
+			credentialsManager.EXPECT().GetTaskCredentials(gomock.Any()).Return(credentials.TaskIAMRoleCredentials{
+				IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: "test-cred-id"},
+			}, true)
+			tc.setExpect(ctrl, ssmClientCreator, s3ClientCreator)
+
+			assert.Error(t, cs.create())
+			status := cs.GetLifecycleStatus()
+			assert.Equal(t, LifecycleFailed, status.State)
+			assert.Contains(t, status.Reason, "test-error")
+			assert.Equal(t, []string{tc.location}, status.Locations)
+			assert.NotNil(t, status.UpdatedAt)
+			assert.False(t, status.RenewalWarning)
+		})
+	}
+}
@@ -17,11 +17,13 @@
 package credentialspec
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	resourcestatus "github.com/aws/amazon-ecs-agent/agent/taskresource/status"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetResourceName(t *testing.T) {
@@ -105,3 +107,42 @@ func TestMarshallandUnMarshallCredSpec(t *testing.T) {
 	err = cs.UnmarshalJSON(parsedBytes)
 	assert.NoError(t, err)
 }
+
+func TestMarkRenewalResult(t *testing.T) {
+	cs := &CredentialSpecResource{
+		CredentialSpecResourceCommon: &CredentialSpecResourceCommon{
+			taskARN: taskARN,
+			credentialSpecContainerMap: map[string]string{
+				"credentialspecdomainless:arn:aws:ssm:us-west-2:123456789012:parameter/test": "webapp",
+			},
+		},
+	}
+
+	cs.MarkRenewalScheduled()
+	assert.Equal(t, LifecycleRenewalScheduled, cs.GetLifecycleStatus().State)
+
+	cs.MarkRenewalResult(errors.New("renewal failed"))
+	status := cs.GetLifecycleStatus()
+	assert.Equal(t, LifecycleFailed, status.State)
+	assert.Equal(t, "renewal failed", status.Reason)
+	assert.True(t, status.RenewalWarning)
+	assert.Equal(t, []string{"arn:aws:ssm:us-west-2:123456789012:parameter/test"}, status.Locations)
+
+	// The lifecycle status is persisted with the resource
+	parsedBytes, err := cs.MarshalJSON()
+	require.NoError(t, err)
+	unmarshalled := &CredentialSpecResource{CredentialSpecResourceCommon: &CredentialSpecResourceCommon{}}
+	require.NoError(t, unmarshalled.UnmarshalJSON(parsedBytes))
+	unmarshalledStatus := unmarshalled.GetLifecycleStatus()
+	assert.Equal(t, status.State, unmarshalledStatus.State)
+	assert.Equal(t, status.Reason, unmarshalledStatus.Reason)
+	assert.True(t, unmarshalledStatus.RenewalWarning)
+	require.NotNil(t, unmarshalledStatus.UpdatedAt)
+	assert.True(t, status.UpdatedAt.Equal(*unmarshalledStatus.UpdatedAt))
+
+	cs.MarkRenewalResult(nil)
+	status = cs.GetLifecycleStatus()
+	assert.Equal(t, LifecycleFetched, status.State)
+	assert.Empty(t, status.Reason)
+	assert.False(t, status.RenewalWarning)
+}
@@ -1503,3 +1503,100 @@ func TestWriteCredentialSpecJSONMarshallErr(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateTracksLifecycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+	ssmClientCreator := mock_factory.NewMockSSMClientCreator(ctrl)
+	s3ClientCreator := mock_s3_factory.NewMockS3ClientCreator(ctrl)
+	mockIO := mock_ioutilwrapper.NewMockIOUtil(ctrl)
+	mockSSMClient := mock_ssmiface.NewMockSSMClient(ctrl)
+
+	ssmCredentialSpec := "credentialspec:arn:aws:ssm:us-west-2:123456789012:parameter/test"
+	s3CredentialSpec := "credentialspec:arn:aws:s3:::bucket_name/test"
+
+	newResource := func(credentialSpec string) *CredentialSpecResource {
+		cs := &CredentialSpecResource{
+			CredentialSpecResourceCommon: &CredentialSpecResourceCommon{
+				knownStatusUnsafe:          resourcestatus.ResourceCreated,
+				desiredStatusUnsafe:        resourcestatus.ResourceCreated,
+				CredSpecMap:                map[string]string{},
+				taskARN:                    taskARN,
+				credentialSpecContainerMap: map[string]string{credentialSpec: "webapp"},
+			},
+			ioutil: mockIO,
+		}
+		cs.Initialize(&taskresource.ResourceFields{
+			ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
+				SSMClientCreator:   ssmClientCreator,
+				CredentialsManager: credentialsManager,
+				S3ClientCreator:    s3ClientCreator,
+			},
+		}, apitaskstatus.TaskStatusNone, apitaskstatus.TaskRunning)
+		return cs
+	}
+
+	creds := credentials.TaskIAMRoleCredentials{
+		ARN: "arn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			AccessKeyID:     "id",
+			SecretAccessKey: "key",
+		},
+	}
+
+	t.Run("SSM failure", func(t *testing.T) {
+		cs := newResource(ssmCredentialSpec)
+		gomock.InOrder(
+			credentialsManager.EXPECT().GetTaskCredentials(gomock.Any()).Return(creds, true),
+			ssmClientCreator.EXPECT().NewSSMClient(gomock.Any(), gomock.Any()).Return(mockSSMClient),
+			mockSSMClient.EXPECT().GetParameters(gomock.Any()).Return(nil, errors.New("test-error")),
+		)
+
+		assert.Error(t, cs.create())
+		status := cs.GetLifecycleStatus()
+		assert.Equal(t, LifecycleFailed, status.State)
+		assert.Contains(t, status.Reason, "test-error")
+		assert.Equal(t, []string{"arn:aws:ssm:us-west-2:123456789012:parameter/test"}, status.Locations)
+	})
+
+	t.Run("S3 failure", func(t *testing.T) {
+		cs := newResource(s3CredentialSpec)
+		gomock.InOrder(
+			credentialsManager.EXPECT().GetTaskCredentials(gomock.Any()).Return(creds, true),
+			s3ClientCreator.EXPECT().NewS3ManagerClient(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil, errors.New("test-error")),
+		)
+
+		assert.Error(t, cs.create())
+		status := cs.GetLifecycleStatus()
+		assert.Equal(t, LifecycleFailed, status.State)
+		assert.Contains(t, status.Reason, "test-error")
+		assert.Equal(t, []string{"arn:aws:s3:::bucket_name/test"}, status.Locations)
+	})
+
+	t.Run("SSM success", func(t *testing.T) {
+		cs := newResource(ssmCredentialSpec)
+		ssmClientOutput := &ssm.GetParametersOutput{
+			InvalidParameters: []*string{},
+			Parameters: []*ssm.Parameter{
+				{
+					Name:  aws.String("test"),
+					Value: aws.String("test-cred-spec-data"),
+				},
+			},
+		}
+		gomock.InOrder(
+			credentialsManager.EXPECT().GetTaskCredentials(gomock.Any()).Return(creds, true),
+			ssmClientCreator.EXPECT().NewSSMClient(gomock.Any(), gomock.Any()).Return(mockSSMClient),
+			mockSSMClient.EXPECT().GetParameters(gomock.Any()).Return(ssmClientOutput, nil),
+			mockIO.EXPECT().WriteFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		assert.NoError(t, cs.create())
+		status := cs.GetLifecycleStatus()
+		assert.Equal(t, LifecycleFetched, status.State)
+		assert.Empty(t, status.Reason)
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package credentialspec
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const (
+	// LifecycleFetching means the credential specs are being fetched.
+	LifecycleFetching = "FETCHING"
+	// LifecycleFetched means the credential specs were fetched and are ready for use.
+	LifecycleFetched = "FETCHED"
+	// LifecycleRenewalScheduled means the credentials used by the credential specs
+	// are being renewed after a refresh of the task execution role credentials.
+	LifecycleRenewalScheduled = "RENEWAL_SCHEDULED"
+	// LifecycleFailed means fetching or renewing the credential specs failed.
+	LifecycleFailed = "FAILED"
+)
+
+// LifecycleStatus is the fetch and renewal status of the credential specs of a task.
+type LifecycleStatus struct {
+	State string `json:"state"`
+	// Reason is why the last fetch or renewal failed.
+	Reason string `json:"reason,omitempty"`
+	// Locations are where the credential specs are fetched from. These are the file
+	// paths and S3/SSM ARNs from the task definition, never the spec contents.
+	Locations []string   `json:"locations,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// RenewalWarning is set when the last renewal failed. The task keeps running with
+	// the credentials it already has, which may stop working once they expire.
+	RenewalWarning bool `json:"renewalWarning,omitempty"`
+}
+
+// create fetches the credential specs and tracks the outcome in the lifecycle status.
+func (cs *CredentialSpecResource) create() error {
+	cs.setLifecycleState(LifecycleFetching, "")
+	if err := cs.Create(); err != nil {
+		cs.setLifecycleState(LifecycleFailed, err.Error())
+		return err
+	}
+	cs.setLifecycleState(LifecycleFetched, "")
+	return nil
+}
+
+// MarkRenewalScheduled records that the credentials used by the credential specs
+// are being renewed.
+func (cs *CredentialSpecResource) MarkRenewalScheduled() {
+	cs.setLifecycleState(LifecycleRenewalScheduled, "")
+}
+
+// MarkRenewalResult records the outcome of renewing the credentials used by the
+// credential specs, and sets or clears the renewal warning accordingly.
+func (cs *CredentialSpecResource) MarkRenewalResult(err error) {
+	if err == nil {
+		cs.setLifecycleState(LifecycleFetched, "")
+		cs.lock.Lock()
+		cs.renewalWarning = false
+		cs.lock.Unlock()
+		return
+	}
+
+	logger.Warn("Failed to renew credential spec credentials for task", logger.Fields{
+		field.TaskARN:   cs.taskARN,
+		"locations":     strings.Join(cs.specLocations(), ","),
+		field.Error:     err,
+		"renewalFailed": true,
+	})
+	cs.setLifecycleState(LifecycleFailed, err.Error())
+	cs.lock.Lock()
+	cs.renewalWarning = true
+	cs.lock.Unlock()
+}
+
+// GetLifecycleStatus returns the fetch and renewal status of the credential specs.
+func (cs *CredentialSpecResource) GetLifecycleStatus() LifecycleStatus {
+	locations := cs.specLocations()
+
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+
+	status := LifecycleStatus{
+		State:          cs.lifecycleState,
+		Reason:         cs.lifecycleReason,
+		Locations:      locations,
+		RenewalWarning: cs.renewalWarning,
+	}
+	if !cs.lifecycleUpdatedAt.IsZero() {
+		updatedAt := cs.lifecycleUpdatedAt
+		status.UpdatedAt = &updatedAt
+	}
+	return status
+}
+
+func (cs *CredentialSpecResource) setLifecycleState(state, reason string) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	cs.lifecycleState = state
+	cs.lifecycleReason = reason
+	cs.lifecycleUpdatedAt = time.Now()
+}
+
+// specLocations returns the sanitized locations of the credential specs, which are
+// the credential spec inputs without the "credentialspec:" or
+// "credentialspecdomainless:" prefix.
+func (cs *CredentialSpecResource) specLocations() []string {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+
+	var locations []string
+	for credSpecStr := range cs.credentialSpecContainerMap {
+		location := strings.TrimPrefix(credSpecStr, "credentialspecdomainless:")
+		location = strings.TrimPrefix(location, "credentialspec:")
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	return locations
+}
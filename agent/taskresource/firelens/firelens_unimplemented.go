@@ -18,6 +18,7 @@ package firelens
 
 import (
 	"errors"
+	"io"
 	"time"
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
@@ -175,3 +176,8 @@ func (firelens *FirelensResource) BuildContainerDependency(containerName string,
 func (firelens *FirelensResource) GetContainerDependencies(dependent resourcestatus.ResourceStatus) []apicontainer.ContainerDependency {
 	return nil
 }
+
+// GenerateConfig generates the config of the firelens container.
+func (firelens *FirelensResource) GenerateConfig(w io.Writer) error {
+	return errors.New("not implemented")
+}
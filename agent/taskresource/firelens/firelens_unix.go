@@ -18,6 +18,7 @@ package firelens
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -38,6 +39,8 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/utils/ioutilwrapper"
 	"github.com/aws/amazon-ecs-agent/agent/utils/oswrapper"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+
+	generator "github.com/awslabs/go-config-generator-for-fluentd-and-fluentbit"
 )
 
 const (
@@ -467,11 +470,7 @@ func (firelens *FirelensResource) generateConfigFile() error {
 
 	confFilePath := filepath.Join(firelens.resourceDir, "config", "fluent.conf")
 	err = firelens.writeConfigFile(func(file oswrapper.File) error {
-		if firelens.firelensConfigType == FirelensConfigTypeFluentd {
-			return config.WriteFluentdConfig(file)
-		} else {
-			return config.WriteFluentBitConfig(file)
-		}
+		return firelens.writeFluentConfig(config, file)
 	}, confFilePath)
 	if err != nil {
 		return errors.Wrapf(err, "unable to generate firelens config file")
@@ -481,6 +480,23 @@ func (firelens *FirelensResource) generateConfigFile() error {
 	return nil
 }
 
+// GenerateConfig generates the fluentd or fluentbit config of the firelens container and writes it to w,
+// exactly as it's written to the config file.
+func (firelens *FirelensResource) GenerateConfig(w io.Writer) error {
+	config, err := firelens.generateConfig()
+	if err != nil {
+		return errors.Wrap(err, "unable to generate firelens config")
+	}
+	return firelens.writeFluentConfig(config, w)
+}
+
+func (firelens *FirelensResource) writeFluentConfig(config generator.FluentConfig, w io.Writer) error {
+	if firelens.firelensConfigType == FirelensConfigTypeFluentd {
+		return config.WriteFluentdConfig(w)
+	}
+	return config.WriteFluentBitConfig(w)
+}
+
 // downloadConfigFromS3 downloads an external config file from S3 and saves it at ${RESOURCE_DIR}/config/external.conf.
 // The generated firelens config file fluent.conf will have a reference to include this file.
 func (firelens *FirelensResource) downloadConfigFromS3() error {
@@ -14,6 +14,8 @@
 package taskresource
 
 import (
+	"context"
+
 	asmfactory "github.com/aws/amazon-ecs-agent/agent/asm/factory"
 	fsxfactory "github.com/aws/amazon-ecs-agent/agent/fsx/factory"
 	s3factory "github.com/aws/amazon-ecs-agent/agent/s3/factory"
@@ -30,4 +32,11 @@ type ResourceFieldsCommon struct {
 	S3ClientCreator    s3factory.S3ClientCreator
 	CredentialsManager credentials.Manager
 	EC2InstanceID      string
+	VolumeDriverProber VolumeDriverProber
+}
+
+// VolumeDriverProber checks that a docker volume driver is available before volumes are
+// created with it
+type VolumeDriverProber interface {
+	Probe(ctx context.Context, driver string, driverOpts map[string]string) error
 }
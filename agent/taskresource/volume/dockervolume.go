@@ -63,6 +63,9 @@ type VolumeResource struct {
 	statusToTransitions map[resourcestatus.ResourceStatus]func() error
 	client              dockerapi.DockerClient
 	ctx                 context.Context
+	// driverProber is used to check that the volume driver is available before creating
+	// the volume, the driver is not probed if it's nil
+	driverProber taskresource.VolumeDriverProber
 
 	// TransitionDependenciesMap is a map of the dependent container status to other
 	// dependencies that must be satisfied in order for this container to transition.
@@ -135,6 +138,9 @@ func (vol *VolumeResource) Initialize(resourceFields *taskresource.ResourceField
 
 	vol.ctx = resourceFields.Ctx
 	vol.client = resourceFields.DockerClient
+	if resourceFields.ResourceFieldsCommon != nil {
+		vol.driverProber = resourceFields.VolumeDriverProber
+	}
 	vol.initStatusToTransitions()
 }
 
@@ -315,8 +321,29 @@ func (vol *VolumeResource) SourcePath() string {
 	return vol.GetMountPoint()
 }
 
+// SetDriverProber sets the prober used to check that the volume driver is available before
+// creating the volume.
+func (vol *VolumeResource) SetDriverProber(prober taskresource.VolumeDriverProber) {
+	vol.driverProber = prober
+}
+
+// probeDriver checks that the volume driver is available. The local driver and the ECS
+// volume plugin, which are managed with the agent, are not probed.
+func (vol *VolumeResource) probeDriver() error {
+	driver := vol.VolumeConfig.Driver
+	if vol.driverProber == nil || driver == "" || driver == DockerLocalVolumeDriver || driver == ECSVolumePlugin {
+		return nil
+	}
+	return vol.driverProber.Probe(vol.ctx, driver, vol.VolumeConfig.DriverOpts)
+}
+
 // Create performs resource creation
 func (vol *VolumeResource) Create() error {
+	if err := vol.probeDriver(); err != nil {
+		err = errors.Wrapf(err, "volume [%s]", vol.Name)
+		vol.setTerminalReason("VolumeError: " + err.Error())
+		return err
+	}
 	seelog.Debugf("Creating volume with name %s using driver %s", vol.VolumeConfig.DockerVolumeName, vol.VolumeConfig.Driver)
 	volumeResponse := vol.client.CreateVolume(
 		vol.ctx,
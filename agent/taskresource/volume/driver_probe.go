@@ -0,0 +1,153 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package volume
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/utils/mobypkgwrapper"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/pkg/errors"
+)
+
+// DefaultDriverProbeTTL is the duration for which a successful probe of a volume driver is
+// cached before the driver is probed again
+const DefaultDriverProbeTTL = 5 * time.Minute
+
+// DriverProber checks that the volume driver of a docker volume is available on the instance
+// before the volume is created, so that tasks using a missing driver fail with a clear reason
+// instead of an opaque docker error. Successful probes are cached per driver.
+type DriverProber struct {
+	client        dockerapi.DockerClient
+	legacyPlugins mobypkgwrapper.Plugins
+	ttl           time.Duration
+	now           func() time.Time
+	// probedAt maps a driver name to the time it was last successfully probed
+	probedAt map[string]time.Time
+	lock     sync.Mutex
+}
+
+// NewDriverProber creates a new DriverProber. Managed plugins are looked up with the docker
+// plugin API and legacy plugins are looked up in the plugin spec directories.
+func NewDriverProber(client dockerapi.DockerClient, legacyPlugins mobypkgwrapper.Plugins,
+	ttl time.Duration) *DriverProber {
+	return &DriverProber{
+		client:        client,
+		legacyPlugins: legacyPlugins,
+		ttl:           ttl,
+		now:           time.Now,
+		probedAt:      make(map[string]time.Time),
+	}
+}
+
+// Probe returns an error if the volume driver is not installed, is installed but disabled or
+// does not provide the volume driver capability, or if the driver options are invalid.
+// Failures to query docker for plugins are logged and ignored, in which case volume creation
+// is left to fail on its own if the driver is not available.
+func (p *DriverProber) Probe(ctx context.Context, driver string, driverOpts map[string]string) error {
+	for opt := range driverOpts {
+		if strings.TrimSpace(opt) == "" {
+			return errors.Errorf("volume driver '%s': driver options contain an empty option name", driver)
+		}
+	}
+	if p.cached(driver) {
+		return nil
+	}
+
+	response := p.client.ListPlugins(ctx, dockerclient.ListPluginsTimeout, filters.NewArgs())
+	if response.Error != nil {
+		logger.Warn("Unable to list docker plugins to probe volume driver", logger.Fields{
+			"driver":    driver,
+			field.Error: response.Error,
+		})
+		return nil
+	}
+	for _, plugin := range response.Plugins {
+		if plugin == nil || !pluginNameMatches(plugin.Name, driver) {
+			continue
+		}
+		if !plugin.Enabled {
+			return errors.Errorf("volume driver '%s' is installed but disabled", driver)
+		}
+		if !providesVolumeDriver(plugin) {
+			return errors.Errorf("plugin '%s' does not provide the %s capability", driver,
+				dockerapi.VolumeDriverType)
+		}
+		p.setProbed(driver)
+		return nil
+	}
+
+	// Legacy plugins are not known to the plugin API, their capabilities can't be checked
+	legacyPlugins, err := p.legacyPlugins.Scan()
+	if err != nil {
+		logger.Warn("Unable to scan legacy docker plugins to probe volume driver", logger.Fields{
+			"driver":    driver,
+			field.Error: err,
+		})
+		return nil
+	}
+	for _, name := range legacyPlugins {
+		if name == driver {
+			p.setProbed(driver)
+			return nil
+		}
+	}
+	return errors.Errorf("volume driver '%s' is not installed", driver)
+}
+
+func (p *DriverProber) cached(driver string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	probedAt, ok := p.probedAt[driver]
+	return ok && p.now().Sub(probedAt) < p.ttl
+}
+
+func (p *DriverProber) setProbed(driver string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.probedAt[driver] = p.now()
+}
+
+// pluginNameMatches returns whether the name of a plugin refers to the driver. Plugin names
+// always carry a tag, while drivers may be referenced without the default tag.
+func pluginNameMatches(pluginName string, driver string) bool {
+	return withDefaultTag(pluginName) == withDefaultTag(driver)
+}
+
+func withDefaultTag(name string) string {
+	if strings.LastIndex(name, config.DockerTagSeparator) > strings.LastIndex(name, "/") {
+		return name
+	}
+	return name + config.DockerTagSeparator + config.DefaultDockerTag
+}
+
+func providesVolumeDriver(plugin *types.Plugin) bool {
+	for _, interfaceType := range plugin.Config.Interface.Types {
+		if interfaceType.Capability == dockerapi.VolumeDriverType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package volume
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	mock_dockerapi "github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi/mocks"
+	mock_mobypkgwrapper "github.com/aws/amazon-ecs-agent/agent/utils/mobypkgwrapper/mocks"
+
+	"github.com/docker/docker/api/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func volumeDriverPlugin(name string, enabled bool, capabilities ...string) *types.Plugin {
+	plugin := &types.Plugin{Name: name, Enabled: enabled}
+	for _, capability := range capabilities {
+		plugin.Config.Interface.Types = append(plugin.Config.Interface.Types,
+			types.PluginInterfaceType{Prefix: "docker", Capability: capability, Version: "1.0"})
+	}
+	return plugin
+}
+
+func testPluginList() dockerapi.ListPluginsResponse {
+	return dockerapi.ListPluginsResponse{
+		Plugins: []*types.Plugin{
+			volumeDriverPlugin("rexray/ebs:latest", true, dockerapi.VolumeDriverType),
+			volumeDriverPlugin("portworx/pxd:2.1", false, dockerapi.VolumeDriverType),
+			volumeDriverPlugin("vieux/sshfs:latest", true, "authz"),
+		},
+	}
+}
+
+func TestDriverProberProbe(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		driver        string
+		driverOpts    map[string]string
+		legacyPlugins []string
+		expectScan    bool
+		expectedError string
+	}{
+		{
+			name:   "installed plugin referenced without tag",
+			driver: "rexray/ebs",
+		},
+		{
+			name:   "installed plugin referenced with tag",
+			driver: "rexray/ebs:latest",
+		},
+		{
+			name:          "installed but disabled plugin",
+			driver:        "portworx/pxd:2.1",
+			expectedError: "volume driver 'portworx/pxd:2.1' is installed but disabled",
+		},
+		{
+			name:          "plugin without volume driver capability",
+			driver:        "vieux/sshfs",
+			expectedError: "plugin 'vieux/sshfs' does not provide the volumedriver capability",
+		},
+		{
+			name:          "legacy plugin",
+			driver:        "netapp",
+			legacyPlugins: []string{"netapp"},
+			expectScan:    true,
+		},
+		{
+			name:          "driver not installed",
+			driver:        "rexray/s3fs",
+			legacyPlugins: []string{"netapp"},
+			expectScan:    true,
+			expectedError: "volume driver 'rexray/s3fs' is not installed",
+		},
+		{
+			name:          "empty driver option name",
+			driver:        "rexray/ebs",
+			driverOpts:    map[string]string{" ": "gp2"},
+			expectedError: "volume driver 'rexray/ebs': driver options contain an empty option name",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient := mock_dockerapi.NewMockDockerClient(ctrl)
+			mockPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
+			if tc.driverOpts == nil {
+				mockClient.EXPECT().ListPlugins(gomock.Any(), dockerclient.ListPluginsTimeout, gomock.Any()).
+					Return(testPluginList())
+			}
+			if tc.expectScan {
+				mockPlugins.EXPECT().Scan().Return(tc.legacyPlugins, nil)
+			}
+
+			prober := NewDriverProber(mockClient, mockPlugins, DefaultDriverProbeTTL)
+			err := prober.Probe(context.TODO(), tc.driver, tc.driverOpts)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+// Tests that successful probes are cached until the TTL expires and that failed probes are
+// not cached.
+func TestDriverProberCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	mockPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
+
+	now := time.Now()
+	prober := NewDriverProber(mockClient, mockPlugins, time.Minute)
+	prober.now = func() time.Time { return now }
+
+	mockClient.EXPECT().ListPlugins(gomock.Any(), gomock.Any(), gomock.Any()).Return(testPluginList()).Times(4)
+	require.NoError(t, prober.Probe(context.TODO(), "rexray/ebs", nil))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, prober.Probe(context.TODO(), "rexray/ebs", nil))
+	now = now.Add(time.Minute)
+	require.NoError(t, prober.Probe(context.TODO(), "rexray/ebs", nil))
+
+	assert.Error(t, prober.Probe(context.TODO(), "portworx/pxd:2.1", nil))
+	assert.Error(t, prober.Probe(context.TODO(), "portworx/pxd:2.1", nil))
+}
+
+func TestDriverProberListPluginsError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	mockPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
+
+	mockClient.EXPECT().ListPlugins(gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		dockerapi.ListPluginsResponse{Error: errors.New("docker unavailable")})
+	prober := NewDriverProber(mockClient, mockPlugins, DefaultDriverProbeTTL)
+	assert.NoError(t, prober.Probe(context.TODO(), "rexray/ebs", nil))
+}
+
+// Tests that volumes are not created and the terminal reason names the driver if the probe
+// fails.
+func TestCreateDriverNotAvailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	mockPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
+
+	mockClient.EXPECT().ListPlugins(gomock.Any(), gomock.Any(), gomock.Any()).Return(testPluginList())
+	mockClient.EXPECT().CreateVolume(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any()).Times(0)
+
+	volume, err := NewVolumeResource(context.TODO(), "volumeName", "docker", "volumeName", SharedScope, true,
+		"portworx/pxd:2.1", nil, nil, mockClient)
+	require.NoError(t, err)
+	volume.SetDriverProber(NewDriverProber(mockClient, mockPlugins, DefaultDriverProbeTTL))
+	assert.Error(t, volume.Create())
+	assert.Equal(t, "VolumeError: volume [volumeName]: volume driver 'portworx/pxd:2.1' is installed but disabled",
+		volume.GetTerminalReason())
+}
+
+// Tests that the local driver is not probed.
+func TestCreateLocalDriverNotProbed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	mockPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
+
+	mockClient.EXPECT().CreateVolume(gomock.Any(), "volumeName", DockerLocalVolumeDriver, nil, nil,
+		dockerclient.CreateVolumeTimeout).Return(dockerapi.SDKVolumeResponse{
+		DockerVolume: &types.Volume{Name: "volumeName"},
+	})
+
+	volume, err := NewVolumeResource(context.TODO(), "volumeName", "docker", "volumeName", SharedScope, true,
+		DockerLocalVolumeDriver, nil, nil, mockClient)
+	require.NoError(t, err)
+	volume.SetDriverProber(NewDriverProber(mockClient, mockPlugins, DefaultDriverProbeTTL))
+	assert.NoError(t, volume.Create())
+}
@@ -15,6 +15,7 @@ package tcshandler
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/url"
 	"strings"
@@ -90,12 +91,14 @@ func startTelemetrySession(params *TelemetrySessionParams) error {
 	tcsEndpoint, err := params.ECSClient.DiscoverTelemetryEndpoint(params.ContainerInstanceArn)
 	if err != nil {
 		seelog.Errorf("tcs: unable to discover poll endpoint: %v", err)
+		params.Connections.ConnectFailed(err)
 		return err
 	}
 	url := formatURL(tcsEndpoint, params.Cfg.Cluster, params.ContainerInstanceArn, params.TaskEngine)
 	return startSession(params.Ctx, url, params.Cfg, params.CredentialProvider, params.MetricsChannel,
 		params.HealthChannel, defaultHeartbeatTimeout, defaultHeartbeatJitter,
-		config.DefaultContainerMetricsPublishInterval, params.DeregisterInstanceEventStream, params.Doctor)
+		config.DefaultContainerMetricsPublishInterval, params.DeregisterInstanceEventStream, params.Doctor,
+		params.Connections)
 }
 
 func startSession(
@@ -109,6 +112,7 @@ func startSession(
 	publishMetricsInterval time.Duration,
 	deregisterInstanceEventStream *eventstream.EventStream,
 	doctor *doctor.Doctor,
+	connections *wsclient.ConnectionTracker,
 ) error {
 	client := tcsclient.New(url, &wsclient.WSClientMinAgentConfig{
 		AWSRegion:          cfg.AWSRegion,
@@ -125,18 +129,21 @@ func startSession(
 	}
 	defer deregisterInstanceEventStream.Unsubscribe(deregisterContainerInstanceHandler)
 
+	connections.Connecting(url)
 	err = client.Connect()
 	if err != nil {
 		seelog.Errorf("Error connecting to TCS: %v", err.Error())
+		connections.ConnectFailed(err)
 		return err
 	}
 	seelog.Info("Connected to TCS endpoint")
+	connections.Connected()
 	// start a timer and listens for tcs heartbeats/acks. The timer is reset when
 	// we receive a heartbeat from the server or when a published metrics message
 	// is acked.
 	timer := time.NewTimer(retry.AddJitter(heartbeatTimeout, heartbeatJitter))
 	defer timer.Stop()
-	client.AddRequestHandler(heartbeatHandler(timer))
+	client.AddRequestHandler(heartbeatHandler(timer, connections))
 	client.AddRequestHandler(ackPublishMetricHandler(timer))
 	client.AddRequestHandler(ackPublishHealthMetricHandler(timer))
 	client.AddRequestHandler(ackPublishInstanceStatusHandler(timer))
@@ -152,16 +159,25 @@ func startSession(
 	case <-timer.C:
 		seelog.Info("TCS Connection hasn't had any activity for too long; disconnecting")
 		client.Disconnect()
+		connections.Disconnected(errors.New("no activity for too long"))
+		return nil
 	case err := <-serveC:
+		if err == io.EOF {
+			connections.Disconnected(nil)
+		} else {
+			connections.Disconnected(err)
+		}
 		return err
 	}
+	connections.Disconnected(nil)
 	return nil
 }
 
 // heartbeatHandler resets the heartbeat timer when HeartbeatMessage message is received from tcs.
-func heartbeatHandler(timer *time.Timer) func(*ecstcs.HeartbeatMessage) {
+func heartbeatHandler(timer *time.Timer, connections *wsclient.ConnectionTracker) func(*ecstcs.HeartbeatMessage) {
 	return func(*ecstcs.HeartbeatMessage) {
 		seelog.Debug("Received HeartbeatMessage from tcs")
+		connections.Heartbeat()
 		timer.Reset(retry.AddJitter(defaultHeartbeatTimeout, defaultHeartbeatJitter))
 	}
 }
@@ -203,7 +203,7 @@ func TestStartSession(t *testing.T) {
 	// Start a session with the test server.
 	go startSession(ctx, server.URL, testCfg, testCreds, telemetryMessages, healthMessages,
 		defaultHeartbeatTimeout, defaultHeartbeatJitter,
-		testPublishMetricsInterval, deregisterInstanceEventStream, emptyDoctor)
+		testPublishMetricsInterval, deregisterInstanceEventStream, emptyDoctor, nil)
 	// Wait for 100 ms to make sure the session is ready to receive message from channel
 	time.Sleep(testSendMetricsToChannelWaitTime)
 	go mockEngine.SimulateMetricsPublishToChannel(ctx)
@@ -270,8 +270,9 @@ func TestSessionConnectionClosedByRemote(t *testing.T) {
 	healthMessages := make(chan ecstcs.HealthMessage, testTelemetryChannelDefaultBufferSize)
 
 	// Start a session with the test server.
+	connections := wsclient.NewConnectionTracker()
 	err = startSession(ctx, server.URL, testCfg, testCreds, telemetryMessages, healthMessages, defaultHeartbeatTimeout,
-		defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream, emptyDoctor)
+		defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream, emptyDoctor, connections)
 
 	if err == nil {
 		t.Error("Expected io.EOF on closed connection")
@@ -279,6 +280,13 @@ func TestSessionConnectionClosedByRemote(t *testing.T) {
 	if err != io.EOF {
 		t.Error("Expected io.EOF on closed connection, got: ", err)
 	}
+	// Connections closed by TCS are closed for a valid reason
+	status := connections.ConnectionStatus()
+	assert.False(t, status.Connected)
+	assert.Equal(t, uint64(1), status.Connects)
+	assert.NotNil(t, status.LastConnectedAt)
+	assert.NotNil(t, status.LastDisconnectedAt)
+	assert.Empty(t, status.LastDisconnectError)
 }
 
 // TestConnectionInactiveTimeout tests the tcs client reconnect when it loses network
@@ -310,10 +318,15 @@ func TestConnectionInactiveTimeout(t *testing.T) {
 	healthMessages := make(chan ecstcs.HealthMessage, testTelemetryChannelDefaultBufferSize)
 
 	// Start a session with the test server.
+	connections := wsclient.NewConnectionTracker()
 	err = startSession(ctx, server.URL, testCfg, testCreds, telemetryMessages, healthMessages, 50*time.Millisecond,
-		100*time.Millisecond, testPublishMetricsInterval, deregisterInstanceEventStream, emptyDoctor)
+		100*time.Millisecond, testPublishMetricsInterval, deregisterInstanceEventStream, emptyDoctor, connections)
 	// if we are not blocked here, then the test pass as it will reconnect in StartSession
 	assert.NoError(t, err, "Close the connection should cause the tcs client return error")
+	status := connections.ConnectionStatus()
+	assert.False(t, status.Connected)
+	assert.Equal(t, uint64(1), status.Connects)
+	assert.Equal(t, "no activity for too long", status.LastDisconnectError)
 
 	assert.True(t, websocket.IsCloseError(<-serverErr, websocket.CloseAbnormalClosure),
 		"Read from closed connection should produce an io.EOF error")
@@ -328,10 +341,14 @@ func TestDiscoverEndpointAndStartSession(t *testing.T) {
 	mockEcs := mock_api.NewMockECSClient(ctrl)
 	mockEcs.EXPECT().DiscoverTelemetryEndpoint(gomock.Any()).Return("", errors.New("error"))
 
-	err := startTelemetrySession(&TelemetrySessionParams{ECSClient: mockEcs})
+	connections := wsclient.NewConnectionTracker()
+	err := startTelemetrySession(&TelemetrySessionParams{ECSClient: mockEcs, Connections: connections})
 	if err == nil {
 		t.Error("Expected error from startTelemetrySession when DiscoverTelemetryEndpoint returns error")
 	}
+	status := connections.ConnectionStatus()
+	assert.Equal(t, uint64(1), status.ConnectFailures)
+	assert.Equal(t, "error", status.LastDisconnectError)
 }
 
 func getPayloadFromRequest(request string) (string, error) {
@@ -25,6 +25,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/ecs-agent/eventstream"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tcs/model/ecstcs"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/ttime"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/pkg/errors"
 )
@@ -43,6 +44,7 @@ type TelemetrySessionParams struct {
 	MetricsChannel                <-chan ecstcs.TelemetryMessage
 	HealthChannel                 <-chan ecstcs.HealthMessage
 	Doctor                        *doctor.Doctor
+	Connections                   *wsclient.ConnectionTracker
 	_time                         ttime.Time
 	_timeOnce                     sync.Once
 }
@@ -0,0 +1,114 @@
+//go:build linux
+// +build linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	procFSRoot   = "/proc"
+	cgroupFSRoot = "/sys/fs/cgroup"
+	// cgroupV1Controller is the controller whose hierarchy is reported as the cgroup path
+	// of a process on cgroup v1 hosts.
+	cgroupV1Controller = "cpu"
+)
+
+// GetCgroupPath returns the absolute path of the cgroup of the process with the given pid.
+// On cgroup v1 hosts this is the path in the cpu controller hierarchy, on cgroup v2 hosts
+// it is the path in the unified hierarchy.
+func GetCgroupPath(pid int) (string, error) {
+	return readCgroupPath(filepath.Join(procFSRoot, fmt.Sprint(pid), "cgroup"))
+}
+
+// GetPIDNamespaceInode returns the inode number of the PID namespace of the process with
+// the given pid.
+func GetPIDNamespaceInode(pid int) (uint64, error) {
+	return readNamespaceInode(filepath.Join(procFSRoot, fmt.Sprint(pid), "ns", "pid"))
+}
+
+// GetDeviceNumber returns the major:minor number of the device containing the given path.
+func GetDeviceNumber(path string) (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return "", err
+	}
+	// Dev is not a uint64 on all architectures
+	dev := uint64(stat.Dev)
+	return fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev)), nil
+}
+
+// readCgroupPath parses a /proc/<pid>/cgroup file. Each line of the file has the format
+// hierarchy-ID:controller-list:cgroup-path, and the cgroup v2 unified hierarchy has an
+// empty controller list.
+func readCgroupPath(cgroupFile string) (string, error) {
+	file, err := os.Open(cgroupFile)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	unifiedPath := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		controllers, cgroupPath := fields[1], fields[2]
+		if controllers == "" {
+			unifiedPath = filepath.Join(cgroupFSRoot, cgroupPath)
+			continue
+		}
+		for _, controller := range strings.Split(controllers, ",") {
+			if controller == cgroupV1Controller {
+				return filepath.Join(cgroupFSRoot, controllers, cgroupPath), nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if unifiedPath == "" {
+		return "", fmt.Errorf("no %s or unified cgroup hierarchy found in %s", cgroupV1Controller, cgroupFile)
+	}
+	return unifiedPath, nil
+}
+
+// readNamespaceInode reads the inode number from a namespace link, which has the format
+// <type>:[<inode>].
+func readNamespaceInode(nsLink string) (uint64, error) {
+	target, err := os.Readlink(nsLink)
+	if err != nil {
+		return 0, err
+	}
+	start, end := strings.Index(target, "["), strings.LastIndex(target, "]")
+	if start == -1 || end < start {
+		return 0, fmt.Errorf("unexpected namespace link %s -> %s", nsLink, target)
+	}
+	var inode uint64
+	if _, err := fmt.Sscan(target[start+1:end], &inode); err != nil {
+		return 0, fmt.Errorf("unexpected namespace link %s -> %s: %v", nsLink, target, err)
+	}
+	return inode, nil
+}
@@ -0,0 +1,91 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCgroupPath(t *testing.T) {
+	testCases := []struct {
+		name         string
+		cgroupFile   string
+		expectedPath string
+		expectError  bool
+	}{
+		{
+			name:         "cgroup v1",
+			cgroupFile:   "testdata/cgroup/v1",
+			expectedPath: "/sys/fs/cgroup/cpu,cpuacct/ecs/7b0d4e4e3fd44093a33a7a5d3bc6d8a1/7a2ba1bc2a9e2d8d22a8f0e0f5ab7c1d3f5390af2b9c2bf0e6f4a0ed1f3de3a9",
+		},
+		{
+			name:         "cgroup v2",
+			cgroupFile:   "testdata/cgroup/v2",
+			expectedPath: "/sys/fs/cgroup/ecs/7b0d4e4e3fd44093a33a7a5d3bc6d8a1/7a2ba1bc2a9e2d8d22a8f0e0f5ab7c1d3f5390af2b9c2bf0e6f4a0ed1f3de3a9",
+		},
+		{
+			name:        "no cpu hierarchy",
+			cgroupFile:  "testdata/cgroup/no_cpu",
+			expectError: true,
+		},
+		{
+			name:        "missing file",
+			cgroupFile:  "testdata/cgroup/missing",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := readCgroupPath(tc.cgroupFile)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPath, path)
+		})
+	}
+}
+
+func TestReadNamespaceInode(t *testing.T) {
+	dir := t.TempDir()
+	nsLink := filepath.Join(dir, "pid")
+	require.NoError(t, os.Symlink("pid:[4026532451]", nsLink))
+	inode, err := readNamespaceInode(nsLink)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4026532451), inode)
+
+	badLink := filepath.Join(dir, "bad")
+	require.NoError(t, os.Symlink("pid", badLink))
+	_, err = readNamespaceInode(badLink)
+	assert.Error(t, err)
+}
+
+func TestGetDeviceNumber(t *testing.T) {
+	device, err := GetDeviceNumber(t.TempDir())
+	require.NoError(t, err)
+	assert.Regexp(t, `^\d+:\d+$`, device)
+
+	_, err = GetDeviceNumber(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import "errors"
+
+var errContainerProcUnsupported = errors.New("container process information is only supported on linux")
+
+// GetCgroupPath is not supported on this platform
+func GetCgroupPath(pid int) (string, error) {
+	return "", errContainerProcUnsupported
+}
+
+// GetPIDNamespaceInode is not supported on this platform
+func GetPIDNamespaceInode(pid int) (uint64, error) {
+	return 0, errContainerProcUnsupported
+}
+
+// GetDeviceNumber is not supported on this platform
+func GetDeviceNumber(path string) (string, error) {
+	return "", errContainerProcUnsupported
+}
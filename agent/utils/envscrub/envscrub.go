@@ -0,0 +1,99 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package envscrub redacts the values of environment variables whose names look like they
+// hold secrets, so that the values aren't written to the state of the agent.
+package envscrub
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RedactionMarker replaces the values of environment variables that are scrubbed.
+const RedactionMarker = "[redacted]"
+
+// DefaultPatterns are the patterns of the names of the environment variables that are
+// scrubbed by default.
+var DefaultPatterns = []string{"*KEY*", "*SECRET*", "*TOKEN*", "*PASSWORD*"}
+
+// Scrubber redacts the values of environment variables whose names match any of its
+// patterns. Patterns have the syntax of path.Match, and are matched case-insensitively.
+// A nil Scrubber doesn't redact anything.
+type Scrubber struct {
+	patterns []string
+}
+
+// New creates a scrubber for the patterns. An error is returned if a pattern is malformed.
+func New(patterns []string) (*Scrubber, error) {
+	scrubber := &Scrubber{}
+	for _, pattern := range patterns {
+		pattern = strings.ToUpper(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid environment variable name pattern %q: %w", pattern, err)
+		}
+		scrubber.patterns = append(scrubber.patterns, pattern)
+	}
+	return scrubber, nil
+}
+
+// Sensitive returns true if the value of the environment variable is scrubbed.
+func (s *Scrubber) Sensitive(name string) bool {
+	if s == nil {
+		return false
+	}
+	name = strings.ToUpper(name)
+	for _, pattern := range s.patterns {
+		// The patterns are validated when the scrubber is created
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrubEnvironment returns a copy of the environment variables, by name, with the values of
+// the sensitive ones redacted.
+func (s *Scrubber) ScrubEnvironment(environment map[string]string) map[string]string {
+	if environment == nil {
+		return nil
+	}
+	scrubbed := make(map[string]string, len(environment))
+	for name, value := range environment {
+		if s.Sensitive(name) {
+			value = RedactionMarker
+		}
+		scrubbed[name] = value
+	}
+	return scrubbed
+}
+
+// ScrubEnvironmentList returns a copy of the environment variables, in the NAME=value form
+// of the docker API, with the values of the sensitive ones redacted.
+func (s *Scrubber) ScrubEnvironmentList(environment []string) []string {
+	if environment == nil {
+		return nil
+	}
+	scrubbed := make([]string, 0, len(environment))
+	for _, variable := range environment {
+		if name, _, ok := strings.Cut(variable, "="); ok && s.Sensitive(name) {
+			variable = name + "=" + RedactionMarker
+		}
+		scrubbed = append(scrubbed, variable)
+	}
+	return scrubbed
+}
@@ -0,0 +1,68 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package envscrub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrubEnvironment(t *testing.T) {
+	scrubber, err := New(DefaultPatterns)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"API_KEY":        RedactionMarker,
+		"db_password":    RedactionMarker,
+		"GITHUB_TOKEN":   RedactionMarker,
+		"ClientSecretId": RedactionMarker,
+		"HOME":           "/root",
+		"PASS":           "not matched",
+	}, scrubber.ScrubEnvironment(map[string]string{
+		"API_KEY":        "abc",
+		"db_password":    "hunter2",
+		"GITHUB_TOKEN":   "ghp_123",
+		"ClientSecretId": "s3cr3t",
+		"HOME":           "/root",
+		"PASS":           "not matched",
+	}))
+	assert.Nil(t, scrubber.ScrubEnvironment(nil))
+}
+
+func TestScrubEnvironmentList(t *testing.T) {
+	scrubber, err := New([]string{"AWS_*", " "})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"AWS_SECRET_ACCESS_KEY=" + RedactionMarker, "aws_region=" + RedactionMarker,
+		"PATH=/usr/bin", "NOVALUE", "AWS_EMPTY=" + RedactionMarker},
+		scrubber.ScrubEnvironmentList([]string{"AWS_SECRET_ACCESS_KEY=abc=def", "aws_region=us-west-2",
+			"PATH=/usr/bin", "NOVALUE", "AWS_EMPTY="}))
+	assert.Nil(t, scrubber.ScrubEnvironmentList(nil))
+}
+
+func TestNilScrubberDoesNotScrub(t *testing.T) {
+	var scrubber *Scrubber
+	assert.False(t, scrubber.Sensitive("API_KEY"))
+	assert.Equal(t, map[string]string{"API_KEY": "abc"}, scrubber.ScrubEnvironment(map[string]string{"API_KEY": "abc"}))
+}
+
+func TestNewInvalidPattern(t *testing.T) {
+	_, err := New([]string{"*KEY*", "[SECRET"})
+	assert.Error(t, err)
+}
@@ -18,6 +18,82 @@ package credentials
 // between the task engine, acs and credentials handlers
 type Manager interface {
 	SetTaskCredentials(*TaskIAMRoleCredentials) error
+	// ForceSetTaskCredentials sets credentials like SetTaskCredentials, even if the
+	// maximum number of credentials is reached
+	ForceSetTaskCredentials(*TaskIAMRoleCredentials) error
 	GetTaskCredentials(string) (TaskIAMRoleCredentials, bool)
+	// GetAllCredentialsForTaskARN returns all the credentials held for the task with the
+	// given arn, such as the credentials of its task role and of its execution role
+	GetAllCredentialsForTaskARN(string) []TaskIAMRoleCredentials
 	RemoveCredentials(string)
 }
+
+// RetiredCredentialsTracker is implemented by managers that remember the credentials
+// ids that were removed for a while after their removal, so that requests for them can
+// be told apart from requests for ids that never existed
+type RetiredCredentialsTracker interface {
+	IsCredentialsRetired(string) bool
+}
+
+// RoleCredentialsSelector is implemented by managers that can select the credentials of
+// another role of the task that credentials belong to, for tasks that hold the credentials
+// of several roles
+type RoleCredentialsSelector interface {
+	// GetTaskCredentialsForRole returns the credentials of the role with the given arn that
+	// the task of the credentials id holds, if they are of the same role type as the
+	// credentials of the id
+	GetTaskCredentialsForRole(credentialsID string, roleARN string) (TaskIAMRoleCredentials, bool)
+}
+
+// RemovalNotifier is implemented by managers that notify of the credentials they remove
+type RemovalNotifier interface {
+	// NotifyOnRemoval registers a function that is called with the credentials id of the
+	// credentials that are removed, after they are removed
+	NotifyOnRemoval(onRemoval func(credentialsID string))
+}
+
+// EntryCountReporter is implemented by managers that count the credentials they hold
+type EntryCountReporter interface {
+	EntryCount() EntryCount
+}
+
+// CredentialsLister is implemented by managers that can list the credentials they hold
+// for diagnostics
+type CredentialsLister interface {
+	ListCredentials() []CredentialsSummary
+}
+
+// CredentialsSummary identifies credentials held by a credentials manager. It never
+// holds secret material, so that it's safe to show to support staff.
+type CredentialsSummary struct {
+	CredentialsID string `json:"CredentialsId"`
+	TaskARN       string `json:"TaskArn"`
+	RoleType      string `json:"RoleType"`
+	Expiration    string `json:"Expiration"`
+}
+
+// CredentialsSnapshotter is implemented by managers that can take a consistent snapshot of
+// the metadata of the credentials they hold, for incident response
+type CredentialsSnapshotter interface {
+	SnapshotCredentials() []CredentialsMetadata
+}
+
+// CredentialsMetadata describes credentials held by a credentials manager. Like
+// CredentialsSummary, it never holds secret material.
+type CredentialsMetadata struct {
+	CredentialsID string
+	TaskARN       string
+	RoleARN       string
+	RoleType      string
+	Expiration    string
+	Revision      uint64
+}
+
+// EntryCount is the number of credentials held by a credentials manager
+type EntryCount struct {
+	Entries int `json:"Entries"`
+	// HighWaterMark is the highest number of credentials held since the manager was created
+	HighWaterMark int `json:"HighWaterMark"`
+	// MaxEntries is the maximum number of credentials held, not limited if it's zero or less
+	MaxEntries int `json:"MaxEntries"`
+}
@@ -14,10 +14,18 @@
 package credentials
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
 	"github.com/aws/aws-sdk-go/aws"
 )
 
@@ -46,8 +54,33 @@ const (
 	// ExecutionRoleType specifies the credentials used for non task application
 	// uses
 	ExecutionRoleType = "TaskExecution"
+
+	// credentialsShardCount is the number of shards that credentials are spread across in
+	// the credentials manager
+	credentialsShardCount = 32
+
+	// RetiredCredentialsRetention is how long the credentials manager remembers credentials
+	// ids after their credentials are removed
+	RetiredCredentialsRetention = 10 * time.Minute
+
+	// DefaultMaxEntries is the default maximum number of credentials held by the
+	// credentials manager. Instances run at most a few hundred tasks with a couple of
+	// credentials each, so the cap is only reached if credentials are leaked.
+	DefaultMaxEntries = 50000
+
+	// entriesAlarmRatio is the ratio of the maximum number of credentials above which the
+	// credentials manager warns that it is running out of room
+	entriesAlarmRatio = 0.9
 )
 
+// ErrMaxEntriesExceeded is returned when credentials for a new credentials id are set while
+// the credentials manager holds the maximum number of credentials.
+var ErrMaxEntriesExceeded = errors.New("maximum number of credentials exceeded")
+
+// ErrCredentialsIDCollision is returned when credentials are set for a credentials id that
+// the credentials manager holds credentials of another task for.
+var ErrCredentialsIDCollision = errors.New("credentials id is held for another task")
+
 // IAMRoleCredentials is used to save credentials sent by ACS
 type IAMRoleCredentials struct {
 	CredentialsID   string `json:"-"`
@@ -68,6 +101,39 @@ type IAMRoleCredentials struct {
 type TaskIAMRoleCredentials struct {
 	ARN                string
 	IAMRoleCredentials IAMRoleCredentials
+	// Revision is incremented by the credentials manager every time the credentials
+	// for a credentials id are updated. Clients can use it to tell whether the
+	// credentials they hold are current.
+	Revision uint64
+	// ServiceScope lists the AWS services that the credentials are valid for. It is nil
+	// if the credentials manager has no scoping info for the credentials.
+	ServiceScope []string
+	// NotBefore is the time at which the credentials become active. It is the zero time
+	// if the credentials are active as soon as they are received.
+	NotBefore time.Time
+	// GeneratedAt is the time at which the credentials were generated, such as the time
+	// they were received from the backend. It is the zero time if unknown.
+	GeneratedAt time.Time
+}
+
+// NotYetActive returns whether the credentials have an activation time after now.
+func (role *TaskIAMRoleCredentials) NotYetActive(now time.Time) bool {
+	return !role.NotBefore.IsZero() && now.Before(role.NotBefore)
+}
+
+// PermitsService returns whether the credentials are valid for the AWS service. The
+// second return value is false if there is no scoping info for the credentials, in
+// which case the first one is meaningless.
+func (role *TaskIAMRoleCredentials) PermitsService(service string) (bool, bool) {
+	if role.ServiceScope == nil {
+		return false, false
+	}
+	for _, scopedService := range role.ServiceScope {
+		if strings.EqualFold(scopedService, service) {
+			return true, true
+		}
+	}
+	return false, true
 }
 
 // GetIAMRoleCredentials returns the IAM role credentials in the task IAM role struct
@@ -83,10 +149,74 @@ func (roleCredentials *IAMRoleCredentials) GenerateCredentialsEndpointRelativeUR
 
 // credentialsManager implements the Manager interface. It is used to
 // save credentials sent from ACS and to retrieve credentials from
-// the credentials endpoint
+// the credentials endpoint. Credentials are spread across shards by credentials
+// id, so that lookups and updates for unrelated tasks don't contend for a lock.
 type credentialsManager struct {
+	shards [credentialsShardCount]credentialsShard
+	now    func() time.Time
+
+	// entries is the number of credentials held, and highWaterMark the highest it has been
+	entries       int64
+	highWaterMark int64
+	// alarmed is 1 while entries is above the alarm threshold, so that it's only warned
+	// about once every time it's crossed
+	alarmed    int32
+	maxEntries int
+	// isTaskTracked returns whether the engine still tracks a task. The credentials of
+	// tasks that aren't tracked anymore can be evicted to make room for new credentials.
+	isTaskTracked func(taskARN string) bool
+	// admissionLock serializes the admission of new credentials ids, so that the maximum
+	// number of credentials isn't exceeded by concurrent updates. It's always acquired
+	// before shard locks.
+	admissionLock sync.Mutex
+	// arnIndex maps task arns to the ids of the credentials held for the tasks. It's guarded
+	// by arnIndexLock, which is acquired after shard locks.
+	arnIndex     map[string]map[string]struct{}
+	arnIndexLock sync.RWMutex
+	// metricsFactory records the credentials id collisions
+	metricsFactory metrics.EntryFactory
+	// removalListeners are called with the ids of the credentials that are removed. They're
+	// guarded by removalListenersLock, and called without holding any other lock.
+	removalListeners     []func(credentialsID string)
+	removalListenersLock sync.RWMutex
+}
+
+// ManagerOpt is a function type for updating the credentials manager.
+type ManagerOpt func(*credentialsManager)
+
+// WithMaxEntries sets the maximum number of credentials held by the credentials manager.
+// DefaultMaxEntries is used if not set. The number of credentials is not limited if max
+// is set to zero or less.
+func WithMaxEntries(max int) ManagerOpt {
+	return func(manager *credentialsManager) {
+		manager.maxEntries = max
+	}
+}
+
+// WithTrackedTaskLookup sets the lookup of whether the engine still tracks a task. Once the
+// maximum number of credentials is reached, credentials of tasks that the lookup reports
+// as not tracked are evicted to make room for new credentials. Credentials are never
+// evicted if it's not set.
+func WithTrackedTaskLookup(isTaskTracked func(taskARN string) bool) ManagerOpt {
+	return func(manager *credentialsManager) {
+		manager.isTaskTracked = isTaskTracked
+	}
+}
+
+// WithMetricsFactory sets the factory of the metrics that the credentials manager records,
+// such as the credentials id collisions. Metrics aren't recorded if it's not set.
+func WithMetricsFactory(metricsFactory metrics.EntryFactory) ManagerOpt {
+	return func(manager *credentialsManager) {
+		manager.metricsFactory = metricsFactory
+	}
+}
+
+// credentialsShard holds the credentials for a subset of credentials ids
+type credentialsShard struct {
 	// idToTaskCredentials maps credentials id to its corresponding TaskIAMRoleCredentials object
 	idToTaskCredentials map[string]TaskIAMRoleCredentials
+	// retiredIDs maps the ids of removed credentials to the time they were removed at
+	retiredIDs          map[string]time.Time
 	taskCredentialsLock sync.RWMutex
 }
 
@@ -105,17 +235,52 @@ func IAMRoleCredentialsFromACS(roleCredentials *ecsacs.IAMRoleCredentials, roleT
 }
 
 // NewManager creates a new credentials manager object
-func NewManager() Manager {
-	return &credentialsManager{
-		idToTaskCredentials: make(map[string]TaskIAMRoleCredentials),
+func NewManager(options ...ManagerOpt) Manager {
+	manager := &credentialsManager{
+		now:            time.Now,
+		maxEntries:     DefaultMaxEntries,
+		arnIndex:       make(map[string]map[string]struct{}),
+		metricsFactory: metrics.NewNopEntryFactory(),
 	}
+	for _, opt := range options {
+		opt(manager)
+	}
+	for i := range manager.shards {
+		manager.shards[i].idToTaskCredentials = make(map[string]TaskIAMRoleCredentials)
+		manager.shards[i].retiredIDs = make(map[string]time.Time)
+	}
+	return manager
+}
+
+// shardFor returns the shard holding the credentials for a given credentials id
+func (manager *credentialsManager) shardFor(id string) *credentialsShard {
+	// 32-bit FNV-1a, computed inline to keep lookups allocation free
+	hash := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		hash ^= uint32(id[i])
+		hash *= 16777619
+	}
+	return &manager.shards[hash%credentialsShardCount]
 }
 
-// SetTaskCredentials adds or updates credentials in the credentials manager
+// SetTaskCredentials adds or updates credentials in the credentials manager. Credentials
+// are only updated for the task that they are held for, so an error is returned if the
+// credentials id is held for another task, rather than serving the credentials of one task
+// to another.
 func (manager *credentialsManager) SetTaskCredentials(taskCredentials *TaskIAMRoleCredentials) error {
-	manager.taskCredentialsLock.Lock()
-	defer manager.taskCredentialsLock.Unlock()
+	return manager.setTaskCredentials(taskCredentials, false)
+}
 
+// ForceSetTaskCredentials adds or updates credentials in the credentials manager like
+// SetTaskCredentials, except that the credentials are admitted even if the maximum number
+// of credentials is reached. It is meant for the credentials of tasks that are known to be
+// running, whose credentials must not be refused, so credentials are still only updated for
+// the task that they are held for.
+func (manager *credentialsManager) ForceSetTaskCredentials(taskCredentials *TaskIAMRoleCredentials) error {
+	return manager.setTaskCredentials(taskCredentials, true)
+}
+
+func (manager *credentialsManager) setTaskCredentials(taskCredentials *TaskIAMRoleCredentials, force bool) error {
 	credentials := taskCredentials.IAMRoleCredentials
 	// Validate that credentials id is not empty
 	if credentials.CredentialsID == "" {
@@ -127,9 +292,45 @@ func (manager *credentialsManager) SetTaskCredentials(taskCredentials *TaskIAMRo
 		return fmt.Errorf("task ARN is empty")
 	}
 
-	manager.idToTaskCredentials[credentials.CredentialsID] = TaskIAMRoleCredentials{
+	shard := manager.shardFor(credentials.CredentialsID)
+	if manager.maxEntries > 0 && !force {
+		// The admission lock is held until the credentials are stored, so that the
+		// credentials id can't be evicted after it is found, nor another one admitted
+		manager.admissionLock.Lock()
+		defer manager.admissionLock.Unlock()
+		if err := manager.admitUnsafe(shard, taskCredentials); err != nil {
+			return err
+		}
+	}
+	shard.taskCredentialsLock.Lock()
+	defer shard.taskCredentialsLock.Unlock()
+
+	existing, exists := shard.idToTaskCredentials[credentials.CredentialsID]
+	if exists && existing.ARN != taskCredentials.ARN {
+		logger.Error("Refusing to set credentials, the credentials id is held for another task", logger.Fields{
+			"credentialsId":   credentials.CredentialsID,
+			"existingTaskArn": existing.ARN,
+			"newTaskArn":      taskCredentials.ARN,
+			"roleType":        credentials.RoleType,
+		})
+		err := fmt.Errorf("unable to set credentials for task %s: %w: %s", taskCredentials.ARN,
+			ErrCredentialsIDCollision, existing.ARN)
+		manager.metricsFactory.New(metrics.CredentialsIDCollisionMetricName).Done(err)()
+		return err
+	}
+	delete(shard.retiredIDs, credentials.CredentialsID)
+	if !exists {
+		manager.entryAdded()
+	}
+	manager.index(taskCredentials.ARN, credentials.CredentialsID)
+	revision := existing.Revision + 1
+	shard.idToTaskCredentials[credentials.CredentialsID] = TaskIAMRoleCredentials{
 		ARN:                taskCredentials.ARN,
 		IAMRoleCredentials: taskCredentials.GetIAMRoleCredentials(),
+		Revision:           revision,
+		ServiceScope:       taskCredentials.ServiceScope,
+		NotBefore:          taskCredentials.NotBefore,
+		GeneratedAt:        taskCredentials.GeneratedAt,
 	}
 
 	return nil
@@ -137,10 +338,11 @@ func (manager *credentialsManager) SetTaskCredentials(taskCredentials *TaskIAMRo
 
 // GetTaskCredentials retrieves credentials for a given credentials id
 func (manager *credentialsManager) GetTaskCredentials(id string) (TaskIAMRoleCredentials, bool) {
-	manager.taskCredentialsLock.RLock()
-	defer manager.taskCredentialsLock.RUnlock()
+	shard := manager.shardFor(id)
+	shard.taskCredentialsLock.RLock()
+	defer shard.taskCredentialsLock.RUnlock()
 
-	taskCredentials, ok := manager.idToTaskCredentials[id]
+	taskCredentials, ok := shard.idToTaskCredentials[id]
 
 	if !ok {
 		return TaskIAMRoleCredentials{}, ok
@@ -148,13 +350,291 @@ func (manager *credentialsManager) GetTaskCredentials(id string) (TaskIAMRoleCre
 	return TaskIAMRoleCredentials{
 		ARN:                taskCredentials.ARN,
 		IAMRoleCredentials: taskCredentials.GetIAMRoleCredentials(),
+		Revision:           taskCredentials.Revision,
+		ServiceScope:       taskCredentials.ServiceScope,
+		NotBefore:          taskCredentials.NotBefore,
+		GeneratedAt:        taskCredentials.GeneratedAt,
 	}, ok
 }
 
-// RemoveCredentials removes credentials from the credentials manager
+// GetAllCredentialsForTaskARN retrieves all the credentials held for a task, such as the
+// credentials of its task role and of its execution role, ordered by role type and
+// credentials id. It returns no credentials if none are held for the task.
+func (manager *credentialsManager) GetAllCredentialsForTaskARN(arn string) []TaskIAMRoleCredentials {
+	manager.arnIndexLock.RLock()
+	ids := make([]string, 0, len(manager.arnIndex[arn]))
+	for id := range manager.arnIndex[arn] {
+		ids = append(ids, id)
+	}
+	manager.arnIndexLock.RUnlock()
+
+	allCredentials := make([]TaskIAMRoleCredentials, 0, len(ids))
+	for _, id := range ids {
+		// The credentials can have been removed or moved to another task since the index
+		// was read
+		if taskCredentials, ok := manager.GetTaskCredentials(id); ok && taskCredentials.ARN == arn {
+			allCredentials = append(allCredentials, taskCredentials)
+		}
+	}
+	sort.Slice(allCredentials, func(i, j int) bool {
+		left, right := allCredentials[i].IAMRoleCredentials, allCredentials[j].IAMRoleCredentials
+		if left.RoleType != right.RoleType {
+			return left.RoleType < right.RoleType
+		}
+		return left.CredentialsID < right.CredentialsID
+	})
+	return allCredentials
+}
+
+// GetTaskCredentialsForRole returns the credentials of the role with the given arn that the
+// task of the credentials id holds. Only credentials of the same role type as the
+// credentials of the id are returned, so that the credentials of the task role can't be
+// used to get the credentials of the execution role.
+func (manager *credentialsManager) GetTaskCredentialsForRole(credentialsID string, roleARN string) (
+	TaskIAMRoleCredentials, bool) {
+	taskCredentials, ok := manager.GetTaskCredentials(credentialsID)
+	if !ok {
+		return TaskIAMRoleCredentials{}, false
+	}
+	if taskCredentials.IAMRoleCredentials.RoleArn == roleARN {
+		return taskCredentials, true
+	}
+	for _, candidate := range manager.GetAllCredentialsForTaskARN(taskCredentials.ARN) {
+		if candidate.IAMRoleCredentials.RoleArn == roleARN &&
+			candidate.IAMRoleCredentials.RoleType == taskCredentials.IAMRoleCredentials.RoleType {
+			return candidate, true
+		}
+	}
+	return TaskIAMRoleCredentials{}, false
+}
+
+// RemoveCredentials removes credentials from the credentials manager. The credentials id
+// is remembered as retired for RetiredCredentialsRetention. The removal listeners are
+// notified once the credentials are removed.
 func (manager *credentialsManager) RemoveCredentials(id string) {
-	manager.taskCredentialsLock.Lock()
-	defer manager.taskCredentialsLock.Unlock()
+	if !manager.removeCredentials(id) {
+		return
+	}
+	manager.removalListenersLock.RLock()
+	defer manager.removalListenersLock.RUnlock()
+	for _, onRemoval := range manager.removalListeners {
+		onRemoval(id)
+	}
+}
+
+// NotifyOnRemoval registers a function that is called with the credentials id of the
+// credentials that are removed, including the credentials that are evicted.
+func (manager *credentialsManager) NotifyOnRemoval(onRemoval func(credentialsID string)) {
+	manager.removalListenersLock.Lock()
+	defer manager.removalListenersLock.Unlock()
+	manager.removalListeners = append(manager.removalListeners, onRemoval)
+}
+
+// removeCredentials removes credentials from the credentials manager, and returns whether
+// there were credentials for the id.
+func (manager *credentialsManager) removeCredentials(id string) bool {
+	shard := manager.shardFor(id)
+	shard.taskCredentialsLock.Lock()
+	defer shard.taskCredentialsLock.Unlock()
+
+	now := manager.now()
+	for retiredID, retiredAt := range shard.retiredIDs {
+		if now.Sub(retiredAt) >= RetiredCredentialsRetention {
+			delete(shard.retiredIDs, retiredID)
+		}
+	}
+	if taskCredentials, ok := shard.idToTaskCredentials[id]; ok {
+		delete(shard.idToTaskCredentials, id)
+		manager.unindex(taskCredentials.ARN, id)
+		shard.retiredIDs[id] = now
+		manager.entryRemoved()
+		return true
+	}
+	return false
+}
+
+// IsCredentialsRetired returns whether the credentials for a given credentials id were
+// removed within the last RetiredCredentialsRetention
+func (manager *credentialsManager) IsCredentialsRetired(id string) bool {
+	shard := manager.shardFor(id)
+	shard.taskCredentialsLock.RLock()
+	defer shard.taskCredentialsLock.RUnlock()
+
+	retiredAt, ok := shard.retiredIDs[id]
+	return ok && manager.now().Sub(retiredAt) < RetiredCredentialsRetention
+}
+
+// EntryCount returns the number of credentials held by the credentials manager, the
+// highest it has been, and the maximum number of credentials.
+func (manager *credentialsManager) EntryCount() EntryCount {
+	return EntryCount{
+		Entries:       int(atomic.LoadInt64(&manager.entries)),
+		HighWaterMark: int(atomic.LoadInt64(&manager.highWaterMark)),
+		MaxEntries:    manager.maxEntries,
+	}
+}
+
+// ListCredentials returns the summaries of the credentials held by the credentials manager,
+// ordered by credentials id.
+func (manager *credentialsManager) ListCredentials() []CredentialsSummary {
+	summaries := make([]CredentialsSummary, 0, atomic.LoadInt64(&manager.entries))
+	for i := range manager.shards {
+		shard := &manager.shards[i]
+		shard.taskCredentialsLock.RLock()
+		for id, taskCredentials := range shard.idToTaskCredentials {
+			summaries = append(summaries, CredentialsSummary{
+				CredentialsID: id,
+				TaskARN:       taskCredentials.ARN,
+				RoleType:      taskCredentials.IAMRoleCredentials.RoleType,
+				Expiration:    taskCredentials.IAMRoleCredentials.Expiration,
+			})
+		}
+		shard.taskCredentialsLock.RUnlock()
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CredentialsID < summaries[j].CredentialsID
+	})
+	return summaries
+}
+
+// SnapshotCredentials returns the metadata of the credentials held by the credentials
+// manager, ordered by credentials id. All shards are locked while the snapshot is taken,
+// so that it reflects the credentials held at a single point in time, unlike
+// ListCredentials.
+func (manager *credentialsManager) SnapshotCredentials() []CredentialsMetadata {
+	for i := range manager.shards {
+		manager.shards[i].taskCredentialsLock.RLock()
+	}
+	snapshot := make([]CredentialsMetadata, 0, atomic.LoadInt64(&manager.entries))
+	for i := range manager.shards {
+		for id, taskCredentials := range manager.shards[i].idToTaskCredentials {
+			snapshot = append(snapshot, CredentialsMetadata{
+				CredentialsID: id,
+				TaskARN:       taskCredentials.ARN,
+				RoleARN:       taskCredentials.IAMRoleCredentials.RoleArn,
+				RoleType:      taskCredentials.IAMRoleCredentials.RoleType,
+				Expiration:    taskCredentials.IAMRoleCredentials.Expiration,
+				Revision:      taskCredentials.Revision,
+			})
+		}
+	}
+	for i := range manager.shards {
+		manager.shards[i].taskCredentialsLock.RUnlock()
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].CredentialsID < snapshot[j].CredentialsID
+	})
+	return snapshot
+}
+
+func (shard *credentialsShard) contains(id string) bool {
+	shard.taskCredentialsLock.RLock()
+	defer shard.taskCredentialsLock.RUnlock()
+	_, ok := shard.idToTaskCredentials[id]
+	return ok
+}
+
+// admitUnsafe returns whether there is room for the credentials, which are for a new
+// credentials id, evicting the credentials of a task that isn't tracked anymore if the
+// maximum number of credentials is reached. An error is returned if there is no room.
+// The admission lock must be held.
+func (manager *credentialsManager) admitUnsafe(shard *credentialsShard, taskCredentials *TaskIAMRoleCredentials) error {
+	if shard.contains(taskCredentials.IAMRoleCredentials.CredentialsID) ||
+		atomic.LoadInt64(&manager.entries) < int64(manager.maxEntries) {
+		return nil
+	}
+	if evictedID, evictedARN, ok := manager.evictUntracked(); ok {
+		logger.Warn("Evicted credentials of a task that is not tracked anymore, the maximum number of credentials is reached", logger.Fields{
+			"evictedCredentialsId": evictedID,
+			"evictedTaskArn":       evictedARN,
+			"maxEntries":           manager.maxEntries,
+		})
+		return nil
+	}
+	logger.Error("Refusing to set credentials, the maximum number of credentials is reached; credentials may be leaking", logger.Fields{
+		field.TaskARN:   taskCredentials.ARN,
+		"credentialsId": taskCredentials.IAMRoleCredentials.CredentialsID,
+		"roleType":      taskCredentials.IAMRoleCredentials.RoleType,
+		"maxEntries":    manager.maxEntries,
+	})
+	return fmt.Errorf("unable to set credentials for task %s: %w (%d)", taskCredentials.ARN,
+		ErrMaxEntriesExceeded, manager.maxEntries)
+}
+
+// evictUntracked removes the credentials of a task that isn't tracked anymore, and returns
+// the id and task arn of the removed credentials. Nothing is removed if the tracked task
+// lookup isn't set or all the credentials are for tracked tasks.
+func (manager *credentialsManager) evictUntracked() (string, string, bool) {
+	if manager.isTaskTracked == nil {
+		return "", "", false
+	}
+	for i := range manager.shards {
+		shard := &manager.shards[i]
+		id, arn, ok := shard.untracked(manager.isTaskTracked)
+		if ok {
+			manager.RemoveCredentials(id)
+			return id, arn, true
+		}
+	}
+	return "", "", false
+}
+
+// untracked returns the id and task arn of credentials of the shard whose task isn't
+// tracked anymore
+func (shard *credentialsShard) untracked(isTaskTracked func(taskARN string) bool) (string, string, bool) {
+	shard.taskCredentialsLock.RLock()
+	defer shard.taskCredentialsLock.RUnlock()
+	for id, taskCredentials := range shard.idToTaskCredentials {
+		if !isTaskTracked(taskCredentials.ARN) {
+			return id, taskCredentials.ARN, true
+		}
+	}
+	return "", "", false
+}
 
-	delete(manager.idToTaskCredentials, id)
+// index adds the credentials id to the ids of the credentials held for the task.
+func (manager *credentialsManager) index(arn string, id string) {
+	manager.arnIndexLock.Lock()
+	defer manager.arnIndexLock.Unlock()
+	ids, ok := manager.arnIndex[arn]
+	if !ok {
+		ids = make(map[string]struct{})
+		manager.arnIndex[arn] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+// unindex removes the credentials id from the ids of the credentials held for the task.
+func (manager *credentialsManager) unindex(arn string, id string) {
+	manager.arnIndexLock.Lock()
+	defer manager.arnIndexLock.Unlock()
+	ids := manager.arnIndex[arn]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(manager.arnIndex, arn)
+	}
+}
+
+func (manager *credentialsManager) entryAdded() {
+	entries := atomic.AddInt64(&manager.entries, 1)
+	for {
+		highWaterMark := atomic.LoadInt64(&manager.highWaterMark)
+		if entries <= highWaterMark || atomic.CompareAndSwapInt64(&manager.highWaterMark, highWaterMark, entries) {
+			break
+		}
+	}
+	if manager.maxEntries > 0 && float64(entries) >= entriesAlarmRatio*float64(manager.maxEntries) &&
+		atomic.CompareAndSwapInt32(&manager.alarmed, 0, 1) {
+		logger.Warn("The credentials manager is running out of room for credentials", logger.Fields{
+			"entries":    entries,
+			"maxEntries": manager.maxEntries,
+		})
+	}
+}
+
+func (manager *credentialsManager) entryRemoved() {
+	entries := atomic.AddInt64(&manager.entries, -1)
+	if manager.maxEntries > 0 && float64(entries) < entriesAlarmRatio*float64(manager.maxEntries) {
+		atomic.StoreInt32(&manager.alarmed, 0)
+	}
 }
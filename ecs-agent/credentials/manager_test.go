@@ -18,11 +18,19 @@ package credentials
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	mock_metrics "github.com/aws/amazon-ecs-agent/ecs-agent/metrics/mocks"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestIAMRoleCredentialsFromACS tests if credentials sent from ACS can be
@@ -105,6 +113,7 @@ func TestSetAndGetTaskCredentialsHappyPath(t *testing.T) {
 	err := manager.SetTaskCredentials(&credentials)
 	assert.NoError(t, err, "Error adding credentials")
 
+	credentials.Revision = 1
 	credentialsFromManager, ok := manager.GetTaskCredentials("cid1")
 	assert.True(t, ok, "GetTaskCredentials returned false for existing credentials")
 	assert.Equal(t, credentials, credentialsFromManager, "Mismatch between added and retrieved credentials")
@@ -122,6 +131,7 @@ func TestSetAndGetTaskCredentialsHappyPath(t *testing.T) {
 	}
 	err = manager.SetTaskCredentials(&updatedCredentials)
 	assert.NoError(t, err, "Error updating credentials")
+	updatedCredentials.Revision = 2
 	credentialsFromManager, ok = manager.GetTaskCredentials("cid1")
 
 	assert.True(t, ok, "GetTaskCredentials returned false for existing credentials")
@@ -162,6 +172,7 @@ func TestRemoveExistingCredentials(t *testing.T) {
 	err := manager.SetTaskCredentials(&credentials)
 	assert.NoError(t, err, "Error adding credentials")
 
+	credentials.Revision = 1
 	credentialsFromManager, ok := manager.GetTaskCredentials("cid1")
 	assert.True(t, ok, "GetTaskCredentials returned false for existing credentials")
 	assert.Equal(t, credentials, credentialsFromManager, "Mismatch between added and retrieved credentials")
@@ -172,3 +183,774 @@ func TestRemoveExistingCredentials(t *testing.T) {
 		t.Error("Expected GetTaskCredentials to return false for removed credentials")
 	}
 }
+
+// TestRetiredCredentials tests that the ids of removed credentials are remembered as
+// retired until RetiredCredentialsRetention has passed
+func TestRetiredCredentials(t *testing.T) {
+	now := time.Now()
+	manager := NewManager().(*credentialsManager)
+	manager.now = func() time.Time { return now }
+	for _, id := range []string{"active", "retired"} {
+		assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                "t1",
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: id, AccessKeyID: "akid"},
+		}))
+	}
+	manager.RemoveCredentials("retired")
+	manager.RemoveCredentials("never-existed")
+
+	assert.False(t, manager.IsCredentialsRetired("active"))
+	assert.False(t, manager.IsCredentialsRetired("never-existed"))
+	assert.True(t, manager.IsCredentialsRetired("retired"))
+	_, ok := manager.GetTaskCredentials("retired")
+	assert.False(t, ok)
+
+	now = now.Add(RetiredCredentialsRetention)
+	assert.False(t, manager.IsCredentialsRetired("retired"))
+	manager.RemoveCredentials("active")
+	assert.True(t, manager.IsCredentialsRetired("active"))
+	// Removals prune the ids of their shard that were retired for longer than the retention
+	manager.RemoveCredentials("retired")
+	assert.NotContains(t, manager.shardFor("retired").retiredIDs, "retired")
+
+	// Credentials set again for a retired id are no longer retired
+	assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t2",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "active", AccessKeyID: "akid"},
+	}))
+	assert.False(t, manager.IsCredentialsRetired("active"))
+}
+
+// TestNotifyOnRemoval tests that the removal listeners are notified of the credentials that
+// are removed or evicted, after they are removed
+func TestNotifyOnRemoval(t *testing.T) {
+	manager := NewManager(WithMaxEntries(2), WithTrackedTaskLookup(func(taskARN string) bool {
+		return taskARN != "t1"
+	})).(*credentialsManager)
+	var removed []string
+	manager.NotifyOnRemoval(func(credentialsID string) {
+		_, ok := manager.GetTaskCredentials(credentialsID)
+		assert.False(t, ok, "listeners must be notified after the credentials are removed")
+		removed = append(removed, credentialsID)
+	})
+	for i, arn := range []string{"t1", "t2"} {
+		assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                arn,
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: fmt.Sprintf("c%d", i+1)},
+		}))
+	}
+
+	manager.RemoveCredentials("never-existed")
+	assert.Empty(t, removed)
+	manager.RemoveCredentials("c2")
+	assert.Equal(t, []string{"c2"}, removed)
+	manager.RemoveCredentials("c2")
+	assert.Equal(t, []string{"c2"}, removed, "credentials are only removed once")
+
+	// Evicted credentials are removed too
+	for i, arn := range []string{"t3", "t4"} {
+		assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                arn,
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: fmt.Sprintf("c%d", i+3)},
+		}))
+	}
+	assert.Equal(t, []string{"c2", "c1"}, removed)
+}
+
+// TestMaxEntries tests that credentials for new credentials ids are refused once the
+// maximum number of credentials is reached, while existing credentials can be updated
+func TestMaxEntries(t *testing.T) {
+	manager := NewManager(WithMaxEntries(3)).(*credentialsManager)
+	set := func(id string) error {
+		return manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                "t-" + id,
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: id, AccessKeyID: "akid-" + id},
+		})
+	}
+	for _, id := range []string{"c1", "c2", "c3"} {
+		assert.NoError(t, set(id))
+	}
+	err := set("c4")
+	assert.ErrorIs(t, err, ErrMaxEntriesExceeded)
+	_, ok := manager.GetTaskCredentials("c4")
+	assert.False(t, ok)
+	assert.NoError(t, set("c1"), "existing credentials can be updated at the cap")
+	assert.Equal(t, EntryCount{Entries: 3, HighWaterMark: 3, MaxEntries: 3}, manager.EntryCount())
+
+	manager.RemoveCredentials("c2")
+	manager.RemoveCredentials("c3")
+	assert.Equal(t, EntryCount{Entries: 1, HighWaterMark: 3, MaxEntries: 3}, manager.EntryCount())
+	assert.NoError(t, set("c4"))
+	assert.Equal(t, EntryCount{Entries: 2, HighWaterMark: 3, MaxEntries: 3}, manager.EntryCount())
+}
+
+// TestMaxEntriesEviction tests that only credentials of tasks that aren't tracked anymore
+// are evicted to make room for new credentials
+func TestMaxEntriesEviction(t *testing.T) {
+	tracked := map[string]bool{"t1": true, "t2": true, "t3": true}
+	var lock sync.Mutex
+	manager := NewManager(WithMaxEntries(3), WithTrackedTaskLookup(func(taskARN string) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return tracked[taskARN]
+	})).(*credentialsManager)
+	set := func(id, arn string) error {
+		return manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                arn,
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: id},
+		})
+	}
+	for i, arn := range []string{"t1", "t2", "t3"} {
+		assert.NoError(t, set(fmt.Sprintf("c%d", i+1), arn))
+	}
+	assert.ErrorIs(t, set("c4", "t4"), ErrMaxEntriesExceeded, "credentials of tracked tasks must not be evicted")
+
+	lock.Lock()
+	delete(tracked, "t2")
+	lock.Unlock()
+	assert.NoError(t, set("c4", "t4"))
+	_, ok := manager.GetTaskCredentials("c2")
+	assert.False(t, ok, "credentials of the untracked task should be evicted")
+	assert.True(t, manager.IsCredentialsRetired("c2"))
+	for _, id := range []string{"c1", "c3", "c4"} {
+		_, ok := manager.GetTaskCredentials(id)
+		assert.True(t, ok, id)
+	}
+	assert.Equal(t, 3, manager.EntryCount().Entries)
+}
+
+// TestConcurrentMaxEntries tests that the maximum number of credentials isn't exceeded
+// by concurrent updates
+func TestConcurrentMaxEntries(t *testing.T) {
+	manager := NewManager(WithMaxEntries(50)).(*credentialsManager)
+	var wg sync.WaitGroup
+	var refused int64
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+				ARN:                "t",
+				IAMRoleCredentials: IAMRoleCredentials{CredentialsID: fmt.Sprintf("c%d", i)},
+			})
+			if err != nil {
+				atomic.AddInt64(&refused, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(150), refused)
+	assert.Equal(t, EntryCount{Entries: 50, HighWaterMark: 50, MaxEntries: 50}, manager.EntryCount())
+}
+
+// TestConcurrentMaxEntriesEviction tests that the maximum number of credentials isn't
+// exceeded by concurrent updates of credentials that are being evicted
+func TestConcurrentMaxEntriesEviction(t *testing.T) {
+	manager := NewManager(WithMaxEntries(10), WithTrackedTaskLookup(func(string) bool {
+		return false
+	})).(*credentialsManager)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+					ARN:                "t",
+					IAMRoleCredentials: IAMRoleCredentials{CredentialsID: fmt.Sprintf("c%d", (i+j)%30)},
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, EntryCount{Entries: 10, HighWaterMark: 10, MaxEntries: 10}, manager.EntryCount())
+}
+
+// TestForceSetTaskCredentialsMaxEntries tests that force set credentials are admitted
+// once the maximum number of credentials is reached
+func TestForceSetTaskCredentialsMaxEntries(t *testing.T) {
+	manager := NewManager(WithMaxEntries(1)).(*credentialsManager)
+	require.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t1",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "c1"},
+	}))
+	rotated := &TaskIAMRoleCredentials{
+		ARN:                "t1",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "c2"},
+	}
+	assert.ErrorIs(t, manager.SetTaskCredentials(rotated), ErrMaxEntriesExceeded)
+	require.NoError(t, manager.ForceSetTaskCredentials(rotated))
+	_, ok := manager.GetTaskCredentials("c2")
+	assert.True(t, ok)
+	assert.Equal(t, EntryCount{Entries: 2, HighWaterMark: 2, MaxEntries: 1}, manager.EntryCount())
+}
+
+func TestUnlimitedEntries(t *testing.T) {
+	manager := NewManager(WithMaxEntries(0)).(*credentialsManager)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                "t",
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: fmt.Sprintf("c%d", i)},
+		}))
+	}
+	assert.Equal(t, EntryCount{Entries: 10, HighWaterMark: 10}, manager.EntryCount())
+	assert.Equal(t, DefaultMaxEntries, NewManager().(EntryCountReporter).EntryCount().MaxEntries)
+}
+
+func TestListCredentials(t *testing.T) {
+	manager := NewManager()
+	assert.Empty(t, manager.(CredentialsLister).ListCredentials())
+	for _, id := range []string{"cid2", "cid1", "cid3"} {
+		assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN: "t-" + id,
+			IAMRoleCredentials: IAMRoleCredentials{
+				CredentialsID:   id,
+				AccessKeyID:     "akid",
+				SecretAccessKey: "skid",
+				SessionToken:    "token",
+				Expiration:      "2026-01-01T00:00:00Z",
+				RoleType:        ApplicationRoleType,
+			},
+		}))
+	}
+	manager.RemoveCredentials("cid3")
+
+	assert.Equal(t, []CredentialsSummary{
+		{CredentialsID: "cid1", TaskARN: "t-cid1", RoleType: ApplicationRoleType, Expiration: "2026-01-01T00:00:00Z"},
+		{CredentialsID: "cid2", TaskARN: "t-cid2", RoleType: ApplicationRoleType, Expiration: "2026-01-01T00:00:00Z"},
+	}, manager.(CredentialsLister).ListCredentials())
+}
+
+func TestSnapshotCredentials(t *testing.T) {
+	manager := NewManager()
+	assert.Empty(t, manager.(CredentialsSnapshotter).SnapshotCredentials())
+	for _, id := range []string{"cid2", "cid1", "cid3"} {
+		assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN: "t-" + id,
+			IAMRoleCredentials: IAMRoleCredentials{
+				CredentialsID:   id,
+				RoleArn:         "r-" + id,
+				AccessKeyID:     "akid",
+				SecretAccessKey: "skid",
+				SessionToken:    "token",
+				Expiration:      "2026-01-01T00:00:00Z",
+				RoleType:        ApplicationRoleType,
+			},
+		}))
+	}
+	assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t-cid2",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid2", RoleArn: "r-cid2", RoleType: ExecutionRoleType},
+	}))
+	manager.RemoveCredentials("cid3")
+
+	assert.Equal(t, []CredentialsMetadata{
+		{CredentialsID: "cid1", TaskARN: "t-cid1", RoleARN: "r-cid1", RoleType: ApplicationRoleType,
+			Expiration: "2026-01-01T00:00:00Z", Revision: 1},
+		{CredentialsID: "cid2", TaskARN: "t-cid2", RoleARN: "r-cid2", RoleType: ExecutionRoleType, Revision: 2},
+	}, manager.(CredentialsSnapshotter).SnapshotCredentials())
+}
+
+// Tests that snapshots reflect the credentials held at a single point in time while
+// credentials are updated. The credentials of the first id are always updated before
+// those of the second one, so no consistent snapshot has the second one ahead.
+func TestSnapshotCredentialsConsistency(t *testing.T) {
+	manager := NewManager()
+	snapshotter := manager.(CredentialsSnapshotter)
+	// The ids are in different shards so that they aren't read under the same lock anyway
+	first, second := "cid-first", "cid-second"
+	for i := 0; manager.(*credentialsManager).shardFor(first) == manager.(*credentialsManager).shardFor(second); i++ {
+		second = fmt.Sprintf("cid-second-%d", i)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, id := range []string{first, second} {
+				assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+					ARN:                "t1",
+					IAMRoleCredentials: IAMRoleCredentials{CredentialsID: id},
+				}))
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		revisions := make(map[string]uint64)
+		for _, metadata := range snapshotter.SnapshotCredentials() {
+			revisions[metadata.CredentialsID] = metadata.Revision
+		}
+		if revisions[second] > revisions[first] || revisions[first]-revisions[second] > 1 {
+			t.Errorf("inconsistent snapshot: revision %d of %s, revision %d of %s",
+				revisions[first], first, revisions[second], second)
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestGetAllCredentialsForTaskARN tests that all the credentials held for a task are
+// retrieved by its arn, for tasks with zero, one and two credentials sets, and that
+// removing or moving the credentials of one role doesn't affect the other role.
+func TestGetAllCredentialsForTaskARN(t *testing.T) {
+	manager := NewManager()
+	setCredentials := func(arn, id, roleType string) {
+		require.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN: arn,
+			IAMRoleCredentials: IAMRoleCredentials{
+				CredentialsID: id,
+				AccessKeyID:   "akid-" + id,
+				RoleType:      roleType,
+			},
+		}))
+	}
+	ids := func(allCredentials []TaskIAMRoleCredentials) []string {
+		ids := []string{}
+		for _, taskCredentials := range allCredentials {
+			ids = append(ids, taskCredentials.IAMRoleCredentials.CredentialsID)
+		}
+		return ids
+	}
+	setCredentials("t-both", "cid-task", ApplicationRoleType)
+	setCredentials("t-both", "cid-execution", ExecutionRoleType)
+	setCredentials("t-one", "cid-one", ExecutionRoleType)
+
+	assert.Empty(t, manager.GetAllCredentialsForTaskARN("t-none"))
+	assert.Equal(t, []string{"cid-one"}, ids(manager.GetAllCredentialsForTaskARN("t-one")))
+	allCredentials := manager.GetAllCredentialsForTaskARN("t-both")
+	require.Len(t, allCredentials, 2)
+	assert.Equal(t, []string{"cid-task", "cid-execution"}, ids(allCredentials))
+	assert.Equal(t, "akid-cid-execution", allCredentials[1].IAMRoleCredentials.AccessKeyID)
+	assert.Equal(t, uint64(1), allCredentials[1].Revision)
+
+	// Removing the credentials of one role keeps the credentials of the other one
+	manager.RemoveCredentials("cid-task")
+	assert.Equal(t, []string{"cid-execution"}, ids(manager.GetAllCredentialsForTaskARN("t-both")))
+	taskCredentials, ok := manager.GetTaskCredentials("cid-execution")
+	assert.True(t, ok)
+	assert.Equal(t, "t-both", taskCredentials.ARN)
+
+	// Credentials held for a task aren't held for another task that they're set for
+	assert.Error(t, manager.ForceSetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t-one",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid-execution", RoleType: ExecutionRoleType},
+	}))
+	assert.Equal(t, []string{"cid-execution"}, ids(manager.GetAllCredentialsForTaskARN("t-both")))
+	assert.Equal(t, []string{"cid-one"}, ids(manager.GetAllCredentialsForTaskARN("t-one")))
+
+	manager.RemoveCredentials("cid-execution")
+	manager.RemoveCredentials("cid-one")
+	assert.Empty(t, manager.GetAllCredentialsForTaskARN("t-both"))
+	assert.Empty(t, manager.GetAllCredentialsForTaskARN("t-one"))
+	assert.Empty(t, manager.(*credentialsManager).arnIndex)
+}
+
+// TestGetTaskCredentialsForRole tests that the credentials of the other roles of the task
+// of credentials are selected, only if they are of the same role type.
+func TestGetTaskCredentialsForRole(t *testing.T) {
+	manager := NewManager()
+	for _, taskCredentials := range []TaskIAMRoleCredentials{
+		{ARN: "t1", IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid-primary", RoleArn: "role-primary",
+			RoleType: ApplicationRoleType}},
+		{ARN: "t1", IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid-secondary", RoleArn: "role-secondary",
+			RoleType: ApplicationRoleType}},
+		{ARN: "t1", IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid-execution", RoleArn: "role-execution",
+			RoleType: ExecutionRoleType}},
+		{ARN: "t2", IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid-other", RoleArn: "role-other",
+			RoleType: ApplicationRoleType}},
+	} {
+		taskCredentials := taskCredentials
+		require.NoError(t, manager.SetTaskCredentials(&taskCredentials))
+	}
+	selector := manager.(RoleCredentialsSelector)
+
+	for _, tc := range []struct {
+		roleARN    string
+		expectedID string
+	}{
+		{roleARN: "role-primary", expectedID: "cid-primary"},
+		{roleARN: "role-secondary", expectedID: "cid-secondary"},
+		// The execution role is of another role type, and the other role of another task
+		{roleARN: "role-execution"},
+		{roleARN: "role-other"},
+		{roleARN: "role-unknown"},
+	} {
+		t.Run(tc.roleARN, func(t *testing.T) {
+			taskCredentials, ok := selector.GetTaskCredentialsForRole("cid-primary", tc.roleARN)
+			assert.Equal(t, tc.expectedID != "", ok)
+			assert.Equal(t, tc.expectedID, taskCredentials.IAMRoleCredentials.CredentialsID)
+		})
+	}
+
+	_, ok := selector.GetTaskCredentialsForRole("cid-unknown", "role-primary")
+	assert.False(t, ok)
+}
+
+// TestSetTaskCredentialsRotation tests that credentials are rotated for the task that
+// they are held for, by both SetTaskCredentials and ForceSetTaskCredentials.
+func TestSetTaskCredentialsRotation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// No collision is recorded
+	manager := NewManager(WithMetricsFactory(mock_metrics.NewMockEntryFactory(ctrl)))
+
+	for i, set := range []func(*TaskIAMRoleCredentials) error{
+		manager.SetTaskCredentials,
+		manager.ForceSetTaskCredentials,
+		manager.SetTaskCredentials,
+	} {
+		require.NoError(t, set(&TaskIAMRoleCredentials{
+			ARN:                "t1",
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid1", AccessKeyID: fmt.Sprintf("akid%d", i)},
+		}))
+	}
+	taskCredentials, ok := manager.GetTaskCredentials("cid1")
+	require.True(t, ok)
+	assert.Equal(t, "t1", taskCredentials.ARN)
+	assert.Equal(t, "akid2", taskCredentials.IAMRoleCredentials.AccessKeyID)
+	assert.Equal(t, uint64(3), taskCredentials.Revision)
+}
+
+// TestSetTaskCredentialsCollision tests that credentials aren't set for a credentials id
+// that is held for another task, unless they are force set, and that the collision is
+// recorded.
+func TestSetTaskCredentialsCollision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	metricsFactory := mock_metrics.NewMockEntryFactory(ctrl)
+	entry := mock_metrics.NewMockEntry(ctrl)
+	manager := NewManager(WithMetricsFactory(metricsFactory))
+
+	require.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t1",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid1", AccessKeyID: "akid1"},
+	}))
+
+	flushed := false
+	metricsFactory.EXPECT().New(metrics.CredentialsIDCollisionMetricName).Return(entry).Times(2)
+	entry.EXPECT().Done(gomock.Any()).DoAndReturn(func(err error) func() {
+		assert.ErrorIs(t, err, ErrCredentialsIDCollision)
+		return func() { flushed = true }
+	}).Times(2)
+	err := manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t2",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid1", AccessKeyID: "akid2"},
+	})
+	assert.ErrorIs(t, err, ErrCredentialsIDCollision)
+	assert.True(t, flushed, "collision metric was not flushed")
+
+	// The credentials of the first task are still served
+	taskCredentials, ok := manager.GetTaskCredentials("cid1")
+	require.True(t, ok)
+	assert.Equal(t, "t1", taskCredentials.ARN)
+	assert.Equal(t, "akid1", taskCredentials.IAMRoleCredentials.AccessKeyID)
+	assert.Empty(t, manager.GetAllCredentialsForTaskARN("t2"))
+
+	// Force set credentials aren't reassigned to the other task either
+	flushed = false
+	err = manager.ForceSetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t2",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid1", AccessKeyID: "akid2"},
+	})
+	assert.ErrorIs(t, err, ErrCredentialsIDCollision)
+	assert.True(t, flushed, "collision metric was not flushed")
+	taskCredentials, ok = manager.GetTaskCredentials("cid1")
+	require.True(t, ok)
+	assert.Equal(t, "t1", taskCredentials.ARN)
+	assert.Equal(t, "akid1", taskCredentials.IAMRoleCredentials.AccessKeyID)
+	assert.Empty(t, manager.GetAllCredentialsForTaskARN("t2"))
+	assert.Equal(t, 1, manager.(EntryCountReporter).EntryCount().Entries)
+}
+
+// TestSetTaskCredentialsIncrementsRevision tests that the revision of credentials
+// is incremented every time the credentials for a credentials id are updated
+func TestSetTaskCredentialsIncrementsRevision(t *testing.T) {
+	manager := NewManager()
+	for i := 1; i <= 3; i++ {
+		err := manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN: "t1",
+			IAMRoleCredentials: IAMRoleCredentials{
+				AccessKeyID:   fmt.Sprintf("akid%d", i),
+				CredentialsID: "cid1",
+			},
+		})
+		assert.NoError(t, err, "Error setting credentials")
+
+		credentialsFromManager, ok := manager.GetTaskCredentials("cid1")
+		assert.True(t, ok, "GetTaskCredentials returned false for existing credentials")
+		assert.Equal(t, uint64(i), credentialsFromManager.Revision)
+		assert.Equal(t, fmt.Sprintf("akid%d", i), credentialsFromManager.IAMRoleCredentials.AccessKeyID)
+	}
+
+	// Revisions are tracked per credentials id
+	err := manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t2",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid2"},
+	})
+	assert.NoError(t, err, "Error setting credentials")
+	credentialsFromManager, ok := manager.GetTaskCredentials("cid2")
+	assert.True(t, ok, "GetTaskCredentials returned false for existing credentials")
+	assert.Equal(t, uint64(1), credentialsFromManager.Revision)
+}
+
+func TestPermitsService(t *testing.T) {
+	noScope := TaskIAMRoleCredentials{}
+	_, scoped := noScope.PermitsService("s3")
+	assert.False(t, scoped)
+
+	withScope := TaskIAMRoleCredentials{ServiceScope: []string{"s3", "DynamoDB"}}
+	permitted, scoped := withScope.PermitsService("dynamodb")
+	assert.True(t, scoped)
+	assert.True(t, permitted)
+	permitted, scoped = withScope.PermitsService("sqs")
+	assert.True(t, scoped)
+	assert.False(t, permitted)
+}
+
+func TestNotYetActive(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name      string
+		notBefore time.Time
+		expected  bool
+	}{
+		{name: "future activation time", notBefore: now.Add(time.Minute), expected: true},
+		{name: "current activation time", notBefore: now, expected: false},
+		{name: "past activation time", notBefore: now.Add(-time.Minute), expected: false},
+		{name: "no activation time", expected: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			creds := TaskIAMRoleCredentials{NotBefore: tc.notBefore}
+			assert.Equal(t, tc.expected, creds.NotYetActive(now))
+		})
+	}
+}
+
+func TestSetAndGetTaskCredentialsNotBefore(t *testing.T) {
+	manager := NewManager()
+	notBefore := time.Now().Add(time.Minute)
+	err := manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t1",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid1"},
+		NotBefore:          notBefore,
+	})
+	assert.NoError(t, err)
+	creds, ok := manager.GetTaskCredentials("cid1")
+	assert.True(t, ok)
+	assert.True(t, notBefore.Equal(creds.NotBefore))
+}
+
+func TestSetAndGetTaskCredentialsGeneratedAt(t *testing.T) {
+	manager := NewManager()
+	generatedAt := time.Now().Add(-time.Minute)
+	err := manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+		ARN:                "t1",
+		IAMRoleCredentials: IAMRoleCredentials{CredentialsID: "cid1"},
+		GeneratedAt:        generatedAt,
+	})
+	assert.NoError(t, err)
+	creds, ok := manager.GetTaskCredentials("cid1")
+	assert.True(t, ok)
+	assert.True(t, generatedAt.Equal(creds.GeneratedAt))
+}
+
+// Tests that concurrent lookups and updates of credentials across many credentials ids
+// always observe consistent credentials. Run with -race to detect data races.
+func TestConcurrentSetAndGetTaskCredentials(t *testing.T) {
+	const (
+		ids       = 64
+		revisions = 50
+	)
+	manager := NewManager()
+	var wg sync.WaitGroup
+	for i := 0; i < ids; i++ {
+		id := fmt.Sprintf("cid%d", i)
+		taskARN := fmt.Sprintf("t%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for revision := 1; revision <= revisions; revision++ {
+				assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+					ARN: taskARN,
+					IAMRoleCredentials: IAMRoleCredentials{
+						CredentialsID: id,
+						AccessKeyID:   fmt.Sprintf("akid%d", revision),
+					},
+				}))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			var lastRevision uint64
+			for lastRevision < revisions {
+				credentials, ok := manager.GetTaskCredentials(id)
+				if !ok {
+					continue
+				}
+				assert.Equal(t, taskARN, credentials.ARN)
+				assert.Equal(t, fmt.Sprintf("akid%d", credentials.Revision),
+					credentials.IAMRoleCredentials.AccessKeyID)
+				assert.GreaterOrEqual(t, credentials.Revision, lastRevision)
+				lastRevision = credentials.Revision
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < ids; i++ {
+		id := fmt.Sprintf("cid%d", i)
+		credentials, ok := manager.GetTaskCredentials(id)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(revisions), credentials.Revision)
+		manager.RemoveCredentials(id)
+		_, ok = manager.GetTaskCredentials(id)
+		assert.False(t, ok)
+	}
+}
+
+// Tests that credentials ids are spread across shards.
+func TestCredentialsShardDistribution(t *testing.T) {
+	manager := NewManager().(*credentialsManager)
+	for i := 0; i < 10*credentialsShardCount; i++ {
+		err := manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                "t1",
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: uuid.New()},
+		})
+		assert.NoError(t, err)
+	}
+	for i := range manager.shards {
+		assert.NotEmpty(t, manager.shards[i].idToTaskCredentials, "shard %d is empty", i)
+	}
+}
+
+// Tests that lookups of credentials are not blocked by updates of credentials in other shards.
+func TestGetTaskCredentialsNotBlockedByOtherShards(t *testing.T) {
+	manager := NewManager().(*credentialsManager)
+	lockedID, otherID := "cid0", ""
+	for i := 1; otherID == ""; i++ {
+		id := fmt.Sprintf("cid%d", i)
+		if manager.shardFor(id) != manager.shardFor(lockedID) {
+			otherID = id
+		}
+	}
+	for _, id := range []string{lockedID, otherID} {
+		assert.NoError(t, manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+			ARN:                "t1",
+			IAMRoleCredentials: IAMRoleCredentials{CredentialsID: id},
+		}))
+	}
+
+	// Hold the lock of one shard as a long running update would
+	lockedShard := manager.shardFor(lockedID)
+	lockedShard.taskCredentialsLock.Lock()
+	defer lockedShard.taskCredentialsLock.Unlock()
+
+	done := make(chan bool)
+	go func() {
+		_, ok := manager.GetTaskCredentials(otherID)
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		assert.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lookup was blocked by an update in another shard")
+	}
+}
+
+// globalLockManager is a credentials store guarded by a single lock, used as a baseline
+// for measuring lock contention in the credentials manager.
+type globalLockManager struct {
+	credentialsShard
+}
+
+func (manager *globalLockManager) SetTaskCredentials(taskCredentials *TaskIAMRoleCredentials) error {
+	manager.taskCredentialsLock.Lock()
+	defer manager.taskCredentialsLock.Unlock()
+	manager.idToTaskCredentials[taskCredentials.IAMRoleCredentials.CredentialsID] = *taskCredentials
+	return nil
+}
+
+func (manager *globalLockManager) ForceSetTaskCredentials(taskCredentials *TaskIAMRoleCredentials) error {
+	return manager.SetTaskCredentials(taskCredentials)
+}
+
+func (manager *globalLockManager) GetTaskCredentials(id string) (TaskIAMRoleCredentials, bool) {
+	manager.taskCredentialsLock.RLock()
+	defer manager.taskCredentialsLock.RUnlock()
+	taskCredentials, ok := manager.idToTaskCredentials[id]
+	return taskCredentials, ok
+}
+
+func (manager *globalLockManager) GetAllCredentialsForTaskARN(arn string) []TaskIAMRoleCredentials {
+	manager.taskCredentialsLock.RLock()
+	defer manager.taskCredentialsLock.RUnlock()
+	var allCredentials []TaskIAMRoleCredentials
+	for _, taskCredentials := range manager.idToTaskCredentials {
+		if taskCredentials.ARN == arn {
+			allCredentials = append(allCredentials, taskCredentials)
+		}
+	}
+	return allCredentials
+}
+
+func (manager *globalLockManager) RemoveCredentials(id string) {
+	manager.taskCredentialsLock.Lock()
+	defer manager.taskCredentialsLock.Unlock()
+	delete(manager.idToTaskCredentials, id)
+}
+
+// Benchmarks concurrent credentials lookups across many tasks while credentials are being
+// refreshed, comparing the credentials manager against a store with a single lock.
+func BenchmarkConcurrentGetTaskCredentials(b *testing.B) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("cid%d", i)
+	}
+	for _, bc := range []struct {
+		name    string
+		manager Manager
+	}{
+		{
+			name: "global lock",
+			manager: &globalLockManager{credentialsShard{
+				idToTaskCredentials: make(map[string]TaskIAMRoleCredentials),
+			}},
+		},
+		{name: "sharded", manager: NewManager()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for _, id := range ids {
+				bc.manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+					ARN:                "t1",
+					IAMRoleCredentials: IAMRoleCredentials{CredentialsID: id},
+				})
+			}
+			var next uint32
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddUint32(&next, 1))
+				for pb.Next() {
+					i++
+					id := ids[i%len(ids)]
+					// One in ten requests is a credentials refresh
+					if i%10 == 0 {
+						bc.manager.SetTaskCredentials(&TaskIAMRoleCredentials{
+							ARN:                "t1",
+							IAMRoleCredentials: IAMRoleCredentials{CredentialsID: id},
+						})
+						continue
+					}
+					bc.manager.GetTaskCredentials(id)
+				}
+			})
+		})
+	}
+}
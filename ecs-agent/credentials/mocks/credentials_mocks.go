@@ -48,6 +48,34 @@ func (m *MockManager) EXPECT() *MockManagerMockRecorder {
 	return m.recorder
 }
 
+// ForceSetTaskCredentials mocks base method.
+func (m *MockManager) ForceSetTaskCredentials(arg0 *credentials.TaskIAMRoleCredentials) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForceSetTaskCredentials", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForceSetTaskCredentials indicates an expected call of ForceSetTaskCredentials.
+func (mr *MockManagerMockRecorder) ForceSetTaskCredentials(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceSetTaskCredentials", reflect.TypeOf((*MockManager)(nil).ForceSetTaskCredentials), arg0)
+}
+
+// GetAllCredentialsForTaskARN mocks base method.
+func (m *MockManager) GetAllCredentialsForTaskARN(arg0 string) []credentials.TaskIAMRoleCredentials {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllCredentialsForTaskARN", arg0)
+	ret0, _ := ret[0].([]credentials.TaskIAMRoleCredentials)
+	return ret0
+}
+
+// GetAllCredentialsForTaskARN indicates an expected call of GetAllCredentialsForTaskARN.
+func (mr *MockManagerMockRecorder) GetAllCredentialsForTaskARN(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllCredentialsForTaskARN", reflect.TypeOf((*MockManager)(nil).GetAllCredentialsForTaskARN), arg0)
+}
+
 // GetTaskCredentials mocks base method.
 func (m *MockManager) GetTaskCredentials(arg0 string) (credentials.TaskIAMRoleCredentials, bool) {
 	m.ctrl.T.Helper()
@@ -16,14 +16,26 @@
 package audit
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
+	"github.com/cihub/seelog"
 )
 
+// Audit log event types for credentials requests
 const (
-	GetCredentialsEventType                = "GetCredentials"
-	GetCredentialsTaskExecutionEventType   = "GetCredentialsExecutionRole"
+	// GetCredentialsEventType is logged for requests for task role credentials
+	GetCredentialsEventType = "GetCredentials"
+	// GetCredentialsTaskExecutionEventType is logged for requests for task execution role credentials
+	GetCredentialsTaskExecutionEventType = "GetCredentialsExecutionRole"
+	// GetCredentialsInvalidRoleTypeEventType is logged for requests that fail before the role
+	// type is known
 	GetCredentialsInvalidRoleTypeEventType = "GetCredentialsInvalidRoleType"
+	// GetCredentialsUnknownRoleTypeEventType is logged for requests for credentials of a role
+	// type that has no event type mapping
+	GetCredentialsUnknownRoleTypeEventType = "GetCredentialsUnknownRoleType"
 )
 
 type AuditLogger interface {
@@ -32,14 +44,102 @@ type AuditLogger interface {
 	GetCluster() string
 }
 
-// Returns a suitable audit log event type for the credentials role type
+// roleTypeEventTypes is the registry of the event types that requests for credentials of
+// each role type are logged with
+var roleTypeEventTypes = struct {
+	lock sync.RWMutex
+	// mappings maps role types to event types, and registered lists the role types that
+	// were registered with RegisterRoleTypeEventMapping, in the order of registration
+	mappings   map[string]string
+	registered []string
+	// unmapped lists the role types without a mapping that requests were logged for, so
+	// that the missing mapping is warned about once per role type
+	unmapped map[string]bool
+}{
+	mappings: map[string]string{
+		credentials.ApplicationRoleType: GetCredentialsEventType,
+		credentials.ExecutionRoleType:   GetCredentialsTaskExecutionEventType,
+	},
+	unmapped: make(map[string]bool),
+}
+
+// RegisterRoleTypeEventMapping registers the event type that requests for credentials of
+// the role type are logged with. Mappings can't be overridden, so an error is returned if
+// the role type already has a mapping, including the built-in mappings.
+func RegisterRoleTypeEventMapping(roleType, eventType string) error {
+	if roleType == "" || eventType == "" {
+		return fmt.Errorf("role type and event type must not be empty")
+	}
+	roleTypeEventTypes.lock.Lock()
+	defer roleTypeEventTypes.lock.Unlock()
+	if existing, ok := roleTypeEventTypes.mappings[roleType]; ok {
+		return fmt.Errorf("role type %s is already mapped to event type %s", roleType, existing)
+	}
+	roleTypeEventTypes.mappings[roleType] = eventType
+	roleTypeEventTypes.registered = append(roleTypeEventTypes.registered, roleType)
+	return nil
+}
+
+// GetCredentialsEventTypes returns all the event types that credentials requests are logged
+// with, including the registered ones. Requests that are rejected before being handled,
+// such as throttled requests, are logged with an empty event type.
+func GetCredentialsEventTypes() []string {
+	eventTypes := []string{
+		GetCredentialsEventType,
+		GetCredentialsTaskExecutionEventType,
+		GetCredentialsInvalidRoleTypeEventType,
+		GetCredentialsUnknownRoleTypeEventType,
+	}
+	roleTypeEventTypes.lock.RLock()
+	defer roleTypeEventTypes.lock.RUnlock()
+	seen := make(map[string]bool, len(eventTypes))
+	for _, eventType := range eventTypes {
+		seen[eventType] = true
+	}
+	for _, roleType := range roleTypeEventTypes.registered {
+		if eventType := roleTypeEventTypes.mappings[roleType]; !seen[eventType] {
+			seen[eventType] = true
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	return eventTypes
+}
+
+// IsCredentialsEventType returns true if the event type is one of GetCredentialsEventTypes.
+func IsCredentialsEventType(eventType string) bool {
+	for _, credentialsEventType := range GetCredentialsEventTypes() {
+		if eventType == credentialsEventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a suitable audit log event type for the credentials role type. The event type is
+// always one of GetCredentialsEventTypes. An empty role type means that the request failed
+// before the role type was known.
 func GetCredentialsEventTypeFromRoleType(roleType string) string {
-	switch roleType {
-	case credentials.ApplicationRoleType:
-		return GetCredentialsEventType
-	case credentials.ExecutionRoleType:
-		return GetCredentialsTaskExecutionEventType
-	default:
+	if roleType == "" {
 		return GetCredentialsInvalidRoleTypeEventType
 	}
+	roleTypeEventTypes.lock.RLock()
+	eventType, ok := roleTypeEventTypes.mappings[roleType]
+	warned := roleTypeEventTypes.unmapped[roleType]
+	roleTypeEventTypes.lock.RUnlock()
+	if ok {
+		return eventType
+	}
+	if !warned {
+		roleTypeEventTypes.lock.Lock()
+		warned = roleTypeEventTypes.unmapped[roleType]
+		roleTypeEventTypes.unmapped[roleType] = true
+		roleTypeEventTypes.lock.Unlock()
+	}
+	if warned {
+		seelog.Debugf("No audit log event type is registered for credentials role type %s", roleType)
+	} else {
+		seelog.Warnf("No audit log event type is registered for credentials role type %s, "+
+			"requests are logged with event type %s", roleType, GetCredentialsUnknownRoleTypeEventType)
+	}
+	return GetCredentialsUnknownRoleTypeEventType
 }
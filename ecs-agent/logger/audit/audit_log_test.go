@@ -0,0 +1,140 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCredentialsEventTypes(t *testing.T) {
+	eventTypes := GetCredentialsEventTypes()
+	assert.ElementsMatch(t, []string{
+		"GetCredentials",
+		"GetCredentialsExecutionRole",
+		"GetCredentialsInvalidRoleType",
+		"GetCredentialsUnknownRoleType",
+	}, eventTypes)
+
+	// Callers must not be able to modify the set through the returned slice
+	eventTypes[0] = "Modified"
+	assert.Contains(t, GetCredentialsEventTypes(), GetCredentialsEventType)
+}
+
+// Tests that the event type for any role type is one of the enumerated event types.
+func TestGetCredentialsEventTypeFromRoleTypeIsEnumerated(t *testing.T) {
+	for roleType, expected := range map[string]string{
+		credentials.ApplicationRoleType: GetCredentialsEventType,
+		credentials.ExecutionRoleType:   GetCredentialsTaskExecutionEventType,
+		"":                              GetCredentialsInvalidRoleTypeEventType,
+		"TaskApplicationRole":           GetCredentialsUnknownRoleTypeEventType,
+		"taskexecution":                 GetCredentialsUnknownRoleTypeEventType,
+		"ContainerInstance":             GetCredentialsUnknownRoleTypeEventType,
+	} {
+		t.Run(roleType, func(t *testing.T) {
+			eventType := GetCredentialsEventTypeFromRoleType(roleType)
+			assert.Equal(t, expected, eventType)
+			assert.Contains(t, GetCredentialsEventTypes(), eventType)
+		})
+	}
+}
+
+// resetRoleTypeEventMappings removes the registered role type mappings at the end of a test
+func resetRoleTypeEventMappings(t *testing.T) {
+	t.Cleanup(func() {
+		roleTypeEventTypes.lock.Lock()
+		defer roleTypeEventTypes.lock.Unlock()
+		for _, roleType := range roleTypeEventTypes.registered {
+			delete(roleTypeEventTypes.mappings, roleType)
+		}
+		roleTypeEventTypes.registered = nil
+		roleTypeEventTypes.unmapped = make(map[string]bool)
+	})
+}
+
+func TestRegisterRoleTypeEventMapping(t *testing.T) {
+	resetRoleTypeEventMappings(t)
+	assert.Equal(t, GetCredentialsUnknownRoleTypeEventType, GetCredentialsEventTypeFromRoleType("ServiceLinkedEphemeral"))
+
+	require.NoError(t, RegisterRoleTypeEventMapping("ServiceLinkedEphemeral", "GetCredentialsServiceLinkedEphemeral"))
+	require.NoError(t, RegisterRoleTypeEventMapping("ServiceLinkedEphemeralV2", "GetCredentialsServiceLinkedEphemeral"))
+	assert.Equal(t, "GetCredentialsServiceLinkedEphemeral", GetCredentialsEventTypeFromRoleType("ServiceLinkedEphemeral"))
+	assert.Equal(t, "GetCredentialsServiceLinkedEphemeral", GetCredentialsEventTypeFromRoleType("ServiceLinkedEphemeralV2"))
+	// Registered event types are enumerated once
+	assert.Equal(t, []string{
+		GetCredentialsEventType,
+		GetCredentialsTaskExecutionEventType,
+		GetCredentialsInvalidRoleTypeEventType,
+		GetCredentialsUnknownRoleTypeEventType,
+		"GetCredentialsServiceLinkedEphemeral",
+	}, GetCredentialsEventTypes())
+	// The built-in mappings are kept
+	assert.Equal(t, GetCredentialsEventType, GetCredentialsEventTypeFromRoleType(credentials.ApplicationRoleType))
+}
+
+func TestRegisterRoleTypeEventMappingRejectsOverrides(t *testing.T) {
+	resetRoleTypeEventMappings(t)
+	require.NoError(t, RegisterRoleTypeEventMapping("ServiceLinkedEphemeral", "GetCredentialsServiceLinkedEphemeral"))
+
+	for _, tc := range []struct {
+		name      string
+		roleType  string
+		eventType string
+	}{
+		{name: "registered role type", roleType: "ServiceLinkedEphemeral", eventType: "GetCredentialsOther"},
+		{name: "built-in role type", roleType: credentials.ApplicationRoleType, eventType: "GetCredentialsOther"},
+		{name: "empty role type", roleType: "", eventType: "GetCredentialsOther"},
+		{name: "empty event type", roleType: "Other", eventType: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, RegisterRoleTypeEventMapping(tc.roleType, tc.eventType))
+		})
+	}
+	assert.Equal(t, "GetCredentialsServiceLinkedEphemeral", GetCredentialsEventTypeFromRoleType("ServiceLinkedEphemeral"))
+	assert.Equal(t, GetCredentialsEventType, GetCredentialsEventTypeFromRoleType(credentials.ApplicationRoleType))
+	assert.Equal(t, GetCredentialsUnknownRoleTypeEventType, GetCredentialsEventTypeFromRoleType("Other"))
+}
+
+func TestIsCredentialsEventType(t *testing.T) {
+	resetRoleTypeEventMappings(t)
+	require.NoError(t, RegisterRoleTypeEventMapping("ServiceLinkedEphemeral", "GetCredentialsServiceLinkedEphemeral"))
+
+	for _, eventType := range []string{
+		GetCredentialsEventType,
+		GetCredentialsTaskExecutionEventType,
+		GetCredentialsInvalidRoleTypeEventType,
+		GetCredentialsUnknownRoleTypeEventType,
+		"GetCredentialsServiceLinkedEphemeral",
+	} {
+		assert.True(t, IsCredentialsEventType(eventType), eventType)
+	}
+	assert.False(t, IsCredentialsEventType(""))
+	assert.False(t, IsCredentialsEventType("GetCredentialsOther"))
+}
+
+func TestUnmappedRoleTypeIsRecordedOnce(t *testing.T) {
+	resetRoleTypeEventMappings(t)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, GetCredentialsUnknownRoleTypeEventType, GetCredentialsEventTypeFromRoleType("Other"))
+	}
+	roleTypeEventTypes.lock.RLock()
+	defer roleTypeEventTypes.lock.RUnlock()
+	assert.Equal(t, map[string]bool{"Other": true}, roleTypeEventTypes.unmapped)
+}
@@ -18,4 +18,9 @@ import "net/http"
 type LogRequest struct {
 	Request *http.Request
 	ARN     string
+	// APIVersion is the version of the TMDS API that handled the request, such as "v1"
+	APIVersion string
+	// Body is the request body, for requests whose body is logged. It is scrubbed of
+	// secrets before it is written to the audit log.
+	Body []byte
 }
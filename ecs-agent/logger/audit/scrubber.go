@@ -0,0 +1,92 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import "regexp"
+
+// ScrubbedValue replaces the secrets that are scrubbed from audit logged request bodies.
+const ScrubbedValue = "[REDACTED]"
+
+// BodyScrubber removes secrets from request bodies before they are audit logged.
+type BodyScrubber interface {
+	Scrub(body []byte) []byte
+}
+
+// BodyScrubberFunc is an adapter to use functions as body scrubbers.
+type BodyScrubberFunc func(body []byte) []byte
+
+// Scrub calls f(body).
+func (f BodyScrubberFunc) Scrub(body []byte) []byte {
+	return f(body)
+}
+
+// ScrubRule replaces the matches of Pattern with Replacement, which can refer to the
+// submatches of Pattern like regexp.Regexp.ReplaceAll replacements do.
+type ScrubRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// secretName matches the names of fields that hold secrets.
+const secretName = `[A-Za-z0-9_\-]*(?i:secret|password|passwd|token|credential|private_?key|api_?key)[A-Za-z0-9_\-]*`
+
+// DefaultScrubRules are the rules of the default body scrubber. They scrub the values of
+// JSON fields and form or query parameters whose names look like they hold secrets, as
+// well as AWS access key IDs, bearer tokens and PEM private keys found anywhere.
+var DefaultScrubRules = []ScrubRule{
+	{
+		Pattern:     regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		Replacement: ScrubbedValue,
+	},
+	{
+		Pattern:     regexp.MustCompile(`("` + secretName + `"\s*:\s*)"(?:[^"\\]|\\.)*"`),
+		Replacement: `${1}"` + ScrubbedValue + `"`,
+	},
+	{
+		Pattern:     regexp.MustCompile(`(\b` + secretName + `=)[^&\s"]+`),
+		Replacement: `${1}` + ScrubbedValue,
+	},
+	{
+		Pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`),
+		Replacement: ScrubbedValue,
+	},
+	{
+		Pattern:     regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+		Replacement: `${1}` + ScrubbedValue,
+	},
+}
+
+// RegexpScrubber is a body scrubber that applies scrub rules in order.
+type RegexpScrubber struct {
+	rules []ScrubRule
+}
+
+// NewRegexpScrubber creates a body scrubber that applies the rules in order.
+func NewRegexpScrubber(rules ...ScrubRule) *RegexpScrubber {
+	return &RegexpScrubber{rules: append([]ScrubRule(nil), rules...)}
+}
+
+// DefaultBodyScrubber returns a body scrubber that applies DefaultScrubRules.
+func DefaultBodyScrubber() BodyScrubber {
+	return NewRegexpScrubber(DefaultScrubRules...)
+}
+
+// Scrub returns a copy of the body with the matches of the rules replaced.
+func (s *RegexpScrubber) Scrub(body []byte) []byte {
+	scrubbed := append([]byte(nil), body...)
+	for _, rule := range s.rules {
+		scrubbed = rule.Pattern.ReplaceAll(scrubbed, []byte(rule.Replacement))
+	}
+	return scrubbed
+}
@@ -0,0 +1,88 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header that carries the span context of a
+// request.
+const TraceparentHeader = "traceparent"
+
+const (
+	traceIDLength = 32
+	spanIDLength  = 16
+)
+
+// SpanContext identifies the span that a request is part of, as defined by W3C Trace
+// Context. The ids are lowercase hex strings.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of the context that carries the span context.
+func ContextWithSpanContext(ctx context.Context, spanContext SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, spanContext)
+}
+
+// SpanContextFromContext returns the span context carried by the context, if any.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	spanContext, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return spanContext, ok
+}
+
+// ParseTraceparent parses the span context of a traceparent header value. Only the fields
+// of version 00 are parsed, fields that later versions may append are ignored.
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	fields := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(fields) < 4 {
+		return SpanContext{}, fmt.Errorf("traceparent %q has %d fields, expected at least 4", traceparent, len(fields))
+	}
+	version, traceID, spanID, flags := fields[0], fields[1], fields[2], fields[3]
+	if !isLowerHex(version, 2) || version == "ff" {
+		return SpanContext{}, fmt.Errorf("traceparent version %q is invalid", version)
+	}
+	if version == "00" && len(fields) != 4 {
+		return SpanContext{}, fmt.Errorf("traceparent %q has %d fields, expected 4 for version 00", traceparent, len(fields))
+	}
+	if !isLowerHex(traceID, traceIDLength) || isAllZeros(traceID) {
+		return SpanContext{}, fmt.Errorf("traceparent trace id %q is invalid", traceID)
+	}
+	if !isLowerHex(spanID, spanIDLength) || isAllZeros(spanID) {
+		return SpanContext{}, fmt.Errorf("traceparent parent id %q is invalid", spanID)
+	}
+	if !isLowerHex(flags, 2) {
+		return SpanContext{}, fmt.Errorf("traceparent flags %q are invalid", flags)
+	}
+	return SpanContext{TraceID: traceID, SpanID: spanID}, nil
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func isAllZeros(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
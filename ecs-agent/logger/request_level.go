@@ -0,0 +1,50 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import "context"
+
+// LogLevelOverrideField is the field added to the messages that are logged at a higher
+// level than they were meant for because of a per-request log level override.
+const LogLevelOverrideField = "logLevelOverride"
+
+// debugLevelKey is the context key of the per-request log level override
+type debugLevelKey struct{}
+
+// ContextWithDebugLevel returns a copy of ctx whose debug messages logged by DebugContext are
+// written whatever the global log level is, to get verbose logs for a single request.
+func ContextWithDebugLevel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugLevelKey{}, true)
+}
+
+// DebugLevelFromContext returns whether the debug messages logged with ctx are written
+// whatever the global log level is.
+func DebugLevelFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	enabled, _ := ctx.Value(debugLevelKey{}).(bool)
+	return enabled
+}
+
+// DebugContext logs a debug message. The message is logged at info level instead, with the
+// LogLevelOverrideField field, if ctx was created with ContextWithDebugLevel, so that it's
+// written even if the global log level is above debug.
+func DebugContext(ctx context.Context, message string, fields ...Fields) {
+	if !DebugLevelFromContext(ctx) {
+		Debug(message, fields...)
+		return
+	}
+	Info(message, append(fields, Fields{LogLevelOverrideField: "debug"})...)
+}
@@ -0,0 +1,55 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cihub/seelog"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mock_seelog "github.com/aws/amazon-ecs-agent/ecs-agent/logger/mocks"
+)
+
+func TestDebugContext(t *testing.T) {
+	defer globalLoggerBackup()()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockReceiver := mock_seelog.NewMockCustomReceiver(ctrl)
+	seeLog, err := seelog.LoggerFromCustomReceiver(mockReceiver)
+	require.NoError(t, err)
+	setGlobalLogger(seeLog, logFmt)
+	mockReceiver.EXPECT().Flush().AnyTimes()
+	mockReceiver.EXPECT().Close().AnyTimes()
+
+	gomock.InOrder(
+		mockReceiver.EXPECT().ReceiveMessage(`logger=structured msg="Handling request"`,
+			seelog.LogLevel(seelog.DebugLvl), gomock.Any()),
+		mockReceiver.EXPECT().ReceiveMessage(`logger=structured msg="Handling request" logLevelOverride="debug"`,
+			seelog.LogLevel(seelog.InfoLvl), gomock.Any()),
+	)
+
+	assert.False(t, DebugLevelFromContext(context.Background()))
+	DebugContext(context.Background(), "Handling request")
+
+	ctx := ContextWithDebugLevel(context.Background())
+	assert.True(t, DebugLevelFromContext(ctx))
+	DebugContext(ctx, "Handling request")
+}
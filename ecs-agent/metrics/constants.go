@@ -22,4 +22,13 @@ const (
 	GetTaskProtectionMetricName    = metadataServerMetricNamespace + ".GetTaskProtection"
 	UpdateTaskProtectionMetricName = metadataServerMetricNamespace + ".UpdateTaskProtection"
 	AuthConfigMetricName           = metadataServerMetricNamespace + ".AuthConfig"
+	RequestLatencyMetricName       = metadataServerMetricNamespace + ".RequestLatency"
+
+	// CredentialsManager
+	credentialsManagerMetricNamespace = "CredentialsManager"
+	CredentialsIDCollisionMetricName  = credentialsManagerMetricNamespace + ".CredentialsIDCollision"
+
+	// IntrospectionServer
+	introspectionServerMetricNamespace    = "IntrospectionServer"
+	IntrospectionRequestLatencyMetricName = introspectionServerMetricNamespace + ".RequestLatency"
 )
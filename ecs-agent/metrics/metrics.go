@@ -50,6 +50,15 @@ type Entry interface {
 	Done(err error) func()
 }
 
+// ExemplarEntry is implemented by entries that can attach an exemplar to the value that
+// they record, such as the ID of the trace of the request whose latency is recorded, so
+// that dashboards can link the value to the trace.
+type ExemplarEntry interface {
+	// WithExemplar returns a copy of the entry that attaches the exemplar with the labels
+	// to the value it records.
+	WithExemplar(labels map[string]string) Entry
+}
+
 // nopEntryFactory implements the EntryFactory interface with no-ops.
 type nopEntryFactory struct{}
 
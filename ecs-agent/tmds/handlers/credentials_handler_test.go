@@ -16,19 +16,38 @@
 package v1
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
 	mock_credentials "github.com/aws/amazon-ecs-agent/ecs-agent/credentials/mocks"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
 	mock_audit "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
 	v1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
 	v2 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v2"
+	"github.com/cihub/seelog"
 	"github.com/gorilla/mux"
 
 	"github.com/golang/mock/gomock"
@@ -72,6 +91,27 @@ var getCredentialsHandlerV1 GetCredentialsHandler = func(
 	return http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger))
 }
 
+// Custom path that the v1 credentials handler is registered under in tests
+const customCredentialsPath = "/custom/base/credentials"
+
+// MakePath function for credentials endpoint v1 registered under a custom path
+var makePathV1Custom MakePath = func(credsId string) string {
+	if credsId == "" {
+		return customCredentialsPath
+	}
+	return customCredentialsPath + "?id=" + credsId
+}
+
+// GetCredentialsHandler function for v1 registered under a custom path
+var getCredentialsHandlerV1Custom GetCredentialsHandler = func(
+	credManager credentials.Manager,
+	auditLogger audit.AuditLogger,
+) http.Handler {
+	router := mux.NewRouter()
+	v1.RegisterCredentialsHandler(router, credManager, auditLogger, v1.WithPath(customCredentialsPath))
+	return router
+}
+
 // GetCredentialsHandler function for v2
 var getCredentialsHandlerV2 GetCredentialsHandler = func(
 	credManager credentials.Manager,
@@ -173,6 +213,55 @@ func credentialsUninitializedCase(
 	}
 }
 
+// Creates test cases for credentials records where only one of the task ARN and the
+// role credentials is populated
+func credentialsIncompleteCases(
+	makePath MakePath,
+	makeHandler GetCredentialsHandler,
+) []CredentialsErrorTestCase {
+	records := map[string]credentials.TaskIAMRoleCredentials{
+		"credentials record missing role credentials": {ARN: "taskArn"},
+		"credentials record missing task ARN": {
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				AccessKeyID:     "access_key_id",
+				SecretAccessKey: "secret_access_key",
+				RoleArn:         "rolearn",
+				SessionToken:    "session_token",
+				Expiration:      "expiration",
+				CredentialsID:   "credsid",
+				RoleType:        credentials.ApplicationRoleType,
+			},
+		},
+	}
+	var tcs []CredentialsErrorTestCase
+	for name, record := range records {
+		record := record
+		tcs = append(tcs, CredentialsErrorTestCase{
+			Name: name,
+			Path: makePath("credsid"),
+			GetHandler: func(
+				credManager *mock_credentials.MockManager,
+				auditLogger *mock_audit.MockAuditLogger,
+			) http.Handler {
+				auditLogger.EXPECT().Log(
+					gomock.Any(),
+					http.StatusInternalServerError,
+					audit.GetCredentialsInvalidRoleTypeEventType)
+				credManager.EXPECT().GetTaskCredentials("credsid").Return(record, true)
+
+				return makeHandler(credManager, auditLogger)
+			},
+			ExpectedStatusCode: http.StatusInternalServerError,
+			ExpectedResponse: utils.ErrorMessage{
+				Code:          v1.ErrInternalServer,
+				Message:       "Internal server error",
+				HTTPErrorCode: http.StatusInternalServerError,
+			},
+		})
+	}
+	return tcs
+}
+
 // Tests error cases for credentials endpoint v1
 func TestCredentialsHandlerErrorV1(t *testing.T) {
 	errorPrefix := "CredentialsV1Request"
@@ -181,6 +270,23 @@ func TestCredentialsHandlerErrorV1(t *testing.T) {
 		credentialsNotFoundCase(makePathV1, getCredentialsHandlerV1, errorPrefix),
 		credentialsUninitializedCase(makePathV1, getCredentialsHandlerV1, errorPrefix),
 	}
+	tcs = append(tcs, credentialsIncompleteCases(makePathV1, getCredentialsHandlerV1)...)
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			testCredentialsHandlerError(t, tc)
+		})
+	}
+}
+
+// Tests error cases for credentials endpoint v1 registered under a custom path
+func TestCredentialsHandlerErrorV1CustomPath(t *testing.T) {
+	errorPrefix := "CredentialsV1Request"
+	tcs := []CredentialsErrorTestCase{
+		noCredentialsIDCase(makePathV1Custom, getCredentialsHandlerV1Custom, errorPrefix),
+		credentialsNotFoundCase(makePathV1Custom, getCredentialsHandlerV1Custom, errorPrefix),
+		credentialsUninitializedCase(makePathV1Custom, getCredentialsHandlerV1Custom, errorPrefix),
+	}
+	tcs = append(tcs, credentialsIncompleteCases(makePathV1Custom, getCredentialsHandlerV1Custom)...)
 	for _, tc := range tcs {
 		t.Run(tc.Name, func(t *testing.T) {
 			testCredentialsHandlerError(t, tc)
@@ -196,6 +302,7 @@ func TestCredentialsHandlerErrorV2(t *testing.T) {
 		credentialsNotFoundCase(makePathV2, getCredentialsHandlerV2, errorPrefix),
 		credentialsUninitializedCase(makePathV2, getCredentialsHandlerV2, errorPrefix),
 	}
+	tcs = append(tcs, credentialsIncompleteCases(makePathV2, getCredentialsHandlerV2)...)
 	for _, tc := range tcs {
 		t.Run(tc.Name, func(t *testing.T) {
 			testCredentialsHandlerError(t, tc)
@@ -240,6 +347,63 @@ func TestCredentialsHandlerV1Success(t *testing.T) {
 	testCredentialsHandlerSuccess(t, makePathV1, getCredentialsHandlerV1)
 }
 
+// Tests happy case for credentials endpoint v1 registered under a custom path
+func TestCredentialsHandlerV1CustomPathSuccess(t *testing.T) {
+	testCredentialsHandlerSuccess(t, makePathV1Custom, getCredentialsHandlerV1Custom)
+}
+
+// Tests that the v1 credentials handler is registered under the default path
+// when no custom path is provided and not under the custom path.
+func TestRegisterCredentialsHandlerDefaultPath(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	credManager := mock_credentials.NewMockManager(ctrl)
+
+	router := mux.NewRouter()
+	v1.RegisterCredentialsHandler(router, credManager, auditLogger)
+
+	auditLogger.EXPECT().Log(gomock.Any(), http.StatusBadRequest, audit.GetCredentialsInvalidRoleTypeEventType)
+	recorder := recordCredentialsRequest(t, router, credentials.V1CredentialsPath)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = recordCredentialsRequest(t, router, customCredentialsPath)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// Tests that the v1 credentials API isn't registered when it's disabled, while the v2
+// credentials API configured with the same options keeps serving credentials.
+func TestRegisterCredentialsHandlerV1Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	credManager := mock_credentials.NewMockManager(ctrl)
+
+	options := []v1.ConfigOpt{v1.WithV1Disabled(true)}
+	assert.True(t, v1.NewConfig(options...).Disabled())
+	router := mux.NewRouter()
+	v1.RegisterCredentialsHandler(router, credManager, auditLogger, options...)
+	router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger, options...))
+	assert.Nil(t, router.Get(v1.CredentialsRouteName))
+
+	credsId := "credsid"
+	recorder := recordCredentialsRequest(t, router, makePathV1(credsId))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	credManager.EXPECT().GetTaskCredentials(credsId).Return(credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: credsId,
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}, true)
+	auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType)
+	recorder = recordCredentialsRequest(t, router, makePathV2(credsId))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
 // Tests happy case for credentials endpoint v2
 func TestCredentialsHandlerV2Success(t *testing.T) {
 	testCredentialsHandlerSuccess(t, makePathV2, getCredentialsHandlerV2)
@@ -301,6 +465,87 @@ func testCredentialsHandlerSuccess(t *testing.T, makePath MakePath, makeHandler
 	assert.Equal(t, expectedCreds, response)
 }
 
+// Tests that credentials requests are audit logged with the API version of the handler
+func TestCredentialsHandlerAuditLogAPIVersion(t *testing.T) {
+	testCases := []struct {
+		name               string
+		path               string
+		makeHandler        GetCredentialsHandler
+		expectedAPIVersion string
+	}{
+		{
+			name:               "v1",
+			path:               makePathV1("credsid"),
+			makeHandler:        getCredentialsHandlerV1,
+			expectedAPIVersion: "v1",
+		},
+		{
+			name:               "v1 custom path",
+			path:               makePathV1Custom("credsid"),
+			makeHandler:        getCredentialsHandlerV1Custom,
+			expectedAPIVersion: "v1",
+		},
+		{
+			name:               "v2",
+			path:               makePathV2("credsid"),
+			makeHandler:        getCredentialsHandlerV2,
+			expectedAPIVersion: "v2",
+		},
+		{
+			name: "v1 with custom API version",
+			path: makePathV1("credsid"),
+			makeHandler: func(credManager credentials.Manager, auditLogger audit.AuditLogger) http.Handler {
+				return http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithAPIVersion("v1-proxy")))
+			},
+			expectedAPIVersion: "v1-proxy",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			credManager := mock_credentials.NewMockManager(ctrl)
+			credManager.EXPECT().GetTaskCredentials("credsid").Return(credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}, true)
+
+			var loggedRequest request.LogRequest
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType).Do(
+				func(r request.LogRequest, _ int, _ string) {
+					loggedRequest = r
+				})
+
+			recorder := recordCredentialsRequest(t, tc.makeHandler(credManager, auditLogger), tc.path)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.expectedAPIVersion, loggedRequest.APIVersion)
+			assert.Equal(t, "taskArn", loggedRequest.ARN)
+		})
+	}
+}
+
+// Tests that errors are audit logged with the API version of the handler
+func TestCredentialsHandlerErrorAuditLogAPIVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	credManager := mock_credentials.NewMockManager(ctrl)
+
+	auditLogger.EXPECT().Log(gomock.Any(), http.StatusBadRequest, audit.GetCredentialsInvalidRoleTypeEventType).Do(
+		func(r request.LogRequest, _ int, _ string) {
+			assert.Equal(t, v1.APIVersion, r.APIVersion)
+		})
+	recorder := recordCredentialsRequest(t, getCredentialsHandlerV1(credManager, auditLogger), makePathV1(""))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
 // Sends a request to the handler and records it
 func recordCredentialsRequest(t *testing.T, handler http.Handler, path string) *httptest.ResponseRecorder {
 	// Prepare and send a request
@@ -310,3 +555,2864 @@ func recordCredentialsRequest(t *testing.T, handler http.Handler, path string) *
 	handler.ServeHTTP(recorder, req)
 	return recorder
 }
+
+// Tests that faults injected with WithUnsafeFaultInjection are applied to credentials responses
+func TestCredentialsHandlerFaultInjection(t *testing.T) {
+	credsId := "credsid"
+	taskArn := "taskArn"
+	creds := credentials.IAMRoleCredentials{
+		CredentialsID:   credsId,
+		RoleArn:         "rolearn",
+		AccessKeyID:     "access_key_id",
+		SecretAccessKey: "secret_access_key",
+		SessionToken:    "session_token",
+		Expiration:      "expiration",
+		RoleType:        credentials.ApplicationRoleType,
+	}
+
+	setup := func(t *testing.T, faults map[string]v1.Fault) (
+		http.Handler, *mock_credentials.MockManager, *mock_audit.MockAuditLogger,
+	) {
+		ctrl := gomock.NewController(t)
+		t.Cleanup(ctrl.Finish)
+		auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+		credManager := mock_credentials.NewMockManager(ctrl)
+		handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+			v1.WithUnsafeFaultInjection(faults)))
+		return handler, credManager, auditLogger
+	}
+
+	t.Run("delay", func(t *testing.T) {
+		delay := 50 * time.Millisecond
+		handler, credManager, auditLogger := setup(t,
+			map[string]v1.Fault{credsId: {Type: v1.FaultDelay, Delay: delay}})
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType)
+		credManager.EXPECT().GetTaskCredentials(credsId).Return(
+			credentials.TaskIAMRoleCredentials{ARN: taskArn, IAMRoleCredentials: creds}, true)
+
+		start := time.Now()
+		recorder := recordCredentialsRequest(t, handler, makePathV1(credsId))
+		assert.GreaterOrEqual(t, time.Since(start), delay)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var response credentials.IAMRoleCredentials
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, creds.AccessKeyID, response.AccessKeyID)
+	})
+
+	t.Run("delay ends when the client goes away", func(t *testing.T) {
+		handler, _, _ := setup(t,
+			map[string]v1.Fault{credsId: {Type: v1.FaultDelay, Delay: time.Hour}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", makePathV1(credsId), nil)
+		require.NoError(t, err)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the delayed request outlived its client")
+		}
+	})
+
+	t.Run("service unavailable", func(t *testing.T) {
+		handler, _, auditLogger := setup(t,
+			map[string]v1.Fault{credsId: {Type: v1.FaultServiceUnavailable}})
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusServiceUnavailable,
+			audit.GetCredentialsInvalidRoleTypeEventType)
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1(credsId))
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		var response utils.ErrorMessage
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, utils.ErrorMessage{
+			Code:          v1.ErrInjectedFault,
+			Message:       "CredentialsV1Request: Injected fault",
+			HTTPErrorCode: http.StatusServiceUnavailable,
+		}, response)
+	})
+
+	t.Run("truncated body", func(t *testing.T) {
+		handler, credManager, auditLogger := setup(t,
+			map[string]v1.Fault{credsId: {Type: v1.FaultTruncatedBody}})
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType)
+		credManager.EXPECT().GetTaskCredentials(credsId).Return(
+			credentials.TaskIAMRoleCredentials{ARN: taskArn, IAMRoleCredentials: creds}, true)
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1(credsId))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, strings.HasPrefix(recorder.Body.String(), `{"RoleArn":"rolearn","AccessKeyId":"access_key_id"`),
+			"unexpected truncated body: %s", recorder.Body.String())
+		var response credentials.IAMRoleCredentials
+		assert.Error(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	})
+
+	t.Run("no fault for other credentials IDs", func(t *testing.T) {
+		handler, credManager, auditLogger := setup(t,
+			map[string]v1.Fault{"othercredsid": {Type: v1.FaultServiceUnavailable}})
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType)
+		credManager.EXPECT().GetTaskCredentials(credsId).Return(
+			credentials.TaskIAMRoleCredentials{ARN: taskArn, IAMRoleCredentials: creds}, true)
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1(credsId))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		handler, credManager, auditLogger := setup(t, nil)
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType)
+		credManager.EXPECT().GetTaskCredentials(credsId).Return(
+			credentials.TaskIAMRoleCredentials{ARN: taskArn, IAMRoleCredentials: creds}, true)
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1(credsId))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var response credentials.IAMRoleCredentials
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, creds.AccessKeyID, response.AccessKeyID)
+	})
+}
+
+// Tests that credential serving is blocked while the maintenance toggle is paused and that
+// it is restored once the toggle is cleared.
+func TestCredentialsHandlerMaintenanceToggle(t *testing.T) {
+	credsId := "credsid"
+	taskArn := "taskArn"
+	creds := credentials.IAMRoleCredentials{
+		CredentialsID:   credsId,
+		RoleArn:         "rolearn",
+		AccessKeyID:     "access_key_id",
+		SecretAccessKey: "secret_access_key",
+		SessionToken:    "session_token",
+		Expiration:      "expiration",
+		RoleType:        credentials.ApplicationRoleType,
+	}
+
+	for _, tc := range []struct {
+		name       string
+		path       string
+		errPrefix  string
+		getHandler func(credentials.Manager, audit.AuditLogger, *v1.MaintenanceToggle) http.Handler
+	}{
+		{
+			name:      "v1",
+			path:      makePathV1(credsId),
+			errPrefix: "CredentialsV1Request: ",
+			getHandler: func(
+				credManager credentials.Manager, auditLogger audit.AuditLogger, toggle *v1.MaintenanceToggle,
+			) http.Handler {
+				return http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+					v1.WithMaintenanceToggle(toggle)))
+			},
+		},
+		{
+			name:      "v2",
+			path:      makePathV2(credsId),
+			errPrefix: "CredentialsV2Request: ",
+			getHandler: func(
+				credManager credentials.Manager, auditLogger audit.AuditLogger, toggle *v1.MaintenanceToggle,
+			) http.Handler {
+				router := mux.NewRouter()
+				router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger,
+					v1.WithMaintenanceToggle(toggle)))
+				return router
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			credManager := mock_credentials.NewMockManager(ctrl)
+			toggle := v1.NewMaintenanceToggle()
+			handler := tc.getHandler(credManager, auditLogger, toggle)
+
+			credManager.EXPECT().GetTaskCredentials(credsId).Return(
+				credentials.TaskIAMRoleCredentials{ARN: taskArn, IAMRoleCredentials: creds}, true).Times(2)
+			gomock.InOrder(
+				auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType),
+				auditLogger.EXPECT().Log(gomock.Any(), http.StatusServiceUnavailable,
+					audit.GetCredentialsInvalidRoleTypeEventType),
+				auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType),
+			)
+
+			recorder := recordCredentialsRequest(t, handler, tc.path)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			toggle.Pause()
+			assert.True(t, toggle.Paused())
+			recorder = recordCredentialsRequest(t, handler, tc.path)
+			assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+			var response utils.ErrorMessage
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, utils.ErrorMessage{
+				Code:          v1.ErrServiceMaintenance,
+				Message:       tc.errPrefix + "Credential serving is paused for maintenance",
+				HTTPErrorCode: http.StatusServiceUnavailable,
+			}, response)
+
+			toggle.Resume()
+			assert.False(t, toggle.Paused())
+			recorder = recordCredentialsRequest(t, handler, tc.path)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			var credsResponse credentials.IAMRoleCredentials
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &credsResponse))
+			assert.Equal(t, creds.AccessKeyID, credsResponse.AccessKeyID)
+		})
+	}
+}
+
+// Tests that all credentials requests are answered with a 503 and the same Retry-After
+// until the agent has completed reconciling its state, whether or not there are
+// credentials for the ID, and that credentials are served once it has.
+func TestCredentialsHandlerReconciliationGate(t *testing.T) {
+	credsId := "credsid"
+	taskArn := "taskArn"
+	creds := credentials.IAMRoleCredentials{
+		CredentialsID:   credsId,
+		RoleArn:         "rolearn",
+		AccessKeyID:     "access_key_id",
+		SecretAccessKey: "secret_access_key",
+		SessionToken:    "session_token",
+		Expiration:      "expiration",
+		RoleType:        credentials.ApplicationRoleType,
+	}
+
+	for _, tc := range []struct {
+		name       string
+		makePath   func(string) string
+		errPrefix  string
+		getHandler func(credentials.Manager, audit.AuditLogger, *v1.ReconciliationGate) http.Handler
+	}{
+		{
+			name:      "v1",
+			makePath:  makePathV1,
+			errPrefix: "CredentialsV1Request: ",
+			getHandler: func(
+				credManager credentials.Manager, auditLogger audit.AuditLogger, gate *v1.ReconciliationGate,
+			) http.Handler {
+				return http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+					v1.WithReconciliationGate(gate)))
+			},
+		},
+		{
+			name:      "v2",
+			makePath:  makePathV2,
+			errPrefix: "CredentialsV2Request: ",
+			getHandler: func(
+				credManager credentials.Manager, auditLogger audit.AuditLogger, gate *v1.ReconciliationGate,
+			) http.Handler {
+				router := mux.NewRouter()
+				router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger,
+					v1.WithReconciliationGate(gate)))
+				return router
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			credManager := mock_credentials.NewMockManager(ctrl)
+			gate := v1.NewReconciliationGate(1500 * time.Millisecond)
+			handler := tc.getHandler(credManager, auditLogger, gate)
+			assert.False(t, gate.Reconciled())
+
+			// Before reconciliation, known and unknown credentials IDs get the same response
+			// without the credentials manager being consulted
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusServiceUnavailable,
+				audit.GetCredentialsInvalidRoleTypeEventType).Times(2)
+			for _, id := range []string{credsId, "unknown"} {
+				recorder := recordCredentialsRequest(t, handler, tc.makePath(id))
+				assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				assert.Equal(t, "2", recorder.Header().Get(v1.RetryAfterHeader))
+				var response utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, utils.ErrorMessage{
+					Code:          v1.ErrStateReconciling,
+					Message:       tc.errPrefix + "Agent is reconciling its state, credentials are not available yet",
+					HTTPErrorCode: http.StatusServiceUnavailable,
+				}, response)
+			}
+
+			gate.MarkReconciled()
+			assert.True(t, gate.Reconciled())
+			credManager.EXPECT().GetTaskCredentials(credsId).Return(
+				credentials.TaskIAMRoleCredentials{ARN: taskArn, IAMRoleCredentials: creds}, true)
+			credManager.EXPECT().GetTaskCredentials("unknown").Return(credentials.TaskIAMRoleCredentials{}, false)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusBadRequest, audit.GetCredentialsInvalidRoleTypeEventType)
+
+			recorder := recordCredentialsRequest(t, handler, tc.makePath(credsId))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Empty(t, recorder.Header().Get(v1.RetryAfterHeader))
+			var credsResponse credentials.IAMRoleCredentials
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &credsResponse))
+			assert.Equal(t, creds.AccessKeyID, credsResponse.AccessKeyID)
+
+			recorder = recordCredentialsRequest(t, handler, tc.makePath("unknown"))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+}
+
+// Tests that the service query parameter is checked against the service scope of the
+// credentials when the credentials manager provides it.
+func TestCredentialsHandlerServiceScope(t *testing.T) {
+	credsId := "credsid"
+	taskArn := "taskArn"
+	creds := credentials.IAMRoleCredentials{
+		CredentialsID:   credsId,
+		RoleArn:         "rolearn",
+		AccessKeyID:     "access_key_id",
+		SecretAccessKey: "secret_access_key",
+		SessionToken:    "session_token",
+		Expiration:      "expiration",
+		RoleType:        credentials.ApplicationRoleType,
+	}
+
+	for _, tc := range []struct {
+		name               string
+		path               string
+		serviceScope       []string
+		expectedStatusCode int
+		expectedScopeMatch string
+		expectedResponse   *utils.ErrorMessage
+	}{
+		{
+			name:               "matching service",
+			path:               v1.CredentialsPath + "?id=" + credsId + "&service=s3",
+			serviceScope:       []string{"dynamodb", "S3"},
+			expectedStatusCode: http.StatusOK,
+			expectedScopeMatch: "true",
+		},
+		{
+			name:               "matching service v2",
+			path:               makePathV2(credsId) + "?service=s3",
+			serviceScope:       []string{"s3"},
+			expectedStatusCode: http.StatusOK,
+			expectedScopeMatch: "true",
+		},
+		{
+			name:               "non-matching service",
+			path:               v1.CredentialsPath + "?id=" + credsId + "&service=sqs",
+			serviceScope:       []string{"s3"},
+			expectedStatusCode: http.StatusForbidden,
+			expectedResponse: &utils.ErrorMessage{
+				Code:          v1.ErrServiceNotPermitted,
+				Message:       "CredentialsV1Request: Credentials are not valid for the requested service",
+				HTTPErrorCode: http.StatusForbidden,
+			},
+		},
+		{
+			name:               "no scope info",
+			path:               v1.CredentialsPath + "?id=" + credsId + "&service=sqs",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "no service requested",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			serviceScope:       []string{"s3"},
+			expectedStatusCode: http.StatusOK,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			credManager := mock_credentials.NewMockManager(ctrl)
+			router := mux.NewRouter()
+			v1.RegisterCredentialsHandler(router, credManager, auditLogger)
+			router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger))
+
+			credManager.EXPECT().GetTaskCredentials(credsId).Return(credentials.TaskIAMRoleCredentials{
+				ARN:                taskArn,
+				IAMRoleCredentials: creds,
+				ServiceScope:       tc.serviceScope,
+			}, true)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, audit.GetCredentialsEventType)
+
+			recorder := recordCredentialsRequest(t, router, tc.path)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			assert.Equal(t, tc.expectedScopeMatch, recorder.Header().Get(v1.CredentialsScopeMatchHeader))
+			if tc.expectedResponse != nil {
+				var response utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, *tc.expectedResponse, response)
+				return
+			}
+			var response credentials.IAMRoleCredentials
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, creds.AccessKeyID, response.AccessKeyID)
+		})
+	}
+}
+
+// Tests that credentials with an activation time in the future are not served and that
+// the response tells the caller when to retry.
+func TestCredentialsHandlerNotYetActive(t *testing.T) {
+	credsId := "credsid"
+	taskArn := "taskArn"
+	creds := credentials.IAMRoleCredentials{
+		CredentialsID:   credsId,
+		RoleArn:         "rolearn",
+		AccessKeyID:     "access_key_id",
+		SecretAccessKey: "secret_access_key",
+		SessionToken:    "session_token",
+		Expiration:      "expiration",
+		RoleType:        credentials.ApplicationRoleType,
+	}
+
+	for _, tc := range []struct {
+		name               string
+		path               string
+		notBefore          time.Time
+		expectedStatusCode int
+		expectedRetryAfter string
+		expectedResponse   *utils.ErrorMessage
+	}{
+		{
+			name:               "future activation time",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			notBefore:          time.Now().Add(90 * time.Second),
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedRetryAfter: "90",
+			expectedResponse: &utils.ErrorMessage{
+				Code:          v1.ErrCredentialsNotYetActive,
+				Message:       "CredentialsV1Request: Credentials are not yet active",
+				HTTPErrorCode: http.StatusServiceUnavailable,
+			},
+		},
+		{
+			name:               "future activation time v2",
+			path:               makePathV2(credsId),
+			notBefore:          time.Now().Add(90 * time.Second),
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedRetryAfter: "90",
+			expectedResponse: &utils.ErrorMessage{
+				Code:          v1.ErrCredentialsNotYetActive,
+				Message:       "CredentialsV2Request: Credentials are not yet active",
+				HTTPErrorCode: http.StatusServiceUnavailable,
+			},
+		},
+		{
+			name:               "current activation time",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			notBefore:          time.Now().Add(-time.Second),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "no activation time",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			expectedStatusCode: http.StatusOK,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			credManager := mock_credentials.NewMockManager(ctrl)
+			router := mux.NewRouter()
+			v1.RegisterCredentialsHandler(router, credManager, auditLogger)
+			router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger))
+
+			credManager.EXPECT().GetTaskCredentials(credsId).Return(credentials.TaskIAMRoleCredentials{
+				ARN:                taskArn,
+				IAMRoleCredentials: creds,
+				NotBefore:          tc.notBefore,
+			}, true)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, audit.GetCredentialsEventType)
+
+			recorder := recordCredentialsRequest(t, router, tc.path)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			assert.Equal(t, tc.expectedRetryAfter, recorder.Header().Get(v1.RetryAfterHeader))
+			if tc.expectedResponse != nil {
+				var response utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, *tc.expectedResponse, response)
+				return
+			}
+			var response credentials.IAMRoleCredentials
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, creds.AccessKeyID, response.AccessKeyID)
+		})
+	}
+}
+
+// Tests that the credentials id query parameter is accepted in any case, preferring the
+// canonical name, and that other parameters are rejected with a 400.
+func TestCredentialsHandlerIDQueryParameterCase(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			RoleArn:       "rolearn",
+			AccessKeyID:   "akid",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+	handler := getCredentialsHandlerV1(credManager, auditLogger)
+
+	for query, expectedStatus := range map[string]int{
+		"id=credsid":          http.StatusOK,
+		"ID=credsid":          http.StatusOK,
+		"Id=credsid":          http.StatusOK,
+		"iD=credsid":          http.StatusOK,
+		"i%64=credsid":        http.StatusOK,
+		"ID=other&id=credsid": http.StatusOK,
+		"Id=other&ID=credsid": http.StatusOK,
+		"ID=other":            http.StatusBadRequest,
+		"credsid=credsid":     http.StatusBadRequest,
+		"ids=credsid":         http.StatusBadRequest,
+		"identifier=credsid":  http.StatusBadRequest,
+		"i-d=credsid":         http.StatusBadRequest,
+		"":                    http.StatusBadRequest,
+	} {
+		t.Run(query, func(t *testing.T) {
+			recorder := recordCredentialsRequest(t, handler, "/credentials?"+query)
+			assert.Equal(t, expectedStatus, recorder.Code)
+			if expectedStatus == http.StatusBadRequest && !strings.Contains(query, "other") {
+				var response utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, v1.ErrNoIDInRequest, response.Code)
+			}
+		})
+	}
+}
+
+// Tests that credentials that expired long before they were generated are rejected as
+// clock skew, and that genuinely expired credentials are served as before.
+func TestCredentialsHandlerClockSkew(t *testing.T) {
+	credsId := "credsid"
+	taskArn := "taskArn"
+	now := time.Now()
+	expiration := func(d time.Duration) string {
+		return now.Add(d).UTC().Format(time.RFC3339)
+	}
+	for _, tc := range []struct {
+		name               string
+		path               string
+		expiration         string
+		generatedAt        time.Time
+		expectedStatusCode int
+		expectedResponse   *utils.ErrorMessage
+	}{
+		{
+			name:               "expired long before generation",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			expiration:         expiration(-2 * time.Hour),
+			generatedAt:        now.Add(-time.Minute),
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedResponse: &utils.ErrorMessage{
+				Code: v1.ErrClockSkewDetected,
+				Message: "CredentialsV1Request: Credentials expired before they were generated, " +
+					"which indicates clock skew; check that the client clock is synchronized",
+				HTTPErrorCode: http.StatusServiceUnavailable,
+			},
+		},
+		{
+			name:               "expired long before generation v2",
+			path:               makePathV2(credsId),
+			expiration:         expiration(-2 * time.Hour),
+			generatedAt:        now.Add(-time.Minute),
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedResponse: &utils.ErrorMessage{
+				Code: v1.ErrClockSkewDetected,
+				Message: "CredentialsV2Request: Credentials expired before they were generated, " +
+					"which indicates clock skew; check that the client clock is synchronized",
+				HTTPErrorCode: http.StatusServiceUnavailable,
+			},
+		},
+		{
+			name:               "genuinely expired",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			expiration:         expiration(-time.Hour),
+			generatedAt:        now.Add(-7 * time.Hour),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "expired shortly before generation",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			expiration:         expiration(-3 * time.Minute),
+			generatedAt:        now.Add(-time.Minute),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "not expired",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			expiration:         expiration(time.Hour),
+			generatedAt:        now.Add(-time.Minute),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "no generation time",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			expiration:         expiration(-2 * time.Hour),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "malformed expiration",
+			path:               v1.CredentialsPath + "?id=" + credsId,
+			expiration:         "expiration",
+			generatedAt:        now.Add(-time.Minute),
+			expectedStatusCode: http.StatusOK,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			credManager := mock_credentials.NewMockManager(ctrl)
+			router := mux.NewRouter()
+			v1.RegisterCredentialsHandler(router, credManager, auditLogger)
+			router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger))
+
+			creds := credentials.IAMRoleCredentials{
+				CredentialsID:   credsId,
+				RoleArn:         "rolearn",
+				AccessKeyID:     "access_key_id",
+				SecretAccessKey: "secret_access_key",
+				SessionToken:    "session_token",
+				Expiration:      tc.expiration,
+				RoleType:        credentials.ApplicationRoleType,
+			}
+			credManager.EXPECT().GetTaskCredentials(credsId).Return(credentials.TaskIAMRoleCredentials{
+				ARN:                taskArn,
+				IAMRoleCredentials: creds,
+				GeneratedAt:        tc.generatedAt,
+			}, true)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, audit.GetCredentialsEventType)
+
+			recorder := recordCredentialsRequest(t, router, tc.path)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			if tc.expectedResponse != nil {
+				var response utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, *tc.expectedResponse, response)
+				return
+			}
+			var response credentials.IAMRoleCredentials
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, creds.AccessKeyID, response.AccessKeyID)
+		})
+	}
+}
+
+// Tests that the revision of the credentials is returned in the response body and header
+// and that it tracks rotations of the credentials in the credentials manager.
+func TestCredentialsHandlerRevision(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		makePath   MakePath
+		makeHandle GetCredentialsHandler
+	}{
+		{name: "v1", makePath: makePathV1, makeHandle: getCredentialsHandlerV1},
+		{name: "v2", makePath: makePathV2, makeHandle: getCredentialsHandlerV2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType).AnyTimes()
+			credManager := credentials.NewManager()
+			handler := tc.makeHandle(credManager, auditLogger)
+
+			for revision := 1; revision <= 3; revision++ {
+				accessKeyID := fmt.Sprintf("access_key_id_%d", revision)
+				require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+					ARN: "taskArn",
+					IAMRoleCredentials: credentials.IAMRoleCredentials{
+						CredentialsID: "credsid",
+						AccessKeyID:   accessKeyID,
+						RoleType:      credentials.ApplicationRoleType,
+					},
+				}))
+
+				recorder := recordCredentialsRequest(t, handler, tc.makePath("credsid"))
+				require.Equal(t, http.StatusOK, recorder.Code)
+				assert.Equal(t, fmt.Sprint(revision), recorder.Header().Get(v1.CredentialsRevisionHeader))
+
+				var response struct {
+					AccessKeyID string `json:"AccessKeyId"`
+					Revision    uint64 `json:"Revision"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, accessKeyID, response.AccessKeyID)
+				assert.Equal(t, uint64(revision), response.Revision)
+			}
+		})
+	}
+}
+
+// Tests that requests for credentials IDs whose credentials were removed are told apart
+// from requests for IDs that never existed.
+func TestCredentialsHandlerRetiredCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		makePath   MakePath
+		makeHandle GetCredentialsHandler
+		errPrefix  string
+	}{
+		{name: "v1", makePath: makePathV1, makeHandle: getCredentialsHandlerV1, errPrefix: "CredentialsV1Request: "},
+		{name: "v2", makePath: makePathV2, makeHandle: getCredentialsHandlerV2, errPrefix: "CredentialsV2Request: "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, audit.GetCredentialsEventType)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusBadRequest, audit.GetCredentialsInvalidRoleTypeEventType)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusGone, audit.GetCredentialsInvalidRoleTypeEventType)
+			credManager := credentials.NewManager()
+			handler := tc.makeHandle(credManager, auditLogger)
+			for _, credsID := range []string{"active", "retired"} {
+				require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+					ARN: "taskArn",
+					IAMRoleCredentials: credentials.IAMRoleCredentials{
+						CredentialsID: credsID,
+						AccessKeyID:   "access_key_id",
+						RoleType:      credentials.ApplicationRoleType,
+					},
+				}))
+			}
+			credManager.RemoveCredentials("retired")
+
+			recorder := recordCredentialsRequest(t, handler, tc.makePath("active"))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			for credsID, expected := range map[string]utils.ErrorMessage{
+				"never-existed": {
+					Code:          v1.ErrInvalidIDInRequest,
+					Message:       tc.errPrefix + "Credentials not found",
+					HTTPErrorCode: http.StatusBadRequest,
+				},
+				"retired": {
+					Code:          v1.ErrCredentialsRetired,
+					Message:       tc.errPrefix + "Credentials have been retired",
+					HTTPErrorCode: http.StatusGone,
+				},
+			} {
+				recorder := recordCredentialsRequest(t, handler, tc.makePath(credsID))
+				assert.Equal(t, expected.HTTPErrorCode, recorder.Code, credsID)
+				var response utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, expected, response, credsID)
+			}
+		})
+	}
+}
+
+// Tests that credentials responses, including error responses, carry the headers that keep
+// them from being cached.
+func TestCredentialsHandlerSecurityHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		makePath   MakePath
+		makeHandle GetCredentialsHandler
+	}{
+		{name: "v1", makePath: makePathV1, makeHandle: getCredentialsHandlerV1},
+		{name: "v2", makePath: makePathV2, makeHandle: getCredentialsHandlerV2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					AccessKeyID:   "access_key_id",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}))
+			handler := tc.makeHandle(credManager, auditLogger)
+
+			for path, expectedStatusCode := range map[string]int{
+				tc.makePath("credsid"): http.StatusOK,
+				tc.makePath("unknown"): http.StatusBadRequest,
+				tc.makePath(""):        http.StatusBadRequest,
+			} {
+				recorder := recordCredentialsRequest(t, handler, path)
+				assert.Equal(t, expectedStatusCode, recorder.Code, path)
+				assert.Equal(t, "nosniff", recorder.Header().Get(utils.ContentTypeOptionsHeader), path)
+				assert.Equal(t, "no-store", recorder.Header().Get(utils.CacheControlHeader), path)
+				assert.Equal(t, "no-cache", recorder.Header().Get(utils.PragmaHeader), path)
+			}
+		})
+	}
+}
+
+// Tests that credentials responses, including error responses, are signed with the private
+// key of the public key served by the signing key handler when a response signer is
+// configured.
+func TestCredentialsHandlerResponseSigning(t *testing.T) {
+	signer, err := v1.NewResponseSigner()
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	auditLogger := mock_audit.NewMockAuditLogger(gomock.NewController(t))
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+	v1.RegisterCredentialsHandler(router, credManager, auditLogger, v1.WithResponseSigner(signer))
+	router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger,
+		v1.WithResponseSigner(signer)))
+
+	// Fetch the public key, which is registered along with the credentials handler
+	recorder := recordCredentialsRequest(t, router, v1.SigningKeyPath)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var signingKey v1.SigningKeyResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &signingKey))
+	assert.Equal(t, signer.KeyID(), signingKey.KeyID)
+	assert.Equal(t, v1.SigningAlgorithm, signingKey.Algorithm)
+	publicKey, err := base64.StdEncoding.DecodeString(signingKey.PublicKey)
+	require.NoError(t, err)
+	require.Len(t, publicKey, ed25519.PublicKeySize)
+	assert.Equal(t, signer.PublicKey(), ed25519.PublicKey(publicKey))
+
+	for _, tc := range []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{name: "v1 success", path: v1.CredentialsPath + "?id=credsid", expectedCode: http.StatusOK},
+		{name: "v2 success", path: makePathV2("credsid"), expectedCode: http.StatusOK},
+		{name: "v1 error", path: v1.CredentialsPath + "?id=unknown", expectedCode: http.StatusBadRequest},
+		{name: "v2 error", path: makePathV2("unknown"), expectedCode: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := recordCredentialsRequest(t, router, tc.path)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+			assert.Equal(t, signer.KeyID(), recorder.Header().Get(v1.CredentialsSignatureKeyIDHeader))
+
+			signature := recorder.Header().Get(v1.CredentialsSignatureHeader)
+			decoded, err := base64.StdEncoding.DecodeString(signature)
+			require.NoError(t, err)
+			assert.True(t, ed25519.Verify(publicKey, recorder.Body.Bytes(), decoded))
+			assert.False(t, ed25519.Verify(publicKey, append(recorder.Body.Bytes(), ' '), decoded))
+			assert.True(t, signer.Verify(recorder.Body.Bytes(), signature))
+			assert.False(t, signer.Verify(append(recorder.Body.Bytes(), ' '), signature))
+		})
+	}
+}
+
+// Tests that credentials responses are signed with a pre-shared key in the X-Amzn-Signature
+// header, that tampering with the body invalidates the signature, and that the pre-shared
+// key is not served.
+func TestCredentialsHandlerPreSharedKeySigning(t *testing.T) {
+	_, err := v1.NewPreSharedKeySigner([]byte("too short"))
+	assert.Error(t, err)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	signer, err := v1.NewPreSharedKeySigner(key)
+	require.NoError(t, err)
+	assert.True(t, signer.PreShared())
+
+	router := mux.NewRouter()
+	auditLogger := mock_audit.NewMockAuditLogger(gomock.NewController(t))
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+	router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger,
+		v1.WithResponseSigner(signer)))
+	v1.RegisterSigningKeyHandler(router, signer)
+
+	recorder := recordCredentialsRequest(t, router, v1.SigningKeyPath)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = httptest.NewRecorder()
+	v1.SigningKeyHandler(signer)(recorder, httptest.NewRequest("GET", v1.SigningKeyPath, nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), base64.StdEncoding.EncodeToString(key))
+
+	recorder = recordCredentialsRequest(t, router, makePathV2("credsid"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(v1.CredentialsSignatureHeader))
+	assert.Equal(t, signer.KeyID(), recorder.Header().Get(v1.CredentialsSignatureKeyIDHeader))
+
+	// Clients recompute the signature with the pre-shared key and compare
+	body := recorder.Body.Bytes()
+	signature := recorder.Header().Get(v1.SignatureHeader)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), signature)
+
+	tampered := bytes.Replace(body, []byte("access_key_id"), []byte("another_key_id"), 1)
+	require.NotEqual(t, body, tampered)
+	mac = hmac.New(sha256.New, key)
+	mac.Write(tampered)
+	assert.NotEqual(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), signature)
+	assert.False(t, signer.Verify(tampered, signature))
+	assert.True(t, signer.Verify(body, signature))
+}
+
+// Tests that credentials responses are not signed unless a response signer is configured.
+func TestCredentialsHandlerResponseSigningDisabledByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	credManager := mock_credentials.NewMockManager(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), http.StatusBadRequest, audit.GetCredentialsInvalidRoleTypeEventType)
+
+	recorder := recordCredentialsRequest(t, getCredentialsHandlerV1(credManager, auditLogger), makePathV1(""))
+	assert.Empty(t, recorder.Header().Get(v1.CredentialsSignatureHeader))
+	assert.Empty(t, recorder.Header().Get(v1.CredentialsSignatureKeyIDHeader))
+}
+
+// Tests that swapping the tunables of the credentials handler applies them to the requests
+// that are received after the swap, and not to the requests in flight.
+func TestCredentialsHandlerTunablesSwap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := mock_credentials.NewMockManager(ctrl)
+	taskCredentials := credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ExecutionRoleType,
+		},
+	}
+
+	// The first request is held in flight while the tunables are swapped
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	gomock.InOrder(
+		credManager.EXPECT().GetTaskCredentials("credsid").DoAndReturn(
+			func(string) (credentials.TaskIAMRoleCredentials, bool) {
+				close(inFlight)
+				<-release
+				return taskCredentials, true
+			}),
+		credManager.EXPECT().GetTaskCredentials("credsid").Return(taskCredentials, true),
+	)
+
+	tunables := v1.NewTunablesHolder(v1.Tunables{})
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithTunables(tunables)))
+	inFlightResponse := make(chan *httptest.ResponseRecorder)
+	go func() {
+		inFlightResponse <- recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	}()
+	<-inFlight
+	tunables.Swap(v1.Tunables{AllowedRoleTypes: []string{credentials.ApplicationRoleType}})
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-inFlightResponse).Code, "the in flight request uses the old tunables")
+
+	recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	var response utils.ErrorMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, utils.ErrorMessage{
+		Code:          v1.ErrRoleTypeNotAllowed,
+		Message:       "CredentialsV1Request: Credentials of role type TaskExecution are not served",
+		HTTPErrorCode: http.StatusForbidden,
+	}, response)
+	assert.Equal(t, []string{credentials.ApplicationRoleType}, tunables.Load().AllowedRoleTypes)
+}
+
+func TestCredentialsHandlerTunablesRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+
+	tunables := v1.NewTunablesHolder(v1.Tunables{RequestsPerSecond: 0.001, Burst: 1})
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithTunables(tunables)))
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid")).Code)
+	recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	var response utils.ErrorMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, v1.ErrRequestRateExceeded, response.Code)
+
+	// Requests aren't rate limited once the limit is removed
+	tunables.Swap(v1.Tunables{})
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid")).Code)
+	}
+}
+
+// Tests that throttled responses have rate limit headers that track the tokens of the rate
+// limiter, through throttled requests and requests that are served once tokens are back.
+func TestCredentialsHandlerRateLimitHeaders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+
+	// The bucket of 4 tokens is refilled at 2 tokens per second, so it's full again 2
+	// seconds after it's drained
+	tunables := v1.NewTunablesHolder(v1.Tunables{RequestsPerSecond: 2, Burst: 4})
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithTunables(tunables)))
+	assertThrottled := func() {
+		before := time.Now()
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		after := time.Now()
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		assert.Equal(t, "0", recorder.Header().Get(v1.RateLimitRemainingHeader))
+		reset, err := strconv.ParseInt(recorder.Header().Get(v1.RateLimitResetHeader), 10, 64)
+		require.NoError(t, err)
+		// Less than a token is left, so the bucket is full in 1.5 to 2 seconds
+		assert.GreaterOrEqual(t, reset, before.Add(1500*time.Millisecond).Unix())
+		assert.LessOrEqual(t, reset, after.Add(2*time.Second).Unix()+1)
+	}
+
+	for i := 0; i < 4; i++ {
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Empty(t, recorder.Header().Get(v1.RateLimitRemainingHeader))
+		assert.Empty(t, recorder.Header().Get(v1.RateLimitResetHeader))
+	}
+	assertThrottled()
+	assertThrottled()
+
+	// A token is back after half a second
+	time.Sleep(600 * time.Millisecond)
+	recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(v1.RateLimitResetHeader))
+	assertThrottled()
+}
+
+// Tests that requests can be served while tunables are swapped concurrently. This is mostly
+// useful with the race detector.
+func TestCredentialsHandlerTunablesConcurrentSwap(t *testing.T) {
+	require.NoError(t, seelog.ReplaceLogger(seelog.Disabled))
+	defer seelog.ReplaceLogger(seelog.Default)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+
+	tunables := v1.NewTunablesHolder(v1.Tunables{})
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithTunables(tunables)))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				code := recordCredentialsRequest(t, handler, makePathV1("credsid")).Code
+				assert.Contains(t, []int{http.StatusOK, http.StatusForbidden}, code)
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			tunables.Swap(v1.Tunables{AllowedRoleTypes: []string{credentials.ExecutionRoleType},
+				RequestLogLevel: v1.RequestLogLevelDebug})
+		} else {
+			tunables.Swap(v1.Tunables{})
+		}
+	}
+	wg.Wait()
+}
+
+func TestCredentialsHandlerEMFObserver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ExecutionRoleType,
+		},
+	}))
+
+	var emfLogs bytes.Buffer
+	observer := v1.NewEMFObserver(&emfLogs, "")
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithRequestObserver(observer)))
+	before := time.Now().UnixMilli()
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid")).Code)
+	assert.Equal(t, http.StatusBadRequest, recordCredentialsRequest(t, handler, makePathV1("unknown")).Code)
+
+	lines := strings.Split(strings.TrimSuffix(emfLogs.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	type emfLog struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		APIVersion                string
+		EventType                 string
+		StatusCode                int
+		ErrorCode                 string
+		CredentialsRequestCount   int
+		CredentialsRequestLatency float64
+		CredentialsRequestErrors  int
+	}
+	var logs [2]emfLog
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &logs[i]))
+		metadata := logs[i].AWS
+		assert.GreaterOrEqual(t, metadata.Timestamp, before)
+		require.Len(t, metadata.CloudWatchMetrics, 1)
+		directive := metadata.CloudWatchMetrics[0]
+		assert.Equal(t, v1.DefaultEMFNamespace, directive.Namespace)
+		assert.Equal(t, [][]string{{"APIVersion"}}, directive.Dimensions)
+		assert.Equal(t, []struct{ Name, Unit string }{
+			{"CredentialsRequestCount", "Count"},
+			{"CredentialsRequestLatency", "Milliseconds"},
+			{"CredentialsRequestErrors", "Count"},
+		}, directive.Metrics)
+		assert.Equal(t, v1.APIVersion, logs[i].APIVersion)
+		assert.Equal(t, 1, logs[i].CredentialsRequestCount)
+		assert.GreaterOrEqual(t, logs[i].CredentialsRequestLatency, 0.0)
+	}
+	assert.Equal(t, audit.GetCredentialsTaskExecutionEventType, logs[0].EventType)
+	assert.Equal(t, http.StatusOK, logs[0].StatusCode)
+	assert.Empty(t, logs[0].ErrorCode)
+	assert.Equal(t, 0, logs[0].CredentialsRequestErrors)
+	assert.Equal(t, http.StatusBadRequest, logs[1].StatusCode)
+	assert.Equal(t, v1.ErrInvalidIDInRequest, logs[1].ErrorCode)
+	assert.Equal(t, 1, logs[1].CredentialsRequestErrors)
+
+	// Nothing is written while the observer is disabled
+	observer.SetEnabled(false)
+	emfLogs.Reset()
+	recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	assert.Empty(t, emfLogs.String())
+}
+
+func TestCredentialsHandlerStatsDObserver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	observer, err := v1.NewStatsDObserver(listener.LocalAddr().String(), "")
+	require.NoError(t, err)
+	defer observer.Close()
+
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithRequestObserver(observer)))
+	readPacket := func() []string {
+		buf := make([]byte, 1024)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		require.NoError(t, err)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+	latency := func(line string) {
+		assert.Regexp(t, `^ecs\.tmds\.credentials\.latency\.v1:[0-9.]+\|ms$`, line)
+	}
+
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid")).Code)
+	packet := readPacket()
+	require.Len(t, packet, 3)
+	assert.Equal(t, "ecs.tmds.credentials.requests.v1:1|c", packet[0])
+	latency(packet[1])
+	assert.Equal(t, "ecs.tmds.credentials.status.200:1|c", packet[2])
+
+	assert.Equal(t, http.StatusBadRequest, recordCredentialsRequest(t, handler, makePathV1("unknown")).Code)
+	packet = readPacket()
+	require.Len(t, packet, 4)
+	assert.Equal(t, "ecs.tmds.credentials.requests.v1:1|c", packet[0])
+	latency(packet[1])
+	assert.Equal(t, "ecs.tmds.credentials.status.400:1|c", packet[2])
+	assert.Equal(t, "ecs.tmds.credentials.errors."+v1.ErrInvalidIDInRequest+":1|c", packet[3])
+}
+
+// Tests that the runtime stats count the credentials requests observed by the handler and
+// are snapshotted with all their fields.
+func TestCredentialsHandlerRuntimeStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+
+	stats := v1.NewRuntimeStats()
+	snapshot := stats.Snapshot()
+	assert.Zero(t, snapshot.Requests)
+	assert.Empty(t, snapshot.StatusCodes)
+
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithRequestObserver(stats)))
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid")).Code)
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid")).Code)
+	assert.Equal(t, http.StatusBadRequest, recordCredentialsRequest(t, handler, makePathV1("unknown")).Code)
+	stats.RecordThrottle()
+	stats.RecordCacheHit()
+	stats.RecordCacheHit()
+	stats.RecordCacheMiss()
+
+	snapshot = stats.Snapshot()
+	assert.Equal(t, uint64(3), snapshot.Requests)
+	assert.Equal(t, map[string]uint64{v1.APIVersion: 3}, snapshot.RequestsByAPIVersion)
+	assert.Equal(t, map[string]uint64{"200": 2, "400": 1}, snapshot.StatusCodes)
+	assert.Equal(t, map[string]uint64{v1.ErrInvalidIDInRequest: 1}, snapshot.ErrorCodes)
+	assert.Equal(t, uint64(1), snapshot.Throttled)
+	assert.Equal(t, uint64(2), snapshot.CacheHits)
+	assert.Equal(t, uint64(1), snapshot.CacheMisses)
+
+	encoded, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &fields))
+	for _, field := range []string{"since", "requests", "requestsByApiVersion", "statusCodes", "errorCodes",
+		"throttled", "cacheHits", "cacheMisses"} {
+		assert.Contains(t, fields, field)
+	}
+}
+
+// Tests that the credentials fetch digest counts the fetches of each task ARN that were
+// served credentials.
+func TestCredentialsHandlerFetchDigest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	for _, taskCredentials := range []*credentials.TaskIAMRoleCredentials{
+		{ARN: "taskArn1", IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid1", AccessKeyID: "access_key_id", RoleType: credentials.ApplicationRoleType}},
+		{ARN: "taskArn2", IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid2", AccessKeyID: "access_key_id", RoleType: credentials.ApplicationRoleType}},
+	} {
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials))
+	}
+
+	digest := v1.NewFetchDigest(time.Hour, 0)
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithRequestObserver(digest)))
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid1")).Code)
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid1")).Code)
+	assert.Equal(t, http.StatusOK, recordCredentialsRequest(t, handler, makePathV1("credsid2")).Code)
+	assert.Equal(t, http.StatusBadRequest, recordCredentialsRequest(t, handler, makePathV1("unknown")).Code)
+
+	snapshot := digest.Digest()
+	assert.Equal(t, map[string]uint64{"taskArn1": 2, "taskArn2": 1}, snapshot.Current.Fetches)
+	assert.Equal(t, uint64(3), snapshot.Current.Total)
+	assert.Equal(t, time.Hour, snapshot.Current.WindowEnd.Sub(snapshot.Current.WindowStart))
+	assert.False(t, time.Now().Before(snapshot.Current.WindowStart))
+
+	encoded, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	var fields map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &fields))
+	for _, field := range []string{"windowStart", "windowEnd", "fetches", "total", "uncountedArnFetches"} {
+		assert.Contains(t, fields["current"], field)
+	}
+}
+
+func TestStatsDObserverDoesNotBlock(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	observer, err := v1.NewStatsDObserver(listener.LocalAddr().String(), "custom.prefix.")
+	require.NoError(t, err)
+
+	// Nothing is sent once the observer is closed, so the queue fills up and the
+	// packets of the requests that follow are dropped
+	require.NoError(t, observer.Close())
+	for i := 0; i < 1000; i++ {
+		observer.ObserveRequest(v1.RequestObservation{APIVersion: v1.APIVersion, StatusCode: http.StatusOK})
+	}
+	assert.Greater(t, observer.Dropped(), uint64(0))
+}
+
+// Tests that credentials are only served for running tasks when the task running gate is
+// configured, and regardless of the task status otherwise.
+func TestCredentialsHandlerTaskRunningGate(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		taskStatus         string
+		running            bool
+		gated              bool
+		expectedStatusCode int
+	}{
+		{name: "running", taskStatus: "RUNNING", running: true, gated: true, expectedStatusCode: http.StatusOK},
+		{name: "stopping", taskStatus: "STOPPING", gated: true, expectedStatusCode: http.StatusConflict},
+		{name: "stopped", taskStatus: "STOPPED", gated: true, expectedStatusCode: http.StatusConflict},
+		{name: "stopped without gate", taskStatus: "STOPPED", expectedStatusCode: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, audit.GetCredentialsEventType)
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					AccessKeyID:   "access_key_id",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}))
+			var options []v1.ConfigOpt
+			if tc.gated {
+				options = append(options, v1.WithTaskRunningGate(func(taskARN string) (string, bool) {
+					assert.Equal(t, "taskArn", taskARN)
+					return tc.taskStatus, tc.running
+				}))
+			}
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, options...))
+
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+			require.Equal(t, tc.expectedStatusCode, recorder.Code)
+			if tc.expectedStatusCode == http.StatusOK {
+				var response credentials.IAMRoleCredentials
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, "access_key_id", response.AccessKeyID)
+				return
+			}
+			var response utils.ErrorMessage
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, utils.ErrorMessage{
+				Code:          v1.ErrTaskNotRunning,
+				Message:       "CredentialsV1Request: Task is not running",
+				HTTPErrorCode: http.StatusConflict,
+			}, response)
+		})
+	}
+}
+
+// Tests that credentials are only served if their role is in the partition of their task
+// when the partition check is enabled, and regardless of the partition otherwise.
+func TestCredentialsHandlerPartitionCheck(t *testing.T) {
+	const govCloudTaskARN = "arn:aws-us-gov:ecs:us-gov-west-1:123456789012:task/cluster/taskid"
+	for _, tc := range []struct {
+		name               string
+		roleARN            string
+		checked            bool
+		expectedStatusCode int
+	}{
+		{name: "matching partition", roleARN: "arn:aws-us-gov:iam::123456789012:role/app", checked: true,
+			expectedStatusCode: http.StatusOK},
+		{name: "mismatched partition", roleARN: "arn:aws:iam::123456789012:role/app", checked: true,
+			expectedStatusCode: http.StatusInternalServerError},
+		{name: "malformed role ARN", roleARN: "rolearn", checked: true,
+			expectedStatusCode: http.StatusInternalServerError},
+		{name: "mismatched partition without check", roleARN: "arn:aws-cn:iam::123456789012:role/app",
+			expectedStatusCode: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, audit.GetCredentialsEventType)
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: govCloudTaskARN,
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					RoleArn:       tc.roleARN,
+					AccessKeyID:   "access_key_id",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}))
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+				v1.WithPartitionCheck(tc.checked)))
+
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+			require.Equal(t, tc.expectedStatusCode, recorder.Code)
+			if tc.expectedStatusCode == http.StatusOK {
+				var response credentials.IAMRoleCredentials
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, "access_key_id", response.AccessKeyID)
+				return
+			}
+			var response utils.ErrorMessage
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, utils.ErrorMessage{
+				Code:          v1.ErrPartitionMismatch,
+				Message:       "CredentialsV1Request: Credentials don't belong to the partition of the task",
+				HTTPErrorCode: http.StatusInternalServerError,
+			}, response)
+			assert.NotContains(t, recorder.Body.String(), "access_key_id")
+		})
+	}
+}
+
+// Tests that the backoff of WithNotFoundRetryAfter is advised only for credentials that
+// aren't found, and only if it's configured.
+func TestCredentialsHandlerNotFoundRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		retryAfter         time.Duration
+		found              bool
+		expectedStatusCode int
+		expectedRetryAfter string
+	}{
+		{name: "not found with backoff", retryAfter: 1500 * time.Millisecond,
+			expectedStatusCode: http.StatusBadRequest, expectedRetryAfter: "2"},
+		{name: "not found without backoff", expectedStatusCode: http.StatusBadRequest},
+		{name: "uninitialized with backoff", retryAfter: time.Second, found: true,
+			expectedStatusCode: http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode,
+				audit.GetCredentialsInvalidRoleTypeEventType)
+			credManager := mock_credentials.NewMockManager(ctrl)
+			credManager.EXPECT().GetTaskCredentials("credsid").
+				Return(credentials.TaskIAMRoleCredentials{}, tc.found)
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+				v1.WithNotFoundRetryAfter(tc.retryAfter)))
+
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			assert.Equal(t, tc.expectedRetryAfter, recorder.Header().Get(v1.RetryAfterHeader))
+			_, present := recorder.Header()[v1.RetryAfterHeader]
+			assert.Equal(t, tc.expectedRetryAfter != "", present)
+		})
+	}
+}
+
+// Tests that the digest of the body of credentials responses is sent in a trailer of the
+// chunked response when WithChecksumTrailer is set.
+func TestCredentialsHandlerChecksumTrailer(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		enabled            bool
+		credentialsID      string
+		expectedStatusCode int
+	}{
+		{name: "credentials", enabled: true, credentialsID: "credsid", expectedStatusCode: http.StatusOK},
+		{name: "error", enabled: true, credentialsID: "unknown", expectedStatusCode: http.StatusBadRequest},
+		{name: "disabled", credentialsID: "credsid", expectedStatusCode: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, gomock.Any())
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					RoleArn:       "rolearn",
+					AccessKeyID:   "access_key_id",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}))
+			server := httptest.NewServer(http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+				v1.WithChecksumTrailer(tc.enabled))))
+			defer server.Close()
+
+			resp, err := server.Client().Get(server.URL + makePathV1(tc.credentialsID))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tc.expectedStatusCode, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if !tc.enabled {
+				assert.Empty(t, resp.Header.Values("Trailer"))
+				assert.Empty(t, resp.Trailer)
+				return
+			}
+			// The trailer is declared up front, and its value is only known once the body is read
+			assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+			assert.Equal(t, int64(-1), resp.ContentLength)
+			_, declared := resp.Trailer[v1.ChecksumTrailer]
+			assert.True(t, declared)
+			digest := sha256.Sum256(body)
+			assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), resp.Trailer.Get(v1.ChecksumTrailer))
+		})
+	}
+}
+
+// Tests that credentials responses of both API versions, including error responses, are
+// tagged with the configured agent version, and aren't tagged if it's not configured.
+func TestCredentialsHandlerAgentVersionHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		version            string
+		path               string
+		expectedStatusCode int
+	}{
+		{name: "v1", version: "1.73.0", path: makePathV1("credsid"), expectedStatusCode: http.StatusOK},
+		{name: "v2", version: "1.73.0", path: makePathV2("credsid"), expectedStatusCode: http.StatusOK},
+		{name: "error", version: "1.73.0", path: makePathV1("unknown"), expectedStatusCode: http.StatusBadRequest},
+		{name: "not configured", path: makePathV1("credsid"), expectedStatusCode: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, gomock.Any())
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}))
+			router := mux.NewRouter()
+			router.HandleFunc(makePathV1(""), v1.CredentialsHandler(credManager, auditLogger,
+				v1.WithAgentVersion(tc.version)))
+			router.HandleFunc(v2.CredentialsPath, v2.CredentialsHandler(credManager, auditLogger,
+				v1.WithAgentVersion(tc.version)))
+
+			recorder := recordCredentialsRequest(t, router, tc.path)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			if tc.version == "" {
+				assert.NotContains(t, recorder.Header(), v1.AgentVersionHeader)
+				return
+			}
+			assert.Equal(t, tc.version, recorder.Header().Get(v1.AgentVersionHeader))
+		})
+	}
+}
+
+// Tests that the fields query parameter selects the non-secret fields of the credentials
+// response, and that selections of secret or unknown fields are rejected.
+func TestCredentialsHandlerFieldSelection(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedResponse   string
+		expectedErrorCode  string
+	}{
+		{name: "access key id and expiration", query: "&fields=AccessKeyId,Expiration",
+			expectedStatusCode: http.StatusOK,
+			expectedResponse:   `{"AccessKeyId":"access_key_id","Expiration":"2023-05-01T10:00:00Z"}`},
+		{name: "role arn and revision", query: "&fields=RoleArn,%20Revision",
+			expectedStatusCode: http.StatusOK, expectedResponse: `{"RoleArn":"roleArn","Revision":1}`},
+		{name: "repeated field", query: "&fields=AccessKeyId,AccessKeyId",
+			expectedStatusCode: http.StatusOK, expectedResponse: `{"AccessKeyId":"access_key_id"}`},
+		{name: "secret access key", query: "&fields=AccessKeyId,SecretAccessKey",
+			expectedStatusCode: http.StatusBadRequest, expectedErrorCode: v1.ErrInvalidFieldSelection},
+		{name: "session token", query: "&fields=Token", expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode: v1.ErrInvalidFieldSelection},
+		{name: "unknown field", query: "&fields=Expiration,Password", expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode: v1.ErrInvalidFieldSelection},
+		{name: "empty selection", query: "&fields=,", expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode: v1.ErrInvalidFieldSelection},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, gomock.Any())
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID:   "credsid",
+					RoleArn:         "roleArn",
+					AccessKeyID:     "access_key_id",
+					SecretAccessKey: "secret_access_key",
+					SessionToken:    "session_token",
+					Expiration:      "2023-05-01T10:00:00Z",
+					RoleType:        credentials.ApplicationRoleType,
+				},
+			}))
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger))
+
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid")+tc.query)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			assert.NotContains(t, recorder.Body.String(), "secret_access_key")
+			assert.NotContains(t, recorder.Body.String(), "session_token")
+			if tc.expectedResponse != "" {
+				assert.JSONEq(t, tc.expectedResponse, recorder.Body.String())
+				return
+			}
+			var errorMessage utils.ErrorMessage
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+			assert.Equal(t, tc.expectedErrorCode, errorMessage.Code)
+		})
+	}
+}
+
+// Tests that credentials responses advise clients to refresh the credentials the configured
+// margin before they expire, and that the advice is omitted if the expiration isn't known.
+func TestCredentialsHandlerRefreshAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name                 string
+		expiration           string
+		options              []v1.ConfigOpt
+		expectedRefreshAfter string
+		expectedMargin       time.Duration
+	}{
+		{name: "default margin", expiration: "2023-05-01T10:00:00Z",
+			expectedRefreshAfter: "2023-05-01T09:55:00Z", expectedMargin: v1.DefaultRefreshAfterMargin},
+		{name: "configured margin", expiration: "2023-05-01T10:00:00Z",
+			options:              []v1.ConfigOpt{v1.WithRefreshAfterMargin(15 * time.Minute)},
+			expectedRefreshAfter: "2023-05-01T09:45:00Z", expectedMargin: 15 * time.Minute},
+		{name: "zero margin", expiration: "2023-05-01T10:00:00+02:00",
+			options:              []v1.ConfigOpt{v1.WithRefreshAfterMargin(0)},
+			expectedRefreshAfter: "2023-05-01T08:00:00Z"},
+		{name: "negative margin", expiration: "2023-05-01T10:00:00Z",
+			options: []v1.ConfigOpt{v1.WithRefreshAfterMargin(-time.Second)}},
+		{name: "unknown expiration", expiration: "expiration"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, gomock.Any())
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID:   "credsid",
+					RoleArn:         "roleArn",
+					AccessKeyID:     "access_key_id",
+					SecretAccessKey: "secret_access_key",
+					SessionToken:    "session_token",
+					Expiration:      tc.expiration,
+					RoleType:        credentials.ApplicationRoleType,
+				},
+			}))
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, tc.options...))
+
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+			require.Equal(t, http.StatusOK, recorder.Code)
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			refreshAfter, ok := response["RefreshAfter"]
+			if tc.expectedRefreshAfter == "" {
+				assert.False(t, ok, "RefreshAfter should be omitted")
+				return
+			}
+			require.True(t, ok, "RefreshAfter should be set")
+			assert.Equal(t, tc.expectedRefreshAfter, refreshAfter)
+			expiresAt, err := time.Parse(time.RFC3339, tc.expiration)
+			require.NoError(t, err)
+			refreshAt, err := time.Parse(time.RFC3339, refreshAfter.(string))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedMargin, expiresAt.Sub(refreshAt))
+		})
+	}
+}
+
+// Tests that requests with suspicious headers are rejected with a 403 by the heuristics of
+// the suspicious header guard, and that clean requests and requests to handlers without the
+// guard are served.
+func TestCredentialsHandlerSuspiciousHeaderGuard(t *testing.T) {
+	allHeuristics := v1.SuspiciousHeaderHeuristics
+	for _, tc := range []struct {
+		name               string
+		heuristics         []v1.SuspiciousHeaderHeuristic
+		headers            map[string]string
+		expectedStatusCode int
+	}{
+		{name: "clean request", heuristics: allHeuristics, expectedStatusCode: http.StatusOK},
+		{name: "guard disabled", headers: map[string]string{"X-Forwarded-Host": "attacker.example.com",
+			"X-Original-URL": "/v1/credentials"}, expectedStatusCode: http.StatusOK},
+		{name: "matching forwarded host",
+			heuristics:         []v1.SuspiciousHeaderHeuristic{v1.HeuristicForwardedHostMismatch},
+			headers:            map[string]string{"X-Forwarded-Host": "169.254.170.2:80"},
+			expectedStatusCode: http.StatusOK},
+		{name: "mismatched forwarded host",
+			heuristics:         []v1.SuspiciousHeaderHeuristic{v1.HeuristicForwardedHostMismatch},
+			headers:            map[string]string{"X-Forwarded-Host": "169.254.170.2, attacker.example.com"},
+			expectedStatusCode: http.StatusForbidden},
+		{name: "mismatched forwarded header host",
+			heuristics:         []v1.SuspiciousHeaderHeuristic{v1.HeuristicForwardedHostMismatch},
+			headers:            map[string]string{"Forwarded": `for=10.0.0.1;host="attacker.example.com"`},
+			expectedStatusCode: http.StatusForbidden},
+		{name: "proxy headers", heuristics: []v1.SuspiciousHeaderHeuristic{v1.HeuristicProxyHeaders},
+			headers: map[string]string{"Via": "1.1 proxy"}, expectedStatusCode: http.StatusForbidden},
+		{name: "proxy headers with other heuristics",
+			heuristics: []v1.SuspiciousHeaderHeuristic{v1.HeuristicForwardedHostMismatch,
+				v1.HeuristicURLOverride},
+			headers: map[string]string{"Via": "1.1 proxy"}, expectedStatusCode: http.StatusOK},
+		{name: "url override", heuristics: allHeuristics,
+			headers: map[string]string{"X-Rewrite-URL": "/v1/credentials"}, expectedStatusCode: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, gomock.Any())
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					AccessKeyID:   "access_key_id",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}))
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+				v1.WithSuspiciousHeaderGuard(tc.heuristics...)))
+
+			req, err := http.NewRequest("GET", makePathV1("credsid"), nil)
+			require.NoError(t, err)
+			req.Host = "169.254.170.2"
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			if tc.expectedStatusCode == http.StatusOK {
+				return
+			}
+			assert.NotContains(t, recorder.Body.String(), "access_key_id")
+			var errorMessage utils.ErrorMessage
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+			assert.Equal(t, v1.ErrSuspiciousRequest, errorMessage.Code)
+		})
+	}
+}
+
+// Tests that the heuristics of the suspicious header guard are parsed by their names.
+func TestParseSuspiciousHeaderHeuristic(t *testing.T) {
+	for _, heuristic := range v1.SuspiciousHeaderHeuristics {
+		parsed, err := v1.ParseSuspiciousHeaderHeuristic(string(heuristic))
+		require.NoError(t, err)
+		assert.Equal(t, heuristic, parsed)
+	}
+	_, err := v1.ParseSuspiciousHeaderHeuristic("referer")
+	assert.Error(t, err)
+}
+
+// Tests that credentials are only served to requests received on the local port of
+// WithExpectedLocalPort, and on any port if it isn't set.
+func TestCredentialsHandlerExpectedLocalPort(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		expectedPort       uint16
+		localAddr          net.Addr
+		expectedStatusCode int
+	}{
+		{name: "check disabled", localAddr: &net.TCPAddr{IP: net.ParseIP("0.0.0.0"), Port: 8080},
+			expectedStatusCode: http.StatusOK},
+		{name: "check disabled without local address", expectedStatusCode: http.StatusOK},
+		{name: "matching local port", expectedPort: 51679,
+			localAddr:          &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 51679},
+			expectedStatusCode: http.StatusOK},
+		{name: "mismatched local port", expectedPort: 51679,
+			localAddr:          &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80},
+			expectedStatusCode: http.StatusForbidden},
+		{name: "unknown local address", expectedPort: 51679, expectedStatusCode: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, gomock.Any())
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID: "credsid",
+					AccessKeyID:   "access_key_id",
+					RoleType:      credentials.ApplicationRoleType,
+				},
+			}))
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+				v1.WithExpectedLocalPort(tc.expectedPort)))
+
+			req, err := http.NewRequest("GET", makePathV1("credsid"), nil)
+			require.NoError(t, err)
+			if tc.localAddr != nil {
+				req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, tc.localAddr))
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			if tc.expectedStatusCode == http.StatusOK {
+				return
+			}
+			assert.NotContains(t, recorder.Body.String(), "access_key_id")
+			var errorMessage utils.ErrorMessage
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+			assert.Equal(t, utils.ErrorMessage{
+				Code:          v1.ErrUnexpectedLocalPort,
+				Message:       "CredentialsV1Request: Request was received on an unexpected port",
+				HTTPErrorCode: http.StatusForbidden,
+			}, errorMessage)
+		})
+	}
+}
+
+// Tests that the local port is checked against the listener that the server serves
+// requests on.
+func TestCredentialsHandlerExpectedLocalPortServer(t *testing.T) {
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: "credsid",
+			AccessKeyID:   "access_key_id",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	serverMux := http.NewServeMux()
+	serverMux.HandleFunc("/expected/", v1.CredentialsHandler(credManager, nopAuditLogger{},
+		v1.WithExpectedLocalPort(port)))
+	serverMux.HandleFunc("/other/", v1.CredentialsHandler(credManager, nopAuditLogger{},
+		v1.WithExpectedLocalPort(port+1)))
+	server := httptest.NewUnstartedServer(serverMux)
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	for path, expectedStatusCode := range map[string]int{
+		"/expected/": http.StatusOK,
+		"/other/":    http.StatusForbidden,
+	} {
+		resp, err := http.Get(server.URL + path + "?id=credsid")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, expectedStatusCode, resp.StatusCode, path)
+	}
+}
+
+// fakeExternalCache is a response cache standing in for an external store shared by
+// agents. It records the calls of the handler.
+type fakeExternalCache struct {
+	lock          sync.Mutex
+	entries       map[string]fakeExternalCacheEntry
+	hits          int
+	sets          int
+	invalidations []string
+}
+
+type fakeExternalCacheEntry struct {
+	version  string
+	response []byte
+}
+
+func newFakeExternalCache() *fakeExternalCache {
+	return &fakeExternalCache{entries: make(map[string]fakeExternalCacheEntry)}
+}
+
+func (c *fakeExternalCache) Get(credentialsID string) ([]byte, string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[credentialsID]
+	if ok {
+		c.hits++
+	}
+	return entry.response, entry.version, ok
+}
+
+func (c *fakeExternalCache) Set(credentialsID string, version string, response []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sets++
+	c.entries[credentialsID] = fakeExternalCacheEntry{version: version, response: response}
+}
+
+func (c *fakeExternalCache) Invalidate(credentialsID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.invalidations = append(c.invalidations, credentialsID)
+	delete(c.entries, credentialsID)
+}
+
+// replaceResponse replaces the cached response, keeping its version, so that responses
+// served from the cache can be told apart.
+func (c *fakeExternalCache) replaceResponse(credentialsID string, response []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := c.entries[credentialsID]
+	entry.response = response
+	c.entries[credentialsID] = entry
+}
+
+// Tests that marshaled credentials responses are served from the response cache set with
+// WithResponseCache while the credentials don't change, and that the cached response is
+// invalidated once the credentials are rotated or removed, including after a restart of
+// the agent.
+func TestCredentialsHandlerResponseCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	cache := newFakeExternalCache()
+	setCredentials := func(credManager credentials.Manager, accessKeyID string) {
+		require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+			ARN: "taskArn",
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				CredentialsID: "credsid",
+				AccessKeyID:   accessKeyID,
+				RoleType:      credentials.ApplicationRoleType,
+			},
+		}))
+	}
+	credManager := credentials.NewManager()
+	handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, v1.WithResponseCache(cache)))
+
+	// The response is cached by the first request
+	setCredentials(credManager, "access_key_id_1")
+	recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "access_key_id_1")
+	assert.Equal(t, 1, cache.sets)
+	assert.Equal(t, 0, cache.hits)
+
+	// and served from the cache by the next one
+	cache.replaceResponse("credsid", []byte(`{"cached":true}`))
+	recorder = recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"cached":true}`, recorder.Body.String())
+	assert.Equal(t, 1, cache.sets)
+	assert.Equal(t, 1, cache.hits)
+
+	// Rotated credentials invalidate the cached response
+	setCredentials(credManager, "access_key_id_2")
+	recorder = recordCredentialsRequest(t, handler, makePathV1("credsid"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "access_key_id_2")
+	assert.Equal(t, []string{"credsid"}, cache.invalidations)
+	assert.Equal(t, 2, cache.sets)
+
+	// The cache outlives the agent, whose credentials start over at the first revision
+	restartedManager := credentials.NewManager()
+	restartedHandler := http.HandlerFunc(v1.CredentialsHandler(restartedManager, auditLogger,
+		v1.WithResponseCache(cache)))
+	setCredentials(restartedManager, "access_key_id_3")
+	recorder = recordCredentialsRequest(t, restartedHandler, makePathV1("credsid"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "access_key_id_3")
+	assert.Equal(t, []string{"credsid", "credsid"}, cache.invalidations)
+
+	// Removed credentials invalidate the cached response
+	restartedManager.RemoveCredentials("credsid")
+	recorder = recordCredentialsRequest(t, restartedHandler, makePathV1("credsid"))
+	assert.Equal(t, http.StatusGone, recorder.Code)
+	assert.Equal(t, []string{"credsid", "credsid", "credsid"}, cache.invalidations)
+	assert.Empty(t, cache.entries)
+}
+
+// Tests that the in-memory response cache that the credentials handlers default to holds
+// up to its maximum number of responses.
+func TestMemoryResponseCache(t *testing.T) {
+	cache := v1.NewMemoryResponseCache(2)
+	cache.Set("id1", "v1", []byte("response1"))
+	cache.Set("id2", "v1", []byte("response2"))
+	cache.Set("id2", "v2", []byte("response2"))
+
+	response, version, ok := cache.Get("id2")
+	require.True(t, ok)
+	assert.Equal(t, "v2", version)
+	assert.Equal(t, []byte("response2"), response)
+
+	cache.Set("id3", "v1", []byte("response3"))
+	cached := 0
+	for _, id := range []string{"id1", "id2", "id3"} {
+		if _, _, ok := cache.Get(id); ok {
+			cached++
+		}
+	}
+	assert.Equal(t, 2, cached)
+	_, _, ok = cache.Get("id3")
+	assert.True(t, ok)
+
+	cache.Invalidate("id3")
+	_, _, ok = cache.Get("id3")
+	assert.False(t, ok)
+
+	disabled := v1.NewMemoryResponseCache(0)
+	disabled.Set("id1", "v1", []byte("response1"))
+	_, _, ok = disabled.Get("id1")
+	assert.False(t, ok)
+}
+
+// nopAuditLogger is an audit logger that drops the requests, so that benchmarks of the
+// handlers don't measure the audit logger.
+type nopAuditLogger struct{}
+
+func (nopAuditLogger) Log(request.LogRequest, int, string) {}
+func (nopAuditLogger) GetContainerInstanceArn() string     { return "" }
+func (nopAuditLogger) GetCluster() string                  { return "" }
+
+// reusableResponseWriter is a response writer that is reset between requests instead of
+// being created for every request, so that it doesn't add to the allocations of requests.
+type reusableResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *reusableResponseWriter) Header() http.Header         { return w.header }
+func (w *reusableResponseWriter) WriteHeader(statusCode int)  { w.statusCode = statusCode }
+func (w *reusableResponseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+func (w *reusableResponseWriter) reset() {
+	for key := range w.header {
+		delete(w.header, key)
+	}
+	w.statusCode = 0
+	w.body.Reset()
+}
+
+// successPathAllocsBaselineFile is the output of BenchmarkCredentialsHandlerSuccessPath
+// run against the handlers as they were before the allocations of the success path were
+// reduced, which was measured with
+//
+//	go test -tags unit -run XXX -bench 'BenchmarkCredentialsHandlerSuccessPath$' -benchmem \
+//		-benchtime=100000x ./tmds/handlers/
+//
+// The allocations of the success path must stay at least 40% below its allocations.
+const successPathAllocsBaselineFile = "testdata/success_path_allocs_baseline.txt"
+
+// successPathAllocsBaseline returns the allocations per request of the benchmark of
+// successPathAllocsBaselineFile.
+func successPathAllocsBaseline(t *testing.T) float64 {
+	output, err := os.ReadFile(successPathAllocsBaselineFile)
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "BenchmarkCredentialsHandlerSuccessPath") ||
+			fields[len(fields)-1] != "allocs/op" {
+			continue
+		}
+		allocs, err := strconv.ParseFloat(fields[len(fields)-2], 64)
+		require.NoError(t, err)
+		return allocs
+	}
+	require.FailNow(t, "no allocations found in "+successPathAllocsBaselineFile)
+	return 0
+}
+
+func newSuccessPathCredentialsHandler(t testing.TB) (func(http.ResponseWriter, *http.Request), *http.Request) {
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID:   "credsid",
+			RoleArn:         "rolearn",
+			AccessKeyID:     "access_key_id",
+			SecretAccessKey: "secret_access_key",
+			SessionToken:    "session_token",
+			Expiration:      "expiration",
+			RoleType:        credentials.ApplicationRoleType,
+		},
+	}))
+	request, err := http.NewRequest("GET", v1.CredentialsPath+"?id=credsid", nil)
+	require.NoError(t, err)
+	return v1.CredentialsHandler(credManager, nopAuditLogger{}), request
+}
+
+// Tests that the response of a credentials request that is served is unchanged by the
+// reduction of the allocations of the success path, byte for byte.
+func TestCredentialsHandlerSuccessPathGolden(t *testing.T) {
+	handler, request := newSuccessPathCredentialsHandler(t)
+	for i := 0; i < 2; i++ {
+		// The second response is served from the response cache
+		w := &reusableResponseWriter{header: http.Header{}}
+		handler(w, request)
+		assert.Equal(t, http.StatusOK, w.statusCode)
+		assert.Equal(t, `{"RoleArn":"rolearn","AccessKeyId":"access_key_id",`+
+			`"SecretAccessKey":"secret_access_key","Token":"session_token","Expiration":"expiration",`+
+			`"Revision":1}`, w.body.String())
+		assert.Equal(t, http.Header{
+			"Cache-Control":               {"no-store"},
+			"Content-Type":                {"application/json"},
+			"Pragma":                      {"no-cache"},
+			"X-Amzn-Credentials-Revision": {"1"},
+			"X-Content-Type-Options":      {"nosniff"},
+		}, w.header)
+	}
+}
+
+// Tests that a credentials request that is served allocates at least 40% less than it did
+// before the allocations of the success path were reduced.
+func TestCredentialsHandlerSuccessPathAllocations(t *testing.T) {
+	require.NoError(t, seelog.ReplaceLogger(seelog.Disabled))
+	defer seelog.ReplaceLogger(seelog.Default)
+
+	baseline := successPathAllocsBaseline(t)
+	require.Greater(t, baseline, float64(0))
+
+	handler, request := newSuccessPathCredentialsHandler(t)
+	w := &reusableResponseWriter{header: http.Header{}}
+	allocs := testing.AllocsPerRun(1000, func() {
+		w.reset()
+		handler(w, request)
+	})
+	require.Equal(t, http.StatusOK, w.statusCode)
+	assert.LessOrEqual(t, allocs, baseline*0.6,
+		"a served credentials request allocates %v times, the baseline is %v", allocs, baseline)
+}
+
+// BenchmarkCredentialsHandlerSuccessPath measures the allocations of credentials requests
+// that are served, without the allocations of the audit logger and the response writer.
+func BenchmarkCredentialsHandlerSuccessPath(b *testing.B) {
+	require.NoError(b, seelog.ReplaceLogger(seelog.Disabled))
+	defer seelog.ReplaceLogger(seelog.Default)
+
+	handler, request := newSuccessPathCredentialsHandler(b)
+	w := &reusableResponseWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.reset()
+		handler(w, request)
+	}
+}
+
+// Benchmarks the overhead of signing credentials responses.
+func BenchmarkCredentialsHandlerResponseSigning(b *testing.B) {
+	// Request logging dominates the handler latency, leave it out of the measurement
+	require.NoError(b, seelog.ReplaceLogger(seelog.Disabled))
+
+	signer, err := v1.NewResponseSigner()
+	require.NoError(b, err)
+	auditLogger := mock_audit.NewMockAuditLogger(gomock.NewController(b))
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credManager := credentials.NewManager()
+	require.NoError(b, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID:   "credsid",
+			RoleArn:         "rolearn",
+			AccessKeyID:     "access_key_id",
+			SecretAccessKey: "secret_access_key",
+			SessionToken:    strings.Repeat("session_token", 64),
+			Expiration:      "expiration",
+			RoleType:        credentials.ApplicationRoleType,
+		},
+	}))
+	request, err := http.NewRequest("GET", v1.CredentialsPath+"?id=credsid", nil)
+	require.NoError(b, err)
+
+	for _, bc := range []struct {
+		name    string
+		options []v1.ConfigOpt
+	}{
+		{name: "unsigned"},
+		{name: "signed", options: []v1.ConfigOpt{v1.WithResponseSigner(signer)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			handler := v1.CredentialsHandler(credManager, auditLogger, bc.options...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handler(httptest.NewRecorder(), request)
+			}
+		})
+	}
+}
+
+// conformingCredentialsResponse has the shape of credentials responses.
+type conformingCredentialsResponse struct {
+	RoleArn         string `json:"RoleArn"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+	Revision        uint64 `json:"Revision"`
+}
+
+// driftedCredentialsResponse is a credentials response whose shape has drifted: a field
+// is renamed, a field is dropped and a field changed type.
+type driftedCredentialsResponse struct {
+	RoleArn         string `json:"RoleArn"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Revision        string `json:"Revision"`
+}
+
+func TestValidateCredentialsResponse(t *testing.T) {
+	conforming, err := json.Marshal(conformingCredentialsResponse{
+		RoleArn:         "arn:aws:iam::123456789012:role/role",
+		AccessKeyID:     "access_key_id",
+		SecretAccessKey: "secret_access_key",
+		SessionToken:    "token",
+		Expiration:      "2023-06-01T12:00:00Z",
+		Revision:        3,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, v1.ValidateCredentialsResponse(conforming))
+
+	drifted, err := json.Marshal(driftedCredentialsResponse{
+		RoleArn:         "arn:aws:iam::123456789012:role/role",
+		AccessKeyID:     "access_key_id",
+		SecretAccessKey: "secret_access_key",
+		SessionToken:    "token",
+		Revision:        "3",
+	})
+	require.NoError(t, err)
+	err = v1.ValidateCredentialsResponse(drifted)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "$: missing required property Token")
+	assert.Contains(t, err.Error(), "$: missing required property Expiration")
+	assert.Contains(t, err.Error(), "$: unexpected property SessionToken")
+	assert.Contains(t, err.Error(), "$.Revision: expected integer, got string")
+
+	assert.Error(t, v1.ValidateCredentialsResponse([]byte(`{"RoleArn":`)))
+}
+
+// Tests that credentials responses that don't match the schema are written when schema
+// validation only logs, and replaced with an internal server error when it's enforced.
+func TestCredentialsHandlerSchemaValidation(t *testing.T) {
+	credManager := credentials.NewManager()
+	for _, creds := range []credentials.IAMRoleCredentials{
+		{
+			CredentialsID:   "complete",
+			RoleArn:         "arn:aws:iam::123456789012:role/role",
+			AccessKeyID:     "access_key_id",
+			SecretAccessKey: "secret_access_key",
+			SessionToken:    "token",
+			Expiration:      "2023-06-01T12:00:00Z",
+			RoleType:        credentials.ApplicationRoleType,
+		},
+		{
+			CredentialsID: "no-secret",
+			RoleArn:       "arn:aws:iam::123456789012:role/role",
+			AccessKeyID:   "access_key_id",
+			Expiration:    "2023-06-01T12:00:00Z",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	} {
+		require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+			ARN:                "taskArn",
+			IAMRoleCredentials: creds,
+		}))
+	}
+
+	for _, tc := range []struct {
+		name          string
+		mode          v1.SchemaValidationMode
+		credentialsID string
+		expectedCode  int
+	}{
+		{name: "off", mode: v1.SchemaValidationOff, credentialsID: "no-secret", expectedCode: http.StatusOK},
+		{name: "log", mode: v1.SchemaValidationLog, credentialsID: "no-secret", expectedCode: http.StatusOK},
+		{name: "enforce conforming", mode: v1.SchemaValidationEnforce, credentialsID: "complete", expectedCode: http.StatusOK},
+		{name: "enforce mismatch", mode: v1.SchemaValidationEnforce, credentialsID: "no-secret", expectedCode: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedCode, gomock.Any())
+			router := mux.NewRouter()
+			v1.RegisterCredentialsHandler(router, credManager, auditLogger, v1.WithSchemaValidation(tc.mode))
+
+			recorder := recordCredentialsRequest(t, router, v1.CredentialsPath+"?id="+tc.credentialsID)
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+			if tc.expectedCode == http.StatusInternalServerError {
+				var errorMessage utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+				assert.Equal(t, v1.ErrInternalServer, errorMessage.Code)
+				assert.NotContains(t, recorder.Body.String(), "access_key_id")
+			}
+		})
+	}
+}
+
+// Fuzzes the credentials id query parameter of v1 credentials requests. Whatever the query,
+// the handler must not panic, and only ids that are bounded, printable UTF-8 are looked up.
+func FuzzGetCredentialsID(f *testing.F) {
+	for _, rawQuery := range []string{
+		"id=credsid",
+		"id=",
+		"",
+		"id",
+		"id=%00",
+		"id=creds%00id",
+		"id=creds\x00id",
+		"id=creds%0Aforged%20entry",
+		"id=%zz",
+		"id=%",
+		"id=%2",
+		"id=%252F",
+		"id=%C0%AF",
+		"id=%E2%80%8B",
+		"id=%FF%FE",
+		"id=a&id=b",
+		"id=a;b",
+		"id=+",
+		"%69%64=credsid",
+		"id=" + strings.Repeat("a", 129),
+		"id=" + strings.Repeat("%41", 4096),
+	} {
+		f.Add(rawQuery)
+	}
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		credManager := mock_credentials.NewMockManager(ctrl)
+		auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusBadRequest, gomock.Any())
+		credManager.EXPECT().GetTaskCredentials(gomock.Any()).DoAndReturn(
+			func(credentialsID string) (credentials.TaskIAMRoleCredentials, bool) {
+				assert.NotEmpty(t, credentialsID)
+				assert.LessOrEqual(t, len(credentialsID), 128)
+				assert.True(t, utf8.ValidString(credentialsID))
+				for _, r := range credentialsID {
+					assert.True(t, unicode.IsPrint(r) && r != ' ', "unexpected character %U", r)
+				}
+				return credentials.TaskIAMRoleCredentials{}, false
+			}).MaxTimes(1)
+
+		req := &http.Request{
+			Method:     http.MethodGet,
+			URL:        &url.URL{Path: credentials.V1CredentialsPath, RawQuery: rawQuery},
+			Header:     http.Header{},
+			RemoteAddr: "127.0.0.1:12345",
+		}
+		recorder := httptest.NewRecorder()
+		getCredentialsHandlerV1(credManager, auditLogger).ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+// fakeCredentialsProvider is a credentials provider returning the given credentials and
+// error, after waiting for delay or for its context to be done.
+type fakeCredentialsProvider struct {
+	taskCredentials credentials.TaskIAMRoleCredentials
+	err             error
+	delay           time.Duration
+	calls           int
+	lock            sync.Mutex
+}
+
+func (f *fakeCredentialsProvider) ProvideCredentials(ctx context.Context, credentialsID string) (
+	credentials.TaskIAMRoleCredentials, error) {
+	f.lock.Lock()
+	f.calls++
+	f.lock.Unlock()
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return credentials.TaskIAMRoleCredentials{}, ctx.Err()
+	}
+	return f.taskCredentials, f.err
+}
+
+// Tests that the credentials provider is consulted for credentials IDs in its namespace,
+// that its credentials are served and audit logged like those of the credentials manager,
+// and that it failing, timing out or returning malformed credentials fails the request.
+func TestCredentialsHandlerCredentialsProvider(t *testing.T) {
+	providedCredentials := credentials.TaskIAMRoleCredentials{
+		ARN: "taskArn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID:   "ext-credsid",
+			RoleArn:         "roleArn",
+			AccessKeyID:     "akid",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+			Expiration:      "expiration",
+			RoleType:        credentials.ApplicationRoleType,
+		},
+	}
+	malformedCredentials := providedCredentials
+	malformedCredentials.IAMRoleCredentials.SecretAccessKey = ""
+	otherIDCredentials := providedCredentials
+	otherIDCredentials.IAMRoleCredentials.CredentialsID = "ext-other"
+
+	for _, tc := range []struct {
+		name                string
+		credentialsID       string
+		provider            *fakeCredentialsProvider
+		expectedStatusCode  int
+		expectedErrorCode   string
+		expectedEventType   string
+		expectedAccessKeyID string
+		expectedCalls       int
+	}{
+		{
+			name:                "success",
+			credentialsID:       "ext-credsid",
+			provider:            &fakeCredentialsProvider{taskCredentials: providedCredentials},
+			expectedStatusCode:  http.StatusOK,
+			expectedEventType:   audit.GetCredentialsEventTypeFromRoleType(credentials.ApplicationRoleType),
+			expectedAccessKeyID: "akid",
+			expectedCalls:       1,
+		},
+		{
+			name:                "manager is authoritative",
+			credentialsID:       "ext-managed",
+			provider:            &fakeCredentialsProvider{taskCredentials: providedCredentials},
+			expectedStatusCode:  http.StatusOK,
+			expectedEventType:   audit.GetCredentialsEventTypeFromRoleType(credentials.ApplicationRoleType),
+			expectedAccessKeyID: "managedakid",
+		},
+		{
+			name:               "outside of namespace",
+			credentialsID:      "credsid",
+			provider:           &fakeCredentialsProvider{taskCredentials: providedCredentials},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  v1.ErrInvalidIDInRequest,
+			expectedEventType:  audit.GetCredentialsEventTypeFromRoleType(""),
+		},
+		{
+			name:               "not provided",
+			credentialsID:      "ext-credsid",
+			provider:           &fakeCredentialsProvider{err: v1.ErrCredentialsNotProvided},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  v1.ErrInvalidIDInRequest,
+			expectedEventType:  audit.GetCredentialsEventTypeFromRoleType(""),
+			expectedCalls:      1,
+		},
+		{
+			name:               "timeout",
+			credentialsID:      "ext-credsid",
+			provider:           &fakeCredentialsProvider{taskCredentials: providedCredentials, delay: time.Minute},
+			expectedStatusCode: http.StatusGatewayTimeout,
+			expectedErrorCode:  v1.ErrCredentialsProviderTimeout,
+			expectedEventType:  audit.GetCredentialsEventTypeFromRoleType(""),
+			expectedCalls:      1,
+		},
+		{
+			name:               "failure",
+			credentialsID:      "ext-credsid",
+			provider:           &fakeCredentialsProvider{err: errors.New("broker unavailable")},
+			expectedStatusCode: http.StatusBadGateway,
+			expectedErrorCode:  v1.ErrCredentialsProviderFailure,
+			expectedEventType:  audit.GetCredentialsEventTypeFromRoleType(""),
+			expectedCalls:      1,
+		},
+		{
+			name:               "malformed",
+			credentialsID:      "ext-credsid",
+			provider:           &fakeCredentialsProvider{taskCredentials: malformedCredentials},
+			expectedStatusCode: http.StatusBadGateway,
+			expectedErrorCode:  v1.ErrCredentialsProviderFailure,
+			expectedEventType:  audit.GetCredentialsEventTypeFromRoleType(""),
+			expectedCalls:      1,
+		},
+		{
+			name:               "other credentials id",
+			credentialsID:      "ext-credsid",
+			provider:           &fakeCredentialsProvider{taskCredentials: otherIDCredentials},
+			expectedStatusCode: http.StatusBadGateway,
+			expectedErrorCode:  v1.ErrCredentialsProviderFailure,
+			expectedEventType:  audit.GetCredentialsEventTypeFromRoleType(""),
+			expectedCalls:      1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, tc.expectedEventType)
+			credManager := credentials.NewManager()
+			require.NoError(t, credManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+				ARN: "taskArn",
+				IAMRoleCredentials: credentials.IAMRoleCredentials{
+					CredentialsID:   "ext-managed",
+					RoleArn:         "roleArn",
+					AccessKeyID:     "managedakid",
+					SecretAccessKey: "secret",
+					SessionToken:    "token",
+					Expiration:      "expiration",
+					RoleType:        credentials.ApplicationRoleType,
+				},
+			}))
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger,
+				v1.WithCredentialsProvider("ext-", tc.provider, 50*time.Millisecond)))
+
+			start := time.Now()
+			recorder := recordCredentialsRequest(t, handler, makePathV1(tc.credentialsID))
+			assert.Less(t, time.Since(start), 5*time.Second, "the provider timeout wasn't enforced")
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			tc.provider.lock.Lock()
+			assert.Equal(t, tc.expectedCalls, tc.provider.calls)
+			tc.provider.lock.Unlock()
+			if tc.expectedErrorCode != "" {
+				var errorMessage utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+				assert.Equal(t, tc.expectedErrorCode, errorMessage.Code)
+				return
+			}
+			var response credentials.IAMRoleCredentials
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, tc.expectedAccessKeyID, response.AccessKeyID)
+		})
+	}
+}
+
+// Tests that the provider timeout is enforced for providers that don't return once their
+// context is done.
+func TestCredentialsHandlerCredentialsProviderIgnoringContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), http.StatusGatewayTimeout, gomock.Any())
+	block := make(chan struct{})
+	defer close(block)
+	provider := credentialsProviderFunc(func(ctx context.Context, credentialsID string) (
+		credentials.TaskIAMRoleCredentials, error) {
+		<-block
+		return credentials.TaskIAMRoleCredentials{}, nil
+	})
+	handler := http.HandlerFunc(v1.CredentialsHandler(credentials.NewManager(), auditLogger,
+		v1.WithCredentialsProvider("ext-", provider, 50*time.Millisecond)))
+
+	recorder := recordCredentialsRequest(t, handler, makePathV1("ext-credsid"))
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+}
+
+type credentialsProviderFunc func(ctx context.Context, credentialsID string) (credentials.TaskIAMRoleCredentials, error)
+
+func (f credentialsProviderFunc) ProvideCredentials(ctx context.Context, credentialsID string) (
+	credentials.TaskIAMRoleCredentials, error) {
+	return f(ctx, credentialsID)
+}
+
+// fakeSTSClient is a credentials validator standing in for STS GetCallerIdentity, failing
+// credentials with the given error after waiting for delay or for its context to be done.
+type fakeSTSClient struct {
+	err   error
+	delay time.Duration
+	calls []string
+	lock  sync.Mutex
+}
+
+func (f *fakeSTSClient) ValidateCredentials(ctx context.Context, roleCredentials credentials.IAMRoleCredentials) error {
+	f.lock.Lock()
+	f.calls = append(f.calls, roleCredentials.AccessKeyID)
+	f.lock.Unlock()
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return f.err
+}
+
+func (f *fakeSTSClient) validatedKeys() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Tests that credentials are validated before they are served if credentials validation
+// is enabled, and that the results are cached by access key ID.
+func TestCredentialsHandlerCredentialsValidation(t *testing.T) {
+	taskCredentials := func(accessKeyID string) *credentials.TaskIAMRoleCredentials {
+		return &credentials.TaskIAMRoleCredentials{
+			ARN: "taskArn",
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				CredentialsID:   "credsid",
+				RoleArn:         "roleArn",
+				AccessKeyID:     accessKeyID,
+				SecretAccessKey: "secret",
+				SessionToken:    "token",
+				Expiration:      "expiration",
+				RoleType:        credentials.ApplicationRoleType,
+			},
+		}
+	}
+	newHandler := func(t *testing.T, credManager credentials.Manager, opts ...v1.ConfigOpt) http.Handler {
+		ctrl := gomock.NewController(t)
+		auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+		auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		return http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger, opts...))
+	}
+	errorCode := func(t *testing.T, recorder *httptest.ResponseRecorder) string {
+		var errorMessage utils.ErrorMessage
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+		return errorMessage.Code
+	}
+
+	t.Run("success", func(t *testing.T) {
+		credManager := credentials.NewManager()
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("akid")))
+		sts := &fakeSTSClient{}
+		handler := newHandler(t, credManager, v1.WithCredentialsValidation(sts, time.Second, time.Minute))
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, []string{"akid"}, sts.validatedKeys())
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		credManager := credentials.NewManager()
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("akid")))
+		sts := &fakeSTSClient{err: errors.New("ExpiredToken")}
+		handler := newHandler(t, credManager, v1.WithCredentialsValidation(sts, time.Second, time.Minute))
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(t, v1.ErrCredentialsValidationFailed, errorCode(t, recorder))
+		assert.NotContains(t, recorder.Body.String(), "secret")
+	})
+
+	t.Run("cache hit", func(t *testing.T) {
+		credManager := credentials.NewManager()
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("akid")))
+		sts := &fakeSTSClient{}
+		handler := newHandler(t, credManager, v1.WithCredentialsValidation(sts, time.Second, time.Minute))
+
+		for i := 0; i < 3; i++ {
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+		}
+		assert.Equal(t, []string{"akid"}, sts.validatedKeys(), "cached validations were repeated")
+
+		// Rotated credentials are validated again
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("rotatedakid")))
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, []string{"akid", "rotatedakid"}, sts.validatedKeys())
+	})
+
+	t.Run("cached failure", func(t *testing.T) {
+		credManager := credentials.NewManager()
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("akid")))
+		sts := &fakeSTSClient{err: errors.New("InvalidClientTokenId")}
+		handler := newHandler(t, credManager, v1.WithCredentialsValidation(sts, time.Second, time.Minute))
+
+		for i := 0; i < 2; i++ {
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+			assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		}
+		assert.Equal(t, []string{"akid"}, sts.validatedKeys())
+	})
+
+	t.Run("cache expiry", func(t *testing.T) {
+		credManager := credentials.NewManager()
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("akid")))
+		sts := &fakeSTSClient{}
+		handler := newHandler(t, credManager, v1.WithCredentialsValidation(sts, time.Second, 50*time.Millisecond))
+
+		recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		time.Sleep(100 * time.Millisecond)
+		recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		assert.Equal(t, []string{"akid", "akid"}, sts.validatedKeys())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		credManager := credentials.NewManager()
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("akid")))
+		sts := &fakeSTSClient{delay: time.Minute}
+		handler := newHandler(t, credManager,
+			v1.WithCredentialsValidation(sts, 50*time.Millisecond, time.Minute))
+
+		// Timed out validations aren't cached
+		for i := 0; i < 2; i++ {
+			recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+			assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+			assert.Equal(t, v1.ErrCredentialsValidationFailed, errorCode(t, recorder))
+		}
+		assert.Equal(t, []string{"akid", "akid"}, sts.validatedKeys())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		credManager := credentials.NewManager()
+		require.NoError(t, credManager.SetTaskCredentials(taskCredentials("akid")))
+		handler := newHandler(t, credManager, v1.WithCredentialsValidation(nil, time.Second, time.Minute))
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
+
+// Tests that the roleArn query parameter selects the credentials of another role of the
+// task of the credentials ID, only if the task holds credentials of the role of the same
+// role type, and only if the credentials manager supports selecting roles.
+func TestCredentialsHandlerRoleSelection(t *testing.T) {
+	roleCredentials := func(id, roleArn, roleType string) *credentials.TaskIAMRoleCredentials {
+		return &credentials.TaskIAMRoleCredentials{
+			ARN: "taskArn",
+			IAMRoleCredentials: credentials.IAMRoleCredentials{
+				CredentialsID:   id,
+				RoleArn:         roleArn,
+				AccessKeyID:     "akid-" + id,
+				SecretAccessKey: "secret",
+				SessionToken:    "token",
+				Expiration:      "expiration",
+				RoleType:        roleType,
+			},
+		}
+	}
+	credManager := credentials.NewManager()
+	require.NoError(t, credManager.SetTaskCredentials(roleCredentials("credsid", "primaryRole",
+		credentials.ApplicationRoleType)))
+	require.NoError(t, credManager.SetTaskCredentials(roleCredentials("secondaryid", "secondaryRole",
+		credentials.ApplicationRoleType)))
+	require.NoError(t, credManager.SetTaskCredentials(roleCredentials("executionid", "executionRole",
+		credentials.ExecutionRoleType)))
+
+	for _, tc := range []struct {
+		name                string
+		query               string
+		expectedStatusCode  int
+		expectedErrorCode   string
+		expectedAccessKeyID string
+	}{
+		{name: "default", expectedStatusCode: http.StatusOK, expectedAccessKeyID: "akid-credsid"},
+		{
+			name:                "primary role",
+			query:               "&roleArn=primaryRole",
+			expectedStatusCode:  http.StatusOK,
+			expectedAccessKeyID: "akid-credsid",
+		},
+		{
+			name:                "permitted",
+			query:               "&roleArn=secondaryRole",
+			expectedStatusCode:  http.StatusOK,
+			expectedAccessKeyID: "akid-secondaryid",
+		},
+		{
+			name:               "not permitted",
+			query:              "&roleArn=unknownRole",
+			expectedStatusCode: http.StatusForbidden,
+			expectedErrorCode:  v1.ErrRoleNotPermitted,
+		},
+		{
+			name:               "other role type",
+			query:              "&roleArn=executionRole",
+			expectedStatusCode: http.StatusForbidden,
+			expectedErrorCode:  v1.ErrRoleNotPermitted,
+		},
+		{
+			name:               "unknown credentials",
+			query:              "&roleArn=secondaryRole",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  v1.ErrInvalidIDInRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatusCode, gomock.Any())
+			handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger))
+
+			credentialsID := "credsid"
+			if tc.name == "unknown credentials" {
+				credentialsID = "unknown"
+			}
+			recorder := recordCredentialsRequest(t, handler, makePathV1(credentialsID)+tc.query)
+			assert.Equal(t, tc.expectedStatusCode, recorder.Code)
+			if tc.expectedErrorCode != "" {
+				var errorMessage utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+				assert.Equal(t, tc.expectedErrorCode, errorMessage.Code)
+				return
+			}
+			var response credentials.IAMRoleCredentials
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, tc.expectedAccessKeyID, response.AccessKeyID)
+		})
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusOK, gomock.Any()).Times(2)
+		handler := http.HandlerFunc(v1.CredentialsHandler(credManager, auditLogger))
+
+		// The credentials of the selected role aren't cached for the credentials ID
+		recordCredentialsRequest(t, handler, makePathV1("credsid")+"&roleArn=secondaryRole")
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid"))
+		var response credentials.IAMRoleCredentials
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "akid-credsid", response.AccessKeyID)
+	})
+
+	t.Run("unsupported by manager", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusBadRequest, gomock.Any())
+		mockManager := mock_credentials.NewMockManager(ctrl)
+		mockManager.EXPECT().GetTaskCredentials("credsid").
+			Return(*roleCredentials("credsid", "primaryRole", credentials.ApplicationRoleType), true).AnyTimes()
+		handler := http.HandlerFunc(v1.CredentialsHandler(mockManager, auditLogger))
+
+		recorder := recordCredentialsRequest(t, handler, makePathV1("credsid")+"&roleArn=secondaryRole")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		var errorMessage utils.ErrorMessage
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+		assert.Equal(t, v1.ErrRoleSelectionUnsupported, errorMessage.Code)
+	})
+}
@@ -14,12 +14,20 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/retry"
 	"github.com/cihub/seelog"
 	"github.com/gorilla/mux"
 )
@@ -46,6 +54,9 @@ const (
 	// RequestTypeAgentMetadata specifies the Agent metadata request type of AgentMetadataHandler.
 	RequestTypeAgentMetadata = "agent metadata"
 
+	// RequestTypeContainerStatus specifies the container status request type of ContainerStatusHandler.
+	RequestTypeContainerStatus = "container status"
+
 	// RequestTypeContainerAssociations specifies the container associations request type of ContainerAssociationsHandler.
 	RequestTypeContainerAssociations = "container associations"
 
@@ -60,8 +71,56 @@ const (
 
 	// AnythingButEmptyRegEx is a regex pattern that matches anything but an empty string.
 	AnythingButEmptyRegEx = ".+"
+
+	// ErrTLSRequired is the error code indicating that a plaintext request was received
+	// while TLS is required.
+	ErrTLSRequired = "TLSRequired"
+
+	// ErrRequestBodyTooLarge is the error code indicating that a request body exceeded the
+	// maximum request body size.
+	ErrRequestBodyTooLarge = "RequestBodyTooLarge"
+
+	// ErrRequestTimeout is the error code indicating that a request body wasn't received
+	// before the server read timeout.
+	ErrRequestTimeout = "RequestTimeout"
+
+	// ContentTypeOptionsHeader, CacheControlHeader and PragmaHeader are the security
+	// headers set by SecurityHeadersHandler.
+	ContentTypeOptionsHeader = "X-Content-Type-Options"
+	CacheControlHeader       = "Cache-Control"
+	PragmaHeader             = "Pragma"
+)
+
+// Values of the headers that are set on most responses. The handlers share them instead of
+// allocating them for every response, so they must never be modified in place. Replacing
+// them with Header.Set or appending to them with Header.Add is safe.
+var (
+	jsonContentTypeHeaderValue    = []string{"application/json"}
+	contentTypeOptionsHeaderValue = []string{"nosniff"}
+	cacheControlHeaderValue       = []string{"no-store"}
+	pragmaHeaderValue             = []string{"no-cache"}
 )
 
+// jsonEncoder is a JSON encoder along with the buffer it encodes to.
+type jsonEncoder struct {
+	buffer  bytes.Buffer
+	encoder *json.Encoder
+}
+
+// maxPooledJSONBufferSize is the capacity above which the buffers of JSON encoders are
+// dropped instead of being returned to jsonEncoderPool.
+const maxPooledJSONBufferSize = 64 * 1024
+
+// jsonEncoderPool is the pool of the JSON encoders of WriteJSONResponse, so that the
+// buffers that responses are encoded to are reused across responses.
+var jsonEncoderPool = sync.Pool{
+	New: func() interface{} {
+		e := &jsonEncoder{}
+		e.encoder = json.NewEncoder(&e.buffer)
+		return e
+	},
+}
+
 // ErrorMessage is used to store the human-readable error Code and a descriptive Message
 // that describes the error. This struct is marshalled and returned in the HTTP response.
 type ErrorMessage struct {
@@ -79,17 +138,27 @@ func WriteJSONResponse(
 	response interface{},
 	requestType string,
 ) {
-	responseJSON, err := json.Marshal(response)
+	encoder := jsonEncoderPool.Get().(*jsonEncoder)
+	defer func() {
+		if encoder.buffer.Cap() > maxPooledJSONBufferSize {
+			// Don't hold on to the buffers of unusually large responses
+			return
+		}
+		encoder.buffer.Reset()
+		jsonEncoderPool.Put(encoder)
+	}()
+	// The encoder marshals like json.Marshal, but terminates the JSON with a newline
+	err := encoder.encoder.Encode(response)
 	if e := WriteResponseIfMarshalError(w, err); e != nil {
 		return
 	}
-	WriteJSONToResponse(w, httpStatusCode, responseJSON, requestType)
+	WriteJSONToResponse(w, httpStatusCode, bytes.TrimSuffix(encoder.buffer.Bytes(), []byte("\n")), requestType)
 }
 
 // WriteJSONToResponse writes the header, JSON response to a ResponseWriter, and
 // log the error if necessary.
 func WriteJSONToResponse(w http.ResponseWriter, httpStatusCode int, responseJSON []byte, requestType string) {
-	w.Header().Set("Content-Type", "application/json")
+	w.Header()["Content-Type"] = jsonContentTypeHeaderValue
 	w.WriteHeader(httpStatusCode)
 	_, err := w.Write(responseJSON)
 	if err != nil {
@@ -115,9 +184,27 @@ func WriteResponseIfMarshalError(w http.ResponseWriter, err error) error {
 	return nil
 }
 
+// SortedKeys returns the keys of the map in ascending order. Responses that are built by
+// iterating over maps, such as the networks of a container, use it so that the order of
+// the built slices is the same across requests. Maps that are serialized as they are, such
+// as labels, don't need it since encoding/json writes map keys in ascending order.
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // ValueFromRequest returns the value of a field in the http request. The boolean value is
 // set to true if the field exists in the query.
 func ValueFromRequest(r *http.Request, field string) (string, bool) {
+	if !strings.Contains(r.URL.RawQuery, field) && !strings.Contains(r.URL.RawQuery, "%") {
+		// The field can't be in the query, skip parsing it. Fields can only be named with
+		// escapes, which are checked for above, or literally.
+		return "", false
+	}
 	values := r.URL.Query()
 	_, exists := values[field]
 	return values.Get(field), exists
@@ -151,6 +238,355 @@ func LimitReachedHandler(auditLogger audit.AuditLogger) func(http.ResponseWriter
 	}
 }
 
+// TLSRequiredHandler rejects requests that were not received over TLS with a 403 and logs
+// them in the credentials audit log. Requests received over TLS are passed to the handler.
+func TLSRequiredHandler(auditLogger audit.AuditLogger, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		seelog.Warnf("Rejected plaintext request from %s for %s: TLS is required", r.RemoteAddr, r.URL.Path)
+		auditLogger.Log(request.LogRequest{Request: r}, http.StatusForbidden, "")
+		WriteJSONResponse(w, http.StatusForbidden, ErrorMessage{
+			Code:          ErrTLSRequired,
+			Message:       "TLS is required",
+			HTTPErrorCode: http.StatusForbidden,
+		}, RequestTypeCreds)
+	})
+}
+
+// TraceContextHandler passes requests to the handler with the span context of their W3C
+// Trace Context traceparent header, so that the span is identified in the credentials audit
+// log. Requests without a valid traceparent header are passed as they are.
+func TraceContextHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent := r.Header.Get(audit.TraceparentHeader)
+		if traceparent == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		spanContext, err := audit.ParseTraceparent(traceparent)
+		if err != nil {
+			seelog.Debugf("Ignoring the %s header of the request from %s for %s: %v",
+				audit.TraceparentHeader, r.RemoteAddr, r.URL.Path, err)
+			handler.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(audit.ContextWithSpanContext(r.Context(), spanContext)))
+	})
+}
+
+// credentialsPathSegment is the path segment following the version segment in the paths of
+// the credentials APIs
+const credentialsPathSegment = "credentials"
+
+// CredentialsPathHandler passes requests for non-canonical forms of the paths of the
+// credentials APIs to the handler with the canonical path, and logs a warning for them.
+// Clients that spell the version segment in upper case, such as '/V1/credentials', or
+// that append a trailing slash, such as '/v1/credentials/', are served as if they had
+// requested '/v1/credentials'. Requests for other paths are passed as they are.
+func CredentialsPathHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := CanonicalCredentialsPath(r.URL.Path)
+		if !ok || path == r.URL.Path {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		seelog.Warnf("Request from %s for the non-canonical credentials path %s, serving it as %s; "+
+			"non-canonical credentials paths may not be supported in the future", r.RemoteAddr, r.URL.Path, path)
+		canonical := r.Clone(r.Context())
+		canonical.URL.Path = path
+		canonical.URL.RawPath = ""
+		handler.ServeHTTP(w, canonical)
+	})
+}
+
+// CanonicalCredentialsPath returns the canonical form of a path of the credentials APIs,
+// with a lower case version segment and without a trailing slash. It returns false if the
+// path isn't a path of the credentials APIs. Only the version segment is matched case
+// insensitively, so that credentials ids keep their case. The 'v1' API takes the
+// credentials id in the query, so '/v1/credentials/' is '/v1/credentials', while the
+// later APIs take it in the path, so '/v2/credentials/' is a request without id.
+func CanonicalCredentialsPath(path string) (string, bool) {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(segments) < 2 || !isVersionSegment(segments[0]) || segments[1] != credentialsPathSegment {
+		return "", false
+	}
+	version := strings.ToLower(segments[0])
+	canonical := "/" + version + "/" + credentialsPathSegment
+	if len(segments) == 3 {
+		if rest := strings.TrimSuffix(segments[2], "/"); rest != "" || version != "v1" {
+			canonical += "/" + rest
+		}
+	}
+	return canonical, true
+}
+
+// isVersionSegment returns whether the path segment is an API version, such as 'v1'
+func isVersionSegment(segment string) bool {
+	if len(segment) < 2 || (segment[0] != 'v' && segment[0] != 'V') {
+		return false
+	}
+	for _, c := range segment[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// PathNormalizationHandler passes requests for paths that no route of the router matches,
+// but that match a route once a trailing slash is removed or the case of the static
+// segments of the path template of the route is folded, to the handler with the path of
+// the route. For example, '/V2/Metadata/' is served as '/v2/metadata'. Path variables keep
+// their case, since they hold ids. Requests for other paths are passed as they are.
+func PathNormalizationHandler(handler http.Handler, router *mux.Router) http.Handler {
+	var templates [][]string
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if template, err := route.GetPathTemplate(); err == nil {
+			templates = append(templates, splitPathTemplate(template))
+		}
+		return nil
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if routeMatches(router, r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		for _, path := range normalizedPaths(r.URL.Path, templates) {
+			normalized := r.Clone(r.Context())
+			normalized.URL.Path = path
+			normalized.URL.RawPath = ""
+			if routeMatches(router, normalized) {
+				seelog.Debugf("Request from %s for %s is served as %s", r.RemoteAddr, r.URL.Path, path)
+				handler.ServeHTTP(w, normalized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// routeMatches returns whether a route of the router matches the path of the request,
+// regardless of the method of the request.
+func routeMatches(router *mux.Router, r *http.Request) bool {
+	var match mux.RouteMatch
+	if router.Match(r, &match) {
+		// The router matches all requests if it has a not found handler
+		return match.MatchErr == nil
+	}
+	return match.MatchErr == mux.ErrMethodMismatch
+}
+
+// splitPathTemplate splits a path template into its segments. Slashes in the patterns of
+// path variables, such as '{id:[^/]+}', don't split segments.
+func splitPathTemplate(template string) []string {
+	var segments []string
+	depth, start := 0, 0
+	template = strings.TrimPrefix(template, "/")
+	for i, c := range template {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, template[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, template[start:])
+}
+
+// normalizedPaths returns the paths of the path templates that the path matches when the
+// static segments of the templates are matched case insensitively, for the path with and
+// without its trailing slash.
+func normalizedPaths(path string, templates [][]string) []string {
+	variants := []string{path}
+	if trimmed := strings.TrimSuffix(path, "/"); trimmed != path && trimmed != "" {
+		variants = append(variants, trimmed)
+	}
+	var paths []string
+	for _, variant := range variants {
+		segments := strings.Split(strings.TrimPrefix(variant, "/"), "/")
+		for _, template := range templates {
+			if normalized, ok := normalizePathSegments(segments, template); ok && normalized != path {
+				paths = append(paths, normalized)
+			}
+		}
+	}
+	return paths
+}
+
+// normalizePathSegments returns the path of the template for the segments of a path, with
+// the static segments of the template and the variable segments of the path. The last
+// variable segment of a template takes the remaining segments of the path, which the
+// router then matches against the pattern of the variable.
+func normalizePathSegments(segments, template []string) (string, bool) {
+	if len(segments) < len(template) {
+		return "", false
+	}
+	normalized := make([]string, 0, len(segments))
+	for i, templateSegment := range template {
+		isVariable := strings.Contains(templateSegment, "{")
+		switch {
+		case isVariable && i == len(template)-1:
+			normalized = append(normalized, segments[i:]...)
+			return "/" + strings.Join(normalized, "/"), true
+		case isVariable:
+			normalized = append(normalized, segments[i])
+		case strings.EqualFold(templateSegment, segments[i]):
+			normalized = append(normalized, templateSegment)
+		default:
+			return "", false
+		}
+	}
+	if len(segments) != len(template) {
+		return "", false
+	}
+	return "/" + strings.Join(normalized, "/"), true
+}
+
+// ForwardedPrefixHeader is the header in which reverse proxies pass the prefix of the path
+// that clients requested, that isn't part of the paths of the routes of the handler
+const ForwardedPrefixHeader = "X-Forwarded-Prefix"
+
+// ForwardedPrefixHandler passes requests for paths with the prefix of the
+// ForwardedPrefixHeader header of the request to the handler without the prefix, so that
+// requests proxied by reverse proxies that pass the prefix along with the path, such as
+// '/ecs/v2/credentials/id' with the prefix '/ecs', are routed and have their path
+// variables extracted as requests for '/v2/credentials/id'. The prefixes of proxies that
+// are chained are accumulated in the header as comma separated values. Requests without
+// the header, or for paths without its prefix, such as requests from proxies that strip
+// the prefix themselves, are passed as they are.
+func ForwardedPrefixHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := forwardedPrefix(r.Header.Values(ForwardedPrefixHeader))
+		path := strings.TrimPrefix(r.URL.Path, prefix)
+		if prefix == "" || path == r.URL.Path || (path != "" && path[0] != '/') {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if path == "" {
+			path = "/"
+		}
+		seelog.Debugf("Request from %s for %s is served as %s without the forwarded prefix %s",
+			r.RemoteAddr, r.URL.Path, path, prefix)
+		forwarded := r.Clone(r.Context())
+		forwarded.URL.Path = path
+		forwarded.URL.RawPath = ""
+		handler.ServeHTTP(w, forwarded)
+	})
+}
+
+// forwardedPrefix returns the prefix of the values of the ForwardedPrefixHeader header,
+// without trailing slashes. Empty values and values that aren't absolute paths are ignored.
+func forwardedPrefix(values []string) string {
+	var prefix string
+	for _, value := range values {
+		for _, segment := range strings.Split(value, ",") {
+			segment = strings.TrimRight(strings.TrimSpace(segment), "/")
+			if strings.HasPrefix(segment, "/") {
+				prefix += segment
+			}
+		}
+	}
+	return prefix
+}
+
+// SecurityHeadersHandler sets headers on every response of the handler that keep clients
+// and intermediaries from caching the responses or sniffing their content type, since
+// responses can contain secrets.
+func SecurityHeadersHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header[ContentTypeOptionsHeader] = contentTypeOptionsHeaderValue
+		header[CacheControlHeader] = cacheControlHeaderValue
+		header[PragmaHeader] = pragmaHeaderValue
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// MaxRequestBodyHandler limits the size of request bodies to maxBytes. Requests whose
+// Content-Length exceeds maxBytes are rejected with a 413 without being passed to the
+// handler. Reads of chunked bodies fail once maxBytes are read, with an error that
+// RequestBodyErrorMessage turns into a 413. Request bodies are not limited if maxBytes is
+// not positive.
+func MaxRequestBodyHandler(handler http.Handler, maxBytes int64) http.Handler {
+	if maxBytes <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			seelog.Warnf("Rejected request from %s for %s: request body of %d bytes exceeds %d bytes",
+				r.RemoteAddr, r.URL.Path, r.ContentLength, maxBytes)
+			errorMessage := requestBodyTooLargeErrorMessage(maxBytes)
+			WriteJSONResponse(w, errorMessage.HTTPErrorCode, errorMessage, r.URL.Path)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ResponseJitter returns a random delay between 0 and maxJitter, or 0 if maxJitter is not
+// positive.
+func ResponseJitter(maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+	return retry.AddJitter(0, maxJitter)
+}
+
+// ResponseJitterHandler delays each request by a random duration of up to maxJitter before
+// passing it to the handler, so that clients polling in lockstep drift apart over time.
+// Requests whose context is done while they are delayed are not passed to the handler.
+// Requests are not delayed if maxJitter is not positive.
+func ResponseJitterHandler(handler http.Handler, maxJitter time.Duration) http.Handler {
+	if maxJitter <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timer := time.NewTimer(ResponseJitter(maxJitter))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			handler.ServeHTTP(w, r)
+		case <-r.Context().Done():
+		}
+	})
+}
+
+// RequestBodyErrorMessage returns the error message to respond with if reading a request
+// body failed because the body exceeded the maximum request body size (413) or wasn't
+// received before the server read timeout (408), or nil for other errors.
+func RequestBodyErrorMessage(err error) *ErrorMessage {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return requestBodyTooLargeErrorMessage(maxBytesErr.Limit)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &ErrorMessage{
+			Code:          ErrRequestTimeout,
+			Message:       "Timed out reading the request body",
+			HTTPErrorCode: http.StatusRequestTimeout,
+		}
+	}
+	return nil
+}
+
+func requestBodyTooLargeErrorMessage(maxBytes int64) *ErrorMessage {
+	return &ErrorMessage{
+		Code:          ErrRequestBodyTooLarge,
+		Message:       fmt.Sprintf("Request body exceeds %d bytes", maxBytes),
+		HTTPErrorCode: http.StatusRequestEntityTooLarge,
+	}
+}
+
 func Is5XXStatus(statusCode int) bool {
 	return 500 <= statusCode && statusCode <= 599
 }
@@ -17,17 +17,24 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	mock_audit "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/mocks"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/response"
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -100,6 +107,24 @@ func TestWriteJSONResponse(t *testing.T) {
 	assert.Equal(t, res, actualResponse)
 }
 
+// Tests that WriteJSONResponse writes the same bytes as json.Marshal, including for
+// responses that are escaped and responses bigger than the JSON encoders that are pooled.
+func TestWriteJSONResponseMatchesMarshal(t *testing.T) {
+	for _, res := range []interface{}{
+		response.PortResponse{ContainerPort: 8080, Protocol: "TCP", HostPort: 80, HostIp: "<IP>&"},
+		map[string]string{"b": "line\nbreak", "a": "\u2028"},
+		strings.Repeat("x", maxPooledJSONBufferSize+1),
+		"small",
+	} {
+		expected, err := json.Marshal(res)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		WriteJSONResponse(recorder, http.StatusOK, res, RequestTypeTaskMetadata)
+		assert.Equal(t, string(expected), recorder.Body.String())
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	}
+}
+
 // Tests that an empty JSON response is written by WriteJSONResponse if the provided response
 // is not convertible to JSON.
 func TestWriteJSONResponseError(t *testing.T) {
@@ -111,6 +136,12 @@ func TestWriteJSONResponseError(t *testing.T) {
 	assert.Equal(t, "{}", recorder.Body.String())
 }
 
+func TestSortedKeys(t *testing.T) {
+	assert.Empty(t, SortedKeys(map[string]string(nil)))
+	assert.Equal(t, []string{"a", "b", "bridge", "c"},
+		SortedKeys(map[string]int{"c": 3, "bridge": 2, "a": 1, "b": 0}))
+}
+
 func TestValueFromRequest(t *testing.T) {
 	r, _ := http.NewRequest("GET", "/v1/credentials?id=credid", nil)
 	val, ok := ValueFromRequest(r, "id")
@@ -119,6 +150,31 @@ func TestValueFromRequest(t *testing.T) {
 	assert.Equal(t, "credid", val)
 }
 
+// Tests that ValueFromRequest finds fields whose names are escaped, and doesn't find
+// fields that are only part of the query.
+func TestValueFromRequestQueries(t *testing.T) {
+	for _, tc := range []struct {
+		query         string
+		expectedValue string
+		expectedOK    bool
+	}{
+		{query: "id=credid", expectedValue: "credid", expectedOK: true},
+		{query: "%69d=credid", expectedValue: "credid", expectedOK: true},
+		{query: "id", expectedOK: true},
+		{query: "other=1", expectedOK: false},
+		{query: "other=id", expectedOK: false},
+		{query: "", expectedOK: false},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "/v1/credentials?"+tc.query, nil)
+			require.NoError(t, err)
+			val, ok := ValueFromRequest(r, "id")
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expectedValue, val)
+		})
+	}
+}
+
 // Tests that an audit log is created by LimitReachHandler
 func TestLimitReachHandler(t *testing.T) {
 	// Prepare a request
@@ -137,6 +193,99 @@ func TestLimitReachHandler(t *testing.T) {
 	handler.ServeHTTP(recorder, req)
 }
 
+func TestMaxRequestBodyHandler(t *testing.T) {
+	handler := MaxRequestBodyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		if errorMessage := RequestBodyErrorMessage(err); errorMessage != nil {
+			WriteJSONResponse(w, errorMessage.HTTPErrorCode, errorMessage, "test")
+			return
+		}
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+	}), 8)
+
+	testCases := []struct {
+		name          string
+		body          string
+		contentLength int64
+		expectedCode  int
+	}{
+		{name: "within limit", body: "12345678", contentLength: 8, expectedCode: http.StatusOK},
+		{name: "content length over limit", body: "123456789", contentLength: 9, expectedCode: http.StatusRequestEntityTooLarge},
+		{name: "chunked body over limit", body: "123456789", contentLength: -1, expectedCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/endpoint", strings.NewReader(tc.body))
+			req.ContentLength = tc.contentLength
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+			if tc.expectedCode != http.StatusOK {
+				var errorMessage ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+				assert.Equal(t, ErrRequestBodyTooLarge, errorMessage.Code)
+				assert.Equal(t, "Request body exceeds 8 bytes", errorMessage.Message)
+			}
+		})
+	}
+}
+
+func TestResponseJitter(t *testing.T) {
+	assert.Zero(t, ResponseJitter(0))
+	assert.Zero(t, ResponseJitter(-time.Second))
+	for i := 0; i < 1000; i++ {
+		jitter := ResponseJitter(10 * time.Millisecond)
+		assert.GreaterOrEqual(t, jitter, time.Duration(0))
+		assert.Less(t, jitter, 10*time.Millisecond)
+	}
+}
+
+func TestResponseJitterHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("delayed within bound", func(t *testing.T) {
+		const maxJitter = 20 * time.Millisecond
+		for i := 0; i < 10; i++ {
+			recorder := httptest.NewRecorder()
+			start := time.Now()
+			ResponseJitterHandler(handler, maxJitter).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			assert.Less(t, time.Since(start), maxJitter+time.Second)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		start := time.Now()
+		ResponseJitterHandler(handler, 0).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		assert.Less(t, time.Since(start), 10*time.Millisecond)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+	t.Run("request canceled while delayed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		called := false
+		ResponseJitterHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}), time.Hour).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		assert.False(t, called)
+	})
+}
+
+func TestRequestBodyErrorMessage(t *testing.T) {
+	assert.Nil(t, RequestBodyErrorMessage(nil))
+	assert.Nil(t, RequestBodyErrorMessage(errors.New("unexpected EOF")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge,
+		RequestBodyErrorMessage(fmt.Errorf("decode: %w", &http.MaxBytesError{Limit: 8})).HTTPErrorCode)
+
+	timeout := RequestBodyErrorMessage(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded})
+	require.NotNil(t, timeout)
+	assert.Equal(t, ErrRequestTimeout, timeout.Code)
+	assert.Equal(t, http.StatusRequestTimeout, timeout.HTTPErrorCode)
+}
+
 func TestIs5XXStatus(t *testing.T) {
 	yes := []int{500, 501, 550, http.StatusInternalServerError, http.StatusServiceUnavailable, 580, 599}
 	for _, y := range yes {
@@ -152,3 +301,138 @@ func TestIs5XXStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestCanonicalCredentialsPath(t *testing.T) {
+	for _, tc := range []struct {
+		path          string
+		expectedPath  string
+		expectedMatch bool
+	}{
+		{path: "/v1/credentials", expectedPath: "/v1/credentials", expectedMatch: true},
+		{path: "/V1/credentials", expectedPath: "/v1/credentials", expectedMatch: true},
+		{path: "/v1/credentials/", expectedPath: "/v1/credentials", expectedMatch: true},
+		{path: "/V1/credentials/", expectedPath: "/v1/credentials", expectedMatch: true},
+		{path: "/v2/credentials/CredsID", expectedPath: "/v2/credentials/CredsID", expectedMatch: true},
+		{path: "/V2/credentials/CredsID/", expectedPath: "/v2/credentials/CredsID", expectedMatch: true},
+		{path: "/V2/credentials/", expectedPath: "/v2/credentials/", expectedMatch: true},
+		{path: "/v1/Credentials", expectedMatch: false},
+		{path: "/v1/credentialsx", expectedMatch: false},
+		{path: "/vx/credentials", expectedMatch: false},
+		{path: "/v/credentials", expectedMatch: false},
+		{path: "/credentials", expectedMatch: false},
+		{path: "/v2/metadata", expectedMatch: false},
+		{path: "/", expectedMatch: false},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			path, ok := CanonicalCredentialsPath(tc.path)
+			assert.Equal(t, tc.expectedMatch, ok)
+			assert.Equal(t, tc.expectedPath, path)
+		})
+	}
+}
+
+func TestCredentialsPathHandler(t *testing.T) {
+	var servedPath, servedQuery string
+	handler := CredentialsPathHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servedPath, servedQuery = r.URL.Path, r.URL.RawQuery
+	}))
+	for path, expectedPath := range map[string]string{
+		"/V1/credentials/?id=credsid": "/v1/credentials",
+		"/v1/credentials?id=credsid":  "/v1/credentials",
+		"/v2/metadata/?id=credsid":    "/v2/metadata/",
+	} {
+		t.Run(path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", path, nil)
+			require.NoError(t, err)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, expectedPath, servedPath)
+			assert.Equal(t, "id=credsid", servedQuery)
+		})
+	}
+}
+
+func TestPathNormalizationHandler(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/metadata", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/v3/{id:[^/]*}/task", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/v2/credentials/{id:.*}", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/v1/tasks", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	var servedPath, servedQuery string
+	handler := PathNormalizationHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servedPath, servedQuery = r.URL.Path, r.URL.RawQuery
+	}), router)
+	for path, expectedPath := range map[string]string{
+		"/v2/metadata?q=1":              "/v2/metadata",
+		"/v2/metadata/?q=1":             "/v2/metadata",
+		"/V2/Metadata/?q=1":             "/v2/metadata",
+		"/V3/EndpointID/TASK?q=1":       "/v3/EndpointID/task",
+		"/v3/EndpointID/task/?q=1":      "/v3/EndpointID/task",
+		"/V2/Credentials/CredsID/x?q=1": "/v2/credentials/CredsID/x",
+		// Paths that match no route and methods that don't match are passed as they are
+		"/v2/metadata/x?q=1": "/v2/metadata/x",
+		"/v4/metadata?q=1":   "/v4/metadata",
+		"/v1/tasks?q=1":      "/v1/tasks",
+	} {
+		t.Run(path, func(t *testing.T) {
+			method := "GET"
+			if strings.HasPrefix(path, "/v1/tasks") {
+				method = "POST"
+			}
+			req, err := http.NewRequest(method, path, nil)
+			require.NoError(t, err)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, expectedPath, servedPath)
+			assert.Equal(t, "q=1", servedQuery)
+		})
+	}
+}
+
+func TestPathNormalizationHandlerNotFoundHandler(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/metadata", func(w http.ResponseWriter, r *http.Request) {})
+	router.NotFoundHandler = http.NotFoundHandler()
+	var servedPath string
+	handler := PathNormalizationHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servedPath = r.URL.Path
+	}), router)
+	req, err := http.NewRequest("GET", "/V2/metadata/", nil)
+	require.NoError(t, err)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "/v2/metadata", servedPath)
+}
+
+func TestForwardedPrefixHandler(t *testing.T) {
+	var servedPath, servedQuery string
+	handler := ForwardedPrefixHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servedPath, servedQuery = r.URL.Path, r.URL.RawQuery
+	}))
+	testCases := []struct {
+		name         string
+		path         string
+		prefixes     []string
+		expectedPath string
+	}{
+		{"no header", "/ecs/v2/credentials/id", nil, "/ecs/v2/credentials/id"},
+		{"prefix", "/ecs/v2/credentials/id", []string{"/ecs"}, "/v2/credentials/id"},
+		{"prefix with trailing slash", "/ecs/v2/credentials/id", []string{"/ecs/"}, "/v2/credentials/id"},
+		{"prefix only", "/ecs", []string{"/ecs"}, "/"},
+		{"chained prefixes", "/a/b/v1/credentials", []string{"/a, /b"}, "/v1/credentials"},
+		{"chained headers", "/a/b/v1/credentials", []string{"/a", "/b"}, "/v1/credentials"},
+		{"stripped by the proxy", "/v2/credentials/id", []string{"/ecs"}, "/v2/credentials/id"},
+		{"partial segment", "/ecsx/v2/credentials/id", []string{"/ecs"}, "/ecsx/v2/credentials/id"},
+		{"relative prefix", "/ecs/v2/credentials/id", []string{"ecs"}, "/ecs/v2/credentials/id"},
+		{"empty prefix", "/v2/credentials/id", []string{""}, "/v2/credentials/id"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.path+"?q=1", nil)
+			require.NoError(t, err)
+			for _, prefix := range tc.prefixes {
+				req.Header.Add(ForwardedPrefixHeader, prefix)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tc.expectedPath, servedPath)
+			assert.Equal(t, "q=1", servedQuery)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ErrCredentialsNotYetActive is the error code indicating that the credentials for the
+	// specified ID have an activation time in the future
+	ErrCredentialsNotYetActive = "CredentialsNotYetActive"
+
+	// RetryAfterHeader is the response header containing the number of seconds after which
+	// the request can be retried
+	RetryAfterHeader = "Retry-After"
+)
+
+// checkActivation verifies that the credentials are active at the given time. If they are
+// not, it returns an error message along with the number of whole seconds, rounded up,
+// until the credentials become active.
+func checkActivation(
+	taskCredentials credentials.TaskIAMRoleCredentials,
+	now time.Time,
+	errPrefix string,
+) (int, *handlersutils.ErrorMessage) {
+	if !taskCredentials.NotYetActive(now) {
+		return 0, nil
+	}
+	retryAfter := int(math.Ceil(taskCredentials.NotBefore.Sub(now).Seconds()))
+	errText := errPrefix + "Credentials are not yet active"
+	seelog.Warnf("Error processing credential request credentialType=%s taskARN=%s notBefore=%s: %s",
+		taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN,
+		taskCredentials.NotBefore.UTC().Format(time.RFC3339), errText)
+	return retryAfter, &handlersutils.ErrorMessage{
+		Code:          ErrCredentialsNotYetActive,
+		Message:       errText,
+		HTTPErrorCode: http.StatusServiceUnavailable,
+	}
+}
+
+// setRetryAfter sets the Retry-After header of the response.
+func setRetryAfter(w http.ResponseWriter, seconds int) {
+	w.Header().Set(RetryAfterHeader, strconv.Itoa(seconds))
+}
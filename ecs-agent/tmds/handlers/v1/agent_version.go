@@ -0,0 +1,38 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import "net/http"
+
+// AgentVersionHeader is the response header containing the version of the agent that served
+// the credentials response, for correlating client-side issues with agent builds.
+const AgentVersionHeader = "X-Amzn-Agent-Version"
+
+// Tag credentials responses, including error responses, with the given agent version in the
+// X-Amzn-Agent-Version header. Responses are not tagged if the version is empty, which is
+// the default.
+func WithAgentVersion(version string) ConfigOpt {
+	return func(c *Config) {
+		c.agentVersion = version
+	}
+}
+
+// setAgentVersionHeader tags the response with the agent version, if it's set. It must be
+// called before anything is written.
+func (c *Config) setAgentVersionHeader(w http.ResponseWriter) {
+	if c == nil || c.agentVersion == "" {
+		return
+	}
+	w.Header().Set(AgentVersionHeader, c.agentVersion)
+}
@@ -0,0 +1,60 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"net/http"
+)
+
+// ChecksumTrailer is the response trailer containing the base64 encoded SHA-256 digest of
+// the response body, for clients to verify the integrity of the body once it's read.
+const ChecksumTrailer = "X-Amzn-Checksum"
+
+// Send the SHA-256 digest of credentials response bodies in the X-Amzn-Checksum trailer,
+// which is declared in the Trailer header. The digest is computed as the body is written,
+// and responses with trailers are sent with the chunked transfer encoding. Trailers are not
+// sent if not set.
+func WithChecksumTrailer(enabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.checksumTrailer = enabled
+	}
+}
+
+// checksumResponseWriter is a response writer that digests the body as it's written.
+type checksumResponseWriter struct {
+	http.ResponseWriter
+	digest hash.Hash
+}
+
+// newChecksumResponseWriter declares the checksum trailer in the headers of the response
+// and returns a writer that digests the body written to w.
+func newChecksumResponseWriter(w http.ResponseWriter) *checksumResponseWriter {
+	w.Header().Add("Trailer", ChecksumTrailer)
+	return &checksumResponseWriter{ResponseWriter: w, digest: sha256.New()}
+}
+
+func (w *checksumResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.digest.Write(b[:n])
+	return n, err
+}
+
+// setTrailer sets the checksum trailer to the digest of the body that was written. It must
+// be called once the body is written.
+func (w *checksumResponseWriter) setTrailer() {
+	w.Header().Set(ChecksumTrailer, base64.StdEncoding.EncodeToString(w.digest.Sum(nil)))
+}
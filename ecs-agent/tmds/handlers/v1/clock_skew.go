@@ -0,0 +1,86 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ErrClockSkewDetected is the error code indicating that the credentials appear to
+	// have expired because of clock skew rather than their age
+	ErrClockSkewDetected = "ClockSkewDetected"
+
+	// ClockSkewThreshold is how long before they were generated the credentials must have
+	// expired for the expiry to be attributed to clock skew
+	ClockSkewThreshold = 5 * time.Minute
+)
+
+// Set an estimator of the host clock skew to report with credentials. Only the v4 task
+// metadata with credentials handler reports the skew.
+func WithClockSkewEstimator(estimator clockdrift.Estimator) ConfigOpt {
+	return func(c *Config) {
+		c.clockSkew = estimator
+	}
+}
+
+// ClockSkewEstimate returns the latest estimate of the host clock skew, and false if
+// there is no estimator or the skew has not been estimated yet.
+func (c *Config) ClockSkewEstimate() (clockdrift.Estimate, bool) {
+	if c == nil || c.clockSkew == nil {
+		return clockdrift.Estimate{}, false
+	}
+	return c.clockSkew.Estimate()
+}
+
+// checkClockSkew returns an error message if the credentials expired long ago although
+// they were generated recently, which can't be explained by the age of the credentials.
+// Either the clock jumped since the credentials were generated, or it is ahead of the
+// clock of their issuer. Credentials that are genuinely expired, or that have no
+// generation time or a malformed expiration, pass the check.
+func checkClockSkew(
+	taskCredentials credentials.TaskIAMRoleCredentials,
+	now time.Time,
+	errPrefix string,
+) *handlersutils.ErrorMessage {
+	if taskCredentials.GeneratedAt.IsZero() {
+		return nil
+	}
+	expiration, err := time.Parse(time.RFC3339, taskCredentials.IAMRoleCredentials.Expiration)
+	if err != nil {
+		return nil
+	}
+	untilExpiry := expiration.Sub(now)
+	sinceGenerated := now.Sub(taskCredentials.GeneratedAt)
+	if untilExpiry > -ClockSkewThreshold || sinceGenerated > -untilExpiry-ClockSkewThreshold {
+		return nil
+	}
+	errText := errPrefix + "Credentials expired before they were generated, which indicates clock skew; " +
+		"check that the client clock is synchronized"
+	seelog.Warnf("Error processing credential request credentialType=%s taskARN=%s expiration=%s generatedAt=%s: %s",
+		taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN,
+		taskCredentials.IAMRoleCredentials.Expiration,
+		taskCredentials.GeneratedAt.UTC().Format(time.RFC3339), errText)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrClockSkewDetected,
+		Message:       errText,
+		HTTPErrorCode: http.StatusServiceUnavailable,
+	}
+}
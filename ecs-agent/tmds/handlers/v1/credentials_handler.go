@@ -18,14 +18,22 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
-	auditinterface "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
 	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/utils"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
 	"github.com/cihub/seelog"
+	"github.com/gorilla/mux"
 )
 
 const (
@@ -37,6 +45,10 @@ const (
 	// ErrInvalidIDInRequest is the error code indicating that the ID was invalid
 	ErrInvalidIDInRequest = "InvalidIdInRequest"
 
+	// ErrCredentialsRetired is the error code indicating that the ID was valid, but its
+	// credentials have been removed, for example because the task was replaced
+	ErrCredentialsRetired = "CredentialsRetired"
+
 	// ErrNoCredentialsAssociated is the error code indicating no credentials are
 	// associated with the specified ID
 	ErrNoCredentialsAssociated = "NoCredentialsAssociated"
@@ -49,24 +61,163 @@ const (
 	// ErrInternalServer is the error indicating something generic went wrong
 	ErrInternalServer = "InternalServerError"
 
+	// CredentialsRevisionHeader is the response header containing the revision of the
+	// credentials returned for the credentials ID
+	CredentialsRevisionHeader = "X-Amzn-Credentials-Revision"
+
 	// Credentials API version.
 	apiVersion = 1
 
+	// APIVersion is the API version that v1 credentials requests are audit logged with
+	APIVersion = "v1"
+
 	// CredentialsPath specifies the relative URI path for serving task IAM credentials
 	CredentialsPath = credentials.V1CredentialsPath
+
+	// CredentialsRouteName is the name of the route that the credentials handler is
+	// registered under
+	CredentialsRouteName = "v1/credentials"
 )
 
+// credentialsResponse is the response for a credentials request. It augments the IAM
+// role credentials with the revision of the credentials in the credentials manager.
+type credentialsResponse struct {
+	credentials.IAMRoleCredentials
+	Revision uint64 `json:"Revision"`
+	// RefreshAfter is when clients are advised to refresh the credentials, which is omitted
+	// if the expiration of the credentials isn't known
+	RefreshAfter string `json:"RefreshAfter,omitempty"`
+}
+
+// Configuration for the credentials handler
+type Config struct {
+	path               string               // path that the credentials handler is registered under
+	faults             map[string]Fault     // faults to inject for credentials IDs, for testing only
+	maintenance        *MaintenanceToggle   // toggle for pausing credential serving
+	reconciliation     *ReconciliationGate  // gate holding back credential serving until state is reconciled
+	signer             *ResponseSigner      // signer for credentials responses, responses are unsigned if nil
+	clockSkew          clockdrift.Estimator // estimator of the host clock skew reported with credentials
+	observers          []RequestObserver    // observers notified of every credentials request
+	tunables           *TunablesHolder      // tunables that can be swapped while serving requests
+	apiVersion         string               // API version that requests are audit logged with
+	schemaValidation   SchemaValidationMode // what to do with responses that don't match the response schema
+	taskStatus         TaskStatusLookup     // lookup of task statuses, credentials are served for tasks in any status if nil
+	partitionCheck     bool                 // whether credentials must be in the partition of their task
+	notFoundRetryAfter time.Duration        // backoff advised to clients for credentials that aren't found
+	checksumTrailer    bool                 // whether the digest of response bodies is sent in a trailer
+	responseCache      ResponseCache        // cache of marshaled credentials responses, responses aren't cached if nil
+	headerGuard        *headerGuard         // guard rejecting requests with suspicious headers, requests aren't checked if nil
+	agentVersion       string               // agent version that responses are tagged with, responses aren't tagged if empty
+	provider           *credentialsProvider // provider consulted for credentials IDs in its namespace, none is consulted if nil
+	validation         *validationCache     // validation of credentials before they are served, they aren't validated if nil
+	expectedLocalPort  uint16               // local port that requests must be received on, ports aren't checked if 0
+	refreshAfterMargin time.Duration        // how long before credentials expire clients are advised to refresh them
+	disabled           bool                 // whether RegisterCredentialsHandler skips registering the handler
+}
+
+// Function type for updating credentials handler config
+type ConfigOpt func(*Config)
+
+// Set a custom path for the credentials handler to be registered under. This is useful
+// for deployments behind rewriting proxies. CredentialsPath is used if not set.
+func WithPath(path string) ConfigOpt {
+	return func(c *Config) {
+		c.path = path
+	}
+}
+
+// Set the API version that requests are audit logged with. The credentials handlers
+// default to their own version, so this is only needed by handlers that reuse
+// CredentialsHandlerImpl for another API version.
+func WithAPIVersion(apiVersion string) ConfigOpt {
+	return func(c *Config) {
+		c.apiVersion = apiVersion
+	}
+}
+
+// Disable the 'v1/credentials' API, so that RegisterCredentialsHandler doesn't register
+// the handler and requests to its path are answered with 404 by the router. Handlers of
+// other API versions that share the options are not affected.
+func WithV1Disabled(disabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.disabled = disabled
+	}
+}
+
+// NewConfig creates a credentials handler config with defaults and applies the provided options.
+func NewConfig(options ...ConfigOpt) *Config {
+	config := &Config{
+		path:               CredentialsPath,
+		apiVersion:         APIVersion,
+		responseCache:      NewMemoryResponseCache(DefaultResponseCacheSize),
+		refreshAfterMargin: DefaultRefreshAfterMargin,
+	}
+	for _, opt := range options {
+		opt(config)
+	}
+	if scheduler, ok := config.responseCache.(*RefreshScheduler); ok {
+		// The responses that the scheduler refreshes must be the same as the ones it's given
+		scheduler.setRefreshAfterMargin(config.refreshAfterMargin)
+	}
+	return config
+}
+
+// Path returns the path that the credentials handler is registered under.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Disabled returns whether the 'v1/credentials' API is disabled.
+func (c *Config) Disabled() bool {
+	return c.disabled
+}
+
+// RegisterCredentialsHandler registers the handler for the 'v1/credentials' API on the
+// provided router. The handler is registered under CredentialsPath unless a custom path
+// is provided with WithPath, and isn't registered if the API is disabled with
+// WithV1Disabled.
+func RegisterCredentialsHandler(
+	router *mux.Router,
+	credentialsManager credentials.Manager,
+	auditLogger audit.AuditLogger,
+	options ...ConfigOpt,
+) {
+	config := NewConfig(options...)
+	if config.signer != nil {
+		// The public key is served even if the v1 API is disabled, for the other credentials APIs
+		RegisterSigningKeyHandler(router, config.signer)
+	}
+	if config.Disabled() {
+		seelog.Infof("The %s API is disabled, not registering its handler", CredentialsRouteName)
+		return
+	}
+	router.HandleFunc(config.Path(), credentialsHandler(credentialsManager, auditLogger, config)).
+		Name(CredentialsRouteName)
+}
+
 // CredentialsHandler creates response for the 'v1/credentials' API. It returns a JSON response
 // containing credentials when found. The HTTP status code of 400 is returned otherwise.
+// The non-secret fields of the response can be selected with FieldsQueryParameterName.
+// Responses carry the headers of handlersutils.SecurityHeadersHandler.
 func CredentialsHandler(
 	credentialsManager credentials.Manager,
-	auditLogger auditinterface.AuditLogger,
+	auditLogger audit.AuditLogger,
+	options ...ConfigOpt,
+) func(http.ResponseWriter, *http.Request) {
+	return credentialsHandler(credentialsManager, auditLogger, NewConfig(options...))
+}
+
+func credentialsHandler(
+	credentialsManager credentials.Manager,
+	auditLogger audit.AuditLogger,
+	config *Config,
 ) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+	// The error prefix is formatted once, not for every request
+	errPrefix := fmt.Sprintf("CredentialsV%dRequest: ", apiVersion)
+	return handlersutils.SecurityHeadersHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		credentialsID := getCredentialsID(r)
-		errPrefix := fmt.Sprintf("CredentialsV%dRequest: ", apiVersion)
-		CredentialsHandlerImpl(w, r, auditLogger, credentialsManager, credentialsID, errPrefix)
-	}
+		CredentialsHandlerImpl(w, r, auditLogger, credentialsManager, credentialsID, errPrefix, config)
+	})).ServeHTTP
 }
 
 // CredentialsHandlerImpl is the major logic in CredentialsHandler, abstract this out
@@ -74,35 +225,253 @@ func CredentialsHandler(
 func CredentialsHandlerImpl(
 	w http.ResponseWriter,
 	r *http.Request,
-	auditLogger auditinterface.AuditLogger,
+	auditLogger audit.AuditLogger,
 	credentialsManager credentials.Manager,
 	credentialsID string,
 	errPrefix string,
+	config *Config,
 ) {
-	responseJSON, arn, roleType, errorMessage, err := processCredentialsRequest(
-		credentialsManager, r, credentialsID, errPrefix)
-	if err != nil {
-		errResponseJSON, err := json.Marshal(errorMessage)
-		if e := handlersutils.WriteResponseIfMarshalError(w, err); e != nil {
+	ServeCredentials(w, r, auditLogger, credentialsManager, credentialsID, errPrefix, config, nil)
+}
+
+// CredentialsResponder writes the response of a credentials request once the credentials
+// can be served. responseJSON is the credentials response of the credentials handlers, and
+// taskCredentials the credentials it was created from. The responder signs what it writes
+// with SignResponse. It returns an error message to respond with instead, in which case it
+// must not have written anything.
+type CredentialsResponder func(
+	w http.ResponseWriter,
+	responseJSON []byte,
+	taskCredentials credentials.TaskIAMRoleCredentials,
+) *handlersutils.ErrorMessage
+
+// ServeCredentials serves the credentials of a request with all the checks of the
+// credentials handlers, and audit logs and observes the request. Once the credentials can
+// be served, the response is written by respond, or is the credentials response if respond
+// is nil. It is exported for handlers that serve credentials as part of a larger response.
+// Requests are served with the default config if config is nil.
+func ServeCredentials(
+	w http.ResponseWriter,
+	r *http.Request,
+	auditLogger audit.AuditLogger,
+	credentialsManager credentials.Manager,
+	credentialsID string,
+	errPrefix string,
+	config *Config,
+	respond CredentialsResponder,
+) {
+	start := time.Now()
+	if config == nil {
+		config = NewConfig()
+	}
+	config.setAgentVersionHeader(w)
+	if config.checksumTrailer {
+		checksumWriter := newChecksumResponseWriter(w)
+		defer checksumWriter.setTrailer()
+		w = checksumWriter
+	}
+	// The tunables are loaded once, so that a request isn't affected by a swap while it's in flight
+	tunables := config.loadTunables()
+	if errorMessage := config.localPortErrorMessage(r, credentialsID, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage,
+			audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+		return
+	}
+
+	if errorMessage := config.suspiciousHeaderErrorMessage(r, credentialsID, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage,
+			audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+		return
+	}
+
+	if errorMessage := config.ReconciliationErrorMessage(w, credentialsID, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage,
+			audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+		return
+	}
+
+	if errorMessage := config.maintenanceErrorMessage(credentialsID, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage,
+			audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+		return
+	}
+
+	if errorMessage := tunables.rateLimitErrorMessage(w, credentialsID, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage,
+			audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+		return
+	}
+
+	// Fields are only selected from the credentials response, not from the responses of respond
+	var fields []string
+	if respond == nil {
+		var errorMessage *handlersutils.ErrorMessage
+		if fields, errorMessage = selectedFields(r, errPrefix); errorMessage != nil {
+			writeCredentialsErrorResponse(w, r, start, errorMessage,
+				audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+			return
+		}
+	}
+
+	fault, faultInjected := config.faultFor(credentialsID)
+	if faultInjected {
+		if errorMessage := injectFault(r.Context(), fault, credentialsID, errPrefix); errorMessage != nil {
+			writeCredentialsErrorResponse(w, r, start, errorMessage,
+				audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+			return
+		}
+		if r.Context().Err() != nil {
+			// The client went away while the response was delayed
+			return
+		}
+	}
+
+	credentialsManager, errorMessage := config.providedCredentialsManager(r.Context(), credentialsManager,
+		credentialsID, errPrefix)
+	if errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage,
+			audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+		return
+	}
+
+	credentialsManager, roleSelected, errorMessage := selectedRoleCredentialsManager(r, credentialsManager,
+		credentialsID, errPrefix)
+	if errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage,
+			audit.GetCredentialsEventTypeFromRoleType(""), "", auditLogger, config)
+		return
+	}
+	cache := config.cache()
+	if roleSelected {
+		// Responses are cached by credentials ID, which the credentials of the selected
+		// role don't have
+		cache = nil
+	}
+
+	responseJSON, taskCredentials, errorMessage := processCredentialsRequestWithTunables(
+		w, r, credentialsManager, credentialsID, errPrefix, tunables, cache, config.refreshAfter())
+	arn := taskCredentials.ARN
+	roleType := taskCredentials.IAMRoleCredentials.RoleType
+	// The event type is looked up once for all the responses below
+	eventType := audit.GetCredentialsEventTypeFromRoleType(roleType)
+	if errorMessage != nil {
+		config.setNotFoundRetryAfter(w, errorMessage)
+		writeCredentialsErrorResponse(w, r, start, errorMessage, eventType, arn, auditLogger, config)
+		return
+	}
+
+	if errorMessage := config.taskStateErrorMessage(taskCredentials, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage, eventType, arn, auditLogger, config)
+		return
+	}
+
+	if errorMessage := config.partitionErrorMessage(taskCredentials, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage, eventType, arn, auditLogger, config)
+		return
+	}
+
+	if errorMessage := config.validationErrorMessage(r.Context(), taskCredentials, errPrefix); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage, eventType, arn, auditLogger, config)
+		return
+	}
+
+	if errorMessage := config.schemaErrorMessage(responseJSON, credentialsID); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage, eventType, arn, auditLogger, config)
+		return
+	}
+
+	if fields != nil {
+		selectedJSON, err := selectFields(responseJSON, fields)
+		if err != nil {
+			seelog.Errorf("Error selecting the fields of the credentials response credentialType=%s taskARN=%s: %v",
+				roleType, arn, err)
+			writeCredentialsErrorResponse(w, r, start, &handlersutils.ErrorMessage{
+				Code:          ErrInternalServer,
+				Message:       "Internal server error",
+				HTTPErrorCode: http.StatusInternalServerError,
+			}, eventType, arn, auditLogger, config)
 			return
 		}
-		writeCredentialsRequestResponse(w, r, errorMessage.HTTPErrorCode,
-			audit.GetCredentialsEventTypeFromRoleType(roleType), arn, auditLogger, errResponseJSON)
+		responseJSON = selectedJSON
+	}
+
+	if faultInjected && fault.Type == FaultTruncatedBody {
+		responseJSON = truncateBody(responseJSON)
+	}
+
+	if respond == nil {
+		writeCredentialsRequestResponse(w, r, start, http.StatusOK, "", eventType, arn, auditLogger, config,
+			responseJSON)
 		return
 	}
+	if errorMessage := respond(w, responseJSON, taskCredentials); errorMessage != nil {
+		writeCredentialsErrorResponse(w, r, start, errorMessage, eventType, arn, auditLogger, config)
+		return
+	}
+	logCredentialsRequest(r, start, http.StatusOK, "", eventType, arn, auditLogger, config)
+}
 
-	writeCredentialsRequestResponse(w, r, http.StatusOK,
-		audit.GetCredentialsEventTypeFromRoleType(roleType), arn, auditLogger, responseJSON)
+func processCredentialsRequestWithTunables(
+	w http.ResponseWriter,
+	r *http.Request,
+	credentialsManager credentials.Manager,
+	credentialsID string,
+	errPrefix string,
+	tunables *tunablesSnapshot,
+	cache ResponseCache,
+	refreshAfterMargin time.Duration,
+) ([]byte, credentials.TaskIAMRoleCredentials, *handlersutils.ErrorMessage) {
+	logf := tunables.logf
+	if logger.DebugLevelFromContext(r.Context()) {
+		// The log level of the request was raised to debug by its log level header
+		logf = seelog.Infof
+	}
+	responseJSON, taskCredentials, errorMessage, err := processCredentialsRequest(
+		credentialsManager, r, credentialsID, errPrefix, logf, cache, refreshAfterMargin)
+	if err != nil {
+		return nil, taskCredentials, errorMessage
+	}
+
+	if errorMessage := tunables.roleTypeErrorMessage(taskCredentials.IAMRoleCredentials.RoleType, errPrefix); errorMessage != nil {
+		return nil, taskCredentials, errorMessage
+	}
+
+	now := time.Now()
+	if retryAfter, errorMessage := checkActivation(taskCredentials, now, errPrefix); errorMessage != nil {
+		setRetryAfter(w, retryAfter)
+		return nil, taskCredentials, errorMessage
+	}
+
+	if errorMessage := checkClockSkew(taskCredentials, now, errPrefix); errorMessage != nil {
+		return nil, taskCredentials, errorMessage
+	}
+
+	scopeMatch, errorMessage := checkServiceScope(r, taskCredentials, errPrefix)
+	if errorMessage != nil {
+		return nil, taskCredentials, errorMessage
+	}
+	if scopeMatch {
+		w.Header().Set(CredentialsScopeMatchHeader, "true")
+	}
+
+	w.Header().Set(CredentialsRevisionHeader, strconv.FormatUint(taskCredentials.Revision, 10))
+	return responseJSON, taskCredentials, nil
 }
 
 // processCredentialsRequest returns the response json containing credentials for the
-// credentials id in the request
+// credentials id in the request along with the task credentials the response was
+// created from. The request is logged with logf. Responses are served from and added to
+// the cache, if not nil, and advise clients to refresh the credentials the margin before
+// they expire.
 func processCredentialsRequest(
 	credentialsManager credentials.Manager,
 	r *http.Request,
 	credentialsID string,
 	errPrefix string,
-) ([]byte, string, string, *handlersutils.ErrorMessage, error) {
+	logf func(format string, params ...interface{}),
+	cache ResponseCache,
+	refreshAfterMargin time.Duration,
+) ([]byte, credentials.TaskIAMRoleCredentials, *handlersutils.ErrorMessage, error) {
 	if credentialsID == "" {
 		errText := errPrefix + "No Credential ID in the request"
 		seelog.Errorf("Error processing credential request: %s", errText)
@@ -111,11 +480,24 @@ func processCredentialsRequest(
 			Message:       errText,
 			HTTPErrorCode: http.StatusBadRequest,
 		}
-		return nil, "", "", msg, errors.New(errText)
+		return nil, credentials.TaskIAMRoleCredentials{}, msg, errors.New(errText)
 	}
 
-	credentials, ok := credentialsManager.GetTaskCredentials(credentialsID)
+	taskCredentials, ok := credentialsManager.GetTaskCredentials(credentialsID)
+	if tracker, isTracker := credentialsManager.(credentials.RetiredCredentialsTracker); !ok && isTracker &&
+		tracker.IsCredentialsRetired(credentialsID) {
+		invalidateResponse(cache, credentialsID)
+		errText := errPrefix + "Credentials have been retired"
+		seelog.Errorf("Error processing credential request: %s", errText)
+		msg := &handlersutils.ErrorMessage{
+			Code:          ErrCredentialsRetired,
+			Message:       errText,
+			HTTPErrorCode: http.StatusGone,
+		}
+		return nil, credentials.TaskIAMRoleCredentials{}, msg, errors.New(errText)
+	}
 	if !ok {
+		invalidateResponse(cache, credentialsID)
 		errText := errPrefix + "Credentials not found"
 		seelog.Errorf("Error processing credential request: %s", errText)
 		msg := &handlersutils.ErrorMessage{
@@ -123,59 +505,184 @@ func processCredentialsRequest(
 			Message:       errText,
 			HTTPErrorCode: http.StatusBadRequest,
 		}
-		return nil, "", "", msg, errors.New(errText)
+		return nil, credentials.TaskIAMRoleCredentials{}, msg, errors.New(errText)
 	}
 
-	seelog.Infof("Processing credential request, credentialType=%s taskARN=%s",
-		credentials.IAMRoleCredentials.RoleType, credentials.ARN)
+	logf("Processing credential request, credentialType=%s taskARN=%s",
+		taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN)
 
-	if utils.ZeroOrNil(credentials.ARN) && utils.ZeroOrNil(credentials.IAMRoleCredentials) {
+	if utils.ZeroOrNil(taskCredentials.ARN) && utils.ZeroOrNil(taskCredentials.IAMRoleCredentials) {
 		// This can happen when the agent is restarted and is reconciling its state.
 		errText := errPrefix + "Credentials uninitialized for ID"
 		seelog.Errorf("Error processing credential request credentialType=%s taskARN=%s: %s",
-			credentials.IAMRoleCredentials.RoleType, credentials.ARN, errText)
+			taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, errText)
 		msg := &handlersutils.ErrorMessage{
 			Code:          ErrCredentialsUninitialized,
 			Message:       errText,
 			HTTPErrorCode: http.StatusServiceUnavailable,
 		}
-		return nil, "", "", msg, errors.New(errText)
+		return nil, credentials.TaskIAMRoleCredentials{}, msg, errors.New(errText)
 	}
 
-	credentialsJSON, err := json.Marshal(credentials.IAMRoleCredentials)
+	if utils.ZeroOrNil(taskCredentials.ARN) || utils.ZeroOrNil(taskCredentials.IAMRoleCredentials) {
+		// Only one of the task ARN and the credentials is set. Unlike the case above, this
+		// is not expected during reconciliation and indicates a corrupt record.
+		errText := errPrefix + "Credentials record is incomplete"
+		seelog.Errorf("Error processing credential request credentialType=%s taskARN=%s: %s",
+			taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, errText)
+		msg := &handlersutils.ErrorMessage{
+			Code:          ErrInternalServer,
+			Message:       "Internal server error",
+			HTTPErrorCode: http.StatusInternalServerError,
+		}
+		return nil, credentials.TaskIAMRoleCredentials{}, msg, errors.New(errText)
+	}
+
+	if credentialsJSON, ok := cachedResponse(cache, credentialsID, taskCredentials); ok {
+		return credentialsJSON, taskCredentials, nil, nil
+	}
+	credentialsJSON, err := marshalCredentialsResponse(taskCredentials, refreshAfterMargin)
 	if err != nil {
 		errText := errPrefix + "Error marshaling credentials"
 		seelog.Errorf("Error processing credential request credentialType=%s taskARN=%s: %s",
-			credentials.IAMRoleCredentials.RoleType, credentials.ARN, errText)
+			taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, errText)
 		msg := &handlersutils.ErrorMessage{
 			Code:          ErrInternalServer,
 			Message:       "Internal server error",
 			HTTPErrorCode: http.StatusInternalServerError,
 		}
-		return nil, "", "", msg, errors.New(errText)
+		return nil, credentials.TaskIAMRoleCredentials{}, msg, errors.New(errText)
 	}
 
 	// Success
-	return credentialsJSON, credentials.ARN, credentials.IAMRoleCredentials.RoleType, nil, nil
+	cacheResponse(cache, credentialsID, taskCredentials, credentialsJSON)
+	return credentialsJSON, taskCredentials, nil, nil
+}
+
+// marshalCredentialsResponse returns the response json of the credentials, advising clients
+// to refresh them the margin before they expire.
+func marshalCredentialsResponse(taskCredentials credentials.TaskIAMRoleCredentials,
+	refreshAfterMargin time.Duration) ([]byte, error) {
+	return json.Marshal(credentialsResponse{
+		IAMRoleCredentials: taskCredentials.IAMRoleCredentials,
+		Revision:           taskCredentials.Revision,
+		RefreshAfter:       refreshAfterTime(taskCredentials.IAMRoleCredentials.Expiration, refreshAfterMargin),
+	})
 }
 
 func writeCredentialsRequestResponse(
 	w http.ResponseWriter,
 	r *http.Request,
+	start time.Time,
 	httpStatusCode int,
+	errorCode string,
 	eventType string,
 	arn string,
-	auditLogger auditinterface.AuditLogger,
+	auditLogger audit.AuditLogger,
+	config *Config,
 	message []byte,
 ) {
-	auditLogger.Log(request.LogRequest{Request: r, ARN: arn}, httpStatusCode, eventType)
+	config.SignResponse(w, message)
 	handlersutils.WriteJSONToResponse(w, httpStatusCode, message, handlersutils.RequestTypeCreds)
+	logCredentialsRequest(r, start, httpStatusCode, errorCode, eventType, arn, auditLogger, config)
 }
 
+// logCredentialsRequest audit logs a credentials request and notifies the observers of it.
+func logCredentialsRequest(
+	r *http.Request,
+	start time.Time,
+	httpStatusCode int,
+	errorCode string,
+	eventType string,
+	arn string,
+	auditLogger audit.AuditLogger,
+	config *Config,
+) {
+	auditLogger.Log(request.LogRequest{Request: r, ARN: arn, APIVersion: config.apiVersion},
+		httpStatusCode, eventType)
+	config.observeRequest(RequestObservation{
+		APIVersion: config.apiVersion,
+		EventType:  eventType,
+		ARN:        arn,
+		StatusCode: httpStatusCode,
+		ErrorCode:  errorCode,
+		Latency:    time.Since(start),
+	})
+}
+
+func writeCredentialsErrorResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	start time.Time,
+	errorMessage *handlersutils.ErrorMessage,
+	eventType string,
+	arn string,
+	auditLogger audit.AuditLogger,
+	config *Config,
+) {
+	errResponseJSON, err := json.Marshal(errorMessage)
+	if e := handlersutils.WriteResponseIfMarshalError(w, err); e != nil {
+		return
+	}
+	writeCredentialsRequestResponse(w, r, start, errorMessage.HTTPErrorCode, errorMessage.Code, eventType, arn,
+		auditLogger, config, errResponseJSON)
+}
+
+// maxCredentialsIDLength bounds the length of the credentials ids that are looked up.
+// Credentials ids are UUIDs, far shorter than that.
+const maxCredentialsIDLength = 128
+
+// getCredentialsID returns the credentials id of the request query. The query comes from
+// untrusted clients and the id is written to logs, so ids that are too long, or that aren't
+// printable UTF-8, are treated as missing.
 func getCredentialsID(r *http.Request) string {
 	credentialsID, ok := handlersutils.ValueFromRequest(r, credentials.CredentialsIDQueryParameterName)
-	if ok {
-		return credentialsID
+	if !ok {
+		credentialsID, ok = getNonCanonicalCredentialsID(r)
+	}
+	if !ok {
+		return ""
+	}
+	if err := validateCredentialsID(credentialsID); err != nil {
+		seelog.Warnf("Ignoring the credentials id of the request from %s: %v", r.RemoteAddr, err)
+		return ""
+	}
+	return credentialsID
+}
+
+// getNonCanonicalCredentialsID returns the credentials id of the request query if it is
+// named in another case than CredentialsIDQueryParameterName, such as 'ID', and logs a
+// warning as clients should use the canonical name. The first such name is used in
+// lexical order if there are several.
+func getNonCanonicalCredentialsID(r *http.Request) (string, bool) {
+	var names []string
+	values := r.URL.Query()
+	for name := range values {
+		if strings.EqualFold(name, credentials.CredentialsIDQueryParameterName) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	sort.Strings(names)
+	seelog.Warnf("Request from %s names the credentials id with the non-canonical query parameter %q; "+
+		"use %q, non-canonical names may not be supported in the future",
+		r.RemoteAddr, names[0], credentials.CredentialsIDQueryParameterName)
+	return values.Get(names[0]), true
+}
+
+func validateCredentialsID(credentialsID string) error {
+	if len(credentialsID) > maxCredentialsIDLength {
+		return fmt.Errorf("credentials id of %d bytes exceeds %d bytes", len(credentialsID), maxCredentialsIDLength)
+	}
+	if !utf8.ValidString(credentialsID) {
+		return errors.New("credentials id is not valid UTF-8")
+	}
+	for _, r := range credentialsID {
+		if !unicode.IsPrint(r) || r == ' ' {
+			return fmt.Errorf("credentials id contains the whitespace or unprintable character %U", r)
+		}
 	}
-	return ""
+	return nil
 }
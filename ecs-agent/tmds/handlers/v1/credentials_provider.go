@@ -0,0 +1,203 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ErrCredentialsProviderTimeout is the error code indicating that the credentials
+	// provider didn't return credentials within its timeout
+	ErrCredentialsProviderTimeout = "CredentialsProviderTimeout"
+	// ErrCredentialsProviderFailure is the error code indicating that the credentials
+	// provider failed or returned malformed credentials
+	ErrCredentialsProviderFailure = "CredentialsProviderFailure"
+
+	// DefaultCredentialsProviderTimeout is how long the credentials provider is waited
+	// for if no timeout is given
+	DefaultCredentialsProviderTimeout = time.Second
+)
+
+// ErrCredentialsNotProvided is returned by credentials providers that have no credentials
+// for a credentials ID. The credentials are then not found, as with the credentials
+// manager.
+var ErrCredentialsNotProvided = errors.New("credentials not provided")
+
+// CredentialsProvider provides task credentials that aren't IAM role credentials of the
+// credentials manager, such as credentials issued by an external broker. Implementations
+// must be safe for concurrent use.
+type CredentialsProvider interface {
+	// ProvideCredentials returns the credentials for the credentials ID, or
+	// ErrCredentialsNotProvided if it has none. It should return once ctx is done, as the
+	// request is failed when the timeout of the provider passes regardless.
+	ProvideCredentials(ctx context.Context, credentialsID string) (credentials.TaskIAMRoleCredentials, error)
+}
+
+// credentialsProvider is the credentials provider consulted for credentials IDs with its
+// prefix.
+type credentialsProvider struct {
+	prefix   string
+	provider CredentialsProvider
+	timeout  time.Duration
+}
+
+// Consult the given provider for credentials IDs starting with the prefix that the
+// credentials manager has no credentials for. The credentials manager stays authoritative
+// for the credentials IDs it has, so the prefix should be a namespace that the credentials
+// manager doesn't issue IDs in. Provided credentials are validated, and are served and
+// audit logged like the credentials of the credentials manager. Requests fail if the
+// provider doesn't return within the timeout, which is DefaultCredentialsProviderTimeout
+// if not positive. No provider is consulted if the provider is nil or the prefix is empty.
+func WithCredentialsProvider(prefix string, provider CredentialsProvider, timeout time.Duration) ConfigOpt {
+	return func(c *Config) {
+		if provider == nil || prefix == "" {
+			c.provider = nil
+			return
+		}
+		if timeout <= 0 {
+			timeout = DefaultCredentialsProviderTimeout
+		}
+		c.provider = &credentialsProvider{prefix: prefix, provider: provider, timeout: timeout}
+	}
+}
+
+// providedCredentialsManager returns the credentials manager to serve the request from.
+// If the credentials ID is in the namespace of the credentials provider and the credentials
+// manager has no credentials for it, that's a credentials manager that has the credentials
+// of the provider as well. It returns an error message if the provider times out, fails or
+// returns malformed credentials.
+func (c *Config) providedCredentialsManager(
+	ctx context.Context,
+	credentialsManager credentials.Manager,
+	credentialsID string,
+	errPrefix string,
+) (credentials.Manager, *handlersutils.ErrorMessage) {
+	if c == nil || c.provider == nil || !strings.HasPrefix(credentialsID, c.provider.prefix) {
+		return credentialsManager, nil
+	}
+	if _, ok := credentialsManager.GetTaskCredentials(credentialsID); ok {
+		return credentialsManager, nil
+	}
+	taskCredentials, err := c.provider.provide(ctx, credentialsID)
+	if errors.Is(err, ErrCredentialsNotProvided) {
+		// The credentials are not found when the credentials manager is consulted
+		return credentialsManager, nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		errText := errPrefix + "Credentials provider timed out"
+		seelog.Errorf("Error processing credential request for credentials ID %s: %s after %s",
+			credentialsID, errText, c.provider.timeout)
+		return nil, &handlersutils.ErrorMessage{
+			Code:          ErrCredentialsProviderTimeout,
+			Message:       errText,
+			HTTPErrorCode: http.StatusGatewayTimeout,
+		}
+	}
+	if err == nil {
+		err = validateProvidedCredentials(credentialsID, taskCredentials)
+	}
+	if err != nil {
+		errText := errPrefix + "Credentials provider failed"
+		seelog.Errorf("Error processing credential request for credentials ID %s: %s: %v",
+			credentialsID, errText, err)
+		return nil, &handlersutils.ErrorMessage{
+			Code:          ErrCredentialsProviderFailure,
+			Message:       errText,
+			HTTPErrorCode: http.StatusBadGateway,
+		}
+	}
+	return &providedCredentials{Manager: credentialsManager, credentialsID: credentialsID,
+		taskCredentials: taskCredentials}, nil
+}
+
+// provide returns the credentials of the provider, or context.DeadlineExceeded if the
+// provider doesn't return within its timeout, even if it doesn't stop once its context
+// is done.
+func (p *credentialsProvider) provide(ctx context.Context, credentialsID string) (
+	credentials.TaskIAMRoleCredentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	type result struct {
+		taskCredentials credentials.TaskIAMRoleCredentials
+		err             error
+	}
+	// The channel is buffered so that a provider returning after the timeout doesn't block
+	results := make(chan result, 1)
+	go func() {
+		taskCredentials, err := p.provider.ProvideCredentials(ctx, credentialsID)
+		results <- result{taskCredentials: taskCredentials, err: err}
+	}()
+	select {
+	case res := <-results:
+		return res.taskCredentials, res.err
+	case <-ctx.Done():
+		return credentials.TaskIAMRoleCredentials{}, ctx.Err()
+	}
+}
+
+// validateProvidedCredentials returns an error if the provided credentials don't have
+// all the fields of the credentials response, or are for another credentials ID.
+func validateProvidedCredentials(credentialsID string, taskCredentials credentials.TaskIAMRoleCredentials) error {
+	roleCredentials := taskCredentials.IAMRoleCredentials
+	if roleCredentials.CredentialsID != credentialsID {
+		return fmt.Errorf("credentials are for credentials ID %q", roleCredentials.CredentialsID)
+	}
+	var missing []string
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"ARN", taskCredentials.ARN},
+		{"RoleArn", roleCredentials.RoleArn},
+		{"AccessKeyId", roleCredentials.AccessKeyID},
+		{"SecretAccessKey", roleCredentials.SecretAccessKey},
+		{"Token", roleCredentials.SessionToken},
+		{"Expiration", roleCredentials.Expiration},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("credentials are missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// providedCredentials is a credentials manager that has the given credentials for the
+// credentials ID, such as the credentials of the credentials provider, and the credentials
+// of the credentials manager for all other IDs.
+type providedCredentials struct {
+	credentials.Manager
+	credentialsID   string
+	taskCredentials credentials.TaskIAMRoleCredentials
+}
+
+func (p *providedCredentials) GetTaskCredentials(credentialsID string) (credentials.TaskIAMRoleCredentials, bool) {
+	if credentialsID == p.credentialsID {
+		return p.taskCredentials, true
+	}
+	return p.Manager.GetTaskCredentials(credentialsID)
+}
@@ -0,0 +1,171 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ErrCredentialsValidationFailed is the error code indicating that the credentials
+	// could not be validated before they were served
+	ErrCredentialsValidationFailed = "CredentialsValidationFailed"
+
+	// DefaultCredentialsValidationTimeout is how long the credentials validator is waited
+	// for if no timeout is given
+	DefaultCredentialsValidationTimeout = 2 * time.Second
+	// DefaultCredentialsValidationCacheTTL is how long the result of validating credentials
+	// is cached for if no TTL is given
+	DefaultCredentialsValidationCacheTTL = 5 * time.Minute
+
+	// maxCachedValidations is the number of validation results that are cached
+	maxCachedValidations = 1024
+)
+
+// CredentialsValidator validates that credentials work, such as by calling STS
+// GetCallerIdentity with them. Implementations must be safe for concurrent use.
+type CredentialsValidator interface {
+	// ValidateCredentials returns an error if the credentials don't work. It should return
+	// once ctx is done.
+	ValidateCredentials(ctx context.Context, roleCredentials credentials.IAMRoleCredentials) error
+}
+
+// validationCache validates credentials before they are served, caching the
+// results by the access key ID of the credentials.
+type validationCache struct {
+	validator CredentialsValidator
+	timeout   time.Duration
+	ttl       time.Duration
+	now       func() time.Time
+	results   map[string]validationResult
+	lock      sync.Mutex
+}
+
+type validationResult struct {
+	err       error
+	expiresAt time.Time
+}
+
+// Validate credentials with the given validator before they are served, and respond with
+// a 503 instead of credentials that fail validation, so that broken credentials are caught
+// before clients use them. This is meant for sensitive workloads, as validating credentials
+// calls out of the agent. The results are cached by access key ID for the TTL so that
+// validation isn't repeated for every request, and validation fails if the validator
+// doesn't return within the timeout. The timeout and the TTL default to
+// DefaultCredentialsValidationTimeout and DefaultCredentialsValidationCacheTTL if not
+// positive. Credentials aren't validated if the validator is nil, which is the default.
+func WithCredentialsValidation(validator CredentialsValidator, timeout, ttl time.Duration) ConfigOpt {
+	return func(c *Config) {
+		if validator == nil {
+			c.validation = nil
+			return
+		}
+		if timeout <= 0 {
+			timeout = DefaultCredentialsValidationTimeout
+		}
+		if ttl <= 0 {
+			ttl = DefaultCredentialsValidationCacheTTL
+		}
+		c.validation = &validationCache{
+			validator: validator,
+			timeout:   timeout,
+			ttl:       ttl,
+			now:       time.Now,
+			results:   make(map[string]validationResult),
+		}
+	}
+}
+
+// validationErrorMessage returns the error message to respond with if the credentials
+// fail validation, or nil if they are valid or credentials aren't validated.
+func (c *Config) validationErrorMessage(
+	ctx context.Context,
+	taskCredentials credentials.TaskIAMRoleCredentials,
+	errPrefix string,
+) *handlersutils.ErrorMessage {
+	if c == nil || c.validation == nil {
+		return nil
+	}
+	err := c.validation.validate(ctx, taskCredentials.IAMRoleCredentials)
+	if err == nil {
+		return nil
+	}
+	errText := errPrefix + "Credentials failed validation"
+	seelog.Errorf("Error processing credential request credentialType=%s taskARN=%s: %s: %v",
+		taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, errText, err)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrCredentialsValidationFailed,
+		Message:       errText,
+		HTTPErrorCode: http.StatusServiceUnavailable,
+	}
+}
+
+// validate returns the cached result of validating the credentials, or validates them if
+// no result is cached. Results of validations that timed out or that the client went away
+// from aren't cached, as they say nothing about the credentials.
+func (v *validationCache) validate(ctx context.Context, roleCredentials credentials.IAMRoleCredentials) error {
+	key := roleCredentials.AccessKeyID
+	if result, ok := v.cachedResult(key); ok {
+		return result.err
+	}
+	validateCtx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+	err := v.validator.ValidateCredentials(validateCtx, roleCredentials)
+	if validateCtx.Err() != nil {
+		if err == nil {
+			err = validateCtx.Err()
+		}
+		return err
+	}
+	v.cacheResult(key, err)
+	return err
+}
+
+func (v *validationCache) cachedResult(key string) (validationResult, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	result, ok := v.results[key]
+	if !ok || !v.now().Before(result.expiresAt) {
+		return validationResult{}, false
+	}
+	return result, true
+}
+
+func (v *validationCache) cacheResult(key string, err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	now := v.now()
+	if _, ok := v.results[key]; !ok && len(v.results) >= maxCachedValidations {
+		// Expired results are evicted first, and arbitrary results if none have expired
+		for cachedKey, result := range v.results {
+			if !now.Before(result.expiresAt) {
+				delete(v.results, cachedKey)
+			}
+		}
+		for cachedKey := range v.results {
+			if len(v.results) < maxCachedValidations {
+				break
+			}
+			delete(v.results, cachedKey)
+		}
+	}
+	v.results[key] = validationResult{err: err, expiresAt: now.Add(v.ttl)}
+}
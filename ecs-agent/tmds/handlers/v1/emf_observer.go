@@ -0,0 +1,137 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+const (
+	// DefaultEMFNamespace is the CloudWatch namespace that EMF metrics are emitted under
+	// if no namespace is provided.
+	DefaultEMFNamespace = "ECS/TaskMetadata"
+
+	// EMF metric names
+	emfRequestCountMetric   = "CredentialsRequestCount"
+	emfRequestLatencyMetric = "CredentialsRequestLatency"
+	emfRequestErrorsMetric  = "CredentialsRequestErrors"
+
+	// EMF dimension and property names
+	emfAPIVersionDimension = "APIVersion"
+	emfEventTypeProperty   = "EventType"
+	emfStatusCodeProperty  = "StatusCode"
+	emfErrorCodeProperty   = "ErrorCode"
+)
+
+// emfMetadata is the "_aws" member of an EMF log, which tells CloudWatch which members
+// of the log are metrics.
+type emfMetadata struct {
+	Timestamp         int64                 `json:"Timestamp"`
+	CloudWatchMetrics []emfMetricsDirective `json:"CloudWatchMetrics"`
+}
+
+type emfMetricsDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// EMFObserver is a RequestObserver that writes a CloudWatch embedded metric format log
+// line to a writer for every credentials request, with the request count, latency and
+// errors as metrics. CloudWatch extracts the metrics from the logs once they are
+// shipped to CloudWatch Logs, for example with the awslogs log driver.
+type EMFObserver struct {
+	writer    io.Writer
+	namespace string
+	now       func() time.Time
+	enabled   bool
+	lock      sync.Mutex
+}
+
+// NewEMFObserver creates an enabled observer that writes EMF logs to the writer under
+// the namespace, or under DefaultEMFNamespace if the namespace is empty.
+func NewEMFObserver(writer io.Writer, namespace string) *EMFObserver {
+	if namespace == "" {
+		namespace = DefaultEMFNamespace
+	}
+	return &EMFObserver{
+		writer:    writer,
+		namespace: namespace,
+		now:       time.Now,
+		enabled:   true,
+	}
+}
+
+// SetEnabled turns emitting EMF logs on or off.
+func (o *EMFObserver) SetEnabled(enabled bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.enabled = enabled
+}
+
+// ObserveRequest writes the EMF log line for the request. Lines are written whole, so
+// that lines of concurrent requests don't interleave.
+func (o *EMFObserver) ObserveRequest(observation RequestObservation) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if !o.enabled {
+		return
+	}
+
+	errors := 0
+	if observation.StatusCode >= 400 {
+		errors = 1
+	}
+	log := map[string]interface{}{
+		"_aws": emfMetadata{
+			Timestamp: o.now().UnixMilli(),
+			CloudWatchMetrics: []emfMetricsDirective{{
+				Namespace:  o.namespace,
+				Dimensions: [][]string{{emfAPIVersionDimension}},
+				Metrics: []emfMetricDefinition{
+					{Name: emfRequestCountMetric, Unit: "Count"},
+					{Name: emfRequestLatencyMetric, Unit: "Milliseconds"},
+					{Name: emfRequestErrorsMetric, Unit: "Count"},
+				},
+			}},
+		},
+		emfAPIVersionDimension:  observation.APIVersion,
+		emfEventTypeProperty:    observation.EventType,
+		emfStatusCodeProperty:   observation.StatusCode,
+		emfRequestCountMetric:   1,
+		emfRequestLatencyMetric: float64(observation.Latency) / float64(time.Millisecond),
+		emfRequestErrorsMetric:  errors,
+	}
+	if observation.ErrorCode != "" {
+		log[emfErrorCodeProperty] = observation.ErrorCode
+	}
+	line, err := json.Marshal(log)
+	if err != nil {
+		seelog.Warnf("Unable to marshal EMF log for credentials request: %v", err)
+		return
+	}
+	if _, err := o.writer.Write(append(line, '\n')); err != nil {
+		seelog.Warnf("Unable to write EMF log for credentials request: %v", err)
+	}
+}
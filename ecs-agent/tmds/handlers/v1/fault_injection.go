@@ -0,0 +1,116 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ErrInjectedFault is the error code returned when a service unavailable fault
+	// is injected for a credentials request
+	ErrInjectedFault = "InjectedFault"
+
+	// FaultDelay delays the credentials response by the configured duration
+	FaultDelay FaultType = "Delay"
+
+	// FaultServiceUnavailable responds to the credentials request with a 503
+	FaultServiceUnavailable FaultType = "ServiceUnavailable"
+
+	// FaultTruncatedBody responds to the credentials request with a truncated body
+	FaultTruncatedBody FaultType = "TruncatedBody"
+)
+
+// FaultType is the type of fault injected into a credentials response
+type FaultType string
+
+// faultInjectionWarning is logged once, rather than for every config that faults are
+// injected with, as the credentials handlers of all API versions share the options.
+var faultInjectionWarning sync.Once
+
+// Fault describes a fault injected into credentials responses for a credentials ID.
+// Delay is only used by FaultDelay.
+type Fault struct {
+	Type  FaultType
+	Delay time.Duration
+}
+
+// Inject faults into credentials responses for the provided credentials IDs.
+//
+// UNSAFE: This is meant for validating client resilience in test environments only and
+// must never be enabled in production. Fault injection is disabled unless this option
+// is set with a non-empty set of faults.
+func WithUnsafeFaultInjection(faults map[string]Fault) ConfigOpt {
+	return func(c *Config) {
+		if len(faults) == 0 {
+			return
+		}
+		faultInjectionWarning.Do(func() {
+			seelog.Warnf("UNSAFE: credentials fault injection is enabled for %d credentials ID(s). "+
+				"This must never be enabled in production.", len(faults))
+		})
+		c.faults = faults
+	}
+}
+
+// faultFor returns the fault to inject for the credentials ID, if any.
+func (c *Config) faultFor(credentialsID string) (Fault, bool) {
+	if c == nil || len(c.faults) == 0 {
+		return Fault{}, false
+	}
+	fault, ok := c.faults[credentialsID]
+	return fault, ok
+}
+
+// injectFault applies a fault that has to be injected before the credentials request is
+// processed. An error message is returned if the fault replaces the response. Delays end
+// early once the context of the request is done.
+func injectFault(ctx context.Context, fault Fault, credentialsID string, errPrefix string) *handlersutils.ErrorMessage {
+	seelog.Warnf("UNSAFE: injecting fault %s into credentials response for ID sha256:%s", fault.Type,
+		redactCredentialsID(credentialsID))
+	switch fault.Type {
+	case FaultDelay:
+		select {
+		case <-time.After(fault.Delay):
+		case <-ctx.Done():
+		}
+	case FaultServiceUnavailable:
+		return &handlersutils.ErrorMessage{
+			Code:          ErrInjectedFault,
+			Message:       errPrefix + "Injected fault",
+			HTTPErrorCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+// redactCredentialsID returns a prefix of the hash of the credentials ID, which identifies
+// the credentials in logs without revealing the ID that they are requested with.
+func redactCredentialsID(credentialsID string) string {
+	hash := sha256.Sum256([]byte(credentialsID))
+	return hex.EncodeToString(hash[:6])
+}
+
+// truncateBody cuts the response body in half so that it is no longer valid JSON.
+func truncateBody(body []byte) []byte {
+	return body[:len(body)/2]
+}
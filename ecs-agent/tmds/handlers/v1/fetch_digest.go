@@ -0,0 +1,164 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFetchDigestWindow is the window of the credentials fetch digest if no
+	// window is provided.
+	DefaultFetchDigestWindow = time.Hour
+	// DefaultFetchDigestMaxARNs is the number of ARNs that the credentials fetch digest
+	// counts fetches of in a window if no limit is provided.
+	DefaultFetchDigestMaxARNs = 1024
+)
+
+// FetchDigest is a RequestObserver that counts the credentials fetches of each ARN over
+// fixed windows, for auditors that ingest periodic digests of who fetched credentials.
+// Only requests that were served credentials are counted. The windows are aligned to
+// multiples of the window duration, and the counts are reset at the start of each window.
+// Memory is bounded: once fetches of the maximum number of ARNs are counted in a window,
+// fetches of other ARNs are only counted in total.
+type FetchDigest struct {
+	window  time.Duration
+	maxARNs int
+	now     func() time.Time
+
+	lock     sync.Mutex
+	current  fetchDigestWindow
+	previous *fetchDigestWindow
+}
+
+// fetchDigestWindow holds the counts of the window that fetches are counted in.
+type fetchDigestWindow struct {
+	start     time.Time
+	fetches   map[string]uint64
+	total     uint64
+	uncounted uint64
+}
+
+// FetchDigestWindow is the digest of the credentials fetches of a window.
+type FetchDigestWindow struct {
+	// WindowStart is when the window started, inclusive
+	WindowStart time.Time `json:"windowStart"`
+	// WindowEnd is when the window ends, exclusive
+	WindowEnd time.Time `json:"windowEnd"`
+	// Fetches is the number of credentials fetches by ARN
+	Fetches map[string]uint64 `json:"fetches"`
+	// Total is the number of credentials fetches of all ARNs
+	Total uint64 `json:"total"`
+	// UncountedARNFetches is the number of credentials fetches of ARNs that weren't
+	// counted by ARN because the maximum number of ARNs was reached
+	UncountedARNFetches uint64 `json:"uncountedArnFetches"`
+}
+
+// FetchDigestSnapshot is the digest of the credentials fetches of the window in progress
+// and of the last window that ended.
+type FetchDigestSnapshot struct {
+	// Current is the digest of the window in progress, whose counts are still growing
+	Current FetchDigestWindow `json:"current"`
+	// Previous is the digest of the window before the current one, which is final. It's
+	// nil until the first window ends.
+	Previous *FetchDigestWindow `json:"previous,omitempty"`
+}
+
+// NewFetchDigest creates a credentials fetch digest of windows of the duration, which
+// counts fetches of up to maxARNs ARNs per window. The window and the number of ARNs
+// default to DefaultFetchDigestWindow and DefaultFetchDigestMaxARNs if not positive.
+func NewFetchDigest(window time.Duration, maxARNs int) *FetchDigest {
+	if window <= 0 {
+		window = DefaultFetchDigestWindow
+	}
+	if maxARNs <= 0 {
+		maxARNs = DefaultFetchDigestMaxARNs
+	}
+	d := &FetchDigest{
+		window:  window,
+		maxARNs: maxARNs,
+		now:     time.Now,
+	}
+	d.current = d.newWindow(d.now())
+	return d
+}
+
+// ObserveRequest counts the request if it was served credentials.
+func (d *FetchDigest) ObserveRequest(observation RequestObservation) {
+	if observation.StatusCode != http.StatusOK || observation.ErrorCode != "" {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.roll(d.now())
+	d.current.total++
+	if _, ok := d.current.fetches[observation.ARN]; !ok && len(d.current.fetches) >= d.maxARNs {
+		d.current.uncounted++
+		return
+	}
+	d.current.fetches[observation.ARN]++
+}
+
+// Digest returns the digests of the current and of the previous windows.
+func (d *FetchDigest) Digest() FetchDigestSnapshot {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.roll(d.now())
+	snapshot := FetchDigestSnapshot{Current: d.current.digest(d.window)}
+	if d.previous != nil {
+		previous := d.previous.digest(d.window)
+		snapshot.Previous = &previous
+	}
+	return snapshot
+}
+
+// roll starts a new window if the current one has ended by now. The previous window is
+// empty if no fetch was counted in it, because it started after the current window ended.
+func (d *FetchDigest) roll(now time.Time) {
+	end := d.current.start.Add(d.window)
+	if now.Before(end) {
+		return
+	}
+	previous := d.current
+	if !now.Before(end.Add(d.window)) {
+		previous = d.newWindow(now.Add(-d.window))
+	}
+	d.previous = &previous
+	d.current = d.newWindow(now)
+}
+
+// newWindow returns the empty window that the time is in.
+func (d *FetchDigest) newWindow(t time.Time) fetchDigestWindow {
+	return fetchDigestWindow{
+		start:   t.UTC().Truncate(d.window),
+		fetches: make(map[string]uint64),
+	}
+}
+
+// digest returns a copy of the counts of the window.
+func (w fetchDigestWindow) digest(window time.Duration) FetchDigestWindow {
+	digest := FetchDigestWindow{
+		WindowStart:         w.start,
+		WindowEnd:           w.start.Add(window),
+		Fetches:             make(map[string]uint64, len(w.fetches)),
+		Total:               w.total,
+		UncountedARNFetches: w.uncounted,
+	}
+	for arn, count := range w.fetches {
+		digest.Fetches[arn] = count
+	}
+	return digest
+}
@@ -0,0 +1,128 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fetch(arn string) RequestObservation {
+	return RequestObservation{APIVersion: APIVersion, ARN: arn, StatusCode: http.StatusOK}
+}
+
+// newTestFetchDigest returns a digest whose clock is the returned time, which starts
+// 10 minutes into a window.
+func newTestFetchDigest(window time.Duration, maxARNs int) (*FetchDigest, *time.Time) {
+	now := time.Date(2023, 5, 1, 10, 10, 0, 0, time.UTC)
+	d := NewFetchDigest(window, maxARNs)
+	d.now = func() time.Time { return now }
+	d.current = d.newWindow(now)
+	return d, &now
+}
+
+func TestFetchDigestAccumulatesAndResetsAtWindowBoundaries(t *testing.T) {
+	d, now := newTestFetchDigest(time.Hour, 0)
+	windowStart := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	digest := d.Digest()
+	assert.Equal(t, windowStart, digest.Current.WindowStart)
+	assert.Equal(t, windowStart.Add(time.Hour), digest.Current.WindowEnd)
+	assert.Empty(t, digest.Current.Fetches)
+	assert.Nil(t, digest.Previous)
+
+	d.ObserveRequest(fetch("task1"))
+	d.ObserveRequest(fetch("task1"))
+	d.ObserveRequest(fetch("task2"))
+	// Requests that weren't served credentials aren't fetches
+	d.ObserveRequest(RequestObservation{ARN: "task1", StatusCode: http.StatusBadRequest, ErrorCode: ErrInvalidIDInRequest})
+	d.ObserveRequest(RequestObservation{ARN: "task1", StatusCode: http.StatusOK, ErrorCode: "SomeError"})
+
+	*now = windowStart.Add(time.Hour - time.Nanosecond)
+	d.ObserveRequest(fetch("task1"))
+	digest = d.Digest()
+	assert.Equal(t, map[string]uint64{"task1": 3, "task2": 1}, digest.Current.Fetches)
+	assert.Equal(t, uint64(4), digest.Current.Total)
+	assert.Nil(t, digest.Previous)
+
+	// The window ends, the counts are reset and the digest of the window that ended is kept
+	*now = windowStart.Add(time.Hour)
+	d.ObserveRequest(fetch("task2"))
+	digest = d.Digest()
+	assert.Equal(t, windowStart.Add(time.Hour), digest.Current.WindowStart)
+	assert.Equal(t, windowStart.Add(2*time.Hour), digest.Current.WindowEnd)
+	assert.Equal(t, map[string]uint64{"task2": 1}, digest.Current.Fetches)
+	assert.Equal(t, uint64(1), digest.Current.Total)
+	require.NotNil(t, digest.Previous)
+	assert.Equal(t, windowStart, digest.Previous.WindowStart)
+	assert.Equal(t, windowStart.Add(time.Hour), digest.Previous.WindowEnd)
+	assert.Equal(t, map[string]uint64{"task1": 3, "task2": 1}, digest.Previous.Fetches)
+	assert.Equal(t, uint64(4), digest.Previous.Total)
+
+	// Windows roll over when the digest is read even if nothing was fetched
+	*now = windowStart.Add(2*time.Hour + time.Minute)
+	digest = d.Digest()
+	assert.Empty(t, digest.Current.Fetches)
+	require.NotNil(t, digest.Previous)
+	assert.Equal(t, windowStart.Add(time.Hour), digest.Previous.WindowStart)
+	assert.Equal(t, map[string]uint64{"task2": 1}, digest.Previous.Fetches)
+
+	// The previous window is empty if whole windows pass without fetches
+	*now = windowStart.Add(5*time.Hour + time.Minute)
+	digest = d.Digest()
+	assert.Equal(t, windowStart.Add(5*time.Hour), digest.Current.WindowStart)
+	require.NotNil(t, digest.Previous)
+	assert.Equal(t, windowStart.Add(4*time.Hour), digest.Previous.WindowStart)
+	assert.Equal(t, windowStart.Add(5*time.Hour), digest.Previous.WindowEnd)
+	assert.Empty(t, digest.Previous.Fetches)
+	assert.Zero(t, digest.Previous.Total)
+}
+
+func TestFetchDigestIsBounded(t *testing.T) {
+	d, now := newTestFetchDigest(time.Minute, 3)
+	for i := 0; i < 10; i++ {
+		d.ObserveRequest(fetch(fmt.Sprintf("task%d", i)))
+	}
+	// ARNs that are already counted are still counted once the limit is reached
+	d.ObserveRequest(fetch("task0"))
+
+	digest := d.Digest()
+	assert.Equal(t, map[string]uint64{"task0": 2, "task1": 1, "task2": 1}, digest.Current.Fetches)
+	assert.Equal(t, uint64(11), digest.Current.Total)
+	assert.Equal(t, uint64(7), digest.Current.UncountedARNFetches)
+
+	// The limit applies per window
+	*now = now.Add(time.Minute)
+	d.ObserveRequest(fetch("task9"))
+	digest = d.Digest()
+	assert.Equal(t, map[string]uint64{"task9": 1}, digest.Current.Fetches)
+	assert.Zero(t, digest.Current.UncountedARNFetches)
+	assert.Equal(t, uint64(7), digest.Previous.UncountedARNFetches)
+}
+
+func TestFetchDigestSnapshotIsACopy(t *testing.T) {
+	d, _ := newTestFetchDigest(time.Hour, 0)
+	d.ObserveRequest(fetch("task1"))
+	digest := d.Digest()
+	digest.Current.Fetches["task1"] = 100
+	assert.Equal(t, uint64(1), d.Digest().Current.Fetches["task1"])
+}
@@ -0,0 +1,98 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ErrInvalidFieldSelection is the error code indicating that the fields query
+	// parameter selects fields that can't be selected
+	ErrInvalidFieldSelection = "InvalidFieldSelection"
+
+	// FieldsQueryParameterName is the name of the optional query parameter selecting the
+	// fields of the credentials response to return, as a comma separated list, such as
+	// fields=AccessKeyId,Expiration
+	FieldsQueryParameterName = "fields"
+)
+
+// selectableFields are the fields of the credentials response that can be selected with
+// the fields query parameter. The secret access key and the session token can't be
+// selected, so that clients that only need to log which credentials they hold don't
+// handle secrets.
+var selectableFields = map[string]bool{
+	"RoleArn":      true,
+	"AccessKeyId":  true,
+	"Expiration":   true,
+	"Revision":     true,
+	"RefreshAfter": true,
+}
+
+// selectedFields returns the fields of the credentials response selected with the fields
+// query parameter, or nil if the parameter isn't set. It returns an error message if the
+// selection is empty or has fields that can't be selected.
+func selectedFields(r *http.Request, errPrefix string) ([]string, *handlersutils.ErrorMessage) {
+	value, ok := handlersutils.ValueFromRequest(r, FieldsQueryParameterName)
+	if !ok {
+		return nil, nil
+	}
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !selectableFields[field] {
+			errText := errPrefix + "Field can't be selected: " + field
+			seelog.Errorf("Error processing credential request: %s", errText)
+			return nil, &handlersutils.ErrorMessage{
+				Code:          ErrInvalidFieldSelection,
+				Message:       errText,
+				HTTPErrorCode: http.StatusBadRequest,
+			}
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		errText := errPrefix + "No fields selected"
+		seelog.Errorf("Error processing credential request: %s", errText)
+		return nil, &handlersutils.ErrorMessage{
+			Code:          ErrInvalidFieldSelection,
+			Message:       errText,
+			HTTPErrorCode: http.StatusBadRequest,
+		}
+	}
+	return fields, nil
+}
+
+// selectFields returns the credentials response with only the selected fields.
+func selectFields(responseJSON []byte, fields []string) ([]byte, error) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(responseJSON, &response); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := response[field]; ok {
+			selected[field] = value
+		}
+	}
+	return json.Marshal(selected)
+}
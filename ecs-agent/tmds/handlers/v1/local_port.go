@@ -0,0 +1,86 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+// ErrUnexpectedLocalPort is the error code indicating that the request was received on
+// another local port than the one credentials are served on
+const ErrUnexpectedLocalPort = "UnexpectedLocalPort"
+
+// Serve credentials only to requests received on the given local port. This limits the
+// blast radius of the handler being mounted on another listener by mistake, such as a
+// public one. Requests whose local port isn't known, because the server doesn't record
+// the local address of connections, are rejected too. Ports aren't checked if the port is
+// 0, which is the default.
+func WithExpectedLocalPort(port uint16) ConfigOpt {
+	return func(c *Config) {
+		c.expectedLocalPort = port
+	}
+}
+
+// localPortErrorMessage returns the error message to respond with if the expected local
+// port is set and the request wasn't received on it, or nil otherwise.
+func (c *Config) localPortErrorMessage(
+	r *http.Request,
+	credentialsID string,
+	errPrefix string,
+) *handlersutils.ErrorMessage {
+	if c == nil || c.expectedLocalPort == 0 {
+		return nil
+	}
+	port, ok := localPort(r)
+	if ok && port == c.expectedLocalPort {
+		return nil
+	}
+	localAddr := "unknown"
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		localAddr = addr.String()
+	}
+	seelog.Errorf("Rejected credentials request from %s for credentials ID %s received on local address %s: "+
+		"credentials are only served on local port %d", r.RemoteAddr, credentialsID, localAddr,
+		c.expectedLocalPort)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrUnexpectedLocalPort,
+		Message:       errPrefix + "Request was received on an unexpected port",
+		HTTPErrorCode: http.StatusForbidden,
+	}
+}
+
+// localPort returns the local port of the connection that the request was received on.
+func localPort(r *http.Request) (uint16, bool) {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return 0, false
+	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return uint16(tcpAddr.Port), true
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0, false
+	}
+	parsed, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(parsed), true
+}
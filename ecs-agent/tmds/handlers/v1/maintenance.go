@@ -0,0 +1,91 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+	"sync"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+// ErrServiceMaintenance is the error code indicating that serving credentials has been
+// paused by an operator
+const ErrServiceMaintenance = "ServiceMaintenance"
+
+// MaintenanceToggle is an administrative switch for pausing credential serving without
+// restarting the agent, e.g. during a security incident. While paused, credentials
+// handlers configured with the toggle respond to all requests with a 503.
+type MaintenanceToggle struct {
+	paused bool
+	lock   sync.RWMutex
+}
+
+// NewMaintenanceToggle creates a toggle that is not paused.
+func NewMaintenanceToggle() *MaintenanceToggle {
+	return &MaintenanceToggle{}
+}
+
+// Pause stops credential serving until Resume is called.
+func (m *MaintenanceToggle) Pause() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.paused {
+		seelog.Warn("Credential serving paused for maintenance")
+	}
+	m.paused = true
+}
+
+// Resume resumes credential serving.
+func (m *MaintenanceToggle) Resume() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.paused {
+		seelog.Info("Credential serving resumed after maintenance")
+	}
+	m.paused = false
+}
+
+// Paused returns whether credential serving is paused.
+func (m *MaintenanceToggle) Paused() bool {
+	if m == nil {
+		return false
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.paused
+}
+
+// Set a maintenance toggle that can be used to pause credential serving.
+func WithMaintenanceToggle(toggle *MaintenanceToggle) ConfigOpt {
+	return func(c *Config) {
+		c.maintenance = toggle
+	}
+}
+
+// maintenanceErrorMessage returns the error message to respond with if credential serving
+// is paused, or nil otherwise.
+func (c *Config) maintenanceErrorMessage(credentialsID string, errPrefix string) *handlersutils.ErrorMessage {
+	if c == nil || !c.maintenance.Paused() {
+		return nil
+	}
+	errText := errPrefix + "Credential serving is paused for maintenance"
+	seelog.Warnf("Denied credentials request for ID %s: %s", credentialsID, errText)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrServiceMaintenance,
+		Message:       errText,
+		HTTPErrorCode: http.StatusServiceUnavailable,
+	}
+}
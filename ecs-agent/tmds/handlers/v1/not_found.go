@@ -0,0 +1,42 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+)
+
+// Advise clients to back off for the given duration before retrying requests for
+// credentials IDs that aren't found, which happens when a task polls for its credentials
+// before they have been delivered to the agent. The duration is sent in the Retry-After
+// header of the 400 response, rounded up to whole seconds. The header is omitted if the
+// duration isn't positive, which is the default.
+func WithNotFoundRetryAfter(retryAfter time.Duration) ConfigOpt {
+	return func(c *Config) {
+		c.notFoundRetryAfter = retryAfter
+	}
+}
+
+// setNotFoundRetryAfter sets the Retry-After header of the response if the error message
+// is for credentials that weren't found and a backoff is configured for them.
+func (c *Config) setNotFoundRetryAfter(w http.ResponseWriter, errorMessage *handlersutils.ErrorMessage) {
+	if c == nil || c.notFoundRetryAfter <= 0 || errorMessage.Code != ErrInvalidIDInRequest {
+		return
+	}
+	setRetryAfter(w, int(math.Ceil(c.notFoundRetryAfter.Seconds())))
+}
@@ -0,0 +1,76 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/cihub/seelog"
+)
+
+// ErrPartitionMismatch is the error code indicating that the credentials don't belong to
+// the AWS partition of the task that they were issued for
+const ErrPartitionMismatch = "PartitionMismatch"
+
+// Serve credentials only if their role belongs to the AWS partition of their task, such as
+// aws-us-gov or aws-cn, as given by the partition segment of the task ARN. This guards
+// GovCloud and China deployments against being served credentials of another partition.
+// Partitions aren't checked if not set.
+func WithPartitionCheck(enabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.partitionCheck = enabled
+	}
+}
+
+// partitionErrorMessage returns the error message to respond with if the partition check
+// is enabled and the role ARN of the credentials isn't in the partition of the task ARN,
+// or nil otherwise. ARNs that can't be parsed don't match any partition.
+func (c *Config) partitionErrorMessage(
+	taskCredentials credentials.TaskIAMRoleCredentials,
+	errPrefix string,
+) *handlersutils.ErrorMessage {
+	if c == nil || !c.partitionCheck {
+		return nil
+	}
+	expected, err := partitionOf(taskCredentials.ARN)
+	if err == nil {
+		var actual string
+		if actual, err = partitionOf(taskCredentials.IAMRoleCredentials.RoleArn); err == nil {
+			if actual == expected {
+				return nil
+			}
+			err = fmt.Errorf("role is in partition %s, task is in partition %s", actual, expected)
+		}
+	}
+	errText := errPrefix + "Credentials don't belong to the partition of the task"
+	seelog.Errorf("Denied credentials request credentialType=%s taskARN=%s: %s: %v",
+		taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, errText, err)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrPartitionMismatch,
+		Message:       errText,
+		HTTPErrorCode: http.StatusInternalServerError,
+	}
+}
+
+func partitionOf(resourceARN string) (string, error) {
+	parsed, err := arn.Parse(resourceARN)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Partition, nil
+}
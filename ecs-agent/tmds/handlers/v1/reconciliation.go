@@ -0,0 +1,102 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+// ErrStateReconciling is the error code indicating that the agent has not completed
+// reconciling its state after starting, and credentials can't be served yet
+const ErrStateReconciling = "StateReconciling"
+
+// ReconciliationGate holds back credential serving until the agent has completed
+// reconciling its state after starting. Until then, credentials handlers configured
+// with the gate respond to all requests with a 503 and the same Retry-After, instead
+// of a mix of not found and uninitialized errors for credentials that are yet to be
+// restored.
+type ReconciliationGate struct {
+	reconciled bool
+	retryAfter int
+	lock       sync.RWMutex
+}
+
+// NewReconciliationGate creates a gate that is closed until MarkReconciled is called.
+// Requests denied by the gate are told to retry after retryAfter, rounded up to whole
+// seconds.
+func NewReconciliationGate(retryAfter time.Duration) *ReconciliationGate {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &ReconciliationGate{retryAfter: seconds}
+}
+
+// MarkReconciled opens the gate. It is called once the agent has completed reconciling
+// its state.
+func (g *ReconciliationGate) MarkReconciled() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if !g.reconciled {
+		seelog.Info("State reconciliation complete, serving credentials")
+	}
+	g.reconciled = true
+}
+
+// Reconciled returns whether the agent has completed reconciling its state. A nil gate
+// is always reconciled.
+func (g *ReconciliationGate) Reconciled() bool {
+	if g == nil {
+		return true
+	}
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.reconciled
+}
+
+// Set a reconciliation gate that holds back credential serving until the agent has
+// completed reconciling its state.
+func WithReconciliationGate(gate *ReconciliationGate) ConfigOpt {
+	return func(c *Config) {
+		c.reconciliation = gate
+	}
+}
+
+// ReconciliationErrorMessage returns the error message to respond with if the agent has
+// not completed reconciling its state, or nil otherwise. The Retry-After header of the
+// response is set along with it. This is exported for handlers that serve credentials
+// as part of a larger response.
+func (c *Config) ReconciliationErrorMessage(
+	w http.ResponseWriter,
+	credentialsID string,
+	errPrefix string,
+) *handlersutils.ErrorMessage {
+	if c == nil || c.reconciliation.Reconciled() {
+		return nil
+	}
+	errText := errPrefix + "Agent is reconciling its state, credentials are not available yet"
+	seelog.Warnf("Denied credentials request for ID %s: %s", credentialsID, errText)
+	setRetryAfter(w, c.reconciliation.retryAfter)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrStateReconciling,
+		Message:       errText,
+		HTTPErrorCode: http.StatusServiceUnavailable,
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"time"
+)
+
+// DefaultRefreshAfterMargin is how long before credentials expire clients are advised to
+// refresh them, unless another margin is set with WithRefreshAfterMargin.
+const DefaultRefreshAfterMargin = 5 * time.Minute
+
+// Advise clients to refresh credentials the given margin before they expire, with the
+// RefreshAfter field of credentials responses. Clients that refresh at that time, instead
+// of picking a margin of their own, all refresh consistently ahead of the rotation of
+// their credentials. The field is omitted if the margin is negative, and for credentials
+// whose expiration isn't known. DefaultRefreshAfterMargin is used if not set.
+func WithRefreshAfterMargin(margin time.Duration) ConfigOpt {
+	return func(c *Config) {
+		c.refreshAfterMargin = margin
+	}
+}
+
+// refreshAfter returns the margin that the RefreshAfter field of responses is computed with.
+func (c *Config) refreshAfter() time.Duration {
+	if c == nil {
+		return DefaultRefreshAfterMargin
+	}
+	return c.refreshAfterMargin
+}
+
+// refreshAfterTime returns the RefreshAfter field of the response for credentials with the
+// given expiration, which is the expiration minus the margin. It returns an empty string if
+// the margin is negative or the expiration can't be parsed.
+func refreshAfterTime(expiration string, margin time.Duration) string {
+	if margin < 0 {
+		return ""
+	}
+	expiresAt, err := time.Parse(time.RFC3339, expiration)
+	if err != nil {
+		return ""
+	}
+	return expiresAt.Add(-margin).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,243 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/cihub/seelog"
+)
+
+// DefaultRefreshInterval is how often the refresh scheduler checks the cached responses,
+// unless the pre-expiry margin is shorter than twice the interval.
+const DefaultRefreshInterval = 30 * time.Second
+
+// RefreshScheduler is a ResponseCache that keeps the cached responses of credentials warm
+// in the background, so that requests aren't served from a cold cache after credentials
+// are replaced. Responses are cached in the wrapped cache, and the scheduler checks the
+// credentials of every cached response periodically:
+//   - Responses of credentials whose version changed since they were cached, because the
+//     credentials were replaced, are marshaled again and cached with the new version.
+//   - Credentials that expire within the pre-expiry margin without being replaced are
+//     warned about once per version, since credentials are replaced ahead of their
+//     expiration by the credentials refresh of ACS, not by the scheduler.
+//   - Responses of credentials that the manager no longer has are invalidated and no
+//     longer checked. Responses of credentials that are removed from managers that are
+//     credentials.RemovalNotifiers, such as the credentials of tasks that are removed, are
+//     invalidated as soon as the credentials are removed.
+//
+// The scheduler runs from Start until its context is done or Stop is called.
+type RefreshScheduler struct {
+	cache              ResponseCache
+	credentialsManager credentials.Manager
+	margin             time.Duration
+	interval           time.Duration
+	now                func() time.Time
+
+	lock sync.Mutex
+	// refreshAfterMargin is the margin that the RefreshAfter field of refreshed responses is
+	// computed with, which is the one of the credentials handlers using the scheduler
+	refreshAfterMargin time.Duration
+	// tracked holds the ids of the cached responses, along with the version of the
+	// credentials that was last warned about expiring without being replaced
+	tracked map[string]string
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewRefreshScheduler creates a refresh scheduler that caches responses in the cache and
+// refreshes them once their credentials expire within the margin.
+func NewRefreshScheduler(cache ResponseCache, credentialsManager credentials.Manager,
+	margin time.Duration) *RefreshScheduler {
+	interval := DefaultRefreshInterval
+	if margin > 0 && margin < 2*interval {
+		interval = margin / 2
+	}
+	s := &RefreshScheduler{
+		cache:              cache,
+		credentialsManager: credentialsManager,
+		margin:             margin,
+		interval:           interval,
+		now:                time.Now,
+		refreshAfterMargin: DefaultRefreshAfterMargin,
+		tracked:            make(map[string]string),
+		stop:               make(chan struct{}),
+		done:               make(chan struct{}),
+	}
+	if notifier, ok := credentialsManager.(credentials.RemovalNotifier); ok {
+		notifier.NotifyOnRemoval(s.Invalidate)
+	}
+	return s
+}
+
+// Get returns the cached response for the credentials ID.
+func (s *RefreshScheduler) Get(credentialsID string) ([]byte, string, bool) {
+	return s.cache.Get(credentialsID)
+}
+
+// Set caches the response for the credentials ID, which is then kept warm.
+func (s *RefreshScheduler) Set(credentialsID string, version string, response []byte) {
+	s.cache.Set(credentialsID, version, response)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.tracked[credentialsID]; !ok {
+		s.tracked[credentialsID] = ""
+	}
+}
+
+// Invalidate removes the cached response for the credentials ID, which is no longer kept
+// warm.
+func (s *RefreshScheduler) Invalidate(credentialsID string) {
+	s.cache.Invalidate(credentialsID)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.tracked, credentialsID)
+}
+
+// Start refreshes the cached responses in the background until the context is done or
+// Stop is called. Only the first call starts the scheduler.
+func (s *RefreshScheduler) Start(ctx context.Context) {
+	s.startOnce.Do(func() {
+		go s.run(ctx)
+	})
+}
+
+// Stop stops the scheduler and waits for it to stop refreshing responses.
+func (s *RefreshScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	// The scheduler is started here if it wasn't, so that done is closed
+	s.Start(context.Background())
+	<-s.done
+}
+
+func (s *RefreshScheduler) run(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.refresh()
+		}
+	}
+}
+
+// refresh checks the credentials of every cached response.
+func (s *RefreshScheduler) refresh() {
+	s.lock.Lock()
+	ids := make([]string, 0, len(s.tracked))
+	for id := range s.tracked {
+		ids = append(ids, id)
+	}
+	s.lock.Unlock()
+	for _, id := range ids {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		s.refreshResponse(id)
+	}
+}
+
+// refreshResponse refreshes the cached response for the credentials ID if it is about to
+// expire or if its credentials were replaced.
+func (s *RefreshScheduler) refreshResponse(credentialsID string) {
+	taskCredentials, ok := s.credentialsManager.GetTaskCredentials(credentialsID)
+	if !ok {
+		s.Invalidate(credentialsID)
+		return
+	}
+	version, ok := responseVersion(taskCredentials)
+	if !ok {
+		s.Invalidate(credentialsID)
+		return
+	}
+	_, cachedVersion, ok := s.cache.Get(credentialsID)
+	if !ok {
+		// The response was evicted from the cache, there is nothing to keep warm
+		s.untrack(credentialsID)
+		return
+	}
+	if cachedVersion == version {
+		if s.expiresWithinMargin(taskCredentials) && s.markWarned(credentialsID, version) {
+			seelog.Warnf("Credentials expire within %v and weren't replaced yet credentialType=%s taskARN=%s "+
+				"expiration=%s", s.margin, taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN,
+				taskCredentials.IAMRoleCredentials.Expiration)
+		}
+		return
+	}
+	s.lock.Lock()
+	refreshAfterMargin := s.refreshAfterMargin
+	s.lock.Unlock()
+	response, err := marshalCredentialsResponse(taskCredentials, refreshAfterMargin)
+	if err != nil {
+		seelog.Warnf("Error marshaling refreshed credentials credentialType=%s taskARN=%s: %v",
+			taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, err)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// The response isn't cached again if it was invalidated while it was marshaled
+	if _, ok := s.tracked[credentialsID]; ok {
+		s.cache.Set(credentialsID, version, response)
+	}
+}
+
+// expiresWithinMargin returns whether the credentials expire within the pre-expiry margin.
+// Credentials whose expiration can't be parsed never do.
+func (s *RefreshScheduler) expiresWithinMargin(taskCredentials credentials.TaskIAMRoleCredentials) bool {
+	expiration, err := time.Parse(time.RFC3339, taskCredentials.IAMRoleCredentials.Expiration)
+	if err != nil {
+		return false
+	}
+	return expiration.Sub(s.now()) <= s.margin
+}
+
+// markWarned records that the version of the credentials is warned about expiring without
+// being replaced. It returns false if it already was.
+func (s *RefreshScheduler) markWarned(credentialsID string, version string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	warned, ok := s.tracked[credentialsID]
+	if !ok || warned == version {
+		return false
+	}
+	s.tracked[credentialsID] = version
+	return true
+}
+
+func (s *RefreshScheduler) setRefreshAfterMargin(margin time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refreshAfterMargin = margin
+}
+
+func (s *RefreshScheduler) untrack(credentialsID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.tracked, credentialsID)
+}
@@ -0,0 +1,198 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const refreshTestCredentialsID = "credsid"
+
+// setRefreshTestCredentials sets credentials that expire at the expiration.
+func setRefreshTestCredentials(t *testing.T, manager credentials.Manager, expiration time.Time) {
+	require.NoError(t, manager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: "taskarn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID:   refreshTestCredentialsID,
+			AccessKeyID:     "akid-" + expiration.Format(time.RFC3339),
+			SecretAccessKey: "secret",
+			Expiration:      expiration.Format(time.RFC3339),
+		},
+	}))
+}
+
+// newTestRefreshScheduler returns a scheduler with a margin of 5 minutes, whose clock is
+// the returned time, and whose cache has the response of credentials that expire in 10
+// minutes.
+func newTestRefreshScheduler(t *testing.T) (*RefreshScheduler, credentials.Manager, *time.Time) {
+	return newTestRefreshSchedulerWithManager(t, credentials.NewManager())
+}
+
+func newTestRefreshSchedulerWithManager(t *testing.T,
+	manager credentials.Manager) (*RefreshScheduler, credentials.Manager, *time.Time) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	setRefreshTestCredentials(t, manager, now.Add(10*time.Minute))
+	s := NewRefreshScheduler(NewMemoryResponseCache(DefaultResponseCacheSize), manager, 5*time.Minute)
+	s.now = func() time.Time { return now }
+	cacheTestResponse(t, s, manager)
+	return s, manager, &now
+}
+
+// cacheTestResponse caches the response of the current credentials, like the handlers do.
+func cacheTestResponse(t *testing.T, s *RefreshScheduler, manager credentials.Manager) {
+	taskCredentials, ok := manager.GetTaskCredentials(refreshTestCredentialsID)
+	require.True(t, ok)
+	response, err := marshalCredentialsResponse(taskCredentials, DefaultRefreshAfterMargin)
+	require.NoError(t, err)
+	cacheResponse(s, refreshTestCredentialsID, taskCredentials, response)
+}
+
+func cachedTestExpiration(t *testing.T, s *RefreshScheduler) string {
+	response, _, ok := s.Get(refreshTestCredentialsID)
+	require.True(t, ok)
+	var cached credentialsResponse
+	require.NoError(t, json.Unmarshal(response, &cached))
+	return cached.Expiration
+}
+
+func TestRefreshSchedulerRecachesReplacedCredentials(t *testing.T) {
+	s, manager, now := newTestRefreshScheduler(t)
+
+	// Responses of credentials that weren't replaced are left as they are
+	s.refresh()
+	assert.Equal(t, "2023-05-01T10:10:00Z", cachedTestExpiration(t, s))
+
+	// The response of replaced credentials is cached so that it is served to the next request
+	setRefreshTestCredentials(t, manager, now.Add(time.Hour))
+	s.refresh()
+	assert.Equal(t, "2023-05-01T11:00:00Z", cachedTestExpiration(t, s))
+	taskCredentials, _ := manager.GetTaskCredentials(refreshTestCredentialsID)
+	response, ok := cachedResponse(s, refreshTestCredentialsID, taskCredentials)
+	assert.True(t, ok)
+	assert.NotEmpty(t, response)
+}
+
+func TestRefreshSchedulerWarnsWithinMargin(t *testing.T) {
+	s, manager, now := newTestRefreshScheduler(t)
+	taskCredentials, _ := manager.GetTaskCredentials(refreshTestCredentialsID)
+	version, ok := responseVersion(taskCredentials)
+	require.True(t, ok)
+
+	// Credentials that expire after the margin aren't warned about
+	*now = now.Add(5*time.Minute - time.Second)
+	s.refresh()
+	assert.Empty(t, s.tracked[refreshTestCredentialsID])
+
+	// Credentials that expire within the margin without being replaced are warned about,
+	// once per version
+	*now = now.Add(time.Second)
+	s.refresh()
+	assert.Equal(t, version, s.tracked[refreshTestCredentialsID])
+	assert.False(t, s.markWarned(refreshTestCredentialsID, version))
+	assert.Equal(t, "2023-05-01T10:10:00Z", cachedTestExpiration(t, s))
+}
+
+// Tests that refreshed responses advise clients to refresh with the margin of the
+// credentials handlers that the scheduler is the cache of.
+func TestRefreshSchedulerRefreshAfterMargin(t *testing.T) {
+	s, manager, now := newTestRefreshScheduler(t)
+	NewConfig(WithResponseCache(s), WithRefreshAfterMargin(time.Minute))
+
+	setRefreshTestCredentials(t, manager, now.Add(70*time.Minute))
+	s.refresh()
+	response, _, ok := s.Get(refreshTestCredentialsID)
+	require.True(t, ok)
+	var cached credentialsResponse
+	require.NoError(t, json.Unmarshal(response, &cached))
+	assert.Equal(t, "2023-05-01T11:10:00Z", cached.Expiration)
+	assert.Equal(t, "2023-05-01T11:09:00Z", cached.RefreshAfter)
+}
+
+// Tests that the responses of removed credentials are invalidated as soon as the
+// credentials are removed, without waiting for the next refresh.
+func TestRefreshSchedulerInvalidatesRemovedCredentials(t *testing.T) {
+	s, manager, _ := newTestRefreshScheduler(t)
+
+	manager.RemoveCredentials(refreshTestCredentialsID)
+	_, _, ok := s.Get(refreshTestCredentialsID)
+	assert.False(t, ok)
+	assert.Empty(t, s.tracked)
+}
+
+// nonNotifyingManager is a credentials manager that doesn't notify of removals.
+type nonNotifyingManager struct {
+	credentials.Manager
+}
+
+func TestRefreshSchedulerUntracksRemovedCredentials(t *testing.T) {
+	s, manager, _ := newTestRefreshSchedulerWithManager(t, nonNotifyingManager{credentials.NewManager()})
+
+	// Without removal notifications, responses are invalidated on the next refresh
+	manager.RemoveCredentials(refreshTestCredentialsID)
+	assert.Len(t, s.tracked, 1)
+	s.refresh()
+	_, _, ok := s.Get(refreshTestCredentialsID)
+	assert.False(t, ok)
+	assert.Empty(t, s.tracked)
+}
+
+func TestRefreshSchedulerUntracksInvalidatedResponses(t *testing.T) {
+	s, manager, _ := newTestRefreshScheduler(t)
+
+	invalidateResponse(s, refreshTestCredentialsID)
+	assert.Empty(t, s.tracked)
+	setRefreshTestCredentials(t, manager, time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC))
+	s.refresh()
+	_, _, ok := s.Get(refreshTestCredentialsID)
+	assert.False(t, ok)
+}
+
+func TestRefreshSchedulerStop(t *testing.T) {
+	s, _, _ := newTestRefreshScheduler(t)
+	s.Start(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop didn't return")
+	}
+
+	// Schedulers that weren't started can be stopped, and stop when their context is done
+	s, _, _ = newTestRefreshScheduler(t)
+	s.Stop()
+	s, _, _ = newTestRefreshScheduler(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	cancel()
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scheduler didn't stop when its context was done")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"time"
+)
+
+// RequestObservation describes a credentials request that has been responded to.
+type RequestObservation struct {
+	// APIVersion is the API version that the request is audit logged with
+	APIVersion string
+	// EventType is the audit event type of the request
+	EventType string
+	// ARN is the ARN that the request is audit logged with, which is the ARN of the task
+	// whose credentials were served, empty if it isn't known
+	ARN string
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// ErrorCode is the error code of the response, empty if credentials were served
+	ErrorCode string
+	// Latency is the time taken to respond to the request
+	Latency time.Duration
+}
+
+// RequestObserver is notified of every credentials request once it has been responded
+// to. Observers are called on the request path, so they must not block.
+type RequestObserver interface {
+	ObserveRequest(observation RequestObservation)
+}
+
+// Add an observer to be notified of every credentials request. This option can be
+// provided more than once to add several observers.
+func WithRequestObserver(observer RequestObserver) ConfigOpt {
+	return func(c *Config) {
+		if observer != nil {
+			c.observers = append(c.observers, observer)
+		}
+	}
+}
+
+func (c *Config) observeRequest(observation RequestObservation) {
+	if c == nil {
+		return
+	}
+	for _, observer := range c.observers {
+		observer.ObserveRequest(observation)
+	}
+}
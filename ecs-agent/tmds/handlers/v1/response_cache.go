@@ -0,0 +1,166 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+)
+
+// DefaultResponseCacheSize is the number of credentials responses that the in-memory
+// response cache holds
+const DefaultResponseCacheSize = 1024
+
+// ResponseCache caches the marshaled credentials responses of the credentials handlers,
+// so that credentials that didn't change aren't marshaled again for every request.
+// Responses are cached with a version of the credentials that they were created from, and
+// a cached response is only served while the credentials manager has credentials of the
+// same version. Versions combine the revision of the credentials with their access key ID
+// and expiration, as revisions start over when the agent restarts. Implementations backed
+// by an external store, such as a local Redis shared by several agents, keep the cache
+// warm across agent restarts. Implementations must be safe for concurrent use.
+type ResponseCache interface {
+	// Get returns the cached response for the credentials ID and the version of the
+	// credentials it was created from. ok is false if no response is cached.
+	Get(credentialsID string) (response []byte, version string, ok bool)
+	// Set caches the response for the credentials ID, replacing any cached response.
+	Set(credentialsID string, version string, response []byte)
+	// Invalidate removes the cached response for the credentials ID, if any.
+	Invalidate(credentialsID string)
+}
+
+// Cache the marshaled credentials responses in the given cache instead of the in-memory
+// cache that the credentials handlers default to. Responses aren't cached if the cache
+// is nil.
+func WithResponseCache(cache ResponseCache) ConfigOpt {
+	return func(c *Config) {
+		c.responseCache = cache
+	}
+}
+
+// cache returns the response cache of the config, or nil if responses aren't cached.
+func (c *Config) cache() ResponseCache {
+	if c == nil {
+		return nil
+	}
+	return c.responseCache
+}
+
+type memoryResponseCacheEntry struct {
+	version  string
+	response []byte
+}
+
+// MemoryResponseCache is a ResponseCache that holds responses in memory, up to a maximum
+// number of responses. It is the response cache of the credentials handlers by default.
+type MemoryResponseCache struct {
+	maxEntries int
+	entries    map[string]memoryResponseCacheEntry
+	lock       sync.RWMutex
+}
+
+// NewMemoryResponseCache creates an in-memory response cache holding up to maxEntries
+// responses. Once it is full, an arbitrary response is evicted for every response that
+// is cached.
+func NewMemoryResponseCache(maxEntries int) *MemoryResponseCache {
+	return &MemoryResponseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]memoryResponseCacheEntry),
+	}
+}
+
+// Get returns the cached response for the credentials ID.
+func (m *MemoryResponseCache) Get(credentialsID string) ([]byte, string, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	entry, ok := m.entries[credentialsID]
+	return entry.response, entry.version, ok
+}
+
+// Set caches the response for the credentials ID.
+func (m *MemoryResponseCache) Set(credentialsID string, version string, response []byte) {
+	if m.maxEntries <= 0 {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.entries[credentialsID]; !ok {
+		for id := range m.entries {
+			if len(m.entries) < m.maxEntries {
+				break
+			}
+			delete(m.entries, id)
+		}
+	}
+	m.entries[credentialsID] = memoryResponseCacheEntry{version: version, response: response}
+}
+
+// Invalidate removes the cached response for the credentials ID.
+func (m *MemoryResponseCache) Invalidate(credentialsID string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.entries, credentialsID)
+}
+
+// responseVersion returns the version of the credentials that responses are cached with.
+// Credentials without a revision have no version and aren't cached, as the rotation of
+// their credentials can't be detected.
+func responseVersion(taskCredentials credentials.TaskIAMRoleCredentials) (string, bool) {
+	if taskCredentials.Revision == 0 {
+		return "", false
+	}
+	return strconv.FormatUint(taskCredentials.Revision, 10) + "/" +
+		taskCredentials.IAMRoleCredentials.AccessKeyID + "/" +
+		taskCredentials.IAMRoleCredentials.Expiration, true
+}
+
+// cachedResponse returns the cached response for the credentials, if the cache has a
+// response for their current version. A response of another version is invalidated, as
+// the credentials were rotated since it was cached.
+func cachedResponse(cache ResponseCache, credentialsID string, taskCredentials credentials.TaskIAMRoleCredentials) ([]byte, bool) {
+	version, ok := responseVersion(taskCredentials)
+	if cache == nil || !ok {
+		return nil, false
+	}
+	response, cachedVersion, ok := cache.Get(credentialsID)
+	if !ok {
+		return nil, false
+	}
+	if cachedVersion != version {
+		cache.Invalidate(credentialsID)
+		return nil, false
+	}
+	return response, true
+}
+
+// cacheResponse caches the response for the credentials, unless they have no version.
+func cacheResponse(cache ResponseCache, credentialsID string, taskCredentials credentials.TaskIAMRoleCredentials,
+	response []byte) {
+	version, ok := responseVersion(taskCredentials)
+	if cache == nil || !ok {
+		return
+	}
+	cache.Set(credentialsID, version, response)
+}
+
+// invalidateResponse removes the cached response for credentials that are no longer
+// served, so that the cache doesn't hold on to them.
+func invalidateResponse(cache ResponseCache, credentialsID string) {
+	if cache == nil || credentialsID == "" {
+		return
+	}
+	cache.Invalidate(credentialsID)
+}
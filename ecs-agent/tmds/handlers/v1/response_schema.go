@@ -0,0 +1,207 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+// SchemaValidationMode is what the credentials handler does with credentials responses
+// that don't match the credentials response schema.
+type SchemaValidationMode int
+
+const (
+	// SchemaValidationOff doesn't validate responses. This is the default, as validating
+	// every response has a cost that's only worth paying in test and canary environments.
+	SchemaValidationOff SchemaValidationMode = iota
+	// SchemaValidationLog logs mismatches, and writes the responses regardless.
+	SchemaValidationLog
+	// SchemaValidationEnforce logs mismatches, and responds with an internal server error
+	// instead of the responses.
+	SchemaValidationEnforce
+)
+
+//go:embed schema/credentials_response.json
+var credentialsResponseSchemaJSON []byte
+
+// credentialsResponseSchema is the parsed credentials response schema.
+var credentialsResponseSchema = mustParseJSONSchema(credentialsResponseSchemaJSON)
+
+// jsonSchema is the subset of JSON schema that the credentials response schema is
+// written in.
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	MinLength            *int                   `json:"minLength"`
+	Minimum              *float64               `json:"minimum"`
+}
+
+func mustParseJSONSchema(schemaJSON []byte) *jsonSchema {
+	var schema jsonSchema
+	if err := json.Unmarshal(schemaJSON, &schema); err != nil {
+		panic(fmt.Sprintf("invalid embedded JSON schema: %v", err))
+	}
+	return &schema
+}
+
+// Enable validation of credentials responses against the credentials response schema
+// before they are written, to catch changes of the response shape.
+func WithSchemaValidation(mode SchemaValidationMode) ConfigOpt {
+	return func(c *Config) {
+		c.schemaValidation = mode
+	}
+}
+
+// ValidateCredentialsResponse validates the credentials response body against the
+// credentials response schema. The returned error lists every mismatch.
+func ValidateCredentialsResponse(body []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("credentials response is not valid JSON: %w", err)
+	}
+	var mismatches []string
+	credentialsResponseSchema.validate("$", value, &mismatches)
+	if len(mismatches) > 0 {
+		return fmt.Errorf("credentials response does not match schema: %s", strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// schemaErrorMessage validates a credentials response if validation is enabled, and
+// returns the error message to respond with instead of the response if it doesn't match
+// the schema and the schema is enforced, or nil otherwise.
+func (c *Config) schemaErrorMessage(responseJSON []byte, credentialsID string) *handlersutils.ErrorMessage {
+	if c == nil || c.schemaValidation == SchemaValidationOff {
+		return nil
+	}
+	err := ValidateCredentialsResponse(responseJSON)
+	if err == nil {
+		return nil
+	}
+	seelog.Errorf("Credentials response for ID %s failed schema validation: %v", credentialsID, err)
+	if c.schemaValidation != SchemaValidationEnforce {
+		return nil
+	}
+	return &handlersutils.ErrorMessage{
+		Code:          ErrInternalServer,
+		Message:       "Internal server error",
+		HTTPErrorCode: http.StatusInternalServerError,
+	}
+}
+
+func (s *jsonSchema) validate(path string, value interface{}, mismatches *[]string) {
+	mismatch := func(format string, args ...interface{}) {
+		*mismatches = append(*mismatches, path+": "+fmt.Sprintf(format, args...))
+	}
+	if s.Type != "" && !jsonTypeMatches(s.Type, value) {
+		mismatch("expected %s, got %s", s.Type, jsonTypeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			mismatch("value %v is not one of %v", value, s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			mismatch("expected at least %d characters, got %d", *s.MinLength, len(v))
+		}
+	case json.Number:
+		if n, err := v.Float64(); err == nil && s.Minimum != nil && n < *s.Minimum {
+			mismatch("expected at least %v, got %v", *s.Minimum, v)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, mismatches)
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				mismatch("missing required property %s", key)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					mismatch("unexpected property %s", key)
+				}
+				continue
+			}
+			property.validate(path+"."+key, v[key], mismatches)
+		}
+	}
+}
+
+func jsonTypeMatches(schemaType string, value interface{}) bool {
+	actual := jsonTypeOf(value)
+	switch schemaType {
+	case "number":
+		return actual == "number" || actual == "integer"
+	default:
+		return actual == schemaType
+	}
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,197 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// CredentialsSignatureHeader is the response header containing the base64 encoded
+	// signature of the credentials response body
+	CredentialsSignatureHeader = "X-Amzn-Credentials-Signature"
+
+	// CredentialsSignatureKeyIDHeader is the response header containing the ID of the
+	// key that the credentials response body was signed with
+	CredentialsSignatureKeyIDHeader = "X-Amzn-Credentials-Signature-Key-Id"
+
+	// SignatureHeader is the response header containing the base64 encoded signature of
+	// the credentials response body when it's signed with a pre-shared key
+	SignatureHeader = "X-Amzn-Signature"
+
+	// SigningKeyPath specifies the relative URI path for serving the public key to verify
+	// credentials response signatures with
+	SigningKeyPath = "/v1/credentials-signing-key"
+
+	// SigningAlgorithm is the algorithm credentials responses are signed with by signers of
+	// per-boot keys
+	SigningAlgorithm = "Ed25519"
+
+	keyIDSize = 8
+
+	// minPreSharedKeySize is the minimum size of pre-shared keys, which is the size of the
+	// SHA-256 digest as recommended for HMAC-SHA256 keys
+	minPreSharedKeySize = sha256.Size
+)
+
+// ResponseSigner signs credentials response bodies. Signers of per-boot keys sign with an
+// Ed25519 key pair that is generated once per agent boot, and only the public key is
+// served, so that parties that can query the signing key endpoint can verify responses
+// but can't sign modified responses. Signers of pre-shared keys sign with HMAC-SHA256.
+type ResponseSigner struct {
+	keyID string
+	// privateKey and publicKey are set for signers of per-boot keys
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	// preSharedKey is set for signers of pre-shared keys, which are never served
+	preSharedKey []byte
+}
+
+// SigningKeyResponse is the response for a signing key request.
+type SigningKeyResponse struct {
+	KeyID     string `json:"KeyId"`
+	Algorithm string `json:"Algorithm"`
+	PublicKey string `json:"PublicKey"`
+}
+
+// NewResponseSigner creates a signer with a newly generated Ed25519 key pair.
+func NewResponseSigner() (*ResponseSigner, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate credentials response signing key: %w", err)
+	}
+	digest := sha256.Sum256(publicKey)
+	return &ResponseSigner{
+		keyID:      hex.EncodeToString(digest[:keyIDSize]),
+		privateKey: privateKey,
+		publicKey:  publicKey,
+	}, nil
+}
+
+// NewPreSharedKeySigner creates a signer with a key that is shared with the clients ahead
+// of time, so that they can verify responses without querying the signing key endpoint.
+// Responses are signed with the key in the SignatureHeader header, and the key is never
+// served by the signing key endpoint.
+func NewPreSharedKeySigner(key []byte) (*ResponseSigner, error) {
+	if len(key) < minPreSharedKeySize {
+		return nil, fmt.Errorf("credentials response signing key has %d bytes, at least %d are required",
+			len(key), minPreSharedKeySize)
+	}
+	digest := sha256.Sum256(key)
+	return &ResponseSigner{
+		keyID:        hex.EncodeToString(digest[:keyIDSize]),
+		preSharedKey: append([]byte(nil), key...),
+	}, nil
+}
+
+// KeyID returns the ID of the signing key.
+func (s *ResponseSigner) KeyID() string {
+	return s.keyID
+}
+
+// PublicKey returns the public key that signatures are verified with, or nil for signers
+// of pre-shared keys.
+func (s *ResponseSigner) PublicKey() ed25519.PublicKey {
+	return s.publicKey
+}
+
+// Sign returns the base64 encoded signature of the body.
+func (s *ResponseSigner) Sign(body []byte) string {
+	if s.PreShared() {
+		return base64.StdEncoding.EncodeToString(s.hmac(body))
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, body))
+}
+
+// PreShared returns whether the signing key is a pre-shared key.
+func (s *ResponseSigner) PreShared() bool {
+	return s.preSharedKey != nil
+}
+
+// Verify returns whether the base64 encoded signature is valid for the body.
+func (s *ResponseSigner) Verify(body []byte, signature string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	if s.PreShared() {
+		return hmac.Equal(decoded, s.hmac(body))
+	}
+	return ed25519.Verify(s.publicKey, body, decoded)
+}
+
+func (s *ResponseSigner) hmac(body []byte) []byte {
+	mac := hmac.New(sha256.New, s.preSharedKey)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Set a signer for signing credentials responses. Responses are not signed if not set.
+// The public key of signers of per-boot keys is served by RegisterCredentialsHandler.
+func WithResponseSigner(signer *ResponseSigner) ConfigOpt {
+	return func(c *Config) {
+		c.signer = signer
+	}
+}
+
+// SignResponse sets the signature headers for the response body if signing is enabled.
+func (c *Config) SignResponse(w http.ResponseWriter, body []byte) {
+	if c == nil || c.signer == nil {
+		return
+	}
+	signatureHeader := CredentialsSignatureHeader
+	if c.signer.PreShared() {
+		signatureHeader = SignatureHeader
+	}
+	w.Header().Set(signatureHeader, c.signer.Sign(body))
+	w.Header().Set(CredentialsSignatureKeyIDHeader, c.signer.KeyID())
+}
+
+// RegisterSigningKeyHandler registers the handler for the signing key API on the
+// provided router. Nothing is registered for signers of pre-shared keys, which clients
+// already have.
+func RegisterSigningKeyHandler(router *mux.Router, signer *ResponseSigner) {
+	if signer.PreShared() {
+		return
+	}
+	router.HandleFunc(SigningKeyPath, SigningKeyHandler(signer))
+}
+
+// SigningKeyHandler creates response for the signing key API. It returns a JSON response
+// containing the ID, algorithm and base64 encoded public key that credentials responses
+// are verified with. Pre-shared keys are never served, the handler responds with 404 for
+// them.
+func SigningKeyHandler(signer *ResponseSigner) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if signer.PreShared() {
+			http.NotFound(w, r)
+			return
+		}
+		handlersutils.WriteJSONResponse(w, http.StatusOK, SigningKeyResponse{
+			KeyID:     signer.KeyID(),
+			Algorithm: SigningAlgorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(signer.publicKey),
+		}, handlersutils.RequestTypeCreds)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// RoleARNQueryParameterName is the name of the optional query parameter selecting the
+	// role whose credentials are returned, among the roles of the task of the credentials
+	// ID. The credentials of the credentials ID are returned if it isn't set.
+	RoleARNQueryParameterName = "roleArn"
+
+	// ErrRoleNotPermitted is the error code indicating that the task of the credentials ID
+	// holds no credentials of the requested role
+	ErrRoleNotPermitted = "RoleNotPermitted"
+	// ErrRoleSelectionUnsupported is the error code indicating that the credentials manager
+	// can't select the credentials of other roles
+	ErrRoleSelectionUnsupported = "RoleSelectionUnsupported"
+)
+
+// selectedRoleCredentialsManager returns the credentials manager to serve the request
+// from. If the request selects a role with the roleArn query parameter, that's a credentials
+// manager that has the credentials of the role for the credentials ID. It returns whether a
+// role is selected, and an error message if the task of the credentials ID holds no
+// credentials of the role or if the credentials manager can't select roles. Requests for
+// credentials IDs that aren't found are left to fail as they would without a role.
+func selectedRoleCredentialsManager(
+	r *http.Request,
+	credentialsManager credentials.Manager,
+	credentialsID string,
+	errPrefix string,
+) (credentials.Manager, bool, *handlersutils.ErrorMessage) {
+	roleARN, ok := handlersutils.ValueFromRequest(r, RoleARNQueryParameterName)
+	if !ok || credentialsID == "" {
+		return credentialsManager, false, nil
+	}
+	taskCredentials, ok := credentialsManager.GetTaskCredentials(credentialsID)
+	if !ok {
+		return credentialsManager, false, nil
+	}
+	if taskCredentials.IAMRoleCredentials.RoleArn == roleARN {
+		return credentialsManager, false, nil
+	}
+	selector, ok := credentialsManager.(credentials.RoleCredentialsSelector)
+	if !ok {
+		errText := errPrefix + "Role selection is not supported"
+		seelog.Errorf("Error processing credential request taskARN=%s: %s", taskCredentials.ARN, errText)
+		return nil, false, &handlersutils.ErrorMessage{
+			Code:          ErrRoleSelectionUnsupported,
+			Message:       errText,
+			HTTPErrorCode: http.StatusBadRequest,
+		}
+	}
+	selected, ok := selector.GetTaskCredentialsForRole(credentialsID, roleARN)
+	if !ok {
+		errText := errPrefix + "Role is not permitted for the task"
+		seelog.Errorf("Error processing credential request taskARN=%s for role %s: %s",
+			taskCredentials.ARN, roleARN, errText)
+		return nil, false, &handlersutils.ErrorMessage{
+			Code:          ErrRoleNotPermitted,
+			Message:       errText,
+			HTTPErrorCode: http.StatusForbidden,
+		}
+	}
+	return &providedCredentials{Manager: credentialsManager, credentialsID: credentialsID,
+		taskCredentials: selected}, true, nil
+}
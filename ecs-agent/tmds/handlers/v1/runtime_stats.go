@@ -0,0 +1,121 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RuntimeStats is a RequestObserver that counts credentials requests by API version,
+// status code and error code. It also counts the requests throttled by the task metadata
+// server and the hits and misses of the caches of the task metadata handlers, so that the
+// runtime statistics of the handlers can be exported as a single snapshot.
+type RuntimeStats struct {
+	since       time.Time
+	requests    uint64
+	throttled   uint64
+	cacheHits   uint64
+	cacheMisses uint64
+
+	lock        sync.Mutex
+	apiVersions map[string]uint64
+	statusCodes map[int]uint64
+	errorCodes  map[string]uint64
+}
+
+// RuntimeStatsSnapshot is a point in time copy of the counters of RuntimeStats.
+type RuntimeStatsSnapshot struct {
+	// Since is when the counters started counting
+	Since time.Time `json:"since"`
+	// Requests is the number of credentials requests that were responded to
+	Requests uint64 `json:"requests"`
+	// RequestsByAPIVersion is the number of credentials requests by API version
+	RequestsByAPIVersion map[string]uint64 `json:"requestsByApiVersion"`
+	// StatusCodes is the number of credentials responses by HTTP status code
+	StatusCodes map[string]uint64 `json:"statusCodes"`
+	// ErrorCodes is the number of credentials responses by error code
+	ErrorCodes map[string]uint64 `json:"errorCodes"`
+	// Throttled is the number of requests rejected by the rate limiter of the server
+	Throttled uint64 `json:"throttled"`
+	// CacheHits is the number of lookups served from the caches of the handlers
+	CacheHits uint64 `json:"cacheHits"`
+	// CacheMisses is the number of lookups that the caches of the handlers couldn't serve
+	CacheMisses uint64 `json:"cacheMisses"`
+}
+
+// NewRuntimeStats creates runtime statistics that start counting now.
+func NewRuntimeStats() *RuntimeStats {
+	return &RuntimeStats{
+		since:       time.Now(),
+		apiVersions: make(map[string]uint64),
+		statusCodes: make(map[int]uint64),
+		errorCodes:  make(map[string]uint64),
+	}
+}
+
+// ObserveRequest counts the credentials request.
+func (s *RuntimeStats) ObserveRequest(observation RequestObservation) {
+	atomic.AddUint64(&s.requests, 1)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.apiVersions[observation.APIVersion]++
+	s.statusCodes[observation.StatusCode]++
+	if observation.ErrorCode != "" {
+		s.errorCodes[observation.ErrorCode]++
+	}
+}
+
+// RecordThrottle counts a request rejected by the rate limiter of the server.
+func (s *RuntimeStats) RecordThrottle() {
+	atomic.AddUint64(&s.throttled, 1)
+}
+
+// RecordCacheHit counts a lookup served from a cache of the handlers.
+func (s *RuntimeStats) RecordCacheHit() {
+	atomic.AddUint64(&s.cacheHits, 1)
+}
+
+// RecordCacheMiss counts a lookup that a cache of the handlers couldn't serve.
+func (s *RuntimeStats) RecordCacheMiss() {
+	atomic.AddUint64(&s.cacheMisses, 1)
+}
+
+// Snapshot returns a copy of the counters.
+func (s *RuntimeStats) Snapshot() RuntimeStatsSnapshot {
+	snapshot := RuntimeStatsSnapshot{
+		Since:       s.since,
+		Requests:    atomic.LoadUint64(&s.requests),
+		Throttled:   atomic.LoadUint64(&s.throttled),
+		CacheHits:   atomic.LoadUint64(&s.cacheHits),
+		CacheMisses: atomic.LoadUint64(&s.cacheMisses),
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	snapshot.RequestsByAPIVersion = make(map[string]uint64, len(s.apiVersions))
+	for apiVersion, count := range s.apiVersions {
+		snapshot.RequestsByAPIVersion[apiVersion] = count
+	}
+	snapshot.StatusCodes = make(map[string]uint64, len(s.statusCodes))
+	for statusCode, count := range s.statusCodes {
+		snapshot.StatusCodes[strconv.Itoa(statusCode)] = count
+	}
+	snapshot.ErrorCodes = make(map[string]uint64, len(s.errorCodes))
+	for errorCode, count := range s.errorCodes {
+		snapshot.ErrorCodes[errorCode] = count
+	}
+	return snapshot
+}
@@ -0,0 +1,66 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ErrServiceNotPermitted is the error code indicating that the credentials are not
+	// valid for the AWS service requested with the service query parameter
+	ErrServiceNotPermitted = "ServiceNotPermitted"
+
+	// ServiceQueryParameterName is the name of the optional query parameter for the AWS
+	// service that the caller intends to use the credentials for
+	ServiceQueryParameterName = "service"
+
+	// CredentialsScopeMatchHeader is the response header confirming that the credentials
+	// are valid for the AWS service requested with the service query parameter. It is
+	// only set if the credentials manager has scoping info for the credentials.
+	CredentialsScopeMatchHeader = "X-Amzn-Credentials-Scope-Match"
+)
+
+// checkServiceScope verifies that the credentials are valid for the AWS service requested
+// with the service query parameter, if any. It returns whether the scope of the credentials
+// is confirmed to match, and an error message if the service is not permitted.
+func checkServiceScope(
+	r *http.Request,
+	taskCredentials credentials.TaskIAMRoleCredentials,
+	errPrefix string,
+) (bool, *handlersutils.ErrorMessage) {
+	service, ok := handlersutils.ValueFromRequest(r, ServiceQueryParameterName)
+	if !ok || service == "" {
+		return false, nil
+	}
+	permitted, scoped := taskCredentials.PermitsService(service)
+	if !scoped {
+		return false, nil
+	}
+	if permitted {
+		return true, nil
+	}
+	errText := errPrefix + "Credentials are not valid for the requested service"
+	seelog.Errorf("Error processing credential request credentialType=%s taskARN=%s service=%s: %s",
+		taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, service, errText)
+	return false, &handlersutils.ErrorMessage{
+		Code:          ErrServiceNotPermitted,
+		Message:       errText,
+		HTTPErrorCode: http.StatusForbidden,
+	}
+}
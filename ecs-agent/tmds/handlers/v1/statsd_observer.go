@@ -0,0 +1,135 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+const (
+	// DefaultStatsDPrefix is the prefix of the StatsD metric names if no prefix is
+	// provided.
+	DefaultStatsDPrefix = "ecs.tmds"
+
+	// statsDQueueSize is the number of packets that are queued for sending before
+	// packets are dropped.
+	statsDQueueSize = 256
+
+	// StatsD metric names, relative to the prefix
+	statsDRequestCountMetric   = "credentials.requests"
+	statsDRequestLatencyMetric = "credentials.latency"
+	statsDStatusCodeMetric     = "credentials.status"
+	statsDErrorCodeMetric      = "credentials.errors"
+)
+
+// StatsDObserver is a RequestObserver that sends the count, latency, status code and
+// error code of every credentials request to a StatsD server over UDP. The metrics of a
+// request are sent in a single packet, by a goroutine of the observer so that requests
+// are never held up by the send. Packets are dropped if the observer falls behind.
+type StatsDObserver struct {
+	conn    net.Conn
+	prefix  string
+	queue   chan []byte
+	done    chan struct{}
+	dropped uint64
+	close   sync.Once
+}
+
+// NewStatsDObserver creates an observer that sends metrics to the StatsD server at the
+// UDP address, with metric names under the prefix, or under DefaultStatsDPrefix if the
+// prefix is empty.
+func NewStatsDObserver(address, prefix string) (*StatsDObserver, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to StatsD server %s: %w", address, err)
+	}
+	if prefix == "" {
+		prefix = DefaultStatsDPrefix
+	}
+	o := &StatsDObserver{
+		conn:   conn,
+		prefix: strings.TrimSuffix(prefix, "."),
+		queue:  make(chan []byte, statsDQueueSize),
+		done:   make(chan struct{}),
+	}
+	go o.send()
+	return o, nil
+}
+
+// ObserveRequest queues the metrics packet of the request for sending. The packet is
+// dropped if the queue is full.
+func (o *StatsDObserver) ObserveRequest(observation RequestObservation) {
+	apiVersion := statsDName(observation.APIVersion)
+	lines := []string{
+		o.prefix + "." + statsDRequestCountMetric + "." + apiVersion + ":1|c",
+		o.prefix + "." + statsDRequestLatencyMetric + "." + apiVersion + ":" +
+			strconv.FormatFloat(float64(observation.Latency)/float64(time.Millisecond), 'f', -1, 64) + "|ms",
+		o.prefix + "." + statsDStatusCodeMetric + "." + strconv.Itoa(observation.StatusCode) + ":1|c",
+	}
+	if observation.ErrorCode != "" {
+		lines = append(lines, o.prefix+"."+statsDErrorCodeMetric+"."+statsDName(observation.ErrorCode)+":1|c")
+	}
+	select {
+	case o.queue <- []byte(strings.Join(lines, "\n")):
+	default:
+		atomic.AddUint64(&o.dropped, 1)
+	}
+}
+
+// Dropped returns the number of packets that were dropped because the queue was full.
+func (o *StatsDObserver) Dropped() uint64 {
+	return atomic.LoadUint64(&o.dropped)
+}
+
+// Close stops sending metrics. Requests observed after Close are dropped.
+func (o *StatsDObserver) Close() error {
+	var err error
+	o.close.Do(func() {
+		close(o.done)
+		err = o.conn.Close()
+	})
+	return err
+}
+
+func (o *StatsDObserver) send() {
+	for {
+		select {
+		case <-o.done:
+			return
+		case packet := <-o.queue:
+			if _, err := o.conn.Write(packet); err != nil {
+				seelog.Debugf("Unable to send StatsD metrics for credentials request: %v", err)
+			}
+		}
+	}
+}
+
+// statsDName replaces the characters that have a meaning in the StatsD protocol.
+func statsDName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,181 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+// ErrSuspiciousRequest is the error code indicating that the request carries headers that
+// are indicative of server-side request forgery or proxy abuse
+const ErrSuspiciousRequest = "SuspiciousRequest"
+
+// SuspiciousHeaderHeuristic is a heuristic of the suspicious header guard, flagging
+// requests with headers that task containers don't send when they request credentials
+// from the agent themselves.
+type SuspiciousHeaderHeuristic string
+
+const (
+	// HeuristicForwardedHostMismatch flags requests whose X-Forwarded-Host header, or the
+	// host of their Forwarded header, differs from the host that they were sent to. This
+	// is what requests look like that a proxy was tricked into forwarding to the agent.
+	HeuristicForwardedHostMismatch SuspiciousHeaderHeuristic = "forwarded-host-mismatch"
+	// HeuristicProxyHeaders flags requests with any of the headers that proxies add,
+	// X-Forwarded-For, X-Forwarded-Host, X-Forwarded-Proto, Forwarded and Via, as requests
+	// of task containers don't go through proxies.
+	HeuristicProxyHeaders SuspiciousHeaderHeuristic = "proxy-headers"
+	// HeuristicURLOverride flags requests with the X-Original-URL or X-Rewrite-URL headers,
+	// which some proxies and frameworks route by instead of the request path.
+	HeuristicURLOverride SuspiciousHeaderHeuristic = "url-override"
+)
+
+// SuspiciousHeaderHeuristics are all the heuristics of the suspicious header guard.
+var SuspiciousHeaderHeuristics = []SuspiciousHeaderHeuristic{
+	HeuristicForwardedHostMismatch,
+	HeuristicProxyHeaders,
+	HeuristicURLOverride,
+}
+
+var (
+	proxyHeaders       = []string{"X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "Forwarded", "Via"}
+	urlOverrideHeaders = []string{"X-Original-Url", "X-Rewrite-Url"}
+)
+
+// ParseSuspiciousHeaderHeuristic returns the heuristic of the suspicious header guard with
+// the given name.
+func ParseSuspiciousHeaderHeuristic(name string) (SuspiciousHeaderHeuristic, error) {
+	for _, heuristic := range SuspiciousHeaderHeuristics {
+		if string(heuristic) == name {
+			return heuristic, nil
+		}
+	}
+	return "", fmt.Errorf("unknown suspicious header heuristic %q", name)
+}
+
+// headerGuard is the suspicious header guard, checking requests with its heuristics.
+type headerGuard struct {
+	heuristics []SuspiciousHeaderHeuristic
+}
+
+// Reject credentials requests flagged by any of the given heuristics with a 403, which
+// guards against credentials being served to requests that were forwarded to the agent
+// through server-side request forgery or proxy abuse. The heuristics can flag requests of
+// legitimate clients that go through proxies, so requests aren't checked if no heuristics
+// are given, which is the default.
+func WithSuspiciousHeaderGuard(heuristics ...SuspiciousHeaderHeuristic) ConfigOpt {
+	return func(c *Config) {
+		if len(heuristics) == 0 {
+			c.headerGuard = nil
+			return
+		}
+		c.headerGuard = &headerGuard{heuristics: heuristics}
+	}
+}
+
+// suspiciousHeaderErrorMessage returns the error message to respond with if the request
+// is flagged by any of the heuristics of the suspicious header guard, or nil otherwise.
+func (c *Config) suspiciousHeaderErrorMessage(
+	r *http.Request,
+	credentialsID string,
+	errPrefix string,
+) *handlersutils.ErrorMessage {
+	if c == nil || c.headerGuard == nil {
+		return nil
+	}
+	for _, heuristic := range c.headerGuard.heuristics {
+		reason, flagged := checkSuspiciousHeaders(r, heuristic)
+		if !flagged {
+			continue
+		}
+		errText := errPrefix + "Request carries suspicious headers"
+		seelog.Warnf("Rejected credentials request from %s for credentials ID %s flagged by heuristic %s: %s",
+			r.RemoteAddr, credentialsID, heuristic, reason)
+		return &handlersutils.ErrorMessage{
+			Code:          ErrSuspiciousRequest,
+			Message:       errText,
+			HTTPErrorCode: http.StatusForbidden,
+		}
+	}
+	return nil
+}
+
+// checkSuspiciousHeaders returns whether the heuristic flags the request, along with the
+// reason that it does.
+func checkSuspiciousHeaders(r *http.Request, heuristic SuspiciousHeaderHeuristic) (string, bool) {
+	switch heuristic {
+	case HeuristicForwardedHostMismatch:
+		host := hostname(r.Host)
+		for _, forwardedHost := range forwardedHosts(r) {
+			if !strings.EqualFold(hostname(forwardedHost), host) {
+				return fmt.Sprintf("forwarded host %s doesn't match host %s", forwardedHost, r.Host), true
+			}
+		}
+	case HeuristicProxyHeaders:
+		if header, ok := anyHeader(r, proxyHeaders); ok {
+			return "proxy header " + header + " is set", true
+		}
+	case HeuristicURLOverride:
+		if header, ok := anyHeader(r, urlOverrideHeaders); ok {
+			return "URL override header " + header + " is set", true
+		}
+	}
+	return "", false
+}
+
+// forwardedHosts returns the hosts of the X-Forwarded-Host headers and of the host
+// parameters of the Forwarded headers of the request.
+func forwardedHosts(r *http.Request) []string {
+	var hosts []string
+	for _, value := range r.Header.Values("X-Forwarded-Host") {
+		for _, host := range strings.Split(value, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	for _, value := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, host, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "host") {
+					hosts = append(hosts, strings.Trim(host, `"`))
+				}
+			}
+		}
+	}
+	return hosts
+}
+
+// hostname returns the host without its port, if any.
+func hostname(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+func anyHeader(r *http.Request, headers []string) (string, bool) {
+	for _, header := range headers {
+		if _, ok := r.Header[header]; ok {
+			return header, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,61 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+// ErrTaskNotRunning is the error code indicating that the task that the credentials
+// belong to is not running
+const ErrTaskNotRunning = "TaskNotRunning"
+
+// TaskStatusLookup returns the status of the task, and whether credentials can be served
+// to it. It is called with the ARN of the task that the requested credentials belong to.
+type TaskStatusLookup func(taskARN string) (status string, running bool)
+
+// Serve credentials only for tasks that the lookup reports as running. Credentials are
+// served regardless of the status of their task if not set.
+func WithTaskRunningGate(lookup TaskStatusLookup) ConfigOpt {
+	return func(c *Config) {
+		c.taskStatus = lookup
+	}
+}
+
+// taskStateErrorMessage returns the error message to respond with if the task that the
+// credentials belong to is not running, or nil otherwise.
+func (c *Config) taskStateErrorMessage(
+	taskCredentials credentials.TaskIAMRoleCredentials,
+	errPrefix string,
+) *handlersutils.ErrorMessage {
+	if c == nil || c.taskStatus == nil {
+		return nil
+	}
+	status, running := c.taskStatus(taskCredentials.ARN)
+	if running {
+		return nil
+	}
+	errText := errPrefix + "Task is not running"
+	seelog.Warnf("Denied credentials request credentialType=%s taskARN=%s taskStatus=%s: %s",
+		taskCredentials.IAMRoleCredentials.RoleType, taskCredentials.ARN, status, errText)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrTaskNotRunning,
+		Message:       errText,
+		HTTPErrorCode: http.StatusConflict,
+	}
+}
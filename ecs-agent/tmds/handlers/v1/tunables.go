@@ -0,0 +1,216 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/cihub/seelog"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// ErrRequestRateExceeded is the error code indicating that the credentials request
+	// rate limit of the handler was exceeded
+	ErrRequestRateExceeded = "RequestRateExceeded"
+
+	// ErrRoleTypeNotAllowed is the error code indicating that credentials of the role
+	// type of the requested credentials are not served
+	ErrRoleTypeNotAllowed = "RoleTypeNotAllowed"
+
+	// RequestLogLevelInfo and RequestLogLevelDebug are the levels that credentials
+	// requests can be logged at. Requests are logged at RequestLogLevelInfo by default.
+	RequestLogLevelInfo  = "info"
+	RequestLogLevelDebug = "debug"
+
+	// RateLimitRemainingHeader and RateLimitResetHeader are the headers of throttled
+	// responses containing the number of requests that can be made right away, and the
+	// Unix time in seconds at which the rate limiter has its full burst of requests again
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// Tunables are the settings of the credentials handler that can be changed while the
+// handler is serving requests. The zero value doesn't change the behavior of the
+// handler.
+type Tunables struct {
+	// RequestsPerSecond is the steady rate of credentials requests that are served, with
+	// bursts of up to Burst requests. Requests aren't rate limited if it's zero. Burst
+	// defaults to RequestsPerSecond rounded up if it's zero.
+	RequestsPerSecond float64
+	Burst             int
+	// AllowedRoleTypes are the role types that credentials are served for. Credentials of
+	// all role types are served if it's empty.
+	AllowedRoleTypes []string
+	// RequestLogLevel is the level that credentials requests are logged at, one of
+	// RequestLogLevelInfo and RequestLogLevelDebug.
+	RequestLogLevel string
+}
+
+// TunablesHolder holds the tunables of the credentials handler, and swaps them
+// atomically. A request uses the tunables that are current when it's received until
+// it's responded to, so requests that are in flight during a swap aren't affected.
+type TunablesHolder struct {
+	current atomic.Value // *tunablesSnapshot
+}
+
+// tunablesSnapshot is an immutable set of tunables, with the rate limiter and allowlist
+// derived from them.
+type tunablesSnapshot struct {
+	tunables         Tunables
+	limiter          *rate.Limiter
+	allowedRoleTypes map[string]bool
+	logf             func(format string, params ...interface{})
+}
+
+// NewTunablesHolder creates a holder with the initial tunables.
+func NewTunablesHolder(tunables Tunables) *TunablesHolder {
+	h := &TunablesHolder{}
+	h.Swap(tunables)
+	return h
+}
+
+// Swap replaces the tunables with new ones, which are used by requests received from
+// then on. The rate limiter starts afresh with the new rate.
+func (h *TunablesHolder) Swap(tunables Tunables) {
+	tunables.AllowedRoleTypes = append([]string(nil), tunables.AllowedRoleTypes...)
+	snapshot := &tunablesSnapshot{
+		tunables: tunables,
+		logf:     seelog.Infof,
+	}
+	if tunables.RequestsPerSecond > 0 {
+		burst := tunables.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(tunables.RequestsPerSecond))
+		}
+		snapshot.limiter = rate.NewLimiter(rate.Limit(tunables.RequestsPerSecond), burst)
+	}
+	if len(tunables.AllowedRoleTypes) > 0 {
+		snapshot.allowedRoleTypes = make(map[string]bool, len(tunables.AllowedRoleTypes))
+		for _, roleType := range tunables.AllowedRoleTypes {
+			snapshot.allowedRoleTypes[roleType] = true
+		}
+	}
+	if strings.EqualFold(tunables.RequestLogLevel, RequestLogLevelDebug) {
+		snapshot.logf = seelog.Debugf
+	}
+	h.current.Store(snapshot)
+	seelog.Infof("Credentials handler tunables set: requestsPerSecond=%v burst=%d allowedRoleTypes=%v requestLogLevel=%s",
+		tunables.RequestsPerSecond, tunables.Burst, tunables.AllowedRoleTypes, tunables.RequestLogLevel)
+}
+
+// Load returns the current tunables.
+func (h *TunablesHolder) Load() Tunables {
+	tunables := h.snapshot().tunables
+	tunables.AllowedRoleTypes = append([]string(nil), tunables.AllowedRoleTypes...)
+	return tunables
+}
+
+// defaultTunables is used by handlers that aren't configured with a holder.
+var defaultTunables = &tunablesSnapshot{logf: seelog.Infof}
+
+func (h *TunablesHolder) snapshot() *tunablesSnapshot {
+	if h == nil {
+		return defaultTunables
+	}
+	return h.current.Load().(*tunablesSnapshot)
+}
+
+// Set a holder of tunables that can be swapped while the handler is serving requests.
+func WithTunables(holder *TunablesHolder) ConfigOpt {
+	return func(c *Config) {
+		c.tunables = holder
+	}
+}
+
+// loadTunables returns a snapshot of the tunables for a request.
+func (c *Config) loadTunables() *tunablesSnapshot {
+	if c == nil {
+		return defaultTunables
+	}
+	return c.tunables.snapshot()
+}
+
+// rateLimitErrorMessage returns the error message to respond with if the request rate
+// limit is exceeded, or nil otherwise. Throttled responses have the rate limit headers,
+// which are computed from the tokens of the rate limiter.
+func (t *tunablesSnapshot) rateLimitErrorMessage(w http.ResponseWriter, credentialsID string,
+	errPrefix string) *handlersutils.ErrorMessage {
+	if t.limiter == nil {
+		return nil
+	}
+	now := time.Now()
+	if t.limiter.AllowN(now, 1) {
+		return nil
+	}
+	setRateLimitHeaders(w, t.limiter, now)
+	errText := errPrefix + "Credentials request rate exceeded"
+	seelog.Warnf("Denied credentials request for ID %s: %s", credentialsID, errText)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrRequestRateExceeded,
+		Message:       errText,
+		HTTPErrorCode: http.StatusTooManyRequests,
+	}
+}
+
+// setRateLimitHeaders sets the rate limit headers of the response from the tokens of the
+// rate limiter at the given time. The reset is rounded up to the next second.
+func setRateLimitHeaders(w http.ResponseWriter, limiter *rate.Limiter, now time.Time) {
+	tokens, ok := limiterTokens(limiter, now)
+	if !ok {
+		return
+	}
+	secondsUntilFull := (float64(limiter.Burst()) - tokens) / float64(limiter.Limit())
+	reset := now.Add(time.Duration(secondsUntilFull * float64(time.Second)))
+	resetSeconds := reset.Unix()
+	if reset.Nanosecond() > 0 {
+		resetSeconds++
+	}
+	w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+	w.Header().Set(RateLimitResetHeader, strconv.FormatInt(resetSeconds, 10))
+}
+
+// limiterTokens returns the number of tokens of the rate limiter at the given time. The
+// limiter doesn't expose its tokens, so they are derived from the delay of a reservation of
+// a single token, which is canceled right away.
+func limiterTokens(limiter *rate.Limiter, now time.Time) (float64, bool) {
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return 0, false
+	}
+	delay := reservation.DelayFrom(now)
+	reservation.CancelAt(now)
+	return 1 - delay.Seconds()*float64(limiter.Limit()), true
+}
+
+// roleTypeErrorMessage returns the error message to respond with if credentials of the
+// role type aren't served, or nil otherwise.
+func (t *tunablesSnapshot) roleTypeErrorMessage(roleType string, errPrefix string) *handlersutils.ErrorMessage {
+	if t.allowedRoleTypes == nil || t.allowedRoleTypes[roleType] {
+		return nil
+	}
+	errText := errPrefix + "Credentials of role type " + roleType + " are not served"
+	seelog.Warnf("Denied credentials request: %s", errText)
+	return &handlersutils.ErrorMessage{
+		Code:          ErrRoleTypeNotAllowed,
+		Message:       errText,
+		HTTPErrorCode: http.StatusForbidden,
+	}
+}
@@ -28,6 +28,9 @@ const (
 	// Credentials API version.
 	apiVersion = 2
 
+	// APIVersion is the API version that v2 credentials requests are audit logged with
+	APIVersion = "v2"
+
 	// credentialsIDMuxName is the key that's used in gorilla/mux to get the credentials ID.
 	credentialsIDMuxName = "credentialsIDMuxName"
 )
@@ -39,13 +42,20 @@ const (
 // but it should be 400 error.
 var CredentialsPath = credentials.V2CredentialsPath + "/" + utils.ConstructMuxVar(credentialsIDMuxName, utils.AnythingRegEx)
 
-// CredentialsHandler creates response for the 'v2/credentials' API.
-func CredentialsHandler(credentialsManager credentials.Manager, auditLogger auditinterface.AuditLogger) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+// CredentialsHandler creates response for the 'v2/credentials' API. Responses carry the
+// headers of utils.SecurityHeadersHandler.
+func CredentialsHandler(
+	credentialsManager credentials.Manager,
+	auditLogger auditinterface.AuditLogger,
+	options ...v1.ConfigOpt,
+) func(http.ResponseWriter, *http.Request) {
+	config := v1.NewConfig(append([]v1.ConfigOpt{v1.WithAPIVersion(APIVersion)}, options...)...)
+	// The error prefix is formatted once, not for every request
+	errPrefix := fmt.Sprintf("CredentialsV%dRequest: ", apiVersion)
+	return utils.SecurityHeadersHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		credentialsID := getCredentialsID(r)
-		errPrefix := fmt.Sprintf("CredentialsV%dRequest: ", apiVersion)
-		v1.CredentialsHandlerImpl(w, r, auditLogger, credentialsManager, credentialsID, errPrefix)
-	}
+		v1.CredentialsHandlerImpl(w, r, auditLogger, credentialsManager, credentialsID, errPrefix, config)
+	})).ServeHTTP
 }
 
 func getCredentialsID(r *http.Request) string {
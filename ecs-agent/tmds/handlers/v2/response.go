@@ -62,6 +62,7 @@ type ContainerResponse struct {
 	LogDriver     string                    `json:"LogDriver,omitempty"`
 	LogOptions    map[string]string         `json:"LogOptions,omitempty"`
 	ContainerARN  string                    `json:"ContainerARN,omitempty"`
+	PidMode       string                    `json:"PidMode,omitempty"`
 }
 
 // Container health status
@@ -0,0 +1,249 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v4
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	v1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+	state "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v4/state"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// CredentialsIDMuxName is the key that's used in gorilla/mux to get the credentials ID.
+	CredentialsIDMuxName = "credentialsIDMuxName"
+
+	// StreamErrorTrailer is the trailer set when a streamed response could not be
+	// completed. Its value is the JSON encoded error message.
+	StreamErrorTrailer = "X-Amzn-Stream-Error"
+
+	// ErrTaskMetadataUnavailable is the error code indicating that the task metadata
+	// could not be streamed after the credentials.
+	ErrTaskMetadataUnavailable = "TaskMetadataUnavailable"
+
+	// ErrCredentialsTaskMismatch is the error code indicating that the credentials
+	// do not belong to the task of the endpoint container.
+	ErrCredentialsTaskMismatch = "CredentialsTaskMismatch"
+
+	credentialsStreamErrPrefix = "TaskMetadataWithCredentialsV4Request: "
+
+	// credentialsStreamAPIVersion is the API version that credentials streamed with task
+	// metadata are audit logged with
+	credentialsStreamAPIVersion = "v4"
+
+	// clockSkewField is the field of the credentials with the estimated host clock skew
+	// in seconds. The skew is positive when the host clock is ahead.
+	clockSkewField = "EstimatedClockSkewSeconds"
+)
+
+// Returns the standard URI path for task metadata with credentials endpoint.
+func TaskMetadataWithCredentialsPath() string {
+	return fmt.Sprintf(
+		"/v4/%s/taskWithCredentials/%s",
+		utils.ConstructMuxVar(EndpointContainerIDMuxName, utils.AnythingButSlashRegEx),
+		utils.ConstructMuxVar(CredentialsIDMuxName, utils.AnythingButSlashRegEx))
+}
+
+// TaskMetadataWithCredentialsHandler returns the HTTP handler function for handling
+// task metadata with credentials requests. The response is a JSON document with the
+// credentials under "Credentials" and the task metadata under "TaskMetadata". The
+// credentials are flushed to the client before the task metadata is fetched, so that
+// clients can start using them without waiting for the whole document.
+//
+// The credentials are served through the same checks as the credentials handlers with the
+// same options, and credentials errors are reported with an error status code like the
+// credentials handlers do. So are the credentials of another task than the one of the
+// endpoint container. Once the credentials have been sent, the status can no longer
+// change, so task metadata errors end the document without "TaskMetadata" and are
+// reported in the StreamErrorTrailer trailer instead. The signature of a signed response
+// covers the credentials.
+//
+// The credentials include the estimated host clock skew if a clock skew estimator is
+// configured and the skew has been estimated, since a large skew makes the credentials
+// unusable before they expire.
+func TaskMetadataWithCredentialsHandler(
+	agentState state.AgentState,
+	credentialsManager credentials.Manager,
+	auditLogger audit.AuditLogger,
+	metricsFactory metrics.EntryFactory,
+	options ...v1.ConfigOpt,
+) func(http.ResponseWriter, *http.Request) {
+	config := v1.NewConfig(append(options, v1.WithAPIVersion(credentialsStreamAPIVersion))...)
+	return utils.SecurityHeadersHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpointContainerID := mux.Vars(r)[EndpointContainerIDMuxName]
+		credentialsID := mux.Vars(r)[CredentialsIDMuxName]
+		v1.ServeCredentials(w, r, auditLogger, credentialsManager, credentialsID, credentialsStreamErrPrefix, config,
+			func(w http.ResponseWriter, credentialsJSON []byte,
+				taskCredentials credentials.TaskIAMRoleCredentials) *utils.ErrorMessage {
+				if errorMessage := checkCredentialsTask(agentState, metricsFactory, endpointContainerID,
+					taskCredentials); errorMessage != nil {
+					return errorMessage
+				}
+				if estimate, ok := config.ClockSkewEstimate(); ok {
+					credentialsJSON = withClockSkew(credentialsJSON, estimate.SkewSeconds)
+				}
+				streamTaskMetadataWithCredentials(w, agentState, metricsFactory, endpointContainerID, config,
+					credentialsJSON)
+				return nil
+			})
+	})).ServeHTTP
+}
+
+// checkCredentialsTask returns the error message to respond with if the credentials don't
+// belong to the task of the endpoint container, or if the task can't be looked up.
+func checkCredentialsTask(
+	agentState state.AgentState,
+	metricsFactory metrics.EntryFactory,
+	endpointContainerID string,
+	taskCredentials credentials.TaskIAMRoleCredentials,
+) *utils.ErrorMessage {
+	taskARN, err := agentState.GetTaskARN(endpointContainerID)
+	if err != nil {
+		logger.Error("Failed to get the task of the v4 task metadata with credentials", logger.Fields{
+			field.TMDSEndpointContainerID: endpointContainerID,
+			field.Error:                   err,
+		})
+		responseCode, responseBody := getTaskErrorResponse(endpointContainerID, err)
+		if utils.Is5XXStatus(responseCode) {
+			metricsFactory.New(metrics.InternalServerErrorMetricName).Done(err)()
+		}
+		return &utils.ErrorMessage{
+			Code:          ErrTaskMetadataUnavailable,
+			Message:       responseBody,
+			HTTPErrorCode: responseCode,
+		}
+	}
+	if taskARN != taskCredentials.ARN {
+		logger.Error("Credentials requested with task metadata belong to a different task", logger.Fields{
+			field.TMDSEndpointContainerID: endpointContainerID,
+			field.TaskARN:                 taskARN,
+		})
+		return &utils.ErrorMessage{
+			Code:          ErrCredentialsTaskMismatch,
+			Message:       credentialsStreamErrPrefix + "Credentials do not belong to the task",
+			HTTPErrorCode: http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// streamTaskMetadataWithCredentials streams the credentials and then the task metadata of
+// the endpoint container.
+func streamTaskMetadataWithCredentials(
+	w http.ResponseWriter,
+	agentState state.AgentState,
+	metricsFactory metrics.EntryFactory,
+	endpointContainerID string,
+	config *v1.Config,
+	credentialsJSON []byte,
+) {
+	config.SignResponse(w, credentialsJSON)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Trailer", StreamErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+	if !writeStreamChunk(w, `{"Credentials":`, credentialsJSON, "\n") {
+		return
+	}
+
+	taskMetadata, err := agentState.GetTaskMetadata(endpointContainerID)
+	if err != nil {
+		logger.Error("Failed to get v4 task metadata to stream with credentials", logger.Fields{
+			field.TMDSEndpointContainerID: endpointContainerID,
+			field.Error:                   err,
+		})
+		responseCode, responseBody := getTaskErrorResponse(endpointContainerID, err)
+		if utils.Is5XXStatus(responseCode) {
+			metricsFactory.New(metrics.InternalServerErrorMetricName).Done(err)()
+		}
+		endStreamWithError(w, &utils.ErrorMessage{
+			Code:          ErrTaskMetadataUnavailable,
+			Message:       responseBody,
+			HTTPErrorCode: responseCode,
+		})
+		return
+	}
+
+	taskMetadataJSON, err := json.Marshal(taskMetadata)
+	if err != nil {
+		logger.Error("Failed to marshal v4 task metadata to stream with credentials", logger.Fields{
+			field.TMDSEndpointContainerID: endpointContainerID,
+			field.Error:                   err,
+		})
+		endStreamWithError(w, &utils.ErrorMessage{
+			Code:          ErrTaskMetadataUnavailable,
+			Message:       "failed to get task metadata",
+			HTTPErrorCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	logger.Info("Writing response for v4 task metadata with credentials", logger.Fields{
+		field.TMDSEndpointContainerID: endpointContainerID,
+		field.TaskARN:                 taskMetadata.TaskARN,
+	})
+	writeStreamChunk(w, `,"TaskMetadata":`, taskMetadataJSON, "}\n")
+}
+
+// withClockSkew adds the clock skew field to the credentials JSON object.
+func withClockSkew(credentialsJSON []byte, skewSeconds float64) []byte {
+	skewJSON, err := json.Marshal(skewSeconds)
+	if err != nil || len(credentialsJSON) < 2 || credentialsJSON[len(credentialsJSON)-1] != '}' {
+		return credentialsJSON
+	}
+	withSkew := make([]byte, 0, len(credentialsJSON)+len(clockSkewField)+len(skewJSON)+4)
+	withSkew = append(withSkew, credentialsJSON[:len(credentialsJSON)-1]...)
+	withSkew = append(withSkew, `,"`+clockSkewField+`":`...)
+	withSkew = append(withSkew, skewJSON...)
+	return append(withSkew, '}')
+}
+
+// writeStreamChunk writes a chunk of a streamed document and flushes it to the client.
+// It returns false if the chunk could not be written.
+func writeStreamChunk(w http.ResponseWriter, prefix string, body []byte, suffix string) bool {
+	chunk := make([]byte, 0, len(prefix)+len(body)+len(suffix))
+	chunk = append(chunk, prefix...)
+	chunk = append(chunk, body...)
+	chunk = append(chunk, suffix...)
+	if _, err := w.Write(chunk); err != nil {
+		logger.Warn("Unable to write streamed response chunk", logger.Fields{field.Error: err})
+		return false
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return true
+}
+
+// endStreamWithError closes the streamed document and reports the error in the
+// StreamErrorTrailer trailer.
+func endStreamWithError(w http.ResponseWriter, errorMessage *utils.ErrorMessage) {
+	errorJSON, err := json.Marshal(errorMessage)
+	if err != nil {
+		errorJSON = []byte(errorMessage.Code)
+	}
+	if _, err := w.Write([]byte("}\n")); err != nil {
+		logger.Warn("Unable to write streamed response chunk", logger.Fields{field.Error: err})
+	}
+	w.Header().Set(StreamErrorTrailer, string(errorJSON))
+}
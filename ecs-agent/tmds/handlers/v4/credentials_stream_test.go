@@ -0,0 +1,353 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package v4
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/credentials"
+	mock_audit "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	mock_metrics "github.com/aws/amazon-ecs-agent/ecs-agent/metrics/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	v1 "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v1"
+	state "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v4/state"
+	mock_state "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/v4/state/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/utils/clockdrift"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const streamCredentialsID = "credsid"
+
+type taskWithCredentialsResponse struct {
+	Credentials  map[string]interface{} `json:"Credentials"`
+	TaskMetadata *state.TaskResponse    `json:"TaskMetadata"`
+}
+
+func setupTaskWithCredentials(t *testing.T, taskCredentialsARN string, options ...v1.ConfigOpt) (
+	*httptest.Server, *gomock.Controller, *mock_state.MockAgentState, *mock_metrics.MockEntryFactory,
+) {
+	ctrl := gomock.NewController(t)
+	agentState := mock_state.NewMockAgentState(ctrl)
+	metricsFactory := mock_metrics.NewMockEntryFactory(ctrl)
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	credentialsManager := credentials.NewManager()
+	require.NoError(t, credentialsManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: taskCredentialsARN,
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID:   streamCredentialsID,
+			RoleArn:         "roleArn",
+			AccessKeyID:     "accessKeyID",
+			SecretAccessKey: "secretAccessKey",
+			SessionToken:    "sessionToken",
+			Expiration:      "expiration",
+			RoleType:        credentials.ApplicationRoleType,
+		},
+	}))
+
+	router := mux.NewRouter()
+	router.HandleFunc(TaskMetadataWithCredentialsPath(),
+		TaskMetadataWithCredentialsHandler(agentState, credentialsManager, auditLogger, metricsFactory, options...))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	t.Cleanup(ctrl.Finish)
+	return server, ctrl, agentState, metricsFactory
+}
+
+func taskWithCredentialsURL(server *httptest.Server, credentialsID string) string {
+	return server.URL + "/v4/" + endpointContainerID + "/taskWithCredentials/" + credentialsID
+}
+
+func TestTaskMetadataWithCredentialsStreamsCredentialsFirst(t *testing.T) {
+	server, _, agentState, _ := setupTaskWithCredentials(t, taskARN)
+
+	// Task metadata is held back until the client has received the credentials
+	credentialsReceived := make(chan struct{})
+	agentState.EXPECT().GetTaskARN(endpointContainerID).Return(taskARN, nil)
+	agentState.EXPECT().GetTaskMetadata(endpointContainerID).DoAndReturn(
+		func(string) (state.TaskResponse, error) {
+			<-credentialsReceived
+			return taskResponse, nil
+		})
+
+	resp, err := http.Get(taskWithCredentialsURL(server, streamCredentialsID))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+
+	reader := bufio.NewReader(resp.Body)
+	firstChunk, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(firstChunk, `{"Credentials":`))
+	assert.Contains(t, firstChunk, `"AccessKeyId":"accessKeyID"`)
+	close(credentialsReceived)
+
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Trailer.Get(StreamErrorTrailer))
+
+	var body taskWithCredentialsResponse
+	require.NoError(t, json.Unmarshal([]byte(firstChunk+string(rest)), &body))
+	assert.Equal(t, "secretAccessKey", body.Credentials["SecretAccessKey"])
+	require.NotNil(t, body.TaskMetadata)
+	assert.Equal(t, taskResponse.TaskARN, body.TaskMetadata.TaskARN)
+	assert.Equal(t, taskResponse.Containers[0].ID, body.TaskMetadata.Containers[0].ID)
+}
+
+func TestTaskMetadataWithCredentialsErrorTrailer(t *testing.T) {
+	readStream := func(t *testing.T, url string) (taskWithCredentialsResponse, utils.ErrorMessage) {
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		var body taskWithCredentialsResponse
+		require.NoError(t, json.Unmarshal(respBody, &body), "document must be closed on failure")
+
+		var trailer utils.ErrorMessage
+		require.NoError(t, json.Unmarshal([]byte(resp.Trailer.Get(StreamErrorTrailer)), &trailer))
+		return body, trailer
+	}
+
+	t.Run("task lookup failed", func(t *testing.T) {
+		server, _, agentState, _ := setupTaskWithCredentials(t, taskARN)
+		agentState.EXPECT().GetTaskARN(endpointContainerID).Return(taskARN, nil)
+		agentState.EXPECT().GetTaskMetadata(endpointContainerID).
+			Return(state.TaskResponse{}, state.NewErrorLookupFailure(externalReason))
+
+		body, trailer := readStream(t, taskWithCredentialsURL(server, streamCredentialsID))
+		assert.Equal(t, "accessKeyID", body.Credentials["AccessKeyId"])
+		assert.Nil(t, body.TaskMetadata)
+		assert.Equal(t, ErrTaskMetadataUnavailable, trailer.Code)
+		assert.Equal(t, http.StatusNotFound, trailer.HTTPErrorCode)
+		assert.Equal(t, "V4 task metadata handler: "+externalReason, trailer.Message)
+	})
+	t.Run("failed to get metadata", func(t *testing.T) {
+		server, ctrl, agentState, metricsFactory := setupTaskWithCredentials(t, taskARN)
+		err := state.NewErrorMetadataFetchFailure(externalReason)
+		entry := mock_metrics.NewMockEntry(ctrl)
+		entry.EXPECT().Done(err).Return(func() {})
+		metricsFactory.EXPECT().New(metrics.InternalServerErrorMetricName).Return(entry)
+		agentState.EXPECT().GetTaskARN(endpointContainerID).Return(taskARN, nil)
+		agentState.EXPECT().GetTaskMetadata(endpointContainerID).Return(state.TaskResponse{}, err)
+
+		body, trailer := readStream(t, taskWithCredentialsURL(server, streamCredentialsID))
+		assert.NotNil(t, body.Credentials)
+		assert.Nil(t, body.TaskMetadata)
+		assert.Equal(t, ErrTaskMetadataUnavailable, trailer.Code)
+		assert.Equal(t, http.StatusInternalServerError, trailer.HTTPErrorCode)
+	})
+}
+
+// Tests that nothing is streamed if the task of the endpoint container can't be looked up
+// or isn't the task of the credentials.
+func TestTaskMetadataWithCredentialsTaskErrors(t *testing.T) {
+	readError := func(t *testing.T, url string) (int, utils.ErrorMessage) {
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var errorMessage utils.ErrorMessage
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorMessage))
+		assert.Empty(t, resp.Trailer.Get(StreamErrorTrailer))
+		return resp.StatusCode, errorMessage
+	}
+
+	t.Run("task lookup failed", func(t *testing.T) {
+		server, _, agentState, _ := setupTaskWithCredentials(t, taskARN)
+		agentState.EXPECT().GetTaskARN(endpointContainerID).Return("", state.NewErrorLookupFailure(externalReason))
+
+		statusCode, errorMessage := readError(t, taskWithCredentialsURL(server, streamCredentialsID))
+		assert.Equal(t, http.StatusNotFound, statusCode)
+		assert.Equal(t, ErrTaskMetadataUnavailable, errorMessage.Code)
+		assert.Equal(t, "V4 task metadata handler: "+externalReason, errorMessage.Message)
+	})
+	t.Run("credentials of another task", func(t *testing.T) {
+		server, _, agentState, _ := setupTaskWithCredentials(t, "otherTaskARN")
+		agentState.EXPECT().GetTaskARN(endpointContainerID).Return(taskARN, nil)
+
+		statusCode, errorMessage := readError(t, taskWithCredentialsURL(server, streamCredentialsID))
+		assert.Equal(t, http.StatusBadRequest, statusCode)
+		assert.Equal(t, ErrCredentialsTaskMismatch, errorMessage.Code)
+	})
+}
+
+// Tests that the handler applies the options of the credentials handlers.
+func TestTaskMetadataWithCredentialsHandlerOptions(t *testing.T) {
+	t.Run("maintenance", func(t *testing.T) {
+		toggle := v1.NewMaintenanceToggle()
+		toggle.Pause()
+		server, _, _, _ := setupTaskWithCredentials(t, taskARN, v1.WithMaintenanceToggle(toggle))
+
+		// The task isn't looked up while credential serving is paused
+		resp, err := http.Get(taskWithCredentialsURL(server, streamCredentialsID))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+	t.Run("signing", func(t *testing.T) {
+		signer, err := v1.NewResponseSigner()
+		require.NoError(t, err)
+		server, _, agentState, _ := setupTaskWithCredentials(t, taskARN, v1.WithResponseSigner(signer))
+		agentState.EXPECT().GetTaskARN(endpointContainerID).Return(taskARN, nil)
+		agentState.EXPECT().GetTaskMetadata(endpointContainerID).Return(taskResponse, nil)
+
+		resp, err := http.Get(taskWithCredentialsURL(server, streamCredentialsID))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var body struct {
+			Credentials json.RawMessage `json:"Credentials"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.True(t, signer.Verify(body.Credentials, resp.Header.Get(v1.CredentialsSignatureHeader)))
+	})
+	t.Run("observers", func(t *testing.T) {
+		observer := &recordingObserver{}
+		server, _, agentState, _ := setupTaskWithCredentials(t, taskARN, v1.WithRequestObserver(observer))
+		agentState.EXPECT().GetTaskARN(endpointContainerID).Return("otherTaskARN", nil)
+
+		resp, err := http.Get(taskWithCredentialsURL(server, streamCredentialsID))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Len(t, observer.observations, 1)
+		assert.Equal(t, credentialsStreamAPIVersion, observer.observations[0].APIVersion)
+		assert.Equal(t, http.StatusBadRequest, observer.observations[0].StatusCode)
+		assert.Equal(t, ErrCredentialsTaskMismatch, observer.observations[0].ErrorCode)
+	})
+}
+
+type recordingObserver struct {
+	observations []v1.RequestObservation
+}
+
+func (o *recordingObserver) ObserveRequest(observation v1.RequestObservation) {
+	o.observations = append(o.observations, observation)
+}
+
+func TestTaskMetadataWithCredentialsUnknownCredentials(t *testing.T) {
+	server, _, _, _ := setupTaskWithCredentials(t, taskARN)
+
+	resp, err := http.Get(taskWithCredentialsURL(server, "unknown"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Nothing has been streamed yet, so the error is reported with the status code
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var errorMessage utils.ErrorMessage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorMessage))
+	assert.Equal(t, "InvalidIdInRequest", errorMessage.Code)
+	assert.Empty(t, resp.Trailer.Get(StreamErrorTrailer))
+}
+
+func TestTaskMetadataWithCredentialsReconciliationGate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	agentState := mock_state.NewMockAgentState(ctrl)
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	credentialsManager := credentials.NewManager()
+	require.NoError(t, credentialsManager.SetTaskCredentials(&credentials.TaskIAMRoleCredentials{
+		ARN: taskARN,
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			CredentialsID: streamCredentialsID,
+			AccessKeyID:   "accessKeyID",
+			RoleType:      credentials.ApplicationRoleType,
+		},
+	}))
+
+	gate := v1.NewReconciliationGate(5 * time.Second)
+	router := mux.NewRouter()
+	router.HandleFunc(TaskMetadataWithCredentialsPath(),
+		TaskMetadataWithCredentialsHandler(agentState, credentialsManager, auditLogger,
+			mock_metrics.NewMockEntryFactory(ctrl), v1.WithReconciliationGate(gate)))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Nothing is streamed before reconciliation, and task metadata is not looked up
+	resp, err := http.Get(taskWithCredentialsURL(server, streamCredentialsID))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get(v1.RetryAfterHeader))
+	var errorMessage utils.ErrorMessage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorMessage))
+	assert.Equal(t, v1.ErrStateReconciling, errorMessage.Code)
+
+	gate.MarkReconciled()
+	agentState.EXPECT().GetTaskARN(endpointContainerID).Return(taskARN, nil)
+	agentState.EXPECT().GetTaskMetadata(endpointContainerID).Return(taskResponse, nil)
+	resp, err = http.Get(taskWithCredentialsURL(server, streamCredentialsID))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var body taskWithCredentialsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "accessKeyID", body.Credentials["AccessKeyId"])
+	require.NotNil(t, body.TaskMetadata)
+}
+
+type fakeClockSkewEstimator struct {
+	estimate *clockdrift.Estimate
+}
+
+func (f *fakeClockSkewEstimator) Estimate() (clockdrift.Estimate, bool) {
+	if f.estimate == nil {
+		return clockdrift.Estimate{}, false
+	}
+	return *f.estimate, true
+}
+
+func TestTaskMetadataWithCredentialsClockSkew(t *testing.T) {
+	estimator := &fakeClockSkewEstimator{}
+	server, _, agentState, _ := setupTaskWithCredentials(t, taskARN, v1.WithClockSkewEstimator(estimator))
+	agentState.EXPECT().GetTaskARN(endpointContainerID).Return(taskARN, nil).Times(2)
+	agentState.EXPECT().GetTaskMetadata(endpointContainerID).Return(taskResponse, nil).Times(2)
+
+	getCredentials := func() map[string]interface{} {
+		resp, err := http.Get(taskWithCredentialsURL(server, streamCredentialsID))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body taskWithCredentialsResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.NotNil(t, body.TaskMetadata)
+		return body.Credentials
+	}
+
+	// The skew is left out until it has been estimated
+	credentials := getCredentials()
+	assert.NotContains(t, credentials, clockSkewField)
+
+	estimator.estimate = &clockdrift.Estimate{SkewSeconds: -42.5, Source: clockdrift.SourceDateHeader}
+	credentials = getCredentials()
+	assert.Equal(t, -42.5, credentials[clockSkewField])
+	assert.Equal(t, "expiration", credentials["Expiration"])
+	assert.Equal(t, "accessKeyID", credentials["AccessKeyId"])
+}
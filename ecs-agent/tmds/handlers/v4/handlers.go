@@ -32,6 +32,10 @@ const (
 	version                    = "v4"
 )
 
+// IncludeTagsQueryParameter is the query parameter of task metadata requests whose response
+// includes the task and container instance tags when it's "true".
+const IncludeTagsQueryParameter = "includeTags"
+
 // ContainerMetadataPath specifies the relative URI path for serving container metadata.
 func ContainerMetadataPath() string {
 	return "/v4/" + utils.ConstructMuxVar(EndpointContainerIDMuxName, utils.AnythingButSlashRegEx)
@@ -102,6 +106,8 @@ func getContainerErrorResponse(endpointContainerID string, err error) (int, stri
 }
 
 // TaskMetadataHandler returns the HTTP handler function for handling task metadata requests.
+// The task and container instance tags are included in the response of requests with the
+// includeTags=true query parameter.
 func TaskMetadataHandler(
 	agentState state.AgentState,
 	metricsFactory metrics.EntryFactory,
@@ -126,7 +132,7 @@ func taskMetadataHandler(
 		endpointContainerID := mux.Vars(r)[EndpointContainerIDMuxName]
 		var taskMetadata state.TaskResponse
 		var err error
-		if includeTags {
+		if includeTags || r.URL.Query().Get(IncludeTagsQueryParameter) == "true" {
 			taskMetadata, err = agentState.GetTaskMetadataWithTags(endpointContainerID)
 		} else {
 			taskMetadata, err = agentState.GetTaskMetadata(endpointContainerID)
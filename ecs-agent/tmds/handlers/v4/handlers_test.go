@@ -248,6 +248,33 @@ func TestTaskMetadata(t *testing.T) {
 			expectedResponseBody: taskResponse,
 		})
 	})
+	t.Run("includeTags query parameter", func(t *testing.T) {
+		handler, _, agentState, _ := setup(t)
+		taskResponseWithTags := taskResponse
+		taskResponseWithTags.TaskResponse = &v2.TaskResponse{
+			TaskARN:  taskARN,
+			TaskTags: map[string]string{"team": "metadata"},
+		}
+		agentState.EXPECT().
+			GetTaskMetadataWithTags(endpointContainerID).
+			Return(taskResponseWithTags, nil)
+		testTMDSRequest(t, handler, TMDSTestCase[state.TaskResponse]{
+			path:                 path + "?includeTags=true",
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: taskResponseWithTags,
+		})
+	})
+	t.Run("includeTags query parameter not true", func(t *testing.T) {
+		handler, _, agentState, _ := setup(t)
+		agentState.EXPECT().
+			GetTaskMetadata(endpointContainerID).
+			Return(taskResponse, nil)
+		testTMDSRequest(t, handler, TMDSTestCase[state.TaskResponse]{
+			path:                 path + "?includeTags=false",
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: taskResponse,
+		})
+	})
 	t.Run("task lookup failure", func(t *testing.T) {
 		handler, _, agentState, _ := setup(t)
 		agentState.EXPECT().
@@ -63,6 +63,21 @@ func (mr *MockAgentStateMockRecorder) GetContainerMetadata(arg0 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContainerMetadata", reflect.TypeOf((*MockAgentState)(nil).GetContainerMetadata), arg0)
 }
 
+// GetTaskARN mocks base method.
+func (m *MockAgentState) GetTaskARN(arg0 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTaskARN", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTaskARN indicates an expected call of GetTaskARN.
+func (mr *MockAgentStateMockRecorder) GetTaskARN(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskARN", reflect.TypeOf((*MockAgentState)(nil).GetTaskARN), arg0)
+}
+
 // GetTaskMetadata mocks base method.
 func (m *MockAgentState) GetTaskMetadata(arg0 string) (state.TaskResponse, error) {
 	m.ctrl.T.Helper()
@@ -33,6 +33,19 @@ type TaskResponse struct {
 	ServiceName             string                   `json:"ServiceName,omitempty"`
 	ClockDrift              *ClockDrift              `json:"ClockDrift,omitempty"`
 	EphemeralStorageMetrics *EphemeralStorageMetrics `json:"EphemeralStorageMetrics,omitempty"`
+	CredentialSpec          *CredentialSpecStatus    `json:"CredentialSpec,omitempty"`
+	Warnings                []string                 `json:"Warnings,omitempty"`
+}
+
+// CredentialSpecStatus is the fetch and renewal status of the credential specs (gMSA)
+// of the task. Locations are where the credential specs are fetched from; the
+// contents of the credential specs are never included.
+type CredentialSpecStatus struct {
+	State          string     `json:"State"`
+	Reason         string     `json:"Reason,omitempty"`
+	Locations      []string   `json:"Locations,omitempty"`
+	UpdatedAt      *time.Time `json:"UpdatedAt,omitempty"`
+	RenewalWarning bool       `json:"RenewalWarning,omitempty"`
 }
 
 // Instance's clock drift status
@@ -54,6 +67,12 @@ type EphemeralStorageMetrics struct {
 type ContainerResponse struct {
 	*v2.ContainerResponse
 	Networks []Network `json:"Networks,omitempty"`
+	// ImagePullMechanism is how the container image was pulled, one of full, lazy or fallback.
+	ImagePullMechanism string `json:"ImagePullMechanism,omitempty"`
+	// OutputCaptureFile is the path on the host of the file that the output of the
+	// container is captured to, if the container has no log driver and the agent captures
+	// its output.
+	OutputCaptureFile string `json:"OutputCaptureFile,omitempty"`
 }
 
 // Network is the v4 Network response. It adds a bunch of information about network
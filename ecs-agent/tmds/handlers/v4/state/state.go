@@ -68,4 +68,9 @@ type AgentState interface {
 	// Returns ErrorTaskLookupFailed if task lookup fails.
 	// Returns ErrorMetadataFetchFailure if something else goes wrong.
 	GetTaskMetadataWithTags(endpointContainerID string) (TaskResponse, error)
+
+	// Returns the ARN of the task identified by the provided endpointContainerID, without
+	// the cost of building its metadata.
+	// Returns ErrorTaskLookupFailed if task lookup fails.
+	GetTaskARN(endpointContainerID string) (string, error)
 }
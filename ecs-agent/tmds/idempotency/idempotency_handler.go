@@ -0,0 +1,299 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package idempotency dedupes retries of requests with side effects, such as requests
+// that trigger a credentials refresh, using the Idempotency-Key request header.
+package idempotency
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const (
+	// KeyHeader is the request header with the client chosen key that identifies retries
+	// of the same request.
+	KeyHeader = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on responses that are replayed for a retried
+	// request instead of being handled again.
+	ReplayedHeader = "Idempotent-Replayed"
+	// DefaultMaxEntries is the default number of responses that are kept for replay.
+	DefaultMaxEntries = 1024
+)
+
+// CallerFunc identifies the caller of a request, such as the task that the source IP
+// of the request belongs to.
+type CallerFunc func(r *http.Request) (string, error)
+
+// Handler wraps a handler of requests with side effects. The first request with an
+// Idempotency-Key is handled, and the response is replayed for requests from the same
+// caller with the same method, path, body and key until the TTL expires. Requests that are handled while an
+// earlier request with the same key is in flight wait for its response.
+//
+// Requests without an Idempotency-Key and read-only requests (GET, HEAD and OPTIONS)
+// are always handled. Server error responses aren't replayed, so that the request can
+// be retried with the same key. At most maxEntries responses are kept, and the least
+// recently used response is forgotten to make room for a new one.
+type Handler struct {
+	h          http.Handler
+	ttl        time.Duration
+	maxEntries int
+	caller     CallerFunc
+	now        func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]*entry
+	// lru orders the keys of the entries from the most to the least recently used
+	lru *list.List
+}
+
+// Opt configures a Handler.
+type Opt func(*Handler)
+
+// WithCaller sets the func that identifies the caller of a request. By default, the
+// caller is identified by the source IP of the request.
+func WithCaller(caller CallerFunc) Opt {
+	return func(ih *Handler) {
+		ih.caller = caller
+	}
+}
+
+// WithMaxEntries sets the number of responses that are kept for replay.
+func WithMaxEntries(maxEntries int) Opt {
+	return func(ih *Handler) {
+		ih.maxEntries = maxEntries
+	}
+}
+
+// entry is the response to the first request with a key. done is closed once the
+// response has been recorded.
+type entry struct {
+	done      chan struct{}
+	expiresAt time.Time
+	element   *list.Element
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+// NewHandler creates a new Handler that replays responses for ttl.
+func NewHandler(handler http.Handler, ttl time.Duration, opts ...Opt) *Handler {
+	ih := &Handler{
+		h:          handler,
+		ttl:        ttl,
+		maxEntries: DefaultMaxEntries,
+		caller:     sourceIP,
+		now:        time.Now,
+		entries:    make(map[string]*entry),
+		lru:        list.New(),
+	}
+	for _, opt := range opts {
+		opt(ih)
+	}
+	return ih
+}
+
+// ServeHTTP handles the request, or replays the response to an earlier request with
+// the same Idempotency-Key.
+func (ih *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(KeyHeader)
+	if key == "" || isReadOnly(r.Method) {
+		ih.h.ServeHTTP(w, r)
+		return
+	}
+	key, err := ih.requestKey(r, key)
+	if err != nil {
+		// Without a key that is scoped to the caller, the response can't be replayed
+		// safely, so the request is handled.
+		logger.Warn("Unable to identify request for replay", logger.Fields{
+			"method":    r.Method,
+			"path":      r.URL.Path,
+			field.Error: err,
+		})
+		ih.h.ServeHTTP(w, r)
+		return
+	}
+
+	for {
+		ih.lock.Lock()
+		ih.removeExpiredUnsafe()
+		existing, ok := ih.entries[key]
+		if !ok {
+			current := &entry{done: make(chan struct{})}
+			ih.addUnsafe(key, current)
+			ih.lock.Unlock()
+			ih.handle(w, r, key, current)
+			return
+		}
+		ih.lru.MoveToFront(existing.element)
+		ih.lock.Unlock()
+
+		select {
+		case <-existing.done:
+		case <-r.Context().Done():
+			return
+		}
+		if existing.status != 0 {
+			logger.Debug("Replaying response for retried request", logger.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+			})
+			replay(w, existing)
+			return
+		}
+		// The earlier request failed and was forgotten, so the request is handled afresh
+	}
+}
+
+// handle handles the first request with a key, and records the response for retries.
+func (ih *Handler) handle(w http.ResponseWriter, r *http.Request, key string, current *entry) {
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	completed := false
+	defer func() {
+		ih.lock.Lock()
+		defer ih.lock.Unlock()
+		// A handler that panicked may have written a partial response
+		if !completed || recorder.status >= http.StatusInternalServerError {
+			ih.removeUnsafe(key, current)
+		} else {
+			current.status = recorder.status
+			current.header = w.Header().Clone()
+			current.body = recorder.body.Bytes()
+			current.expiresAt = ih.now().Add(ih.ttl)
+		}
+		close(current.done)
+	}()
+	ih.h.ServeHTTP(recorder, r)
+	completed = true
+}
+
+// requestKey scopes the Idempotency-Key of a request to its caller, method, path and
+// body, so that a key can't be used to replay the response to another request. The
+// body is read to be hashed, and is restored for the handler.
+func (ih *Handler) requestKey(r *http.Request, idempotencyKey string) (string, error) {
+	caller, err := ih.caller(r)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.New()
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		digest.Write(body)
+	}
+	return caller + " " + r.Method + " " + r.URL.Path + " " + hex.EncodeToString(digest.Sum(nil)) +
+		" " + idempotencyKey, nil
+}
+
+// addUnsafe adds the entry of a key as the most recently used, and forgets the least
+// recently used responses once there are more than maxEntries. Requests in flight
+// are kept.
+func (ih *Handler) addUnsafe(key string, current *entry) {
+	current.element = ih.lru.PushFront(key)
+	ih.entries[key] = current
+	for element := ih.lru.Back(); element != nil && len(ih.entries) > ih.maxEntries; {
+		previous := element.Prev()
+		evicted := element.Value.(string)
+		if existing := ih.entries[evicted]; existing.status != 0 {
+			ih.removeUnsafe(evicted, existing)
+		}
+		element = previous
+	}
+}
+
+// removeUnsafe forgets the entry of a key, unless it was already replaced.
+func (ih *Handler) removeUnsafe(key string, existing *entry) {
+	if ih.entries[key] != existing {
+		return
+	}
+	delete(ih.entries, key)
+	ih.lru.Remove(existing.element)
+}
+
+// removeExpiredUnsafe forgets the responses whose TTL has expired. Requests in flight
+// are kept.
+func (ih *Handler) removeExpiredUnsafe() {
+	now := ih.now()
+	for key, existing := range ih.entries {
+		if existing.status != 0 && !now.Before(existing.expiresAt) {
+			ih.removeUnsafe(key, existing)
+		}
+	}
+}
+
+// sourceIP identifies the caller of a request by its source IP.
+func sourceIP(r *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+	return host, nil
+}
+
+func replay(w http.ResponseWriter, recorded *entry) {
+	for name, values := range recorded.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(recorded.status)
+	if _, err := w.Write(recorded.body); err != nil {
+		logger.Warn("Unable to write replayed response", logger.Fields{
+			field.Error: err,
+		})
+	}
+}
+
+func isReadOnly(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// responseRecorder writes a response through while recording it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
@@ -0,0 +1,244 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package idempotency
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const refreshPath = "/v2/credentials/credsid/refresh"
+
+// refreshHandler counts the refreshes it is asked for and responds with the count.
+type refreshHandler struct {
+	lock      sync.Mutex
+	refreshes int
+	status    int
+	release   chan struct{}
+}
+
+func (h *refreshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.release != nil {
+		<-h.release
+	}
+	h.lock.Lock()
+	h.refreshes++
+	refreshes := h.refreshes
+	h.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+	}
+	fmt.Fprintf(w, `{"Refresh":%d}`, refreshes)
+}
+
+func (h *refreshHandler) count() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.refreshes
+}
+
+func newRequest(method, path, key string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	if key != "" {
+		req.Header.Set(KeyHeader, key)
+	}
+	return req
+}
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestFirstRequestIsHandled(t *testing.T) {
+	underlying := &refreshHandler{}
+	handler := NewHandler(underlying, time.Minute)
+
+	res := serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `{"Refresh":1}`, res.Body.String())
+	assert.Empty(t, res.Header().Get(ReplayedHeader))
+	assert.Equal(t, 1, underlying.count())
+}
+
+func TestRetriedRequestIsReplayed(t *testing.T) {
+	underlying := &refreshHandler{status: http.StatusAccepted}
+	handler := NewHandler(underlying, time.Minute)
+
+	first := serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	retried := serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	assert.Equal(t, 1, underlying.count(), "the retry must not trigger another refresh")
+	assert.Equal(t, http.StatusAccepted, retried.Code)
+	assert.Equal(t, first.Body.String(), retried.Body.String())
+	assert.Equal(t, "application/json", retried.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retried.Header().Get(ReplayedHeader))
+
+	// The same key for another path is a different request
+	serve(handler, newRequest(http.MethodPost, "/v2/credentials/othercredsid/refresh", "key1"))
+	assert.Equal(t, 2, underlying.count())
+}
+
+func TestDifferentKeyIsHandled(t *testing.T) {
+	underlying := &refreshHandler{}
+	handler := NewHandler(underlying, time.Minute)
+
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	res := serve(handler, newRequest(http.MethodPost, refreshPath, "key2"))
+	assert.Equal(t, `{"Refresh":2}`, res.Body.String())
+	assert.Empty(t, res.Header().Get(ReplayedHeader))
+	assert.Equal(t, 2, underlying.count())
+}
+
+func TestRequestsWithoutKeyOrReadOnlyAreHandled(t *testing.T) {
+	underlying := &refreshHandler{}
+	handler := NewHandler(underlying, time.Minute)
+
+	serve(handler, newRequest(http.MethodPost, refreshPath, ""))
+	serve(handler, newRequest(http.MethodPost, refreshPath, ""))
+	serve(handler, newRequest(http.MethodGet, refreshPath, "key1"))
+	serve(handler, newRequest(http.MethodGet, refreshPath, "key1"))
+	assert.Equal(t, 4, underlying.count())
+}
+
+func TestReplayExpiresAfterTTL(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	underlying := &refreshHandler{}
+	handler := NewHandler(underlying, time.Minute)
+	handler.now = func() time.Time { return now }
+
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	now = now.Add(59 * time.Second)
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	assert.Equal(t, 1, underlying.count())
+
+	now = now.Add(time.Second)
+	res := serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	assert.Equal(t, `{"Refresh":2}`, res.Body.String())
+	assert.Len(t, handler.entries, 1, "the expired response is forgotten")
+}
+
+func TestServerErrorsAreNotReplayed(t *testing.T) {
+	underlying := &refreshHandler{status: http.StatusInternalServerError}
+	handler := NewHandler(underlying, time.Minute)
+
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	underlying.status = http.StatusOK
+	res := serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 2, underlying.count())
+}
+
+func TestConcurrentRetryWaitsForFirstRequest(t *testing.T) {
+	underlying := &refreshHandler{release: make(chan struct{})}
+	handler := NewHandler(underlying, time.Minute)
+
+	responses := make([]*httptest.ResponseRecorder, 3)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+		}(i)
+	}
+	close(underlying.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, underlying.count())
+	for _, res := range responses {
+		assert.Equal(t, `{"Refresh":1}`, res.Body.String())
+	}
+}
+
+func TestKeyIsScopedToCallerAndBody(t *testing.T) {
+	underlying := &refreshHandler{}
+	handler := NewHandler(underlying, time.Minute)
+
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	// The same key from another caller is a different request
+	other := newRequest(http.MethodPost, refreshPath, "key1")
+	other.RemoteAddr = "192.0.2.2:1234"
+	res := serve(handler, other)
+	assert.Empty(t, res.Header().Get(ReplayedHeader))
+	assert.Equal(t, 2, underlying.count())
+
+	// The same key with another body is a different request
+	withBody := httptest.NewRequest(http.MethodPost, refreshPath, strings.NewReader(`{"force":true}`))
+	withBody.Header.Set(KeyHeader, "key1")
+	serve(handler, withBody)
+	assert.Equal(t, 3, underlying.count())
+	withBody = httptest.NewRequest(http.MethodPost, refreshPath, strings.NewReader(`{"force":true}`))
+	withBody.Header.Set(KeyHeader, "key1")
+	res = serve(handler, withBody)
+	assert.Equal(t, "true", res.Header().Get(ReplayedHeader))
+	assert.Equal(t, 3, underlying.count())
+}
+
+func TestCallerFromOption(t *testing.T) {
+	underlying := &refreshHandler{}
+	handler := NewHandler(underlying, time.Minute, WithCaller(func(r *http.Request) (string, error) {
+		if r.RemoteAddr == "192.0.2.2:1234" {
+			return "", errors.New("no task for the source IP")
+		}
+		return "taskARN", nil
+	}))
+
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	assert.Equal(t, 1, underlying.count())
+
+	// Requests whose caller is unknown are always handled
+	unknown := newRequest(http.MethodPost, refreshPath, "key1")
+	unknown.RemoteAddr = "192.0.2.2:1234"
+	serve(handler, unknown)
+	unknown = newRequest(http.MethodPost, refreshPath, "key1")
+	unknown.RemoteAddr = "192.0.2.2:1234"
+	res := serve(handler, unknown)
+	assert.Empty(t, res.Header().Get(ReplayedHeader))
+	assert.Equal(t, 3, underlying.count())
+	assert.Len(t, handler.entries, 1)
+}
+
+func TestLeastRecentlyUsedResponseIsEvicted(t *testing.T) {
+	underlying := &refreshHandler{}
+	handler := NewHandler(underlying, time.Minute, WithMaxEntries(2))
+
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key2"))
+	// Replaying key1 makes key2 the least recently used response
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	serve(handler, newRequest(http.MethodPost, refreshPath, "key3"))
+	assert.Equal(t, 3, underlying.count())
+	assert.Len(t, handler.entries, 2)
+
+	res := serve(handler, newRequest(http.MethodPost, refreshPath, "key1"))
+	assert.Equal(t, "true", res.Header().Get(ReplayedHeader))
+	res = serve(handler, newRequest(http.MethodPost, refreshPath, "key2"))
+	assert.Empty(t, res.Header().Get(ReplayedHeader), "the evicted response is handled again")
+	assert.Equal(t, 4, underlying.count())
+	assert.Equal(t, handler.lru.Len(), len(handler.entries))
+}
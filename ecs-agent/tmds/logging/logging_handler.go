@@ -15,10 +15,18 @@ package logging
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
 )
 
+const (
+	// LogLevelHeader is the header of requests that raises the log level for the request.
+	LogLevelHeader = "X-Amzn-Log-Level"
+	// logLevelHeaderDebug is the only level that requests can be raised to.
+	logLevelHeaderDebug = "debug"
+)
+
 // LoggingHandler is used to log all requests for an endpoint.
 type LoggingHandler struct{ h http.Handler }
 
@@ -29,9 +37,27 @@ func NewLoggingHandler(handler http.Handler) LoggingHandler {
 
 // ServeHTTP logs the method and remote address of the request.
 func (lh LoggingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("Handling http request", logger.Fields{
+	logger.DebugContext(r.Context(), "Handling http request", logger.Fields{
 		"method": r.Method,
 		"from":   r.RemoteAddr,
 	})
 	lh.h.ServeHTTP(w, r)
 }
+
+// NewLogLevelHeaderHandler creates a handler that raises the log level to debug for the
+// requests with a LogLevelHeader header set to debug, whatever the global log level is.
+// Messages logged with logger.DebugContext and the request context are written for those
+// requests. Other values of the header are ignored.
+func NewLogLevelHeaderHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(strings.TrimSpace(r.Header.Get(LogLevelHeader)), logLevelHeaderDebug) {
+			logger.Info("Raising the log level to debug for http request", logger.Fields{
+				"method": r.Method,
+				"from":   r.RemoteAddr,
+				"path":   r.URL.Path,
+			})
+			r = r.WithContext(logger.ContextWithDebugLevel(r.Context()))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
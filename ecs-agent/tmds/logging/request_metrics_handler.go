@@ -0,0 +1,168 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	"github.com/gorilla/mux"
+)
+
+// UnknownRoute is the route name used for requests that do not match any route.
+const UnknownRoute = "unknown"
+
+// TraceIDExemplarLabel is the label of the exemplars of request latencies that holds the
+// ID of the trace of the request.
+const TraceIDExemplarLabel = "trace_id"
+
+// RouteNameFunc returns a name for the route that the request is routed to. Route names
+// are used as metric labels and must not contain request specific values such as
+// credential IDs or task ARNs.
+type RouteNameFunc func(r *http.Request) string
+
+// MuxRouteName returns a RouteNameFunc for the routes of the router. The name of the
+// route is used if it has one, its path template otherwise.
+func MuxRouteName(router *mux.Router) RouteNameFunc {
+	return func(r *http.Request) string {
+		var match mux.RouteMatch
+		if !router.Match(r, &match) || match.Route == nil {
+			return UnknownRoute
+		}
+		if name := match.Route.GetName(); name != "" {
+			return name
+		}
+		if template, err := match.Route.GetPathTemplate(); err == nil {
+			return template
+		}
+		return UnknownRoute
+	}
+}
+
+// ServeMuxRouteName returns a RouteNameFunc for the patterns registered with the
+// serve mux.
+func ServeMuxRouteName(serveMux *http.ServeMux) RouteNameFunc {
+	return func(r *http.Request) string {
+		if _, pattern := serveMux.Handler(r); pattern != "" {
+			return pattern
+		}
+		return UnknownRoute
+	}
+}
+
+// RequestMetricsHandler is used to record the latency of requests to an endpoint per route
+// and to log requests that are slower than a threshold.
+type RequestMetricsHandler struct {
+	h                    http.Handler
+	routeName            RouteNameFunc
+	metricsFactory       metrics.EntryFactory
+	metricName           string
+	slowRequestThreshold time.Duration
+	streamingRoutes      map[string]struct{}
+}
+
+// NewRequestMetricsHandler creates a new RequestMetricsHandler object. Request latencies are
+// recorded under metricName with the route, method and status code as fields. Requests that
+// take at least slowRequestThreshold are logged, slow request logging is disabled if the
+// threshold is not positive.
+func NewRequestMetricsHandler(
+	handler http.Handler,
+	routeName RouteNameFunc,
+	metricsFactory metrics.EntryFactory,
+	metricName string,
+	slowRequestThreshold time.Duration,
+) RequestMetricsHandler {
+	return RequestMetricsHandler{
+		h:                    handler,
+		routeName:            routeName,
+		metricsFactory:       metricsFactory,
+		metricName:           metricName,
+		slowRequestThreshold: slowRequestThreshold,
+	}
+}
+
+// WithStreamingRoutes returns a copy of the handler that doesn't log the requests of the
+// routes as slow requests. Streaming routes are expected to outlast any threshold.
+func (rh RequestMetricsHandler) WithStreamingRoutes(routes ...string) RequestMetricsHandler {
+	rh.streamingRoutes = make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		rh.streamingRoutes[route] = struct{}{}
+	}
+	return rh
+}
+
+// ServeHTTP records the latency of the request once the underlying handler returns.
+func (rh RequestMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := rh.routeName(r)
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	// The entry is timed from its creation until it is done
+	entry := rh.metricsFactory.New(rh.metricName)
+	start := time.Now()
+	rh.h.ServeHTTP(recorder, r)
+	duration := time.Since(start)
+
+	// Requests with a span context are linked to their trace, if the entry supports it
+	if spanContext, ok := audit.SpanContextFromContext(r.Context()); ok {
+		if exemplarEntry, ok := entry.(metrics.ExemplarEntry); ok {
+			entry = exemplarEntry.WithExemplar(map[string]string{TraceIDExemplarLabel: spanContext.TraceID})
+		}
+	}
+	entry.WithFields(map[string]interface{}{
+		"route":  route,
+		"method": r.Method,
+		"status": recorder.status,
+	}).Done(nil)()
+
+	if _, streaming := rh.streamingRoutes[route]; streaming {
+		return
+	}
+	if rh.slowRequestThreshold > 0 && duration >= rh.slowRequestThreshold {
+		logger.Warn("Slow http request", logger.Fields{
+			"method":   r.Method,
+			"route":    route,
+			"status":   recorder.status,
+			"duration": duration.String(),
+		})
+	}
+}
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush responses through the recorder.
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,229 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package logging
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	mock_metrics "github.com/aws/amazon-ecs-agent/ecs-agent/metrics/mocks"
+	"github.com/cihub/seelog"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMetricName = "Test.RequestLatency"
+
+// Tests that request latencies are recorded with the mux route name or path template
+// instead of the raw request path.
+func TestRequestMetricsHandlerMuxRouteNames(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}).Name("v2/credentials")
+	router.HandleFunc("/v4/{id}/task", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tc := range []struct {
+		name           string
+		path           string
+		expectedRoute  string
+		expectedStatus int
+	}{
+		{
+			name:           "named route",
+			path:           "/v2/credentials/6a2c1b8e-credentials-id",
+			expectedRoute:  "v2/credentials",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unnamed route",
+			path:           "/v4/8b7f9fa8aa6d4b6c8c46c6e9a45dd1f5-1234567890/task",
+			expectedRoute:  "/v4/{id}/task",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no matching route",
+			path:           "/v1/secret-path",
+			expectedRoute:  UnknownRoute,
+			expectedStatus: http.StatusNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			metricsFactory := mock_metrics.NewMockEntryFactory(ctrl)
+			entry := mock_metrics.NewMockEntry(ctrl)
+			gomock.InOrder(
+				metricsFactory.EXPECT().New(testMetricName).Return(entry),
+				entry.EXPECT().WithFields(map[string]interface{}{
+					"route":  tc.expectedRoute,
+					"method": "GET",
+					"status": tc.expectedStatus,
+				}).Return(entry),
+				entry.EXPECT().Done(nil).Return(func() {}),
+			)
+
+			handler := NewRequestMetricsHandler(router, MuxRouteName(router), metricsFactory,
+				testMetricName, 0)
+			req, err := http.NewRequest("GET", tc.path, nil)
+			require.NoError(t, err)
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			assert.Equal(t, tc.expectedStatus, res.Code)
+		})
+	}
+}
+
+// Tests that request latencies are recorded with the registered serve mux patterns.
+func TestServeMuxRouteName(t *testing.T) {
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/v1/tasks", func(w http.ResponseWriter, r *http.Request) {})
+	serveMux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) {})
+	routeName := ServeMuxRouteName(serveMux)
+
+	for path, expectedRoute := range map[string]string{
+		"/v1/tasks?taskarn=arn:aws:ecs:us-west-2:123456789012:task/abc": "/v1/tasks",
+		"/debug/pprof/heap": "/debug/pprof/",
+		"/unregistered":     UnknownRoute,
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expectedRoute, routeName(req), path)
+	}
+}
+
+// Tests that the entry of a request is created before the underlying handler is called and
+// done after it returns, and that slow requests are served normally.
+func TestRequestMetricsHandlerSlowRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	metricsFactory := mock_metrics.NewMockEntryFactory(ctrl)
+	entry := mock_metrics.NewMockEntry(ctrl)
+	delay := 10 * time.Millisecond
+	var created time.Time
+	metricsFactory.EXPECT().New(testMetricName).DoAndReturn(func(string) *mock_metrics.MockEntry {
+		created = time.Now()
+		return entry
+	})
+	entry.EXPECT().WithFields(gomock.Any()).Return(entry)
+	entry.EXPECT().Done(nil).DoAndReturn(func(error) func() {
+		assert.GreaterOrEqual(t, time.Since(created), delay)
+		return func() {}
+	})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte("done"))
+	}).Name("slow")
+	handler := NewRequestMetricsHandler(router, MuxRouteName(router), metricsFactory,
+		testMetricName, time.Millisecond)
+
+	req, err := http.NewRequest("GET", "/slow", nil)
+	require.NoError(t, err)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "done", res.Body.String())
+}
+
+// Tests that the requests of streaming routes are not logged as slow requests.
+func TestRequestMetricsHandlerStreamingRoutes(t *testing.T) {
+	var logs bytes.Buffer
+	testLogger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(&logs, seelog.WarnLvl, "%Msg%n")
+	require.NoError(t, err)
+	previousLogger := seelog.Current
+	seelog.ReplaceLogger(testLogger)
+	defer seelog.ReplaceLogger(previousLogger)
+
+	serveMux := http.NewServeMux()
+	for _, path := range []string{"/slow", "/events"} {
+		serveMux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(5 * time.Millisecond)
+		})
+	}
+	handler := NewRequestMetricsHandler(serveMux, ServeMuxRouteName(serveMux), metrics.NewNopEntryFactory(),
+		testMetricName, time.Millisecond).WithStreamingRoutes("/events")
+
+	for _, path := range []string{"/events", "/slow"} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	seelog.Flush()
+	assert.Contains(t, logs.String(), "/slow")
+	assert.NotContains(t, logs.String(), "/events")
+}
+
+// exemplarEntry is an entry that records the exemplar that it is done with.
+type exemplarEntry struct {
+	metrics.Entry
+	exemplar map[string]string
+	done     *map[string]string
+}
+
+func (e *exemplarEntry) WithExemplar(labels map[string]string) metrics.Entry {
+	return &exemplarEntry{Entry: e.Entry, exemplar: labels, done: e.done}
+}
+
+func (e *exemplarEntry) WithFields(f map[string]interface{}) metrics.Entry {
+	return e
+}
+
+func (e *exemplarEntry) Done(err error) func() {
+	*e.done = e.exemplar
+	return func() {}
+}
+
+type exemplarEntryFactory struct {
+	metrics.EntryFactory
+	done map[string]string
+}
+
+func (f *exemplarEntryFactory) New(op string) metrics.Entry {
+	return &exemplarEntry{Entry: f.EntryFactory.New(op), done: &f.done}
+}
+
+// Tests that the latencies of requests with a span context are linked to their trace, and
+// that those of other requests aren't.
+func TestRequestMetricsHandlerExemplars(t *testing.T) {
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/v1/credentials", func(w http.ResponseWriter, r *http.Request) {})
+	metricsFactory := &exemplarEntryFactory{EntryFactory: metrics.NewNopEntryFactory()}
+	handler := NewRequestMetricsHandler(serveMux, ServeMuxRouteName(serveMux), metricsFactory,
+		testMetricName, 0)
+
+	req, err := http.NewRequest("GET", "/v1/credentials", nil)
+	require.NoError(t, err)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Nil(t, metricsFactory.done)
+
+	spanContext := audit.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(audit.ContextWithSpanContext(req.Context(), spanContext)))
+	assert.Equal(t, map[string]string{TraceIDExemplarLabel: "4bf92f3577b34da6a3ce929d0e0e4736"}, metricsFactory.done)
+
+	// Entries that don't support exemplars are recorded without them
+	handler = NewRequestMetricsHandler(serveMux, ServeMuxRouteName(serveMux), metrics.NewNopEntryFactory(),
+		testMetricName, 0)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(audit.ContextWithSpanContext(req.Context(), spanContext)))
+}
@@ -19,8 +19,10 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
 	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/logging"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/session"
 	muxutils "github.com/aws/amazon-ecs-agent/ecs-agent/tmds/utils/mux"
 
 	"github.com/didip/tollbooth"
@@ -31,6 +33,27 @@ const (
 	// TMDS IP and port
 	IPv4 = "127.0.0.1"
 	Port = 51679
+
+	// DefaultIdleTimeout is the default maximum duration to wait for the next request on
+	// a keep-alive connection. It is kept long enough for clients polling metadata or
+	// credentials at typical intervals to reuse their connections.
+	DefaultIdleTimeout = 60 * time.Second
+
+	// DefaultReadHeaderTimeout is the default maximum duration for reading request headers.
+	// Connections of clients that send headers slower than that are closed, so that slow
+	// clients can't hold on to server connections.
+	DefaultReadHeaderTimeout = 3 * time.Second
+
+	// DefaultMaxHeaderBytes is the default maximum size of request headers. Requests to
+	// TMDS carry few headers, so it is much lower than the http server default of 1MB.
+	DefaultMaxHeaderBytes = 16 << 10
+
+	// DefaultMaxRequestBodyBytes is the default maximum size of request bodies.
+	DefaultMaxRequestBodyBytes = 64 << 10
+
+	// MaxResponseJitter bounds the random delay of responses, so that response jitter
+	// can't harm latency sensitive clients.
+	MaxResponseJitter = time.Second
 )
 
 // IPv4 address for TMDS
@@ -46,6 +69,26 @@ type Config struct {
 	steadyStateRate float64       // steady request rate limit
 	burstRate       int           // burst request rate limit
 	handler         http.Handler  // HTTP handler with routes configured
+	idleTimeout     time.Duration // http server idle timeout for keep-alive connections
+	keepAlives      bool          // whether http keep-alives are enabled
+	tlsRequired     bool          // whether requests not received over TLS are rejected
+
+	pathNormalization bool // whether variants of the paths of the routes of the handler are served
+	forwardedPrefix   bool // whether the X-Forwarded-Prefix header of requests is honored
+
+	readHeaderTimeout   time.Duration // http server read timeout for request headers
+	maxHeaderBytes      int           // maximum size of request headers
+	maxRequestBodyBytes int64         // maximum size of request bodies, not limited if not positive
+	logLevelHeader      bool          // whether the log level header of requests is honored
+	traceContext        bool          // whether the traceparent header of requests is honored
+	responseJitter      time.Duration // maximum random delay of requests, not delayed if not positive
+
+	metricsFactory       metrics.EntryFactory // factory for request latency metrics, not recorded if nil
+	slowRequestThreshold time.Duration        // duration above which requests are logged as slow
+	onLimitReached       func(*http.Request)  // called for every throttled request, if not nil
+
+	sessionMode session.Mode  // whether requests must carry session tokens, session tokens aren't issued if empty
+	sessionOpts []session.Opt // options of the session token handler
 }
 
 // Function type for updating TMDS config
@@ -72,6 +115,133 @@ func WithWriteTimeout(writeTimeout time.Duration) ConfigOpt {
 	}
 }
 
+// Set TMDS idle timeout for keep-alive connections. DefaultIdleTimeout is used if not set.
+// The read timeout is used instead if the idle timeout is set to zero.
+func WithIdleTimeout(idleTimeout time.Duration) ConfigOpt {
+	return func(c *Config) {
+		c.idleTimeout = idleTimeout
+	}
+}
+
+// Set TMDS read timeout for request headers. DefaultReadHeaderTimeout is used if not set.
+// The read timeout is used instead if the read header timeout is set to zero.
+func WithReadHeaderTimeout(readHeaderTimeout time.Duration) ConfigOpt {
+	return func(c *Config) {
+		c.readHeaderTimeout = readHeaderTimeout
+	}
+}
+
+// Set TMDS maximum size of request headers. DefaultMaxHeaderBytes is used if not set.
+// Requests with larger headers are rejected with a 431.
+func WithMaxHeaderBytes(maxHeaderBytes int) ConfigOpt {
+	return func(c *Config) {
+		c.maxHeaderBytes = maxHeaderBytes
+	}
+}
+
+// Set TMDS maximum size of request bodies. DefaultMaxRequestBodyBytes is used if not set.
+// Requests with larger bodies are rejected with a 413. Request bodies are not limited if
+// the maximum size is set to zero or less.
+func WithMaxRequestBodyBytes(maxRequestBodyBytes int64) ConfigOpt {
+	return func(c *Config) {
+		c.maxRequestBodyBytes = maxRequestBodyBytes
+	}
+}
+
+// Honor the logging.LogLevelHeader header of requests, which raises the log level to debug
+// for the requests that set it. The header is ignored by default, so that clients can't
+// flood the logs.
+func WithLogLevelHeader(enabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.logLevelHeader = enabled
+	}
+}
+
+// Honor the W3C Trace Context traceparent header of requests, so that the trace and span
+// ids of requests are written to the credentials audit log. The header is ignored by
+// default.
+func WithTraceContext(enabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.traceContext = enabled
+	}
+}
+
+// Delay requests by a random duration of up to maxJitter, so that clients polling in
+// lockstep drift apart over time. The delay is capped at MaxResponseJitter. Requests are
+// not delayed by default.
+func WithResponseJitter(maxJitter time.Duration) ConfigOpt {
+	return func(c *Config) {
+		if maxJitter > MaxResponseJitter {
+			maxJitter = MaxResponseJitter
+		}
+		c.responseJitter = maxJitter
+	}
+}
+
+// Enable or disable TMDS http keep-alives. Keep-alives are enabled by default.
+func WithKeepAlivesEnabled(enabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.keepAlives = enabled
+	}
+}
+
+// Reject requests that were not received over TLS with a 403. This guards against
+// plaintext credential exposure if the server is configured to serve over TLS but a
+// plaintext request reaches the handler anyway. TLS is not required by default.
+func WithTLSRequired(required bool) ConfigOpt {
+	return func(c *Config) {
+		c.tlsRequired = required
+	}
+}
+
+// Serve requests for variants of the paths of the routes of the handler that have a trailing
+// slash or differ in case, such as '/V2/Metadata/', as requests for the paths of the
+// routes, if the handler is a mux router. Path variables, such as ids, keep their case.
+// Paths are matched strictly by default, except for the forms of the credentials paths
+// that are canonicalized by utils.CredentialsPathHandler.
+func WithPathNormalization(enabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.pathNormalization = enabled
+	}
+}
+
+// Honor the X-Forwarded-Prefix header of requests, serving requests for paths with the
+// forwarded prefix as requests for the paths without it, for the handler to run behind
+// reverse proxies that forward requests under a prefix. The header is ignored by default.
+func WithForwardedPrefix(enabled bool) ConfigOpt {
+	return func(c *Config) {
+		c.forwardedPrefix = enabled
+	}
+}
+
+// Issue IMDSv2-like session tokens at session.TokenPath and check the session tokens of
+// requests, rejecting requests without session tokens if the mode is session.ModeRequired.
+// Session tokens aren't issued by default.
+func WithSessionTokens(mode session.Mode, opts ...session.Opt) ConfigOpt {
+	return func(c *Config) {
+		c.sessionMode = mode
+		c.sessionOpts = opts
+	}
+}
+
+// Record per-route request latency metrics and log requests taking at least
+// slowRequestThreshold. Routes are identified by their mux route names if the handler
+// is a mux router, so that request specific path values are not used in metrics.
+func WithRequestMetrics(metricsFactory metrics.EntryFactory, slowRequestThreshold time.Duration) ConfigOpt {
+	return func(c *Config) {
+		c.metricsFactory = metricsFactory
+		c.slowRequestThreshold = slowRequestThreshold
+	}
+}
+
+// Call onLimitReached for every request that is throttled by the request rate limiter,
+// after the request is logged in the credentials audit log.
+func WithLimitReachedObserver(onLimitReached func(*http.Request)) ConfigOpt {
+	return func(c *Config) {
+		c.onLimitReached = onLimitReached
+	}
+}
+
 // Set TMDS steady request rate limit
 func WithSteadyStateRate(steadyStateRate float64) ConfigOpt {
 	return func(c *Config) {
@@ -95,7 +265,13 @@ func WithHandler(handler http.Handler) ConfigOpt {
 
 // Create a new HTTP Task Metadata Server (TMDS)
 func NewServer(auditLogger audit.AuditLogger, options ...ConfigOpt) (*http.Server, error) {
-	config := new(Config)
+	config := &Config{
+		idleTimeout:         DefaultIdleTimeout,
+		keepAlives:          true,
+		readHeaderTimeout:   DefaultReadHeaderTimeout,
+		maxHeaderBytes:      DefaultMaxHeaderBytes,
+		maxRequestBodyBytes: DefaultMaxRequestBodyBytes,
+	}
 	for _, opt := range options {
 		opt(config)
 	}
@@ -109,26 +285,93 @@ func setup(auditLogger audit.AuditLogger, config *Config) (*http.Server, error)
 	}
 
 	// Define a reqeuest rate limiter
+	onLimitReached := utils.LimitReachedHandler(auditLogger)
+	if config.onLimitReached != nil {
+		auditLimitReached := onLimitReached
+		onLimitReached = func(w http.ResponseWriter, r *http.Request) {
+			auditLimitReached(w, r)
+			config.onLimitReached(r)
+		}
+	}
 	limiter := tollbooth.
 		NewLimiter(config.steadyStateRate, nil).
-		SetOnLimitReached(utils.LimitReachedHandler(auditLogger)).
+		SetOnLimitReached(onLimitReached).
 		SetBurst(config.burstRate)
 
+	handler := utils.MaxRequestBodyHandler(config.handler, config.maxRequestBodyBytes)
+	if config.metricsFactory != nil {
+		handler = logging.NewRequestMetricsHandler(handler, routeNameFunc(config.handler),
+			config.metricsFactory, metrics.RequestLatencyMetricName, config.slowRequestThreshold)
+	}
+	// Requests are delayed outside of the latency metrics, so that the jitter is not
+	// reported as request latency
+	handler = utils.ResponseJitterHandler(handler, config.responseJitter)
+
+	if config.sessionMode != "" {
+		// Rejected requests are audited, which can be overridden by the options
+		opts := append([]session.Opt{session.WithAuditLogger(auditLogger)}, config.sessionOpts...)
+		sessionHandler, err := session.NewHandler(handler, config.sessionMode, opts...)
+		if err != nil {
+			return nil, err
+		}
+		handler = sessionHandler
+	}
+
+	if config.tlsRequired {
+		handler = utils.TLSRequiredHandler(auditLogger, handler)
+	}
+	// Non-canonical credentials paths are canonicalized before requests are routed, and
+	// before they are measured so that they are measured under their route
+	handler = utils.CredentialsPathHandler(handler)
+	if router, ok := config.handler.(*mux.Router); ok && config.pathNormalization {
+		handler = utils.PathNormalizationHandler(handler, router)
+	}
+	// Forwarded prefixes are removed before the paths are canonicalized or normalized
+	if config.forwardedPrefix {
+		handler = utils.ForwardedPrefixHandler(handler)
+	}
+
 	// Log all requests and then pass through to muxRouter.
 	loggingMuxRouter := mux.NewRouter()
 
 	// rootPath is a path for any traffic to this endpoint
 	rootPath := "/" + muxutils.ConstructMuxVar("root", muxutils.AnythingRegEx)
-	loggingMuxRouter.Handle(rootPath, tollbooth.LimitHandler(
-		limiter, logging.NewLoggingHandler(config.handler)))
+	var loggingHandler http.Handler = logging.NewLoggingHandler(handler)
+	if config.logLevelHeader {
+		loggingHandler = logging.NewLogLevelHeaderHandler(loggingHandler)
+	}
+	// The span context is set before the rate limiter, so that throttled requests are
+	// audited with it too
+	var rootHandler http.Handler = tollbooth.LimitHandler(limiter, loggingHandler)
+	if config.traceContext {
+		rootHandler = utils.TraceContextHandler(rootHandler)
+	}
+	loggingMuxRouter.Handle(rootPath, rootHandler)
 
 	// explicitly enable path cleaning
 	loggingMuxRouter.SkipClean(false)
 
-	return &http.Server{
-		Addr:         config.listenAddress,
-		Handler:      loggingMuxRouter,
-		ReadTimeout:  config.readTimeout,
-		WriteTimeout: config.writeTimeout,
-	}, nil
+	server := &http.Server{
+		Addr:              config.listenAddress,
+		Handler:           loggingMuxRouter,
+		ReadTimeout:       config.readTimeout,
+		ReadHeaderTimeout: config.readHeaderTimeout,
+		WriteTimeout:      config.writeTimeout,
+		IdleTimeout:       config.idleTimeout,
+		MaxHeaderBytes:    config.maxHeaderBytes,
+	}
+	server.SetKeepAlivesEnabled(config.keepAlives)
+	return server, nil
+}
+
+// routeNameFunc returns the function for naming the routes of the handler in metrics.
+func routeNameFunc(handler http.Handler) logging.RouteNameFunc {
+	switch h := handler.(type) {
+	case *mux.Router:
+		return logging.MuxRouteName(h)
+	case *http.ServeMux:
+		return logging.ServeMuxRouteName(h)
+	default:
+		return func(*http.Request) string { return logging.UnknownRoute }
+	}
 }
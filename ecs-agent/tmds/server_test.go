@@ -16,9 +16,29 @@
 package tmds
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	mock_audit "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/metrics"
+	mock_metrics "github.com/aws/amazon-ecs-agent/ecs-agent/metrics/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/logging"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/session"
+	"github.com/cihub/seelog"
+	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -37,17 +57,670 @@ func TestServerSettings(t *testing.T) {
 	router := mux.NewRouter()
 	writeTimeout := 5 * time.Second
 	readTimeout := 10 * time.Second
+	idleTimeout := 30 * time.Second
 
 	server, err := NewServer(nil,
 		WithListenAddress(AddressIPv4()),
 		WithHandler(router),
 		WithWriteTimeout(writeTimeout),
-		WithReadTimeout(readTimeout))
+		WithReadTimeout(readTimeout),
+		WithIdleTimeout(idleTimeout))
 
 	require.NoError(t, err)
 	assert.Equal(t, AddressIPv4(), server.Addr)
 	assert.Equal(t, writeTimeout, server.WriteTimeout)
 	assert.Equal(t, readTimeout, server.ReadTimeout)
+	assert.Equal(t, idleTimeout, server.IdleTimeout)
+}
+
+func TestServerDefaultIdleTimeout(t *testing.T) {
+	server, err := NewServer(nil, WithHandler(mux.NewRouter()))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultIdleTimeout, server.IdleTimeout)
+}
+
+func TestServerRequestLimits(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		server, err := NewServer(nil, WithHandler(mux.NewRouter()))
+		require.NoError(t, err)
+		assert.Equal(t, DefaultReadHeaderTimeout, server.ReadHeaderTimeout)
+		assert.Equal(t, DefaultMaxHeaderBytes, server.MaxHeaderBytes)
+	})
+	t.Run("overridden", func(t *testing.T) {
+		server, err := NewServer(nil, WithHandler(mux.NewRouter()),
+			WithReadHeaderTimeout(time.Second), WithMaxHeaderBytes(1024))
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, server.ReadHeaderTimeout)
+		assert.Equal(t, 1024, server.MaxHeaderBytes)
+	})
+}
+
+// startTestServer serves the handler with a TMDS server created with the options, and
+// returns the address of the server.
+func startTestServer(t *testing.T, handler http.Handler, options ...ConfigOpt) string {
+	auditLogger := mock_audit.NewMockAuditLogger(gomock.NewController(t))
+	server, err := NewServer(auditLogger, append([]ConfigOpt{
+		WithHandler(handler),
+		WithSteadyStateRate(100),
+		WithBurstRate(100),
+	}, options...)...)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+// Asserts that request bodies larger than the maximum request body size are rejected
+// with a 413, whether their size is known up front or not.
+func TestServerMaxRequestBodyBytes(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/fault", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			errorMessage := utils.RequestBodyErrorMessage(err)
+			require.NotNil(t, errorMessage)
+			utils.WriteJSONResponse(w, errorMessage.HTTPErrorCode, errorMessage, "fault")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodPost)
+	addr := startTestServer(t, router, WithMaxRequestBodyBytes(1024))
+
+	for _, tc := range []struct {
+		name         string
+		body         io.Reader
+		expectedCode int
+	}{
+		{name: "within limit", body: bytes.NewReader(make([]byte, 1024)), expectedCode: http.StatusOK},
+		{name: "over limit", body: bytes.NewReader(make([]byte, 1025)), expectedCode: http.StatusRequestEntityTooLarge},
+		{name: "chunked over limit", body: io.LimitReader(zeroReader{}, 4096), expectedCode: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := http.Post("http://"+addr+"/fault", "application/json", tc.body)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tc.expectedCode, res.StatusCode)
+			if tc.expectedCode == http.StatusRequestEntityTooLarge {
+				var errorMessage utils.ErrorMessage
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&errorMessage))
+				assert.Equal(t, utils.ErrRequestBodyTooLarge, errorMessage.Code)
+			}
+		})
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// Asserts that connections of clients that send request headers slower than the read header
+// timeout are closed, and that requests whose headers are too large are rejected.
+func TestServerSlowAndLargeHeaders(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	addr := startTestServer(t, router, WithReadHeaderTimeout(200*time.Millisecond), WithMaxHeaderBytes(1024))
+
+	t.Run("slow headers", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		start := time.Now()
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n"))
+		require.NoError(t, err)
+		// Drip the rest of the headers until the server closes the connection
+		var writeErr error
+		for i := 0; i < 20 && writeErr == nil; i++ {
+			time.Sleep(50 * time.Millisecond)
+			_, writeErr = conn.Write([]byte("X-Slow: 1\r\n"))
+		}
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		_, err = io.ReadAll(conn)
+		if netErr, ok := err.(net.Error); ok {
+			require.False(t, netErr.Timeout(), "server did not close the connection")
+		}
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	})
+
+	t.Run("large headers", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Large", strings.Repeat("a", 8192))
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, res.StatusCode)
+	})
+}
+
+// Asserts that the keep-alive setting is applied to connections served by the server.
+func TestServerKeepAlives(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		options       []ConfigOpt
+		expectedClose bool
+	}{
+		{name: "enabled by default", expectedClose: false},
+		{name: "disabled", options: []ConfigOpt{WithKeepAlivesEnabled(false)}, expectedClose: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+			auditLogger := mock_audit.NewMockAuditLogger(gomock.NewController(t))
+			options := append([]ConfigOpt{
+				WithHandler(router),
+				WithSteadyStateRate(100),
+				WithBurstRate(100),
+			}, tc.options...)
+			server, err := NewServer(auditLogger, options...)
+			require.NoError(t, err)
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go server.Serve(listener)
+			defer server.Close()
+
+			res, err := http.Get("http://" + listener.Addr().String() + "/")
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, tc.expectedClose, res.Close)
+		})
+	}
+}
+
+// Asserts that request metrics are recorded with mux route names when enabled.
+func TestServerRequestMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	metricsFactory := mock_metrics.NewMockEntryFactory(ctrl)
+	entry := mock_metrics.NewMockEntry(ctrl)
+	metricsFactory.EXPECT().New(metrics.RequestLatencyMetricName).Return(entry)
+	entry.EXPECT().WithFields(map[string]interface{}{
+		"route":  "credentials",
+		"method": "GET",
+		"status": http.StatusOK,
+	}).Return(entry)
+	entry.EXPECT().Done(nil).Return(func() {})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {}).
+		Name("credentials")
+	server, err := NewServer(mock_audit.NewMockAuditLogger(ctrl),
+		WithHandler(router),
+		WithSteadyStateRate(100),
+		WithBurstRate(100),
+		WithRequestMetrics(metricsFactory, time.Second))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/v2/credentials/credsid", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "127.0.0.1:12345"
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// Asserts that the limit reached observer is called for throttled requests only.
+func TestServerLimitReachedObserver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), http.StatusTooManyRequests, "")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	var throttled []string
+	server, err := NewServer(auditLogger,
+		WithHandler(router),
+		WithSteadyStateRate(1),
+		WithBurstRate(1),
+		WithLimitReachedObserver(func(r *http.Request) {
+			throttled = append(throttled, r.URL.Path)
+		}))
+	require.NoError(t, err)
+
+	for _, expectedStatus := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req, err := http.NewRequest("GET", "/v2/credentials/credsid", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = "127.0.0.1:12345"
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, req)
+		require.Equal(t, expectedStatus, recorder.Code)
+	}
+	assert.Equal(t, []string{"/v2/credentials/credsid"}, throttled)
+}
+
+// Asserts that the response jitter is capped and that jittered requests are served.
+func TestServerResponseJitter(t *testing.T) {
+	config := &Config{}
+	WithResponseJitter(time.Hour)(config)
+	assert.Equal(t, MaxResponseJitter, config.responseJitter)
+	WithResponseJitter(50 * time.Millisecond)(config)
+	assert.Equal(t, 50*time.Millisecond, config.responseJitter)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	server, err := NewServer(mock_audit.NewMockAuditLogger(ctrl),
+		WithHandler(router),
+		WithSteadyStateRate(100),
+		WithBurstRate(100),
+		WithResponseJitter(50*time.Millisecond))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/v2/credentials/credsid", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "127.0.0.1:12345"
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	server.Handler.ServeHTTP(recorder, req)
+	assert.Less(t, time.Since(start), MaxResponseJitter)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// Asserts that plaintext requests are rejected only when TLS is required.
+func TestServerTLSRequired(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		tlsRequired    bool
+		tls            bool
+		expectedStatus int
+	}{
+		{name: "enforced, TLS request", tlsRequired: true, tls: true, expectedStatus: http.StatusOK},
+		{name: "enforced, plaintext request", tlsRequired: true, tls: false, expectedStatus: http.StatusForbidden},
+		{name: "not enforced, TLS request", tlsRequired: false, tls: true, expectedStatus: http.StatusOK},
+		{name: "not enforced, plaintext request", tlsRequired: false, tls: false, expectedStatus: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			if tc.expectedStatus == http.StatusForbidden {
+				auditLogger.EXPECT().Log(gomock.Any(), http.StatusForbidden, "")
+			}
+
+			router := mux.NewRouter()
+			router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {})
+			server, err := NewServer(auditLogger,
+				WithHandler(router),
+				WithSteadyStateRate(100),
+				WithBurstRate(100),
+				WithTLSRequired(tc.tlsRequired))
+			require.NoError(t, err)
+
+			req, err := http.NewRequest("GET", "/v2/credentials/credsid", nil)
+			require.NoError(t, err)
+			req.RemoteAddr = "127.0.0.1:12345"
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			recorder := httptest.NewRecorder()
+			server.Handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			if tc.expectedStatus == http.StatusForbidden {
+				var response utils.ErrorMessage
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, utils.ErrTLSRequired, response.Code)
+			}
+		})
+	}
+}
+
+// Asserts that non-canonical forms of the credentials paths are routed to the credentials
+// handlers, and that other paths are not.
+func TestServerCredentialsPaths(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/credentials", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "credsid", mux.Vars(r)["id"])
+	})
+	server, err := NewServer(nil,
+		WithHandler(router),
+		WithSteadyStateRate(100),
+		WithBurstRate(100))
+	require.NoError(t, err)
+
+	for path, expectedStatus := range map[string]int{
+		"/v1/credentials?id=credsid":   http.StatusOK,
+		"/V1/credentials?id=credsid":   http.StatusOK,
+		"/v1/credentials/?id=credsid":  http.StatusOK,
+		"/V1/credentials/?ID=credsid":  http.StatusOK,
+		"/v2/credentials/credsid":      http.StatusOK,
+		"/V2/credentials/credsid/":     http.StatusOK,
+		"/v1/Credentials?id=credsid":   http.StatusNotFound,
+		"/v1/credentials/x?id=credsid": http.StatusNotFound,
+	} {
+		t.Run(path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", path, nil)
+			require.NoError(t, err)
+			req.RemoteAddr = "127.0.0.1:12345"
+			recorder := httptest.NewRecorder()
+			server.Handler.ServeHTTP(recorder, req)
+			assert.Equal(t, expectedStatus, recorder.Code)
+		})
+	}
+}
+
+// Asserts that variants of the paths of the routes are served only if path normalization
+// is enabled, other than the canonicalized credentials paths.
+func TestServerPathNormalization(t *testing.T) {
+	newServer := func(t *testing.T, opts ...ConfigOpt) *http.Server {
+		router := mux.NewRouter()
+		router.HandleFunc("/v1/credentials", func(w http.ResponseWriter, r *http.Request) {})
+		router.HandleFunc("/v2/metadata", func(w http.ResponseWriter, r *http.Request) {})
+		router.HandleFunc("/v3/{id:[^/]*}/task", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "EndpointID", mux.Vars(r)["id"])
+		})
+		server, err := NewServer(nil, append([]ConfigOpt{
+			WithHandler(router),
+			WithSteadyStateRate(100),
+			WithBurstRate(100),
+		}, opts...)...)
+		require.NoError(t, err)
+		return server
+	}
+	testCases := []struct {
+		path             string
+		strictStatus     int
+		normalizedStatus int
+	}{
+		{"/v2/metadata", http.StatusOK, http.StatusOK},
+		{"/v2/metadata/", http.StatusNotFound, http.StatusOK},
+		{"/V2/Metadata", http.StatusNotFound, http.StatusOK},
+		{"/V2/METADATA/", http.StatusNotFound, http.StatusOK},
+		{"/v3/EndpointID/task", http.StatusOK, http.StatusOK},
+		{"/V3/EndpointID/Task/", http.StatusNotFound, http.StatusOK},
+		{"/v1/credentials/?id=credsid", http.StatusOK, http.StatusOK},
+		{"/v1/Credentials?id=credsid", http.StatusNotFound, http.StatusOK},
+		{"/v2/metadata/task", http.StatusNotFound, http.StatusNotFound},
+		{"/v3/EndpointID/x/task", http.StatusNotFound, http.StatusNotFound},
+	}
+	for _, mode := range []struct {
+		name       string
+		opts       []ConfigOpt
+		normalized bool
+	}{
+		{"default", nil, false},
+		{"strict", []ConfigOpt{WithPathNormalization(false)}, false},
+		{"normalized", []ConfigOpt{WithPathNormalization(true)}, true},
+	} {
+		server := newServer(t, mode.opts...)
+		for _, tc := range testCases {
+			t.Run(mode.name+tc.path, func(t *testing.T) {
+				req, err := http.NewRequest("GET", tc.path, nil)
+				require.NoError(t, err)
+				req.RemoteAddr = "127.0.0.1:12345"
+				recorder := httptest.NewRecorder()
+				server.Handler.ServeHTTP(recorder, req)
+				expectedStatus := tc.strictStatus
+				if mode.normalized {
+					expectedStatus = tc.normalizedStatus
+				}
+				assert.Equal(t, expectedStatus, recorder.Code)
+			})
+		}
+	}
+}
+
+// Asserts that requests for paths with the forwarded prefix are routed, with their path
+// variables, as requests for the paths without it only if the forwarded prefix is honored.
+func TestServerForwardedPrefix(t *testing.T) {
+	newServer := func(t *testing.T, opts ...ConfigOpt) *http.Server {
+		router := mux.NewRouter()
+		router.HandleFunc("/v1/credentials", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "credsid", r.URL.Query().Get("id"))
+		})
+		router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "credsid", mux.Vars(r)["id"])
+		})
+		server, err := NewServer(nil, append([]ConfigOpt{
+			WithHandler(router),
+			WithSteadyStateRate(100),
+			WithBurstRate(100),
+		}, opts...)...)
+		require.NoError(t, err)
+		return server
+	}
+	testCases := []struct {
+		path          string
+		prefix        string
+		ignoredStatus int
+		honoredStatus int
+	}{
+		{"/v2/credentials/credsid", "", http.StatusOK, http.StatusOK},
+		{"/v2/credentials/credsid", "/ecs", http.StatusOK, http.StatusOK},
+		{"/ecs/v2/credentials/credsid", "", http.StatusNotFound, http.StatusNotFound},
+		{"/ecs/v2/credentials/credsid", "/ecs", http.StatusNotFound, http.StatusOK},
+		{"/ecs/V1/credentials/?id=credsid", "/ecs", http.StatusNotFound, http.StatusOK},
+		{"/ecs/v2/credentials/credsid", "/other", http.StatusNotFound, http.StatusNotFound},
+	}
+	for _, mode := range []struct {
+		name    string
+		opts    []ConfigOpt
+		honored bool
+	}{
+		{"default", nil, false},
+		{"ignored", []ConfigOpt{WithForwardedPrefix(false)}, false},
+		{"honored", []ConfigOpt{WithForwardedPrefix(true)}, true},
+	} {
+		server := newServer(t, mode.opts...)
+		for _, tc := range testCases {
+			t.Run(mode.name+tc.prefix+tc.path, func(t *testing.T) {
+				req, err := http.NewRequest("GET", tc.path, nil)
+				require.NoError(t, err)
+				req.RemoteAddr = "127.0.0.1:12345"
+				if tc.prefix != "" {
+					req.Header.Set(utils.ForwardedPrefixHeader, tc.prefix)
+				}
+				recorder := httptest.NewRecorder()
+				server.Handler.ServeHTTP(recorder, req)
+				expectedStatus := tc.ignoredStatus
+				if mode.honored {
+					expectedStatus = tc.honoredStatus
+				}
+				assert.Equal(t, expectedStatus, recorder.Code)
+			})
+		}
+	}
+}
+
+// Asserts that session tokens are issued and checked only if session tokens are enabled,
+// and that requests are rejected before they reach the handler.
+func TestServerSessionTokens(t *testing.T) {
+	newServer := func(t *testing.T, auditLogger audit.AuditLogger, opts ...ConfigOpt) *http.Server {
+		router := mux.NewRouter()
+		router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {})
+		server, err := NewServer(auditLogger, append([]ConfigOpt{
+			WithHandler(router),
+			WithSteadyStateRate(100),
+			WithBurstRate(100),
+		}, opts...)...)
+		require.NoError(t, err)
+		return server
+	}
+	serve := func(server *http.Server, method, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("required", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+		auditLogger.EXPECT().Log(gomock.Any(), http.StatusUnauthorized, "")
+		server := newServer(t, auditLogger, WithSessionTokens(session.ModeRequired))
+
+		recorder := serve(server, http.MethodPut, session.TokenPath, http.Header{session.TokenTTLHeader: {"60"}})
+		require.Equal(t, http.StatusOK, recorder.Code)
+		token := recorder.Body.String()
+
+		assert.Equal(t, http.StatusUnauthorized, serve(server, http.MethodGet, "/v2/credentials/credsid", nil).Code)
+		assert.Equal(t, http.StatusOK, serve(server, http.MethodGet, "/v2/credentials/credsid",
+			http.Header{session.TokenHeader: {token}}).Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		server := newServer(t, mock_audit.NewMockAuditLogger(ctrl))
+
+		assert.Equal(t, http.StatusNotFound,
+			serve(server, http.MethodPut, session.TokenPath, http.Header{session.TokenTTLHeader: {"60"}}).Code)
+		assert.Equal(t, http.StatusOK, serve(server, http.MethodGet, "/v2/credentials/credsid",
+			http.Header{session.TokenHeader: {"not-a-token"}}).Code)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		_, err := NewServer(mock_audit.NewMockAuditLogger(ctrl),
+			WithHandler(mux.NewRouter()), WithSessionTokens("sometimes"))
+		assert.Error(t, err)
+	})
+}
+
+// Asserts that the span context of the traceparent header is passed to the handler, and to
+// the audit log for throttled requests, only if the header is honored.
+func TestServerTraceContext(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	expected := audit.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "enabled", enabled: true},
+		{name: "disabled by default", enabled: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			var handlerSpanContext, auditedSpanContext audit.SpanContext
+			var handlerOK, auditedOK bool
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), http.StatusTooManyRequests, "").Do(
+				func(r request.LogRequest, _ int, _ string) {
+					auditedSpanContext, auditedOK = audit.SpanContextFromContext(r.Request.Context())
+				})
+
+			router := mux.NewRouter()
+			router.HandleFunc("/v2/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {
+				handlerSpanContext, handlerOK = audit.SpanContextFromContext(r.Context())
+			})
+			options := []ConfigOpt{WithHandler(router), WithSteadyStateRate(1), WithBurstRate(1)}
+			if tc.enabled {
+				options = append(options, WithTraceContext(true))
+			}
+			server, err := NewServer(auditLogger, options...)
+			require.NoError(t, err)
+
+			for _, expectedStatus := range []int{http.StatusOK, http.StatusTooManyRequests} {
+				req, err := http.NewRequest("GET", "/v2/credentials/credsid", nil)
+				require.NoError(t, err)
+				req.RemoteAddr = "127.0.0.1:12345"
+				req.Header.Set(audit.TraceparentHeader, traceparent)
+				recorder := httptest.NewRecorder()
+				server.Handler.ServeHTTP(recorder, req)
+				require.Equal(t, expectedStatus, recorder.Code)
+			}
+			assert.Equal(t, tc.enabled, handlerOK)
+			assert.Equal(t, tc.enabled, auditedOK)
+			if tc.enabled {
+				assert.Equal(t, expected, handlerSpanContext)
+				assert.Equal(t, expected, auditedSpanContext)
+			}
+		})
+	}
+}
+
+// lockedBuffer is a buffer that logs can be written to concurrently
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+// Asserts that debug logs are written for the requests with the log level header only if
+// the header is honored, while the global log level is info.
+func TestServerLogLevelHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "enabled", enabled: true},
+		{name: "disabled by default", enabled: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := &lockedBuffer{}
+			infoLogger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(logs, seelog.InfoLvl, "%Msg%n")
+			require.NoError(t, err)
+			previousLogger := seelog.Current
+			seelog.ReplaceLogger(infoLogger)
+			defer seelog.ReplaceLogger(previousLogger)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/{path}", func(w http.ResponseWriter, r *http.Request) {
+				logger.DebugContext(r.Context(), "Handler debug message", logger.Fields{"path": r.URL.Path})
+			})
+			options := []ConfigOpt{}
+			if tc.enabled {
+				options = append(options, WithLogLevelHeader(true))
+			}
+			addr := startTestServer(t, router, options...)
+
+			get := func(path string, level string) {
+				req, err := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+				require.NoError(t, err)
+				if level != "" {
+					req.Header.Set(logging.LogLevelHeader, level)
+				}
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+			}
+			get("/plain", "")
+			get("/verbose", "DEBUG")
+			get("/trace", "trace")
+			infoLogger.Flush()
+
+			output := logs.String()
+			assert.NotContains(t, output, "/plain")
+			assert.NotContains(t, output, "/trace")
+			if tc.enabled {
+				assert.Contains(t, output, `msg="Handler debug message" path="/verbose" logLevelOverride="debug"`)
+				assert.Contains(t, output, `msg="Handling http request"`)
+			} else {
+				assert.NotContains(t, output, "Handler debug message")
+				assert.NotContains(t, output, "Handling http request")
+			}
+		})
+	}
 }
 
 func TestAddressIPv4(t *testing.T) {
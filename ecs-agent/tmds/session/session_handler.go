@@ -0,0 +1,358 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package session hardens the task metadata endpoints with session tokens, in the way of
+// IMDSv2. Clients PUT to the token path to be issued a session token with a TTL, and
+// present it in the token header of their subsequent requests.
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/request"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// TokenPath is the path that clients PUT to to be issued a session token.
+	TokenPath = "/api/token"
+	// TokenHeader is the request header with the session token of a request.
+	TokenHeader = "X-Aws-Ecs-Metadata-Token"
+	// TokenTTLHeader is the header with the TTL of session tokens in seconds. Token requests
+	// set it to the TTL they ask for, and token responses to the TTL they are issued with.
+	TokenTTLHeader = "X-Aws-Ecs-Metadata-Token-Ttl-Seconds"
+
+	// MinTokenTTL and MaxTokenTTL bound the TTLs of session tokens.
+	MinTokenTTL = time.Second
+	MaxTokenTTL = 6 * time.Hour
+
+	// DefaultIssueRate and DefaultIssueBurst are the default rate and burst of token
+	// requests from each source IP.
+	DefaultIssueRate  = 1.0
+	DefaultIssueBurst = 5
+
+	// ErrInvalidToken is the error code indicating that a request carries a session token
+	// that is malformed, expired, or was issued to another caller.
+	ErrInvalidToken = "InvalidSessionToken"
+	// ErrTokenRequired is the error code indicating that a request carries no session token
+	// while session tokens are required.
+	ErrTokenRequired = "SessionTokenRequired"
+	// ErrInvalidTokenRequest is the error code indicating that a token request is malformed.
+	ErrInvalidTokenRequest = "InvalidSessionTokenRequest"
+	// ErrTokenRequestThrottled is the error code indicating that a token request exceeded
+	// the token request rate of its source IP.
+	ErrTokenRequestThrottled = "SessionTokenRequestThrottled"
+
+	// requestType is the request type that responses of the session handler are logged with.
+	requestType = "session token"
+	// keySize is the size of the key that session tokens are signed with.
+	keySize = 32
+	// expirySize is the size of the expiry encoded in session tokens.
+	expirySize = 8
+	// maxTrackedSources is the number of source IPs whose token request rates are tracked
+	// before the rates of idle source IPs are forgotten.
+	maxTrackedSources = 1024
+	// sourceIdleTimeout is how long a source IP doesn't request tokens for before its token
+	// request rate can be forgotten.
+	sourceIdleTimeout = time.Minute
+)
+
+// Mode is whether requests must carry session tokens.
+type Mode string
+
+const (
+	// ModeOptional serves requests without session tokens. Requests with session tokens
+	// are still rejected if their tokens are invalid.
+	ModeOptional Mode = "optional"
+	// ModeRequired rejects requests without valid session tokens.
+	ModeRequired Mode = "required"
+)
+
+// ParseMode returns the mode with the given name.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case ModeOptional, ModeRequired:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown session token mode %q", name)
+}
+
+// CallerFunc identifies the caller of a request by its network identity, such as its
+// source IP or the task that its source IP belongs to. Session tokens are scoped to the
+// caller they are issued to, so that they can't be replayed by other callers.
+type CallerFunc func(r *http.Request) (string, error)
+
+// Handler wraps the handler of the task metadata endpoints. It issues session tokens for
+// PUT requests to TokenPath, and checks the session tokens of all other requests before
+// they are passed to the handler.
+//
+// Session tokens are signed with a key that is generated when the handler is created, so
+// they aren't stored and don't outlive the handler.
+type Handler struct {
+	h           http.Handler
+	mode        Mode
+	caller      CallerFunc
+	issueRate   rate.Limit
+	issueBurst  int
+	auditLogger audit.AuditLogger
+	now         func() time.Time
+	key         []byte
+
+	lock    sync.Mutex
+	sources map[string]*source
+}
+
+// source is the token request rate of a source IP.
+type source struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Opt configures a Handler.
+type Opt func(*Handler)
+
+// WithCaller sets the func that identifies the caller of a request. By default, the
+// caller is identified by the source IP of the request.
+func WithCaller(caller CallerFunc) Opt {
+	return func(h *Handler) {
+		h.caller = caller
+	}
+}
+
+// WithIssueRate sets the rate and the burst of the token requests of each source IP.
+// Token requests above the rate are rejected with a 429.
+func WithIssueRate(requestsPerSecond float64, burst int) Opt {
+	return func(h *Handler) {
+		h.issueRate = rate.Limit(requestsPerSecond)
+		h.issueBurst = burst
+	}
+}
+
+// WithAuditLogger logs the requests that are rejected by the handler in the credentials
+// audit log.
+func WithAuditLogger(auditLogger audit.AuditLogger) Opt {
+	return func(h *Handler) {
+		h.auditLogger = auditLogger
+	}
+}
+
+// NewHandler creates a new Handler in the given mode.
+func NewHandler(handler http.Handler, mode Mode, opts ...Opt) (*Handler, error) {
+	if _, err := ParseMode(string(mode)); err != nil {
+		return nil, err
+	}
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("unable to generate the session token key: %w", err)
+	}
+	h := &Handler{
+		h:          handler,
+		mode:       mode,
+		caller:     sourceIP,
+		issueRate:  DefaultIssueRate,
+		issueBurst: DefaultIssueBurst,
+		now:        time.Now,
+		key:        key,
+		sources:    make(map[string]*source),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// ServeHTTP issues a session token, or checks the session token of the request before
+// passing it to the handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == TokenPath {
+		h.issue(w, r)
+		return
+	}
+	token := r.Header.Get(TokenHeader)
+	if token == "" {
+		if h.mode == ModeRequired {
+			h.reject(w, r, http.StatusUnauthorized, ErrTokenRequired, "Session token is required")
+			return
+		}
+		h.h.ServeHTTP(w, r)
+		return
+	}
+	if err := h.validate(r, token); err != nil {
+		logger.Warn("Rejected request with invalid session token", logger.Fields{
+			"remoteAddr": r.RemoteAddr,
+			"path":       r.URL.Path,
+			field.Error:  err,
+		})
+		h.reject(w, r, http.StatusUnauthorized, ErrInvalidToken, "Session token is invalid")
+		return
+	}
+	h.h.ServeHTTP(w, r)
+}
+
+// issue issues a session token for the caller of a token request.
+func (h *Handler) issue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		h.reject(w, r, http.StatusMethodNotAllowed, ErrInvalidTokenRequest, "Session tokens are issued for PUT requests")
+		return
+	}
+	// Requests that went through a proxy aren't issued tokens, as the proxy could hand the
+	// token to anyone, like IMDSv2 does
+	if r.Header.Get("X-Forwarded-For") != "" {
+		h.reject(w, r, http.StatusForbidden, ErrInvalidTokenRequest, "Session tokens aren't issued to forwarded requests")
+		return
+	}
+	ttl, err := tokenTTL(r)
+	if err != nil {
+		h.reject(w, r, http.StatusBadRequest, ErrInvalidTokenRequest, "Invalid token TTL: "+err.Error())
+		return
+	}
+	ip, err := sourceIP(r)
+	if err != nil {
+		h.reject(w, r, http.StatusBadRequest, ErrInvalidTokenRequest, "Unable to identify the source of the request")
+		return
+	}
+	if !h.allow(ip) {
+		h.reject(w, r, http.StatusTooManyRequests, ErrTokenRequestThrottled, "Session token requests are throttled")
+		return
+	}
+	caller, err := h.caller(r)
+	if err != nil {
+		logger.Warn("Unable to identify the caller of a session token request", logger.Fields{
+			"remoteAddr": r.RemoteAddr,
+			field.Error:  err,
+		})
+		h.reject(w, r, http.StatusForbidden, ErrInvalidTokenRequest, "Unable to identify the caller of the request")
+		return
+	}
+	token := h.token(caller, h.now().Add(ttl))
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set(TokenTTLHeader, strconv.FormatInt(int64(ttl/time.Second), 10))
+	w.Header().Set(utils.CacheControlHeader, "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(token))
+}
+
+// tokenTTL returns the TTL that a token request asks for.
+func tokenTTL(r *http.Request) (time.Duration, error) {
+	value := r.Header.Get(TokenTTLHeader)
+	if value == "" {
+		return 0, fmt.Errorf("header %s is required", TokenTTLHeader)
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < int64(MinTokenTTL/time.Second) || seconds > int64(MaxTokenTTL/time.Second) {
+		return 0, fmt.Errorf("header %s must be between %d and %d seconds", TokenTTLHeader,
+			int64(MinTokenTTL/time.Second), int64(MaxTokenTTL/time.Second))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// allow returns whether a token request from the source IP is within its rate.
+func (h *Handler) allow(ip string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	now := h.now()
+	s, ok := h.sources[ip]
+	if !ok {
+		if len(h.sources) >= maxTrackedSources {
+			h.forgetIdleSourcesUnsafe(now)
+		}
+		s = &source{limiter: rate.NewLimiter(h.issueRate, h.issueBurst)}
+		h.sources[ip] = s
+	}
+	s.lastSeen = now
+	return s.limiter.AllowN(now, 1)
+}
+
+// forgetIdleSourcesUnsafe forgets the token request rates of the source IPs that didn't
+// request tokens for a while. Their limiters have refilled, so nothing is lost.
+func (h *Handler) forgetIdleSourcesUnsafe(now time.Time) {
+	for ip, s := range h.sources {
+		if now.Sub(s.lastSeen) >= sourceIdleTimeout {
+			delete(h.sources, ip)
+		}
+	}
+}
+
+// token returns a session token for the caller that expires at the given time. Tokens are
+// the expiry followed by the signature of the caller and the expiry.
+func (h *Handler) token(caller string, expiresAt time.Time) string {
+	raw := make([]byte, expirySize, expirySize+sha256.Size)
+	binary.BigEndian.PutUint64(raw, uint64(expiresAt.Unix()))
+	raw = append(raw, h.sign(caller, raw[:expirySize])...)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// validate returns an error if the token is malformed, expired, or was issued to another
+// caller than the caller of the request.
+func (h *Handler) validate(r *http.Request, token string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != expirySize+sha256.Size {
+		return errors.New("malformed token")
+	}
+	caller, err := h.caller(r)
+	if err != nil {
+		return fmt.Errorf("unable to identify the caller: %w", err)
+	}
+	if !hmac.Equal(raw[expirySize:], h.sign(caller, raw[:expirySize])) {
+		return errors.New("token was not issued to the caller")
+	}
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(raw[:expirySize])), 0)
+	if !h.now().Before(expiresAt) {
+		return fmt.Errorf("token expired at %s", expiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (h *Handler) sign(caller string, expiry []byte) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(expiry)
+	mac.Write([]byte(caller))
+	return mac.Sum(nil)
+}
+
+// reject responds to the request with an error, and logs it in the credentials audit log.
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if h.auditLogger != nil {
+		h.auditLogger.Log(request.LogRequest{Request: r}, status, "")
+	}
+	utils.WriteJSONResponse(w, status, utils.ErrorMessage{
+		Code:          code,
+		Message:       message,
+		HTTPErrorCode: status,
+	}, requestType)
+}
+
+// sourceIP identifies the caller of a request by its source IP.
+func sourceIP(r *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+	return host, nil
+}
@@ -0,0 +1,302 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mock_audit "github.com/aws/amazon-ecs-agent/ecs-agent/logger/audit/mocks"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/tmds/handlers/utils"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	credentialsPath = "/v2/credentials/credsid"
+	taskIP          = "10.0.0.1"
+	otherTaskIP     = "10.0.0.2"
+)
+
+// okHandler responds with a 200 to every request.
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+// fakeClock is the clock of a handler, which tests advance to expire tokens.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestHandler(t *testing.T, mode Mode, opts ...Opt) (*Handler, *fakeClock) {
+	h, err := NewHandler(okHandler, mode, opts...)
+	require.NoError(t, err)
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	h.now = clock.Now
+	return h, clock
+}
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func tokenRequest(ip string, ttl string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, TokenPath, nil)
+	req.RemoteAddr = ip + ":34567"
+	if ttl != "" {
+		req.Header.Set(TokenTTLHeader, ttl)
+	}
+	return req
+}
+
+func metadataRequest(ip string, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, credentialsPath, nil)
+	req.RemoteAddr = ip + ":34567"
+	if token != "" {
+		req.Header.Set(TokenHeader, token)
+	}
+	return req
+}
+
+// issueToken issues a token to the IP, failing the test if it isn't issued.
+func issueToken(t *testing.T, h http.Handler, ip string, ttl string) string {
+	recorder := serve(h, tokenRequest(ip, ttl))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	token := recorder.Body.String()
+	require.NotEmpty(t, token)
+	return token
+}
+
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	var errorMessage utils.ErrorMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorMessage))
+	return errorMessage.Code
+}
+
+func TestParseMode(t *testing.T) {
+	for _, mode := range []Mode{ModeOptional, ModeRequired} {
+		parsed, err := ParseMode(string(mode))
+		require.NoError(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+	_, err := ParseMode("sometimes")
+	assert.Error(t, err)
+	_, err = NewHandler(okHandler, "sometimes")
+	assert.Error(t, err)
+}
+
+func TestIssueToken(t *testing.T) {
+	h, _ := newTestHandler(t, ModeRequired)
+
+	recorder := serve(h, tokenRequest(taskIP, "21600"))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "21600", recorder.Header().Get(TokenTTLHeader))
+	assert.Equal(t, "no-store", recorder.Header().Get(utils.CacheControlHeader))
+	assert.NotEmpty(t, recorder.Body.String())
+}
+
+func TestIssueTokenInvalidRequests(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		req            func() *http.Request
+		expectedStatus int
+	}{
+		{
+			name: "GET",
+			req: func() *http.Request {
+				req := tokenRequest(taskIP, "60")
+				req.Method = http.MethodGet
+				return req
+			},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "no TTL",
+			req:            func() *http.Request { return tokenRequest(taskIP, "") },
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "TTL not a number",
+			req:            func() *http.Request { return tokenRequest(taskIP, "one minute") },
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "TTL too short",
+			req:            func() *http.Request { return tokenRequest(taskIP, "0") },
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "TTL too long",
+			req:            func() *http.Request { return tokenRequest(taskIP, "21601") },
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "forwarded",
+			req: func() *http.Request {
+				req := tokenRequest(taskIP, "60")
+				req.Header.Set("X-Forwarded-For", "192.0.2.1")
+				return req
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+			auditLogger.EXPECT().Log(gomock.Any(), tc.expectedStatus, "")
+			h, _ := newTestHandler(t, ModeOptional, WithAuditLogger(auditLogger))
+
+			recorder := serve(h, tc.req())
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			assert.Equal(t, ErrInvalidTokenRequest, errorCode(t, recorder))
+		})
+	}
+}
+
+func TestOptionalMode(t *testing.T) {
+	h, _ := newTestHandler(t, ModeOptional)
+	token := issueToken(t, h, taskIP, "60")
+
+	assert.Equal(t, http.StatusOK, serve(h, metadataRequest(taskIP, "")).Code,
+		"requests without tokens are served in optional mode")
+	assert.Equal(t, http.StatusOK, serve(h, metadataRequest(taskIP, token)).Code)
+
+	recorder := serve(h, metadataRequest(taskIP, "not-a-token"))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "invalid tokens are rejected in optional mode")
+	assert.Equal(t, ErrInvalidToken, errorCode(t, recorder))
+}
+
+func TestRequiredMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+	auditLogger.EXPECT().Log(gomock.Any(), http.StatusUnauthorized, "").Times(2)
+	h, _ := newTestHandler(t, ModeRequired, WithAuditLogger(auditLogger))
+	token := issueToken(t, h, taskIP, "60")
+
+	recorder := serve(h, metadataRequest(taskIP, ""))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, ErrTokenRequired, errorCode(t, recorder))
+
+	assert.Equal(t, http.StatusOK, serve(h, metadataRequest(taskIP, token)).Code)
+
+	// A token with a forged expiry is rejected
+	forged := []byte(token)
+	forged[0] ^= 1
+	recorder = serve(h, metadataRequest(taskIP, string(forged)))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, ErrInvalidToken, errorCode(t, recorder))
+}
+
+func TestTokenExpiry(t *testing.T) {
+	h, clock := newTestHandler(t, ModeRequired)
+	token := issueToken(t, h, taskIP, "60")
+
+	clock.now = clock.now.Add(59 * time.Second)
+	assert.Equal(t, http.StatusOK, serve(h, metadataRequest(taskIP, token)).Code)
+
+	clock.now = clock.now.Add(time.Second)
+	recorder := serve(h, metadataRequest(taskIP, token))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "expired tokens are rejected")
+	assert.Equal(t, ErrInvalidToken, errorCode(t, recorder))
+
+	// A new token is issued once the old one expired
+	token = issueToken(t, h, taskIP, "60")
+	assert.Equal(t, http.StatusOK, serve(h, metadataRequest(taskIP, token)).Code)
+}
+
+func TestCrossTaskReplay(t *testing.T) {
+	t.Run("source IP", func(t *testing.T) {
+		h, _ := newTestHandler(t, ModeRequired)
+		token := issueToken(t, h, taskIP, "60")
+
+		recorder := serve(h, metadataRequest(otherTaskIP, token))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, "tokens can't be replayed from another IP")
+		assert.Equal(t, ErrInvalidToken, errorCode(t, recorder))
+	})
+
+	t.Run("caller", func(t *testing.T) {
+		// The task that the IP belongs to changes, such as once the IP is reused
+		taskARN := "task1"
+		h, _ := newTestHandler(t, ModeRequired, WithCaller(func(r *http.Request) (string, error) {
+			return r.RemoteAddr[:strings.LastIndex(r.RemoteAddr, ":")] + "/" + taskARN, nil
+		}))
+		token := issueToken(t, h, taskIP, "60")
+		assert.Equal(t, http.StatusOK, serve(h, metadataRequest(taskIP, token)).Code)
+
+		taskARN = "task2"
+		recorder := serve(h, metadataRequest(taskIP, token))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, "tokens can't be replayed by another task")
+	})
+
+	t.Run("unknown caller", func(t *testing.T) {
+		h, _ := newTestHandler(t, ModeRequired, WithCaller(func(r *http.Request) (string, error) {
+			return "", errors.New("unknown task")
+		}))
+		recorder := serve(h, tokenRequest(taskIP, "60"))
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	})
+
+	t.Run("another handler", func(t *testing.T) {
+		// Tokens don't outlive the handler that issued them, such as across agent restarts
+		h, _ := newTestHandler(t, ModeRequired)
+		token := issueToken(t, h, taskIP, "60")
+		other, _ := newTestHandler(t, ModeRequired)
+		assert.Equal(t, http.StatusUnauthorized, serve(other, metadataRequest(taskIP, token)).Code)
+	})
+}
+
+func TestIssueRateLimit(t *testing.T) {
+	h, clock := newTestHandler(t, ModeRequired, WithIssueRate(1, 2))
+
+	issueToken(t, h, taskIP, "60")
+	issueToken(t, h, taskIP, "60")
+	recorder := serve(h, tokenRequest(taskIP, "60"))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, ErrTokenRequestThrottled, errorCode(t, recorder))
+
+	// The rate is per source IP
+	issueToken(t, h, otherTaskIP, "60")
+
+	// Tokens are issued again once the rate allows
+	clock.now = clock.now.Add(time.Second)
+	issueToken(t, h, taskIP, "60")
+}
+
+func TestForgetIdleSources(t *testing.T) {
+	h, clock := newTestHandler(t, ModeRequired)
+	for i := 0; i < maxTrackedSources; i++ {
+		require.True(t, h.allow(fmt.Sprintf("10.1.%d.%d", i/256, i%256)))
+	}
+	require.Len(t, h.sources, maxTrackedSources)
+
+	clock.now = clock.now.Add(sourceIdleTimeout)
+	require.True(t, h.allow(taskIP))
+	assert.Len(t, h.sources, 1, "the rates of idle source IPs weren't forgotten")
+}
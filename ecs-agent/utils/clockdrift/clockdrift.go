@@ -0,0 +1,180 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clockdrift estimates how far the host clock is off. Credentials are signed
+// and validated against the host clock, so a large skew makes them unusable well
+// before they expire.
+package clockdrift
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger"
+	"github.com/aws/amazon-ecs-agent/ecs-agent/logger/field"
+)
+
+const (
+	// SourceDateHeader means the skew was estimated from the Date header of an API response.
+	SourceDateHeader = "DateHeader"
+	// SourceNTP means the skew was estimated from an NTP query.
+	SourceNTP = "NTP"
+
+	// dateHeaderResolution is the resolution of the Date header, which is truncated to
+	// whole seconds.
+	dateHeaderResolution = time.Second
+)
+
+// Estimate is an estimate of the host clock skew. The skew is positive when the host
+// clock is ahead.
+type Estimate struct {
+	SkewSeconds      float64   `json:"SkewSeconds"`
+	Source           string    `json:"Source"`
+	MeasuredAt       time.Time `json:"MeasuredAt"`
+	ExceedsThreshold bool      `json:"ExceedsThreshold"`
+}
+
+// Estimator provides the latest clock skew estimate.
+type Estimator interface {
+	// Estimate returns the latest estimate, and false if the skew has not been
+	// estimated yet.
+	Estimate() (Estimate, bool)
+}
+
+// Checker estimates the host clock skew from the responses of API calls, or from NTP
+// queries if an NTP server is configured. Checks are rate limited to one per interval
+// and never block the API calls they are made from.
+type Checker struct {
+	threshold time.Duration
+	interval  time.Duration
+	ntpServer string
+	now       func() time.Time
+	queryNTP  func(server string) (time.Duration, error)
+
+	lock          sync.Mutex
+	estimate      *Estimate
+	lastCheckedAt time.Time
+	ntpInFlight   bool
+}
+
+// NewChecker creates a checker that checks the skew at most once per interval and
+// warns when it exceeds the threshold. The skew is estimated from API responses if
+// ntpServer is empty.
+func NewChecker(threshold, interval time.Duration, ntpServer string) *Checker {
+	return &Checker{
+		threshold: threshold,
+		interval:  interval,
+		ntpServer: ntpServer,
+		now:       time.Now,
+		queryNTP:  queryNTPOffset,
+	}
+}
+
+// ObserveResponse checks the skew against the Date header of a response that was
+// requested at sentAt and received at receivedAt, or starts an NTP query in the
+// background if an NTP server is configured. It returns straight away if a check was
+// done within the interval or another check is being recorded.
+func (c *Checker) ObserveResponse(sentAt, receivedAt time.Time, header http.Header) {
+	if c == nil {
+		return
+	}
+	var serverTime time.Time
+	if c.ntpServer == "" {
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			return
+		}
+		// The server time is anywhere within the second the header was truncated to
+		serverTime = date.Add(dateHeaderResolution / 2)
+	}
+
+	if !c.lock.TryLock() {
+		return
+	}
+	now := c.now()
+	if !c.lastCheckedAt.IsZero() && now.Sub(c.lastCheckedAt) < c.interval {
+		c.lock.Unlock()
+		return
+	}
+	c.lastCheckedAt = now
+
+	if c.ntpServer != "" {
+		if c.ntpInFlight {
+			c.lock.Unlock()
+			return
+		}
+		c.ntpInFlight = true
+		c.lock.Unlock()
+		go c.checkNTP()
+		return
+	}
+	// The server handled the request roughly halfway through the round trip
+	localTime := sentAt.Add(receivedAt.Sub(sentAt) / 2)
+	c.recordUnsafe(localTime.Sub(serverTime), SourceDateHeader, now)
+	c.lock.Unlock()
+}
+
+// Estimate returns the latest skew estimate, and false if the skew has not been
+// estimated yet.
+func (c *Checker) Estimate() (Estimate, bool) {
+	if c == nil {
+		return Estimate{}, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.estimate == nil {
+		return Estimate{}, false
+	}
+	return *c.estimate, true
+}
+
+func (c *Checker) checkNTP() {
+	offset, err := c.queryNTP(c.ntpServer)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ntpInFlight = false
+	if err != nil {
+		logger.Warn("Unable to query NTP server to check the host clock skew", logger.Fields{
+			"ntpServer": c.ntpServer,
+			field.Error: err,
+		})
+		return
+	}
+	// The offset is how far the server clock is ahead of the host clock
+	c.recordUnsafe(-offset, SourceNTP, c.now())
+}
+
+func (c *Checker) recordUnsafe(skew time.Duration, source string, measuredAt time.Time) {
+	exceeds := c.threshold > 0 && time.Duration(math.Abs(float64(skew))) > c.threshold
+	if exceeds {
+		logger.Warn("Host clock skew exceeds the threshold, credentials may be rejected before they expire", logger.Fields{
+			"skew":      skew.String(),
+			"threshold": c.threshold.String(),
+			"source":    source,
+		})
+	} else if c.estimate != nil && c.estimate.ExceedsThreshold {
+		logger.Info("Host clock skew is back within the threshold", logger.Fields{
+			"skew":   skew.String(),
+			"source": source,
+		})
+	}
+	c.estimate = &Estimate{
+		SkewSeconds:      skew.Seconds(),
+		Source:           source,
+		MeasuredAt:       measuredAt,
+		ExceedsThreshold: exceeds,
+	}
+}
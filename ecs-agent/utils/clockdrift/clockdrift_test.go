@@ -0,0 +1,143 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package clockdrift
+
+import (
+	"encoding/binary"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dateHeader(t time.Time) http.Header {
+	header := http.Header{}
+	header.Set("Date", t.UTC().Format(http.TimeFormat))
+	return header
+}
+
+func TestCheckerDateHeader(t *testing.T) {
+	host := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name         string
+		serverTime   time.Time
+		expectedSkew time.Duration
+		exceeds      bool
+	}{
+		{"in sync", host, -500 * time.Millisecond, false},
+		{"host ahead", host.Add(-3 * time.Minute), 3*time.Minute - 500*time.Millisecond, true},
+		{"host behind", host.Add(2 * time.Minute), -2*time.Minute - 500*time.Millisecond, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := NewChecker(time.Minute, time.Minute, "")
+			checker.now = func() time.Time { return host }
+			_, ok := checker.Estimate()
+			assert.False(t, ok)
+
+			// The request took 2 seconds, so the host time is taken at the midpoint
+			checker.ObserveResponse(host.Add(-time.Second), host.Add(time.Second), dateHeader(tc.serverTime))
+			estimate, ok := checker.Estimate()
+			require.True(t, ok)
+			assert.Equal(t, tc.expectedSkew.Seconds(), estimate.SkewSeconds)
+			assert.Equal(t, SourceDateHeader, estimate.Source)
+			assert.Equal(t, host, estimate.MeasuredAt)
+			assert.Equal(t, tc.exceeds, estimate.ExceedsThreshold)
+		})
+	}
+}
+
+func TestCheckerRateLimited(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	checker := NewChecker(time.Minute, 5*time.Minute, "")
+	checker.now = func() time.Time { return now }
+
+	// Responses without a usable Date header don't count as a check
+	checker.ObserveResponse(now, now, http.Header{})
+	checker.ObserveResponse(now, now, http.Header{"Date": []string{"yesterday"}})
+	_, ok := checker.Estimate()
+	assert.False(t, ok)
+
+	checker.ObserveResponse(now, now, dateHeader(now.Add(-10*time.Minute)))
+	estimate, _ := checker.Estimate()
+	assert.True(t, estimate.ExceedsThreshold)
+
+	now = now.Add(time.Minute)
+	checker.ObserveResponse(now, now, dateHeader(now))
+	estimate, _ = checker.Estimate()
+	assert.True(t, estimate.ExceedsThreshold, "checks within the interval are skipped")
+
+	now = now.Add(5 * time.Minute)
+	checker.ObserveResponse(now, now, dateHeader(now))
+	estimate, _ = checker.Estimate()
+	assert.False(t, estimate.ExceedsThreshold)
+	assert.Equal(t, now, estimate.MeasuredAt)
+}
+
+func TestCheckerNTP(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	checker := NewChecker(time.Minute, time.Minute, "ntp.example.com")
+	checker.now = func() time.Time { return now }
+	queried := make(chan string, 1)
+	release := make(chan struct{})
+	checker.queryNTP = func(server string) (time.Duration, error) {
+		queried <- server
+		<-release
+		return 90 * time.Second, nil
+	}
+
+	// The response headers are ignored, and the query doesn't block the caller
+	checker.ObserveResponse(now, now, http.Header{})
+	assert.Equal(t, "ntp.example.com", <-queried)
+	_, ok := checker.Estimate()
+	assert.False(t, ok)
+	close(release)
+
+	require.Eventually(t, func() bool {
+		_, ok := checker.Estimate()
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	estimate, _ := checker.Estimate()
+	assert.Equal(t, -90.0, estimate.SkewSeconds)
+	assert.Equal(t, SourceNTP, estimate.Source)
+	assert.True(t, estimate.ExceedsThreshold)
+}
+
+func TestNilChecker(t *testing.T) {
+	var checker *Checker
+	checker.ObserveResponse(time.Now(), time.Now(), dateHeader(time.Now()))
+	_, ok := checker.Estimate()
+	assert.False(t, ok)
+}
+
+func TestNTPOffset(t *testing.T) {
+	putNTPTime := func(b []byte, t time.Time) {
+		binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+		binary.BigEndian.PutUint32(b[4:8], uint32((int64(t.Nanosecond())<<32)/int64(time.Second)))
+	}
+	sentAt := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	receivedAt := sentAt.Add(100 * time.Millisecond)
+	// The server clock is 2 seconds ahead and took 20ms to respond
+	response := make([]byte, ntpPacketSize)
+	putNTPTime(response[32:40], sentAt.Add(2*time.Second+40*time.Millisecond))
+	putNTPTime(response[40:48], sentAt.Add(2*time.Second+60*time.Millisecond))
+
+	offset := ntpOffset(response, sentAt, receivedAt)
+	assert.InDelta(t, (2 * time.Second).Seconds(), offset.Seconds(), 1e-6)
+}
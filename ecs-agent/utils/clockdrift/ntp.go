@@ -0,0 +1,80 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package clockdrift
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	ntpPort       = "123"
+	ntpPacketSize = 48
+	ntpTimeout    = 5 * time.Second
+	// ntpClientRequest is the first byte of an SNTP client request: no leap warning,
+	// version 4, client mode.
+	ntpClientRequest = 0x23
+	// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and the
+	// Unix epoch (1970).
+	ntpEpochOffset = 2208988800
+)
+
+// queryNTPOffset sends a single SNTP request to the server and returns how far the
+// server clock is ahead of the host clock.
+func queryNTPOffset(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, ntpPort)
+	}
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(ntpTimeout)); err != nil {
+		return 0, err
+	}
+
+	request := make([]byte, ntpPacketSize)
+	request[0] = ntpClientRequest
+	sentAt := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	response := make([]byte, ntpPacketSize)
+	n, err := conn.Read(response)
+	receivedAt := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < ntpPacketSize {
+		return 0, fmt.Errorf("short NTP response of %d bytes", n)
+	}
+	return ntpOffset(response, sentAt, receivedAt), nil
+}
+
+// ntpOffset computes the clock offset from an SNTP response as described in RFC 4330.
+func ntpOffset(response []byte, sentAt, receivedAt time.Time) time.Duration {
+	serverReceivedAt := ntpTime(response[32:40])
+	serverSentAt := ntpTime(response[40:48])
+	return (serverReceivedAt.Sub(sentAt) + serverSentAt.Sub(receivedAt)) / 2
+}
+
+// ntpTime decodes a 64 bit NTP timestamp.
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(seconds, (fraction*int64(time.Second))>>32)
+}
@@ -0,0 +1,182 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnectionStatus is the state of the connections of a websocket client to its backend
+// since the agent started. It never holds the query string of the URL of the backend or
+// any credentials, so that it is safe to expose locally.
+type ConnectionStatus struct {
+	// Connected is whether the client is connected
+	Connected bool `json:"Connected"`
+	// Endpoint is the scheme, host and path of the URL of the last connection attempt
+	Endpoint string `json:"Endpoint,omitempty"`
+	// LastConnectedAt is when the client last connected successfully
+	LastConnectedAt *time.Time `json:"LastConnectedAt,omitempty"`
+	// LastHeartbeatAt is when the last heartbeat of the backend was received
+	LastHeartbeatAt *time.Time `json:"LastHeartbeatAt,omitempty"`
+	// LastDisconnectedAt is when the client was last disconnected, or last failed to connect
+	LastDisconnectedAt *time.Time `json:"LastDisconnectedAt,omitempty"`
+	// LastDisconnectError is the error that the client was last disconnected with, or
+	// last failed to connect with. It is empty if the connection was closed for a valid
+	// reason.
+	LastDisconnectError string `json:"LastDisconnectError,omitempty"`
+	// Connects is the number of successful connections
+	Connects uint64 `json:"Connects"`
+	// Reconnects is the number of successful connections after the first one
+	Reconnects uint64 `json:"Reconnects"`
+	// ConnectFailures is the number of connection attempts that failed
+	ConnectFailures uint64 `json:"ConnectFailures"`
+}
+
+// ConnectionStatusReporter reports the state of the connections of a websocket client.
+type ConnectionStatusReporter interface {
+	ConnectionStatus() ConnectionStatus
+}
+
+// ConnectionTracker tracks the connections of a websocket client to its backend for
+// diagnostics. A nil tracker tracks nothing, so that sessions don't have to check whether
+// connections are tracked. It is safe for concurrent use.
+type ConnectionTracker struct {
+	now func() time.Time
+
+	lock   sync.Mutex
+	status ConnectionStatus
+	// url is the URL of the last connection attempt, which is redacted from errors
+	url string
+}
+
+// NewConnectionTracker creates a tracker of the connections of a websocket client.
+func NewConnectionTracker() *ConnectionTracker {
+	return &ConnectionTracker{now: time.Now}
+}
+
+// Connecting records that the client attempts to connect to the URL.
+func (t *ConnectionTracker) Connecting(rawURL string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.url = rawURL
+	t.status.Endpoint = redactURL(rawURL)
+}
+
+// Connected records that the client connected successfully.
+func (t *ConnectionTracker) Connected() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	if t.status.Connects > 0 {
+		t.status.Reconnects++
+	}
+	t.status.Connects++
+	t.status.Connected = true
+	t.status.LastConnectedAt = &now
+}
+
+// ConnectFailed records that the client failed to connect with the error.
+func (t *ConnectionTracker) ConnectFailed(err error) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.ConnectFailures++
+	t.disconnectedUnsafe(err)
+}
+
+// Heartbeat records that a heartbeat of the backend was received.
+func (t *ConnectionTracker) Heartbeat() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	t.status.LastHeartbeatAt = &now
+}
+
+// Disconnected records that the client was disconnected with the error, which is nil if
+// the connection was closed for a valid reason.
+func (t *ConnectionTracker) Disconnected(err error) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.disconnectedUnsafe(err)
+}
+
+func (t *ConnectionTracker) disconnectedUnsafe(err error) {
+	now := t.now()
+	t.status.Connected = false
+	t.status.LastDisconnectedAt = &now
+	t.status.LastDisconnectError = ""
+	if err != nil {
+		t.status.LastDisconnectError = t.redactError(err)
+	}
+}
+
+// ConnectionStatus returns the state of the connections of the client.
+func (t *ConnectionTracker) ConnectionStatus() ConnectionStatus {
+	if t == nil {
+		return ConnectionStatus{}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	status := t.status
+	status.LastConnectedAt = copyTime(status.LastConnectedAt)
+	status.LastHeartbeatAt = copyTime(status.LastHeartbeatAt)
+	status.LastDisconnectedAt = copyTime(status.LastDisconnectedAt)
+	return status
+}
+
+// redactError returns the message of the error, in which the URL of the connection is
+// replaced with the redacted endpoint.
+func (t *ConnectionTracker) redactError(err error) string {
+	message := err.Error()
+	if t.url != "" {
+		message = strings.ReplaceAll(message, t.url, t.status.Endpoint)
+	}
+	return message
+}
+
+// redactURL returns the scheme, host and path of the URL, without its user info, query
+// string and fragment.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	redacted := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	return redacted.String()
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}